@@ -0,0 +1,350 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// aliasNamePattern matches a capitalized name of one to three words.
+const aliasNamePattern = `\p{Lu}[\p{L}'’-]*(?:\s+\p{Lu}[\p{L}'’-]*){0,2}`
+
+// akaPattern finds explicit co-reference: "Robert Smith aka Bob", "Priya (also known as P)".
+var akaPattern = regexp.MustCompile(`(` + aliasNamePattern + `)\s*,?\s*\(?\s*(?i:aka|a\.k\.a\.?|also known as|also called|goes by|nicknamed)\s+["“']?(` + aliasNamePattern + `)`)
+
+// vocativePattern finds a name used to address someone: "Thanks, Sam", "hey Sammy!".
+var vocativePattern = regexp.MustCompile(`(?i:\b(?:hi|hey|hello|thanks|thank you|cheers|sorry|okay|ok|sure|yes|no|morning|good night))[,!]?\s+(\p{Lu}\p{L}+)\b`)
+
+// vocativeStopwords are capitalized words that follow greetings without being names.
+var vocativeStopwords = map[string]bool{
+	"i": true, "the": true, "that": true, "this": true, "there": true, "you": true,
+	"we": true, "it": true, "so": true, "but": true, "and": true, "problem": true,
+	"worries": true, "way": true, "idea": true, "again": true, "everyone": true, "all": true,
+}
+
+// AliasSuggestion is a group of names that appear to refer to the same entity. The
+// first name is the suggested canonical one.
+type AliasSuggestion struct {
+	Names    []string
+	Reasons  []string
+	Evidence int
+}
+
+type aliasCandidate struct {
+	names    []string
+	reasons  []string
+	evidence int
+}
+
+// aliasCandidates accumulates suggestions keyed by their sorted, lowercased names so
+// a group found by several signals is reported once.
+type aliasCandidates map[string]*aliasCandidate
+
+func (c aliasCandidates) add(names []string, reason string, evidence int) {
+	keys := make([]string, len(names))
+	for i, n := range names {
+		keys[i] = strings.ToLower(n)
+	}
+	sort.Strings(keys)
+	key := strings.Join(keys, "\x00")
+
+	existing, ok := c[key]
+	if !ok {
+		c[key] = &aliasCandidate{names: names, reasons: []string{reason}, evidence: evidence}
+		return
+	}
+	existing.evidence += evidence
+	if !containsFold(existing.reasons, reason) {
+		existing.reasons = append(existing.reasons, reason)
+	}
+}
+
+// SuggestAliases looks for names that co-refer and returns alias groups seen at least
+// minEvidence times, strongest first. Three signals are used:
+//   - explicit phrases in chunks and messages ("X aka Y", "X, also known as Y")
+//   - known entities where one name extends the other ("Bob" / "Bob Smith", "Rob" /
+//     "Robert") and both appear in the same sessions
+//   - different names used to address the same speaker in replies ("thanks, Sam")
+//
+// Groups already covered by stored aliases or MNEME_ALIASES are left out.
+func SuggestAliases(db *sql.DB, minEvidence int) ([]AliasSuggestion, error) {
+	if minEvidence <= 0 {
+		minEvidence = 2
+	}
+	candidates := aliasCandidates{}
+
+	if err := suggestFromAkaPhrases(db, candidates); err != nil {
+		return nil, err
+	}
+	if err := suggestFromSharedSessions(db, candidates); err != nil {
+		return nil, err
+	}
+	if err := suggestFromReplies(db, candidates, minEvidence); err != nil {
+		return nil, err
+	}
+
+	suggestions := []AliasSuggestion{}
+	for _, c := range candidates {
+		if c.evidence < minEvidence {
+			continue
+		}
+		known, err := aliasesKnown(db, c.names)
+		if err != nil {
+			return nil, err
+		}
+		if known {
+			continue
+		}
+		suggestions = append(suggestions, AliasSuggestion{Names: c.names, Reasons: c.reasons, Evidence: c.evidence})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Evidence != suggestions[j].Evidence {
+			return suggestions[i].Evidence > suggestions[j].Evidence
+		}
+		return suggestions[i].Names[0] < suggestions[j].Names[0]
+	})
+	return suggestions, nil
+}
+
+func suggestFromAkaPhrases(db *sql.DB, candidates aliasCandidates) error {
+	rows, err := db.Query(
+		`SELECT text FROM chunks WHERE text LIKE '%aka%' OR text LIKE '%a.k.a%' OR text LIKE '%known as%'
+		     OR text LIKE '%also called%' OR text LIKE '%goes by%' OR text LIKE '%nicknamed%'
+		 UNION ALL
+		 SELECT text FROM messages WHERE text LIKE '%aka%' OR text LIKE '%a.k.a%' OR text LIKE '%known as%'
+		     OR text LIKE '%also called%' OR text LIKE '%goes by%' OR text LIKE '%nicknamed%'`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return err
+		}
+		for _, m := range akaPattern.FindAllStringSubmatch(text, -1) {
+			name, alias := cleanEntityName(m[1]), cleanEntityName(m[2])
+			if name == "" || alias == "" || strings.EqualFold(name, alias) {
+				continue
+			}
+			candidates.add([]string{name, alias}, "aka", 1)
+		}
+	}
+	return rows.Err()
+}
+
+// suggestFromSharedSessions pairs people whose names extend one another and counts
+// the source files (sessions) that mention both.
+func suggestFromSharedSessions(db *sql.DB, candidates aliasCandidates) error {
+	rows, err := db.Query(
+		`SELECT e.name, c.source_file
+		 FROM entities e
+		 JOIN chunk_entities ce ON ce.entity_id = e.id
+		 JOIN chunks c ON c.id = ce.chunk_id
+		 WHERE e.kind IN ('person', '')
+		 GROUP BY e.id, c.source_file`,
+	)
+	if err != nil {
+		return err
+	}
+	sessions := make(map[string]map[string]bool)
+	var names []string
+	for rows.Next() {
+		var name, source string
+		if err := rows.Scan(&name, &source); err != nil {
+			rows.Close()
+			return err
+		}
+		if sessions[name] == nil {
+			sessions[name] = make(map[string]bool)
+			names = append(names, name)
+		}
+		sessions[name][source] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sort.Strings(names)
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			long, short := a, b
+			if len(short) > len(long) {
+				long, short = short, long
+			}
+			if !nameExtends(long, short) {
+				continue
+			}
+			shared := 0
+			for source := range sessions[short] {
+				if sessions[long][source] {
+					shared++
+				}
+			}
+			if shared > 0 {
+				candidates.add([]string{long, short}, "same sessions", shared)
+			}
+		}
+	}
+	return nil
+}
+
+// nameExtends reports whether short is a shorter form of long: a subset of its words
+// ("Bob" of "Bob Smith", "Smith" of "Bob Smith") or a prefix of its first word of at
+// least three letters ("Rob" of "Robert").
+func nameExtends(long, short string) bool {
+	longWords := strings.Fields(strings.ToLower(long))
+	shortWords := strings.Fields(strings.ToLower(short))
+	if len(shortWords) == 0 || len(longWords) == 0 {
+		return false
+	}
+	if len(shortWords) < len(longWords) {
+		subset := true
+		for _, w := range shortWords {
+			if !containsFold(longWords, w) {
+				subset = false
+				break
+			}
+		}
+		if subset {
+			return true
+		}
+	}
+	first := shortWords[0]
+	return len(shortWords) == 1 && len([]rune(first)) >= 3 &&
+		longWords[0] != first && strings.HasPrefix(longWords[0], first)
+}
+
+// suggestFromReplies collects the names each role is addressed by in the reply that
+// follows its messages. A role addressed by several names suggests they co-refer.
+func suggestFromReplies(db *sql.DB, candidates aliasCandidates, minEvidence int) error {
+	rows, err := db.Query(`SELECT session_id, role, text FROM messages ORDER BY session_id, timestamp, id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	addressed := make(map[string]map[string]int)
+	display := make(map[string]string)
+	var prevSession, prevRole string
+	for rows.Next() {
+		var session, role, text string
+		if err := rows.Scan(&session, &role, &text); err != nil {
+			return err
+		}
+		if session == prevSession && prevRole != "" && role != prevRole {
+			for _, m := range vocativePattern.FindAllStringSubmatch(text, -1) {
+				key := strings.ToLower(m[1])
+				if vocativeStopwords[key] {
+					continue
+				}
+				if addressed[prevRole] == nil {
+					addressed[prevRole] = make(map[string]int)
+				}
+				addressed[prevRole][key]++
+				display[key] = m[1]
+			}
+		}
+		prevSession, prevRole = session, role
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for role, counts := range addressed {
+		var names []string
+		for key, n := range counts {
+			if n >= minEvidence {
+				names = append(names, key)
+			}
+		}
+		if len(names) < 2 {
+			continue
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if counts[names[i]] != counts[names[j]] {
+				return counts[names[i]] > counts[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		group := make([]string, len(names))
+		evidence := counts[names[0]]
+		for i, key := range names {
+			group[i] = display[key]
+			evidence = min(evidence, counts[key])
+		}
+		candidates.add(group, "addressed in replies to "+role, evidence)
+	}
+	return nil
+}
+
+// aliasesKnown reports whether every name already resolves to the same entity or
+// sits in one MNEME_ALIASES group.
+func aliasesKnown(db *sql.DB, names []string) (bool, error) {
+	group := resolveAliases(names[0])
+	if len(group) > 1 {
+		all := true
+		for _, n := range names[1:] {
+			if !containsFold(group, n) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true, nil
+		}
+	}
+
+	var entityID int64
+	for _, n := range names {
+		ids, err := entityIDsForName(db, n)
+		if err != nil {
+			return false, err
+		}
+		if len(ids) != 1 || (entityID != 0 && ids[0] != entityID) {
+			return false, nil
+		}
+		entityID = ids[0]
+	}
+	return true, nil
+}
+
+// ApplyAliasSuggestion stores a suggestion: the first name becomes (or stays) the
+// entity, other entities in the group are merged into it, and remaining names become
+// its aliases.
+func ApplyAliasSuggestion(db *sql.DB, s AliasSuggestion) error {
+	canonical := s.Names[0]
+	if _, err := findEntityID(db, canonical); err == sql.ErrNoRows {
+		err := withWriteTx(db, "apply alias", func(tx *sql.Tx) error {
+			_, _, err := upsertEntity(tx, canonical, entityKindPerson)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	for _, name := range s.Names[1:] {
+		var other int64
+		err := db.QueryRow(`SELECT id FROM entities WHERE name = ?`, name).Scan(&other)
+		switch {
+		case err == nil:
+			if _, err := MergeEntities(db, canonical, name); err != nil {
+				return err
+			}
+		case err == sql.ErrNoRows:
+			if _, err := AddEntityAlias(db, name, canonical); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+	return nil
+}
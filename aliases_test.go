@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNameExtends(t *testing.T) {
+	tests := []struct {
+		long, short string
+		want        bool
+	}{
+		{"Bob Smith", "Bob", true},
+		{"Bob Smith", "smith", true},
+		{"Robert", "Rob", true},
+		{"Robert Smith", "Rob", true},
+		{"Alexander", "Al", false},
+		{"Bob Smith", "Bob Jones", false},
+		{"Bob", "Bob", false},
+	}
+	for _, tt := range tests {
+		if got := nameExtends(tt.long, tt.short); got != tt.want {
+			t.Errorf("nameExtends(%q, %q) = %v, want %v", tt.long, tt.short, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestAliases(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	insertChunk(t, db, "Lunch with Robert Smith aka Bob today.", "a.md", "Lunch", "", 2, "", vec)
+	insertChunk(t, db, "Robert Smith (a.k.a. Bob) sent the contract.", "b.md", "Contract", "", 2, "", vec)
+	insertChunk(t, db, "Priya Patel reviewed the plan; Priya liked it.", "s1.md", "Review", "", 2, "", vec)
+	insertChunk(t, db, "Call with Priya Patel. Priya will follow up.", "s2.md", "Call", "", 2, "", vec)
+
+	for _, name := range []string{"Priya Patel", "Priya"} {
+		if _, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES (?, 'person', '2025-01-01T00:00:00Z')`, name); err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+	}
+	if err := ReindexEntityMentions(db); err != nil {
+		t.Fatalf("ReindexEntityMentions: %v", err)
+	}
+
+	messages := []struct{ role, text string }{
+		{"user", "Can you check the deploy?"},
+		{"assistant", "Sure, Sam. It finished."},
+		{"user", "And the logs?"},
+		{"assistant", "Hey Sammy, nothing unusual."},
+		{"user", "Great."},
+		{"assistant", "Thanks, Sam!"},
+		{"user", "Bye."},
+		{"assistant", "Night, ok Sammy."},
+	}
+	for i, m := range messages {
+		if _, err := db.Exec(
+			`INSERT INTO messages (id, session_id, role, timestamp, text) VALUES (?, 'sess', ?, ?, ?)`,
+			fmt.Sprintf("m%d", i), m.role, i, m.text,
+		); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+
+	suggestions, err := SuggestAliases(db, 2)
+	if err != nil {
+		t.Fatalf("SuggestAliases: %v", err)
+	}
+	got := make(map[string]AliasSuggestion)
+	for _, s := range suggestions {
+		got[strings.Join(s.Names, "|")] = s
+	}
+	if s, ok := got["Robert Smith|Bob"]; !ok || s.Reasons[0] != "aka" || s.Evidence != 2 {
+		t.Fatalf("expected aka suggestion, got %+v", suggestions)
+	}
+	if s, ok := got["Priya Patel|Priya"]; !ok || s.Evidence != 2 {
+		t.Fatalf("expected shared-session suggestion, got %+v", suggestions)
+	}
+	if s, ok := got["Sam|Sammy"]; !ok || s.Reasons[0] != "addressed in replies to user" {
+		t.Fatalf("expected reply suggestion, got %+v", suggestions)
+	}
+
+	for _, s := range suggestions {
+		if err := ApplyAliasSuggestion(db, s); err != nil {
+			t.Fatalf("ApplyAliasSuggestion(%v): %v", s.Names, err)
+		}
+	}
+	if id, err := findEntityID(db, "Bob"); err != nil || id == 0 {
+		t.Fatalf("expected Bob to resolve after apply: %v", err)
+	}
+	if history, err := History(db, "Priya", 10); err != nil || len(history) != 2 {
+		t.Fatalf("expected merged Priya history, got %d, %v", len(history), err)
+	}
+
+	suggestions, err = SuggestAliases(db, 2)
+	if err != nil {
+		t.Fatalf("SuggestAliases after apply: %v", err)
+	}
+	if len(suggestions) != 0 {
+		t.Fatalf("expected applied groups to be left out, got %+v", suggestions)
+	}
+}
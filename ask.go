@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// askMaxWords caps the retrieved text put in front of the model, best match first.
+const askMaxWords = 3000
+
+const askPrompt = `You answer questions from someone's own notes and conversations.
+You are given numbered sources, each with where it came from and when it was written, followed by a question.
+Rules:
+- Answer only from the sources. If they do not answer the question, say so plainly instead of guessing.
+- Cite every claim with the number of the source it comes from, like [2]; cite several as [1][3].
+- When sources disagree, prefer the most recent and say that it changed.
+- Be concise: a few sentences, or a short list when the question asks for several things.`
+
+// Answer is an ask run: the generated answer and the chunks it was given, numbered as
+// the answer cites them.
+type Answer struct {
+	Question string         `json:"question"`
+	Text     string         `json:"answer"`
+	Sources  []SearchResult `json:"sources"`
+}
+
+// Ask searches for chunks relevant to question and has model answer it from them, citing
+// each by its number. With nothing retrieved no model call is made and the answer is
+// empty.
+func Ask(ctx context.Context, db *sql.DB, ollama *OllamaClient, model, question string, opts SearchOptions) (*Answer, error) {
+	opts.ByRelevance = true
+	results, err := SearchWithOptions(ctx, db, ollama, question, opts)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	answer := &Answer{Question: question, Sources: askSources(results)}
+	if len(answer.Sources) == 0 {
+		return answer, nil
+	}
+	text, err := ollama.GenerateAnswer(ctx, model, askPrompt, buildAskPrompt(question, answer.Sources))
+	if err != nil {
+		return nil, fmt.Errorf("generate answer: %w", err)
+	}
+	answer.Text = strings.TrimSpace(text)
+	return answer, nil
+}
+
+// askSources keeps the best matches that fit in askMaxWords, always at least one.
+func askSources(results []SearchResult) []SearchResult {
+	words := 0
+	for i, r := range results {
+		words += len(strings.Fields(r.Text))
+		if words > askMaxWords && i > 0 {
+			return results[:i]
+		}
+	}
+	return results
+}
+
+// buildAskPrompt numbers the sources from 1 and puts the question after them.
+func buildAskPrompt(question string, sources []SearchResult) string {
+	var b strings.Builder
+	for i, r := range sources {
+		fmt.Fprintf(&b, "[%d] %s — %s (%s)\n%s\n\n", i+1, r.SourceFile, r.SectionTitle, dateLabel(r.ValidAt), strings.TrimSpace(r.Text))
+	}
+	fmt.Fprintf(&b, "Question: %s\n", question)
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAsk(t *testing.T) {
+	var prompt, model string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			prompt, model = req.Prompt, req.Model
+			json.NewEncoder(w).Encode(generateResponse{Response: " Postgres, for its ledger support [1].\n"})
+		case "/api/embed":
+			vec := make([]float64, EmbedDimension)
+			vec[0] = 1
+			json.NewEncoder(w).Encode(embedResponse{Embeddings: [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	answer, err := Ask(context.Background(), db, client, "query-model", "Which database?", SearchOptions{Limit: 5})
+	if err != nil {
+		t.Fatalf("Ask: %v", err)
+	}
+	if answer.Text != "" || len(answer.Sources) != 0 || prompt != "" {
+		t.Fatalf("expected no model call with nothing retrieved, got %+v", answer)
+	}
+
+	insertChunk(t, db, "We chose Postgres for the ledger.", "decisions.md", "Ledger", "", 2, "2025-03-01", makeVec(map[int]float32{0: 1}))
+	if answer, err = Ask(context.Background(), db, client, "query-model", "Which database?", SearchOptions{Limit: 5}); err != nil {
+		t.Fatalf("Ask: %v", err)
+	}
+	if answer.Text != "Postgres, for its ledger support [1]." || len(answer.Sources) != 1 || model != "query-model" {
+		t.Fatalf("unexpected answer %+v from %s", answer, model)
+	}
+	if !strings.Contains(prompt, "[1] decisions.md — Ledger (2025-03-01)\nWe chose Postgres for the ledger.") || !strings.HasSuffix(prompt, "Question: Which database?\n") {
+		t.Fatalf("unexpected prompt %q", prompt)
+	}
+}
+
+func TestAskSources(t *testing.T) {
+	long := strings.Repeat("word ", askMaxWords)
+	results := []SearchResult{{ID: 1, Text: long}, {ID: 2, Text: "short"}}
+	if got := askSources(results); len(got) != 1 {
+		t.Fatalf("expected the sources capped at %d words, got %d", askMaxWords, len(got))
+	}
+	if got := askSources([]SearchResult{{ID: 1, Text: long + long}}); len(got) != 1 {
+		t.Fatal("expected the best match kept however long")
+	}
+}
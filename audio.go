@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultTranscriptSection is how much of a recording one transcript section covers.
+const defaultTranscriptSection = 5 * time.Minute
+
+// transcriptSegment is a stretch of speech and where in the recording it was said.
+type transcriptSegment struct {
+	Start, End time.Duration
+	Text       string
+}
+
+// transcriber turns a recording into timed text.
+type transcriber interface {
+	transcribe(ctx context.Context, path string) ([]transcriptSegment, error)
+}
+
+// newTranscriber picks the HTTP endpoint when url is set, and the whisper.cpp command
+// otherwise.
+func newTranscriber(url, command, model string) transcriber {
+	if url != "" {
+		return whisperServer{url: url, model: model, client: &http.Client{Timeout: 30 * time.Minute}}
+	}
+	return whisperCLI{command: command, model: model}
+}
+
+// whisperCLI runs whisper.cpp's command line tool. Recordings other than WAV are converted
+// to the 16 kHz mono WAV it reads with ffmpeg first.
+type whisperCLI struct {
+	command string
+	model   string
+}
+
+func (w whisperCLI) transcribe(ctx context.Context, path string) ([]transcriptSegment, error) {
+	if w.model == "" {
+		return nil, fmt.Errorf("whisper.cpp needs a model: set --whisper-model or $MNEME_WHISPER_MODEL")
+	}
+	dir, err := os.MkdirTemp("", "mneme-audio-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := path
+	if !strings.EqualFold(filepath.Ext(path), ".wav") {
+		input = filepath.Join(dir, "audio.wav")
+		if err := runTool(ctx, "ffmpeg", "-nostdin", "-loglevel", "error", "-i", path, "-ar", "16000", "-ac", "1", input); err != nil {
+			return nil, err
+		}
+	}
+	out := filepath.Join(dir, "transcript")
+	if err := runTool(ctx, w.command, "-m", w.model, "-f", input, "-oj", "-of", out, "-np"); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(out + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("%s wrote no transcript: %w", w.command, err)
+	}
+	return parseWhisperCPPJSON(data)
+}
+
+// runTool runs an external program, failing with what it printed.
+func runTool(ctx context.Context, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// parseWhisperCPPJSON reads the file whisper.cpp writes with -oj, which times each
+// segment in milliseconds.
+func parseWhisperCPPJSON(data []byte) ([]transcriptSegment, error) {
+	var out struct {
+		Transcription []struct {
+			Offsets struct {
+				From int64 `json:"from"`
+				To   int64 `json:"to"`
+			} `json:"offsets"`
+			Text string `json:"text"`
+		} `json:"transcription"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("read whisper.cpp transcript: %w", err)
+	}
+	var segments []transcriptSegment
+	for _, s := range out.Transcription {
+		segments = append(segments, transcriptSegment{
+			Start: time.Duration(s.Offsets.From) * time.Millisecond,
+			End:   time.Duration(s.Offsets.To) * time.Millisecond,
+			Text:  s.Text,
+		})
+	}
+	return segments, nil
+}
+
+// whisperServer posts recordings to an OpenAI-compatible transcription endpoint, such as
+// whisper.cpp's server (/inference) or a local /v1/audio/transcriptions.
+type whisperServer struct {
+	url    string
+	model  string
+	client *http.Client
+}
+
+func (w whisperServer) transcribe(ctx context.Context, path string) ([]transcriptSegment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, err
+	}
+	form.WriteField("response_format", "verbose_json")
+	if w.model != "" {
+		form.WriteField("model", w.model)
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("transcribe %s: %w", filepath.Base(path), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("transcribe %s: %s: %s", filepath.Base(path), resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var out struct {
+		Text     string `json:"text"`
+		Segments []struct {
+			Start float64 `json:"start"`
+			End   float64 `json:"end"`
+			Text  string  `json:"text"`
+		} `json:"segments"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("transcribe %s: decode response: %w", filepath.Base(path), err)
+	}
+	if len(out.Segments) == 0 {
+		// Endpoints that ignore verbose_json give the text alone
+		return []transcriptSegment{{Text: out.Text}}, nil
+	}
+	segments := make([]transcriptSegment, 0, len(out.Segments))
+	for _, s := range out.Segments {
+		segments = append(segments, transcriptSegment{
+			Start: time.Duration(s.Start * float64(time.Second)),
+			End:   time.Duration(s.End * float64(time.Second)),
+			Text:  s.Text,
+		})
+	}
+	return segments, nil
+}
+
+// buildTranscriptMarkdown renders a transcript as sections each covering about every of
+// the recording, titled by the time range they span, with each segment on its own line
+// after the time it starts at.
+func buildTranscriptMarkdown(segments []transcriptSegment, every time.Duration) string {
+	if every <= 0 {
+		every = defaultTranscriptSection
+	}
+	var b strings.Builder
+	var lines []string
+	var start, end time.Duration
+	flush := func() {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "## %s–%s\n\n%s\n\n", transcriptTime(start), transcriptTime(end), strings.Join(lines, "\n"))
+		lines = nil
+	}
+	for _, s := range segments {
+		text := strings.Join(strings.Fields(s.Text), " ")
+		// whisper marks silence and noise as [BLANK_AUDIO], (music) and the like
+		if text == "" || strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			continue
+		}
+		if len(lines) > 0 && s.Start >= start+every {
+			flush()
+		}
+		if len(lines) == 0 {
+			start = s.Start
+		}
+		end = max(end, s.End)
+		lines = append(lines, "["+transcriptTime(s.Start)+"] "+text)
+	}
+	flush()
+	return b.String()
+}
+
+// transcriptTime formats an offset into a recording as m:ss, or h:mm:ss past an hour.
+func transcriptTime(d time.Duration) string {
+	seconds := int(d / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// IngestAudio transcribes the recording at path and ingests the transcript with the
+// recording as its source, so transcribing it again replaces what it held. Sections
+// without a date of their own are dated validAt.
+func IngestAudio(ctx context.Context, db *sql.DB, ollama *OllamaClient, t transcriber, path, validAt string, every time.Duration, chunking ChunkOptions, progress ProgressFunc) (IngestResult, error) {
+	segments, err := t.transcribe(ctx, path)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	md := buildTranscriptMarkdown(segments, every)
+	if md == "" {
+		return IngestResult{}, fmt.Errorf("%s: no speech found", path)
+	}
+	return IngestMarkdown(ctx, db, ollama, path, strings.NewReader(md), validAt, chunking, progress)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildTranscriptMarkdown(t *testing.T) {
+	segments := []transcriptSegment{
+		{0, 4 * time.Second, " Remind me to call the landlord"},
+		{4 * time.Second, 6 * time.Second, "[BLANK_AUDIO]"},
+		{200 * time.Second, 210 * time.Second, "about the heating."},
+		{6 * time.Minute, 6*time.Minute + 5*time.Second, "Also the  dentist is on Friday."},
+	}
+	sections := ParseMarkdown(buildTranscriptMarkdown(segments, 5*time.Minute))
+	if len(sections) != 2 {
+		t.Fatalf("expected two sections, got %+v", sections)
+	}
+	if sections[0].Title != "0:00–3:30" || sections[0].ValidAt != "" || sections[0].Content != "[0:00] Remind me to call the landlord\n[3:20] about the heating." {
+		t.Fatalf("unexpected first section %+v", sections[0])
+	}
+	if sections[1].Title != "6:00–6:05" || sections[1].Content != "[6:00] Also the dentist is on Friday." {
+		t.Fatalf("unexpected second section %+v", sections[1])
+	}
+	if got := transcriptTime(time.Hour + 2*time.Minute + 3*time.Second); got != "1:02:03" {
+		t.Fatalf("expected 1:02:03, got %s", got)
+	}
+	if md := buildTranscriptMarkdown([]transcriptSegment{{Text: "[BLANK_AUDIO]"}}, 0); md != "" {
+		t.Fatalf("expected silence to leave nothing, got %q", md)
+	}
+}
+
+func TestIngestAudioFromServer(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+
+	var format, filename string
+	whisper := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format = r.FormValue("response_format")
+		if _, header, err := r.FormFile("file"); err == nil {
+			filename = header.Filename
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"text":     "Parking spot is B14.",
+			"segments": []map[string]any{{"start": 1.5, "end": 3.0, "text": " Parking spot is B14."}},
+		})
+	}))
+	defer whisper.Close()
+
+	path := filepath.Join(t.TempDir(), "memo.m4a")
+	os.WriteFile(path, []byte("not really audio"), 0o644)
+	result, err := IngestAudio(context.Background(), db, NewOllamaClient(server.URL, "embed"), newTranscriber(whisper.URL, "", ""), path, "2026-01-21", 0, defaultChunking, nil)
+	if err != nil {
+		t.Fatalf("IngestAudio: %v", err)
+	}
+	if format != "verbose_json" || filename != "memo.m4a" || len(result.ChunkIDs) != 1 {
+		t.Fatalf("expected the recording posted for timed segments and one chunk stored, got %q, %q, %+v", format, filename, result)
+	}
+	var text, validAt string
+	db.QueryRow(`SELECT text, valid_at FROM chunks WHERE source_file = ?`, path).Scan(&text, &validAt)
+	if !strings.Contains(text, "[0:01] Parking spot is B14.") || validAt != "2026-01-21" {
+		t.Fatalf("unexpected chunk %q dated %q", text, validAt)
+	}
+}
+
+func TestWhisperCLI(t *testing.T) {
+	dir := t.TempDir()
+	// Stands in for whisper-cli: writes a transcript wherever -of points
+	script := filepath.Join(dir, "whisper")
+	os.WriteFile(script, []byte(`#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in -of) out="$2"; shift ;; esac
+	shift
+done
+printf '{"transcription": [{"offsets": {"from": 0, "to": 2500}, "text": " Buy milk"}]}' > "$out.json"
+`), 0o755)
+	path := filepath.Join(dir, "memo.wav")
+	os.WriteFile(path, []byte("RIFF"), 0o644)
+
+	segments, err := newTranscriber("", script, "ggml-base.bin").transcribe(context.Background(), path)
+	if err != nil {
+		t.Fatalf("transcribe: %v", err)
+	}
+	if len(segments) != 1 || segments[0].End != 2500*time.Millisecond || segments[0].Text != " Buy milk" {
+		t.Fatalf("unexpected segments %+v", segments)
+	}
+	if _, err := newTranscriber("", script, "").transcribe(context.Background(), path); err == nil {
+		t.Fatal("expected a missing model reported")
+	}
+}
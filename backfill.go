@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+)
+
+// backfillSession is a past session to ingest in full.
+type backfillSession struct {
+	ID           string
+	Title        string
+	SourcePrefix string // watch://<id>/ or watch-cc://<id>/, as its watcher writes
+	Messages     []textMessage
+	// saveState records the watcher's progress with each stored batch, last being true
+	// for the final one; it runs once with no batch when nothing was left to store. Nil
+	// for sessions no watcher follows.
+	saveState func(tx *sql.Tx, batch []textMessage, last bool) error
+}
+
+// BackfillResult counts what a backfill stored.
+type BackfillResult struct {
+	Messages int
+	Batches  int
+	// Skipped counts messages already stored, by a watcher or an earlier backfill.
+	Skipped int
+}
+
+// storedMessageIDs returns the IDs of a session's messages already in the database.
+func storedMessageIDs(db *sql.DB, sessionID string) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT id FROM messages WHERE session_id = ?`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("load stored messages: %w", err)
+	}
+	defer rows.Close()
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		stored[id] = true
+	}
+	return stored, rows.Err()
+}
+
+// Backfill ingests the messages of a past session that are not stored yet, in batches of
+// batchSize through ingestBatch under the sources its watcher uses, so a backfilled
+// session reads like a watched one. The watcher's state is saved with every batch: a
+// watcher started afterwards carries on from the end of the backfill, and an interrupted
+// backfill run again picks up where it stopped.
+func Backfill(ctx context.Context, db *sql.DB, ollama *OllamaClient, titleModel string, s backfillSession, batchSize int, chunking ChunkOptions, progress ProgressFunc) (BackfillResult, error) {
+	var result BackfillResult
+	stored, err := storedMessageIDs(db, s.ID)
+	if err != nil {
+		return result, err
+	}
+	var messages []textMessage
+	for _, m := range s.Messages {
+		if stored[m.MessageID] {
+			result.Skipped++
+			continue
+		}
+		messages = append(messages, m)
+	}
+
+	batchSize = max(batchSize, 1)
+	for start := 0; start < len(messages); start += batchSize {
+		if progress != nil {
+			progress(start, len(messages), s.Title)
+		}
+		batch := messages[start:min(start+batchSize, len(messages))]
+		last := start+batchSize >= len(messages)
+		sourceFile := fmt.Sprintf("%sbatch-%d", s.SourcePrefix, nextWatchSeq(db, s.SourcePrefix+"batch-"))
+		var saveState func(tx *sql.Tx) error
+		if s.saveState != nil {
+			saveState = func(tx *sql.Tx) error { return s.saveState(tx, batch, last) }
+		}
+		err := ingestBatch(ctx, db, ollama, titleModel, sourceFile, batch, s.Title, chunking, saveState)
+		if err != nil {
+			return result, fmt.Errorf("ingest %s: %w", sourceFile, err)
+		}
+		result.Messages += len(batch)
+		result.Batches++
+	}
+	if progress != nil && len(messages) > 0 {
+		progress(len(messages), len(messages), "")
+	}
+	if result.Batches == 0 && s.saveState != nil {
+		err = withWriteTx(db, "save watch state", func(tx *sql.Tx) error {
+			return s.saveState(tx, nil, true)
+		})
+	}
+	return result, err
+}
+
+// readOCSession reads every text message of an OpenCode session, oldest first. ids lists
+// all of its message IDs, including those without text.
+func readOCSession(ocDB *sql.DB, sessionID, userAlias, assistantAlias string) (messages []textMessage, ids []string, err error) {
+	if ids, err = getNewMessages(ocDB, sessionID, nil); err != nil {
+		return nil, nil, fmt.Errorf("list messages: %w", err)
+	}
+	for _, id := range ids {
+		tm, err := readTextFromDB(ocDB, sessionID, id, userAlias, assistantAlias)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read message %s: %w", id, err)
+		}
+		if tm != nil {
+			messages = append(messages, *tm)
+		}
+	}
+	return messages, ids, nil
+}
+
+// backfillFlags are the options backfill-oc and backfill-cc share.
+type backfillFlags struct {
+	sessionID, project *string
+	latest, all        *bool
+	batchSize          *int
+	noTitles           *bool
+	chunks             chunkFlags
+}
+
+func newBackfillFlags(fs *flag.FlagSet, projectUsage string) backfillFlags {
+	return backfillFlags{
+		sessionID: fs.String("session", "", "backfill the session with this ID"),
+		project:   fs.String("project", "", projectUsage),
+		latest:    fs.Bool("latest", false, "backfill the most recent session"),
+		all:       fs.Bool("all", false, "backfill every session (of --project, when given)"),
+		batchSize: fs.Int("batch", 6, "messages per ingested batch, as with the watchers"),
+		noTitles:  fs.Bool("no-titles", false, "keep date headings instead of titling each batch with the generate model"),
+		chunks:    newChunkFlags(fs),
+	}
+}
+
+func (f backfillFlags) validate() {
+	chosen := 0
+	for _, set := range []bool{*f.sessionID != "", *f.latest, *f.all} {
+		if set {
+			chosen++
+		}
+	}
+	if chosen > 1 {
+		log.Fatal("--session, --latest and --all are exclusive")
+	}
+	if _, err := f.chunks.options(); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// runBackfills backfills each session in turn, reporting as it goes.
+func runBackfills(mnemeDB, ollamaHost, embedModel, generateModel string, f backfillFlags, sessions []backfillSession) {
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	if err := ValidateEmbedDimension(ctx, ollama); err != nil {
+		log.Fatalf("%v", err)
+	}
+	titleModel := generateModel
+	if *f.noTitles {
+		titleModel = ""
+	}
+	chunking, _ := f.chunks.options()
+
+	var total BackfillResult
+	for _, s := range sessions {
+		progress := NewProgress("Backfilling")
+		result, err := Backfill(ctx, db, ollama, titleModel, s, *f.batchSize, chunking, progress.Func())
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("backfill %s: %v (run it again to resume)", s.ID, err)
+		}
+		fmt.Println(renderPreflightStep("ok", fmt.Sprintf("%s: %d messages in %d batches, %d already stored", s.Title, result.Messages, result.Batches, result.Skipped)))
+		total.Messages += result.Messages
+		total.Batches += result.Batches
+		total.Skipped += result.Skipped
+	}
+	if len(sessions) > 1 {
+		fmt.Printf("\nBackfilled %d messages from %d sessions in %d batches (%d already stored).\n", total.Messages, len(sessions), total.Batches, total.Skipped)
+	}
+}
+
+func runBackfillOC(args []string, mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias string) {
+	fs := flag.NewFlagSet("backfill-oc", flag.ExitOnError)
+	f := newBackfillFlags(fs, "only sessions run in this directory")
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	f.validate()
+
+	ocDB, err := sql.Open("sqlite3", openCodeDBPath()+"?mode=ro")
+	if err != nil {
+		log.Fatalf("open opencode db: %v", err)
+	}
+	defer ocDB.Close()
+	defer closeStatements(ocDB)
+
+	sessions, err := discoverSessions(ocDB)
+	if err != nil {
+		log.Fatalf("discover sessions: %v", err)
+	}
+	if *f.project != "" {
+		sessions = ocSessionsIn(sessions, *f.project)
+	}
+	if len(sessions) == 0 {
+		log.Fatal("no OpenCode sessions found")
+	}
+	switch {
+	case *f.all:
+	case *f.sessionID != "" || *f.latest:
+		session, err := findSession(sessions, *f.sessionID, *f.latest)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		sessions = []ocSession{session}
+	default:
+		session, err := pickSession(sessions)
+		if err != nil {
+			log.Fatalf("pick session: %v", err)
+		}
+		sessions = []ocSession{session}
+	}
+
+	var backfills []backfillSession
+	for _, session := range sessions {
+		messages, ids, err := readOCSession(ocDB, session.ID, userAlias, assistantAlias)
+		if err != nil {
+			log.Fatalf("read session %s: %v", session.ID, err)
+		}
+		sessionID := session.ID
+		backfills = append(backfills, backfillSession{
+			ID:           sessionID,
+			Title:        session.Title,
+			SourcePrefix: fmt.Sprintf("watch://%s/", sessionID),
+			Messages:     messages,
+			saveState: func(tx *sql.Tx, batch []textMessage, last bool) error {
+				if last {
+					// Messages without text too, so the watcher does not wait on them
+					return saveWatchedIDs(tx, watcherOC, sessionID, ids)
+				}
+				batchIDs := make([]string, len(batch))
+				for i, m := range batch {
+					batchIDs[i] = m.MessageID
+				}
+				return saveWatchedIDs(tx, watcherOC, sessionID, batchIDs)
+			},
+		})
+	}
+	runBackfills(mnemeDB, ollamaHost, embedModel, generateModel, f, backfills)
+}
+
+func runBackfillCC(args []string, mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias string) {
+	fs := flag.NewFlagSet("backfill-cc", flag.ExitOnError)
+	f := newBackfillFlags(fs, "only sessions of this project: its directory, or its name under ~/.claude/projects")
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	f.validate()
+
+	basePath := claudeCodeBasePath()
+	projects, err := discoverCCProjects(basePath)
+	if err != nil {
+		log.Fatalf("discover projects: %v", err)
+	}
+	if len(projects) == 0 {
+		log.Fatal("no Claude Code projects found")
+	}
+	if *f.project != "" {
+		projectDir, err := matchCCProject(basePath, projects, *f.project)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		projects = []string{projectDir}
+	}
+
+	var sessions []ccSessionEntry
+	switch {
+	case *f.all:
+		if sessions, err = listCCSessions(basePath, projects); err != nil {
+			log.Fatalf("discover sessions: %v", err)
+		}
+	case *f.sessionID != "" || *f.latest:
+		session, err := findCCSession(basePath, projects, *f.sessionID, *f.latest)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		sessions = []ccSessionEntry{session}
+	default:
+		projectDir, err := pickCCProject(basePath, projects)
+		if err != nil {
+			log.Fatalf("pick project: %v", err)
+		}
+		all, err := discoverCCSessions(basePath, projectDir)
+		if err != nil {
+			log.Fatalf("discover sessions: %v", err)
+		}
+		if len(all) == 0 {
+			log.Fatal("no Claude Code sessions found in project")
+		}
+		session, err := pickCCSession(all)
+		if err != nil {
+			log.Fatalf("pick session: %v", err)
+		}
+		sessions = []ccSessionEntry{session}
+	}
+
+	var backfills []backfillSession
+	for _, session := range sessions {
+		var messages []textMessage
+		offset, err := scanCCJSONL(session.FullPath, 0, userAlias, assistantAlias, func(tm textMessage) {
+			messages = append(messages, tm)
+		})
+		if err != nil {
+			log.Fatalf("read session %s: %v", session.SessionID, err)
+		}
+		sessionID := session.SessionID
+		backfills = append(backfills, backfillSession{
+			ID:           sessionID,
+			Title:        session.title(),
+			SourcePrefix: fmt.Sprintf("watch-cc://%s/", sessionID),
+			Messages:     messages,
+			saveState: func(tx *sql.Tx, batch []textMessage, last bool) error {
+				if !last {
+					return nil
+				}
+				// A watcher that read further than this backfill keeps its place
+				var saved int64
+				err := tx.QueryRow(`SELECT CAST(value AS INTEGER) FROM watch_state WHERE watcher = ? AND session_id = ? AND key = ?`, watcherCC, sessionID, watchOffsetKey).Scan(&saved)
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return err
+				}
+				if saved >= offset {
+					return nil
+				}
+				return saveWatchedOffset(tx, watcherCC, sessionID, offset)
+			},
+		})
+	}
+	runBackfills(mnemeDB, ollamaHost, embedModel, generateModel, f, backfills)
+}
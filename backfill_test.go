@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+	// Every batch embeds alike here
+	withNearDuplicateThreshold(t, 0)
+
+	at := time.Date(2025, time.June, 3, 10, 0, 0, 0, time.UTC)
+	var messages []textMessage
+	for i := range 5 {
+		messages = append(messages, textMessage{Role: "User", Text: fmt.Sprintf("Message number %d about the rollout", i), Timestamp: at.Add(time.Duration(i) * time.Minute), MessageID: fmt.Sprintf("m%d", i), SessionID: "s1"})
+	}
+	// The watcher already stored the first message
+	if err := ingestBatch(context.Background(), db, client, "", "watch://s1/batch-0", messages[:1], "Rollout", defaultChunking, nil); err != nil {
+		t.Fatalf("ingestBatch: %v", err)
+	}
+
+	var saves []string
+	session := backfillSession{
+		ID:           "s1",
+		Title:        "Rollout",
+		SourcePrefix: "watch://s1/",
+		Messages:     messages,
+		saveState: func(tx *sql.Tx, batch []textMessage, last bool) error {
+			saves = append(saves, fmt.Sprintf("%d/%v", len(batch), last))
+			return nil
+		},
+	}
+	result, err := Backfill(context.Background(), db, client, "", session, 3, defaultChunking, nil)
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	if result.Messages != 4 || result.Batches != 2 || result.Skipped != 1 {
+		t.Fatalf("expected 4 new messages in 2 batches, got %+v", result)
+	}
+	if fmt.Sprint(saves) != "[3/false 1/true]" {
+		t.Fatalf("expected state saved with each batch, got %v", saves)
+	}
+	var sources []string
+	rows, err := db.Query(`SELECT DISTINCT source_file FROM chunks ORDER BY source_file`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var s string
+		rows.Scan(&s)
+		sources = append(sources, s)
+	}
+	rows.Close()
+	if fmt.Sprint(sources) != "[watch://s1/batch-0 watch://s1/batch-1 watch://s1/batch-2]" {
+		t.Fatalf("expected batches numbered after the watcher's, got %v", sources)
+	}
+
+	// Run again, everything is already stored
+	saves = nil
+	if result, err = Backfill(context.Background(), db, client, "", session, 3, defaultChunking, nil); err != nil || result.Messages != 0 || result.Skipped != 5 {
+		t.Fatalf("expected nothing left to backfill, got %+v, %v", result, err)
+	}
+	if fmt.Sprint(saves) != "[0/true]" {
+		t.Fatalf("expected the state saved once, got %v", saves)
+	}
+}
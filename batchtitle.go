@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// watchBatchFilter matches the chunks of raw watcher batches (not their summaries).
+const watchBatchFilter = `(source_file LIKE 'watch://%/batch-%' OR source_file LIKE 'watch-cc://%/batch-%')`
+
+// extractionKindBatchTitle marks batch chunks whose section_title has been generated.
+const extractionKindBatchTitle = "batch-title"
+
+// batchTitleMax caps generated titles, in runes.
+const batchTitleMax = 80
+
+// batchTitleMaxWords caps how much of a batch is sent to the model.
+const batchTitleMaxWords = 1500
+
+const batchTitlePrompt = `You title short excerpts of a conversation so they are easy to recognize in search results.
+Return JSON only, in exactly this shape:
+{"title": "..."}
+Rules:
+- 3 to 8 words naming the concrete subject ("Moving auth tokens to Postgres"), not the activity ("Discussion about code").
+- No dates, no quotes, no trailing punctuation.`
+
+type batchTitleResponse struct {
+	Title string `json:"title"`
+}
+
+// cleanBatchTitle trims quotes and trailing punctuation and caps the length.
+func cleanBatchTitle(title string) string {
+	title = strings.TrimSpace(strings.SplitN(strings.TrimSpace(title), "\n", 2)[0])
+	title = strings.Trim(title, "\"'`*# ")
+	title = strings.TrimRight(title, ".!?:; ")
+	if utf8.RuneCountInString(title) > batchTitleMax {
+		title = strings.TrimSpace(string([]rune(title)[:batchTitleMax]))
+	}
+	return title
+}
+
+// TitleBatch asks the generate model for a short descriptive title for a batch of
+// conversation text.
+func TitleBatch(ctx context.Context, ollama *OllamaClient, model, text string) (string, error) {
+	words := strings.Fields(text)
+	if len(words) > batchTitleMaxWords {
+		text = strings.Join(words[:batchTitleMaxWords], " ")
+	}
+	raw, err := ollama.GenerateJSON(ctx, model, batchTitlePrompt, text)
+	if err != nil {
+		return "", err
+	}
+	var resp batchTitleResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return "", err
+	}
+	title := cleanBatchTitle(resp.Title)
+	if title == "" {
+		return "", fmt.Errorf("%w: empty title", errBadModelResponse)
+	}
+	return title, nil
+}
+
+// applyBatchTitle stores title as the section_title of a batch's chunks (the
+// "Preamble" holding the session heading keeps its own) and marks them titled.
+func applyBatchTitle(db *sql.DB, chunkIDs []int64, title string) error {
+	return withWriteTx(db, "title batch", func(tx *sql.Tx) error {
+		for _, id := range chunkIDs {
+			if _, err := tx.Exec(`UPDATE chunks SET section_title = ? WHERE id = ? AND section_title != 'Preamble'`, title, id); err != nil {
+				return fmt.Errorf("title chunk %d: %w", id, err)
+			}
+			if err := markExtracted(tx, id, extractionKindBatchTitle); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// titleIngestedBatch titles a batch just ingested under chunkIDs. On failure the batch
+// keeps its date headings until TitleWatchBatches retries it. An empty model skips titling.
+func titleIngestedBatch(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, chunkIDs []int64, md string) (string, error) {
+	if model == "" || len(chunkIDs) == 0 {
+		return "", nil
+	}
+	title, err := TitleBatch(ctx, ollama, model, md)
+	if err != nil {
+		return "", fmt.Errorf("title batch: %w", err)
+	}
+	if err := applyBatchTitle(db, chunkIDs, title); err != nil {
+		return "", err
+	}
+	return title, nil
+}
+
+// TitleWatchBatches titles every stored watch batch that doesn't have a generated
+// title yet, one model call per batch. Batches whose response can't be parsed are
+// skipped and retried on the next run; transport errors abort the pass.
+func TitleWatchBatches(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, progress ProgressFunc) (int, error) {
+	rows, err := db.Query(
+		`SELECT id, source_file, text FROM chunks
+		 WHERE ` + watchBatchFilter + `
+		   AND id NOT IN (SELECT chunk_id FROM chunk_extractions WHERE kind = '` + extractionKindBatchTitle + `')
+		 ORDER BY source_file, section_sequence, chunk_sequence`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	type batch struct {
+		source string
+		ids    []int64
+		text   strings.Builder
+	}
+	var batches []*batch
+	for rows.Next() {
+		var id int64
+		var source, text string
+		if err := rows.Scan(&id, &source, &text); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if len(batches) == 0 || batches[len(batches)-1].source != source {
+			batches = append(batches, &batch{source: source})
+		}
+		b := batches[len(batches)-1]
+		b.ids = append(b.ids, id)
+		b.text.WriteString(text)
+		b.text.WriteString("\n\n")
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	titled := 0
+	for i, b := range batches {
+		if progress != nil {
+			progress(i, len(batches), b.source)
+		}
+		title, err := TitleBatch(ctx, ollama, model, b.text.String())
+		if err != nil {
+			if errors.Is(err, errBadModelResponse) {
+				continue
+			}
+			return titled, fmt.Errorf("title %s: %w", b.source, err)
+		}
+		if err := applyBatchTitle(db, b.ids, title); err != nil {
+			return titled, err
+		}
+		titled++
+	}
+	if progress != nil && len(batches) > 0 {
+		progress(len(batches), len(batches), "")
+	}
+	return titled, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanBatchTitle(t *testing.T) {
+	for in, want := range map[string]string{
+		`"Moving auth tokens to Postgres."`: "Moving auth tokens to Postgres",
+		"## Sleep schedule\nsecond line":    "Sleep schedule",
+		"  ":                                "",
+	} {
+		if got := cleanBatchTitle(in); got != want {
+			t.Errorf("cleanBatchTitle(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := cleanBatchTitle(strings.Repeat("ü", batchTitleMax+10)); got != strings.Repeat("ü", batchTitleMax) {
+		t.Fatalf("expected a rune-safe cap, got %q", got)
+	}
+}
+
+func newBatchTitleServer(t *testing.T, answer *string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: *answer})
+		case "/api/embed":
+			vec := make([]float64, EmbedDimension)
+			vec[0] = 1
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestIngestBatchTitles(t *testing.T) {
+	answer := `{"title": "Moving auth tokens to Postgres"}`
+	server := newBatchTitleServer(t, &answer)
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	at := time.Date(2025, time.June, 3, 10, 0, 0, 0, time.UTC)
+	messages := []textMessage{
+		{Role: "User", Text: "Should auth tokens live in Postgres?", Timestamp: at, MessageID: "m1", SessionID: "s1"},
+		{Role: "Assistant", Text: "Yes, with a TTL column.", Timestamp: at.Add(time.Minute), MessageID: "m2", SessionID: "s1"},
+	}
+	if err := ingestBatch(context.Background(), db, client, "gen", "watch://s1/batch-0", messages, "Backend work", defaultChunking, nil); err != nil {
+		t.Fatalf("ingestBatch: %v", err)
+	}
+
+	var title, validAt string
+	if err := db.QueryRow(`SELECT section_title, valid_at FROM chunks WHERE source_file = 'watch://s1/batch-0' AND valid_at IS NOT NULL`).Scan(&title, &validAt); err != nil {
+		t.Fatalf("read batch chunk: %v", err)
+	}
+	if title != "Moving auth tokens to Postgres" || validAt != "2025-06-03" {
+		t.Fatalf("expected a titled, still dated chunk, got %q on %q", title, validAt)
+	}
+
+	// Without a model the date heading stays and the batch is left for the backfill. The
+	// batch repeats the first, so it is stored only when near-duplicates are
+	withNearDuplicateThreshold(t, 0)
+	if err := ingestBatch(context.Background(), db, client, "", "watch://s1/batch-1", messages, "Backend work", defaultChunking, nil); err != nil {
+		t.Fatalf("ingestBatch without titles: %v", err)
+	}
+	db.QueryRow(`SELECT section_title FROM chunks WHERE source_file = 'watch://s1/batch-1' AND valid_at IS NOT NULL`).Scan(&title)
+	if title != "June 3, 2025" {
+		t.Fatalf("expected the date heading, got %q", title)
+	}
+
+	answer = `{"title": "Postgres token TTLs"}`
+	titled, err := TitleWatchBatches(context.Background(), db, client, "gen", nil)
+	if err != nil || titled != 1 {
+		t.Fatalf("expected only the untitled batch to be titled, got %d, %v", titled, err)
+	}
+	db.QueryRow(`SELECT section_title FROM chunks WHERE source_file = 'watch://s1/batch-1' AND valid_at IS NOT NULL`).Scan(&title)
+	if title != "Postgres token TTLs" {
+		t.Fatalf("unexpected backfilled title %q", title)
+	}
+	var preamble int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE section_title = 'Preamble'`).Scan(&preamble)
+	if preamble != 2 {
+		t.Fatalf("expected the session heading chunks to keep their title, got %d", preamble)
+	}
+}
+
+func TestTitleWatchBatchesSkipsBadResponses(t *testing.T) {
+	answer := `{"title": ""}`
+	server := newBatchTitleServer(t, &answer)
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	insertChunk(t, db, "Batch text.", "watch-cc://s2/batch-0", "June 3, 2025", "", 2, "2025-06-03", vec)
+	insertChunk(t, db, "A note.", "notes.md", "Note", "", 2, "2025-06-03", vec)
+
+	client := NewOllamaClient(server.URL, "embed")
+	if titled, err := TitleWatchBatches(context.Background(), db, client, "gen", nil); err != nil || titled != 0 {
+		t.Fatalf("expected an empty title to be skipped, got %d, %v", titled, err)
+	}
+
+	answer = `{"title": "Something concrete"}`
+	if titled, err := TitleWatchBatches(context.Background(), db, client, "gen", nil); err != nil || titled != 1 {
+		t.Fatalf("expected the skipped batch retried, got %d, %v", titled, err)
+	}
+	var note string
+	db.QueryRow(`SELECT section_title FROM chunks WHERE source_file = 'notes.md'`).Scan(&note)
+	if note != "Note" {
+		t.Fatalf("expected non-batch chunks untouched, got %q", note)
+	}
+}
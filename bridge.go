@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// bridgeSourcePrefix starts the source_file of every message captured by a bridge:
+// bridge://<platform>/<chat>/<message>.
+const bridgeSourcePrefix = "bridge://"
+
+// bridgeMessage is one message sent to the bot, whatever the platform.
+type bridgeMessage struct {
+	Chat string
+	ID   string
+	Text string
+	Time time.Time
+}
+
+// chatBridge is a chat platform messages are captured from.
+type chatBridge interface {
+	// platform names the bridge in source files and confirmations
+	platform() string
+	// poll blocks until there are new messages from allowed senders, or it gives up. Until
+	// ack, the next poll returns the same messages again.
+	poll(ctx context.Context) ([]bridgeMessage, error)
+	// ack marks everything the last poll returned as handled
+	ack()
+	// confirm tells the sender the message was remembered
+	confirm(ctx context.Context, m bridgeMessage) error
+}
+
+func bridgeSource(b chatBridge, m bridgeMessage) string {
+	return bridgeSourcePrefix + b.platform() + "/" + m.Chat + "/" + m.ID
+}
+
+// captureTitleRunes caps how much of a captured message's first line titles its section.
+const captureTitleRunes = 60
+
+// captureTitle titles a quickly captured memory by its first line.
+func captureTitle(text string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	title = strings.TrimSpace(strings.TrimLeft(title, "#"))
+	if utf8.RuneCountInString(title) > captureTitleRunes {
+		title = string([]rune(title)[:captureTitleRunes]) + "…"
+	}
+	return title
+}
+
+// buildBridgeMarkdown renders a message as one section titled by its first line and dated
+// when it was sent.
+func buildBridgeMarkdown(platform string, m bridgeMessage) string {
+	text := strings.TrimSpace(m.Text)
+	title := captureTitle(text)
+	local := m.Time.In(mnemeLocation)
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s (%s)\n\n", title, local.Format("January 2, 2006"))
+	b.WriteString(demoteHeadings(text) + "\n\n")
+	fmt.Fprintf(&b, "Captured from %s at %s.\n", platform, local.Format("15:04"))
+	return b.String()
+}
+
+// RunBridge ingests every message the bridge receives as a dated memory until ctx is
+// done. Messages already stored (say, when a channel is read again after a restart) are
+// skipped. A poll is acknowledged only once all its messages are stored, so one that
+// fails to ingest is fetched and tried again rather than lost.
+func RunBridge(ctx context.Context, db *sql.DB, ollama *OllamaClient, b chatBridge) error {
+	stored, err := storedSources(db, bridgeSourcePrefix+b.platform()+"/")
+	if err != nil {
+		return err
+	}
+	backoff := time.Second
+	for {
+		messages, err := b.poll(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Warning: %s: %v (retrying in %s)", b.platform(), err, backoff)
+			if !sleepContext(ctx, backoff) {
+				return nil
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+
+		failed := false
+		for _, m := range messages {
+			source := bridgeSource(b, m)
+			if stored[source] || strings.TrimSpace(m.Text) == "" {
+				continue
+			}
+			if _, err := ingestMarkdownSource(ctx, db, ollama, source, buildBridgeMarkdown(b.platform(), m)); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				// Left unacknowledged; the next poll returns it, and those after it, again
+				log.Printf("Warning: ingest %s: %v (retrying in %s)", source, err, backoff)
+				failed = true
+				break
+			}
+			stored[source] = true
+			fmt.Println(renderPreflightStep("ok", "Remembered "+source))
+			if err := b.confirm(ctx, m); err != nil {
+				log.Printf("Warning: confirm %s: %v", source, err)
+			}
+		}
+		if failed {
+			if !sleepContext(ctx, backoff) {
+				return nil
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		b.ack()
+		backoff = time.Second
+	}
+}
+
+// sleepContext waits for d, reporting false if ctx ended first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// parseAllowList splits a comma-separated list of chat or user IDs.
+func parseAllowList(s string) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			allowed[id] = true
+		}
+	}
+	return allowed
+}
+
+// bridgeRequest sends a bridge API request, decoding a JSON response into out when it is
+// not nil.
+func bridgeRequest(ctx context.Context, client *http.Client, method, endpoint string, header http.Header, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// A *url.Error quotes the URL, which holds the token on Telegram
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s request: %w", method, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// telegramBridge long-polls a Telegram bot for the messages sent to it.
+type telegramBridge struct {
+	api     string // https://api.telegram.org/bot<token>
+	client  *http.Client
+	allowed map[string]bool // chat IDs
+	wait    time.Duration
+	offset  int64 // the first update not yet acknowledged
+	next    int64 // offset once the last poll is acknowledged
+	refused map[string]bool
+}
+
+func newTelegramBridge(token string, allowed map[string]bool) *telegramBridge {
+	wait := 30 * time.Second
+	return &telegramBridge{
+		api:     "https://api.telegram.org/bot" + token,
+		client:  &http.Client{Timeout: wait + 10*time.Second},
+		allowed: allowed,
+		wait:    wait,
+		refused: make(map[string]bool),
+	}
+}
+
+func (t *telegramBridge) platform() string { return "telegram" }
+
+func (t *telegramBridge) poll(ctx context.Context) ([]bridgeMessage, error) {
+	query := url.Values{
+		"timeout":         {strconv.Itoa(int(t.wait.Seconds()))},
+		"offset":          {strconv.FormatInt(t.offset, 10)},
+		"allowed_updates": {`["message"]`},
+	}
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+		Result      []struct {
+			UpdateID int64 `json:"update_id"`
+			Message  *struct {
+				MessageID int64  `json:"message_id"`
+				Date      int64  `json:"date"`
+				Text      string `json:"text"`
+				Caption   string `json:"caption"`
+				Chat      struct {
+					ID int64 `json:"id"`
+				} `json:"chat"`
+			} `json:"message"`
+		} `json:"result"`
+	}
+	if err := bridgeRequest(ctx, t.client, http.MethodGet, t.api+"/getUpdates?"+query.Encode(), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return nil, errors.New(resp.Description)
+	}
+
+	var messages []bridgeMessage
+	t.next = t.offset
+	for _, u := range resp.Result {
+		// Acknowledged with the rest of the poll whether or not it is kept
+		t.next = max(t.next, u.UpdateID+1)
+		if u.Message == nil {
+			continue
+		}
+		chat := strconv.FormatInt(u.Message.Chat.ID, 10)
+		if !t.allowed[chat] {
+			if !t.refused[chat] {
+				t.refused[chat] = true
+				log.Printf("Warning: ignoring telegram chat %s; pass --allow %s to capture its messages", chat, chat)
+			}
+			continue
+		}
+		text := u.Message.Text
+		if text == "" {
+			text = u.Message.Caption
+		}
+		messages = append(messages, bridgeMessage{
+			Chat: chat,
+			ID:   strconv.FormatInt(u.Message.MessageID, 10),
+			Text: text,
+			Time: time.Unix(u.Message.Date, 0),
+		})
+	}
+	return messages, nil
+}
+
+func (t *telegramBridge) ack() { t.offset = max(t.offset, t.next) }
+
+func (t *telegramBridge) confirm(ctx context.Context, m bridgeMessage) error {
+	id, _ := strconv.ParseInt(m.ID, 10, 64)
+	body := map[string]any{
+		"chat_id":             m.Chat,
+		"text":                "Remembered.",
+		"reply_to_message_id": id,
+	}
+	return bridgeRequest(ctx, t.client, http.MethodPost, t.api+"/sendMessage", nil, body, nil)
+}
+
+// discordBridge polls a Discord channel the bot can read. Reading messages over REST
+// needs no gateway connection, at the cost of a short delay.
+type discordBridge struct {
+	api      string
+	client   *http.Client
+	header   http.Header
+	channel  string
+	allowed  map[string]bool // user IDs; any non-bot author when empty
+	interval time.Duration
+	after    string // the newest message acknowledged
+	next     string // after, once the last poll is acknowledged
+	polled   bool
+}
+
+func newDiscordBridge(token, channel string, allowed map[string]bool, interval time.Duration) *discordBridge {
+	return &discordBridge{
+		api:      "https://discord.com/api/v10",
+		client:   &http.Client{Timeout: 30 * time.Second},
+		header:   http.Header{"Authorization": {"Bot " + token}},
+		channel:  channel,
+		allowed:  allowed,
+		interval: interval,
+	}
+}
+
+func (d *discordBridge) platform() string { return "discord" }
+
+func (d *discordBridge) poll(ctx context.Context) ([]bridgeMessage, error) {
+	if d.polled && !sleepContext(ctx, d.interval) {
+		return nil, ctx.Err()
+	}
+	d.polled = true
+
+	query := url.Values{"limit": {"100"}}
+	if d.after != "" {
+		query.Set("after", d.after)
+	}
+	var resp []struct {
+		ID        string    `json:"id"`
+		Content   string    `json:"content"`
+		Timestamp time.Time `json:"timestamp"`
+		Author    struct {
+			ID  string `json:"id"`
+			Bot bool   `json:"bot"`
+		} `json:"author"`
+	}
+	endpoint := d.api + "/channels/" + url.PathEscape(d.channel) + "/messages?" + query.Encode()
+	if err := bridgeRequest(ctx, d.client, http.MethodGet, endpoint, d.header, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	d.next = d.after
+	var messages []bridgeMessage
+	for _, m := range resp {
+		if snowflakeLess(d.next, m.ID) {
+			d.next = m.ID
+		}
+		if m.Author.Bot || (len(d.allowed) > 0 && !d.allowed[m.Author.ID]) {
+			continue
+		}
+		messages = append(messages, bridgeMessage{Chat: d.channel, ID: m.ID, Text: m.Content, Time: m.Timestamp})
+	}
+	// Discord lists newest first
+	sort.Slice(messages, func(i, j int) bool { return snowflakeLess(messages[i].ID, messages[j].ID) })
+	return messages, nil
+}
+
+// snowflakeLess orders Discord IDs, which are decimal integers of growing length.
+func snowflakeLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func (d *discordBridge) ack() {
+	if snowflakeLess(d.after, d.next) {
+		d.after = d.next
+	}
+}
+
+func (d *discordBridge) confirm(ctx context.Context, m bridgeMessage) error {
+	endpoint := fmt.Sprintf("%s/channels/%s/messages/%s/reactions/%s/@me", d.api, url.PathEscape(d.channel), url.PathEscape(m.ID), url.PathEscape("✅"))
+	return bridgeRequest(ctx, d.client, http.MethodPut, endpoint, d.header, nil, nil)
+}
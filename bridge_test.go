@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBuildBridgeMarkdown(t *testing.T) {
+	withLocation(t, time.UTC)
+	m := bridgeMessage{Chat: "1", ID: "2", Text: "# Remember the dentist is on the 14th, and that she moved offices to Elm Street\nBring the forms", Time: time.Date(2025, 5, 2, 8, 30, 0, 0, time.UTC)}
+	sections := ParseMarkdown(buildBridgeMarkdown("telegram", m))
+	if len(sections) != 1 {
+		t.Fatalf("expected one section, got %+v", sections)
+	}
+	if !strings.HasPrefix(sections[0].Title, "Remember the dentist is on the 14th") || !strings.HasSuffix(sections[0].Title, "… (May 2, 2025)") || sections[0].ValidAt != "2025-05-02" {
+		t.Fatalf("unexpected title %q, %q", sections[0].Title, sections[0].ValidAt)
+	}
+	if !strings.Contains(sections[0].Content, "Bring the forms") || !strings.Contains(sections[0].Content, "Captured from telegram at 08:30.") {
+		t.Fatalf("unexpected content %q", sections[0].Content)
+	}
+}
+
+func TestTelegramBridge(t *testing.T) {
+	withLocation(t, time.UTC)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var offsets []string
+	var replies []map[string]any
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/getUpdates":
+			offsets = append(offsets, r.URL.Query().Get("offset"))
+			if len(offsets) > 2 {
+				cancel()
+				fmt.Fprint(w, `{"ok": true, "result": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"ok": true, "result": [
+				{"update_id": 10, "message": {"message_id": 5, "date": 1746174600, "text": "Parking spot is B14", "chat": {"id": 42}}},
+				{"update_id": 11, "message": {"message_id": 6, "date": 1746174601, "text": "spam", "chat": {"id": 666}}}
+			]}`)
+		case "/sendMessage":
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			replies = append(replies, body)
+			fmt.Fprint(w, `{"ok": true}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	db, err := InitDB(filepath.Join(t.TempDir(), "mneme.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	// The first embedding fails, so the first poll is fetched again
+	var embeds atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if embeds.Add(1) == 1 {
+			http.Error(w, "out of memory", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float32{makeVec(map[int]float32{0: 1})}})
+	}))
+	defer server.Close()
+
+	bridge := newTelegramBridge("token", parseAllowList("42"))
+	bridge.api = api.URL
+	if err := RunBridge(ctx, db, NewOllamaClient(server.URL, "embed"), bridge); err != nil {
+		t.Fatalf("RunBridge: %v", err)
+	}
+
+	var sources []string
+	rows, err := db.Query(`SELECT source_file FROM chunks`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var s string
+		rows.Scan(&s)
+		sources = append(sources, s)
+	}
+	rows.Close()
+	if len(sources) != 1 || sources[0] != "bridge://telegram/42/5" {
+		t.Fatalf("expected only the allowed chat's message, got %v", sources)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(offsets) != "[0 0 12]" {
+		t.Fatalf("expected the updates acknowledged only once stored, got offsets %v", offsets)
+	}
+	if len(replies) != 1 || replies[0]["chat_id"] != "42" {
+		t.Fatalf("expected one confirmation to chat 42, got %v", replies)
+	}
+}
+
+func TestDiscordBridgePoll(t *testing.T) {
+	var after []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bot token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		after = append(after, r.URL.Query().Get("after"))
+		fmt.Fprint(w, `[
+			{"id": "1000000000000000010", "content": "Bot reply", "timestamp": "2025-05-02T08:31:00Z", "author": {"id": "9", "bot": true}},
+			{"id": "1000000000000000009", "content": "Second", "timestamp": "2025-05-02T08:30:30Z", "author": {"id": "7"}},
+			{"id": "999999999999999999", "content": "First", "timestamp": "2025-05-02T08:30:00Z", "author": {"id": "7"}},
+			{"id": "1000000000000000008", "content": "Someone else", "timestamp": "2025-05-02T08:30:10Z", "author": {"id": "8"}}
+		]`)
+	}))
+	defer api.Close()
+
+	bridge := newDiscordBridge("token", "55", parseAllowList("7"), time.Millisecond)
+	bridge.api = api.URL
+	messages, err := bridge.poll(context.Background())
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Text != "First" || messages[1].Text != "Second" || messages[0].Chat != "55" {
+		t.Fatalf("expected the allowed user's messages oldest first, got %+v", messages)
+	}
+	// Unacknowledged, the same messages are read again
+	if _, err := bridge.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	bridge.ack()
+	if _, err := bridge.poll(context.Background()); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(after) != 3 || after[1] != "" || after[2] != "1000000000000000010" {
+		t.Fatalf("expected the next poll after the newest acknowledged message, got %v", after)
+	}
+}
+
+func TestBridgeRequestHidesURL(t *testing.T) {
+	err := bridgeRequest(context.Background(), http.DefaultClient, http.MethodGet, "http://127.0.0.1:1/botSECRET/getUpdates", nil, nil, nil)
+	if err == nil || strings.Contains(err.Error(), "SECRET") {
+		t.Fatalf("expected an error without the token, got %v", err)
+	}
+}
@@ -0,0 +1,663 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// browseResults is how many chunks a search in the browser lists.
+const browseResults = 30
+
+// browseDebounce is how long the browser waits after a keystroke before searching, so
+// typing a word makes one embedding request rather than one per letter.
+const browseDebounce = 250 * time.Millisecond
+
+// BrowseSource is a source file in the browser's first pane.
+type BrowseSource struct {
+	File   string
+	Chunks int
+}
+
+// BrowseSection is a section of a source file; Sequence is NULL for chunks stored
+// without one.
+type BrowseSection struct {
+	Sequence sql.NullInt64
+	Title    string
+	Chunks   int
+}
+
+// BrowseChunk is a chunk as the browser shows it.
+type BrowseChunk struct {
+	ID           int64
+	Text         string
+	SourceFile   string
+	SectionTitle string
+	ValidAt      string
+	Archived     bool
+	Pinned       bool
+	Tags         []string
+}
+
+// BrowseSources lists every source file with its chunk count, archived chunks included.
+func BrowseSources(db *sql.DB) ([]BrowseSource, error) {
+	rows, err := db.Query(`SELECT source_file, COUNT(*) FROM chunks GROUP BY source_file ORDER BY source_file`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []BrowseSource
+	for rows.Next() {
+		var s BrowseSource
+		if err := rows.Scan(&s.File, &s.Chunks); err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return sources, rows.Err()
+}
+
+// BrowseSections lists a source file's sections in document order.
+func BrowseSections(db *sql.DB, source string) ([]BrowseSection, error) {
+	rows, err := db.Query(
+		`SELECT section_sequence, MIN(section_title), COUNT(*) FROM chunks
+		 WHERE source_file = ?
+		 GROUP BY section_sequence
+		 ORDER BY section_sequence`,
+		source,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sections []BrowseSection
+	for rows.Next() {
+		var s BrowseSection
+		if err := rows.Scan(&s.Sequence, &s.Title, &s.Chunks); err != nil {
+			return nil, err
+		}
+		sections = append(sections, s)
+	}
+	return sections, rows.Err()
+}
+
+const browseChunkColumns = `SELECT id, text, source_file, section_title, COALESCE(valid_at, ''), archived_at IS NOT NULL, pinned_at IS NOT NULL FROM chunks`
+
+// BrowseSectionChunks returns a section's chunks in order, with their tags.
+func BrowseSectionChunks(db *sql.DB, source string, section sql.NullInt64) ([]BrowseChunk, error) {
+	rows, err := db.Query(browseChunkColumns+` WHERE source_file = ? AND section_sequence IS ? ORDER BY chunk_sequence, id`, source, section)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []BrowseChunk
+	for rows.Next() {
+		var c BrowseChunk
+		if err := rows.Scan(&c.ID, &c.Text, &c.SourceFile, &c.SectionTitle, &c.ValidAt, &c.Archived, &c.Pinned); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range chunks {
+		if chunks[i].Tags, err = browseTags(db, chunks[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// browseResultChunks turns search results into browser chunks, in the same order.
+func browseResultChunks(db *sql.DB, results []SearchResult) ([]BrowseChunk, error) {
+	chunks := make([]BrowseChunk, 0, len(results))
+	for _, r := range results {
+		var c BrowseChunk
+		err := db.QueryRow(browseChunkColumns+` WHERE id = ?`, r.ID).Scan(&c.ID, &c.Text, &c.SourceFile, &c.SectionTitle, &c.ValidAt, &c.Archived, &c.Pinned)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.Tags, err = browseTags(db, c.ID); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
+}
+
+func browseTags(db *sql.DB, chunkID int64) ([]string, error) {
+	tags, err := ListChunkTags(db, chunkID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Tag
+	}
+	return names, nil
+}
+
+type browsePane int
+
+const (
+	paneSources browsePane = iota
+	paneSections
+	paneChunks
+)
+
+type browseMode int
+
+const (
+	modeBrowse browseMode = iota
+	modeSearch
+	modeTag
+	modeConfirmDelete
+)
+
+// browseModel is the bubbletea model behind `mneme browse`: sources, a source's
+// sections and a section's chunks side by side, or search results in place of the
+// first two while a query is entered.
+type browseModel struct {
+	ctx    context.Context
+	db     *sql.DB
+	ollama *OllamaClient
+
+	width, height int
+	focus         browsePane
+	mode          browseMode
+	input         string
+
+	sources    []BrowseSource
+	source     int
+	sections   []BrowseSection
+	section    int
+	chunks     []BrowseChunk
+	chunk      int
+	scroll     int
+	searchSeq  int
+	query      string
+	results    []BrowseChunk
+	result     int
+	searched   bool
+	degraded   bool
+	status     string
+	statusFail bool
+}
+
+// browseSearchTick fires browseDebounce after a keystroke in the search box; only the
+// tick for the latest keystroke searches.
+type browseSearchTick int
+
+type browseResultsMsg struct {
+	seq      int
+	chunks   []BrowseChunk
+	degraded bool
+	err      error
+}
+
+type browseReembedMsg struct {
+	id  int64
+	err error
+}
+
+func newBrowseModel(ctx context.Context, db *sql.DB, ollama *OllamaClient) (*browseModel, error) {
+	m := &browseModel{ctx: ctx, db: db, ollama: ollama, width: 100, height: 30}
+	return m, m.loadSources()
+}
+
+// RunBrowser runs the memory browser full-screen until it is quit. Each search and
+// re-embed is bounded by searchTimeout; the browser itself has no time limit.
+func RunBrowser(db *sql.DB, ollama *OllamaClient) error {
+	model, err := newBrowseModel(context.Background(), db, ollama)
+	if err != nil {
+		return err
+	}
+	// Log lines would be drawn over the panes; failures show in the status line instead
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+	_, err = tea.NewProgram(model, tea.WithAltScreen()).Run()
+	return err
+}
+
+func (m *browseModel) Init() tea.Cmd { return nil }
+
+// loadSources reloads the sources pane, and the panes under it, keeping the selection
+// where it was as far as the lists allow.
+func (m *browseModel) loadSources() error {
+	var err error
+	if m.sources, err = BrowseSources(m.db); err != nil {
+		return err
+	}
+	m.source = clampIndex(m.source, len(m.sources))
+	return m.loadSections()
+}
+
+func (m *browseModel) loadSections() error {
+	m.sections = nil
+	if len(m.sources) > 0 {
+		var err error
+		if m.sections, err = BrowseSections(m.db, m.sources[m.source].File); err != nil {
+			return err
+		}
+	}
+	m.section = clampIndex(m.section, len(m.sections))
+	return m.loadChunks()
+}
+
+func (m *browseModel) loadChunks() error {
+	m.chunks = nil
+	if len(m.sections) > 0 {
+		var err error
+		if m.chunks, err = BrowseSectionChunks(m.db, m.sources[m.source].File, m.sections[m.section].Sequence); err != nil {
+			return err
+		}
+	}
+	m.chunk = clampIndex(m.chunk, len(m.chunks))
+	m.scroll = 0
+	return nil
+}
+
+func clampIndex(i, n int) int {
+	return max(min(i, n-1), 0)
+}
+
+// searching reports whether the panes show search results rather than the sources.
+func (m *browseModel) searching() bool {
+	return m.query != ""
+}
+
+// current returns the chunk the actions apply to, or nil.
+func (m *browseModel) current() *BrowseChunk {
+	if m.searching() {
+		if m.result < len(m.results) {
+			return &m.results[m.result]
+		}
+		return nil
+	}
+	if m.chunk < len(m.chunks) {
+		return &m.chunks[m.chunk]
+	}
+	return nil
+}
+
+func (m *browseModel) setStatus(format string, args ...any) {
+	m.status, m.statusFail = fmt.Sprintf(format, args...), false
+}
+
+func (m *browseModel) setError(err error) {
+	m.status, m.statusFail = err.Error(), true
+}
+
+func (m *browseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case browseSearchTick:
+		if int(msg) == m.searchSeq && m.query != "" {
+			return m, m.search(m.searchSeq, m.query)
+		}
+	case browseResultsMsg:
+		if msg.seq != m.searchSeq {
+			break
+		}
+		if msg.err != nil {
+			m.setError(fmt.Errorf("search: %w", msg.err))
+			break
+		}
+		m.results, m.result, m.scroll = msg.chunks, 0, 0
+		m.searched, m.degraded = true, msg.degraded
+	case browseReembedMsg:
+		if msg.err != nil {
+			m.setError(msg.err)
+		} else {
+			m.setStatus("Re-embedded chunk %d", msg.id)
+		}
+	case tea.KeyMsg:
+		return m.updateKey(msg)
+	}
+	return m, nil
+}
+
+func (m *browseModel) updateKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	if key == "ctrl+c" {
+		return m, tea.Quit
+	}
+	switch m.mode {
+	case modeSearch:
+		switch key {
+		case "esc":
+			m.mode, m.query, m.results, m.searched, m.degraded = modeBrowse, "", nil, false, false
+			m.searchSeq++
+			return m, nil
+		case "enter":
+			m.mode = modeBrowse
+			return m, nil
+		case "up", "down":
+			m.move(key == "down")
+			return m, nil
+		case "backspace":
+			if m.query == "" {
+				return m, nil
+			}
+			m.query = string([]rune(m.query)[:len([]rune(m.query))-1])
+		default:
+			if msg.Type != tea.KeyRunes && msg.Type != tea.KeySpace {
+				return m, nil
+			}
+			m.query += string(msg.Runes)
+		}
+		m.searchSeq++
+		if m.query == "" {
+			m.results, m.searched, m.degraded = nil, false, false
+			return m, nil
+		}
+		seq := m.searchSeq
+		return m, tea.Tick(browseDebounce, func(time.Time) tea.Msg { return browseSearchTick(seq) })
+
+	case modeTag:
+		switch key {
+		case "esc":
+			m.mode, m.input = modeBrowse, ""
+		case "enter":
+			m.mode = modeBrowse
+			m.addTags(splitList(m.input))
+			m.input = ""
+		case "backspace":
+			if m.input != "" {
+				m.input = string([]rune(m.input)[:len([]rune(m.input))-1])
+			}
+		default:
+			if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+				m.input += string(msg.Runes)
+			}
+		}
+		return m, nil
+
+	case modeConfirmDelete:
+		m.mode = modeBrowse
+		if key == "y" || key == "Y" {
+			m.deleteCurrent()
+		} else {
+			m.setStatus("Kept the chunk")
+		}
+		return m, nil
+	}
+
+	switch key {
+	case "q":
+		return m, tea.Quit
+	case "esc":
+		if m.searching() {
+			m.query, m.results, m.searched, m.degraded = "", nil, false, false
+			m.searchSeq++
+		}
+	case "/":
+		m.mode = modeSearch
+		m.status = ""
+	case "tab", "right", "l":
+		if !m.searching() && m.focus < paneChunks {
+			m.focus++
+		}
+	case "shift+tab", "left", "h":
+		if !m.searching() && m.focus > paneSources {
+			m.focus--
+		}
+	case "down", "j":
+		m.move(true)
+	case "up", "k":
+		m.move(false)
+	case "pgdown", "ctrl+d":
+		m.scroll += max(m.paneHeight()/2, 1)
+	case "pgup", "ctrl+u":
+		m.scroll = max(m.scroll-max(m.paneHeight()/2, 1), 0)
+	case "t":
+		if m.current() != nil {
+			m.mode, m.input = modeTag, ""
+		}
+	case "d":
+		if m.current() != nil {
+			m.mode = modeConfirmDelete
+		}
+	case "e":
+		if c := m.current(); c != nil {
+			m.setStatus("Re-embedding chunk %d...", c.ID)
+			return m, m.reembed(c.ID)
+		}
+	}
+	return m, nil
+}
+
+// move steps the selection in the focused pane, or through the search results.
+func (m *browseModel) move(down bool) {
+	step := -1
+	if down {
+		step = 1
+	}
+	var err error
+	switch {
+	case m.searching():
+		m.result = clampIndex(m.result+step, len(m.results))
+		m.scroll = 0
+	case m.focus == paneSources:
+		if next := clampIndex(m.source+step, len(m.sources)); next != m.source {
+			m.source, m.section, m.chunk = next, 0, 0
+			err = m.loadSections()
+		}
+	case m.focus == paneSections:
+		if next := clampIndex(m.section+step, len(m.sections)); next != m.section {
+			m.section, m.chunk = next, 0
+			err = m.loadChunks()
+		}
+	default:
+		if next := clampIndex(m.chunk+step, len(m.chunks)); next != m.chunk {
+			m.chunk, m.scroll = next, 0
+		}
+	}
+	if err != nil {
+		m.setError(err)
+	}
+}
+
+func (m *browseModel) search(seq int, query string) tea.Cmd {
+	ctx, db, ollama := m.ctx, m.db, m.ollama
+	return func() tea.Msg {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+		results, degraded, err := SearchWithFallback(ctx, db, ollama, query, SearchOptions{
+			Limit: browseResults, ByRelevance: true, Hybrid: true, IncludeArchived: true,
+		})
+		if err != nil {
+			return browseResultsMsg{seq: seq, err: err}
+		}
+		chunks, err := browseResultChunks(db, results)
+		return browseResultsMsg{seq: seq, chunks: chunks, degraded: degraded, err: err}
+	}
+}
+
+func (m *browseModel) reembed(id int64) tea.Cmd {
+	ctx, db, ollama := m.ctx, m.db, m.ollama
+	return func() tea.Msg {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+		return browseReembedMsg{id: id, err: ReembedChunk(ctx, db, ollama, id)}
+	}
+}
+
+func (m *browseModel) addTags(tags []string) {
+	c := m.current()
+	if c == nil || len(tags) == 0 {
+		return
+	}
+	added, err := AddChunkTags(m.db, c.ID, tags)
+	if err != nil {
+		m.setError(err)
+		return
+	}
+	if c.Tags, err = browseTags(m.db, c.ID); err != nil {
+		m.setError(err)
+		return
+	}
+	m.setStatus("Added %d tags to chunk %d", added, c.ID)
+}
+
+func (m *browseModel) deleteCurrent() {
+	c := m.current()
+	if c == nil {
+		return
+	}
+	id := c.ID
+	if _, err := DeleteChunks(m.db, []int64{id}); err != nil {
+		m.setError(err)
+		return
+	}
+	if m.searching() {
+		m.results = append(m.results[:m.result], m.results[m.result+1:]...)
+		m.result = clampIndex(m.result, len(m.results))
+	}
+	// The source and section lists change under a search too
+	if err := m.loadSources(); err != nil {
+		m.setError(err)
+		return
+	}
+	m.setStatus("Deleted chunk %d", id)
+}
+
+// paneHeight is the number of lines inside a pane's border.
+func (m *browseModel) paneHeight() int {
+	// Title and footer lines, then the border
+	return max(m.height-2-2, 1)
+}
+
+func (m *browseModel) View() string {
+	height := m.paneHeight()
+	left := max(m.width/4, 12)
+	var panes []string
+	if m.searching() {
+		title := fmt.Sprintf("Results for %q", m.query)
+		items := make([]string, len(m.results))
+		for i, c := range m.results {
+			items[i] = c.SourceFile + " — " + c.SectionTitle
+		}
+		if m.searched && len(m.results) == 0 {
+			items = []string{"no matches"}
+		}
+		panes = append(panes, renderBrowseList(title, items, m.result, 2*left, height, true))
+	} else {
+		items := make([]string, len(m.sources))
+		for i, s := range m.sources {
+			items[i] = fmt.Sprintf("%s (%d)", s.File, s.Chunks)
+		}
+		panes = append(panes, renderBrowseList("Sources", items, m.source, left, height, m.focus == paneSources))
+		items = make([]string, len(m.sections))
+		for i, s := range m.sections {
+			items[i] = fmt.Sprintf("%s (%d)", s.Title, s.Chunks)
+		}
+		panes = append(panes, renderBrowseList("Sections", items, m.section, left, height, m.focus == paneSections))
+	}
+	panes = append(panes, m.renderChunk(max(m.width-2*left-6, 20), height))
+
+	var footer string
+	switch m.mode {
+	case modeSearch:
+		footer = promptStyle.Render("/") + " " + m.query + "█"
+	case modeTag:
+		footer = promptStyle.Render("Tags, comma-separated:") + " " + m.input + "█"
+	case modeConfirmDelete:
+		footer = promptStyle.Render(fmt.Sprintf("Delete chunk %d? (y/n)", m.current().ID))
+	default:
+		switch {
+		case m.statusFail:
+			footer = browseErrorStyle.Render(m.status)
+		case m.status != "":
+			footer = infoHighlightStyle.Render(m.status)
+		default:
+			footer = infoStyle.Render("tab/←→ pane · ↑↓ move · / search · t tag · d delete · e re-embed · pgup/pgdn scroll · q quit")
+		}
+	}
+	header := ingestStyle.Render("Mneme Browse")
+	if m.degraded && m.searching() {
+		header += " " + browseErrorStyle.Render("degraded mode: Ollama is unreachable, keyword matches only")
+	}
+	return header + "\n" + lipgloss.JoinHorizontal(lipgloss.Top, panes...) + "\n" + footer
+}
+
+// renderChunk renders the selected chunk's pane: where it is from, its tags and its
+// text from the scroll offset.
+func (m *browseModel) renderChunk(width, height int) string {
+	c := m.current()
+	if c == nil {
+		return browsePaneStyle.Width(width).Height(height).Render("")
+	}
+	position := ""
+	if !m.searching() {
+		position = fmt.Sprintf(" · %d/%d", m.chunk+1, len(m.chunks))
+	}
+	meta := fmt.Sprintf("#%d%s", c.ID, position)
+	if c.ValidAt != "" {
+		meta += " · " + c.ValidAt
+	}
+	if c.Pinned {
+		meta += " · pinned"
+	}
+	if c.Archived {
+		meta += " · archived"
+	}
+	lines := []string{sessionNumStyle.Render(truncate(meta, width-3))}
+	if m.searching() {
+		lines = append(lines, sessionSlugStyle.Render(truncate(c.SourceFile+" — "+c.SectionTitle, width-3)))
+	}
+	if len(c.Tags) > 0 {
+		lines = append(lines, infoHighlightStyle.Render(truncate("tags: "+strings.Join(c.Tags, ", "), width-3)))
+	}
+	lines = append(lines, "")
+
+	text := strings.Split(lipgloss.NewStyle().Width(width).Render(c.Text), "\n")
+	m.scroll = clampIndex(m.scroll, len(text))
+	text = text[m.scroll:]
+	if room := height - len(lines); len(text) > room {
+		text = text[:max(room, 0)]
+	}
+	lines = append(lines, text...)
+	style := browsePaneStyle
+	if m.searching() || m.focus == paneChunks {
+		style = browseFocusedPaneStyle
+	}
+	return style.Width(width).Height(height).Render(strings.Join(lines, "\n"))
+}
+
+// renderBrowseList renders a titled list pane, scrolled to keep the selection in view.
+func renderBrowseList(title string, items []string, selected, width, height int, focused bool) string {
+	style := browsePaneStyle
+	if focused {
+		style = browseFocusedPaneStyle
+	}
+	lines := []string{sessionTitleStyle.Render(truncate(title, width-3))}
+	room := max(height-1, 1)
+	start := max(min(selected-room/2, len(items)-room), 0)
+	for i := start; i < len(items) && i < start+room; i++ {
+		item := truncate(items[i], width-3)
+		if i == selected {
+			lines = append(lines, browseSelectedStyle.Render(item))
+		} else {
+			lines = append(lines, item)
+		}
+	}
+	return style.Width(width).Height(height).Render(strings.Join(lines, "\n"))
+}
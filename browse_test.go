@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// newBrowseTestDB ingests two notes, one with two sections, embedding everything alike.
+func newBrowseTestDB(t *testing.T) (*sql.DB, *OllamaClient) {
+	t.Helper()
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	t.Cleanup(server.Close)
+	client := NewOllamaClient(server.URL, "embed")
+	withNearDuplicateThreshold(t, 0)
+
+	notes := map[string]string{
+		"b.md": "## Move\n\nThe movers arrive at eight.\n\n## Keys\n\nKeys are handed over at noon.\n",
+		"a.md": "## Lunch\n\nSoup on Fridays.\n",
+	}
+	for _, source := range []string{"a.md", "b.md"} {
+		if _, err := IngestMarkdown(context.Background(), db, client, source, strings.NewReader(notes[source]), "", defaultChunking, nil); err != nil {
+			t.Fatalf("IngestMarkdown: %v", err)
+		}
+	}
+	return db, client
+}
+
+func sendKeys(t *testing.T, m *browseModel, keys ...tea.KeyMsg) tea.Cmd {
+	t.Helper()
+	var cmd tea.Cmd
+	for _, key := range keys {
+		_, cmd = m.Update(key)
+	}
+	return cmd
+}
+
+func typed(s string) []tea.KeyMsg {
+	var keys []tea.KeyMsg
+	for _, r := range s {
+		keys = append(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return keys
+}
+
+func TestBrowseLists(t *testing.T) {
+	db, _ := newBrowseTestDB(t)
+
+	sources, err := BrowseSources(db)
+	if err != nil || len(sources) != 2 || sources[0].File != "a.md" || sources[1].Chunks != 2 {
+		t.Fatalf("expected both sources in order with their counts, got %+v, %v", sources, err)
+	}
+	sections, err := BrowseSections(db, "b.md")
+	if err != nil || len(sections) != 2 || sections[0].Title != "Move" || sections[1].Title != "Keys" {
+		t.Fatalf("expected b.md's sections in document order, got %+v, %v", sections, err)
+	}
+	chunks, err := BrowseSectionChunks(db, "b.md", sections[1].Sequence)
+	if err != nil || len(chunks) != 1 || !strings.Contains(chunks[0].Text, "noon") {
+		t.Fatalf("expected the Keys chunk, got %+v, %v", chunks, err)
+	}
+	if _, err := AddChunkTags(db, chunks[0].ID, []string{"house"}); err != nil {
+		t.Fatalf("AddChunkTags: %v", err)
+	}
+	if chunks, _ = BrowseSectionChunks(db, "b.md", sections[1].Sequence); len(chunks[0].Tags) != 1 || chunks[0].Tags[0] != "house" {
+		t.Fatalf("expected the chunk's tags loaded, got %+v", chunks)
+	}
+}
+
+func TestBrowseModel(t *testing.T) {
+	db, client := newBrowseTestDB(t)
+	m, err := newBrowseModel(context.Background(), db, client)
+	if err != nil {
+		t.Fatalf("newBrowseModel: %v", err)
+	}
+	if c := m.current(); c == nil || c.SourceFile != "a.md" {
+		t.Fatalf("expected the first source's first chunk selected, got %+v", c)
+	}
+	if view := m.View(); !strings.Contains(view, "Sources") || !strings.Contains(view, "Soup on Fridays") {
+		t.Fatalf("expected the panes rendered, got\n%s", view)
+	}
+
+	// Down to b.md, over to its sections, down to Keys
+	sendKeys(t, m, append(typed("j"), tea.KeyMsg{Type: tea.KeyTab})...)
+	sendKeys(t, m, typed("j")...)
+	if c := m.current(); c == nil || !strings.Contains(c.Text, "noon") {
+		t.Fatalf("expected the Keys chunk selected, got %+v", c)
+	}
+
+	sendKeys(t, m, typed("thouse, keys")...)
+	sendKeys(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if c := m.current(); len(c.Tags) != 2 {
+		t.Fatalf("expected two tags added, got %+v (%s)", c, m.status)
+	}
+
+	id := m.current().ID
+	sendKeys(t, m, typed("dn")...)
+	sendKeys(t, m, typed("dy")...)
+	if err := chunkExists(db, id); err == nil {
+		t.Fatal("expected the chunk deleted after confirming")
+	}
+	if len(m.sections) != 1 || m.current() == nil || !strings.Contains(m.current().Text, "movers") {
+		t.Fatalf("expected the emptied section gone and its neighbor selected, got %+v", m.sections)
+	}
+
+	cmd := sendKeys(t, m, typed("e")...)
+	if cmd == nil {
+		t.Fatal("expected a re-embed")
+	}
+	if m.Update(cmd()); m.statusFail {
+		t.Fatalf("expected the chunk re-embedded, got %s", m.status)
+	}
+
+	// Only the tick for the last keystroke searches
+	sendKeys(t, m, typed("/sou")...)
+	stale := m.searchSeq - 1
+	sendKeys(t, m, typed("p")...)
+	if _, cmd := m.Update(browseSearchTick(stale)); cmd != nil {
+		t.Fatal("expected a superseded keystroke not to search")
+	}
+	_, cmd = m.Update(browseSearchTick(m.searchSeq))
+	if cmd == nil {
+		t.Fatal("expected a search")
+	}
+	m.Update(cmd())
+	if len(m.results) == 0 || m.current() != &m.results[0] {
+		t.Fatalf("expected search results listed, got %+v (%s)", m.results, m.status)
+	}
+	if view := m.View(); !strings.Contains(view, `Results for "soup"`) {
+		t.Fatalf("expected the results pane, got\n%s", view)
+	}
+
+	sendKeys(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	if m.searching() || m.mode != modeBrowse {
+		t.Fatal("expected Esc to leave search")
+	}
+}
@@ -2,17 +2,19 @@ package main
 
 import (
 	"bufio"
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/charmbracelet/x/ansi"
 )
 
 // Claude Code session from sessions-index.json
@@ -28,6 +30,14 @@ type ccSessionEntry struct {
 	IsSidechain  bool   `json:"isSidechain"`
 }
 
+// title names the session by its summary, or else its first prompt.
+func (s ccSessionEntry) title() string {
+	if s.Summary != "" {
+		return s.Summary
+	}
+	return truncate(s.FirstPrompt, 60)
+}
+
 type ccSessionsIndex struct {
 	Version      int              `json:"version"`
 	Entries      []ccSessionEntry `json:"entries"`
@@ -185,13 +195,15 @@ func buildSessionFromJSONL(sessionID, fullPath string, info os.FileInfo) ccSessi
 	}
 	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-
+	reader := bufio.NewReaderSize(f, 64*1024)
 	msgCount := 0
-	for scanner.Scan() {
+	for {
+		data, _, _, err := readLine(reader, maxCCLineBytes)
+		if err != nil && len(data) == 0 {
+			break
+		}
 		var line ccJSONLLine
-		if json.Unmarshal(scanner.Bytes(), &line) != nil {
+		if json.Unmarshal(data, &line) != nil {
 			continue
 		}
 
@@ -199,7 +211,7 @@ func buildSessionFromJSONL(sessionID, fullPath string, info os.FileInfo) ccSessi
 			var raw struct {
 				Summary string `json:"summary"`
 			}
-			if json.Unmarshal(scanner.Bytes(), &raw) == nil && raw.Summary != "" {
+			if json.Unmarshal(data, &raw) == nil && raw.Summary != "" {
 				entry.Summary = raw.Summary
 			}
 			continue
@@ -209,10 +221,7 @@ func buildSessionFromJSONL(sessionID, fullPath string, info os.FileInfo) ccSessi
 			msgCount++
 			if entry.FirstPrompt == "" && line.Type == "user" {
 				if text, ok := line.Message.Content.(string); ok && len(text) > 0 {
-					entry.FirstPrompt = text
-					if len(entry.FirstPrompt) > 100 {
-						entry.FirstPrompt = entry.FirstPrompt[:100]
-					}
+					entry.FirstPrompt = ansi.Truncate(text, 100, "")
 				}
 			}
 			if entry.Created == "" && line.Timestamp != "" {
@@ -237,20 +246,7 @@ func pickCCProject(basePath string, projects []string) (string, error) {
 	fmt.Println()
 
 	for i, p := range projects {
-		readable := p
-		if p != "transcripts" {
-			indexPath := filepath.Join(basePath, "projects", p, "sessions-index.json")
-			if data, err := os.ReadFile(indexPath); err == nil {
-				var index ccSessionsIndex
-				if json.Unmarshal(data, &index) == nil && index.OriginalPath != "" {
-					readable = index.OriginalPath
-				}
-			}
-			if readable == p {
-				readable = strings.ReplaceAll(p, "-", "/")
-			}
-		}
-		fmt.Println(renderSessionItem(i+1, readable, "", ""))
+		fmt.Println(renderSessionItem(i+1, ccProjectPath(basePath, p), "", ""))
 	}
 
 	fmt.Println()
@@ -274,6 +270,80 @@ func pickCCProject(basePath string, projects []string) (string, error) {
 	return projects[choice-1], nil
 }
 
+// ccProjectPath is the directory a Claude Code project was opened in, from its session
+// index or else decoded from the project's directory name.
+func ccProjectPath(basePath, project string) string {
+	if project == "transcripts" {
+		return project
+	}
+	indexPath := filepath.Join(basePath, "projects", project, "sessions-index.json")
+	if data, err := os.ReadFile(indexPath); err == nil {
+		var index ccSessionsIndex
+		if json.Unmarshal(data, &index) == nil && index.OriginalPath != "" {
+			return index.OriginalPath
+		}
+	}
+	return strings.ReplaceAll(project, "-", "/")
+}
+
+// matchCCProject finds the project --project names, by its directory under projects/ or
+// the directory it was opened in.
+func matchCCProject(basePath string, projects []string, want string) (string, error) {
+	dir := want
+	if abs, err := filepath.Abs(want); err == nil {
+		dir = abs
+	}
+	for _, p := range projects {
+		if p == want || ccProjectPath(basePath, p) == dir {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no Claude Code project for %s", want)
+}
+
+// listCCSessions lists the sessions of every one of projects.
+func listCCSessions(basePath string, projects []string) ([]ccSessionEntry, error) {
+	var all []ccSessionEntry
+	for _, p := range projects {
+		sessions, err := discoverCCSessions(basePath, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sessions {
+			// Sidechains and empty sessions come back from the index blank
+			if s.SessionID != "" {
+				all = append(all, s)
+			}
+		}
+	}
+	return all, nil
+}
+
+// findCCSession chooses a session without prompting: the one with id, or with latest
+// the most recently modified, in any of projects.
+func findCCSession(basePath string, projects []string, id string, latest bool) (ccSessionEntry, error) {
+	sessions, err := listCCSessions(basePath, projects)
+	if err != nil {
+		return ccSessionEntry{}, err
+	}
+	var newest ccSessionEntry
+	for _, s := range sessions {
+		if id != "" && s.SessionID == id {
+			return s, nil
+		}
+		if latest && s.Modified > newest.Modified {
+			newest = s
+		}
+	}
+	if id != "" {
+		return ccSessionEntry{}, fmt.Errorf("no Claude Code session %s", id)
+	}
+	if newest.SessionID == "" {
+		return ccSessionEntry{}, errors.New("no Claude Code sessions found")
+	}
+	return newest, nil
+}
+
 func pickCCSession(sessions []ccSessionEntry) (ccSessionEntry, error) {
 	fmt.Println()
 	fmt.Println(renderHeader())
@@ -287,10 +357,7 @@ func pickCCSession(sessions []ccSessionEntry) (ccSessionEntry, error) {
 	for i, s := range sessions[:limit] {
 		title := s.Summary
 		if title == "" {
-			title = s.FirstPrompt
-			if len(title) > 60 {
-				title = title[:60] + "..."
-			}
+			title = truncate(s.FirstPrompt, 60)
 		}
 		modified := s.Modified
 		if t, err := time.Parse(time.RFC3339, s.Modified); err == nil {
@@ -321,121 +388,184 @@ func pickCCSession(sessions []ccSessionEntry) (ccSessionEntry, error) {
 	return sessions[choice-1], nil
 }
 
-// readCCJSONL reads the JSONL file and returns all text messages
-func readCCJSONL(filePath, userAlias, assistantAlias string) ([]textMessage, error) {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	var messages []textMessage
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024) // 10MB max line
+// maxCCLineBytes bounds how much of one JSONL entry is held in memory. Longer entries
+// are pasted images or huge tool results; they're skipped, not buffered.
+const maxCCLineBytes = 16 << 20
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		var entry ccJSONLLine
-		if err := json.Unmarshal(line, &entry); err != nil {
-			continue
+// readLine reads one '\n'-terminated line from r, keeping at most max bytes of it: a
+// longer line is consumed but returned as nil. n counts the bytes consumed, and complete
+// is false when r ended before a newline.
+func readLine(r *bufio.Reader, max int) (line []byte, n int64, complete bool, err error) {
+	tooLong := false
+	for {
+		part, err := r.ReadSlice('\n')
+		n += int64(len(part))
+		if !tooLong {
+			if len(line)+len(part) > max {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, part...)
+			}
 		}
-
-		// Only process user and assistant messages
-		if entry.Type != "user" && entry.Type != "assistant" {
+		switch err {
+		case nil:
+			if tooLong {
+				return nil, n, true, nil
+			}
+			return line[:len(line)-1], n, true, nil
+		case bufio.ErrBufferFull:
 			continue
+		default:
+			return line, n, false, err
 		}
+	}
+}
 
-		ts, _ := time.Parse(time.RFC3339Nano, entry.Timestamp)
-		if ts.IsZero() {
-			ts, _ = time.Parse(time.RFC3339, entry.Timestamp)
-		}
-
-		if entry.Type == "user" {
-			// User content is a string
-			text := ""
-			switch v := entry.Message.Content.(type) {
-			case string:
-				text = v
-			case []interface{}:
-				// Sometimes user content is array of blocks
-				for _, block := range v {
-					if m, ok := block.(map[string]interface{}); ok {
-						if m["type"] == "text" {
-							if t, ok := m["text"].(string); ok {
-								text += t + "\n"
-							}
+// parseCCLine returns the text message in one JSONL entry, if it holds one.
+func parseCCLine(line []byte, userAlias, assistantAlias string) (textMessage, bool) {
+	var entry ccJSONLLine
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return textMessage{}, false
+	}
+
+	ts, _ := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	if ts.IsZero() {
+		ts, _ = time.Parse(time.RFC3339, entry.Timestamp)
+	}
+	// Claude Code logs UTC; batches are dated in mnemeLocation
+	ts = ts.In(mnemeLocation)
+
+	switch entry.Type {
+	case "user":
+		// User content is a string
+		text := ""
+		switch v := entry.Message.Content.(type) {
+		case string:
+			text = v
+		case []interface{}:
+			// Sometimes user content is array of blocks
+			for _, block := range v {
+				if m, ok := block.(map[string]interface{}); ok {
+					if m["type"] == "text" {
+						if t, ok := m["text"].(string); ok {
+							text += t + "\n"
 						}
 					}
 				}
 			}
+		}
 
-			cleaned := stripNoise(text)
-			if len(cleaned) < 3 {
-				continue
-			}
-
-			messages = append(messages, textMessage{
-				Role:      userAlias,
-				Text:      cleaned,
-				Timestamp: ts,
-				IsUser:    true,
-				MessageID: entry.UUID,
-				SessionID: entry.SessionID,
-			})
+		cleaned := stripNoise(text)
+		if len(cleaned) < 3 {
+			return textMessage{}, false
+		}
+		return textMessage{
+			Role:      userAlias,
+			Text:      cleaned,
+			Timestamp: ts,
+			IsUser:    true,
+			MessageID: entry.UUID,
+			SessionID: entry.SessionID,
+		}, true
+
+	case "assistant":
+		// Assistant content is array of blocks
+		blocks, ok := entry.Message.Content.([]interface{})
+		if !ok {
+			return textMessage{}, false
 		}
 
-		if entry.Type == "assistant" {
-			// Assistant content is array of blocks
-			blocks, ok := entry.Message.Content.([]interface{})
+		var texts []string
+		for _, block := range blocks {
+			m, ok := block.(map[string]interface{})
 			if !ok {
 				continue
 			}
-
-			var texts []string
-			for _, block := range blocks {
-				m, ok := block.(map[string]interface{})
-				if !ok {
-					continue
-				}
-				// Only text blocks — skip thinking, tool_use, tool_result
-				if m["type"] == "text" {
-					if t, ok := m["text"].(string); ok && t != "" {
-						texts = append(texts, t)
-					}
+			// Only text blocks — skip thinking, tool_use, tool_result
+			if m["type"] == "text" {
+				if t, ok := m["text"].(string); ok && t != "" {
+					texts = append(texts, t)
 				}
 			}
+		}
 
-			if len(texts) == 0 {
-				continue
-			}
-
-			cleaned := stripNoise(strings.Join(texts, "\n"))
-			if len(cleaned) < 3 {
-				continue
-			}
+		if len(texts) == 0 {
+			return textMessage{}, false
+		}
 
-			messages = append(messages, textMessage{
-				Role:      assistantAlias,
-				Text:      cleaned,
-				Timestamp: ts,
-				IsUser:    false,
-				MessageID: entry.UUID,
-				SessionID: entry.SessionID,
-			})
+		cleaned := stripNoise(strings.Join(texts, "\n"))
+		if len(cleaned) < 3 {
+			return textMessage{}, false
 		}
-	}
+		return textMessage{
+			Role:      assistantAlias,
+			Text:      cleaned,
+			Timestamp: ts,
+			IsUser:    false,
+			MessageID: entry.UUID,
+			SessionID: entry.SessionID,
+		}, true
+	}
+
+	// Only user and assistant messages carry conversation text
+	return textMessage{}, false
+}
 
-	return messages, scanner.Err()
+// scanCCJSONL passes each text message of a Claude Code transcript after byte offset to
+// fn, and returns the offset to resume from (see scanJSONL).
+func scanCCJSONL(filePath string, offset int64, userAlias, assistantAlias string, fn func(textMessage)) (int64, error) {
+	return scanJSONL(filePath, offset, ccLineParser(userAlias, assistantAlias), fn)
 }
 
-func runWatchCC(args []string, mnemeDB, ollamaHost, embedModel, userAlias, assistantAlias string) {
+// ccLineParser parses Claude Code transcript lines for scanJSONL.
+func ccLineParser(userAlias, assistantAlias string) jsonlParser {
+	return func(line []byte, _ int64) (textMessage, bool) {
+		return parseCCLine(line, userAlias, assistantAlias)
+	}
+}
+
+func runWatchCC(args []string, mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias string) {
 	fs := flag.NewFlagSet("watch-cc", flag.ExitOnError)
 	batchSize := fs.Int("batch", 6, "text messages before ingesting")
 	pollSec := fs.Int("poll", 3, "poll interval in seconds")
+	summaryIdle := fs.Int("summary-idle", 10, "minutes of quiet before summarizing the session (0 disables)")
+	flushAfter := fs.Duration("flush-after", 0, "ingest a partial batch after this long without new messages, e.g. 5m (0 waits for a full batch)")
+	noTitles := fs.Bool("no-titles", false, "keep date headings instead of titling each batch with the generate model")
+	chunks := newChunkFlags(fs)
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics on this address, e.g. :9464")
+	sessionID := fs.String("session", "", "watch the session with this ID instead of picking one")
+	project := fs.String("project", "", "only sessions of this project: its directory, or its name under ~/.claude/projects")
+	latest := fs.Bool("latest", false, "watch the most recently modified session instead of picking one")
+	daemon := fs.Bool("daemon", false, "run unattended: write a PID file and log to a file instead of the terminal (needs --session or --latest)")
+	pidFile := fs.String("pid-file", "", "daemon PID file (default: next to the database)")
+	logFile := fs.String("log-file", "", "daemon log file (default: next to the database)")
 
 	if err := fs.Parse(args); err != nil {
 		log.Fatalf("parse flags: %v", err)
 	}
+	chunking, err := chunks.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *sessionID != "" && *latest {
+		log.Fatal("--session and --latest are exclusive")
+	}
+	if *daemon {
+		if *sessionID == "" && !*latest {
+			log.Fatal("--daemon needs --session or --latest: there is no one to pick a session")
+		}
+		stop, err := startDaemon(daemonPaths(watcherCC, mnemeDB, *pidFile, *logFile))
+		if err != nil {
+			log.Fatalf("daemon: %v", err)
+		}
+		defer stop()
+	}
+
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
 
 	basePath := claudeCodeBasePath()
 
@@ -448,38 +578,50 @@ func runWatchCC(args []string, mnemeDB, ollamaHost, embedModel, userAlias, assis
 		log.Fatal("no Claude Code projects found")
 	}
 
-	projectDir, err := pickCCProject(basePath, projects)
-	if err != nil {
-		log.Fatalf("pick project: %v", err)
+	if *project != "" {
+		projectDir, err := matchCCProject(basePath, projects, *project)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		projects = []string{projectDir}
 	}
 
-	// Discover sessions in project
-	sessions, err := discoverCCSessions(basePath, projectDir)
-	if err != nil {
-		log.Fatalf("discover sessions: %v", err)
-	}
-	if len(sessions) == 0 {
-		log.Fatal("no Claude Code sessions found in project")
-	}
+	var session ccSessionEntry
+	if *sessionID != "" || *latest {
+		// Under systemd or a script there is no one to answer the pickers
+		if session, err = findCCSession(basePath, projects, *sessionID, *latest); err != nil {
+			log.Fatalf("%v", err)
+		}
+	} else {
+		projectDir, err := pickCCProject(basePath, projects)
+		if err != nil {
+			log.Fatalf("pick project: %v", err)
+		}
 
-	session, err := pickCCSession(sessions)
-	if err != nil {
-		log.Fatalf("pick session: %v", err)
+		// Discover sessions in project
+		sessions, err := discoverCCSessions(basePath, projectDir)
+		if err != nil {
+			log.Fatalf("discover sessions: %v", err)
+		}
+		if len(sessions) == 0 {
+			log.Fatal("no Claude Code sessions found in project")
+		}
+
+		if session, err = pickCCSession(sessions); err != nil {
+			log.Fatalf("pick session: %v", err)
+		}
 	}
 
 	fmt.Println()
-	if err := watchPreflight(ollamaHost, embedModel); err != nil {
+	// The watcher catches Ctrl+C itself to flush what is pending, so its work runs to
+	// completion rather than on a cancellable context.
+	ctx := context.Background()
+	if err := watchPreflight(ctx, ollamaHost, embedModel); err != nil {
 		log.Fatalf("preflight: %v", err)
 	}
 
 	fmt.Println()
-	title := session.Summary
-	if title == "" {
-		title = session.FirstPrompt
-		if len(title) > 60 {
-			title = title[:60] + "..."
-		}
-	}
+	title := session.title()
 	fmt.Println(renderWatchStatus(title, session.SessionID, *batchSize, *pollSec, mnemeDB))
 	fmt.Println()
 
@@ -490,91 +632,19 @@ func runWatchCC(args []string, mnemeDB, ollamaHost, embedModel, userAlias, assis
 	defer db.Close()
 
 	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
-
-	// Cleanup orphaned vec_chunks
-	db.Exec(`DELETE FROM vec_chunks WHERE chunk_id NOT IN (SELECT id FROM chunks)`)
-
-	// Find batch number
-	batchNum := 0
-	watchPrefix := fmt.Sprintf("watch-cc://%s/batch-", session.SessionID)
-	var maxBatch sql.NullInt64
-	_ = db.QueryRow(
-		`SELECT MAX(CAST(REPLACE(source_file, ?, '') AS INTEGER)) FROM chunks WHERE source_file LIKE ?`,
-		watchPrefix, watchPrefix+"%",
-	).Scan(&maxBatch)
-	if maxBatch.Valid {
-		batchNum = int(maxBatch.Int64) + 1
-	}
-
-	// Read existing messages to know where we left off
-	existingMsgs, _ := readCCJSONL(session.FullPath, userAlias, assistantAlias)
-	seenCount := len(existingMsgs)
-	fmt.Println(infoStyle.Render(fmt.Sprintf("  Skipping %d existing messages. Watching for new...", seenCount)))
-	fmt.Println()
-
-	var pending []textMessage
-
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
-
-	ticker := time.NewTicker(time.Duration(*pollSec) * time.Second)
-	defer ticker.Stop()
-
-	flushPending := func() {
-		if len(pending) == 0 {
-			return
-		}
-		fmt.Println()
-		fmt.Println(infoStyle.Render(fmt.Sprintf("  Flushing %d pending messages...", len(pending))))
-		sourceFile := fmt.Sprintf("watch-cc://%s/batch-%d", session.SessionID, batchNum)
-		if err := ingestBatch(db, ollama, sourceFile, pending, title); err != nil {
-			fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Flush error: %v", err)))
-			return
-		}
-		batchNum++
-		fmt.Println(renderIngest(len(pending), batchNum))
-		pending = nil
-	}
-
-	for {
-		select {
-		case <-sigCh:
-			flushPending()
-			fmt.Println()
-			fmt.Println(infoStyle.Render("  Stopped."))
-			return
-		case <-ticker.C:
-		}
-
-		allMsgs, err := readCCJSONL(session.FullPath, userAlias, assistantAlias)
-		if err != nil {
-			continue
-		}
-
-		if len(allMsgs) <= seenCount {
-			continue
-		}
-
-		newMsgs := allMsgs[seenCount:]
-		seenCount = len(allMsgs)
-
-		for _, tm := range newMsgs {
-			pending = append(pending, tm)
-			fmt.Println(renderMessage(tm.Role, tm.Timestamp.Format("15:04:05"), tm.Text, tm.IsUser))
-		}
-
-		if len(pending) >= *batchSize {
-			sourceFile := fmt.Sprintf("watch-cc://%s/batch-%d", session.SessionID, batchNum)
-			if err := ingestBatch(db, ollama, sourceFile, pending, title); err != nil {
-				fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Ingest error: %v", err)))
-				continue
-			}
-
-			batchNum++
-			fmt.Println()
-			fmt.Println(renderIngest(len(pending), batchNum))
-			fmt.Println()
-			pending = nil
-		}
-	}
+	followJSONL(ctx, db, ollama, jsonlWatch{
+		watcher:   watcherCC,
+		sessionID: session.SessionID,
+		title:     title,
+		path:      session.FullPath,
+		parse:     ccLineParser(userAlias, assistantAlias),
+	}, watchOptions{
+		batchSize:     *batchSize,
+		pollSec:       *pollSec,
+		summaryIdle:   time.Duration(*summaryIdle) * time.Minute,
+		flushAfter:    *flushAfter,
+		generateModel: generateModel,
+		noTitles:      *noTitles,
+		chunking:      chunking,
+	})
 }
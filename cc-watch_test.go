@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadLine(t *testing.T) {
+	input := "short\n" + strings.Repeat("x", 100) + "\nlast"
+	reader := bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	line, n, complete, err := readLine(reader, 50)
+	if string(line) != "short" || n != 6 || !complete || err != nil {
+		t.Fatalf("unexpected first line: %q, %d, %v, %v", line, n, complete, err)
+	}
+	line, n, complete, err = readLine(reader, 50)
+	if line != nil || n != 101 || !complete || err != nil {
+		t.Fatalf("expected an over-long line consumed and dropped, got %q, %d, %v, %v", line, n, complete, err)
+	}
+	line, n, complete, _ = readLine(reader, 50)
+	if string(line) != "last" || n != 4 || complete {
+		t.Fatalf("expected an unterminated last line, got %q, %d, %v", line, n, complete)
+	}
+}
+
+func TestScanCCJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	lines := []string{
+		`{"type":"user","uuid":"u1","timestamp":"2025-06-02T10:00:00Z","message":{"role":"user","content":"How do we rotate tokens?"}}`,
+		`{"type":"assistant","uuid":"a1","timestamp":"2025-06-02T10:00:05Z","message":{"role":"assistant","content":[{"type":"thinking","thinking":"hmm"},{"type":"text","text":"Rotate them weekly."}]}}`,
+		`{"type":"user","uuid":"u2","message":{"content":"` + strings.Repeat("a", maxCCLineBytes) + `"}}`,
+		`{"type":"summary","summary":"Token rotation"}`,
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var got []textMessage
+	collect := func(tm textMessage) { got = append(got, tm) }
+	offset, err := scanCCJSONL(path, 0, "Me", "AI", collect)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if len(got) != 2 || got[0].Role != "Me" || got[0].Text != "How do we rotate tokens?" || got[1].Role != "AI" || got[1].Text != "Rotate them weekly." {
+		t.Fatalf("unexpected messages (the over-long line should be skipped): %+v", got)
+	}
+
+	// A line still being written is left for the next scan
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	partial := `{"type":"user","uuid":"u3","message":{"content":"And the`
+	f.WriteString(partial)
+	got = nil
+	next, err := scanCCJSONL(path, offset, "Me", "AI", collect)
+	if err != nil || len(got) != 0 || next != offset {
+		t.Fatalf("expected the partial line left unread, got %+v at %d (from %d), %v", got, next, offset, err)
+	}
+
+	f.WriteString(` signing keys?"}}` + "\n")
+	next, err = scanCCJSONL(path, next, "Me", "AI", collect)
+	if err != nil || len(got) != 1 || got[0].Text != "And the signing keys?" {
+		t.Fatalf("expected the finished line, got %+v, %v", got, err)
+	}
+	if info, _ := os.Stat(path); next != info.Size() {
+		t.Fatalf("expected the offset at the end of the file, got %d of %d", next, info.Size())
+	}
+}
+
+func TestFindCCSession(t *testing.T) {
+	base := t.TempDir()
+	line := `{"type":"user","uuid":"u1","timestamp":"2025-06-02T10:00:00Z","message":{"role":"user","content":"hi"}}` + "\n"
+	for i, session := range []struct{ project, id string }{
+		{"-home-me-app", "old"},
+		{"-home-me-app", "new"},
+		{"-home-me-site", "other"},
+	} {
+		dir := filepath.Join(base, "projects", session.project)
+		os.MkdirAll(dir, 0o755)
+		path := filepath.Join(dir, session.id+".jsonl")
+		if err := os.WriteFile(path, []byte(line), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		modified := time.Date(2025, 6, 2, 10, i, 0, 0, time.UTC)
+		os.Chtimes(path, modified, modified)
+	}
+	projects, err := discoverCCProjects(base)
+	if err != nil {
+		t.Fatalf("discoverCCProjects: %v", err)
+	}
+
+	app, err := matchCCProject(base, projects, "/home/me/app")
+	if err != nil || app != "-home-me-app" {
+		t.Fatalf("expected the project opened in /home/me/app, got %q, %v", app, err)
+	}
+	if _, err := matchCCProject(base, projects, "/home/me/elsewhere"); err == nil {
+		t.Fatal("expected an error for a directory with no project")
+	}
+
+	if s, err := findCCSession(base, projects, "", true); err != nil || s.SessionID != "other" {
+		t.Fatalf("expected the newest session of any project, got %q, %v", s.SessionID, err)
+	}
+	if s, err := findCCSession(base, []string{app}, "", true); err != nil || s.SessionID != "new" {
+		t.Fatalf("expected the newest session of the project, got %q, %v", s.SessionID, err)
+	}
+	if s, err := findCCSession(base, projects, "old", false); err != nil || !strings.HasSuffix(s.FullPath, "old.jsonl") {
+		t.Fatalf("expected the session by ID, got %+v, %v", s, err)
+	}
+	if _, err := findCCSession(base, projects, "missing", false); err == nil {
+		t.Fatal("expected an error for an unknown session")
+	}
+}
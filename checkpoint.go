@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// checkpointEvery is how many finished embeddings ingest stages at a time.
+const checkpointEvery = 20
+
+// resumeStaged fills in the pending chunks at indexes whose embeddings an earlier run
+// staged, returning the indexes still to embed and how many were resumed. Staged
+// embeddings made by another model or at another dimension are discarded, not resumed.
+func resumeStaged(db *sql.DB, sourceFile, model string, pending []ingestPreparedChunk, indexes []int) ([]int, int, error) {
+	err := withWriteTx(db, "discard staged embeddings", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM ingest_staging WHERE source_file = ? AND (model != ? OR dim != ?)`, sourceFile, model, EmbedDimension)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	type staged struct {
+		embedding  []byte
+		normalized sql.NullString
+	}
+	found := map[string]staged{}
+	rows, err := db.Query(`SELECT content_hash, embedding, normalized_text FROM ingest_staging WHERE source_file = ?`, sourceFile)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash string
+		var s staged
+		if err := rows.Scan(&hash, &s.embedding, &s.normalized); err != nil {
+			return nil, 0, err
+		}
+		found[hash] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var remaining []int
+	resumed := 0
+	for _, i := range indexes {
+		s, ok := found[pending[i].hash]
+		if !ok {
+			remaining = append(remaining, i)
+			continue
+		}
+		pending[i].serialized, pending[i].normalized = s.embedding, s.normalized
+		resumed++
+	}
+	return remaining, resumed, nil
+}
+
+// stageEmbeddings saves the embeddings of the pending chunks at done for a later run.
+func stageEmbeddings(db *sql.DB, sourceFile, model string, pending []ingestPreparedChunk, done []int) error {
+	var args []any
+	for _, i := range done {
+		args = append(args, sourceFile, pending[i].hash, model, EmbedDimension, pending[i].serialized, pending[i].normalized)
+	}
+	return withWriteTx(db, "stage embeddings", func(tx *sql.Tx) error {
+		for start := 0; start < len(done); start += multiRowBatch {
+			end := min(start+multiRowBatch, len(done))
+			if _, err := tx.Exec(
+				`INSERT OR REPLACE INTO ingest_staging (source_file, content_hash, model, dim, embedding, normalized_text) VALUES `+valuesPlaceholders(end-start, 6),
+				args[start*6:end*6]...,
+			); err != nil {
+				return fmt.Errorf("stage embeddings: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIngestResumesAfterFailure(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	// The model falls over on the last section until it is fixed
+	var requests atomic.Int32
+	var fixed atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req.Input, "fourth") && !fixed.Load() {
+			http.Error(w, "out of memory", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float32{makeVec(map[int]float32{0: 1})}})
+	}))
+	defer server.Close()
+	ollama := NewOllamaClient(server.URL, "embed").WithConcurrency(1)
+
+	path := filepath.Join(t.TempDir(), "notes.md")
+	content := "## One\n\nfirst section\n\n## Two\n\nsecond section\n\n## Three\n\nthird section\n\n## Four\n\nfourth section\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if _, err := IngestFile(context.Background(), db, ollama, path, "", defaultChunking); err == nil {
+		t.Fatal("expected the ingest to fail")
+	}
+	var staged, chunks int
+	db.QueryRow(`SELECT COUNT(*) FROM ingest_staging WHERE source_file = ?`, path).Scan(&staged)
+	db.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&chunks)
+	if staged != 3 || chunks != 0 {
+		t.Fatalf("expected the 3 finished embeddings staged and nothing stored, got %d staged, %d chunks", staged, chunks)
+	}
+
+	fixed.Store(true)
+	requests.Store(0)
+	result, err := IngestFile(context.Background(), db, ollama, path, "", defaultChunking)
+	if err != nil {
+		t.Fatalf("IngestFile: %v", err)
+	}
+	if result.Resumed != 3 || requests.Load() != 1 || len(result.ChunkIDs) != 4 {
+		t.Fatalf("expected 3 resumed and 1 embedded, got %d resumed, %d requests, %d stored", result.Resumed, requests.Load(), len(result.ChunkIDs))
+	}
+	db.QueryRow(`SELECT COUNT(*) FROM ingest_staging`).Scan(&staged)
+	db.QueryRow(`SELECT COUNT(*) FROM vec_chunks`).Scan(&chunks)
+	if staged != 0 || chunks != 4 {
+		t.Fatalf("expected the staging cleared and 4 embeddings stored, got %d staged, %d embeddings", staged, chunks)
+	}
+}
+
+func TestIngestDiscardsStagingFromAnotherModel(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	// The old model fails on the second section, leaving the first staged
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model == "old" && strings.Contains(req.Input, "second") {
+			http.Error(w, "out of memory", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float32{makeVec(map[int]float32{0: 1})}})
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(path, []byte("## One\n\nfirst section\n\n## Two\n\nsecond section\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := IngestFile(context.Background(), db, NewOllamaClient(server.URL, "old").WithConcurrency(1), path, "", defaultChunking); err == nil {
+		t.Fatal("expected the ingest to fail")
+	}
+
+	requests.Store(0)
+	result, err := IngestFile(context.Background(), db, NewOllamaClient(server.URL, "new"), path, "", defaultChunking)
+	if err != nil {
+		t.Fatalf("IngestFile: %v", err)
+	}
+	if result.Resumed != 0 || requests.Load() != 2 {
+		t.Fatalf("expected nothing resumed from the old model, got %d resumed, %d requests", result.Resumed, requests.Load())
+	}
+}
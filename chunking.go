@@ -0,0 +1,246 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ChunkOptions sets how ChunkSection splits a section longer than Words words: at
+// paragraph breaks, and a paragraph too long for one chunk at sentence ends, into chunks
+// of at most Words words. With Overlap, each chunk after the first opens with the trailing
+// paragraphs (or sentences) of the one before, up to Overlap words, so a passage that
+// straddles a cut is whole in at least one chunk.
+//
+// With Tokens set, chunks are budgeted by estimated tokens instead: at most Tokens each,
+// Overlap counted in tokens too. Words undercount code, which the embedding model then
+// truncates without a word.
+//
+// Depth is the deepest header that starts a section of its own, 3 (###) by default.
+type ChunkOptions struct {
+	Words   int
+	Overlap int
+	Tokens  int
+	Depth   int
+}
+
+// defaultChunking is what ingest, the watchers and the backfills use unless given
+// --chunk-words, --chunk-overlap, --chunk-tokens and --section-depth: 600 words without
+// overlap in ## and ### sections, or MNEME_CHUNK_WORDS, MNEME_CHUNK_OVERLAP,
+// MNEME_CHUNK_TOKENS and MNEME_SECTION_DEPTH.
+var defaultChunking = ChunkOptions{Words: 600, Depth: defaultSectionDepth}
+
+// measure returns how chunks are sized, by words or by estimated tokens, and the most
+// one may hold.
+func (o ChunkOptions) measure() (size func(string) int, limit int) {
+	if o.Tokens > 0 {
+		return estimateTokens, o.Tokens
+	}
+	return func(s string) int { return len(strings.Fields(s)) }, o.Words
+}
+
+func loadChunking() error {
+	chunking := defaultChunking
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"MNEME_CHUNK_WORDS", &chunking.Words},
+		{"MNEME_CHUNK_OVERLAP", &chunking.Overlap},
+		{"MNEME_CHUNK_TOKENS", &chunking.Tokens},
+		{"MNEME_SECTION_DEPTH", &chunking.Depth},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: want a number, got %q", setting.name, value)
+		}
+		*setting.value = n
+	}
+	if err := chunking.validate(); err != nil {
+		return fmt.Errorf("MNEME_CHUNK_WORDS, MNEME_CHUNK_OVERLAP, MNEME_CHUNK_TOKENS, MNEME_SECTION_DEPTH: %w", err)
+	}
+	defaultChunking = chunking
+	return nil
+}
+
+func (o ChunkOptions) validate() error {
+	if o.Words < 1 {
+		return fmt.Errorf("chunk words must be at least 1, got %d", o.Words)
+	}
+	if o.Depth != 0 && o.Depth < 2 {
+		return fmt.Errorf("section depth must be 2 (##) or more, got %d", o.Depth)
+	}
+	if o.Tokens < 0 {
+		return fmt.Errorf("chunk tokens must be 0 (size by words) or more, got %d", o.Tokens)
+	}
+	if _, limit := o.measure(); o.Overlap < 0 || o.Overlap >= limit {
+		return fmt.Errorf("chunk overlap must be from 0 to less than the chunk size (%d), got %d", limit, o.Overlap)
+	}
+	return nil
+}
+
+// chunkFlags are the --chunk-words, --chunk-overlap, --chunk-tokens and --section-depth
+// options of the commands that ingest.
+type chunkFlags struct {
+	words, overlap, tokens, depth *int
+}
+
+func newChunkFlags(fs *flag.FlagSet) chunkFlags {
+	return chunkFlags{
+		words:   fs.Int("chunk-words", defaultChunking.Words, "most words per chunk; longer sections are split at paragraph breaks (default $MNEME_CHUNK_WORDS)"),
+		overlap: fs.Int("chunk-overlap", defaultChunking.Overlap, "words (or tokens, with --chunk-tokens) of trailing paragraphs each split chunk repeats from the one before (default $MNEME_CHUNK_OVERLAP)"),
+		tokens:  fs.Int("chunk-tokens", defaultChunking.Tokens, "most estimated tokens per chunk, instead of --chunk-words; 0 sizes by words (default $MNEME_CHUNK_TOKENS)"),
+		depth:   fs.Int("section-depth", defaultChunking.Depth, "deepest header level that starts a section, e.g. 4 for #### (default $MNEME_SECTION_DEPTH)"),
+	}
+}
+
+// options returns the parsed flags as ChunkOptions, failing on ones that can't chunk.
+func (f chunkFlags) options() (ChunkOptions, error) {
+	o := ChunkOptions{Words: *f.words, Overlap: *f.overlap, Tokens: *f.tokens, Depth: *f.depth}
+	if err := o.validate(); err != nil {
+		return o, fmt.Errorf("--chunk-words, --chunk-overlap, --chunk-tokens, --section-depth: %w", err)
+	}
+	return o, nil
+}
+
+// splitLongParagraph breaks a paragraph longer than limit into its sentences, and a
+// sentence that is still too long into runs of words that fit, so no piece outgrows a
+// chunk. Only a single word larger than limit is left whole.
+func splitLongParagraph(paragraph string, size func(string) int, limit int) []string {
+	var pieces []string
+	for _, sentence := range splitSentences(paragraph) {
+		if size(sentence) <= limit {
+			pieces = append(pieces, sentence)
+			continue
+		}
+		var run []string
+		for _, word := range strings.Fields(sentence) {
+			if len(run) > 0 && size(strings.Join(append(run, word), " ")) > limit {
+				pieces = append(pieces, strings.Join(run, " "))
+				run = nil
+			}
+			run = append(run, word)
+		}
+		if len(run) > 0 {
+			pieces = append(pieces, strings.Join(run, " "))
+		}
+	}
+	return pieces
+}
+
+// splitSentences splits text after ".", "!" or "?" (and any closing quotes or brackets)
+// where whitespace and then a capital, a digit or an opening quote follow, so "e.g. this"
+// and "v1.2" stay whole.
+func splitSentences(text string) []string {
+	var sentences []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !strings.ContainsRune(".!?", runes[i]) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && strings.ContainsRune(`"')]”’`, runes[end]) {
+			end++
+		}
+		next := end
+		for next < len(runes) && unicode.IsSpace(runes[next]) {
+			next++
+		}
+		if next == end || next == len(runes) {
+			continue
+		}
+		if r := runes[next]; !unicode.IsUpper(r) && !unicode.IsDigit(r) && !strings.ContainsRune(`"'([“‘`, r) {
+			continue
+		}
+		sentences = append(sentences, strings.TrimSpace(string(runes[start:end])))
+		start = next
+		i = next - 1
+	}
+	if rest := strings.TrimSpace(string(runes[start:])); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	return sentences
+}
+
+// markdownBlocks splits markdown into its paragraphs at blank lines, keeping each fenced
+// code block whole, blank lines and all, as a block of its own.
+func markdownBlocks(content string) []string {
+	var blocks []string
+	var current []string
+	var fences fenceTracker
+	flush := func() {
+		if block := strings.TrimSpace(strings.Join(current, "\n")); block != "" {
+			blocks = append(blocks, block)
+		}
+		current = nil
+	}
+	for _, line := range strings.Split(content, "\n") {
+		wasOpen := fences.open != ""
+		inCode := fences.next(line)
+		switch {
+		case inCode && !wasOpen:
+			// The fence opens a block of its own, even right under a paragraph
+			flush()
+			current = append(current, line)
+		case inCode:
+			current = append(current, line)
+			if fences.open == "" {
+				flush()
+			}
+		case strings.TrimSpace(line) == "":
+			flush()
+		default:
+			current = append(current, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// codeFence returns the fence a line opens or closes a fenced code block with: three or
+// more backticks or tildes, indented at most three spaces. It is "" for any other line.
+func codeFence(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return ""
+	}
+	for _, c := range []byte{'`', '~'} {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == c {
+			n++
+		}
+		if n >= 3 {
+			return trimmed[:n]
+		}
+	}
+	return ""
+}
+
+// fenceTracker follows fenced code blocks through a document line by line.
+type fenceTracker struct {
+	open string // the fence of the block we are in, "" outside one
+}
+
+// next reports whether line belongs to a fenced code block, its fences included. A
+// block closes at a bare fence of its character at least as long as the opening one;
+// one never closed runs to the end of the document.
+func (f *fenceTracker) next(line string) bool {
+	fence := codeFence(line)
+	if f.open == "" {
+		f.open = fence
+		return fence != ""
+	}
+	rest := strings.TrimLeft(line, " ")[len(fence):]
+	if fence != "" && fence[0] == f.open[0] && len(fence) >= len(f.open) && strings.TrimSpace(rest) == "" {
+		f.open = ""
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkSectionOverlap(t *testing.T) {
+	// Paragraphs of 4 words: a1 a2 a3 a4, b1 b2 b3 b4, ...
+	var paragraphs []string
+	for _, p := range []string{"a", "b", "c", "d", "e"} {
+		paragraphs = append(paragraphs, strings.Join([]string{p + "1", p + "2", p + "3", p + "4"}, " "))
+	}
+	section := Section{Title: "Dense", HeaderLevel: 2, Content: strings.Join(paragraphs, "\n\n"), Sequence: 1}
+
+	var got []string
+	for _, chunk := range ChunkSection(section, ChunkOptions{Words: 8, Overlap: 4}) {
+		got = append(got, strings.ReplaceAll(chunk.Text, "\n\n", " | "))
+	}
+	want := []string{
+		"a1 a2 a3 a4 | b1 b2 b3 b4",
+		"b1 b2 b3 b4 | c1 c2 c3 c4",
+		"c1 c2 c3 c4 | d1 d2 d3 d4",
+		"d1 d2 d3 d4 | e1 e2 e3 e4",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected each chunk to repeat the paragraph before, got %q", got)
+	}
+
+	// A trailing paragraph longer than the overlap is not repeated
+	got = nil
+	for _, chunk := range ChunkSection(section, ChunkOptions{Words: 8, Overlap: 3}) {
+		got = append(got, strings.ReplaceAll(chunk.Text, "\n\n", " | "))
+	}
+	if len(got) != 3 || got[1] != "c1 c2 c3 c4 | d1 d2 d3 d4" {
+		t.Fatalf("expected no overlap, got %q", got)
+	}
+
+	// An overlap that leaves no room for the next paragraph is dropped, not looped on
+	section.Content = "a1 a2 a3 a4 a5 a6\n\nb1 b2 b3 b4 b5 b6 b7 b8\n\nc1"
+	got = nil
+	for _, chunk := range ChunkSection(section, ChunkOptions{Words: 8, Overlap: 6}) {
+		got = append(got, strings.ReplaceAll(chunk.Text, "\n\n", " | "))
+	}
+	want = []string{"a1 a2 a3 a4 a5 a6", "b1 b2 b3 b4 b5 b6 b7 b8", "c1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected chunks %q", got)
+	}
+}
+
+func TestLoadChunking(t *testing.T) {
+	previous := defaultChunking
+	defer func() { defaultChunking = previous }()
+
+	t.Setenv("MNEME_CHUNK_WORDS", "300")
+	t.Setenv("MNEME_CHUNK_OVERLAP", "50")
+	if err := loadChunking(); err != nil || defaultChunking != (ChunkOptions{Words: 300, Overlap: 50, Depth: defaultSectionDepth}) {
+		t.Fatalf("expected 300 words with 50 overlap, got %+v, %v", defaultChunking, err)
+	}
+	for _, bad := range [][2]string{{"many", "0"}, {"0", "0"}, {"300", "300"}, {"300", "-1"}} {
+		t.Setenv("MNEME_CHUNK_WORDS", bad[0])
+		t.Setenv("MNEME_CHUNK_OVERLAP", bad[1])
+		if err := loadChunking(); err == nil {
+			t.Fatalf("expected an error for words %s, overlap %s", bad[0], bad[1])
+		}
+	}
+
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	chunks := newChunkFlags(fs)
+	if err := fs.Parse([]string{"--chunk-overlap", "20"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if o, err := chunks.options(); err != nil || o != (ChunkOptions{Words: 300, Overlap: 20, Depth: defaultSectionDepth}) {
+		t.Fatalf("expected the flags to default to the environment, got %+v, %v", o, err)
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	got := splitSentences(`We ship v1.2 today, e.g. the API. Is it ready? "Yes!" she said. 3 teams agree.`)
+	want := []string{"We ship v1.2 today, e.g. the API.", "Is it ready?", `"Yes!" she said.`, "3 teams agree."}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestChunkSectionLongParagraph(t *testing.T) {
+	sentence := "Word" + strings.Repeat(" word", 8) + "."
+	long := strings.Repeat(sentence+" ", 5) + "X" + strings.Repeat(" x", 24)
+	section := Section{Title: "Wall of text", HeaderLevel: 2, Content: "Intro.\n\n" + long, Sequence: 1}
+
+	chunks := ChunkSection(section, ChunkOptions{Words: 20})
+	for _, chunk := range chunks {
+		if words := len(strings.Fields(chunk.Text)); words > 20 {
+			t.Fatalf("expected no chunk over 20 words, got %d in %q", words, chunk.Text)
+		}
+	}
+	if len(chunks) != 5 {
+		t.Fatalf("expected 5 chunks, got %d", len(chunks))
+	}
+	// Sentences continue their paragraph, the intro stays one of its own, and the
+	// 25-word sentence is cut at 20 words
+	if chunks[0].Text != "Intro.\n\n"+sentence+" "+sentence || chunks[1].Text != sentence+" "+sentence {
+		t.Fatalf("unexpected chunks %q, %q", chunks[0].Text, chunks[1].Text)
+	}
+	if chunks[4].Text != "x x x x x" {
+		t.Fatalf("expected the long sentence's last 5 words on their own, got %q", chunks[4].Text)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"Auth tokens move to Postgres.", 8},
+		{"if (err != nil) { return err; }", 13},
+		{"東京へ行く", 5},
+	} {
+		if got := estimateTokens(c.text); got != c.want {
+			t.Fatalf("estimateTokens(%q) = %d, want %d", c.text, got, c.want)
+		}
+	}
+}
+
+func TestChunkSectionTokens(t *testing.T) {
+	// Six words of code that count as 16 tokens
+	line := "if x.y(z) { return a[b]; }"
+	section := Section{Title: "Code", HeaderLevel: 2, Content: strings.Repeat(line+"\n\n", 4), Sequence: 1}
+
+	if chunks := ChunkSection(section, ChunkOptions{Words: 600}); len(chunks) != 1 {
+		t.Fatalf("expected one chunk by words, got %d", len(chunks))
+	}
+	chunks := ChunkSection(section, ChunkOptions{Words: 600, Tokens: 40})
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks of 2 lines by tokens, got %d", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if n := estimateTokens(chunk.Text); n > 40 {
+			t.Fatalf("expected chunks within 40 tokens, got %d in %q", n, chunk.Text)
+		}
+	}
+
+	if err := (ChunkOptions{Words: 600, Overlap: 100, Tokens: 80}).validate(); err == nil {
+		t.Fatal("expected an overlap past the token budget rejected")
+	}
+	if err := (ChunkOptions{Words: 10, Overlap: 100, Tokens: 200}).validate(); err != nil {
+		t.Fatalf("expected the overlap checked against the tokens, got %v", err)
+	}
+}
+
+func TestMarkdownBlocks(t *testing.T) {
+	content := "Run this:\n```sh\n## not a header\n\necho hi\n```\nAfter.\n\n~~~\nunclosed\n\n```\nstill code"
+	want := []string{"Run this:", "```sh\n## not a header\n\necho hi\n```", "After.", "~~~\nunclosed\n\n```\nstill code"}
+	if got := markdownBlocks(content); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestChunkSectionCodeFences(t *testing.T) {
+	code := "```go\nfunc main() {\n\tfmt.Println(\"one two three four five six\")\n\n\treturn\n}\n```"
+	content := "Some background here.\n\nFirst we set up the project. Then we write main:\n\n" + code + "\n\nThat is all there is to it."
+	section := Section{Title: "Setup", HeaderLevel: 2, Content: content, Sequence: 1}
+
+	chunks := ChunkSection(section, ChunkOptions{Words: 12})
+	var got []string
+	for _, chunk := range chunks {
+		got = append(got, chunk.Text)
+	}
+	want := []string{
+		"Some background here.\n\nFirst we set up the project.",
+		"Then we write main:\n\n" + code,
+		"That is all there is to it.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the code block whole with its introducing sentence, got %q", got)
+	}
+
+	// Headers inside a fence stay in their section
+	sections := ParseMarkdown("## Script\n\n```sh\n## install\napt install mneme\n```\n")
+	if len(sections) != 1 || !strings.Contains(sections[0].Content, "## install") {
+		t.Fatalf("expected one section holding the code, got %+v", sections)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// claudeConversation is one conversation of a Claude.ai data export's
+// conversations.json.
+type claudeConversation struct {
+	UUID      string `json:"uuid"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	Messages  []struct {
+		UUID      string `json:"uuid"`
+		Sender    string `json:"sender"` // human or assistant
+		Text      string `json:"text"`
+		CreatedAt string `json:"created_at"`
+		Content   []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"chat_messages"`
+}
+
+// readClaudeExport reads the conversations of a Claude.ai data export: the zip file as
+// downloaded, or the conversations.json inside it.
+func readClaudeExport(exportPath string) ([]claudeConversation, error) {
+	var r io.Reader
+	if strings.EqualFold(path.Ext(exportPath), ".zip") {
+		archive, err := zip.OpenReader(exportPath)
+		if err != nil {
+			return nil, fmt.Errorf("open export: %w", err)
+		}
+		defer archive.Close()
+		for _, f := range archive.File {
+			if path.Base(f.Name) != "conversations.json" {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("open %s: %w", f.Name, err)
+			}
+			defer rc.Close()
+			r = rc
+			break
+		}
+		if r == nil {
+			return nil, fmt.Errorf("%s: no conversations.json in the export", exportPath)
+		}
+	} else {
+		f, err := os.Open(exportPath)
+		if err != nil {
+			return nil, fmt.Errorf("open export: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var conversations []claudeConversation
+	if err := json.NewDecoder(r).Decode(&conversations); err != nil {
+		return nil, fmt.Errorf("read conversations: %w", err)
+	}
+	return conversations, nil
+}
+
+// textMessages maps a conversation's human and assistant turns to text messages, noise
+// stripped. Tool use and attachments are left out: only text blocks are read, or the
+// message's text when it has no content blocks.
+func (c claudeConversation) textMessages(userAlias, assistantAlias string) []textMessage {
+	var messages []textMessage
+	for _, m := range c.Messages {
+		var isUser bool
+		switch m.Sender {
+		case "human":
+			isUser = true
+		case "assistant":
+		default:
+			continue
+		}
+		text := m.Text
+		if len(m.Content) > 0 {
+			var texts []string
+			for _, block := range m.Content {
+				if block.Type == "text" && block.Text != "" {
+					texts = append(texts, block.Text)
+				}
+			}
+			text = strings.Join(texts, "\n")
+		}
+		cleaned := stripNoise(text)
+		if len(cleaned) < 3 || m.UUID == "" {
+			continue
+		}
+		ts, _ := time.Parse(time.RFC3339Nano, m.CreatedAt)
+		role := assistantAlias
+		if isUser {
+			role = userAlias
+		}
+		messages = append(messages, textMessage{
+			Role:      role,
+			Text:      cleaned,
+			Timestamp: ts.In(mnemeLocation),
+			IsUser:    isUser,
+			MessageID: m.UUID,
+			SessionID: c.UUID,
+		})
+	}
+	return messages
+}
+
+// title is the conversation's name, or its date for one never named.
+func (c claudeConversation) title() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	created, err := time.Parse(time.RFC3339Nano, c.CreatedAt)
+	if err != nil {
+		return "Claude conversation " + c.UUID
+	}
+	return "Claude conversation " + created.In(mnemeLocation).Format("Jan 02, 2006 15:04")
+}
+
+// ClaudeImportResult counts what an import stored.
+type ClaudeImportResult struct {
+	Conversations int
+	Messages      int
+	Batches       int
+	// Skipped counts messages already stored by an earlier import.
+	Skipped int
+}
+
+// ImportClaude ingests the conversations of a Claude.ai export as backfilled sessions,
+// so web conversations are stored like watched ones: messages and batch chunks, under
+// claude-ai://<conversation>/batch-N. Importing a newer export only adds what is new.
+func ImportClaude(ctx context.Context, db *sql.DB, ollama *OllamaClient, titleModel string, conversations []claudeConversation, userAlias, assistantAlias string, batchSize int, chunking ChunkOptions, progress ProgressFunc) (ClaudeImportResult, error) {
+	var result ClaudeImportResult
+	for i, c := range conversations {
+		if progress != nil {
+			progress(i, len(conversations), c.title())
+		}
+		messages := c.textMessages(userAlias, assistantAlias)
+		if len(messages) == 0 || c.UUID == "" {
+			continue
+		}
+		backfilled, err := Backfill(ctx, db, ollama, titleModel, backfillSession{
+			ID:           c.UUID,
+			Title:        c.title(),
+			SourcePrefix: fmt.Sprintf("claude-ai://%s/", c.UUID),
+			Messages:     messages,
+		}, batchSize, chunking, nil)
+		if err != nil {
+			return result, fmt.Errorf("import %q: %w", c.title(), err)
+		}
+		if backfilled.Messages > 0 {
+			result.Conversations++
+		}
+		result.Messages += backfilled.Messages
+		result.Batches += backfilled.Batches
+		result.Skipped += backfilled.Skipped
+	}
+	if progress != nil && len(conversations) > 0 {
+		progress(len(conversations), len(conversations), "")
+	}
+	return result, nil
+}
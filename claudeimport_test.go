@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const claudeExport = `[
+	{"uuid": "conv-1", "name": "Token rotation", "created_at": "2025-06-02T10:00:00.000000Z", "chat_messages": [
+		{"uuid": "m1", "sender": "human", "text": "How often should we rotate auth tokens?", "created_at": "2025-06-02T10:00:00.000000Z", "content": [{"type": "text", "text": "How often should we rotate auth tokens?"}]},
+		{"uuid": "m2", "sender": "assistant", "text": "", "created_at": "2025-06-02T10:00:05.000000Z", "content": [{"type": "tool_use", "name": "search"}, {"type": "text", "text": "Weekly, with a TTL column."}]},
+		{"uuid": "m3", "sender": "assistant", "text": "ok", "created_at": "2025-06-02T10:00:06.000000Z", "content": []}
+	]},
+	{"uuid": "conv-2", "name": "", "created_at": "2025-06-03T09:30:00Z", "chat_messages": [
+		{"uuid": "m4", "sender": "human", "text": "Rename the logs bucket", "created_at": "2025-06-03T09:30:00Z"}
+	]},
+	{"uuid": "conv-3", "name": "Empty", "chat_messages": []}
+]`
+
+func TestReadClaudeExport(t *testing.T) {
+	withLocation(t, time.UTC)
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "data-2025-06-04.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	archive := zip.NewWriter(f)
+	for name, content := range map[string]string{"users.json": `[]`, "conversations.json": claudeExport} {
+		w, _ := archive.Create(name)
+		w.Write([]byte(content))
+	}
+	archive.Close()
+	f.Close()
+
+	conversations, err := readClaudeExport(zipPath)
+	if err != nil || len(conversations) != 3 {
+		t.Fatalf("expected 3 conversations from the zip, got %d, %v", len(conversations), err)
+	}
+	messages := conversations[0].textMessages("Me", "Claude")
+	if len(messages) != 2 {
+		t.Fatalf("expected the two turns with text, got %+v", messages)
+	}
+	if m := messages[0]; !m.IsUser || m.Role != "Me" || m.MessageID != "m1" || m.SessionID != "conv-1" || !m.Timestamp.Equal(time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected human turn %+v", m)
+	}
+	if m := messages[1]; m.IsUser || m.Role != "Claude" || m.Text != "Weekly, with a TTL column." {
+		t.Fatalf("expected only the assistant's text block, got %+v", m)
+	}
+	if got := conversations[1].textMessages("Me", "Claude"); len(got) != 1 || got[0].Text != "Rename the logs bucket" {
+		t.Fatalf("expected the message text without content blocks, got %+v", got)
+	}
+	if got := conversations[1].title(); got != "Claude conversation Jun 03, 2025 09:30" {
+		t.Fatalf("expected an unnamed conversation titled by date, got %q", got)
+	}
+
+	if _, err := readClaudeExport(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("expected an error for a missing export")
+	}
+}
+
+func TestImportClaude(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	if err := os.WriteFile(path, []byte(claudeExport), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	conversations, err := readClaudeExport(path)
+	if err != nil {
+		t.Fatalf("readClaudeExport: %v", err)
+	}
+	result, err := ImportClaude(context.Background(), db, client, "", conversations, "Me", "Claude", 6, defaultChunking, nil)
+	if err != nil {
+		t.Fatalf("ImportClaude: %v", err)
+	}
+	if result.Conversations != 2 || result.Messages != 3 || result.Batches != 2 || result.Skipped != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	var sources int
+	db.QueryRow(`SELECT COUNT(DISTINCT source_file) FROM chunks WHERE source_file IN ('claude-ai://conv-1/batch-0', 'claude-ai://conv-2/batch-0')`).Scan(&sources)
+	if sources != 2 {
+		t.Fatalf("expected a batch per conversation, got %d", sources)
+	}
+
+	// A newer export adds only what is new
+	again, err := ImportClaude(context.Background(), db, client, "", conversations, "Me", "Claude", 6, defaultChunking, nil)
+	if err != nil || again.Messages != 0 || again.Skipped != 3 {
+		t.Fatalf("expected everything skipped on a second import, got %+v, %v", again, err)
+	}
+}
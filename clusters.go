@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// topicClusterMaxIterations bounds k-means; it usually settles well before.
+const topicClusterMaxIterations = 50
+
+// topicClusterSamples is how many chunks nearest each centroid are kept to describe it.
+const topicClusterSamples = 5
+
+const topicLabelPrompt = `You name a cluster of related notes from someone's personal memory.
+Return JSON only, in exactly this shape:
+{"label": "..."}
+The label is a short lowercase noun phrase of at most four words that says what the notes have in common.`
+
+type topicLabelResponse struct {
+	Label string `json:"label"`
+}
+
+// TopicCluster is one group of chunks whose embeddings sit close together.
+type TopicCluster struct {
+	Label     string   `json:"label"`
+	Size      int      `json:"size"`
+	FirstSeen string   `json:"first_seen,omitempty"`
+	LastSeen  string   `json:"last_seen,omitempty"`
+	Titles    []string `json:"titles"`
+	ChunkIDs  []int64  `json:"-"`
+	excerpts  []string
+}
+
+type clusterPoint struct {
+	chunkID int64
+	title   string
+	text    string
+	validAt string
+	vec     []float32
+}
+
+// deserializeFloat32 reverses sqlite_vec.SerializeFloat32 (little-endian float32s).
+func deserializeFloat32(blob []byte) ([]float32, error) {
+	if len(blob)%4 != 0 {
+		return nil, fmt.Errorf("embedding blob length %d is not a multiple of 4", len(blob))
+	}
+	vec := make([]float32, len(blob)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[i*4:]))
+	}
+	return vec, nil
+}
+
+func normalizeVec(vec []float32) {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vec {
+		vec[i] /= norm
+	}
+}
+
+func dotVec(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// defaultTopicClusters picks k from the number of chunks: roughly sqrt(n/2), between 2 and 12.
+func defaultTopicClusters(n int) int {
+	k := int(math.Sqrt(float64(n) / 2))
+	if k < 2 {
+		k = 2
+	}
+	if k > 12 {
+		k = 12
+	}
+	return k
+}
+
+// ClusterTopics groups chunk embeddings with spherical k-means (cosine similarity), largest
+// cluster first. from/to (YYYY-MM-DD, inclusive) restrict to chunks dated in that range.
+// If k <= 0 it is chosen from the number of chunks. Clusters come back unlabeled.
+func ClusterTopics(db *sql.DB, from, to string, k int) ([]TopicCluster, error) {
+	from, err := NormalizeDate(from)
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	if to, err = NormalizeDate(to); err != nil {
+		return nil, fmt.Errorf("to: %w", err)
+	}
+	query := `SELECT v.chunk_id, v.embedding, c.section_title, c.text, c.valid_at
+		FROM vec_chunks v
+		JOIN chunks c ON c.id = v.chunk_id`
+	var conditions []string
+	var args []any
+	if from != "" {
+		conditions = append(conditions, "c.valid_at >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conditions = append(conditions, "c.valid_at < date(?, '+1 day')")
+		args = append(args, to)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY v.chunk_id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var points []clusterPoint
+	for rows.Next() {
+		var p clusterPoint
+		var blob []byte
+		var validAt sql.NullString
+		if err := rows.Scan(&p.chunkID, &blob, &p.title, &p.text, &validAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if p.vec, err = deserializeFloat32(blob); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		normalizeVec(p.vec)
+		p.validAt = validAt.String
+		points = append(points, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(points) == 0 {
+		return []TopicCluster{}, nil
+	}
+	if k <= 0 {
+		k = defaultTopicClusters(len(points))
+	}
+	if k > len(points) {
+		k = len(points)
+	}
+
+	assignments, centroids := kMeans(points, k)
+
+	clusters := make([]TopicCluster, k)
+	members := make([][]clusterPoint, k)
+	for i, p := range points {
+		c := assignments[i]
+		members[c] = append(members[c], p)
+	}
+	for c := range clusters {
+		group := members[c]
+		sort.Slice(group, func(i, j int) bool {
+			return dotVec(group[i].vec, centroids[c]) > dotVec(group[j].vec, centroids[c])
+		})
+		cluster := &clusters[c]
+		cluster.Size = len(group)
+		cluster.Titles = []string{}
+		for i, p := range group {
+			cluster.ChunkIDs = append(cluster.ChunkIDs, p.chunkID)
+			if p.validAt != "" {
+				if cluster.FirstSeen == "" || p.validAt < cluster.FirstSeen {
+					cluster.FirstSeen = p.validAt
+				}
+				if p.validAt > cluster.LastSeen {
+					cluster.LastSeen = p.validAt
+				}
+			}
+			if i < topicClusterSamples {
+				cluster.Titles = append(cluster.Titles, p.title)
+				cluster.excerpts = append(cluster.excerpts, truncate(p.text, 300))
+			}
+		}
+	}
+
+	// Empty clusters can survive when several points are identical
+	kept := clusters[:0]
+	for _, c := range clusters {
+		if c.Size > 0 {
+			kept = append(kept, c)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Size > kept[j].Size })
+	return kept, nil
+}
+
+// kMeans runs spherical k-means with k-means++ seeding. The seed is fixed so the
+// same store always produces the same report.
+func kMeans(points []clusterPoint, k int) ([]int, [][]float32) {
+	rng := rand.New(rand.NewSource(1))
+	dim := len(points[0].vec)
+
+	centroids := make([][]float32, 0, k)
+	first := points[rng.Intn(len(points))].vec
+	centroids = append(centroids, append([]float32(nil), first...))
+	for len(centroids) < k {
+		// Pick the next seed with probability proportional to its distance from existing seeds
+		weights := make([]float64, len(points))
+		var total float64
+		for i, p := range points {
+			best := float32(-2)
+			for _, c := range centroids {
+				if s := dotVec(p.vec, c); s > best {
+					best = s
+				}
+			}
+			d := float64(1 - best)
+			weights[i] = d * d
+			total += weights[i]
+		}
+		if total == 0 {
+			centroids = append(centroids, append([]float32(nil), points[rng.Intn(len(points))].vec...))
+			continue
+		}
+		r := rng.Float64() * total
+		chosen := len(points) - 1
+		for i, w := range weights {
+			if r -= w; r <= 0 {
+				chosen = i
+				break
+			}
+		}
+		centroids = append(centroids, append([]float32(nil), points[chosen].vec...))
+	}
+
+	assignments := make([]int, len(points))
+	for i := range assignments {
+		assignments[i] = -1
+	}
+	for iter := 0; iter < topicClusterMaxIterations; iter++ {
+		changed := false
+		for i, p := range points {
+			best, bestSim := 0, float32(-2)
+			for c, centroid := range centroids {
+				if s := dotVec(p.vec, centroid); s > bestSim {
+					best, bestSim = c, s
+				}
+			}
+			if assignments[i] != best {
+				assignments[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		sums := make([][]float32, k)
+		for c := range sums {
+			sums[c] = make([]float32, dim)
+		}
+		for i, p := range points {
+			sum := sums[assignments[i]]
+			for d, v := range p.vec {
+				sum[d] += v
+			}
+		}
+		for c := range centroids {
+			var zero = true
+			for _, v := range sums[c] {
+				if v != 0 {
+					zero = false
+					break
+				}
+			}
+			if zero {
+				continue // keep the old centroid for an empty cluster
+			}
+			normalizeVec(sums[c])
+			centroids[c] = sums[c]
+		}
+	}
+	return assignments, centroids
+}
+
+// LabelTopicClusters names each cluster from its most central chunks via the generate
+// model. Clusters the model can't label fall back to their most common topic tag, then
+// to the most central chunk's section title.
+func LabelTopicClusters(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, clusters []TopicCluster, progress ProgressFunc) error {
+	for i := range clusters {
+		c := &clusters[i]
+		if progress != nil {
+			progress(i, len(clusters), fmt.Sprintf("cluster %d", i+1))
+		}
+
+		if ollama != nil {
+			var b strings.Builder
+			for j, text := range c.excerpts {
+				fmt.Fprintf(&b, "## %s\n%s\n\n", c.Titles[j], text)
+			}
+			raw, err := ollama.GenerateJSON(ctx, model, topicLabelPrompt, b.String())
+			if err != nil {
+				return fmt.Errorf("label cluster: %w", err)
+			}
+			var resp topicLabelResponse
+			if err := decodeModelJSON(raw, &resp); err != nil {
+				if !errors.Is(err, errBadModelResponse) {
+					return err
+				}
+				log.Printf("topics: could not label cluster %d: %v", i+1, err)
+			}
+			c.Label = normalizeTag(resp.Label)
+		}
+		if c.Label == "" {
+			label, err := dominantTag(db, c.ChunkIDs)
+			if err != nil {
+				return err
+			}
+			c.Label = label
+		}
+		if c.Label == "" && len(c.Titles) > 0 {
+			c.Label = c.Titles[0]
+		}
+	}
+	if progress != nil && len(clusters) > 0 {
+		progress(len(clusters), len(clusters), "")
+	}
+	return nil
+}
+
+// dominantTag returns the tag carried by the most of the given chunks ("" if none).
+func dominantTag(db *sql.DB, chunkIDs []int64) (string, error) {
+	if len(chunkIDs) == 0 {
+		return "", nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")
+	args := make([]any, len(chunkIDs))
+	for i, id := range chunkIDs {
+		args[i] = id
+	}
+	var tag string
+	err := db.QueryRow(fmt.Sprintf(
+		`SELECT tag FROM chunk_tags WHERE chunk_id IN (%s)
+		 GROUP BY tag ORDER BY COUNT(*) DESC, tag LIMIT 1`, placeholders), args...).Scan(&tag)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return tag, err
+}
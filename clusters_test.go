@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+func TestDeserializeFloat32(t *testing.T) {
+	vec := []float32{1.5, -2, 0, 3.25}
+	blob, err := sqlite_vec.SerializeFloat32(vec)
+	if err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	got, err := deserializeFloat32(blob)
+	if err != nil {
+		t.Fatalf("deserializeFloat32: %v", err)
+	}
+	for i := range vec {
+		if got[i] != vec[i] {
+			t.Fatalf("expected %v, got %v", vec, got)
+		}
+	}
+	if _, err := deserializeFloat32([]byte{1, 2, 3}); err == nil {
+		t.Fatal("expected error for truncated blob")
+	}
+}
+
+func TestClusterTopics(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	insertChunk(t, db, "Ledger schema migration.", "a.md", "Migration plan", "", 2, "2025-01-01", makeVec(map[int]float32{0: 1, 1: 0.1}))
+	insertChunk(t, db, "Backfilling the ledger.", "b.md", "Backfill", "", 2, "2025-01-05", makeVec(map[int]float32{0: 1, 1: 0.2}))
+	insertChunk(t, db, "Rollback for the migration.", "c.md", "Rollback", "", 2, "2025-02-01", makeVec(map[int]float32{0: 1}))
+	insertChunk(t, db, "Trip to Lisbon.", "d.md", "Lisbon", "", 2, "2025-03-01", makeVec(map[int]float32{5: 1}))
+	insertChunk(t, db, "Booking flights.", "e.md", "Flights", "", 2, "2025-03-02", makeVec(map[int]float32{5: 1, 6: 0.1}))
+
+	clusters, err := ClusterTopics(db, "", "", 2)
+	if err != nil {
+		t.Fatalf("ClusterTopics: %v", err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clusters))
+	}
+	if clusters[0].Size != 3 || clusters[1].Size != 2 {
+		t.Fatalf("unexpected sizes: %d, %d", clusters[0].Size, clusters[1].Size)
+	}
+	if clusters[0].FirstSeen != "2025-01-01" || clusters[0].LastSeen != "2025-02-01" {
+		t.Fatalf("unexpected span: %s → %s", clusters[0].FirstSeen, clusters[0].LastSeen)
+	}
+	if clusters[1].Titles[0] != "Lisbon" && clusters[1].Titles[0] != "Flights" {
+		t.Fatalf("unexpected titles: %v", clusters[1].Titles)
+	}
+
+	// Date range limits which chunks are clustered
+	clusters, err = ClusterTopics(db, "2025-03-01", "2025-03-02", 0)
+	if err != nil {
+		t.Fatalf("ClusterTopics with range: %v", err)
+	}
+	total := 0
+	for _, c := range clusters {
+		total += c.Size
+	}
+	if total != 2 {
+		t.Fatalf("expected 2 chunks in range, got %d", total)
+	}
+}
+
+func TestLabelTopicClusters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(generateResponse{Response: `{"label": "Ledger Migration"}`})
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	id1 := insertChunk(t, db, "Ledger schema migration.", "a.md", "Migration plan", "", 2, "", makeVec(map[int]float32{0: 1}))
+	id2 := insertChunk(t, db, "Trip to Lisbon.", "b.md", "Lisbon", "", 2, "", makeVec(map[int]float32{5: 1}))
+	if _, err := db.Exec(`INSERT INTO chunk_tags (chunk_id, tag, source, created_at) VALUES (?, 'travel', 'topic', '2025-01-01')`, id2); err != nil {
+		t.Fatalf("insert tag: %v", err)
+	}
+
+	clusters, err := ClusterTopics(db, "", "", 2)
+	if err != nil {
+		t.Fatalf("ClusterTopics: %v", err)
+	}
+
+	client := NewOllamaClient(server.URL, "embed")
+	if err := LabelTopicClusters(context.Background(), db, client, "gen", clusters, nil); err != nil {
+		t.Fatalf("LabelTopicClusters: %v", err)
+	}
+	for _, c := range clusters {
+		if c.Label != "ledger migration" {
+			t.Fatalf("expected model label, got %q", c.Label)
+		}
+	}
+
+	// Without a model, fall back to the dominant tag, then the section title
+	clusters, err = ClusterTopics(db, "", "", 2)
+	if err != nil {
+		t.Fatalf("ClusterTopics: %v", err)
+	}
+	if err := LabelTopicClusters(context.Background(), db, nil, "", clusters, nil); err != nil {
+		t.Fatalf("LabelTopicClusters without model: %v", err)
+	}
+	labels := map[int64]string{}
+	for _, c := range clusters {
+		labels[c.ChunkIDs[0]] = c.Label
+	}
+	if labels[id1] != "Migration plan" || labels[id2] != "travel" {
+		t.Fatalf("unexpected fallback labels: %v", labels)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// condensedSourceSuffix names the source a condensed session's chunks are stored under,
+// next to its batches: watch://<session>/condensed.
+const condensedSourceSuffix = "/condensed"
+
+// defaultCondenseMinAge is how long a session must have been quiet before it counts as
+// finished and may be condensed.
+const defaultCondenseMinAge = 24 * time.Hour
+
+const condensePrompt = `You rewrite part of a long conversation log into a few coherent notes, one per topic.
+The material is a run of conversation batches, each labeled with its date.
+Return JSON only, in exactly this shape:
+{"sections": [{"title": "...", "date": "YYYY-MM-DD", "text": "..."}]}
+Rules:
+- One section per distinct topic, in the order the topics first came up. Merge scattered discussion of the same topic.
+- title: 3 to 8 words naming the concrete subject.
+- date: the label date on which the topic was first discussed.
+- text: well-organized prose or "- " bullets keeping every decision, fact, name, number, command and open question. Drop greetings, filler and repetition.
+- Only use what the material states.`
+
+type condenseSection struct {
+	Title string `json:"title"`
+	Date  string `json:"date"`
+	Text  string `json:"text"`
+}
+
+type condenseResponse struct {
+	Sections []condenseSection `json:"sections"`
+}
+
+// CondensedSession reports how one session was condensed.
+type CondensedSession struct {
+	Session    string
+	SourceFile string
+	Batches    int
+	Before     int
+	After      int
+}
+
+type condenseInput struct {
+	id      int64
+	source  string
+	validAt string
+	text    string
+	ingest  time.Time
+}
+
+// condenseCandidates returns the watch batch chunks whose source matches pattern (a
+// glob such as watch://<session>/*), grouped by session prefix (watch://<session>).
+func condenseCandidates(db *sql.DB, pattern string) (map[string][]condenseInput, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("bad source pattern %q", pattern)
+	}
+	rows, err := db.Query(
+		`SELECT id, source_file, COALESCE(valid_at, ''), text, ingested_at FROM chunks
+		 WHERE ` + watchBatchFilter + `
+		 ORDER BY source_file, section_sequence, chunk_sequence`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make(map[string][]condenseInput)
+	for rows.Next() {
+		var in condenseInput
+		var ingestedAt string
+		if err := rows.Scan(&in.id, &in.source, &in.validAt, &in.text, &ingestedAt); err != nil {
+			return nil, err
+		}
+		if ok, _ := path.Match(pattern, in.source); !ok {
+			continue
+		}
+		in.ingest, _ = time.Parse(time.RFC3339, ingestedAt)
+		session := in.source[:strings.LastIndex(in.source, "/")]
+		sessions[session] = append(sessions[session], in)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Batches sort by number, not name, so batch-10 follows batch-9
+	for _, inputs := range sessions {
+		sort.SliceStable(inputs, func(i, j int) bool {
+			return watchBatchNumber(inputs[i].source) < watchBatchNumber(inputs[j].source)
+		})
+	}
+	return sessions, nil
+}
+
+func watchBatchNumber(source string) int {
+	var n int
+	fmt.Sscanf(source[strings.LastIndex(source, "/batch-")+len("/batch-"):], "%d", &n)
+	return n
+}
+
+// parseCondenseResponse keeps sections with a title and text, defaulting a missing or
+// unknown date to fallback.
+func parseCondenseResponse(raw string, dates map[string]bool, fallback string) ([]condenseSection, error) {
+	var resp condenseResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	var sections []condenseSection
+	for _, s := range resp.Sections {
+		s.Title = cleanBatchTitle(s.Title)
+		s.Text = strings.TrimSpace(s.Text)
+		if s.Title == "" || s.Text == "" {
+			continue
+		}
+		if !dates[s.Date] {
+			s.Date = fallback
+		}
+		sections = append(sections, s)
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("%w: no sections", errBadModelResponse)
+	}
+	return sections, nil
+}
+
+// condenseSession asks the model to reorganize a session's batches by topic, about
+// digestBatchWords words per call. Sections with the same title from different calls
+// are merged, keeping the earlier date.
+func condenseSession(ctx context.Context, ollama *OllamaClient, model string, inputs []condenseInput) ([]condenseSection, error) {
+	var groups [][]condenseInput
+	words := 0
+	for _, in := range inputs {
+		n := len(strings.Fields(in.text))
+		if len(groups) == 0 || (words+n > digestBatchWords && words > 0) {
+			groups = append(groups, nil)
+			words = 0
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], in)
+		words += n
+	}
+
+	var sections []condenseSection
+	byTitle := make(map[string]int)
+	for _, group := range groups {
+		dates := make(map[string]bool)
+		var b strings.Builder
+		for _, in := range group {
+			dates[in.validAt] = true
+			fmt.Fprintf(&b, "\n## [%s] %s\n%s\n", in.validAt, in.source, in.text)
+		}
+		raw, err := ollama.GenerateJSON(ctx, model, condensePrompt, b.String())
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseCondenseResponse(raw, dates, group[0].validAt)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range parsed {
+			key := strings.ToLower(s.Title)
+			if i, ok := byTitle[key]; ok {
+				sections[i].Text += "\n\n" + s.Text
+				continue
+			}
+			byTitle[key] = len(sections)
+			sections = append(sections, s)
+		}
+	}
+	return sections, nil
+}
+
+// renderCondensedMarkdown writes one section per topic, its header carrying the date
+// so ParseMarkdown dates the chunks like the batches they replace.
+func renderCondensedMarkdown(sections []condenseSection) string {
+	var b strings.Builder
+	for _, s := range sections {
+		header := s.Title
+		if day, err := time.Parse("2006-01-02", s.Date); err == nil {
+			header += ", " + day.Format("January 2, 2006")
+		}
+		fmt.Fprintf(&b, "## %s\n\n%s\n\n", header, s.Text)
+	}
+	return b.String()
+}
+
+// Condense rewrites the watch batches of every finished session matching pattern into
+// topic-organized chunks stored as watch://<session>/condensed, then deletes the
+// batches. A session counts as finished once its newest batch is older than minAge.
+// Condensing a session again folds its new batches in with the earlier condensed text.
+func Condense(ctx context.Context, db *sql.DB, ollama *OllamaClient, model, pattern string, minAge time.Duration, now time.Time, progress ProgressFunc) ([]CondensedSession, error) {
+	sessions, err := condenseCandidates(db, pattern)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(sessions))
+	for session, inputs := range sessions {
+		finished := true
+		for _, in := range inputs {
+			finished = finished && now.Sub(in.ingest) >= minAge
+		}
+		if finished {
+			names = append(names, session)
+		}
+	}
+	sort.Strings(names)
+
+	var results []CondensedSession
+	for i, session := range names {
+		if progress != nil {
+			progress(i, len(names), session)
+		}
+		inputs := sessions[session]
+		sourceFile := session + condensedSourceSuffix
+
+		var previous []condenseInput
+		rows, err := db.Query(`SELECT id, COALESCE(valid_at, ''), text FROM chunks WHERE source_file = ? ORDER BY section_sequence, chunk_sequence`, sourceFile)
+		if err != nil {
+			return results, err
+		}
+		for rows.Next() {
+			in := condenseInput{source: sourceFile}
+			if err := rows.Scan(&in.id, &in.validAt, &in.text); err != nil {
+				rows.Close()
+				return results, err
+			}
+			previous = append(previous, in)
+		}
+		rows.Close()
+
+		sections, err := condenseSession(ctx, ollama, model, append(previous, inputs...))
+		if err != nil {
+			return results, fmt.Errorf("condense %s: %w", session, err)
+		}
+		ids, err := ingestMarkdownSource(ctx, db, ollama, sourceFile, renderCondensedMarkdown(sections))
+		if err != nil {
+			return results, fmt.Errorf("store %s: %w", sourceFile, err)
+		}
+		batchIDs := make([]int64, 0, len(inputs))
+		batches := make(map[string]bool)
+		for _, in := range inputs {
+			batchIDs = append(batchIDs, in.id)
+			batches[in.source] = true
+		}
+		if _, err := DeleteChunks(db, batchIDs); err != nil {
+			return results, fmt.Errorf("delete batches of %s: %w", session, err)
+		}
+		results = append(results, CondensedSession{
+			Session:    session,
+			SourceFile: sourceFile,
+			Batches:    len(batches),
+			Before:     len(inputs) + len(previous),
+			After:      len(ids),
+		})
+	}
+	if progress != nil && len(names) > 0 {
+		progress(len(names), len(names), "")
+	}
+	return results, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCondenseResponse(t *testing.T) {
+	dates := map[string]bool{"2025-06-03": true}
+	sections, err := parseCondenseResponse(`{"sections": [
+		{"title": "Auth tokens.", "date": "2025-06-03", "text": "Tokens move to Postgres."},
+		{"title": "Deploys", "date": "1999-01-01", "text": "Ship Friday."},
+		{"title": "", "date": "2025-06-03", "text": "No title."}
+	]}`, dates, "2025-06-02")
+	if err != nil {
+		t.Fatalf("parseCondenseResponse: %v", err)
+	}
+	if len(sections) != 2 || sections[0].Title != "Auth tokens" || sections[1].Date != "2025-06-02" {
+		t.Fatalf("unexpected sections: %+v", sections)
+	}
+	if _, err := parseCondenseResponse(`{"sections": []}`, dates, ""); !errors.Is(err, errBadModelResponse) {
+		t.Fatalf("expected errBadModelResponse, got %v", err)
+	}
+}
+
+func TestCondense(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			prompts = append(prompts, req.Prompt)
+			answer := `{"sections": [
+				{"title": "Auth tokens in Postgres", "date": "2025-06-03", "text": "- Tokens move to Postgres\n- TTL still open"},
+				{"title": "Friday deploy", "date": "2025-06-04", "text": "Deploy on Friday after the migration."}
+			]}`
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		case "/api/embed":
+			vec := make([]float64, EmbedDimension)
+			vec[0] = 1
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	old := time.Date(2025, time.June, 5, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	for _, b := range []struct{ source, date, text string }{
+		{"watch://s1/batch-0", "2025-06-03", "first batch"},
+		{"watch://s1/batch-10", "2025-06-04", "eleventh batch"},
+		{"watch://s1/batch-2", "2025-06-03", "third batch"},
+		{"watch://s2/batch-0", "2025-06-04", "other session"},
+	} {
+		insertChunk(t, db, b.text, b.source, "June 3, 2025", "", 2, b.date, vec)
+	}
+	db.Exec(`UPDATE chunks SET ingested_at = ? WHERE source_file LIKE 'watch://s1/%'`, old)
+	summary := insertChunk(t, db, "**Decisions**\n- Ship Friday", "watch://s1/summary-0", "Backend: session summary, June 4, 2025", "", 2, "2025-06-04", vec)
+
+	client := NewOllamaClient(server.URL, "embed")
+	now := time.Date(2025, time.June, 10, 0, 0, 0, 0, time.UTC)
+
+	// s2 was ingested just now, so it is still active
+	sessions, err := Condense(context.Background(), db, client, "gen", "watch://*/*", time.Hour, time.Now(), nil)
+	if err != nil || len(sessions) != 1 || sessions[0].Session != "watch://s1" {
+		t.Fatalf("expected only the quiet session condensed, got %+v, %v", sessions, err)
+	}
+	if sessions[0].Batches != 3 || sessions[0].Before != 3 || sessions[0].After != 2 {
+		t.Fatalf("unexpected counts: %+v", sessions[0])
+	}
+	first, third, eleventh := strings.Index(prompts[0], "first batch"), strings.Index(prompts[0], "third batch"), strings.Index(prompts[0], "eleventh batch")
+	if first < 0 || !(first < third && third < eleventh) {
+		t.Fatalf("expected batches in numeric order:\n%s", prompts[0])
+	}
+
+	var remaining int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE source_file LIKE 'watch://s1/batch-%'`).Scan(&remaining)
+	if remaining != 0 {
+		t.Fatalf("expected the batches deleted, %d left", remaining)
+	}
+	var kept int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE id = ?`, summary).Scan(&kept)
+	if kept != 1 {
+		t.Fatal("expected the session summary kept")
+	}
+	var title, validAt string
+	if err := db.QueryRow(`SELECT section_title, valid_at FROM chunks WHERE source_file = 'watch://s1/condensed' AND text LIKE '%Friday%'`).Scan(&title, &validAt); err != nil {
+		t.Fatalf("read condensed chunk: %v", err)
+	}
+	if title != "Friday deploy, June 4, 2025" || validAt != "2025-06-04" {
+		t.Fatalf("unexpected condensed chunk %q dated %q", title, validAt)
+	}
+
+	// Condensing again folds new batches into the condensed text
+	insertChunk(t, db, "late batch", "watch://s1/batch-11", "June 5, 2025", "", 2, "2025-06-05", vec)
+	db.Exec(`UPDATE chunks SET ingested_at = ? WHERE source_file = 'watch://s1/batch-11'`, old)
+	prompts = nil
+	sessions, err = Condense(context.Background(), db, client, "gen", "watch://s1/*", defaultCondenseMinAge, now, nil)
+	if err != nil || len(sessions) != 1 || sessions[0].Before != 3 {
+		t.Fatalf("expected the new batch folded into 2 condensed chunks, got %+v, %v", sessions, err)
+	}
+	if !strings.Contains(prompts[0], "Tokens move to Postgres") || !strings.Contains(prompts[0], "late batch") {
+		t.Fatalf("expected the earlier condensed text and the new batch in the prompt:\n%s", prompts[0])
+	}
+
+	if _, err := Condense(context.Background(), db, client, "gen", "watch://[", 0, now, nil); err == nil {
+		t.Fatal("expected an error for a bad pattern")
+	}
+}
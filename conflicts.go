@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// extractionKindConflicts marks chunks whose facts have been checked against older facts.
+const extractionKindConflicts = "conflicts"
+
+const (
+	conflictKindContradiction = "contradiction"
+	conflictKindSupersession  = "supersession"
+)
+
+// conflictCandidates is how many nearest facts each fact is compared with.
+const conflictCandidates = 5
+
+const conflictCheckPrompt = `You compare two statements from someone's personal memory about the same subject.
+Return JSON only, in exactly this shape:
+{"verdict": "consistent", "reason": "..."}
+Verdicts:
+- "supersedes": the newer statement replaces the older one because the situation changed (moved city, switched tools, changed jobs).
+- "contradicts": both describe the same thing at the same time but cannot both be true.
+- "consistent": they can both be true, or they are about different things.
+Keep the reason to one short sentence.`
+
+type conflictCheckResponse struct {
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason"`
+}
+
+// ConflictFact is one side of a conflict.
+type ConflictFact struct {
+	ID         int64  `json:"id"`
+	Text       string `json:"text"`
+	ValidAt    string `json:"valid_at,omitempty"`
+	SourceFile string `json:"source_file"`
+}
+
+// Conflict pairs an older fact with a newer one about the same entity.
+type Conflict struct {
+	ID         int64        `json:"id"`
+	Entity     string       `json:"entity"`
+	Kind       string       `json:"kind"`
+	Reason     string       `json:"reason,omitempty"`
+	Older      ConflictFact `json:"older"`
+	Newer      ConflictFact `json:"newer"`
+	DetectedAt string       `json:"detected_at"`
+}
+
+type ConflictDetectionResult struct {
+	FactsChecked   int
+	Comparisons    int
+	ConflictsFound int
+}
+
+// parseConflictResponse maps the model's verdict to a conflict kind ("" when consistent).
+func parseConflictResponse(raw string) (string, string, error) {
+	var resp conflictCheckResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return "", "", err
+	}
+	reason := strings.TrimSpace(resp.Reason)
+	switch strings.ToLower(strings.TrimSpace(resp.Verdict)) {
+	case "supersedes", "supersession":
+		return conflictKindSupersession, reason, nil
+	case "contradicts", "contradiction":
+		return conflictKindContradiction, reason, nil
+	case "consistent":
+		return "", reason, nil
+	}
+	return "", "", fmt.Errorf("%w: unknown verdict %q", errBadModelResponse, resp.Verdict)
+}
+
+// pendingConflictChunks returns chunks whose facts exist but have not been checked yet.
+func pendingConflictChunks(db *sql.DB) ([]int64, error) {
+	rows, err := db.Query(
+		`SELECT chunk_id FROM chunk_extractions WHERE kind = ?
+		 AND chunk_id NOT IN (SELECT chunk_id FROM chunk_extractions WHERE kind = ?)
+		 ORDER BY chunk_id`,
+		extractionKindFacts, extractionKindConflicts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+type factRow struct {
+	id      int64
+	text    string
+	validAt string
+}
+
+// isNewer reports whether a is later than b: dated after timeless, then by date, then by id.
+func (a factRow) isNewer(b factRow) bool {
+	if a.validAt != b.validAt {
+		return a.validAt > b.validAt
+	}
+	return a.id > b.id
+}
+
+// DetectConflicts checks the facts of the given chunks against their nearest existing
+// facts. Pairs that share an entity are judged by the generate model, and contradictions
+// or supersessions are recorded in the conflicts table.
+func DetectConflicts(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, chunkIDs []int64, progress ProgressFunc) (ConflictDetectionResult, error) {
+	var result ConflictDetectionResult
+
+	entities, err := loadEntityNames(db)
+	if err != nil {
+		return result, fmt.Errorf("load entities: %w", err)
+	}
+
+	type detected struct {
+		entityID     int64
+		olderID      int64
+		newerID      int64
+		kind, reason string
+		olderText    string
+		newerText    string
+	}
+	compared := make(map[[2]int64]bool)
+
+	for i, chunkID := range chunkIDs {
+		if progress != nil {
+			progress(i, len(chunkIDs), fmt.Sprintf("chunk %d", chunkID))
+		}
+
+		facts, err := chunkFacts(db, chunkID)
+		if err != nil {
+			return result, err
+		}
+
+		var found []detected
+		for _, fact := range facts {
+			result.FactsChecked++
+			factEntities := mentionedEntities(fact.text, entities)
+			if len(factEntities) == 0 {
+				continue
+			}
+
+			neighbors, err := nearestFacts(db, fact.id, conflictCandidates)
+			if err != nil {
+				return result, err
+			}
+			for _, other := range neighbors {
+				entityID, ok := sharedEntity(factEntities, mentionedEntities(other.text, entities))
+				if !ok {
+					continue
+				}
+				older, newer := other, fact
+				if other.isNewer(fact) {
+					older, newer = fact, other
+				}
+				pair := [2]int64{older.id, newer.id}
+				if compared[pair] {
+					continue
+				}
+				compared[pair] = true
+
+				prompt := fmt.Sprintf("Older (%s): %s\nNewer (%s): %s",
+					dateLabel(older.validAt), older.text, dateLabel(newer.validAt), newer.text)
+				raw, err := ollama.GenerateJSON(ctx, model, conflictCheckPrompt, prompt)
+				if err != nil {
+					return result, fmt.Errorf("check facts %d/%d: %w", older.id, newer.id, err)
+				}
+				result.Comparisons++
+				kind, reason, err := parseConflictResponse(raw)
+				if err != nil {
+					if errors.Is(err, errBadModelResponse) {
+						log.Printf("conflict detection: skipping facts %d/%d: %v", older.id, newer.id, err)
+						continue
+					}
+					return result, err
+				}
+				if kind == "" {
+					continue
+				}
+				found = append(found, detected{entityID, older.id, newer.id, kind, reason, older.text, newer.text})
+			}
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		var recorded []detected
+		err = withWriteTx(db, "detect conflicts", func(tx *sql.Tx) error {
+			recorded = recorded[:0]
+			for _, c := range found {
+				res, err := tx.Exec(
+					`INSERT OR IGNORE INTO conflicts (entity_id, older_fact_id, newer_fact_id, kind, reason, detected_at)
+					 VALUES (?, ?, ?, ?, ?, ?)`,
+					c.entityID, c.olderID, c.newerID, c.kind, c.reason, now,
+				)
+				if err != nil {
+					return fmt.Errorf("insert conflict: %w", err)
+				}
+				if n, _ := res.RowsAffected(); n > 0 {
+					recorded = append(recorded, c)
+				}
+				if c.kind == conflictKindSupersession {
+					// The older fact stops being true when the newer one starts
+					if _, err := tx.Exec(
+						`UPDATE facts SET superseded_by = ?,
+						   valid_until = COALESCE(valid_until, (SELECT valid_at FROM facts WHERE id = ?))
+						 WHERE id = ?`,
+						c.newerID, c.newerID, c.olderID,
+					); err != nil {
+						return fmt.Errorf("close superseded fact: %w", err)
+					}
+				}
+			}
+			if err := markExtracted(tx, chunkID, extractionKindConflicts); err != nil {
+				return fmt.Errorf("mark checked: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		result.ConflictsFound += len(recorded)
+		for _, c := range recorded {
+			var entity string
+			db.QueryRow(`SELECT name FROM entities WHERE id = ?`, c.entityID).Scan(&entity)
+			notify(eventConflictDetected, fmt.Sprintf("Detected %s about %s: %q, then %q", c.kind, entity, c.olderText, c.newerText), map[string]any{
+				"entity": entity,
+				"kind":   c.kind,
+				"reason": c.reason,
+				"older":  map[string]any{"id": c.olderID, "text": c.olderText},
+				"newer":  map[string]any{"id": c.newerID, "text": c.newerText},
+			})
+		}
+	}
+	if progress != nil && len(chunkIDs) > 0 {
+		progress(len(chunkIDs), len(chunkIDs), "")
+	}
+
+	return result, nil
+}
+
+func chunkFacts(db *sql.DB, chunkID int64) ([]factRow, error) {
+	rows, err := db.Query(`SELECT id, text, valid_at FROM facts WHERE chunk_id = ? ORDER BY id`, chunkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var facts []factRow
+	for rows.Next() {
+		var f factRow
+		var validAt sql.NullString
+		if err := rows.Scan(&f.id, &f.text, &validAt); err != nil {
+			return nil, err
+		}
+		f.validAt = validAt.String
+		facts = append(facts, f)
+	}
+	return facts, rows.Err()
+}
+
+// nearestFacts returns up to k facts closest to factID's embedding, excluding
+// factID itself and facts from the same chunk.
+func nearestFacts(db *sql.DB, factID int64, k int) ([]factRow, error) {
+	var embedding []byte
+	err := db.QueryRow(`SELECT embedding FROM vec_facts WHERE fact_id = ?`, factID).Scan(&embedding)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load fact embedding: %w", err)
+	}
+
+	rows, err := db.Query(
+		`SELECT f.id, f.text, f.valid_at
+		 FROM vec_facts v
+		 JOIN facts f ON f.id = v.fact_id
+		 WHERE v.embedding MATCH ? AND v.k = ?
+		   AND f.chunk_id != (SELECT chunk_id FROM facts WHERE id = ?)
+		 ORDER BY v.distance`,
+		embedding, k+1, factID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var facts []factRow
+	for rows.Next() {
+		var f factRow
+		var validAt sql.NullString
+		if err := rows.Scan(&f.id, &f.text, &validAt); err != nil {
+			return nil, err
+		}
+		f.validAt = validAt.String
+		facts = append(facts, f)
+	}
+	return facts, rows.Err()
+}
+
+// mentionedEntities returns the ids of entities named in text.
+func mentionedEntities(text string, entities []entityName) map[int64]bool {
+	ids := make(map[int64]bool)
+	for _, e := range entities {
+		if len(findMentions(text, e.name)) > 0 {
+			ids[e.id] = true
+		}
+	}
+	return ids
+}
+
+// sharedEntity returns the lowest entity id present in both sets.
+func sharedEntity(a, b map[int64]bool) (int64, bool) {
+	var best int64
+	found := false
+	for id := range a {
+		if b[id] && (!found || id < best) {
+			best = id
+			found = true
+		}
+	}
+	return best, found
+}
+
+func dateLabel(validAt string) string {
+	if validAt == "" {
+		return "undated"
+	}
+	return validAt
+}
+
+// Conflicts lists recorded conflicts, newest first, optionally for one entity
+// (and its aliases). If limit <= 0, defaults to 20.
+func Conflicts(db *sql.DB, entity string, limit int) ([]Conflict, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	query := `SELECT k.id, e.name, k.kind, k.reason, k.detected_at,
+			o.id, o.text, o.valid_at, oc.source_file,
+			n.id, n.text, n.valid_at, nc.source_file
+		 FROM conflicts k
+		 JOIN entities e ON e.id = k.entity_id
+		 JOIN facts o ON o.id = k.older_fact_id
+		 JOIN chunks oc ON oc.id = o.chunk_id
+		 JOIN facts n ON n.id = k.newer_fact_id
+		 JOIN chunks nc ON nc.id = n.chunk_id`
+	var args []any
+	if entity != "" {
+		ids, _, err := lookupEntityIDs(db, resolveAliases(entity))
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("unknown entity: %s", entity)
+		}
+		query += fmt.Sprintf(` WHERE k.entity_id IN (%s)`, strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","))
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	query += ` ORDER BY k.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conflicts := []Conflict{}
+	for rows.Next() {
+		var c Conflict
+		var olderValid, newerValid sql.NullString
+		if err := rows.Scan(&c.ID, &c.Entity, &c.Kind, &c.Reason, &c.DetectedAt,
+			&c.Older.ID, &c.Older.Text, &olderValid, &c.Older.SourceFile,
+			&c.Newer.ID, &c.Newer.Text, &newerValid, &c.Newer.SourceFile,
+		); err != nil {
+			return nil, err
+		}
+		c.Older.ValidAt = olderValid.String
+		c.Newer.ValidAt = newerValid.String
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseConflictResponse(t *testing.T) {
+	cases := []struct {
+		raw      string
+		wantKind string
+		wantErr  bool
+	}{
+		{`{"verdict": "supersedes", "reason": "She moved."}`, conflictKindSupersession, false},
+		{`{"verdict": "Contradicts", "reason": "x"}`, conflictKindContradiction, false},
+		{`{"verdict": "consistent"}`, "", false},
+		{`{"verdict": "maybe"}`, "", true},
+		{`nope`, "", true},
+	}
+	for _, tc := range cases {
+		kind, _, err := parseConflictResponse(tc.raw)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: unexpected error state: %v", tc.raw, err)
+		}
+		if kind != tc.wantKind {
+			t.Errorf("%s: expected kind %q, got %q", tc.raw, tc.wantKind, kind)
+		}
+	}
+}
+
+func TestDetectConflicts(t *testing.T) {
+	var comparisons []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			var answer string
+			switch {
+			case req.System == conflictCheckPrompt:
+				comparisons = append(comparisons, req.Prompt)
+				answer = `{"verdict": "consistent"}`
+				if strings.Contains(req.Prompt, "Paris") && strings.Contains(req.Prompt, "Berlin") {
+					answer = `{"verdict": "supersedes", "reason": "Alice moved."}`
+				}
+			case strings.Contains(req.Prompt, "Paris"):
+				answer = `{"facts": ["Alice lives in Paris"]}`
+			case strings.Contains(req.Prompt, "Berlin"):
+				answer = `{"facts": ["Alice moved to Berlin"]}`
+			default:
+				answer = `{"facts": ["Bob lives in Rome"]}`
+			}
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		case "/api/embed":
+			// Every fact lands close together so each is a candidate for the others
+			vec := make([]float64, EmbedDimension)
+			vec[0] = 1
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	id1 := insertChunk(t, db, "Alice lives in Paris now.", "a.md", "2024", "", 2, "2024-03-01", makeVec(map[int]float32{0: 1}))
+	id2 := insertChunk(t, db, "Alice moved to Berlin!", "b.md", "2025", "", 2, "2025-05-01", makeVec(map[int]float32{0: 1}))
+	id3 := insertChunk(t, db, "Bob is in Rome.", "c.md", "Bob", "", 2, "2025-06-01", makeVec(map[int]float32{0: 1}))
+	for _, name := range []string{"Alice", "Bob"} {
+		if _, err := db.Exec(`INSERT INTO entities (name, created_at) VALUES (?, '2025-01-01T00:00:00Z')`, name); err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+	}
+
+	client := NewOllamaClient(server.URL, "embed")
+	if _, err := ExtractFacts(context.Background(), db, client, "gen", []int64{id1, id2, id3}, nil); err != nil {
+		t.Fatalf("ExtractFacts: %v", err)
+	}
+
+	pending, err := pendingConflictChunks(db)
+	if err != nil {
+		t.Fatalf("pendingConflictChunks: %v", err)
+	}
+	if len(pending) != 3 {
+		t.Fatalf("expected 3 chunks pending conflict check, got %v", pending)
+	}
+
+	result, err := DetectConflicts(context.Background(), db, client, "gen", pending, nil)
+	if err != nil {
+		t.Fatalf("DetectConflicts: %v", err)
+	}
+	// Only the two Alice facts share an entity, and the pair is judged once
+	if result.Comparisons != 1 || result.ConflictsFound != 1 || len(comparisons) != 1 {
+		t.Fatalf("unexpected result: %+v (prompts %q)", result, comparisons)
+	}
+	if !strings.HasPrefix(comparisons[0], "Older (2024-03-01): Alice lives in Paris") {
+		t.Fatalf("expected older fact first, got %q", comparisons[0])
+	}
+
+	conflicts, err := Conflicts(db, "alice", 10)
+	if err != nil {
+		t.Fatalf("Conflicts: %v", err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %d", len(conflicts))
+	}
+	c := conflicts[0]
+	if c.Kind != conflictKindSupersession || c.Entity != "Alice" || c.Older.Text != "Alice lives in Paris" || c.Newer.Text != "Alice moved to Berlin" || c.Newer.SourceFile != "b.md" {
+		t.Fatalf("unexpected conflict: %+v", c)
+	}
+
+	var validUntil sql.NullString
+	if err := db.QueryRow(`SELECT valid_until FROM facts WHERE id = ?`, c.Older.ID).Scan(&validUntil); err != nil {
+		t.Fatalf("lookup fact: %v", err)
+	}
+	if validUntil.String != "2025-05-01" {
+		t.Fatalf("expected superseded fact to end 2025-05-01, got %q", validUntil.String)
+	}
+
+	if conflicts, err := Conflicts(db, "Bob", 10); err != nil || len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts for Bob, got %v, %v", conflicts, err)
+	}
+
+	remaining, err := pendingConflictChunks(db)
+	if err != nil {
+		t.Fatalf("pendingConflictChunks: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Fatalf("expected no pending chunks, got %v", remaining)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Consolidation levels. Weekly rollups summarize raw watch batches; monthly rollups
+// summarize the weekly ones.
+const (
+	consolidateWeek  = "week"
+	consolidateMonth = "month"
+)
+
+// consolidatedSourcePrefix is the source_file prefix of rollup chunks.
+const consolidatedSourcePrefix = "consolidated://"
+
+// consolidatedRawImportance is the importance given to raw batches once rolled up,
+// when the raw layer is down-weighted rather than kept or pruned.
+const consolidatedRawImportance = 0.1
+
+// Raw-layer handling after consolidation.
+const (
+	rawKeep       = "keep"
+	rawDownweight = "downweight"
+	rawPrune      = "prune"
+)
+
+const consolidationPrompt = `You consolidate someone's conversation logs into long-term semantic memory.
+You are given the rollup so far (possibly empty, under "So far") and more material from the same period, in order.
+The material is raw conversation batches or shorter-period rollups. Keep what will still matter later; drop chatter.
+Return the updated rollup as JSON only, in exactly this shape:
+{"summary": "...", "highlights": ["..."], "decisions": ["..."], "open_questions": ["..."]}
+Rules:
+- summary: three to five sentences on what the period was about.
+- highlights: at most 8 durable facts learned and notable events.
+- decisions: at most 8 things decided or committed to.
+- open_questions: at most 8 questions or follow-ups still unresolved at the end of the period.
+- Only use what the rollup and material state.`
+
+// ConsolidationResult reports one consolidation pass.
+type ConsolidationResult struct {
+	Periods      int
+	ChunksRolled int
+	Rollups      []string
+	// RolledUp lists the chunk ids folded into a rollup during this pass.
+	RolledUp []int64
+}
+
+// consolidationPeriod returns the period a chunk dated validAt belongs to: the Monday
+// starting its week, or the first of its month.
+func consolidationPeriod(level string, validAt time.Time) time.Time {
+	if level == consolidateMonth {
+		return time.Date(validAt.Year(), validAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	offset := (int(validAt.Weekday()) + 6) % 7
+	return time.Date(validAt.Year(), validAt.Month(), validAt.Day()-offset, 0, 0, 0, 0, time.UTC)
+}
+
+func consolidationPeriodEnd(level string, start time.Time) time.Time {
+	if level == consolidateMonth {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 7)
+}
+
+func rollupSource(level string, start time.Time) string {
+	if level == consolidateMonth {
+		return consolidatedSourcePrefix + "month/" + start.Format("2006-01")
+	}
+	return consolidatedSourcePrefix + "week/" + start.Format("2006-01-02")
+}
+
+func rollupHeader(level string, start time.Time) string {
+	if level == consolidateMonth {
+		return "Month of " + start.Format("January 2, 2006")
+	}
+	return "Week of " + start.Format("January 2, 2006")
+}
+
+// consolidationInputs returns the dated chunks a level rolls up that haven't been
+// folded into a rollup yet: raw watch batches for weeks, weekly rollups for months.
+func consolidationInputs(db *sql.DB, level string) ([]HistoryResult, error) {
+	filter := watchBatchFilter
+	if level == consolidateMonth {
+		filter = `source_file LIKE '` + consolidatedSourcePrefix + `week/%'`
+	}
+	rows, err := db.Query(
+		`SELECT id, text, source_file, section_title, parent_title, valid_at, ingested_at FROM chunks
+		 WHERE `+filter+` AND valid_at IS NOT NULL
+		   AND id NOT IN (SELECT chunk_id FROM chunk_extractions WHERE kind = ?)
+		 ORDER BY valid_at ASC, source_file ASC, section_sequence ASC, chunk_sequence ASC`,
+		"consolidate-"+level,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []HistoryResult
+	for rows.Next() {
+		var r HistoryResult
+		var parent, validAt sql.NullString
+		if err := rows.Scan(&r.ID, &r.Text, &r.SourceFile, &r.SectionTitle, &parent, &validAt, &r.IngestedAt); err != nil {
+			return nil, err
+		}
+		r.ParentTitle = parent.String
+		r.ValidAt = validAt.String
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// Consolidate rolls chunks up into summaries for every complete period (one that ended
+// on or before now) at the given level. A period that already has a rollup is updated
+// by folding its new chunks into the existing rollup text, so raw batches that were
+// pruned after an earlier pass are not needed again. Rollups are ingested and embedded
+// as consolidated://week/<monday> or consolidated://month/<yyyy-mm>.
+func Consolidate(ctx context.Context, db *sql.DB, ollama *OllamaClient, model, level string, now time.Time, progress ProgressFunc) (ConsolidationResult, error) {
+	var result ConsolidationResult
+	if level != consolidateWeek && level != consolidateMonth {
+		return result, fmt.Errorf("unknown consolidation level %q (want week or month)", level)
+	}
+
+	inputs, err := consolidationInputs(db, level)
+	if err != nil {
+		return result, fmt.Errorf("find chunks to consolidate: %w", err)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	periods := make(map[time.Time][]HistoryResult)
+	for _, in := range inputs {
+		validAt, err := time.Parse("2006-01-02", in.ValidAt)
+		if err != nil {
+			continue
+		}
+		start := consolidationPeriod(level, validAt)
+		if consolidationPeriodEnd(level, start).After(today) {
+			continue
+		}
+		periods[start] = append(periods[start], in)
+	}
+	starts := make([]time.Time, 0, len(periods))
+	for start := range periods {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	for i, start := range starts {
+		sourceFile := rollupSource(level, start)
+		if progress != nil {
+			progress(i, len(starts), sourceFile)
+		}
+
+		var items []digestItem
+		var previous sql.NullString
+		if err := db.QueryRow(`SELECT group_concat(text, char(10)||char(10)) FROM chunks WHERE source_file = ?`, sourceFile).Scan(&previous); err != nil {
+			return result, err
+		}
+		if previous.String != "" {
+			items = append(items, digestItem{label: "Existing rollup", text: previous.String})
+		}
+		for _, c := range periods[start] {
+			items = append(items, digestItem{label: fmt.Sprintf("[%s] %s › %s", c.ValidAt, c.SourceFile, c.SectionTitle), text: c.Text})
+		}
+
+		header := rollupHeader(level, start)
+		body, err := foldSummary(ctx, ollama, model, consolidationPrompt, header, items, nil)
+		if err != nil {
+			return result, fmt.Errorf("consolidate %s: %w", sourceFile, err)
+		}
+		if _, err := ingestMarkdownSource(ctx, db, ollama, sourceFile, renderSummaryMarkdown(header, body)); err != nil {
+			return result, fmt.Errorf("store %s: %w", sourceFile, err)
+		}
+
+		err = withWriteTx(db, "consolidate", func(tx *sql.Tx) error {
+			for _, c := range periods[start] {
+				if err := markExtracted(tx, int64(c.ID), "consolidate-"+level); err != nil {
+					return fmt.Errorf("mark consolidated: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		for _, c := range periods[start] {
+			result.RolledUp = append(result.RolledUp, int64(c.ID))
+		}
+
+		result.Periods++
+		result.ChunksRolled += len(periods[start])
+		result.Rollups = append(result.Rollups, sourceFile)
+	}
+	if progress != nil && len(starts) > 0 {
+		progress(len(starts), len(starts), "")
+	}
+	return result, nil
+}
+
+// DownweightChunks caps the importance of chunks that now live on in a rollup, so
+// importance-boosted search prefers the rollup and prune --below can clear them later.
+func DownweightChunks(db *sql.DB, chunkIDs []int64) error {
+	if len(chunkIDs) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")
+	args := []any{consolidatedRawImportance}
+	for _, id := range chunkIDs {
+		args = append(args, id)
+	}
+	return retryBusy("downweight chunks", func() error {
+		_, err := db.Exec(
+			`UPDATE chunks SET importance = MIN(COALESCE(importance, 1), ?) WHERE id IN (`+placeholders+`)`,
+			args...,
+		)
+		return err
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsolidationPeriod(t *testing.T) {
+	sunday := time.Date(2025, time.June, 8, 0, 0, 0, 0, time.UTC)
+	if got := consolidationPeriod(consolidateWeek, sunday).Format("2006-01-02"); got != "2025-06-02" {
+		t.Fatalf("expected Sunday to belong to the week of Monday 2025-06-02, got %s", got)
+	}
+	monday := time.Date(2025, time.June, 2, 0, 0, 0, 0, time.UTC)
+	if got := consolidationPeriod(consolidateWeek, monday).Format("2006-01-02"); got != "2025-06-02" {
+		t.Fatalf("expected Monday to start its own week, got %s", got)
+	}
+	if got := rollupSource(consolidateMonth, consolidationPeriod(consolidateMonth, sunday)); got != "consolidated://month/2025-06" {
+		t.Fatalf("unexpected month source %s", got)
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			prompts = append(prompts, req.Prompt)
+			answer := `{"summary": "Worked on auth.", "highlights": ["Auth uses Postgres"], "decisions": [], "open_questions": []}`
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		case "/api/embed":
+			vec := make([]float64, EmbedDimension)
+			vec[0] = 1
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	first := insertChunk(t, db, "Batch one about auth.", "watch://s1/batch-0", "June 3, 2025", "", 2, "2025-06-03", vec)
+	insertChunk(t, db, "Batch two about Postgres.", "watch-cc://s2/batch-0", "June 5, 2025", "", 2, "2025-06-05", vec)
+	current := insertChunk(t, db, "This week's batch.", "watch://s1/batch-1", "June 10, 2025", "", 2, "2025-06-10", vec)
+	insertChunk(t, db, "A hand-written note.", "notes.md", "Note", "", 2, "2025-06-04", vec)
+
+	client := NewOllamaClient(server.URL, "embed")
+	now := time.Date(2025, time.June, 11, 12, 0, 0, 0, time.UTC)
+	result, err := Consolidate(context.Background(), db, client, "gen", consolidateWeek, now, nil)
+	if err != nil {
+		t.Fatalf("Consolidate: %v", err)
+	}
+	if result.Periods != 1 || result.ChunksRolled != 2 || result.Rollups[0] != "consolidated://week/2025-06-02" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "Batch one") || !strings.Contains(prompts[0], "Batch two") ||
+		strings.Contains(prompts[0], "This week's batch") || strings.Contains(prompts[0], "hand-written") {
+		t.Fatalf("unexpected prompts: %q", prompts)
+	}
+
+	var text, validAt string
+	if err := db.QueryRow(`SELECT text, valid_at FROM chunks WHERE source_file = ?`, result.Rollups[0]).Scan(&text, &validAt); err != nil {
+		t.Fatalf("read rollup: %v", err)
+	}
+	if !strings.Contains(text, "Auth uses Postgres") || validAt != "2025-06-02" {
+		t.Fatalf("unexpected rollup %q dated %q", text, validAt)
+	}
+
+	// Nothing new: a second pass makes no model calls
+	if again, err := Consolidate(context.Background(), db, client, "gen", consolidateWeek, now, nil); err != nil || again.Periods != 0 || len(prompts) != 1 {
+		t.Fatalf("expected an idempotent second pass, got %+v, %v", again, err)
+	}
+
+	// A late batch is folded into the existing rollup
+	insertChunk(t, db, "Late batch.", "watch://s3/batch-0", "June 6, 2025", "", 2, "2025-06-06", vec)
+	late, err := Consolidate(context.Background(), db, client, "gen", consolidateWeek, now, nil)
+	if err != nil || late.ChunksRolled != 1 {
+		t.Fatalf("expected the late batch to be rolled up, got %+v, %v", late, err)
+	}
+	if !strings.Contains(prompts[1], "Existing rollup") || !strings.Contains(prompts[1], "Auth uses Postgres") {
+		t.Fatalf("expected the existing rollup in the prompt, got %q", prompts[1])
+	}
+	var rollups int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE source_file = ?`, result.Rollups[0]).Scan(&rollups)
+	if rollups != 1 {
+		t.Fatalf("expected the rollup to be replaced, got %d chunks", rollups)
+	}
+
+	if err := DownweightChunks(db, result.RolledUp); err != nil {
+		t.Fatalf("DownweightChunks: %v", err)
+	}
+	var importance float64
+	db.QueryRow(`SELECT importance FROM chunks WHERE id = ?`, first).Scan(&importance)
+	if importance != consolidatedRawImportance {
+		t.Fatalf("expected importance %.1f, got %.2f", consolidatedRawImportance, importance)
+	}
+	var untouched *float64
+	db.QueryRow(`SELECT importance FROM chunks WHERE id = ?`, current).Scan(&untouched)
+	if untouched != nil {
+		t.Fatal("expected chunks outside the rollup to keep their importance")
+	}
+
+	// Months roll up the weekly rollups, once the month is over
+	if month, err := Consolidate(context.Background(), db, client, "gen", consolidateMonth, now, nil); err != nil || month.Periods != 0 {
+		t.Fatalf("expected June to be incomplete, got %+v, %v", month, err)
+	}
+	month, err := Consolidate(context.Background(), db, client, "gen", consolidateMonth, time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC), nil)
+	if err != nil || month.Periods != 1 || month.Rollups[0] != "consolidated://month/2025-06" {
+		t.Fatalf("expected a June rollup, got %+v, %v", month, err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// contentHash identifies a chunk's text, which is all its embedding depends on.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// sourceHash identifies everything ingesting a file would store: each chunk's text and
+// where it sits, its date and its tags. It changes with the file, and with the options
+// it was chunked and dated by.
+func sourceHash(chunks []ingestPreparedChunk) string {
+	h := sha256.New()
+	for _, pc := range chunks {
+		c := pc.chunk
+		fmt.Fprintf(h, "%s\x1f%s\x1f%d\x1f%s\x1f%d\x1f%d\x1f%d\x1f%s\x1f%s\x1e",
+			c.Text, c.SectionTitle, c.HeaderLevel, c.ParentTitle, c.SectionSequence, c.ChunkSequence, c.ChunkTotal,
+			pc.validAt.String, strings.Join(pc.tags, ","))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sourceChunks is what a source held before it is ingested again.
+type sourceChunks struct {
+	hash   string             // its sourceHash when last ingested, "" if unknown
+	stored int                // the chunks that ingest stored, -1 if unknown
+	count  int                // the chunks it has now
+	byHash map[string][]int64 // chunk IDs by contentHash, in the order they were stored
+}
+
+// loadSourceChunks reads the chunks a source holds, hashing the text of any stored
+// before chunks had a content_hash.
+func loadSourceChunks(db *sql.DB, sourceFile string) (sourceChunks, error) {
+	previous := sourceChunks{stored: -1, byHash: map[string][]int64{}}
+	err := db.QueryRow(`SELECT hash, COALESCE(chunks, -1) FROM source_hashes WHERE source_file = ?`, sourceFile).Scan(&previous.hash, &previous.stored)
+	if err != nil && err != sql.ErrNoRows {
+		return previous, err
+	}
+	rows, err := db.Query(
+		`SELECT id, content_hash, CASE WHEN content_hash IS NULL THEN text END
+		 FROM chunks WHERE source_file = ? ORDER BY section_sequence, chunk_sequence`, sourceFile)
+	if err != nil {
+		return previous, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var hash, text sql.NullString
+		if err := rows.Scan(&id, &hash, &text); err != nil {
+			return previous, err
+		}
+		if !hash.Valid {
+			hash.String = contentHash(text.String)
+		}
+		previous.byHash[hash.String] = append(previous.byHash[hash.String], id)
+		previous.count++
+	}
+	return previous, rows.Err()
+}
+
+// unchanged reports whether the source already holds exactly what ingesting it would
+// store, chunks of them unless the last ingest recorded how many it left out.
+func (s sourceChunks) unchanged(hash string, chunks int) bool {
+	if s.stored >= 0 {
+		chunks = s.stored
+	}
+	return s.hash == hash && s.count == chunks
+}
+
+// take claims a stored chunk with the given text for reuse, returning 0 when there is none.
+func (s sourceChunks) take(hash string) int64 {
+	ids := s.byHash[hash]
+	if len(ids) == 0 {
+		return 0
+	}
+	s.byHash[hash] = ids[1:]
+	return ids[0]
+}
+
+// keepChunk moves a stored chunk to its place in the newly ingested source, keeping its
+// embedding, and with it its ID, retrievals, pins and extracted facts.
+func keepChunk(tx *sql.Tx, id int64, pc ingestPreparedChunk) error {
+	res, err := tx.Exec(
+		`UPDATE chunks SET section_title = ?, header_level = ?, parent_title = ?, section_sequence = ?, chunk_sequence = ?, chunk_total = ?, valid_at = ?
+		 WHERE id = ?`,
+		pc.chunk.SectionTitle, pc.chunk.HeaderLevel, pc.chunk.ParentTitle, pc.chunk.SectionSequence,
+		pc.chunk.ChunkSequence, pc.chunk.ChunkTotal, pc.validAt, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("chunk %d of %s was removed while ingesting; ingest it again", id, pc.chunk.SourceFile)
+	}
+	// The frontmatter's tags may have changed even where the text has not
+	if _, err := tx.Exec(`DELETE FROM chunk_tags WHERE chunk_id = ? AND source IN (?, ?)`, id, tagSourceFrontmatter, tagSourceHashtag); err != nil {
+		return err
+	}
+	return storeIngestTags(tx, id, pc)
+}
+
+// storeSourceHash records what a source was ingested as, and how many chunks it stored.
+func storeSourceHash(tx *sql.Tx, sourceFile, hash string, chunks int, ingestedAt string) error {
+	_, err := tx.Exec(
+		`INSERT INTO source_hashes (source_file, hash, ingested_at, chunks) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(source_file) DO UPDATE SET hash = excluded.hash, ingested_at = excluded.ingested_at, chunks = excluded.chunks`,
+		sourceFile, hash, ingestedAt, chunks,
+	)
+	return err
+}
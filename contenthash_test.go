@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIngestFileReusesUnchangedChunks(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	ollama := NewOllamaClient(server.URL, "embed")
+
+	path := filepath.Join(t.TempDir(), "notes.md")
+	ingest := func(content string) (IngestResult, int) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		embedded := 0
+		result, err := IngestFileWithProgress(context.Background(), db, ollama, path, "", defaultChunking, func(done, total int, _ string) {
+			embedded = total
+		})
+		if err != nil {
+			t.Fatalf("IngestFile: %v", err)
+		}
+		return result, embedded
+	}
+
+	result, embedded := ingest("## Auth\n\nTokens live in Redis.\n\n## Deploy\n\nShip on Fridays.\n")
+	if embedded != 2 || len(result.ChunkIDs) != 2 {
+		t.Fatalf("expected both chunks embedded, got %d embedded, %d stored", embedded, len(result.ChunkIDs))
+	}
+	deployID := result.ChunkIDs[1]
+	db.Exec(`UPDATE chunks SET pinned_at = '2026-01-01T00:00:00Z' WHERE id = ?`, deployID)
+
+	// The same file again is not embedded or written
+	result, embedded = ingest("## Auth\n\nTokens live in Redis.\n\n## Deploy\n\nShip on Fridays.\n")
+	if embedded != 0 || result.ChunksUnchanged != 2 || len(result.ChunkIDs) != 0 {
+		t.Fatalf("expected nothing embedded, got %d embedded, %+v", embedded, result)
+	}
+
+	// Only the edited section is embedded; the moved one keeps its row and pin
+	result, embedded = ingest("## Intro\n\nWhy this exists.\n\n## Deploy\n\nShip on Fridays.\n\n## Auth\n\nTokens live in Postgres.\n")
+	if embedded != 2 || result.ChunksUnchanged != 1 || result.DeletedChunks != 1 {
+		t.Fatalf("expected the two new chunks embedded and the old auth chunk deleted, got %d embedded, %+v", embedded, result)
+	}
+	var sequence int
+	var pinned string
+	if err := db.QueryRow(`SELECT section_sequence, pinned_at FROM chunks WHERE id = ?`, deployID).Scan(&sequence, &pinned); err != nil {
+		t.Fatalf("expected the deploy chunk kept: %v", err)
+	}
+	if sequence != 2 || pinned == "" {
+		t.Fatalf("expected the kept chunk moved to section 2 and still pinned, got %d, %q", sequence, pinned)
+	}
+	var chunks, vectors int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE source_file = ?`, path).Scan(&chunks)
+	db.QueryRow(`SELECT COUNT(*) FROM vec_chunks`).Scan(&vectors)
+	if chunks != 3 || vectors != 3 {
+		t.Fatalf("expected 3 chunks with 3 embeddings, got %d and %d", chunks, vectors)
+	}
+
+	// A new date changes no text, so nothing is embedded but every chunk is redated
+	if err := os.WriteFile(path, []byte("## Intro\n\nWhy this exists.\n\n## Deploy\n\nShip on Fridays.\n\n## Auth\n\nTokens live in Postgres.\n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	result, err = IngestFile(context.Background(), db, ollama, path, "2026-03-01", defaultChunking)
+	if err != nil || result.ChunksUnchanged != 3 {
+		t.Fatalf("expected all 3 chunks kept, got %+v, %v", result, err)
+	}
+	var dated int
+	db.QueryRow(`SELECT COUNT(*) FROM vec_chunks WHERE valid_at = '2026-03-01'`).Scan(&dated)
+	if dated != 3 {
+		t.Fatalf("expected the new date on every embedding, got %d", dated)
+	}
+}
+
+func TestLoadSourceChunksHashesOldRows(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	// Stored before content hashes, as insertChunk does
+	id := insertChunk(t, db, "Tokens live in Redis.", "a.md", "Auth", "", 2, "", makeVec(map[int]float32{0: 1}))
+
+	previous, err := loadSourceChunks(db, "a.md")
+	if err != nil {
+		t.Fatalf("loadSourceChunks: %v", err)
+	}
+	if previous.take(contentHash("Tokens live in Redis.")) != id || previous.take(contentHash("Tokens live in Redis.")) != 0 {
+		t.Fatalf("expected the old chunk matched by its text once, got %+v", previous)
+	}
+}
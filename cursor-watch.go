@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Keys of Cursor's state databases holding chats. Each workspace's state.vscdb keeps the
+// chat panel's tabs whole and lists its composers; a composer's conversation lives in
+// the global state.vscdb, whole or one bubble per key.
+const (
+	cursorChatKey      = "workbench.panel.aichat.view.aichat.chatdata"
+	cursorComposersKey = "composer.composerData"
+)
+
+// cursorSession is a Cursor chat: a chat panel tab or a composer.
+type cursorSession struct {
+	ID       string
+	Title    string
+	Folder   string // the workspace's directory
+	DBPath   string // the workspace's state.vscdb
+	Updated  time.Time
+	Composer bool
+}
+
+// cursorBubble is one turn of a Cursor chat.
+type cursorBubble struct {
+	ID     string
+	IsUser bool
+	Text   string
+	Time   time.Time
+}
+
+// cursorUserPath is Cursor's user data directory: ~/.config/Cursor/User on Linux,
+// ~/Library/Application Support/Cursor/User on macOS, %AppData%\Cursor\User on Windows.
+func cursorUserPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "Cursor", "User")
+}
+
+// cursorItem reads a JSON value from a Cursor state database's ItemTable; found is false
+// when the key is missing.
+func cursorItem(stateDB *sql.DB, key string, v any) (found bool, err error) {
+	var raw []byte
+	err = stateDB.QueryRow(`SELECT value FROM ItemTable WHERE key = ?`, key).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// cursorChatData is the chat panel's state.
+type cursorChatData struct {
+	Tabs []struct {
+		TabID        string         `json:"tabId"`
+		ChatTitle    string         `json:"chatTitle"`
+		LastSendTime int64          `json:"lastSendTime"`
+		Bubbles      []cursorRawMsg `json:"bubbles"`
+	} `json:"tabs"`
+}
+
+// cursorRawMsg is a bubble as Cursor stores it. Chat panel bubbles have type "user" or
+// "ai", composer bubbles 1 (user) or 2 (assistant).
+type cursorRawMsg struct {
+	ID        string `json:"id"`
+	BubbleID  string `json:"bubbleId"`
+	Type      any    `json:"type"`
+	Text      string `json:"text"`
+	RawText   string `json:"rawText"`
+	CreatedAt any    `json:"createdAt"`
+}
+
+func (m cursorRawMsg) bubble(index int) (cursorBubble, bool) {
+	b := cursorBubble{ID: m.BubbleID, Text: m.Text}
+	if b.ID == "" {
+		b.ID = m.ID
+	}
+	if b.ID == "" {
+		b.ID = fmt.Sprintf("#%d", index)
+	}
+	if b.Text == "" {
+		b.Text = m.RawText
+	}
+	switch m.Type {
+	case "user", float64(1):
+		b.IsUser = true
+	case "ai", float64(2):
+	default:
+		return b, false
+	}
+	if m.CreatedAt != nil {
+		b.Time, _ = jsonlTime(m.CreatedAt)
+	}
+	return b, true
+}
+
+// cursorComposers is a workspace's list of composers.
+type cursorComposers struct {
+	AllComposers []struct {
+		ComposerID    string `json:"composerId"`
+		Name          string `json:"name"`
+		CreatedAt     int64  `json:"createdAt"`
+		LastUpdatedAt int64  `json:"lastUpdatedAt"`
+	} `json:"allComposers"`
+}
+
+// discoverCursorSessions lists the chats of every workspace under userDir, most recently
+// updated first.
+func discoverCursorSessions(userDir string) ([]cursorSession, error) {
+	entries, err := os.ReadDir(filepath.Join(userDir, "workspaceStorage"))
+	if err != nil {
+		return nil, fmt.Errorf("read workspace storage: %w", err)
+	}
+	var sessions []cursorSession
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(userDir, "workspaceStorage", entry.Name())
+		dbPath := filepath.Join(dir, "state.vscdb")
+		if _, err := os.Stat(dbPath); err != nil {
+			continue
+		}
+		found, err := workspaceSessions(dbPath, cursorWorkspaceFolder(dir))
+		if err != nil {
+			// Cursor may be rewriting it; the others are still worth listing
+			continue
+		}
+		sessions = append(sessions, found...)
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions, nil
+}
+
+// cursorWorkspaceFolder is the directory a workspace was opened on, from the
+// workspace.json next to its state database.
+func cursorWorkspaceFolder(dir string) string {
+	var workspace struct {
+		Folder string `json:"folder"`
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "workspace.json"))
+	if err != nil || json.Unmarshal(data, &workspace) != nil {
+		return ""
+	}
+	if u, err := url.Parse(workspace.Folder); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return workspace.Folder
+}
+
+func workspaceSessions(dbPath, folder string) ([]cursorSession, error) {
+	stateDB, err := sql.Open("sqlite3", dbPath+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer stateDB.Close()
+
+	var sessions []cursorSession
+	var chat cursorChatData
+	if _, err := cursorItem(stateDB, cursorChatKey, &chat); err != nil {
+		return nil, fmt.Errorf("read chats: %w", err)
+	}
+	for _, tab := range chat.Tabs {
+		if len(tab.Bubbles) == 0 {
+			continue
+		}
+		sessions = append(sessions, cursorSession{
+			ID:      tab.TabID,
+			Title:   tab.ChatTitle,
+			Folder:  folder,
+			DBPath:  dbPath,
+			Updated: time.UnixMilli(tab.LastSendTime),
+		})
+	}
+	var composers cursorComposers
+	if _, err := cursorItem(stateDB, cursorComposersKey, &composers); err != nil {
+		return nil, fmt.Errorf("read composers: %w", err)
+	}
+	for _, c := range composers.AllComposers {
+		updated := c.LastUpdatedAt
+		if updated == 0 {
+			updated = c.CreatedAt
+		}
+		sessions = append(sessions, cursorSession{
+			ID:       c.ComposerID,
+			Title:    c.Name,
+			Folder:   folder,
+			DBPath:   dbPath,
+			Updated:  time.UnixMilli(updated),
+			Composer: true,
+		})
+	}
+	for i := range sessions {
+		if sessions[i].Title == "" {
+			sessions[i].Title = "Cursor chat " + sessions[i].Updated.Format("Jan 02 15:04")
+		}
+	}
+	return sessions, nil
+}
+
+// cursorSessionsIn keeps the chats of workspaces opened on dir.
+func cursorSessionsIn(sessions []cursorSession, dir string) []cursorSession {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	var kept []cursorSession
+	for _, s := range sessions {
+		if s.Folder != "" && filepath.Clean(s.Folder) == dir {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// findCursorSession chooses a chat without prompting: the one with id, or with latest the
+// most recently updated.
+func findCursorSession(sessions []cursorSession, id string, latest bool) (cursorSession, error) {
+	for _, s := range sessions {
+		// discoverCursorSessions lists the most recently updated first
+		if latest || s.ID == id {
+			return s, nil
+		}
+	}
+	return cursorSession{}, fmt.Errorf("no Cursor chat %s", id)
+}
+
+func pickCursorSession(sessions []cursorSession) (cursorSession, error) {
+	fmt.Println()
+	fmt.Println(renderHeader())
+	fmt.Println()
+
+	limit := min(len(sessions), 10)
+	for i, s := range sessions[:limit] {
+		folder := filepath.Base(s.Folder)
+		if s.Folder == "" {
+			folder = "(no folder)"
+		}
+		fmt.Println(renderSessionItem(i+1, s.Title, folder, s.Updated.Format("Jan 02, 2006 15:04")))
+	}
+
+	fmt.Println()
+	fmt.Print(promptStyle.Render("  Select chat [1]: "))
+	input, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return cursorSession{}, fmt.Errorf("read input: %w", err)
+	}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		input = "1"
+	}
+	var choice int
+	if _, err := fmt.Sscanf(input, "%d", &choice); err != nil || choice < 1 || choice > limit {
+		return cursorSession{}, fmt.Errorf("invalid choice: %s", input)
+	}
+	return sessions[choice-1], nil
+}
+
+// cursorReader reads a chat's bubbles, holding the state databases open between polls.
+type cursorReader struct {
+	session  cursorSession
+	stateDB  *sql.DB
+	globalDB *sql.DB // for composers
+}
+
+func newCursorReader(userDir string, session cursorSession) (*cursorReader, error) {
+	r := &cursorReader{session: session}
+	var err error
+	if r.stateDB, err = sql.Open("sqlite3", session.DBPath+"?mode=ro"); err != nil {
+		return nil, fmt.Errorf("open cursor state: %w", err)
+	}
+	if session.Composer {
+		if r.globalDB, err = sql.Open("sqlite3", filepath.Join(userDir, "globalStorage", "state.vscdb")+"?mode=ro"); err != nil {
+			r.stateDB.Close()
+			return nil, fmt.Errorf("open cursor global state: %w", err)
+		}
+	}
+	return r, nil
+}
+
+func (r *cursorReader) Close() {
+	r.stateDB.Close()
+	if r.globalDB != nil {
+		r.globalDB.Close()
+	}
+}
+
+// bubbles reads the chat's user and assistant turns in order.
+func (r *cursorReader) bubbles() ([]cursorBubble, error) {
+	var raw []cursorRawMsg
+	if r.session.Composer {
+		var err error
+		if raw, err = r.composerMessages(); err != nil {
+			return nil, err
+		}
+	} else {
+		var chat cursorChatData
+		if _, err := cursorItem(r.stateDB, cursorChatKey, &chat); err != nil {
+			return nil, fmt.Errorf("read chats: %w", err)
+		}
+		for _, tab := range chat.Tabs {
+			if tab.TabID == r.session.ID {
+				raw = tab.Bubbles
+			}
+		}
+	}
+	var bubbles []cursorBubble
+	for i, m := range raw {
+		if b, ok := m.bubble(i); ok {
+			bubbles = append(bubbles, b)
+		}
+	}
+	return bubbles, nil
+}
+
+// composerMessages reads a composer's conversation: inline in older versions, as
+// headers pointing at one key per bubble in newer ones.
+func (r *cursorReader) composerMessages() ([]cursorRawMsg, error) {
+	var composer struct {
+		Conversation []cursorRawMsg `json:"conversation"`
+		Headers      []struct {
+			BubbleID string `json:"bubbleId"`
+		} `json:"fullConversationHeadersOnly"`
+	}
+	if err := r.diskValue("composerData:"+r.session.ID, &composer); err != nil {
+		return nil, err
+	}
+	if len(composer.Conversation) > 0 || len(composer.Headers) == 0 {
+		return composer.Conversation, nil
+	}
+	var messages []cursorRawMsg
+	for _, h := range composer.Headers {
+		var m cursorRawMsg
+		if err := r.diskValue("bubbleId:"+r.session.ID+":"+h.BubbleID, &m); err != nil {
+			return nil, err
+		}
+		if m.BubbleID == "" {
+			m.BubbleID = h.BubbleID
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+func (r *cursorReader) diskValue(key string, v any) error {
+	var raw []byte
+	err := r.globalDB.QueryRow(`SELECT value FROM cursorDiskKV WHERE key = ?`, key).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Not written yet: the composer is just starting
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", key, err)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// settledBubbles returns the bubbles not yet done that Cursor has finished writing: one
+// followed by another, or the last one when its text has not changed since the previous
+// poll, which seen holds. An assistant reply still streaming is left for a later poll.
+func settledBubbles(bubbles []cursorBubble, done map[string]bool, seen map[string]string) []cursorBubble {
+	var settled []cursorBubble
+	for i, b := range bubbles {
+		if done[b.ID] {
+			continue
+		}
+		last := i == len(bubbles)-1
+		if last {
+			previous, ok := seen[b.ID]
+			seen[b.ID] = b.Text
+			if !ok || previous != b.Text {
+				continue
+			}
+		}
+		delete(seen, b.ID)
+		settled = append(settled, b)
+	}
+	return settled
+}
+
+// cursorMessage turns a bubble into a text message, if noise stripping leaves any text.
+func cursorMessage(b cursorBubble, sessionID, userAlias, assistantAlias string, now time.Time) (textMessage, bool) {
+	cleaned := stripNoise(b.Text)
+	if len(cleaned) < 3 {
+		return textMessage{}, false
+	}
+	ts := b.Time
+	if ts.IsZero() {
+		// Chat panel bubbles carry no time; they are read as they settle
+		ts = now
+	}
+	role := assistantAlias
+	if b.IsUser {
+		role = userAlias
+	}
+	return textMessage{
+		Role:      role,
+		Text:      cleaned,
+		Timestamp: ts.In(mnemeLocation),
+		IsUser:    b.IsUser,
+		MessageID: sessionID + "/" + b.ID,
+		SessionID: sessionID,
+	}, true
+}
+
+func runWatchCursor(args []string, mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias string) {
+	fs := flag.NewFlagSet("watch-cursor", flag.ExitOnError)
+	batchSize := fs.Int("batch", 6, "text messages before ingesting")
+	pollSec := fs.Int("poll", 3, "poll interval in seconds")
+	summaryIdle := fs.Int("summary-idle", 10, "minutes of quiet before summarizing the session (0 disables)")
+	flushAfter := fs.Duration("flush-after", 0, "ingest a partial batch after this long without new messages, e.g. 5m (0 waits for a full batch)")
+	noTitles := fs.Bool("no-titles", false, "keep date headings instead of titling each batch with the generate model")
+	chunks := newChunkFlags(fs)
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics on this address, e.g. :9464")
+	sessionID := fs.String("session", "", "watch the chat with this ID instead of picking one")
+	project := fs.String("project", "", "only chats of workspaces opened on this directory")
+	latest := fs.Bool("latest", false, "watch the most recently updated chat instead of picking one")
+	userDir := fs.String("cursor-dir", cursorUserPath(), "Cursor's user data directory, holding workspaceStorage")
+	daemon := fs.Bool("daemon", false, "run unattended: write a PID file and log to a file instead of the terminal (needs --session or --latest)")
+	pidFile := fs.String("pid-file", "", "daemon PID file (default: next to the database)")
+	logFile := fs.String("log-file", "", "daemon log file (default: next to the database)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	chunking, err := chunks.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *sessionID != "" && *latest {
+		log.Fatal("--session and --latest are exclusive")
+	}
+	if *daemon {
+		if *sessionID == "" && !*latest {
+			log.Fatal("--daemon needs --session or --latest: there is no one to pick a chat")
+		}
+		stop, err := startDaemon(daemonPaths(watcherCursor, mnemeDB, *pidFile, *logFile))
+		if err != nil {
+			log.Fatalf("daemon: %v", err)
+		}
+		defer stop()
+	}
+
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	sessions, err := discoverCursorSessions(*userDir)
+	if err != nil {
+		log.Fatalf("discover chats: %v", err)
+	}
+	if len(sessions) == 0 {
+		log.Fatal("no Cursor chats found")
+	}
+	if *project != "" {
+		if sessions = cursorSessionsIn(sessions, *project); len(sessions) == 0 {
+			log.Fatalf("no Cursor chats in %s", *project)
+		}
+	}
+
+	var session cursorSession
+	if *sessionID != "" || *latest {
+		// Under systemd or a script there is no one to answer the picker
+		if session, err = findCursorSession(sessions, *sessionID, *latest); err != nil {
+			log.Fatalf("%v", err)
+		}
+	} else if session, err = pickCursorSession(sessions); err != nil {
+		log.Fatalf("pick chat: %v", err)
+	}
+
+	reader, err := newCursorReader(*userDir, session)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer reader.Close()
+
+	fmt.Println()
+	// The watcher catches Ctrl+C itself to flush what is pending, so its work runs to
+	// completion rather than on a cancellable context.
+	ctx := context.Background()
+	if err := watchPreflight(ctx, ollamaHost, embedModel); err != nil {
+		log.Fatalf("preflight: %v", err)
+	}
+
+	fmt.Println()
+	fmt.Println(renderWatchStatus(session.Title, session.ID, *batchSize, *pollSec, mnemeDB))
+	fmt.Println()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	removeOrphanVectors(db)
+
+	var pending []textMessage
+	var lastMessage time.Time
+	seen := make(map[string]string)
+
+	batchNum := nextWatchSeq(db, fmt.Sprintf("watch-cursor://%s/batch-", session.ID))
+	summarizer := newSessionSummarizer(db, ollama, generateModel, fmt.Sprintf("watch-cursor://%s/summary-", session.ID), session.Title, time.Duration(*summaryIdle)*time.Minute)
+	titleModel := generateModel
+	if *noTitles {
+		titleModel = ""
+	}
+
+	done, watched, err := watchedIDs(db, watcherCursor, session.ID)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if watched {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Resuming after %d processed messages. Watching for new...", len(done))))
+	} else {
+		// A chat watched for the first time starts from now
+		bubbles, err := reader.bubbles()
+		if err != nil {
+			log.Fatalf("read chat: %v", err)
+		}
+		existing := make([]string, len(bubbles))
+		for i, b := range bubbles {
+			done[b.ID] = true
+			existing[i] = b.ID
+		}
+		if err := withWriteTx(db, "save watch state", func(tx *sql.Tx) error {
+			return saveWatchedIDs(tx, watcherCursor, session.ID, existing)
+		}); err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Skipping %d existing messages. Watching for new...", len(existing))))
+	}
+	fmt.Println()
+
+	// Bubbles without text, such as tool calls, recorded with the next batch
+	var empty []string
+	saveState := func(tx *sql.Tx) error {
+		ids := empty
+		for _, tm := range pending {
+			ids = append(ids, strings.TrimPrefix(tm.MessageID, session.ID+"/"))
+		}
+		return saveWatchedIDs(tx, watcherCursor, session.ID, ids)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	ticker := time.NewTicker(time.Duration(*pollSec) * time.Second)
+	defer ticker.Stop()
+
+	flushPending := func() {
+		if len(pending) == 0 {
+			return
+		}
+		fmt.Println()
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Flushing %d pending messages...", len(pending))))
+		sourceFile := fmt.Sprintf("watch-cursor://%s/batch-%d", session.ID, batchNum)
+		if err := ingestBatch(ctx, db, ollama, titleModel, sourceFile, pending, session.Title, chunking, saveState); err != nil {
+			fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Flush error: %v", err)))
+			return
+		}
+		empty = nil
+		batchNum++
+		fmt.Println(renderIngest(len(pending), batchNum))
+		pending = nil
+	}
+
+	summarizeSession := func() {
+		if summarizer == nil || len(summarizer.messages) == 0 {
+			return
+		}
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Summarizing %d messages...", len(summarizer.messages))))
+		sourceFile, err := summarizer.summarize(ctx, time.Now())
+		if err != nil {
+			fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Summary error: %v", err)))
+			return
+		}
+		if sourceFile != "" {
+			fmt.Println(renderPreflightStep("ok", "Stored session summary "+sourceFile))
+		}
+	}
+
+	for {
+		select {
+		case <-sigCh:
+			flushPending()
+			summarizeSession()
+			fmt.Println()
+			fmt.Println(infoStyle.Render("  Stopped."))
+			return
+		case <-ticker.C:
+		}
+
+		// A quiet chat gets its last partial batch and a summary written
+		if summarizer.due(time.Now()) {
+			flushPending()
+			summarizeSession()
+		}
+		if idleFlushDue(len(pending), lastMessage, *flushAfter, time.Now()) {
+			flushPending()
+		}
+
+		bubbles, err := reader.bubbles()
+		if err != nil {
+			// Cursor may be mid-write; the next poll reads it again
+			continue
+		}
+		for _, b := range settledBubbles(bubbles, done, seen) {
+			done[b.ID] = true
+			tm, ok := cursorMessage(b, session.ID, userAlias, assistantAlias, time.Now())
+			if !ok {
+				empty = append(empty, b.ID)
+				continue
+			}
+			pending = append(pending, tm)
+			lastMessage = time.Now()
+			summarizer.add(tm, time.Now())
+			fmt.Println(renderMessage(tm.Role, tm.Timestamp.Format("15:04:05"), tm.Text, tm.IsUser))
+		}
+
+		if len(pending) >= *batchSize {
+			sourceFile := fmt.Sprintf("watch-cursor://%s/batch-%d", session.ID, batchNum)
+			if err := ingestBatch(ctx, db, ollama, titleModel, sourceFile, pending, session.Title, chunking, saveState); err != nil {
+				fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Ingest error: %v", err)))
+				if errors.Is(err, errDatabaseBusy) {
+					fmt.Println(infoStyle.Render(fmt.Sprintf("  Keeping %d messages for the next poll", len(pending))))
+				}
+				continue
+			}
+			empty = nil
+			batchNum++
+			fmt.Println()
+			fmt.Println(renderIngest(len(pending), batchNum))
+			fmt.Println()
+			pending = nil
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCursorState creates a Cursor state database holding values under keys in table.
+func writeCursorState(t *testing.T, path, table string, values map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE ` + table + ` (key TEXT UNIQUE ON CONFLICT REPLACE, value BLOB)`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for key, value := range values {
+		if _, err := db.Exec(`INSERT INTO `+table+` (key, value) VALUES (?, ?)`, key, []byte(value)); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+}
+
+func TestCursorSessions(t *testing.T) {
+	userDir := t.TempDir()
+	app := filepath.Join(userDir, "workspaceStorage", "a1b2")
+	os.MkdirAll(app, 0o755)
+	os.WriteFile(filepath.Join(app, "workspace.json"), []byte(`{"folder": "file:///home/me/app"}`), 0o600)
+	writeCursorState(t, filepath.Join(app, "state.vscdb"), "ItemTable", map[string]string{
+		cursorChatKey: `{"tabs": [
+			{"tabId": "tab1", "chatTitle": "Token rotation", "lastSendTime": 1748858400000, "bubbles": [
+				{"id": "b1", "type": "user", "text": "How do we rotate tokens?"},
+				{"id": "b2", "type": "ai", "rawText": "Weekly, with a TTL column."}
+			]},
+			{"tabId": "empty", "bubbles": []}
+		]}`,
+		cursorComposersKey: `{"allComposers": [
+			{"composerId": "c1", "name": "Logging", "lastUpdatedAt": 1748858500000},
+			{"composerId": "c2", "createdAt": 1748858300000}
+		]}`,
+	})
+	writeCursorState(t, filepath.Join(userDir, "globalStorage", "state.vscdb"), "cursorDiskKV", map[string]string{
+		"composerData:c1": `{"conversation": [
+			{"bubbleId": "x1", "type": 1, "text": "Where do the logs go?", "createdAt": "2025-06-02T10:00:00Z"},
+			{"bubbleId": "x2", "type": 2, "text": ""},
+			{"bubbleId": "x3", "type": 2, "text": "To S3, daily."}
+		]}`,
+		"composerData:c2":   `{"fullConversationHeadersOnly": [{"bubbleId": "y1", "type": 1}]}`,
+		"bubbleId:c2:y1":    `{"type": 1, "text": "Rename the bucket"}`,
+		"composerData:none": `{}`,
+	})
+
+	sessions, err := discoverCursorSessions(userDir)
+	if err != nil {
+		t.Fatalf("discoverCursorSessions: %v", err)
+	}
+	if len(sessions) != 3 || sessions[0].ID != "c1" || sessions[1].ID != "tab1" || sessions[2].ID != "c2" {
+		t.Fatalf("expected the chats most recent first, without the empty tab, got %+v", sessions)
+	}
+	if sessions[0].Folder != "/home/me/app" || !sessions[0].Composer || sessions[2].Title == "" {
+		t.Fatalf("unexpected chat %+v", sessions[0])
+	}
+	if kept := cursorSessionsIn(sessions, "/home/me/site"); len(kept) != 0 {
+		t.Fatalf("expected no chats elsewhere, got %+v", kept)
+	}
+	if s, err := findCursorSession(cursorSessionsIn(sessions, "/home/me/app"), "", true); err != nil || s.ID != "c1" {
+		t.Fatalf("expected the latest chat, got %q, %v", s.ID, err)
+	}
+
+	for _, tc := range []struct {
+		session cursorSession
+		want    []cursorBubble
+	}{
+		{sessions[1], []cursorBubble{{ID: "b1", IsUser: true, Text: "How do we rotate tokens?"}, {ID: "b2", Text: "Weekly, with a TTL column."}}},
+		{sessions[0], []cursorBubble{{ID: "x1", IsUser: true, Text: "Where do the logs go?", Time: time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)}, {ID: "x2"}, {ID: "x3", Text: "To S3, daily."}}},
+		{sessions[2], []cursorBubble{{ID: "y1", IsUser: true, Text: "Rename the bucket"}}},
+	} {
+		reader, err := newCursorReader(userDir, tc.session)
+		if err != nil {
+			t.Fatalf("newCursorReader: %v", err)
+		}
+		bubbles, err := reader.bubbles()
+		reader.Close()
+		if err != nil || len(bubbles) != len(tc.want) {
+			t.Fatalf("%s: expected %d bubbles, got %+v, %v", tc.session.ID, len(tc.want), bubbles, err)
+		}
+		for i, b := range bubbles {
+			if w := tc.want[i]; b.ID != w.ID || b.IsUser != w.IsUser || b.Text != w.Text || !b.Time.Equal(w.Time) {
+				t.Fatalf("%s: expected %+v, got %+v", tc.session.ID, w, b)
+			}
+		}
+	}
+}
+
+func TestSettledBubbles(t *testing.T) {
+	done := map[string]bool{"b1": true}
+	seen := make(map[string]string)
+	bubbles := []cursorBubble{{ID: "b1", Text: "old"}, {ID: "b2", Text: "question"}, {ID: "b3", Text: "Partial ans"}}
+
+	// The reply may still be streaming
+	if got := settledBubbles(bubbles, done, seen); len(got) != 1 || got[0].ID != "b2" {
+		t.Fatalf("expected only the bubble followed by another, got %+v", got)
+	}
+	done["b2"] = true
+	bubbles[2].Text = "Partial answer, finished"
+	if got := settledBubbles(bubbles, done, seen); len(got) != 0 {
+		t.Fatalf("expected the growing reply left alone, got %+v", got)
+	}
+	if got := settledBubbles(bubbles, done, seen); len(got) != 1 || got[0].Text != "Partial answer, finished" {
+		t.Fatalf("expected the reply once unchanged, got %+v", got)
+	}
+	if len(seen) != 0 {
+		t.Fatalf("expected settled bubbles forgotten, got %v", seen)
+	}
+}
+
+func TestCursorMessage(t *testing.T) {
+	withLocation(t, time.UTC)
+	now := time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)
+	tm, ok := cursorMessage(cursorBubble{ID: "b1", IsUser: true, Text: "How do we rotate tokens?"}, "tab1", "Me", "AI", now)
+	if !ok || tm.Role != "Me" || !tm.IsUser || tm.MessageID != "tab1/b1" || tm.SessionID != "tab1" || !tm.Timestamp.Equal(now) {
+		t.Fatalf("unexpected message %+v, %v", tm, ok)
+	}
+	if _, ok := cursorMessage(cursorBubble{ID: "b2", Text: "ok"}, "tab1", "Me", "AI", now); ok {
+		t.Fatal("expected a bubble without text skipped")
+	}
+}
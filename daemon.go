@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// daemonPaths returns the PID and log files of a watcher daemon, by default next to the
+// database: watch-oc.pid and watch-oc.log.
+func daemonPaths(watcher, dbPath, pidPath, logPath string) (string, string) {
+	dir := filepath.Dir(dbPath)
+	if pidPath == "" {
+		pidPath = filepath.Join(dir, watcher+".pid")
+	}
+	if logPath == "" {
+		logPath = filepath.Join(dir, watcher+".log")
+	}
+	return pidPath, logPath
+}
+
+// startDaemon switches a watcher to running unattended. It claims the PID file (see
+// createPIDFile), refusing to start while it names a live process, and from then on appends
+// everything the watcher prints to logPath as timestamped plain lines. stop removes the
+// PID file and writes out the last of the log.
+func startDaemon(pidPath, logPath string) (stop func(), err error) {
+	if err := createPIDFile(pidPath); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		os.Remove(pidPath)
+		return nil, fmt.Errorf("open log: %w", err)
+	}
+
+	// No colors or boxes in the log; lipgloss sees a file and drops the colors itself
+	lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(logFile))
+	plainOutput = true
+	logger := log.New(logFile, "", log.LstdFlags)
+	log.SetOutput(logFile)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		logFile.Close()
+		os.Remove(pidPath)
+		return nil, err
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		// Lines of any length, so the pipe is drained however much the watcher prints
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadString('\n')
+			if line = strings.TrimSpace(line); line != "" {
+				logger.Println(line)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	logger.Printf("started as process %d", os.Getpid())
+
+	return func() {
+		logger.Printf("stopped")
+		os.Stdout, os.Stderr = stdout, stderr
+		w.Close()
+		<-copied
+		log.SetOutput(stderr)
+		logFile.Close()
+		os.Remove(pidPath)
+	}, nil
+}
+
+// createPIDFile writes our process ID to path. The file is created exclusively, so of two
+// daemons starting at once only one gets it. One left behind by a process that has
+// exited, or holding no process ID, is stale and replaced.
+func createPIDFile(path string) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return fmt.Errorf("write pid file: %w", err)
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("create pid file: %w", err)
+		}
+		if pid, err := readPIDFile(path); err == nil && processAlive(pid) {
+			return fmt.Errorf("already running as process %d (%s)", pid, path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove stale pid file: %w", err)
+		}
+	}
+	return fmt.Errorf("%s: taken by another process starting at the same time", path)
+}
+
+// readPIDFile reads the process ID a PID file holds.
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("%s: not a process ID", path)
+	}
+	return pid, nil
+}
+
+// processAlive reports whether a process with pid exists, even one owned by another user.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestStartDaemon(t *testing.T) {
+	defer func(r *lipgloss.Renderer, plain bool) {
+		lipgloss.SetDefaultRenderer(r)
+		plainOutput = plain
+	}(lipgloss.DefaultRenderer(), plainOutput)
+
+	dir := t.TempDir()
+	pidPath, logPath := daemonPaths(watcherCC, filepath.Join(dir, "mneme.db"), "", "")
+	if pidPath != filepath.Join(dir, "watch-cc.pid") || logPath != filepath.Join(dir, "watch-cc.log") {
+		t.Fatalf("expected files next to the database, got %s, %s", pidPath, logPath)
+	}
+
+	// A PID file left by a process that has exited does not stop a new start
+	os.WriteFile(pidPath, []byte("999999999\n"), 0o644)
+	stop, err := startDaemon(pidPath, logPath)
+	if err != nil {
+		t.Fatalf("startDaemon: %v", err)
+	}
+	if pid, err := readPIDFile(pidPath); err != nil || pid != os.Getpid() {
+		t.Fatalf("expected our PID written, got %d, %v", pid, err)
+	}
+	if _, err := startDaemon(pidPath, logPath); err == nil || !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+		t.Fatalf("expected a second daemon refused, got %v", err)
+	}
+	fmt.Println(renderMessage("User", "10:00:00", "Rotate the\ntokens", true))
+	// A line longer than any scanner buffer neither stops the log nor blocks the writer
+	fmt.Println(strings.Repeat("x", 2<<20))
+	fmt.Println("after the long line")
+	stop()
+
+	if _, err := os.Stat(pidPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the PID file removed, got %v", err)
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if !strings.Contains(string(data), "10:00:00 User: Rotate the tokens\n") || !strings.Contains(string(data), "stopped\n") {
+		t.Fatalf("expected plain timestamped lines in the log, got\n%.500s", data)
+	}
+	if !strings.Contains(string(data), strings.Repeat("x", 2<<20)+"\n") || !strings.Contains(string(data), "after the long line\n") {
+		t.Fatal("expected the long line and the ones after it logged")
+	}
+}
+
+func TestCreatePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watch-oc.pid")
+	// Garbage, say from a crash while it was written, is stale
+	os.WriteFile(path, []byte("\n"), 0o644)
+	if err := createPIDFile(path); err != nil {
+		t.Fatalf("createPIDFile: %v", err)
+	}
+	if pid, err := readPIDFile(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("expected our PID written, got %d, %v", pid, err)
+	}
+	if err := createPIDFile(path); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("expected the live PID file kept, got %v", err)
+	}
+}
@@ -3,18 +3,25 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
-	_ "github.com/mattn/go-sqlite3"
+	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
 var EmbedDimension = 1024
 
+// EmbedModel is the Ollama model embeddings are made with, from EMBED_MODEL.
+var EmbedModel = "qwen3-embedding:0.6b"
+
 func init() {
 	sqlite_vec.Auto()
 }
@@ -27,6 +34,95 @@ func loadEmbedDimension() {
 	}
 }
 
+func loadEmbedModel() {
+	if model := os.Getenv("EMBED_MODEL"); model != "" {
+		EmbedModel = model
+	}
+}
+
+// busyTimeout is how long a write waits for another writer, in this process or another
+// mneme process on the same database, before failing with SQLITE_BUSY.
+var busyTimeout = 30 * time.Second
+
+func loadBusyTimeout() error {
+	value := os.Getenv("MNEME_BUSY_TIMEOUT")
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("MNEME_BUSY_TIMEOUT: want a duration such as 30s, got %q", value)
+	}
+	busyTimeout = d
+	return nil
+}
+
+// busyRetries bounds how often a write that found the database locked is retried once
+// SQLite's own busyTimeout wait has run out; busyBackoff is the first pause between
+// attempts, doubled (with jitter) each time.
+const busyRetries = 4
+
+var busyBackoff = 500 * time.Millisecond
+
+// errDatabaseBusy marks a write that gave up on a lock held by another writer.
+var errDatabaseBusy = errors.New("database is locked by another writer")
+
+// isBusy reports whether err is SQLite finding the database or a table locked.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// retryBusy runs a write, retrying it while another process holds the write lock. If the
+// lock never frees, the error says who is likely holding it and what to do.
+func retryBusy(op string, fn func() error) error {
+	backoff := busyBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) {
+			return err
+		}
+		if attempt > busyRetries {
+			return fmt.Errorf("%s: %w after %d attempts (%v); another mneme process such as a watcher, the MCP server or an ingest is holding a write transaction. Stop it or raise MNEME_BUSY_TIMEOUT (now %s)",
+				op, errDatabaseBusy, attempt, err, busyTimeout)
+		}
+		time.Sleep(backoff/2 + rand.N(backoff))
+		backoff *= 2
+	}
+}
+
+// withWriteTx runs fn in a write transaction and commits it, retrying the whole
+// transaction under retryBusy. fn may run more than once.
+func withWriteTx(db *sql.DB, op string, fn func(tx *sql.Tx) error) error {
+	return retryBusy(op, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// sqliteDSN adds mneme's connection settings to a database path so that every pooled
+// connection gets them, not just the first. Transactions begin IMMEDIATE: each takes the
+// write lock up front and queues behind the current writer for up to busyTimeout. A
+// deferred transaction that read first fails outright when it later needs to write
+// while another watcher, server or ingest holds the lock.
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_txlock=immediate&_busy_timeout=%d&_foreign_keys=on&_journal_mode=WAL", path, sep, busyTimeout.Milliseconds())
+}
+
 func buildSchema(dim int) string {
 	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS chunks (
     id INTEGER PRIMARY KEY,
@@ -40,12 +136,29 @@ func buildSchema(dim int) string {
     chunk_total INTEGER,
     valid_at TEXT,
     ingested_at TEXT NOT NULL,
+    valid_until TEXT,
+    superseded_by INTEGER REFERENCES chunks(id) ON DELETE SET NULL,
+    importance REAL,
+    retrieval_count INTEGER NOT NULL DEFAULT 0,
+    last_retrieved_at TEXT,
+    decay REAL,
+    archived_at TEXT,
+    pinned_at TEXT,
+    normalized_text TEXT,
+    content_hash TEXT,
     UNIQUE(source_file, section_sequence, chunk_sequence)
 );
 
+CREATE INDEX IF NOT EXISTS idx_chunks_source_file ON chunks(source_file);
+CREATE INDEX IF NOT EXISTS idx_chunks_valid_at ON chunks(valid_at);
+
+-- valid_at and valid_until mirror chunks (see vecChunksValidityTrigger) so date filters
+-- run inside the KNN query; '' and '9999-12-31' stand for open bounds
 CREATE VIRTUAL TABLE IF NOT EXISTS vec_chunks USING vec0(
     chunk_id INTEGER PRIMARY KEY,
-    embedding float[%d] distance_metric=cosine
+    embedding float[%d] distance_metric=cosine,
+    valid_at text,
+    valid_until text
 );
 
 -- Phase 2: Messages table for raw conversation storage
@@ -54,7 +167,9 @@ CREATE TABLE IF NOT EXISTS messages (
     session_id TEXT NOT NULL,
     role TEXT NOT NULL,
     timestamp INTEGER NOT NULL,
-    text TEXT NOT NULL
+    text TEXT NOT NULL,
+    thread_id INTEGER REFERENCES threads(id) ON DELETE SET NULL,
+    normalized_text TEXT
 );
 
 CREATE INDEX IF NOT EXISTS idx_messages_session_ts ON messages(session_id, timestamp);
@@ -65,7 +180,199 @@ CREATE VIRTUAL TABLE IF NOT EXISTS vec_messages USING vec0(
     message_id TEXT PRIMARY KEY,
     embedding float[%d] distance_metric=cosine
 );
-`, dim, dim)
+
+-- Topical threads of messages, within and across sessions (timestamps in ms)
+CREATE TABLE IF NOT EXISTS threads (
+    id INTEGER PRIMARY KEY,
+    title TEXT NOT NULL,
+    started_at INTEGER NOT NULL,
+    ended_at INTEGER NOT NULL,
+    message_count INTEGER NOT NULL DEFAULT 0
+);
+
+-- Sum of each thread's normalized message embeddings (cosine ignores the length)
+CREATE VIRTUAL TABLE IF NOT EXISTS vec_threads USING vec0(
+    thread_id INTEGER PRIMARY KEY,
+    embedding float[%d] distance_metric=cosine
+);
+
+-- Entities extracted from chunks (people, projects, places)
+CREATE TABLE IF NOT EXISTS entities (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    kind TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chunk_entities (
+    chunk_id INTEGER NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+    entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    PRIMARY KEY (chunk_id, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chunk_entities_entity ON chunk_entities(entity_id);
+
+-- Alternate names that resolve to an entity (e.g. left behind by a merge). An alias
+-- may belong to several entities; mentions of it are then resolved per chunk.
+CREATE TABLE IF NOT EXISTS entity_aliases (
+    alias TEXT NOT NULL COLLATE NOCASE,
+    entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    PRIMARY KEY (alias, entity_id)
+);
+
+-- Which entity a shared alias refers to in each chunk (entity_id NULL when undecided)
+CREATE TABLE IF NOT EXISTS mention_resolutions (
+    chunk_id INTEGER NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+    alias TEXT NOT NULL COLLATE NOCASE,
+    entity_id INTEGER REFERENCES entities(id) ON DELETE CASCADE,
+    score REAL NOT NULL,
+    resolved_at TEXT NOT NULL,
+    PRIMARY KEY (chunk_id, alias)
+);
+
+-- Word-boundary positions (byte offsets) of each entity name inside chunk text
+CREATE TABLE IF NOT EXISTS entity_mentions (
+    entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    chunk_id INTEGER NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+    start_pos INTEGER NOT NULL,
+    end_pos INTEGER NOT NULL,
+    PRIMARY KEY (entity_id, chunk_id, start_pos)
+);
+
+CREATE INDEX IF NOT EXISTS idx_entity_mentions_chunk ON entity_mentions(chunk_id);
+
+-- Knowledge graph: subject -[predicate]-> object, with the chunk that stated it
+CREATE TABLE IF NOT EXISTS relations (
+    id INTEGER PRIMARY KEY,
+    subject_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    predicate TEXT NOT NULL,
+    object_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    chunk_id INTEGER REFERENCES chunks(id) ON DELETE CASCADE,
+    valid_at TEXT,
+    UNIQUE(subject_id, predicate, object_id, chunk_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_relations_subject ON relations(subject_id);
+CREATE INDEX IF NOT EXISTS idx_relations_object ON relations(object_id);
+
+-- Labels on chunks: topics assigned by the tagging pass, or added by hand
+CREATE TABLE IF NOT EXISTS chunk_tags (
+    chunk_id INTEGER NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL COLLATE NOCASE,
+    source TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    PRIMARY KEY (chunk_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chunk_tags_tag ON chunk_tags(tag);
+
+-- Atomic facts distilled from chunks, embedded separately for crisp retrieval
+CREATE TABLE IF NOT EXISTS facts (
+    id INTEGER PRIMARY KEY,
+    text TEXT NOT NULL,
+    chunk_id INTEGER NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+    valid_at TEXT,
+    created_at TEXT NOT NULL,
+    valid_until TEXT,
+    superseded_by INTEGER REFERENCES facts(id) ON DELETE SET NULL,
+    UNIQUE(chunk_id, text)
+);
+
+CREATE INDEX IF NOT EXISTS idx_facts_chunk ON facts(chunk_id);
+
+-- valid_at and valid_until mirror facts (see vecFactsValidityTrigger), as for vec_chunks
+CREATE VIRTUAL TABLE IF NOT EXISTS vec_facts USING vec0(
+    fact_id INTEGER PRIMARY KEY,
+    embedding float[%d] distance_metric=cosine,
+    valid_at text,
+    valid_until text
+);
+
+-- Pairs of facts about the same entity that disagree (contradiction) or where the
+-- newer one replaces the older (supersession)
+CREATE TABLE IF NOT EXISTS conflicts (
+    id INTEGER PRIMARY KEY,
+    entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+    older_fact_id INTEGER NOT NULL REFERENCES facts(id) ON DELETE CASCADE,
+    newer_fact_id INTEGER NOT NULL REFERENCES facts(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    detected_at TEXT NOT NULL,
+    UNIQUE(older_fact_id, newer_fact_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conflicts_entity ON conflicts(entity_id);
+
+-- Model-written entity profiles, folded forward as new chunks mention the entity
+CREATE TABLE IF NOT EXISTS entity_profiles (
+    name TEXT PRIMARY KEY COLLATE NOCASE,
+    profile TEXT NOT NULL,
+    last_chunk_id INTEGER NOT NULL,
+    chunk_count INTEGER NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+-- Decay settings per namespace (source_file prefix; '' is the default)
+CREATE TABLE IF NOT EXISTS decay_policies (
+    namespace TEXT PRIMARY KEY,
+    half_life_days REAL NOT NULL,
+    importance_weight REAL NOT NULL,
+    reinforcement REAL NOT NULL,
+    archive_below REAL NOT NULL
+);
+
+-- Records which LLM extraction passes have already run over a chunk
+CREATE TABLE IF NOT EXISTS chunk_extractions (
+    chunk_id INTEGER NOT NULL REFERENCES chunks(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    extracted_at TEXT NOT NULL,
+    PRIMARY KEY (chunk_id, kind)
+);
+
+-- Settings the stored data depends on, such as the embedding model (see checkEmbeddingMeta)
+CREATE TABLE IF NOT EXISTS meta (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+-- What each watcher has processed of a session, so a restart resumes where it stopped
+CREATE TABLE IF NOT EXISTS watch_state (
+    watcher TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (watcher, session_id, key)
+);
+
+-- What each ingested file last produced, so ingesting it unchanged again is a no-op;
+-- chunks is how many of its chunks were stored, near-duplicates left out
+CREATE TABLE IF NOT EXISTS source_hashes (
+    source_file TEXT PRIMARY KEY,
+    hash TEXT NOT NULL,
+    ingested_at TEXT NOT NULL,
+    chunks INTEGER
+);
+
+-- Embeddings of a file's chunks kept until the file is stored, so an interrupted ingest
+-- resumes instead of embedding everything again; keyed by the chunk's content hash
+CREATE TABLE IF NOT EXISTS ingest_staging (
+    source_file TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    dim INTEGER NOT NULL,
+    embedding BLOB NOT NULL,
+    normalized_text TEXT,
+    PRIMARY KEY (source_file, content_hash)
+);
+
+-- Migrations applied to this database (see migrateSchema)
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TEXT NOT NULL
+);
+`, dim, dim, dim, dim)
 }
 
 var fts5Available = false
@@ -73,43 +380,95 @@ var fts5Available = false
 // FTS5 schema - run separately because CREATE VIRTUAL TABLE IF NOT EXISTS
 // doesn't work well with FTS5 in all SQLite versions
 func ensureFTS5(db *sql.DB) error {
+	// An FTS5 table left by another build is unusable without the module
+	var compiled bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&compiled); err != nil || !compiled {
+		log.Printf("FTS5 not available (optional): not compiled in, build with -tags fts5")
+		return dropChunksFTSTriggers(db)
+	}
+
 	// Check if FTS5 table already exists
 	var name string
 	err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='messages_fts'`).Scan(&name)
-	if err == nil {
-		fts5Available = true
-		return nil // already exists
-	}
-
-	// Try to create FTS5 table - may fail if FTS5 not compiled in
-	_, err = db.Exec(`
-		CREATE VIRTUAL TABLE messages_fts USING fts5(
-			message_id UNINDEXED,
-			role,
-			text,
-			content=messages,
-			content_rowid=rowid
-		)
-	`)
 	if err != nil {
-		// FTS5 not available - that's okay, we'll use LIKE fallback
-		log.Printf("FTS5 not available (optional): %v", err)
-		return nil
+		// Try to create FTS5 table - may fail if FTS5 not compiled in
+		_, err = db.Exec(`
+			CREATE VIRTUAL TABLE messages_fts USING fts5(
+				message_id UNINDEXED,
+				role,
+				text,
+				content=messages,
+				content_rowid=rowid
+			)
+		`)
+		if err != nil {
+			// FTS5 not available - that's okay, we'll use LIKE fallback
+			log.Printf("FTS5 not available (optional): %v", err)
+			return dropChunksFTSTriggers(db)
+		}
+
+		// Populate from existing messages
+		_, _ = db.Exec(`
+			INSERT INTO messages_fts(message_id, role, text)
+			SELECT id, role, text FROM messages
+		`)
 	}
 
 	fts5Available = true
 
-	// Populate from existing messages
-	_, _ = db.Exec(`
-		INSERT INTO messages_fts(message_id, role, text)
-		SELECT id, role, text FROM messages
-	`)
+	return ensureChunksFTS(db)
+}
+
+// chunksFTSTriggers keep chunks_fts in step with chunks on every write path.
+const chunksFTSTriggers = `
+CREATE TRIGGER chunks_fts_ai AFTER INSERT ON chunks BEGIN
+    INSERT INTO chunks_fts(rowid, text) VALUES (new.id, new.text);
+END;
+CREATE TRIGGER chunks_fts_ad AFTER DELETE ON chunks BEGIN
+    INSERT INTO chunks_fts(chunks_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+CREATE TRIGGER chunks_fts_au AFTER UPDATE OF text ON chunks BEGIN
+    INSERT INTO chunks_fts(chunks_fts, rowid, text) VALUES ('delete', old.id, old.text);
+    INSERT INTO chunks_fts(rowid, text) VALUES (new.id, new.text);
+END;`
+
+// ensureChunksFTS creates the word index over chunk text used by History.
+// If the triggers are missing (new index, or the database was last written by a
+// build without FTS5), the index is rebuilt from chunks before they are restored.
+func ensureChunksFTS(db *sql.DB) error {
+	var name string
+	err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='chunks_fts'`).Scan(&name)
+	if err != nil {
+		if _, err := db.Exec(`CREATE VIRTUAL TABLE chunks_fts USING fts5(text, content=chunks, content_rowid=id)`); err != nil {
+			return fmt.Errorf("create chunks_fts: %w", err)
+		}
+	}
+
+	err = db.QueryRow(`SELECT name FROM sqlite_master WHERE type='trigger' AND name='chunks_fts_ai'`).Scan(&name)
+	if err == nil {
+		return nil
+	}
+	if _, err := db.Exec(`INSERT INTO chunks_fts(chunks_fts) VALUES ('rebuild')`); err != nil {
+		return fmt.Errorf("rebuild chunks_fts: %w", err)
+	}
+	if _, err := db.Exec(chunksFTSTriggers); err != nil {
+		return fmt.Errorf("create chunks_fts triggers: %w", err)
+	}
+	return nil
+}
 
+// dropChunksFTSTriggers lets a build without FTS5 write to a database created with it;
+// the index is rebuilt the next time an FTS5 build opens the database.
+func dropChunksFTSTriggers(db *sql.DB) error {
+	for _, trigger := range []string{"chunks_fts_ai", "chunks_fts_ad", "chunks_fts_au"} {
+		if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + trigger); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func ValidateEmbedDimension(ollama *OllamaClient) error {
-	ctx := context.Background()
+func ValidateEmbedDimension(ctx context.Context, ollama *OllamaClient) error {
 	embedding, err := ollama.Embed(ctx, "dimension check")
 	if err != nil {
 		return fmt.Errorf("embed test failed: %w", err)
@@ -120,25 +479,65 @@ func ValidateEmbedDimension(ollama *OllamaClient) error {
 	return nil
 }
 
+// InitDB opens the database, creating or migrating its schema. It refuses a database
+// whose embeddings have another dimension than EMBED_DIM (see checkVecDimensions) or
+// were made with another model than EMBED_MODEL (see checkEmbeddingMeta).
 func InitDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	return initDB(dbPath, true)
+}
+
+// initDB is InitDB, with the embedding checks optional for reembed, which fixes a
+// mismatch, and status, which reports one.
+func initDB(dbPath string, checkDimensions bool) (*sql.DB, error) {
+	db, err := sql.Open(sqliteDriver, sqliteDSN(dbPath))
 	if err != nil {
 		return nil, err
 	}
-
-	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+	// Every connection to :memory: opens its own empty database, so keep to one
+	if dbPath == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+	// Opening is lazy; surface a bad path or locked file here
+	if err := db.Ping(); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
-	if _, err := db.Exec("PRAGMA busy_timeout=5000"); err != nil {
+
+	// A database without any tables is created at the latest schema version
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
-
 	if _, err := db.Exec(buildSchema(EmbedDimension)); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
+	if err := migrateSchema(db, tables == 0); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	for _, trigger := range []string{vecChunksValidityTrigger, vecFactsValidityTrigger} {
+		if _, err := db.Exec(trigger); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	if checkDimensions {
+		if err := checkVecDimensions(db); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+		if err := checkEmbeddingMeta(db); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	// Needs the thread_id column, which older databases gain in a migration
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(thread_id)`); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 
 	// Set up FTS5
 	if err := ensureFTS5(db); err != nil {
@@ -149,79 +548,383 @@ func InitDB(dbPath string) (*sql.DB, error) {
 	return db, nil
 }
 
-// ============ Message Functions ============
+// migration is one step in the evolution of the schema. apply runs inside the write
+// transaction that records it, so a failed migration leaves nothing half done.
+type migration struct {
+	version int
+	name    string
+	apply   func(tx *sql.Tx) error
+}
 
-// insertMessages upserts messages and their embeddings
-func insertMessages(db *sql.DB, ollama *OllamaClient, messages []textMessage) (int, error) {
-	if len(messages) == 0 {
-		return 0, nil
+// migrations are applied in order to databases created by older versions of mneme.
+// buildSchema always creates the latest schema, so a new database records them all as
+// applied without running them: a schema change goes in both places. Append only;
+// never renumber or edit a released migration.
+var migrations = []migration{
+	{1, "baseline", migrateBaseline},
+	{2, "meta", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT NOT NULL)`)
+		return err
+	}},
+	{3, "watch_state", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS watch_state (
+		    watcher TEXT NOT NULL,
+		    session_id TEXT NOT NULL,
+		    key TEXT NOT NULL,
+		    value TEXT NOT NULL,
+		    updated_at TEXT NOT NULL,
+		    PRIMARY KEY (watcher, session_id, key)
+		)`)
+		return err
+	}},
+	{4, "content_hash", func(tx *sql.Tx) error {
+		// Left NULL on existing chunks; loadSourceChunks hashes their text when it needs to
+		if err := ensureColumn(tx, "chunks", "content_hash", "TEXT"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS source_hashes (
+		    source_file TEXT PRIMARY KEY,
+		    hash TEXT NOT NULL,
+		    ingested_at TEXT NOT NULL
+		)`)
+		return err
+	}},
+	{5, "source_hashes_chunks", func(tx *sql.Tx) error {
+		return ensureColumn(tx, "source_hashes", "chunks", "INTEGER")
+	}},
+	{6, "vec_facts_validity", func(tx *sql.Tx) error {
+		return ensureVecValidity(tx, "vec_facts", "fact_id", "facts")
+	}},
+	{7, "ingest_staging", func(tx *sql.Tx) error {
+		// Older builds created the table on first use, without the model
+		if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS ingest_staging (
+		    source_file TEXT NOT NULL,
+		    content_hash TEXT NOT NULL,
+		    model TEXT NOT NULL DEFAULT '',
+		    dim INTEGER NOT NULL,
+		    embedding BLOB NOT NULL,
+		    normalized_text TEXT,
+		    PRIMARY KEY (source_file, content_hash)
+		)`); err != nil {
+			return err
+		}
+		return ensureColumn(tx, "ingest_staging", "model", "TEXT NOT NULL DEFAULT ''")
+	}},
+	{8, "normalize_times", normalizeStoredTimes},
+}
+
+// schemaVersion returns the latest migration recorded in the database, 0 for none.
+func schemaVersion(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// latestSchemaVersion is the version this build of mneme migrates databases to.
+func latestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
 	}
+	return migrations[len(migrations)-1].version
+}
 
-	ctx := context.Background()
-	tx, err := db.Begin()
+// migrateSchema applies the migrations a database has not had yet, each in its own write
+// transaction. The version is read again once the write lock is held, so processes
+// opening the database together apply each migration once. fresh marks a database
+// buildSchema just created, which is already at the latest version.
+func migrateSchema(db *sql.DB, fresh bool) error {
+	current, err := schemaVersion(db)
 	if err != nil {
-		return 0, fmt.Errorf("begin tx: %w", err)
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if latest := latestSchemaVersion(); current > latest {
+		return fmt.Errorf("database schema version %d is newer than this mneme supports (%d); upgrade mneme", current, latest)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		err := withWriteTx(db, "migrate schema", func(tx *sql.Tx) error {
+			applied, err := schemaVersion(tx)
+			if err != nil || applied >= m.version {
+				return err
+			}
+			if !fresh {
+				if err := m.apply(tx); err != nil {
+					return err
+				}
+			}
+			_, err = tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`, m.version, m.name, now)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
 	}
-	defer func() { _ = tx.Rollback() }()
+	return nil
+}
 
-	msgStmt, err := tx.Prepare(`INSERT OR IGNORE INTO messages (id, session_id, role, timestamp, text) VALUES (?, ?, ?, ?, ?)`)
-	if err != nil {
-		return 0, fmt.Errorf("prepare msg: %w", err)
+// migrateBaseline brings a database from before version tracking up to the schema of
+// the release that introduced it. Its steps check before they change anything, since
+// such databases may have had any of them already.
+func migrateBaseline(tx *sql.Tx) error {
+	// Validity intervals: valid_at is the start, valid_until the (exclusive) end
+	for _, col := range []struct{ table, column, definition string }{
+		{"chunks", "valid_until", "TEXT"},
+		{"chunks", "superseded_by", "INTEGER REFERENCES chunks(id) ON DELETE SET NULL"},
+		{"facts", "valid_until", "TEXT"},
+		{"facts", "superseded_by", "INTEGER REFERENCES facts(id) ON DELETE SET NULL"},
+		// Retention: 0 (disposable) to 1 (keep), NULL until scored
+		{"chunks", "importance", "REAL"},
+		// Decay: retrievals reinforce a chunk, archived chunks drop out of search
+		{"chunks", "retrieval_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"chunks", "last_retrieved_at", "TEXT"},
+		{"chunks", "decay", "REAL"},
+		{"chunks", "archived_at", "TEXT"},
+		// Pinned chunks are always returned by pinned-aware retrieval
+		{"chunks", "pinned_at", "TEXT"},
+		{"messages", "thread_id", "INTEGER REFERENCES threads(id) ON DELETE SET NULL"},
+		// Spell-corrected text the embedding was made from, NULL when it matches text
+		{"chunks", "normalized_text", "TEXT"},
+		{"messages", "normalized_text", "TEXT"},
+	} {
+		if err := ensureColumn(tx, col.table, col.column, col.definition); err != nil {
+			return err
+		}
+	}
+	if err := ensureVecValidity(tx, "vec_chunks", "chunk_id", "chunks"); err != nil {
+		return err
 	}
-	defer msgStmt.Close()
+	return ensureAliasKey(tx)
+}
 
-	var ftsStmt *sql.Stmt
-	if fts5Available {
-		ftsStmt, err = tx.Prepare(`INSERT OR IGNORE INTO messages_fts (message_id, role, text) VALUES (?, ?, ?)`)
-		if err != nil {
-			// FTS5 might have become unavailable, continue without it
-			ftsStmt = nil
-		} else {
-			defer ftsStmt.Close()
+// ensureColumn adds a column to a table created by an older version of the schema.
+func ensureColumn(tx *sql.Tx, table, column, definition string) error {
+	var found int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&found); err != nil {
+		return err
+	}
+	if found > 0 {
+		return nil
+	}
+	_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// openValidUntil stands in for a NULL valid_until in vec_chunks and vec_facts, whose
+// metadata columns can't hold NULL; an empty valid_at likewise sorts before every date.
+const openValidUntil = "9999-12-31"
+
+// vecChunksValidityTrigger keeps the vec_chunks copies of valid_at and valid_until in
+// step when a chunk's validity changes.
+const vecChunksValidityTrigger = `
+CREATE TRIGGER IF NOT EXISTS vec_chunks_validity_au AFTER UPDATE OF valid_at, valid_until ON chunks BEGIN
+    UPDATE vec_chunks SET valid_at = COALESCE(new.valid_at, ''), valid_until = COALESCE(new.valid_until, '` + openValidUntil + `')
+    WHERE chunk_id = new.id;
+END`
+
+// vecFactsValidityTrigger does the same for vec_facts, as superseded facts are closed.
+const vecFactsValidityTrigger = `
+CREATE TRIGGER IF NOT EXISTS vec_facts_validity_au AFTER UPDATE OF valid_at, valid_until ON facts BEGIN
+    UPDATE vec_facts SET valid_at = COALESCE(new.valid_at, ''), valid_until = COALESCE(new.valid_until, '` + openValidUntil + `')
+    WHERE fact_id = new.id;
+END`
+
+// vecValidity returns the vec_chunks or vec_facts metadata values for a validity interval.
+func vecValidity(validAt, validUntil sql.NullString) (string, string) {
+	until := openValidUntil
+	if validUntil.Valid && validUntil.String != "" {
+		until = validUntil.String
+	}
+	return validAt.String, until
+}
+
+var vecDimensionPattern = regexp.MustCompile(`float\[(\d+)\]`)
+
+// ensureVecValidity rebuilds a vec0 table (vec_chunks or vec_facts) from before the
+// validity metadata columns, copying the embeddings (at their existing dimension) and the
+// dates of the rows in source they belong to. initDB installs the triggers that keep them
+// current.
+func ensureVecValidity(tx *sql.Tx, table, key, source string) error {
+	var schema string
+	if err := tx.QueryRow(`SELECT sql FROM sqlite_master WHERE name = ?`, table).Scan(&schema); err != nil {
+		return err
+	}
+	if strings.Contains(schema, "valid_until") {
+		return nil
+	}
+	dim := EmbedDimension
+	if m := vecDimensionPattern.FindStringSubmatch(schema); m != nil {
+		dim, _ = strconv.Atoi(m[1])
+	}
+	for _, stmt := range []string{
+		`DROP TRIGGER IF EXISTS ` + table + `_validity_au`,
+		`CREATE TABLE ` + table + `_migrate AS SELECT ` + key + `, embedding FROM ` + table,
+		`DROP TABLE ` + table,
+		fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING vec0(
+		    %s INTEGER PRIMARY KEY,
+		    embedding float[%d] distance_metric=cosine,
+		    valid_at text,
+		    valid_until text
+		)`, table, key, dim),
+		`INSERT INTO ` + table + ` (` + key + `, embedding, valid_at, valid_until)
+		 SELECT m.` + key + `, m.embedding, COALESCE(s.valid_at, ''), COALESCE(s.valid_until, '` + openValidUntil + `')
+		 FROM ` + table + `_migrate m JOIN ` + source + ` s ON s.id = m.` + key,
+		`DROP TABLE ` + table + `_migrate`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migrate %s: %w", table, err)
 		}
 	}
+	return nil
+}
 
-	inserted := 0
-	var toEmbed []textMessage
+// ensureAliasKey rebuilds entity_aliases from older schemas, where alias alone was the
+// primary key and so could only belong to one entity.
+func ensureAliasKey(tx *sql.Tx) error {
+	var pk int
+	if err := tx.QueryRow(`SELECT pk FROM pragma_table_info('entity_aliases') WHERE name = 'entity_id'`).Scan(&pk); err != nil {
+		return err
+	}
+	if pk > 0 {
+		return nil
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE entity_aliases_new (
+		    alias TEXT NOT NULL COLLATE NOCASE,
+		    entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE,
+		    PRIMARY KEY (alias, entity_id)
+		)`,
+		`INSERT INTO entity_aliases_new (alias, entity_id) SELECT alias, entity_id FROM entity_aliases`,
+		`DROP TABLE entity_aliases`,
+		`ALTER TABLE entity_aliases_new RENAME TO entity_aliases`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migrate entity_aliases: %w", err)
+		}
+	}
+	return nil
+}
+
+// ============ Message Functions ============
+
+// multiRowBatch caps the rows in one multi-row INSERT, keeping its bound parameters well
+// under SQLite's limit.
+const multiRowBatch = 100
+
+// valuesPlaceholders returns "(?, ?), (?, ?)" for rows tuples of cols parameters.
+func valuesPlaceholders(rows, cols int) string {
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", cols), ", ") + ")"
+	return strings.TrimSuffix(strings.Repeat(tuple+", ", rows), ", ")
+}
+
+type preparedMessage struct {
+	message    textMessage
+	normalized sql.NullString
+	serialized []byte
+}
 
+// prepareMessages returns the messages not stored yet, each with an embedding when it is
+// long enough to be worth searching. A failed embedding leaves that message without a
+// vector rather than failing the batch; a cancelled ctx does fail it, so nothing is stored
+// half-embedded.
+func prepareMessages(ctx context.Context, db *sql.DB, ollama *OllamaClient, messages []textMessage) ([]preparedMessage, error) {
+	seen := make(map[string]bool)
+	var candidates []textMessage
 	for _, m := range messages {
-		if m.MessageID == "" {
+		if m.MessageID == "" || seen[m.MessageID] {
 			continue
 		}
-		res, err := msgStmt.Exec(m.MessageID, m.SessionID, m.Role, m.Timestamp.UnixMilli(), m.Text)
+		seen[m.MessageID] = true
+		candidates = append(candidates, m)
+	}
+
+	stored := make(map[string]bool)
+	for start := 0; start < len(candidates); start += multiRowBatch {
+		batch := candidates[start:min(start+multiRowBatch, len(candidates))]
+		args := make([]any, len(batch))
+		for i, m := range batch {
+			args[i] = m.MessageID
+		}
+		rows, err := db.Query(`SELECT id FROM messages WHERE id IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")+`)`, args...)
 		if err != nil {
-			continue
+			return nil, err
 		}
-		if n, _ := res.RowsAffected(); n > 0 {
-			inserted++
-			toEmbed = append(toEmbed, m)
-			// Also insert into FTS if available
-			if ftsStmt != nil {
-				_, _ = ftsStmt.Exec(m.MessageID, m.Role, m.Text)
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
 			}
+			stored[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("commit: %w", err)
+	var prepared []preparedMessage
+	for _, m := range candidates {
+		if stored[m.MessageID] {
+			continue
+		}
+		pm := preparedMessage{message: m, normalized: normalizedVersion(m.Text)}
+		if len(m.Text) >= 10 { // skip very short messages
+			text := m.Text
+			if pm.normalized.Valid {
+				text = pm.normalized.String
+			}
+			embedding, err := ollama.Embed(ctx, text)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			if err == nil {
+				pm.serialized, _ = sqlite_vec.SerializeFloat32(embedding)
+			}
+		}
+		prepared = append(prepared, pm)
 	}
+	return prepared, nil
+}
 
-	// Embed new messages (outside transaction for performance)
-	for _, m := range toEmbed {
-		if len(m.Text) < 10 {
-			continue // skip very short messages
+// storeMessages writes prepared messages, their FTS rows and their vectors inside tx with
+// multi-row inserts, and returns how many messages were new.
+func storeMessages(tx *sql.Tx, prepared []preparedMessage) (int, error) {
+	inserted := 0
+	for start := 0; start < len(prepared); start += multiRowBatch {
+		batch := prepared[start:min(start+multiRowBatch, len(prepared))]
+		msgArgs := make([]any, 0, len(batch)*6)
+		ftsArgs := make([]any, 0, len(batch)*3)
+		var vecArgs []any
+		for _, pm := range batch {
+			m := pm.message
+			msgArgs = append(msgArgs, m.MessageID, m.SessionID, m.Role, m.Timestamp.UnixMilli(), m.Text, pm.normalized)
+			ftsArgs = append(ftsArgs, m.MessageID, m.Role, m.Text)
+			if pm.serialized != nil {
+				vecArgs = append(vecArgs, m.MessageID, pm.serialized)
+			}
 		}
-		embedding, err := ollama.Embed(ctx, m.Text)
+		res, err := tx.Exec(`INSERT OR IGNORE INTO messages (id, session_id, role, timestamp, text, normalized_text) VALUES `+valuesPlaceholders(len(batch), 6), msgArgs...)
 		if err != nil {
-			continue
+			return 0, fmt.Errorf("insert messages: %w", err)
 		}
-		serialized, err := sqlite_vec.SerializeFloat32(embedding)
-		if err != nil {
-			continue
+		n, _ := res.RowsAffected()
+		inserted += int(n)
+		if fts5Available {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO messages_fts (message_id, role, text) VALUES `+valuesPlaceholders(len(batch), 3), ftsArgs...); err != nil {
+				return 0, fmt.Errorf("index messages: %w", err)
+			}
+		}
+		if len(vecArgs) > 0 {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO vec_messages (message_id, embedding) VALUES `+valuesPlaceholders(len(vecArgs)/2, 2), vecArgs...); err != nil {
+				return 0, fmt.Errorf("insert message vectors: %w", err)
+			}
 		}
-		_, _ = db.Exec(`INSERT OR IGNORE INTO vec_messages (message_id, embedding) VALUES (?, ?)`, m.MessageID, serialized)
 	}
-
 	return inserted, nil
 }
 
@@ -280,24 +983,32 @@ type MessageSearchResult struct {
 }
 
 // searchMessages performs semantic search on messages
-func searchMessages(db *sql.DB, ollama *OllamaClient, query string, limit int) ([]MessageSearchResult, error) {
-	ctx := context.Background()
+func searchMessages(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, limit int) ([]MessageSearchResult, error) {
+	defer func(start time.Time) { searchLatency.observe(time.Since(start).Seconds()) }(time.Now())
 	embedding, err := ollama.Embed(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("embed query: %w", err)
 	}
+	return searchMessagesByEmbedding(ctx, db, embedding, limit)
+}
+
+// searchMessagesByEmbedding is searchMessages for a query that is already embedded.
+func searchMessagesByEmbedding(ctx context.Context, db *sql.DB, embedding []float32, limit int) ([]MessageSearchResult, error) {
 	serialized, err := sqlite_vec.SerializeFloat32(embedding)
 	if err != nil {
 		return nil, fmt.Errorf("serialize: %w", err)
 	}
 
-	rows, err := db.Query(`
+	stmt, err := cachedStmt(db, `
 		SELECT vm.message_id, m.session_id, m.role, m.timestamp, m.text, vm.distance
 		FROM vec_messages vm
 		JOIN messages m ON m.id = vm.message_id
 		WHERE vm.embedding MATCH ? AND k = ?
-		ORDER BY vm.distance ASC`,
-		serialized, limit)
+		ORDER BY vm.distance ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	rows, err := stmt.QueryContext(ctx, serialized, limit)
 	if err != nil {
 		return nil, fmt.Errorf("search: %w", err)
 	}
@@ -357,8 +1068,8 @@ func searchMessagesFTS(db *sql.DB, query string, limit int) ([]MessageSearchResu
 }
 
 // searchMessagesWithContext performs semantic search and returns context window
-func searchMessagesWithContext(db *sql.DB, ollama *OllamaClient, query string, limit, contextMinutes int) ([][]contextMessage, error) {
-	results, err := searchMessages(db, ollama, query, limit)
+func searchMessagesWithContext(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, limit, contextMinutes int) ([][]contextMessage, error) {
+	results, err := searchMessages(ctx, db, ollama, query, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -427,7 +1138,7 @@ func readAllSessions(db *sql.DB) ([]sessionMessages, error) {
 		sessMap[cm.SessionID] = append(sessMap[cm.SessionID], textMessage{
 			Role:      cm.Role,
 			Text:      cm.Text,
-			Timestamp: time.UnixMilli(cm.Timestamp),
+			Timestamp: time.UnixMilli(cm.Timestamp).In(mnemeLocation),
 			IsUser:    cm.Role == "Ghaith" || cm.Role == "Max" || cm.Role == "user",
 			MessageID: cm.ID,
 			SessionID: cm.SessionID,
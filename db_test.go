@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+func TestSqliteDSN(t *testing.T) {
+	previous := busyTimeout
+	defer func() { busyTimeout = previous }()
+
+	t.Setenv("MNEME_BUSY_TIMEOUT", "2s")
+	if err := loadBusyTimeout(); err != nil || busyTimeout != 2*time.Second {
+		t.Fatalf("expected 2s, got %v, %v", busyTimeout, err)
+	}
+	t.Setenv("MNEME_BUSY_TIMEOUT", "soon")
+	if err := loadBusyTimeout(); err == nil {
+		t.Fatal("expected an error for a bad duration")
+	}
+
+	if got := sqliteDSN("mneme.db"); got != "mneme.db?_txlock=immediate&_busy_timeout=2000&_foreign_keys=on&_journal_mode=WAL" {
+		t.Fatalf("unexpected DSN %q", got)
+	}
+	if got := sqliteDSN("file:mneme.db?mode=rwc"); got != "file:mneme.db?mode=rwc&_txlock=immediate&_busy_timeout=2000&_foreign_keys=on&_journal_mode=WAL" {
+		t.Fatalf("unexpected DSN %q", got)
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mneme.db")
+	// Two handles on one file stand in for a watcher and an ingest in separate processes
+	var handles []*sql.DB
+	for i := 0; i < 2; i++ {
+		db, err := InitDB(path)
+		if err != nil {
+			t.Fatalf("InitDB: %v", err)
+		}
+		defer db.Close()
+		handles = append(handles, db)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		db := handles[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Read, then write: a deferred transaction would fail upgrading its lock
+			tx, err := db.Begin()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer func() { _ = tx.Rollback() }()
+			var n int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&n); err != nil {
+				errs <- err
+				return
+			}
+			time.Sleep(time.Millisecond)
+			if _, err := tx.Exec(
+				`INSERT INTO chunks (text, source_file, section_title, section_sequence, chunk_sequence, ingested_at) VALUES ('x', 'a.md', 'T', ?, 1, '2025-06-02T00:00:00Z')`,
+				n+1,
+			); err != nil {
+				errs <- err
+				return
+			}
+			errs <- tx.Commit()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent write failed: %v", err)
+		}
+	}
+
+	var count, foreignKeys int
+	handles[1].QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&count)
+	if count != 20 {
+		t.Fatalf("expected 20 chunks, got %d", count)
+	}
+	// Set on every pooled connection, not just the first
+	conns := make([]*sql.Conn, 3)
+	for i := range conns {
+		conn, err := handles[0].Conn(context.Background())
+		if err != nil {
+			t.Fatalf("conn: %v", err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+	for _, conn := range conns {
+		if err := conn.QueryRowContext(context.Background(), `PRAGMA foreign_keys`).Scan(&foreignKeys); err != nil || foreignKeys != 1 {
+			t.Fatalf("expected foreign keys on every connection, got %d, %v", foreignKeys, err)
+		}
+	}
+}
+
+func TestVecChunksValidityMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mneme.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	id := insertChunk(t, db, "old", "a.md", "Old", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1}))
+	// Rewind vec_chunks to its shape before the validity columns, and before versioning
+	for _, stmt := range []string{
+		`DELETE FROM schema_version`,
+		`DROP TRIGGER vec_chunks_validity_au`,
+		`DROP TABLE vec_chunks`,
+		fmt.Sprintf(`CREATE VIRTUAL TABLE vec_chunks USING vec0(chunk_id INTEGER PRIMARY KEY, embedding float[%d] distance_metric=cosine)`, EmbedDimension),
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	blob, _ := sqlite_vec.SerializeFloat32(makeVec(map[int]float32{0: 1}))
+	db.Exec(`INSERT INTO vec_chunks (chunk_id, embedding) VALUES (?, ?)`, id, blob)
+	db.Exec(`UPDATE chunks SET valid_until = '2024-06-01' WHERE id = ?`, id)
+	db.Close()
+
+	if db, err = InitDB(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+	var validAt, validUntil string
+	var embedding []byte
+	if err := db.QueryRow(`SELECT valid_at, valid_until, embedding FROM vec_chunks WHERE chunk_id = ?`, id).Scan(&validAt, &validUntil, &embedding); err != nil {
+		t.Fatalf("read migrated row: %v", err)
+	}
+	if validAt != "2024-01-01" || validUntil != "2024-06-01" || len(embedding) != len(blob) {
+		t.Fatalf("unexpected migrated row: %q, %q, %d bytes", validAt, validUntil, len(embedding))
+	}
+}
+
+func TestVecFactsValidityMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mneme.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	chunk := insertChunk(t, db, "old", "a.md", "Old", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1}))
+	id := insertFact(t, db, chunk, "Alice leads Project Y", "2024-01-01", makeVec(map[int]float32{0: 1}))
+	// Rewind vec_facts to its shape at schema version 5
+	for _, stmt := range []string{
+		`DELETE FROM schema_version WHERE version >= 6`,
+		`DROP TRIGGER vec_facts_validity_au`,
+		`DROP TABLE vec_facts`,
+		fmt.Sprintf(`CREATE VIRTUAL TABLE vec_facts USING vec0(fact_id INTEGER PRIMARY KEY, embedding float[%d] distance_metric=cosine)`, EmbedDimension),
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	blob, _ := sqlite_vec.SerializeFloat32(makeVec(map[int]float32{0: 1}))
+	db.Exec(`INSERT INTO vec_facts (fact_id, embedding) VALUES (?, ?)`, id, blob)
+	db.Exec(`UPDATE facts SET valid_until = '2024-06-01' WHERE id = ?`, id)
+	db.Close()
+
+	if db, err = InitDB(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+	var validAt, validUntil string
+	var embedding []byte
+	if err := db.QueryRow(`SELECT valid_at, valid_until, embedding FROM vec_facts WHERE fact_id = ?`, id).Scan(&validAt, &validUntil, &embedding); err != nil {
+		t.Fatalf("read migrated row: %v", err)
+	}
+	if validAt != "2024-01-01" || validUntil != "2024-06-01" || len(embedding) != len(blob) {
+		t.Fatalf("unexpected migrated row: %q, %q, %d bytes", validAt, validUntil, len(embedding))
+	}
+}
+
+func TestIngestStagingMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mneme.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	// Rewind ingest_staging to the shape older builds created on first use
+	for _, stmt := range []string{
+		`DELETE FROM schema_version WHERE version >= 7`,
+		`DROP TABLE ingest_staging`,
+		`CREATE TABLE ingest_staging (source_file TEXT NOT NULL, content_hash TEXT NOT NULL, dim INTEGER NOT NULL, embedding BLOB NOT NULL, normalized_text TEXT, PRIMARY KEY (source_file, content_hash))`,
+		`INSERT INTO ingest_staging (source_file, content_hash, dim, embedding) VALUES ('a.md', 'h', 768, x'00')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	db.Close()
+
+	if db, err = InitDB(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+	var model string
+	if err := db.QueryRow(`SELECT model FROM ingest_staging WHERE source_file = 'a.md'`).Scan(&model); err != nil || model != "" {
+		t.Fatalf("expected the staged row kept with no model, got %q, %v", model, err)
+	}
+}
+
+func TestWithWriteTxRetriesBusy(t *testing.T) {
+	previousTimeout, previousBackoff := busyTimeout, busyBackoff
+	busyTimeout, busyBackoff = 20*time.Millisecond, 10*time.Millisecond
+	defer func() { busyTimeout, busyBackoff = previousTimeout, previousBackoff }()
+
+	path := filepath.Join(t.TempDir(), "mneme.db")
+	holder, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer holder.Close()
+	writer, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer writer.Close()
+
+	insert := func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO chunks (text, source_file, section_title, section_sequence, chunk_sequence, ingested_at) VALUES ('x', 'b.md', 'T', 1, 1, '2025-06-02T00:00:00Z')`)
+		return err
+	}
+
+	// Held for longer than every retry together: the write gives up with remediation
+	tx, err := holder.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	err = withWriteTx(writer, "store b.md", insert)
+	if !errors.Is(err, errDatabaseBusy) || !strings.Contains(err.Error(), "MNEME_BUSY_TIMEOUT") {
+		t.Fatalf("expected a busy error with remediation, got %v", err)
+	}
+
+	// Released partway through: a retry gets in
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tx.Rollback()
+	}()
+	if err := withWriteTx(writer, "store b.md", insert); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	var count int
+	holder.QueryRow(`SELECT COUNT(*) FROM chunks WHERE source_file = 'b.md'`).Scan(&count)
+	if count != 1 {
+		t.Fatalf("expected one chunk, got %d", count)
+	}
+
+	if err := retryBusy("op", func() error { return errors.New("boom") }); err == nil || errors.Is(err, errDatabaseBusy) {
+		t.Fatalf("expected other errors returned as-is, got %v", err)
+	}
+}
+
+func TestMigrateSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mneme.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	if version, err := schemaVersion(db); err != nil || version != latestSchemaVersion() {
+		t.Fatalf("expected a new database at version %d, got %d, %v", latestSchemaVersion(), version, err)
+	}
+	db.Close()
+
+	applied := 0
+	defer func(orig []migration) { migrations = orig }(migrations)
+	migrations = append(migrations[:len(migrations):len(migrations)], migration{latestSchemaVersion() + 1, "add notes", func(tx *sql.Tx) error {
+		applied++
+		_, err := tx.Exec(`CREATE TABLE notes (id INTEGER PRIMARY KEY)`)
+		return err
+	}})
+	for range 2 {
+		if db, err = InitDB(path); err != nil {
+			t.Fatalf("reopen: %v", err)
+		}
+		db.Close()
+	}
+	if applied != 1 {
+		t.Fatalf("expected the new migration applied once, got %d", applied)
+	}
+
+	migrations = migrations[:len(migrations)-1]
+	if db, err = InitDB(path); err == nil {
+		db.Close()
+		t.Fatal("expected a database from a newer mneme to be refused")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// DecayPolicy sets how fast memories in a namespace fade. A namespace is a source_file
+// prefix ("watch://", "notes/"); the longest matching prefix wins and "" is the default.
+type DecayPolicy struct {
+	Namespace string `json:"namespace"`
+	// HalfLifeDays is how long an unretrieved, unimportant chunk takes to lose half its strength.
+	HalfLifeDays float64 `json:"half_life_days"`
+	// ImportanceWeight (0 to 1) is the share of the score taken from importance instead of age.
+	ImportanceWeight float64 `json:"importance_weight"`
+	// Reinforcement stretches the half-life by this factor per retrieval.
+	Reinforcement float64 `json:"reinforcement"`
+	// ArchiveBelow archives chunks whose score drops under it (0 = never archive).
+	ArchiveBelow float64 `json:"archive_below"`
+}
+
+// defaultDecayPolicy applies when no stored policy matches a chunk.
+var defaultDecayPolicy = DecayPolicy{HalfLifeDays: 90, ImportanceWeight: 0.3, Reinforcement: 0.5}
+
+// unscoredImportance stands in for chunks that haven't been scored by the importance pass.
+const unscoredImportance = 0.5
+
+// DecayResult reports one decay pass.
+type DecayResult struct {
+	ChunksScored int
+	Archived     int
+}
+
+// LoadDecayPolicies returns the stored policies, with the default policy first when
+// none is stored under "".
+func LoadDecayPolicies(db *sql.DB) ([]DecayPolicy, error) {
+	rows, err := db.Query(`SELECT namespace, half_life_days, importance_weight, reinforcement, archive_below
+		FROM decay_policies ORDER BY namespace`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []DecayPolicy{}
+	hasDefault := false
+	for rows.Next() {
+		var p DecayPolicy
+		if err := rows.Scan(&p.Namespace, &p.HalfLifeDays, &p.ImportanceWeight, &p.Reinforcement, &p.ArchiveBelow); err != nil {
+			return nil, err
+		}
+		hasDefault = hasDefault || p.Namespace == ""
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !hasDefault {
+		policies = append([]DecayPolicy{defaultDecayPolicy}, policies...)
+	}
+	return policies, nil
+}
+
+// SetDecayPolicy stores (or replaces) the policy for p.Namespace.
+func SetDecayPolicy(db *sql.DB, p DecayPolicy) error {
+	if p.HalfLifeDays <= 0 {
+		return fmt.Errorf("half-life must be positive, got %v", p.HalfLifeDays)
+	}
+	if p.ImportanceWeight < 0 || p.ImportanceWeight > 1 {
+		return fmt.Errorf("importance weight must be between 0 and 1, got %v", p.ImportanceWeight)
+	}
+	if p.Reinforcement < 0 || p.ArchiveBelow < 0 || p.ArchiveBelow > 1 {
+		return fmt.Errorf("reinforcement must be >= 0 and archive threshold between 0 and 1")
+	}
+	return retryBusy("set decay policy", func() error {
+		_, err := db.Exec(
+			`INSERT OR REPLACE INTO decay_policies (namespace, half_life_days, importance_weight, reinforcement, archive_below)
+			 VALUES (?, ?, ?, ?, ?)`,
+			p.Namespace, p.HalfLifeDays, p.ImportanceWeight, p.Reinforcement, p.ArchiveBelow,
+		)
+		return err
+	})
+}
+
+// DeleteDecayPolicy removes the policy for namespace, returning whether one existed.
+func DeleteDecayPolicy(db *sql.DB, namespace string) (bool, error) {
+	var n int64
+	err := retryBusy("delete decay policy", func() error {
+		res, err := db.Exec(`DELETE FROM decay_policies WHERE namespace = ?`, namespace)
+		if err != nil {
+			return err
+		}
+		n, _ = res.RowsAffected()
+		return nil
+	})
+	return n > 0, err
+}
+
+// policyFor picks the policy with the longest namespace that prefixes sourceFile.
+func policyFor(policies []DecayPolicy, sourceFile string) DecayPolicy {
+	best := defaultDecayPolicy
+	bestLen := -1
+	for _, p := range policies {
+		if strings.HasPrefix(sourceFile, p.Namespace) && len(p.Namespace) > bestLen {
+			best, bestLen = p, len(p.Namespace)
+		}
+	}
+	return best
+}
+
+// decayScore blends strength (exponential decay since the chunk was written or last
+// retrieved, with each retrieval stretching the half-life) and importance, from 0 to 1.
+func decayScore(p DecayPolicy, ageDays float64, importance sql.NullFloat64, retrievals int) float64 {
+	if ageDays < 0 {
+		ageDays = 0
+	}
+	halfLife := p.HalfLifeDays * (1 + p.Reinforcement*float64(retrievals))
+	strength := math.Exp(-math.Ln2 * ageDays / halfLife)
+	imp := unscoredImportance
+	if importance.Valid {
+		imp = importance.Float64
+	}
+	score := (1-p.ImportanceWeight)*strength + p.ImportanceWeight*imp
+	return math.Round(score*1000) / 1000
+}
+
+// decayAnchor is when a chunk's decay clock last started: its last retrieval, else
+// its valid_at date, else when it was ingested.
+func decayAnchor(lastRetrieved, validAt sql.NullString, ingestedAt string) (time.Time, bool) {
+	for _, candidate := range []string{lastRetrieved.String, validAt.String, ingestedAt} {
+		if candidate == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, candidate); err == nil {
+			return t, true
+		}
+		if t, err := time.Parse("2006-01-02", candidate); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// UpdateDecay recomputes the decay score of chunkIDs (every chunk when nil) as of now.
+// With archive, chunks that fall below their policy's threshold are archived, unless pinned.
+func UpdateDecay(db *sql.DB, now time.Time, chunkIDs []int64, archive bool) (DecayResult, error) {
+	var result DecayResult
+	policies, err := LoadDecayPolicies(db)
+	if err != nil {
+		return result, fmt.Errorf("load policies: %w", err)
+	}
+
+	query := `SELECT id, source_file, valid_at, ingested_at, last_retrieved_at, importance, retrieval_count, archived_at, pinned_at FROM chunks`
+	var args []any
+	if chunkIDs != nil {
+		if len(chunkIDs) == 0 {
+			return result, nil
+		}
+		query += ` WHERE id IN (` + strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",") + `)`
+		for _, id := range chunkIDs {
+			args = append(args, id)
+		}
+	}
+
+	type scored struct {
+		id      int64
+		score   float64
+		archive bool
+	}
+	var updates []scored
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var id int64
+		var source, ingestedAt string
+		var validAt, lastRetrieved, archivedAt, pinnedAt sql.NullString
+		var importance sql.NullFloat64
+		var retrievals int
+		if err := rows.Scan(&id, &source, &validAt, &ingestedAt, &lastRetrieved, &importance, &retrievals, &archivedAt, &pinnedAt); err != nil {
+			rows.Close()
+			return result, err
+		}
+		anchor, ok := decayAnchor(lastRetrieved, validAt, ingestedAt)
+		if !ok {
+			continue
+		}
+		p := policyFor(policies, source)
+		score := decayScore(p, now.Sub(anchor).Hours()/24, importance, retrievals)
+		updates = append(updates, scored{
+			id:      id,
+			score:   score,
+			archive: archive && !archivedAt.Valid && !pinnedAt.Valid && p.ArchiveBelow > 0 && score < p.ArchiveBelow,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	archivedAt := now.UTC().Format(time.RFC3339)
+	chunksScored, archived := 0, 0
+	err = withWriteTx(db, "score decay", func(tx *sql.Tx) error {
+		chunksScored, archived = 0, 0
+		for _, u := range updates {
+			if _, err := tx.Exec(`UPDATE chunks SET decay = ? WHERE id = ?`, u.score, u.id); err != nil {
+				return fmt.Errorf("store decay: %w", err)
+			}
+			chunksScored++
+			if u.archive {
+				if _, err := tx.Exec(`UPDATE chunks SET archived_at = ? WHERE id = ?`, archivedAt, u.id); err != nil {
+					return fmt.Errorf("archive chunk %d: %w", u.id, err)
+				}
+				archived++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	result.ChunksScored, result.Archived = chunksScored, archived
+	return result, nil
+}
+
+// RecordRetrieval reinforces chunks that were just returned to a reader: their
+// retrieval count goes up, their decay clock restarts, and archived ones are restored.
+func RecordRetrieval(db *sql.DB, chunkIDs []int64, now time.Time) error {
+	if len(chunkIDs) == 0 {
+		return nil
+	}
+	args := []any{now.UTC().Format(time.RFC3339)}
+	for _, id := range chunkIDs {
+		args = append(args, id)
+	}
+	// Retried apart from the decay update, which retries its own transaction, so a busy
+	// one can't count the retrieval twice
+	if err := retryBusy("record retrieval", func() error {
+		_, err := db.Exec(
+			`UPDATE chunks SET retrieval_count = retrieval_count + 1, last_retrieved_at = ?, archived_at = NULL
+			 WHERE id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")+`)`,
+			args...,
+		)
+		return err
+	}); err != nil {
+		return err
+	}
+	_, err := UpdateDecay(db, now, chunkIDs, false)
+	return err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestDecayScore(t *testing.T) {
+	p := DecayPolicy{HalfLifeDays: 30, ImportanceWeight: 0, Reinforcement: 1}
+	if got := decayScore(p, 0, sql.NullFloat64{}, 0); got != 1 {
+		t.Fatalf("expected a fresh chunk to score 1, got %v", got)
+	}
+	if got := decayScore(p, 30, sql.NullFloat64{}, 0); got != 0.5 {
+		t.Fatalf("expected half strength after one half-life, got %v", got)
+	}
+	if got := decayScore(p, 30, sql.NullFloat64{}, 1); got <= 0.5 {
+		t.Fatalf("expected a retrieval to slow decay, got %v", got)
+	}
+
+	p.ImportanceWeight = 0.5
+	if got := decayScore(p, 3000, sql.NullFloat64{Float64: 1, Valid: true}, 0); got != 0.5 {
+		t.Fatalf("expected importance to hold up an old chunk, got %v", got)
+	}
+	if got := decayScore(p, 3000, sql.NullFloat64{}, 0); got != 0.25 {
+		t.Fatalf("expected unscored chunks to count as importance 0.5, got %v", got)
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	policies := []DecayPolicy{
+		{Namespace: "", HalfLifeDays: 90},
+		{Namespace: "watch://", HalfLifeDays: 30},
+		{Namespace: "watch://work/", HalfLifeDays: 10},
+	}
+	for source, want := range map[string]float64{
+		"notes.md":             90,
+		"watch://abc/batch-0":  30,
+		"watch://work/batch-2": 10,
+		"watch-cc://x/batch-0": 90,
+	} {
+		if got := policyFor(policies, source).HalfLifeDays; got != want {
+			t.Errorf("policyFor(%q) half-life = %v, want %v", source, got, want)
+		}
+	}
+}
+
+func TestUpdateDecayAndRetrieval(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	policies, err := LoadDecayPolicies(db)
+	if err != nil || len(policies) != 1 || policies[0] != defaultDecayPolicy {
+		t.Fatalf("expected only the default policy, got %+v, %v", policies, err)
+	}
+	if err := SetDecayPolicy(db, DecayPolicy{Namespace: "watch://", HalfLifeDays: 10, ArchiveBelow: 0.2}); err != nil {
+		t.Fatalf("SetDecayPolicy: %v", err)
+	}
+	if err := SetDecayPolicy(db, DecayPolicy{Namespace: "bad", HalfLifeDays: 0}); err == nil {
+		t.Fatal("expected a zero half-life to be rejected")
+	}
+
+	stale := insertChunk(t, db, "Old chatter", "watch://s1/batch-0", "Chat", "", 2, "2025-01-01", makeVec(map[int]float32{0: 1, 1: 0.1}))
+	note := insertChunk(t, db, "Old note", "notes.md", "Note", "", 2, "2025-01-01", makeVec(map[int]float32{0: 1, 1: 0.12}))
+
+	now := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	result, err := UpdateDecay(db, now, nil, true)
+	if err != nil {
+		t.Fatalf("UpdateDecay: %v", err)
+	}
+	if result.ChunksScored != 2 || result.Archived != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	var archivedAt sql.NullString
+	var staleDecay, noteDecay float64
+	db.QueryRow(`SELECT decay, archived_at FROM chunks WHERE id = ?`, stale).Scan(&staleDecay, &archivedAt)
+	db.QueryRow(`SELECT decay FROM chunks WHERE id = ?`, note).Scan(&noteDecay)
+	if !archivedAt.Valid || staleDecay >= 0.2 || noteDecay <= staleDecay {
+		t.Fatalf("expected the watch chunk archived and faded more: stale=%v note=%v archived=%v", staleDecay, noteDecay, archivedAt)
+	}
+
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	results, err := SearchWithOptions(context.Background(), db, client, "q", SearchOptions{Limit: 5})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 1 || int64(results[0].ID) != note {
+		t.Fatalf("expected archived chunk hidden, got %+v", results)
+	}
+
+	results, err = SearchWithOptions(context.Background(), db, client, "q", SearchOptions{Limit: 1, IncludeArchived: true, Reinforce: true})
+	if err != nil {
+		t.Fatalf("search archived: %v", err)
+	}
+	if len(results) != 1 || int64(results[0].ID) != stale {
+		t.Fatalf("expected archived chunk with include-archived, got %+v", results)
+	}
+
+	var retrievals int
+	var refreshed float64
+	db.QueryRow(`SELECT retrieval_count, decay, archived_at FROM chunks WHERE id = ?`, stale).Scan(&retrievals, &refreshed, &archivedAt)
+	if retrievals != 1 || archivedAt.Valid || refreshed <= staleDecay {
+		t.Fatalf("expected retrieval to reinforce and restore: count=%d decay=%v archived=%v", retrievals, refreshed, archivedAt)
+	}
+
+	// With decay ranking the fresher note wins despite being slightly farther away
+	if _, err := db.Exec(`UPDATE chunks SET decay = CASE id WHEN ? THEN 0.1 ELSE 1 END`, stale); err != nil {
+		t.Fatalf("set decay: %v", err)
+	}
+	results, err = SearchWithOptions(context.Background(), db, client, "q", SearchOptions{Limit: 1, DecayWeight: 1})
+	if err != nil {
+		t.Fatalf("search with decay weight: %v", err)
+	}
+	if len(results) != 1 || int64(results[0].ID) != note {
+		t.Fatalf("expected the less faded chunk first, got %+v", results)
+	}
+}
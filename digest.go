@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// digestBatchWords caps how much of the day goes to the model in one call; longer
+// days are folded into the digest a batch at a time.
+const digestBatchWords = 3000
+
+// digestSourcePrefix marks chunks written by StoreDigest, so later digests skip them.
+const digestSourcePrefix = "digest://"
+
+const digestUpdatePrompt = `You write a daily digest of someone's notes and conversations.
+You are given the digest so far (possibly empty, under "So far") and more material from the same day, in order.
+Return the updated digest as JSON only, in exactly this shape:
+{"summary": "...", "highlights": ["..."], "decisions": ["..."], "open_questions": ["..."]}
+Rules:
+- summary: two to four sentences on what the day was about.
+- highlights: at most 8 notable things that happened or were learned.
+- decisions: at most 8 things decided or committed to.
+- open_questions: at most 8 unresolved questions or follow-ups. Drop ones the new material resolves.
+- Only use what the digest and material state.`
+
+// DayDigest is the model-written summary of everything recorded on one day.
+type DayDigest struct {
+	Date          string   `json:"date"`
+	Summary       string   `json:"summary"`
+	Highlights    []string `json:"highlights"`
+	Decisions     []string `json:"decisions"`
+	OpenQuestions []string `json:"open_questions"`
+	Chunks        int      `json:"chunks"`
+	Messages      int      `json:"messages"`
+}
+
+type digestBody struct {
+	Summary       string   `json:"summary"`
+	Highlights    []string `json:"highlights"`
+	Decisions     []string `json:"decisions"`
+	OpenQuestions []string `json:"open_questions"`
+}
+
+func parseDigestResponse(raw string) (digestBody, error) {
+	var resp digestBody
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return digestBody{}, err
+	}
+	return digestBody{
+		Summary:       strings.Join(strings.Fields(resp.Summary), " "),
+		Highlights:    cleanProfileLines(resp.Highlights, 8),
+		Decisions:     cleanProfileLines(resp.Decisions, 8),
+		OpenQuestions: cleanProfileLines(resp.OpenQuestions, 8),
+	}, nil
+}
+
+// digestItem is one chunk or message from the day, rendered for the model.
+type digestItem struct {
+	label string
+	text  string
+}
+
+// gatherDay collects the day's chunks (dated that day, or undated and ingested that
+// day) and messages, in order. Messages from sessions a watcher already ingested as
+// chunks are left out, since the batches carry the same text. Stored digests are skipped.
+func gatherDay(db *sql.DB, day time.Time) (chunks, messages []digestItem, err error) {
+	date := day.Format("2006-01-02")
+	rows, err := db.Query(
+		`SELECT source_file, section_title, text FROM chunks
+		 WHERE (valid_at = ? OR (valid_at IS NULL AND local_date(ingested_at) = ?))
+		   AND source_file NOT LIKE ?
+		 ORDER BY ingested_at ASC, source_file ASC, section_sequence ASC, chunk_sequence ASC`,
+		date, date, digestSourcePrefix+"%",
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var source, title, text string
+		if err := rows.Scan(&source, &title, &text); err != nil {
+			return nil, nil, err
+		}
+		chunks = append(chunks, digestItem{label: source + " › " + title, text: text})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	msgRows, err := db.Query(
+		`SELECT m.role, m.timestamp, m.text FROM messages m
+		 WHERE m.timestamp >= ? AND m.timestamp < ?
+		   AND NOT EXISTS (
+		     SELECT 1 FROM chunks c
+		     WHERE c.source_file LIKE 'watch://' || m.session_id || '/%'
+		        OR c.source_file LIKE 'watch-cc://' || m.session_id || '/%')
+		 ORDER BY m.timestamp ASC`,
+		start.UnixMilli(), start.AddDate(0, 0, 1).UnixMilli(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer msgRows.Close()
+	for msgRows.Next() {
+		var role, text string
+		var ts int64
+		if err := msgRows.Scan(&role, &ts, &text); err != nil {
+			return nil, nil, err
+		}
+		label := fmt.Sprintf("%s at %s", role, time.UnixMilli(ts).In(day.Location()).Format("15:04"))
+		messages = append(messages, digestItem{label: label, text: text})
+	}
+	return chunks, messages, msgRows.Err()
+}
+
+// BuildDigest summarizes everything recorded on day. The day's material is folded into
+// the digest in batches of about digestBatchWords words. A day with nothing recorded
+// returns a digest with zero Chunks and Messages and no model call.
+func BuildDigest(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, day time.Time, progress ProgressFunc) (*DayDigest, error) {
+	chunks, messages, err := gatherDay(db, day)
+	if err != nil {
+		return nil, fmt.Errorf("gather day: %w", err)
+	}
+	digest := &DayDigest{
+		Date:          day.Format("2006-01-02"),
+		Highlights:    []string{},
+		Decisions:     []string{},
+		OpenQuestions: []string{},
+		Chunks:        len(chunks),
+		Messages:      len(messages),
+	}
+	items := append(chunks, messages...)
+	if len(items) == 0 {
+		return digest, nil
+	}
+
+	body, err := foldSummary(ctx, ollama, model, digestUpdatePrompt, "Day: "+digest.Date, items, progress)
+	if err != nil {
+		return nil, fmt.Errorf("digest %s: %w", digest.Date, err)
+	}
+	digest.Summary = body.Summary
+	digest.Highlights = body.Highlights
+	digest.Decisions = body.Decisions
+	digest.OpenQuestions = body.OpenQuestions
+	return digest, nil
+}
+
+// foldSummary runs a summary prompt over items in batches of about digestBatchWords
+// words, passing the summary so far with each batch so long inputs fit the model.
+func foldSummary(ctx context.Context, ollama *OllamaClient, model, prompt, heading string, items []digestItem, progress ProgressFunc) (digestBody, error) {
+	var batches [][]digestItem
+	words := 0
+	for _, item := range items {
+		n := len(strings.Fields(item.text))
+		if len(batches) == 0 || (words+n > digestBatchWords && words > 0) {
+			batches = append(batches, nil)
+			words = 0
+		}
+		batches[len(batches)-1] = append(batches[len(batches)-1], item)
+		words += n
+	}
+
+	body := digestBody{Highlights: []string{}, Decisions: []string{}, OpenQuestions: []string{}}
+	for i, batch := range batches {
+		if progress != nil {
+			progress(i, len(batches), batch[0].label)
+		}
+		current, err := json.Marshal(body)
+		if err != nil {
+			return digestBody{}, err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s\n\nSo far:\n%s\n\nMore material:\n", heading, current)
+		for _, item := range batch {
+			fmt.Fprintf(&b, "\n## %s\n%s\n", item.label, item.text)
+		}
+
+		raw, err := ollama.GenerateJSON(ctx, model, prompt, b.String())
+		if err != nil {
+			return digestBody{}, err
+		}
+		if body, err = parseDigestResponse(raw); err != nil {
+			return digestBody{}, err
+		}
+	}
+	if progress != nil {
+		progress(len(batches), len(batches), "")
+	}
+	return body, nil
+}
+
+// RenderDigestMarkdown formats a digest as a single dated section.
+func RenderDigestMarkdown(d *DayDigest) string {
+	title := d.Date
+	if day, err := time.Parse("2006-01-02", d.Date); err == nil {
+		title = day.Format("January 2, 2006")
+	}
+	return renderSummaryMarkdown("Daily digest, "+title, digestBody{d.Summary, d.Highlights, d.Decisions, d.OpenQuestions})
+}
+
+// renderSummaryMarkdown writes a summary as one "## header" section, listing only the
+// parts that have entries.
+func renderSummaryMarkdown(header string, body digestBody) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", header)
+	if body.Summary != "" {
+		b.WriteString(body.Summary + "\n\n")
+	}
+	for _, part := range []struct {
+		label string
+		lines []string
+	}{
+		{"Highlights", body.Highlights},
+		{"Decisions", body.Decisions},
+		{"Open questions", body.OpenQuestions},
+	} {
+		if len(part.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "**%s**\n", part.label)
+		for _, line := range part.lines {
+			b.WriteString("- " + line + "\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// StoreDigest ingests the digest as digest://<date>, replacing an earlier digest of the
+// same day.
+func StoreDigest(ctx context.Context, db *sql.DB, ollama *OllamaClient, d *DayDigest) (string, error) {
+	sourceFile := digestSourcePrefix + d.Date
+	if _, err := ingestMarkdownSource(ctx, db, ollama, sourceFile, RenderDigestMarkdown(d)); err != nil {
+		return "", err
+	}
+	return sourceFile, nil
+}
+
+// WriteDigestFile writes the digest to <dir>/<date>-digest.md and returns the path.
+func WriteDigestFile(dir string, d *DayDigest) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, d.Date+"-digest.md")
+	if err := os.WriteFile(path, []byte(RenderDigestMarkdown(d)), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
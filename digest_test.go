@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildDigest(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			prompts = append(prompts, req.Prompt)
+			answer := `{"summary": "Planned the  auth rollout.", "highlights": ["Auth plan drafted"], "decisions": ["Ship on Friday"], "open_questions": []}`
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		case "/api/embed":
+			vec := make([]float64, EmbedDimension)
+			vec[0] = 1
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	insertChunk(t, db, "Drafted the auth plan.", "notes.md", "Auth", "", 2, "2025-06-01", vec)
+	insertChunk(t, db, "Unrelated day.", "other.md", "Other", "", 2, "2025-06-02", vec)
+	insertChunk(t, db, "Watched batch about auth.", "watch://s1/batch-0", "June 1, 2025", "", 2, "2025-06-01", vec)
+	insertChunk(t, db, "An older digest.", "digest://2025-06-01", "Daily digest", "", 2, "2025-06-01", vec)
+
+	day := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.Local)
+	for i, m := range []struct{ session, text string }{
+		{"s1", "Already in a batch."},
+		{"s2", "Let's ship on Friday."},
+	} {
+		ts := day.Add(time.Duration(10+i) * time.Hour).UnixMilli()
+		if _, err := db.Exec(`INSERT INTO messages (id, session_id, role, timestamp, text) VALUES (?, ?, 'User', ?, ?)`, m.session+"-m", m.session, ts, m.text); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+
+	client := NewOllamaClient(server.URL, "embed")
+	digest, err := BuildDigest(context.Background(), db, client, "gen", day, nil)
+	if err != nil {
+		t.Fatalf("BuildDigest: %v", err)
+	}
+	if digest.Chunks != 2 || digest.Messages != 1 {
+		t.Fatalf("expected 2 chunks and 1 message, got %d and %d", digest.Chunks, digest.Messages)
+	}
+	if len(prompts) != 1 {
+		t.Fatalf("expected one model call, got %d", len(prompts))
+	}
+	for _, want := range []string{"Drafted the auth plan.", "Watched batch about auth.", "Let's ship on Friday."} {
+		if !strings.Contains(prompts[0], want) {
+			t.Fatalf("expected %q in prompt:\n%s", want, prompts[0])
+		}
+	}
+	for _, unwanted := range []string{"Unrelated day.", "An older digest.", "Already in a batch."} {
+		if strings.Contains(prompts[0], unwanted) {
+			t.Fatalf("did not expect %q in prompt:\n%s", unwanted, prompts[0])
+		}
+	}
+	if digest.Summary != "Planned the auth rollout." || len(digest.Decisions) != 1 {
+		t.Fatalf("unexpected digest: %+v", digest)
+	}
+
+	md := RenderDigestMarkdown(digest)
+	if !strings.HasPrefix(md, "## Daily digest, June 1, 2025\n") || strings.Contains(md, "Open questions") {
+		t.Fatalf("unexpected markdown:\n%s", md)
+	}
+
+	sourceFile, err := StoreDigest(context.Background(), db, client, digest)
+	if err != nil {
+		t.Fatalf("StoreDigest: %v", err)
+	}
+	var stored int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE source_file = ?`, sourceFile).Scan(&stored)
+	if sourceFile != "digest://2025-06-01" || stored != 1 {
+		t.Fatalf("expected the stored digest to replace the old one, got %d chunks in %q", stored, sourceFile)
+	}
+
+	path, err := WriteDigestFile(filepath.Join(t.TempDir(), "daily"), digest)
+	if err != nil {
+		t.Fatalf("WriteDigestFile: %v", err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil || string(written) != md || filepath.Base(path) != "2025-06-01-digest.md" {
+		t.Fatalf("unexpected digest file %s: %v", path, err)
+	}
+
+	empty, err := BuildDigest(context.Background(), db, client, "gen", day.AddDate(0, 0, 5), nil)
+	if err != nil || empty.Chunks != 0 || empty.Messages != 0 || len(prompts) != 1 {
+		t.Fatalf("expected an empty day without a model call, got %+v, %v", empty, err)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// disambiguationMargin is how far ahead the best candidate must score before a shared
+// alias is resolved to it; closer calls are recorded as undecided.
+const disambiguationMargin = 0.02
+
+// disambiguationCooccurrenceWeight is added per earlier chunk where a candidate appeared
+// alongside an entity also named in this chunk, up to disambiguationCooccurrenceCap.
+const (
+	disambiguationCooccurrenceWeight = 0.05
+	disambiguationCooccurrenceCap    = 0.5
+)
+
+// disambiguationProfileChunks caps how many of a candidate's chunks are averaged into
+// the embedding the mention's chunk is compared against.
+const disambiguationProfileChunks = 50
+
+// AliasResult reports the entities an alias now refers to and how its mentions resolved.
+type AliasResult struct {
+	Alias     string
+	Entities  []string
+	Resolved  int
+	Undecided int
+}
+
+// sharedNames groups names by lowercase form and returns the distinct entity ids
+// behind each one.
+func sharedNames(entities []entityName) map[string][]int64 {
+	groups := make(map[string][]int64)
+	for _, e := range entities {
+		key := strings.ToLower(strings.TrimSpace(e.name))
+		dup := false
+		for _, id := range groups[key] {
+			if id == e.id {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			groups[key] = append(groups[key], e.id)
+		}
+	}
+	return groups
+}
+
+// entitiesNamed returns every entity whose name or alias is name.
+func entitiesNamed(db *sql.DB, name string) ([]entityName, error) {
+	rows, err := db.Query(
+		`SELECT id, name FROM entities WHERE name = ?
+		 UNION ALL SELECT entity_id, alias FROM entity_aliases WHERE alias = ?`,
+		strings.TrimSpace(name), strings.TrimSpace(name),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []entityName
+	for rows.Next() {
+		var e entityName
+		if err := rows.Scan(&e.id, &e.name); err != nil {
+			return nil, err
+		}
+		names = append(names, e)
+	}
+	return names, rows.Err()
+}
+
+// clearSharedMentions drops earlier links of a shared name in one chunk before it is
+// re-resolved. A candidate keeps its chunk link only if it is still mentioned elsewhere
+// in the chunk (e.g. by full name).
+func clearSharedMentions(tx *sql.Tx, chunkID int64, candidates []int64, mentions [][2]int) error {
+	for _, id := range candidates {
+		for _, m := range mentions {
+			if _, err := tx.Exec(
+				`DELETE FROM entity_mentions WHERE entity_id = ? AND chunk_id = ? AND start_pos = ? AND end_pos = ?`,
+				id, chunkID, m[0], m[1],
+			); err != nil {
+				return fmt.Errorf("clear mention: %w", err)
+			}
+		}
+		var remaining int
+		if err := tx.QueryRow(
+			`SELECT COUNT(*) FROM entity_mentions WHERE entity_id = ? AND chunk_id = ?`, id, chunkID,
+		).Scan(&remaining); err != nil {
+			return err
+		}
+		if remaining == 0 {
+			if _, err := tx.Exec(`DELETE FROM chunk_entities WHERE chunk_id = ? AND entity_id = ?`, chunkID, id); err != nil {
+				return fmt.Errorf("clear link: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSharedMention picks which candidate a shared name refers to in a chunk.
+// A candidate already linked to the chunk (named in full) wins outright. Otherwise each
+// candidate scores the cosine similarity between the chunk's embedding and the mean
+// embedding of its other chunks, plus a bonus for having appeared alongside the
+// chunk's other entities. Returns 0 when no candidate leads by disambiguationMargin.
+func resolveSharedMention(tx *sql.Tx, chunkID int64, candidates []int64) (int64, float64, error) {
+	linked, err := chunkEntityIDs(tx, chunkID)
+	if err != nil {
+		return 0, 0, err
+	}
+	isCandidate := make(map[int64]bool)
+	var named []int64
+	for _, id := range candidates {
+		isCandidate[id] = true
+		if linked[id] {
+			named = append(named, id)
+		}
+	}
+	if len(named) == 1 {
+		return named[0], 1, nil
+	}
+	var context []any
+	for id := range linked {
+		if !isCandidate[id] {
+			context = append(context, id)
+		}
+	}
+
+	chunkVec, err := chunkEmbedding(tx, chunkID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if chunkVec != nil {
+		normalizeVec(chunkVec)
+	}
+
+	var best, second float64
+	var bestID int64
+	for _, id := range candidates {
+		var score float64
+		if len(context) > 0 {
+			placeholders := strings.TrimSuffix(strings.Repeat("?,", len(context)), ",")
+			args := append([]any{id, chunkID}, context...)
+			var shared int
+			if err := tx.QueryRow(fmt.Sprintf(
+				`SELECT COUNT(DISTINCT a.chunk_id) FROM chunk_entities a
+				 JOIN chunk_entities b ON b.chunk_id = a.chunk_id
+				 WHERE a.entity_id = ? AND a.chunk_id != ? AND b.entity_id IN (%s)`, placeholders),
+				args...,
+			).Scan(&shared); err != nil {
+				return 0, 0, err
+			}
+			score += min(float64(shared)*disambiguationCooccurrenceWeight, disambiguationCooccurrenceCap)
+		}
+		if chunkVec != nil {
+			centroid, err := entityCentroid(tx, id, chunkID)
+			if err != nil {
+				return 0, 0, err
+			}
+			if centroid != nil {
+				score += float64(dotVec(chunkVec, centroid))
+			}
+		}
+
+		if bestID == 0 || score > best {
+			bestID, best, second = id, score, best
+		} else if score > second {
+			second = score
+		}
+	}
+	if best <= 0 || best-second < disambiguationMargin {
+		return 0, best, nil
+	}
+	return bestID, best, nil
+}
+
+func chunkEntityIDs(tx *sql.Tx, chunkID int64) (map[int64]bool, error) {
+	rows, err := tx.Query(`SELECT entity_id FROM chunk_entities WHERE chunk_id = ?`, chunkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// chunkEmbedding reads a chunk's stored vector, or nil if it has none.
+func chunkEmbedding(tx *sql.Tx, chunkID int64) ([]float32, error) {
+	var blob []byte
+	err := tx.QueryRow(`SELECT embedding FROM vec_chunks WHERE chunk_id = ?`, chunkID).Scan(&blob)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return deserializeFloat32(blob)
+}
+
+// entityCentroid averages the normalized embeddings of an entity's chunks other than
+// exclude. Returns nil when the entity has no other embedded chunks.
+func entityCentroid(tx *sql.Tx, entityID, exclude int64) ([]float32, error) {
+	rows, err := tx.Query(
+		`SELECT chunk_id FROM chunk_entities WHERE entity_id = ? AND chunk_id != ? ORDER BY chunk_id DESC LIMIT ?`,
+		entityID, exclude, disambiguationProfileChunks,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var chunkIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		chunkIDs = append(chunkIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var centroid []float32
+	for _, id := range chunkIDs {
+		vec, err := chunkEmbedding(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if vec == nil {
+			continue
+		}
+		normalizeVec(vec)
+		if centroid == nil {
+			centroid = make([]float32, len(vec))
+		}
+		for i, v := range vec {
+			centroid[i] += v
+		}
+	}
+	if centroid != nil {
+		normalizeVec(centroid)
+	}
+	return centroid, nil
+}
+
+func recordResolution(tx *sql.Tx, chunkID int64, alias string, entityID int64, score float64) error {
+	var entity any
+	if entityID != 0 {
+		entity = entityID
+	}
+	_, err := tx.Exec(
+		`INSERT OR REPLACE INTO mention_resolutions (chunk_id, alias, entity_id, score, resolved_at) VALUES (?, ?, ?, ?, ?)`,
+		chunkID, strings.TrimSpace(alias), entity, score, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("record resolution: %w", err)
+	}
+	return nil
+}
+
+// AddEntityAlias stores alias as another name for entity and indexes its mentions.
+// An alias may be shared ("Alex" for both Alex Chen and Alex Rivera); each chunk that
+// mentions it is then linked to whichever entity its context points to.
+func AddEntityAlias(db *sql.DB, alias, entity string) (AliasResult, error) {
+	alias = cleanEntityName(alias)
+	result := AliasResult{Alias: alias}
+	if alias == "" {
+		return result, fmt.Errorf("alias is empty")
+	}
+
+	entityID, err := findEntityID(db, entity)
+	if err == sql.ErrNoRows {
+		return result, fmt.Errorf("unknown entity: %s", entity)
+	}
+	if err != nil {
+		return result, err
+	}
+	var existing int64
+	err = db.QueryRow(`SELECT id FROM entities WHERE name = ?`, alias).Scan(&existing)
+	if err == nil {
+		if existing == entityID {
+			return result, fmt.Errorf("%q is already the entity's name", alias)
+		}
+		return result, fmt.Errorf("%q is an entity of its own; merge it instead", alias)
+	}
+	if err != sql.ErrNoRows {
+		return result, err
+	}
+
+	err = retryBusy("store alias", func() error {
+		_, err := db.Exec(`INSERT OR IGNORE INTO entity_aliases (alias, entity_id) VALUES (?, ?)`, alias, entityID)
+		return err
+	})
+	if err != nil {
+		return result, fmt.Errorf("store alias: %w", err)
+	}
+	if err := indexEntityMentions(db, entityName{id: entityID, name: alias}); err != nil {
+		return result, fmt.Errorf("index mentions of %q: %w", alias, err)
+	}
+
+	rows, err := db.Query(
+		`SELECT e.name FROM entity_aliases a JOIN entities e ON e.id = a.entity_id WHERE a.alias = ? ORDER BY e.name`, alias,
+	)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return result, err
+		}
+		result.Entities = append(result.Entities, name)
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	err = db.QueryRow(
+		`SELECT COUNT(entity_id), COUNT(*) - COUNT(entity_id) FROM mention_resolutions WHERE alias = ?`, alias,
+	).Scan(&result.Resolved, &result.Undecided)
+	return result, err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestSharedAliasDisambiguation(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"Alex Chen", "Alex Rivera", "Postgres", "Lisbon"} {
+		if _, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES (?, '', '2025-01-01T00:00:00Z')`, name); err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+	}
+
+	work := makeVec(map[int]float32{0: 1})
+	travel := makeVec(map[int]float32{5: 1})
+	insertChunk(t, db, "Alex Chen migrated the ledger to Postgres.", "a.md", "Ledger", "", 2, "2025-01-01", work)
+	insertChunk(t, db, "Alex Rivera booked the Lisbon trip.", "b.md", "Trip", "", 2, "2025-01-02", travel)
+	cutover := insertChunk(t, db, "Alex finished the cutover.", "c.md", "Cutover", "", 2, "2025-01-03", makeVec(map[int]float32{0: 1, 1: 0.2}))
+	photos := insertChunk(t, db, "Alex sent photos from Lisbon.", "d.md", "Photos", "", 2, "2025-01-04", makeVec(map[int]float32{3: 1}))
+	hello := insertChunk(t, db, "Alex said hi.", "e.md", "Hello", "", 2, "2025-01-05", makeVec(map[int]float32{9: 1}))
+
+	if err := ReindexEntityMentions(db); err != nil {
+		t.Fatalf("ReindexEntityMentions: %v", err)
+	}
+
+	result, err := AddEntityAlias(db, "Alex", "Alex Chen")
+	if err != nil {
+		t.Fatalf("AddEntityAlias: %v", err)
+	}
+	if len(result.Entities) != 1 || !linked(t, db, hello, "Alex Chen") {
+		t.Fatalf("expected a single-entity alias to link every mention, got %+v", result)
+	}
+
+	result, err = AddEntityAlias(db, "Alex", "Alex Rivera")
+	if err != nil {
+		t.Fatalf("AddEntityAlias (shared): %v", err)
+	}
+	if len(result.Entities) != 2 || result.Resolved != 4 || result.Undecided != 1 {
+		t.Fatalf("unexpected alias result: %+v", result)
+	}
+
+	// Embedding similarity decides the cutover, co-occurrence with Lisbon decides the photos
+	if !linked(t, db, cutover, "Alex Chen") || linked(t, db, cutover, "Alex Rivera") {
+		t.Fatal("expected cutover chunk resolved to Alex Chen")
+	}
+	if !linked(t, db, photos, "Alex Rivera") || linked(t, db, photos, "Alex Chen") {
+		t.Fatal("expected photos chunk resolved to Alex Rivera")
+	}
+	// No signal either way: the earlier single-entity link is withdrawn
+	if linked(t, db, hello, "Alex Chen") || linked(t, db, hello, "Alex Rivera") {
+		t.Fatal("expected undecided chunk to stay unlinked")
+	}
+
+	history, err := History(db, "Alex Chen", 10)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 chunks for Alex Chen, got %+v", history)
+	}
+	history, err = History(db, "Alex", 10)
+	if err != nil {
+		t.Fatalf("History (alias): %v", err)
+	}
+	if len(history) != 5 {
+		t.Fatalf("expected every Alex mention for the shared alias, got %d", len(history))
+	}
+
+	if _, err := findEntityID(db, "Alex"); err == nil || err == sql.ErrNoRows {
+		t.Fatalf("expected ambiguity error, got %v", err)
+	}
+	if _, err := AddEntityAlias(db, "Postgres", "Alex Chen"); err == nil {
+		t.Fatal("expected error aliasing an existing entity name")
+	}
+}
+
+func linked(t *testing.T, db *sql.DB, chunkID int64, entity string) bool {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(
+		`SELECT COUNT(*) FROM chunk_entities ce JOIN entities e ON e.id = ce.entity_id WHERE ce.chunk_id = ? AND e.name = ?`,
+		chunkID, entity,
+	).Scan(&n); err != nil {
+		t.Fatalf("query link: %v", err)
+	}
+	return n > 0
+}
+
+func TestInitDBMigratesAliasKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE entities (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE COLLATE NOCASE, kind TEXT NOT NULL DEFAULT '', created_at TEXT NOT NULL)`,
+		`CREATE TABLE entity_aliases (alias TEXT PRIMARY KEY COLLATE NOCASE, entity_id INTEGER NOT NULL REFERENCES entities(id) ON DELETE CASCADE)`,
+		`INSERT INTO entities (id, name, created_at) VALUES (1, 'Alex Chen', 'x'), (2, 'Alex Rivera', 'x')`,
+		`INSERT INTO entity_aliases (alias, entity_id) VALUES ('Alex', 1)`,
+	} {
+		if _, err := legacy.Exec(stmt); err != nil {
+			t.Fatalf("legacy schema: %v", err)
+		}
+	}
+	legacy.Close()
+
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`INSERT INTO entity_aliases (alias, entity_id) VALUES ('Alex', 2)`); err != nil {
+		t.Fatalf("expected shared alias after migration: %v", err)
+	}
+	ids, err := entityIDsForName(db, "alex")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("expected both entities, got %v, %v", ids, err)
+	}
+}
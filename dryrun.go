@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PlannedChunk is a chunk ingesting a source would store, with the tags it would carry.
+type PlannedChunk struct {
+	ChunkData
+	Tags []string
+}
+
+// IngestPlan is what ingesting a source would store, worked out without the database or
+// Ollama: its chunks exactly as they would be embedded. Err is why the source could not
+// be read.
+type IngestPlan struct {
+	Source string
+	Result IngestResult
+	Chunks []PlannedChunk
+	Err    error
+}
+
+// Tokens estimates the tokens embedding the plan's chunks sends the model.
+func (p IngestPlan) Tokens() int {
+	total := 0
+	for _, c := range p.Chunks {
+		total += estimateTokens(c.Text)
+	}
+	return total
+}
+
+// PlanMarkdown chunks markdown read from r as IngestMarkdown would ingest it as sourceFile.
+func PlanMarkdown(sourceFile string, r io.Reader, validAt string, chunking ChunkOptions) IngestPlan {
+	plan := IngestPlan{Source: sourceFile}
+	result, pending, err := chunkMarkdown(sourceFile, r, validAt, chunking)
+	if err != nil {
+		plan.Err = err
+		return plan
+	}
+	plan.Result = result
+	for _, pc := range pending {
+		tags := append([]string{}, pc.tags...)
+		for _, tag := range pc.hashtags {
+			if !containsFold(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		plan.Chunks = append(plan.Chunks, PlannedChunk{ChunkData: pc.chunk, Tags: tags})
+	}
+	return plan
+}
+
+// PlanFiles plans each file as IngestDir (open is OpenIngestFile) or IngestVault (open is
+// openVaultNote) would ingest it, dated as fileValidAt picks.
+func PlanFiles(files []string, validAt string, dateFrom []string, chunking ChunkOptions, open func(string) (io.ReadCloser, error)) []IngestPlan {
+	plans := make([]IngestPlan, 0, len(files))
+	for _, file := range files {
+		fileDate, err := fileValidAt(file, validAt, dateFrom)
+		var r io.ReadCloser
+		if err == nil {
+			r, err = open(file)
+		}
+		if err != nil {
+			plans = append(plans, IngestPlan{Source: file, Err: err})
+			continue
+		}
+		plans = append(plans, PlanMarkdown(file, r, fileDate, chunking))
+		r.Close()
+	}
+	return plans
+}
+
+// printIngestPlans lists every chunk the plans would store, with its size, date and place
+// among its section's chunks, then what embedding them all would take.
+func printIngestPlans(w io.Writer, plans []IngestPlan) {
+	var chunks, sections, subChunks, tokens, failed int
+	for _, plan := range plans {
+		if plan.Err != nil {
+			failed++
+			fmt.Fprintf(w, "\n%s: FAILED: %v\n", plan.Source, plan.Err)
+			continue
+		}
+		fmt.Fprintf(w, "\nChunks of %s:\n", plan.Source)
+		if len(plan.Chunks) == 0 {
+			fmt.Fprintln(w, "  (none)")
+		}
+		for i, c := range plan.Chunks {
+			title := c.SectionTitle
+			if c.ParentTitle != "" {
+				title = c.ParentTitle + " > " + title
+			}
+			split := ""
+			if c.ChunkTotal > 1 {
+				split = fmt.Sprintf(", part %d of %d", c.ChunkSequence, c.ChunkTotal)
+			}
+			validAt := c.ValidAt
+			if validAt == "" {
+				validAt = "none"
+			}
+			fmt.Fprintf(w, "  %d. [%s] %q%s: %d words, ~%d tokens, valid_at %s",
+				i+1, strings.Repeat("#", c.HeaderLevel), title, split, len(strings.Fields(c.Text)), estimateTokens(c.Text), validAt)
+			if len(c.Tags) > 0 {
+				fmt.Fprintf(w, ", tags %s", strings.Join(c.Tags, ", "))
+			}
+			fmt.Fprintln(w)
+			for _, line := range strings.Split(c.Text, "\n") {
+				fmt.Fprintf(w, "     | %s\n", line)
+			}
+		}
+		sections += plan.Result.SectionsFound
+		chunks += len(plan.Chunks)
+		subChunks += plan.Result.SubChunksCreated
+		tokens += plan.Tokens()
+	}
+
+	fmt.Fprintf(w, "\nDry run: %d sections, %d chunks (%d sub-chunks)", sections, chunks, subChunks)
+	if len(plans) > 1 {
+		fmt.Fprintf(w, " from %d of %d files", len(plans)-failed, len(plans))
+	}
+	fmt.Fprintf(w, "\n  Embedding calls: up to %d, ~%d tokens\n", chunks, tokens)
+	fmt.Fprintln(w, "  Chunks whose text is already stored are not embedded again. Nothing was written.")
+}
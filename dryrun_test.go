@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanFiles(t *testing.T) {
+	dir := t.TempDir()
+	note := filepath.Join(dir, "2026-01-21.md")
+	long := strings.TrimSpace(strings.Repeat("One two three four five. ", 3))
+	content := "---\ntags: [ops]\n---\n## Deploy\n\nShip on Fridays.\n\n### Rollback\n\n" + long + "\n\nSee [[Runbook|the runbook]].\n"
+	if err := os.WriteFile(note, []byte(content), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	missing := filepath.Join(dir, "missing.md")
+
+	plans := PlanFiles([]string{note, missing}, "", []string{dateFromFilename}, ChunkOptions{Words: 15}, openVaultNote)
+	if len(plans) != 2 || plans[1].Err == nil {
+		t.Fatalf("expected the missing file to fail on its own, got %+v", plans)
+	}
+	plan := plans[0]
+	if plan.Err != nil || len(plan.Chunks) != 3 || plan.Result.SubChunksCreated != 1 {
+		t.Fatalf("expected 3 chunks, one of them a split, got %+v", plan)
+	}
+	rollback := plan.Chunks[2]
+	if rollback.ParentTitle != "Deploy" || rollback.ChunkSequence != 2 || rollback.ValidAt != "2026-01-21" || rollback.Tags[0] != "ops" {
+		t.Fatalf("unexpected chunk %+v", rollback)
+	}
+	if !strings.Contains(rollback.Text, "See Runbook.") {
+		t.Fatalf("expected the wikilink resolved, got %q", rollback.Text)
+	}
+
+	var out bytes.Buffer
+	printIngestPlans(&out, plans)
+	for _, want := range []string{
+		`3. [###] "Deploy > Rollback", part 2 of 2: 2 words,`,
+		"valid_at 2026-01-21, tags ops",
+		"     | See Runbook.",
+		"missing.md: FAILED",
+		"Dry run: 2 sections, 3 chunks (1 sub-chunks) from 1 of 2 files",
+		"Embedding calls: up to 3,",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in:\n%s", want, out.String())
+		}
+	}
+}
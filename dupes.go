@@ -0,0 +1,315 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultDuplicateThreshold is the cosine similarity at or above which two chunks
+// are reported as near-duplicates.
+const defaultDuplicateThreshold = 0.95
+
+// duplicateNeighbors is how many nearest neighbours are checked per chunk. Larger
+// clusters still form, through chains of pairs.
+const duplicateNeighbors = 8
+
+// DuplicateChunk is one member of a near-duplicate cluster.
+type DuplicateChunk struct {
+	ID           int64  `json:"id"`
+	SourceFile   string `json:"source_file"`
+	SectionTitle string `json:"section_title"`
+	ValidAt      string `json:"valid_at,omitempty"`
+	Words        int    `json:"words"`
+}
+
+// DuplicateCluster is a group of chunks linked by pairs above the threshold. Chunks
+// starts with the suggested keeper; Similarity is the weakest link in the cluster.
+type DuplicateCluster struct {
+	Chunks     []DuplicateChunk `json:"chunks"`
+	Similarity float64          `json:"similarity"`
+}
+
+// nearDuplicateThreshold is the cosine similarity at or above which ingest skips a new
+// chunk as a near-duplicate of one its source family already holds, or
+// MNEME_DEDUP_THRESHOLD; 0 turns the check off.
+var nearDuplicateThreshold = 0.97
+
+func loadNearDuplicateThreshold() error {
+	value := os.Getenv("MNEME_DEDUP_THRESHOLD")
+	if value == "" {
+		return nil
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		return fmt.Errorf("MNEME_DEDUP_THRESHOLD: want a similarity from 0 (off) to 1, got %q", value)
+	}
+	nearDuplicateThreshold = threshold
+	return nil
+}
+
+// sourceFamily is the source_file prefix of the other sources that tend to repeat
+// sourceFile: the batches and summaries of one watched session ("watch://<session>/").
+// It is "" for anything else: notes in one folder or pages of one site are written
+// apart and may well say nearly the same thing on purpose.
+func sourceFamily(sourceFile string) string {
+	if !isWatchSource(sourceFile) {
+		return ""
+	}
+	scheme := strings.Index(sourceFile, "://")
+	if slash := strings.Index(sourceFile[scheme+3:], "/"); slash >= 0 {
+		return sourceFile[:scheme+3+slash+1]
+	}
+	return sourceFile + "/"
+}
+
+// SkippedDuplicate is a new chunk ingest left out, with the stored chunk it nearly repeats.
+type SkippedDuplicate struct {
+	Section     string `json:"section"`
+	KeptID      int64  `json:"kept_id"`
+	KeptSource  string `json:"kept_source"`
+	KeptSection string `json:"kept_section"`
+}
+
+// nearDuplicate returns the stored chunk of sourceFile's family, outside sourceFile itself,
+// whose embedding is the most similar to embedding if that is at least
+// nearDuplicateThreshold, or 0. Only watcher batches have a family; any other source is
+// left to replace its own chunks. Archived chunks don't count: the new one takes their
+// place.
+func nearDuplicate(db *sql.DB, sourceFile string, embedding []byte) (int64, error) {
+	family := sourceFamily(sourceFile)
+	if nearDuplicateThreshold <= 0 || family == "" {
+		return 0, nil
+	}
+	var id int64
+	var distance float64
+	err := db.QueryRow(
+		`SELECT c.id, COALESCE(vec_distance_cosine(v.embedding, ?), 1) AS distance
+		 FROM chunks c JOIN vec_chunks v ON v.chunk_id = c.id
+		 WHERE substr(c.source_file, 1, ?) = ? AND c.source_file != ? AND c.archived_at IS NULL
+		 ORDER BY distance LIMIT 1`,
+		embedding, utf8.RuneCountInString(family), family, sourceFile,
+	).Scan(&id, &distance)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("find near-duplicates: %w", err)
+	}
+	if 1-distance < nearDuplicateThreshold {
+		return 0, nil
+	}
+	return id, nil
+}
+
+// isWatchSource reports whether sourceFile is a watcher batch or summary, which usually
+// repeats something a hand-ingested transcript also holds.
+func isWatchSource(sourceFile string) bool {
+	scheme, _, ok := strings.Cut(sourceFile, "://")
+	return ok && (scheme == "watch" || strings.HasPrefix(scheme, "watch-"))
+}
+
+// preferKeeper orders chunks so the one to keep comes first: hand-ingested over watch
+// batches, then the longest, then the oldest.
+func preferKeeper(chunks []DuplicateChunk) {
+	sort.SliceStable(chunks, func(i, j int) bool {
+		a, b := chunks[i], chunks[j]
+		if wa, wb := isWatchSource(a.SourceFile), isWatchSource(b.SourceFile); wa != wb {
+			return !wa
+		}
+		if a.Words != b.Words {
+			return a.Words > b.Words
+		}
+		return a.ID < b.ID
+	})
+}
+
+// FindDuplicates groups chunks whose stored embeddings are at least threshold similar
+// (cosine), largest and closest clusters first. No embedding calls are made.
+func FindDuplicates(db *sql.DB, threshold float64, progress ProgressFunc) ([]DuplicateCluster, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, fmt.Errorf("threshold must be between 0 and 1, got %v", threshold)
+	}
+
+	// Resolved before the KNN queries so these rows aren't held open
+	rows, err := db.Query(`SELECT chunk_id FROM vec_chunks ORDER BY chunk_id`)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	parent := make(map[int64]int64)
+	var find func(int64) int64
+	find = func(id int64) int64 {
+		p, ok := parent[id]
+		if !ok || p == id {
+			parent[id] = id
+			return id
+		}
+		root := find(p)
+		parent[id] = root
+		return root
+	}
+	weakest := make(map[int64]float64)
+
+	maxDistance := 1 - threshold
+	for i, id := range ids {
+		if progress != nil {
+			progress(i, len(ids), "")
+		}
+		var embedding []byte
+		if err := db.QueryRow(`SELECT embedding FROM vec_chunks WHERE chunk_id = ?`, id).Scan(&embedding); err != nil {
+			return nil, fmt.Errorf("load embedding %d: %w", id, err)
+		}
+		neighbors, err := db.Query(
+			`SELECT chunk_id, distance FROM vec_chunks WHERE embedding MATCH ? AND k = ? ORDER BY distance`,
+			embedding, duplicateNeighbors+1,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("neighbours of %d: %w", id, err)
+		}
+		for neighbors.Next() {
+			var other int64
+			var distance float64
+			if err := neighbors.Scan(&other, &distance); err != nil {
+				neighbors.Close()
+				return nil, err
+			}
+			if other == id || distance > maxDistance {
+				continue
+			}
+			similarity := 1 - distance
+			a, b := find(id), find(other)
+			if a != b {
+				parent[b] = a
+				w, okA := weakest[a]
+				if wb, okB := weakest[b]; okB && (!okA || wb < w) {
+					w, okA = wb, true
+				}
+				if !okA || similarity < w {
+					w = similarity
+				}
+				weakest[a] = w
+				delete(weakest, b)
+			} else if w, ok := weakest[a]; !ok || similarity < w {
+				weakest[a] = similarity
+			}
+		}
+		neighbors.Close()
+		if err := neighbors.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if progress != nil && len(ids) > 0 {
+		progress(len(ids), len(ids), "")
+	}
+
+	members := make(map[int64][]int64)
+	for id := range parent {
+		root := find(id)
+		members[root] = append(members[root], id)
+	}
+
+	var clusters []DuplicateCluster
+	for root, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		cluster := DuplicateCluster{Similarity: weakest[root]}
+		for _, id := range group {
+			var c DuplicateChunk
+			var validAt sql.NullString
+			var text string
+			if err := db.QueryRow(`SELECT id, source_file, section_title, valid_at, text FROM chunks WHERE id = ?`, id).
+				Scan(&c.ID, &c.SourceFile, &c.SectionTitle, &validAt, &text); err != nil {
+				return nil, fmt.Errorf("load chunk %d: %w", id, err)
+			}
+			c.ValidAt = validAt.String
+			c.Words = len(strings.Fields(text))
+			cluster.Chunks = append(cluster.Chunks, c)
+		}
+		preferKeeper(cluster.Chunks)
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Chunks) != len(clusters[j].Chunks) {
+			return len(clusters[i].Chunks) > len(clusters[j].Chunks)
+		}
+		if clusters[i].Similarity != clusters[j].Similarity {
+			return clusters[i].Similarity > clusters[j].Similarity
+		}
+		return clusters[i].Chunks[0].ID < clusters[j].Chunks[0].ID
+	})
+	return clusters, nil
+}
+
+// MergeChunks folds duplicates into keep and deletes them: their tags, entity links,
+// relations and facts move to keep (unless keep already has them), keep takes the
+// highest importance and the summed retrieval count, and chunks they superseded now
+// point at keep.
+func MergeChunks(db *sql.DB, keep int64, duplicates []int64) (int, error) {
+	var deleted int
+	err := withWriteTx(db, "merge chunks", func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM chunks WHERE id = ?`, keep).Scan(&exists); err != nil {
+			return err
+		}
+		if exists == 0 {
+			return fmt.Errorf("chunk %d not found", keep)
+		}
+
+		var drop []int64
+		for _, id := range duplicates {
+			if id == keep {
+				continue
+			}
+			drop = append(drop, id)
+			steps := []struct {
+				what  string
+				query string
+			}{
+				{"tags", `INSERT OR IGNORE INTO chunk_tags (chunk_id, tag, source, created_at)
+					SELECT ?, tag, source, created_at FROM chunk_tags WHERE chunk_id = ?`},
+				{"entities", `INSERT OR IGNORE INTO chunk_entities (chunk_id, entity_id)
+					SELECT ?, entity_id FROM chunk_entities WHERE chunk_id = ?`},
+				{"relations", `UPDATE OR IGNORE relations SET chunk_id = ? WHERE chunk_id = ?`},
+				{"facts", `UPDATE OR IGNORE facts SET chunk_id = ? WHERE chunk_id = ?`},
+				{"importance", `UPDATE chunks SET
+					importance = MAX(COALESCE(importance, -1), COALESCE((SELECT importance FROM chunks WHERE id = ?2), -1)),
+					retrieval_count = retrieval_count + (SELECT retrieval_count FROM chunks WHERE id = ?2)
+					WHERE id = ?1 AND EXISTS (SELECT 1 FROM chunks WHERE id = ?2)`},
+				{"supersessions", `UPDATE chunks SET superseded_by = ?1 WHERE superseded_by = ?2 AND id != ?1`},
+			}
+			for _, step := range steps {
+				if _, err := tx.Exec(step.query, keep, id); err != nil {
+					return fmt.Errorf("move %s from %d: %w", step.what, id, err)
+				}
+			}
+		}
+		// MAX over a NULL importance leaves -1 behind; restore unscored
+		if _, err := tx.Exec(`UPDATE chunks SET importance = NULL WHERE id = ? AND importance < 0`, keep); err != nil {
+			return fmt.Errorf("restore importance: %w", err)
+		}
+
+		var err error
+		deleted, err = deleteChunksTx(tx, drop)
+		return err
+	})
+	return deleted, err
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPreferKeeper(t *testing.T) {
+	chunks := []DuplicateChunk{
+		{ID: 1, SourceFile: "watch://s1/batch-0", Words: 500},
+		{ID: 2, SourceFile: "notes.md", Words: 40},
+		{ID: 3, SourceFile: "chat.md", Words: 40},
+		{ID: 4, SourceFile: "chat.md", Words: 90},
+	}
+	preferKeeper(chunks)
+	for i, want := range []int64{4, 2, 3, 1} {
+		if chunks[i].ID != want {
+			t.Fatalf("position %d: got #%d, want #%d (%+v)", i, chunks[i].ID, want, chunks)
+		}
+	}
+}
+
+func TestFindAndMergeDuplicates(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	batch := insertChunk(t, db, "We picked Postgres.", "watch://s1/batch-0", "Chat", "", 2, "2025-06-03", makeVec(map[int]float32{0: 1, 1: 0.01}))
+	note := insertChunk(t, db, "We picked Postgres for auth.", "chat.md", "Chat", "", 2, "2025-06-03", makeVec(map[int]float32{0: 1}))
+	summary := insertChunk(t, db, "Picked Postgres.", "watch://s1/summary-0", "Summary", "", 2, "2025-06-03", makeVec(map[int]float32{0: 1, 1: 0.02}))
+	insertChunk(t, db, "Sleep notes.", "sleep.md", "Sleep", "", 2, "2025-06-03", makeVec(map[int]float32{1: 1}))
+
+	if _, err := FindDuplicates(db, 0, nil); err == nil {
+		t.Fatal("expected a zero threshold to be rejected")
+	}
+	clusters, err := FindDuplicates(db, 0.99, nil)
+	if err != nil {
+		t.Fatalf("FindDuplicates: %v", err)
+	}
+	if len(clusters) != 1 || len(clusters[0].Chunks) != 3 || clusters[0].Chunks[0].ID != note {
+		t.Fatalf("expected one cluster of three kept by the hand-ingested chunk, got %+v", clusters)
+	}
+	if s := clusters[0].Similarity; s < 0.99 || s >= 1 {
+		t.Fatalf("unexpected weakest similarity %v", s)
+	}
+
+	// State on the duplicates that should survive the merge
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if _, err := addChunkTag(tx, batch, "databases", tagSourceTopic); err != nil {
+		t.Fatalf("tag: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	res, err := db.Exec(`INSERT INTO entities (name, created_at) VALUES ('Postgres', '2025-06-03')`)
+	if err != nil {
+		t.Fatalf("insert entity: %v", err)
+	}
+	entityID, _ := res.LastInsertId()
+	db.Exec(`INSERT INTO chunk_entities (chunk_id, entity_id) VALUES (?, ?)`, summary, entityID)
+	db.Exec(`UPDATE chunks SET importance = 0.8, retrieval_count = 2 WHERE id = ?`, batch)
+	db.Exec(`UPDATE chunks SET retrieval_count = 1 WHERE id = ?`, note)
+
+	if _, err := MergeChunks(db, 999, []int64{batch}); err == nil {
+		t.Fatal("expected merging into a missing chunk to fail")
+	}
+	merged, err := MergeChunks(db, note, []int64{batch, summary, note})
+	if err != nil {
+		t.Fatalf("MergeChunks: %v", err)
+	}
+	if merged != 2 {
+		t.Fatalf("expected 2 chunks merged, got %d", merged)
+	}
+
+	var remaining, vectors, tags, links, retrievals int
+	var importance sql.NullFloat64
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE id IN (?, ?)`, batch, summary).Scan(&remaining)
+	db.QueryRow(`SELECT COUNT(*) FROM vec_chunks WHERE chunk_id IN (?, ?)`, batch, summary).Scan(&vectors)
+	db.QueryRow(`SELECT COUNT(*) FROM chunk_tags WHERE chunk_id = ? AND tag = 'databases'`, note).Scan(&tags)
+	db.QueryRow(`SELECT COUNT(*) FROM chunk_entities WHERE chunk_id = ?`, note).Scan(&links)
+	db.QueryRow(`SELECT importance, retrieval_count FROM chunks WHERE id = ?`, note).Scan(&importance, &retrievals)
+	if remaining != 0 || vectors != 0 {
+		t.Fatalf("expected duplicates and their vectors gone, got %d chunks, %d vectors", remaining, vectors)
+	}
+	if tags != 1 || links != 1 || importance.Float64 != 0.8 || retrievals != 3 {
+		t.Fatalf("expected state folded into the keeper: tags=%d links=%d importance=%v retrievals=%d", tags, links, importance, retrievals)
+	}
+
+	if clusters, err := FindDuplicates(db, 0.99, nil); err != nil || len(clusters) != 0 {
+		t.Fatalf("expected no duplicates left, got %+v, %v", clusters, err)
+	}
+}
+
+func TestMergeChunksKeepsUnscoredImportance(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	keep := insertChunk(t, db, "A", "a.md", "A", "", 2, "", vec)
+	dup := insertChunk(t, db, "A", "b.md", "A", "", 2, "", vec)
+	if _, err := MergeChunks(db, keep, []int64{dup}); err != nil {
+		t.Fatalf("MergeChunks: %v", err)
+	}
+	var importance sql.NullFloat64
+	db.QueryRow(`SELECT importance FROM chunks WHERE id = ?`, keep).Scan(&importance)
+	if importance.Valid {
+		t.Fatalf("expected the keeper to stay unscored, got %v", importance.Float64)
+	}
+}
+
+// withNearDuplicateThreshold sets the threshold ingest skips near-duplicates at for the
+// rest of the test; 0 stores them all.
+func withNearDuplicateThreshold(t *testing.T, threshold float64) {
+	t.Helper()
+	previous := nearDuplicateThreshold
+	nearDuplicateThreshold = threshold
+	t.Cleanup(func() { nearDuplicateThreshold = previous })
+}
+
+func TestSourceFamily(t *testing.T) {
+	for source, want := range map[string]string{
+		"watch://s1/batch-3":           "watch://s1/",
+		"watch-cc://abc/summary-1":     "watch-cc://abc/",
+		"watch-cursor://c9/batch-1":    "watch-cursor://c9/",
+		"https://go.dev/doc/effective": "",
+		"/home/ada/notes/daily/a.md":   "",
+		"a.md":                         "",
+	} {
+		if got := sourceFamily(source); got != want {
+			t.Fatalf("sourceFamily(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
+
+func TestIngestSkipsNearDuplicates(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	// Chunks about Redis embed alike, however they are worded
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		vec := makeVec(map[int]float32{0: 1, 1: 0.1})
+		if strings.Contains(req.Input, "Redis") {
+			vec = makeVec(map[int]float32{0: 0.1, 1: 1})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float32{vec}})
+	}))
+	defer server.Close()
+	ollama := NewOllamaClient(server.URL, "embed")
+
+	ingest := func(source, md string) IngestResult {
+		t.Helper()
+		result, err := IngestMarkdown(context.Background(), db, ollama, source, strings.NewReader(md), "", defaultChunking, nil)
+		if err != nil {
+			t.Fatalf("IngestMarkdown %s: %v", source, err)
+		}
+		return result
+	}
+	ingest("watch://s1/batch-1", "## Auth\n\nTokens live in Redis.\n")
+	copied := ingest("watch://s1/batch-2", "## Auth again\n\nTokens live in Redis!\n\n## Deploy\n\nShip on Fridays.\n")
+	ingest("watch://s2/batch-1", "## Auth\n\nTokens still live in Redis.\n")
+	ingest("notes/monday.md", "## Auth\n\nTokens live in Redis.\n")
+	ingest("notes/tuesday.md", "## Auth\n\nTokens live in Redis, as Monday said.\n")
+
+	var stored int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&stored)
+	if stored != 5 {
+		t.Fatalf("expected only the repeat in the same session skipped, got %d chunks", stored)
+	}
+	if len(copied.Duplicates) != 1 {
+		t.Fatalf("expected the skipped chunk reported, got %+v", copied)
+	}
+	if d := copied.Duplicates[0]; d.Section != "Auth again" || d.KeptSource != "watch://s1/batch-1" || d.KeptSection != "Auth" || d.KeptID == 0 {
+		t.Fatalf("expected the skip reported with the chunk it repeats, got %+v", d)
+	}
+
+	// Ingesting it again unchanged finds the skip recorded, without embedding anything
+	requests.Store(0)
+	md := "## Auth again\n\nTokens live in Redis!\n\n## Deploy\n\nShip on Fridays.\n"
+	if result := ingest("watch://s1/batch-2", md); result.ChunksUnchanged != 2 || requests.Load() != 0 {
+		t.Fatalf("expected an unchanged source, got %+v, %d requests", result, requests.Load())
+	}
+
+	// Edited elsewhere, the duplicate is skipped and counted again
+	result := ingest("watch://s1/batch-2", strings.Replace(md, "Fridays", "Thursdays", 1))
+	if result.DuplicatesSkipped != 1 || len(result.ChunkIDs) != 1 || result.DeletedChunks != 1 {
+		t.Fatalf("expected one duplicate skipped and the edit stored, got %+v", result)
+	}
+
+	withNearDuplicateThreshold(t, 0)
+	if result = ingest("watch://s1/batch-2", strings.Replace(md, "Fridays", "Wednesdays", 1)); len(result.ChunkIDs) != 2 {
+		t.Fatalf("expected both chunks stored with the check off, got %+v", result)
+	}
+}
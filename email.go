@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Digest email periods.
+const (
+	emailDaily  = "daily"
+	emailWeekly = "weekly"
+)
+
+// emailDigestMemories caps the new memories an email lists; the rest are counted.
+const emailDigestMemories = 25
+
+// smtpConfig is where digest emails are sent from and to, read from MNEME_SMTP_*.
+type smtpConfig struct {
+	Addr     string // host:port
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+// smtpConfigFromEnv reads MNEME_SMTP_ADDR, MNEME_SMTP_USER, MNEME_SMTP_PASSWORD,
+// MNEME_SMTP_FROM and MNEME_SMTP_TO (comma-separated). From defaults to the user.
+func smtpConfigFromEnv() (smtpConfig, error) {
+	cfg := smtpConfig{
+		Addr:     os.Getenv("MNEME_SMTP_ADDR"),
+		User:     os.Getenv("MNEME_SMTP_USER"),
+		Password: os.Getenv("MNEME_SMTP_PASSWORD"),
+		From:     os.Getenv("MNEME_SMTP_FROM"),
+	}
+	for _, to := range strings.Split(os.Getenv("MNEME_SMTP_TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			cfg.To = append(cfg.To, to)
+		}
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.User
+	}
+	switch {
+	case cfg.Addr == "":
+		return cfg, errors.New("MNEME_SMTP_ADDR is not set (e.g. smtp.example.com:587)")
+	case len(cfg.To) == 0:
+		return cfg, errors.New("MNEME_SMTP_TO is not set")
+	case cfg.From == "":
+		return cfg, errors.New("MNEME_SMTP_FROM (or MNEME_SMTP_USER) is not set")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return cfg, fmt.Errorf("MNEME_SMTP_ADDR: %w", err)
+	}
+	return cfg, nil
+}
+
+// DigestMemory is a section ingested during the emailed period.
+type DigestMemory struct {
+	SourceFile string
+	Title      string
+	Chunks     int
+}
+
+// MemoryDigest is what a digest email reports: what was captured during the period, the
+// summaries written about it, and what happened on this day in earlier years.
+type MemoryDigest struct {
+	Period        string
+	Start         string
+	End           string
+	Memories      []DigestMemory
+	MoreMemories  int
+	Summaries     []ReviewSummary
+	Recollections []Recollection
+}
+
+// Empty reports whether there is nothing worth sending.
+func (d *MemoryDigest) Empty() bool {
+	return len(d.Memories) == 0 && len(d.Summaries) == 0 && len(d.Recollections) == 0
+}
+
+// digestPeriod returns the first and last day an email sent at now covers: yesterday,
+// or the seven days up to yesterday.
+func digestPeriod(period string, now time.Time) (start, end time.Time) {
+	end = now.AddDate(0, 0, -1)
+	if period == emailWeekly {
+		return end.AddDate(0, 0, -6), end
+	}
+	return end, end
+}
+
+// BuildMemoryDigest gathers the digest of period for an email sent at now. It makes no
+// model calls: summaries are the ones digest, consolidate and the watchers stored.
+func BuildMemoryDigest(db *sql.DB, period string, now time.Time) (*MemoryDigest, error) {
+	now = now.In(mnemeLocation)
+	first, last := digestPeriod(period, now)
+	d := &MemoryDigest{Period: period, Start: first.Format(dateLayout), End: last.Format(dateLayout)}
+
+	query := `SELECT source_file, section_title, COUNT(*) FROM chunks
+		 WHERE local_date(ingested_at) BETWEEN ? AND ?`
+	args := []any{d.Start, d.End}
+	for _, pattern := range generatedSourcePatterns {
+		query += ` AND source_file NOT LIKE ?`
+		args = append(args, pattern)
+	}
+	query += ` GROUP BY source_file, section_title ORDER BY MIN(ingested_at), MIN(id)`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("load memories: %w", err)
+	}
+	for rows.Next() {
+		var m DigestMemory
+		if err := rows.Scan(&m.SourceFile, &m.Title, &m.Chunks); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(d.Memories) == emailDigestMemories {
+			d.MoreMemories++
+			continue
+		}
+		d.Memories = append(d.Memories, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT source_file, section_title, text FROM chunks WHERE local_date(ingested_at) BETWEEN ? AND ? AND (`
+	args = []any{d.Start, d.End}
+	for i, pattern := range generatedSourcePatterns {
+		if i > 0 {
+			query += ` OR `
+		}
+		query += `source_file LIKE ?`
+		args = append(args, pattern)
+	}
+	query += `) ORDER BY ingested_at, source_file, section_sequence, chunk_sequence`
+	if rows, err = db.Query(query, args...); err != nil {
+		return nil, fmt.Errorf("load summaries: %w", err)
+	}
+	for rows.Next() {
+		var s ReviewSummary
+		if err := rows.Scan(&s.SourceFile, &s.Label, &s.Text); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// A long summary is stored as several chunks of one source
+		if n := len(d.Summaries); n > 0 && d.Summaries[n-1].SourceFile == s.SourceFile {
+			continue
+		}
+		if s.Text = summaryParagraph(s.Text); s.Text != "" {
+			d.Summaries = append(d.Summaries, s)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if d.Recollections, err = OnThisDay(db, now, nil, 5); err != nil {
+		return nil, fmt.Errorf("load on this day: %w", err)
+	}
+	return d, nil
+}
+
+// RenderDigestEmail renders the digest as the plain-text body of an email.
+func RenderDigestEmail(d *MemoryDigest) string {
+	var b strings.Builder
+	start, _ := time.Parse(dateLayout, d.Start)
+	end, _ := time.Parse(dateLayout, d.End)
+	if d.Start == d.End {
+		fmt.Fprintf(&b, "Your memories from %s.\n\n", start.Format("Monday, January 2, 2006"))
+	} else {
+		fmt.Fprintf(&b, "Your memories from %s to %s.\n\n", start.Format("Monday, January 2"), end.Format("Monday, January 2, 2006"))
+	}
+
+	if len(d.Summaries) > 0 {
+		b.WriteString("SUMMARIES\n\n")
+		for _, s := range d.Summaries {
+			fmt.Fprintf(&b, "%s\n%s\n\n", s.Label, s.Text)
+		}
+	}
+	if len(d.Memories) > 0 {
+		b.WriteString("NEW MEMORIES\n\n")
+		for _, m := range d.Memories {
+			fmt.Fprintf(&b, "- %s (%s)\n", m.Title, m.SourceFile)
+		}
+		if d.MoreMemories > 0 {
+			fmt.Fprintf(&b, "- and %d more\n", d.MoreMemories)
+		}
+		b.WriteString("\n")
+	}
+	if len(d.Recollections) > 0 {
+		b.WriteString("ON THIS DAY\n\n")
+		for _, r := range d.Recollections {
+			ago := "1 year ago"
+			if r.YearsAgo != 1 {
+				ago = fmt.Sprintf("%d years ago", r.YearsAgo)
+			}
+			fmt.Fprintf(&b, "%s, %s\n%s\n\n", ago, r.SectionTitle, reviewQuote(r.Text))
+		}
+	}
+	if d.Empty() {
+		b.WriteString("Nothing new was captured.\n")
+	}
+	return b.String()
+}
+
+// digestSubject is the subject line of a digest email.
+func digestSubject(d *MemoryDigest) string {
+	end, _ := time.Parse(dateLayout, d.End)
+	if d.Period == emailWeekly {
+		return "mneme weekly digest, week ending " + end.Format("January 2")
+	}
+	return "mneme daily digest, " + end.Format("Monday, January 2")
+}
+
+// sendMail sends a composed message; tests replace it.
+var sendMail = smtp.SendMail
+
+// SendDigestEmail emails the digest to every configured recipient.
+func SendDigestEmail(cfg smtpConfig, d *MemoryDigest) error {
+	host, _, _ := net.SplitHostPort(cfg.Addr)
+	var auth smtp.Auth
+	if cfg.User != "" {
+		auth = smtp.PlainAuth("", cfg.User, cfg.Password, host)
+	}
+	return sendMail(cfg.Addr, auth, cfg.From, cfg.To, composeEmail(cfg, digestSubject(d), RenderDigestEmail(d), time.Now()))
+}
+
+// composeEmail builds a plain-text UTF-8 message with CRLF line endings.
+func composeEmail(cfg smtpConfig, subject, body string, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// nextDigestTime is when the next email is due after now: the next at (HH:MM) for daily
+// emails, and the next Monday at it for weekly ones.
+func nextDigestTime(period string, at time.Duration, now time.Time) time.Time {
+	now = now.In(mnemeLocation)
+	for day := 0; ; day++ {
+		// Built from the wall clock so a DST change does not shift it
+		next := time.Date(now.Year(), now.Month(), now.Day()+day, 0, int(at.Minutes()), 0, 0, mnemeLocation)
+		if next.After(now) && (period != emailWeekly || next.Weekday() == time.Monday) {
+			return next
+		}
+	}
+}
+
+// parseClock reads an HH:MM time of day.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("want HH:MM, got %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ScheduleDigestEmails emails a digest at every due time until ctx is done. A failed
+// email is logged and the schedule carries on.
+func ScheduleDigestEmails(ctx context.Context, db *sql.DB, cfg smtpConfig, period string, at time.Duration) {
+	for {
+		next := nextDigestTime(period, at, time.Now())
+		fmt.Printf("Next %s digest at %s\n", period, next.Format("Mon Jan 2 15:04"))
+		if !sleepContext(ctx, time.Until(next)) {
+			return
+		}
+		d, err := BuildMemoryDigest(db, period, time.Now())
+		if err != nil {
+			log.Printf("Warning: digest email: %v", err)
+			continue
+		}
+		if d.Empty() {
+			fmt.Println(renderPreflightStep("ok", "Nothing to email"))
+			continue
+		}
+		if err := SendDigestEmail(cfg, d); err != nil {
+			log.Printf("Warning: send digest email: %v", err)
+			continue
+		}
+		fmt.Println(renderPreflightStep("ok", "Emailed "+digestSubject(d)))
+	}
+}
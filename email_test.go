@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMemoryDigest(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	// Chunks are ingested now, so the email is the one sent tomorrow
+	tomorrow := time.Now().In(mnemeLocation).AddDate(0, 0, 1)
+	vec := makeVec(map[int]float32{0: 1})
+	first := insertChunk(t, db, "Moved the retry budget to three.", "notes.md", "Retries", "", 2, "", vec)
+	db.Exec(`UPDATE chunks SET chunk_sequence = 2 WHERE id = ?`, first)
+	insertChunk(t, db, "More on retries.", "notes.md", "Retries", "", 2, "", vec)
+	insertChunk(t, db, "Mostly retries.\n\n**Decisions**\n- Three attempts\n", digestSourcePrefix+"2025-06-03", "Digest, June 3, 2025", "", 2, "2025-06-03", vec)
+	insertChunk(t, db, "Started the garden.", "journal.md", "Garden", "", 2, tomorrow.AddDate(-2, 0, 0).Format(dateLayout), vec)
+
+	d, err := BuildMemoryDigest(db, emailDaily, tomorrow)
+	if err != nil {
+		t.Fatalf("BuildMemoryDigest: %v", err)
+	}
+	if d.Start != d.End || d.End != time.Now().In(mnemeLocation).Format(dateLayout) {
+		t.Fatalf("expected the email to cover today, got %s to %s", d.Start, d.End)
+	}
+	if len(d.Memories) != 2 || d.Memories[0].Title != "Retries" || d.Memories[0].Chunks != 2 {
+		t.Fatalf("expected memories grouped by section without the digest, got %+v", d.Memories)
+	}
+	if len(d.Summaries) != 1 || d.Summaries[0].Text != "Mostly retries." {
+		t.Fatalf("expected the stored digest as a summary, got %+v", d.Summaries)
+	}
+	if len(d.Recollections) != 1 || d.Recollections[0].YearsAgo != 2 {
+		t.Fatalf("expected the garden two years ago, got %+v", d.Recollections)
+	}
+
+	body := RenderDigestEmail(d)
+	for _, want := range []string{"SUMMARIES\n\nDigest, June 3, 2025\nMostly retries.", "- Retries (notes.md)", "2 years ago, Garden\nStarted the garden."} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in\n%s", want, body)
+		}
+	}
+
+	if d, err = BuildMemoryDigest(db, emailWeekly, tomorrow.AddDate(0, 0, 8)); err != nil || len(d.Memories) != 0 {
+		t.Fatalf("expected nothing new a week later, got %+v, %v", d, err)
+	}
+}
+
+func TestNextDigestTime(t *testing.T) {
+	withLocation(t, time.UTC)
+	at := 7*time.Hour + 30*time.Minute
+	wednesday := time.Date(2025, 6, 4, 8, 0, 0, 0, time.UTC)
+	if got := nextDigestTime(emailDaily, at, wednesday); !got.Equal(time.Date(2025, 6, 5, 7, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected tomorrow morning, got %v", got)
+	}
+	if got := nextDigestTime(emailDaily, at, wednesday.Add(-time.Hour)); !got.Equal(time.Date(2025, 6, 4, 7, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected later today, got %v", got)
+	}
+	if got := nextDigestTime(emailWeekly, at, wednesday); !got.Equal(time.Date(2025, 6, 9, 7, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected next Monday, got %v", got)
+	}
+	if _, err := parseClock("7pm"); err == nil {
+		t.Fatal("expected an error for a time that is not HH:MM")
+	}
+}
+
+func TestSendDigestEmail(t *testing.T) {
+	t.Setenv("MNEME_SMTP_ADDR", "smtp.example.com:587")
+	t.Setenv("MNEME_SMTP_USER", "me@example.com")
+	t.Setenv("MNEME_SMTP_PASSWORD", "secret")
+	t.Setenv("MNEME_SMTP_FROM", "")
+	t.Setenv("MNEME_SMTP_TO", "me@example.com, you@example.com")
+	cfg, err := smtpConfigFromEnv()
+	if err != nil {
+		t.Fatalf("smtpConfigFromEnv: %v", err)
+	}
+
+	var addr, from string
+	var to []string
+	var msg []byte
+	defer func(orig func(string, smtp.Auth, string, []string, []byte) error) { sendMail = orig }(sendMail)
+	sendMail = func(a string, auth smtp.Auth, f string, t []string, m []byte) error {
+		addr, from, to, msg = a, f, t, m
+		return nil
+	}
+
+	d := &MemoryDigest{Period: emailWeekly, Start: "2025-06-02", End: "2025-06-08", Memories: []DigestMemory{{SourceFile: "notes.md", Title: "Retries"}}}
+	if err := SendDigestEmail(cfg, d); err != nil {
+		t.Fatalf("SendDigestEmail: %v", err)
+	}
+	if addr != "smtp.example.com:587" || from != "me@example.com" || len(to) != 2 {
+		t.Fatalf("unexpected envelope %s, %s, %v", addr, from, to)
+	}
+	for _, want := range []string{"Subject: mneme weekly digest, week ending June 8\r\n", "To: me@example.com, you@example.com\r\n", "\r\n\r\nYour memories from Monday, June 2 to Sunday, June 8, 2025.\r\n", "- Retries (notes.md)\r\n"} {
+		if !strings.Contains(string(msg), want) {
+			t.Fatalf("expected %q in\n%s", want, msg)
+		}
+	}
+
+	t.Setenv("MNEME_SMTP_TO", "")
+	if _, err := smtpConfigFromEnv(); err == nil {
+		t.Fatal("expected an error without recipients")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+// embedConcurrency is how many embedding requests ingest keeps in flight at once, or
+// MNEME_EMBED_CONCURRENCY. Ollama answers them together up to its OLLAMA_NUM_PARALLEL
+// and queues the rest, so more only helps a server set to run more.
+var embedConcurrency = 4
+
+func loadEmbedConcurrency() error {
+	value := os.Getenv("MNEME_EMBED_CONCURRENCY")
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return fmt.Errorf("MNEME_EMBED_CONCURRENCY: want a number from 1, got %q", value)
+	}
+	embedConcurrency = n
+	return nil
+}
+
+// WithConcurrency returns a copy of the client that ingest embeds with n requests in
+// flight at once.
+func (c *OllamaClient) WithConcurrency(n int) *OllamaClient {
+	copied := *c
+	copied.concurrency = n
+	return &copied
+}
+
+// embedChunks embeds the pending chunks at indexes on the client's concurrency workers,
+// storing each embedding (and the normalized text it was made from) in its own slot, so
+// the chunks keep their order however the requests finish. Progress is reported from the
+// calling goroutine as each one completes. The first failure cancels the rest.
+//
+// stage, when not nil, is handed the finished chunks every checkpointEvery, and the rest
+// of them on failure, so an interrupted run loses at most that many embeddings.
+func embedChunks(ctx context.Context, ollama *OllamaClient, pending []ingestPreparedChunk, indexes []int, progress ProgressFunc, stage func(done []int) error) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	workers := ollama.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	workers = min(workers, len(indexes))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan int)
+	type outcome struct {
+		index int
+		err   error
+	}
+	done := make(chan outcome)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				done <- outcome{i, embedChunk(ctx, ollama, &pending[i])}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, i := range indexes {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	if progress != nil {
+		progress(0, len(indexes), pending[indexes[0]].chunk.SectionTitle)
+	}
+	var firstErr error
+	var finished []int
+	completed := 0
+	for o := range done {
+		if o.err != nil {
+			if firstErr == nil {
+				firstErr = o.err
+				cancel()
+			}
+			continue
+		}
+		completed++
+		finished = append(finished, o.index)
+		if firstErr != nil {
+			continue
+		}
+		if progress != nil {
+			progress(completed, len(indexes), pending[o.index].chunk.SectionTitle)
+		}
+		if stage != nil && len(finished) >= checkpointEvery {
+			if err := stage(finished); err != nil {
+				firstErr = err
+				cancel()
+			}
+			finished = nil
+		}
+	}
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil && stage != nil && len(finished) > 0 {
+		if err := stage(finished); err != nil {
+			return fmt.Errorf("%w (saving the finished embeddings failed too: %v)", firstErr, err)
+		}
+	}
+	return firstErr
+}
+
+// embedChunk embeds one chunk, normalizing its text first to fix typos for better
+// search; the chunk keeps the text as written.
+func embedChunk(ctx context.Context, ollama *OllamaClient, pc *ingestPreparedChunk) error {
+	pc.normalized = normalizedVersion(pc.chunk.Text)
+	text := pc.chunk.Text
+	if pc.normalized.Valid {
+		text = pc.normalized.String
+	}
+	embedding, err := ollama.Embed(ctx, text)
+	if err != nil {
+		return err
+	}
+	pc.serialized, err = sqlite_vec.SerializeFloat32(embedding)
+	return err
+}
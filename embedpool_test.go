@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+func TestEmbedChunksConcurrently(t *testing.T) {
+	// Each embedding says which chunk it was made from, and answers take a while so
+	// requests overlap
+	var inFlight, most atomic.Int32
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		mu.Lock()
+		most.Store(max(most.Load(), n))
+		mu.Unlock()
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req.Input, "broken") {
+			http.Error(w, "model crashed", http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float32{makeVec(map[int]float32{len(req.Input): 1})}})
+	}))
+	defer server.Close()
+	ollama := NewOllamaClient(server.URL, "embed").WithConcurrency(3)
+
+	var pending []ingestPreparedChunk
+	var indexes []int
+	for i := range 7 {
+		pending = append(pending, ingestPreparedChunk{chunk: ChunkData{Text: strings.Repeat("x", i+1), SectionTitle: "S"}})
+		indexes = append(indexes, i)
+	}
+	var reported []int
+	err := embedChunks(context.Background(), ollama, pending, indexes, func(done, total int, _ string) {
+		reported = append(reported, done)
+	}, nil)
+	if err != nil {
+		t.Fatalf("embedChunks: %v", err)
+	}
+	if got := most.Load(); got != 3 {
+		t.Fatalf("expected 3 requests in flight at most, got %d", got)
+	}
+	for i, pc := range pending {
+		want, _ := sqlite_vec.SerializeFloat32(makeVec(map[int]float32{i + 1: 1}))
+		if string(pc.serialized) != string(want) {
+			t.Fatalf("expected chunk %d to hold its own embedding", i)
+		}
+	}
+	if len(reported) != 8 || reported[7] != 7 {
+		t.Fatalf("expected progress from 0 to 7, got %v", reported)
+	}
+
+	// One failure fails the lot
+	pending[4].chunk.Text = "broken"
+	if err := embedChunks(context.Background(), ollama, pending, indexes, nil, nil); err == nil {
+		t.Fatal("expected the failed embedding reported")
+	}
+}
+
+func TestLoadEmbedConcurrency(t *testing.T) {
+	previous := embedConcurrency
+	defer func() { embedConcurrency = previous }()
+
+	t.Setenv("MNEME_EMBED_CONCURRENCY", "8")
+	if err := loadEmbedConcurrency(); err != nil || embedConcurrency != 8 {
+		t.Fatalf("expected 8, got %d, %v", embedConcurrency, err)
+	}
+	if NewOllamaClient("http://localhost", "embed").concurrency != 8 {
+		t.Fatal("expected new clients to embed 8 at once")
+	}
+	t.Setenv("MNEME_EMBED_CONCURRENCY", "0")
+	if err := loadEmbedConcurrency(); err == nil {
+		t.Fatal("expected 0 rejected")
+	}
+}
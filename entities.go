@@ -0,0 +1,824 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	entityKindPerson  = "person"
+	entityKindProject = "project"
+	entityKindPlace   = "place"
+	entityKindTool    = "tool"
+)
+
+// entityKinds are the types an entity can carry.
+var entityKinds = []string{entityKindPerson, entityKindProject, entityKindPlace, entityKindTool}
+
+// normalizeEntityKind maps user input ("People", "tools") to a known kind.
+func normalizeEntityKind(kind string) (string, error) {
+	k := strings.ToLower(strings.TrimSpace(kind))
+	if k == "people" {
+		return entityKindPerson, nil
+	}
+	k = strings.TrimSuffix(k, "s")
+	for _, known := range entityKinds {
+		if k == known {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("unknown entity type %q (want one of %s)", kind, strings.Join(entityKinds, ", "))
+}
+
+// extractionKindEntities marks chunks in chunk_extractions once the entity pass has run.
+const extractionKindEntities = "entities"
+
+const entityExtractionPrompt = `You extract named entities from personal notes and conversation transcripts.
+Return JSON only, in exactly this shape:
+{"people": ["..."], "projects": ["..."], "places": ["..."], "tools": ["..."]}
+Rules:
+- Tools are named software, languages, services, libraries or devices (e.g. "Postgres", "Go", "Figma").
+- Only include entities that are explicitly named in the text. No pronouns, no generic nouns.
+- Use the most complete form of each name that appears in the text.
+- Use empty arrays when nothing applies.`
+
+// ExtractedEntity is a named entity found in a chunk by the generate model.
+type ExtractedEntity struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+type entityExtractionResponse struct {
+	People   []string `json:"people"`
+	Projects []string `json:"projects"`
+	Places   []string `json:"places"`
+	Tools    []string `json:"tools"`
+}
+
+type EntityExtractionResult struct {
+	ChunksProcessed int
+	EntitiesFound   int
+	LinksCreated    int
+}
+
+// extractEntitiesLLM asks the generate model for the people, projects, places and tools named in text.
+func extractEntitiesLLM(ctx context.Context, ollama *OllamaClient, model, text string) ([]ExtractedEntity, error) {
+	raw, err := ollama.GenerateJSON(ctx, model, entityExtractionPrompt, text)
+	if err != nil {
+		return nil, err
+	}
+	return parseEntityResponse(raw)
+}
+
+// parseEntityResponse decodes the model's JSON answer, tolerating surrounding prose.
+func parseEntityResponse(raw string) ([]ExtractedEntity, error) {
+	var resp entityExtractionResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var entities []ExtractedEntity
+	add := func(names []string, kind string) {
+		for _, name := range names {
+			name = cleanEntityName(name)
+			key := strings.ToLower(name)
+			if name == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			entities = append(entities, ExtractedEntity{Name: name, Kind: kind})
+		}
+	}
+	add(resp.People, entityKindPerson)
+	add(resp.Projects, entityKindProject)
+	add(resp.Places, entityKindPlace)
+	add(resp.Tools, entityKindTool)
+
+	return entities, nil
+}
+
+// errBadModelResponse is returned when the generate model's answer cannot be parsed.
+var errBadModelResponse = errors.New("unparseable model response")
+
+// decodeModelJSON unmarshals the first JSON object in raw. Small models often wrap
+// JSON in code fences or a sentence even when asked not to.
+func decodeModelJSON(raw string, v any) error {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("%w: no JSON object", errBadModelResponse)
+	}
+	if err := json.Unmarshal([]byte(raw[start:end+1]), v); err != nil {
+		return fmt.Errorf("%w: %v", errBadModelResponse, err)
+	}
+	return nil
+}
+
+func cleanEntityName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	name = strings.Trim(name, ` "'.,;:()[]`)
+	if len([]rune(name)) < 2 {
+		return ""
+	}
+	return name
+}
+
+// upsertEntity returns the id of the entity called name, creating it if needed
+// (created reports whether it did). An existing entity keeps its kind unless it has none yet.
+func upsertEntity(tx *sql.Tx, name, kind string) (id int64, created bool, err error) {
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.Exec(`INSERT OR IGNORE INTO entities (name, kind, created_at) VALUES (?, ?, ?)`, name, kind, createdAt)
+	if err != nil {
+		return 0, false, fmt.Errorf("insert entity: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		created = true
+	}
+	if kind != "" {
+		if _, err := tx.Exec(`UPDATE entities SET kind = ? WHERE name = ? AND kind = ''`, kind, name); err != nil {
+			return 0, false, fmt.Errorf("update entity kind: %w", err)
+		}
+	}
+	if err := tx.QueryRow(`SELECT id FROM entities WHERE name = ?`, name).Scan(&id); err != nil {
+		return 0, false, fmt.Errorf("lookup entity: %w", err)
+	}
+	return id, created, nil
+}
+
+// pendingExtractionChunks returns ids of chunks that have not been through the given
+// extraction pass yet, optionally limited to one source file.
+func pendingExtractionChunks(db *sql.DB, kind, sourceFile string) ([]int64, error) {
+	query := `SELECT id FROM chunks
+		WHERE id NOT IN (SELECT chunk_id FROM chunk_extractions WHERE kind = ?)`
+	args := []any{kind}
+	if sourceFile != "" {
+		query += ` AND source_file = ?`
+		args = append(args, sourceFile)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func markExtracted(tx *sql.Tx, chunkID int64, kind string) error {
+	_, err := tx.Exec(
+		`INSERT OR REPLACE INTO chunk_extractions (chunk_id, kind, extracted_at) VALUES (?, ?, ?)`,
+		chunkID, kind, time.Now().UTC().Format(time.RFC3339),
+	)
+	return err
+}
+
+// ExtractEntities runs the LLM entity pass over the given chunks and links the
+// results into entities/chunk_entities. Chunks whose response cannot be parsed
+// are skipped (and retried on the next run); transport errors abort the pass.
+func ExtractEntities(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, chunkIDs []int64, progress ProgressFunc) (EntityExtractionResult, error) {
+	var result EntityExtractionResult
+	seenEntities := make(map[int64]bool)
+	var newEntities []entityName
+
+	for i, chunkID := range chunkIDs {
+		var text, title string
+		if err := db.QueryRow(`SELECT text, section_title FROM chunks WHERE id = ?`, chunkID).Scan(&text, &title); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return result, fmt.Errorf("read chunk %d: %w", chunkID, err)
+		}
+		if progress != nil {
+			progress(i, len(chunkIDs), title)
+		}
+
+		entities, err := extractEntitiesLLM(ctx, ollama, model, text)
+		if err != nil {
+			if errors.Is(err, errBadModelResponse) {
+				log.Printf("entity extraction: skipping chunk %d: %v", chunkID, err)
+				continue
+			}
+			return result, fmt.Errorf("extract entities from chunk %d: %w", chunkID, err)
+		}
+
+		var created []entityName
+		var linked []int64
+		links := 0
+		err = withWriteTx(db, "extract entities", func(tx *sql.Tx) error {
+			created, linked, links = created[:0], linked[:0], 0
+			for _, e := range entities {
+				entityID, isNew, err := upsertEntity(tx, e.Name, e.Kind)
+				if err != nil {
+					return err
+				}
+				if isNew {
+					created = append(created, entityName{id: entityID, name: e.Name})
+				}
+				res, err := tx.Exec(`INSERT OR IGNORE INTO chunk_entities (chunk_id, entity_id) VALUES (?, ?)`, chunkID, entityID)
+				if err != nil {
+					return fmt.Errorf("link entity: %w", err)
+				}
+				if n, _ := res.RowsAffected(); n > 0 {
+					links++
+				}
+				linked = append(linked, entityID)
+			}
+			if err := markExtracted(tx, chunkID, extractionKindEntities); err != nil {
+				return fmt.Errorf("mark extracted: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		newEntities = append(newEntities, created...)
+		result.LinksCreated += links
+		for _, entityID := range linked {
+			if !seenEntities[entityID] {
+				seenEntities[entityID] = true
+				result.EntitiesFound++
+			}
+		}
+		result.ChunksProcessed++
+	}
+	if progress != nil && len(chunkIDs) > 0 {
+		progress(len(chunkIDs), len(chunkIDs), "")
+	}
+
+	// New entities may be mentioned in chunks that were ingested before they existed
+	for _, e := range newEntities {
+		if err := indexEntityMentions(db, e); err != nil {
+			return result, fmt.Errorf("index mentions of %q: %w", e.name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// ============ Mention Index ============
+
+type entityName struct {
+	id   int64
+	name string
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// findMentions returns the byte ranges where name occurs in text as a whole word,
+// case-insensitively. "Go" matches "Go," and "(go)" but not "going" or "Google".
+func findMentions(text, name string) [][2]int {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > len(text) {
+		return nil
+	}
+
+	var mentions [][2]int
+	for start := 0; start+len(name) <= len(text); {
+		idx := indexFold(text[start:], name)
+		if idx < 0 {
+			break
+		}
+		begin := start + idx
+		end := begin + len(name)
+
+		before, _ := utf8.DecodeLastRuneInString(text[:begin])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (begin == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after)) {
+			mentions = append(mentions, [2]int{begin, end})
+		}
+
+		_, size := utf8.DecodeRuneInString(text[begin:])
+		start = begin + size
+	}
+	return mentions
+}
+
+// indexFold is a case-insensitive strings.Index that keeps byte offsets into s.
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return -1
+}
+
+// loadEntityNames returns every name the mention index should look for:
+// canonical entity names plus stored aliases.
+func loadEntityNames(db *sql.DB) ([]entityName, error) {
+	rows, err := db.Query(`SELECT id, name FROM entities UNION ALL SELECT entity_id, alias FROM entity_aliases`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []entityName
+	for rows.Next() {
+		var e entityName
+		if err := rows.Scan(&e.id, &e.name); err != nil {
+			return nil, err
+		}
+		names = append(names, e)
+	}
+	return names, rows.Err()
+}
+
+// linkEntityMentions records where each entity occurs in one chunk and links
+// chunk_entities for every entity that occurs at least once. Names shared by several
+// entities are resolved to one of them from the chunk's context.
+func linkEntityMentions(tx *sql.Tx, chunkID int64, text string, entities []entityName) error {
+	shared := sharedNames(entities)
+	resolved := make(map[string]bool)
+	var ambiguous []entityName
+	for _, e := range entities {
+		key := strings.ToLower(strings.TrimSpace(e.name))
+		if len(shared[key]) > 1 {
+			if !resolved[key] {
+				resolved[key] = true
+				ambiguous = append(ambiguous, e)
+			}
+			continue
+		}
+		if err := linkMentions(tx, chunkID, e.id, findMentions(text, e.name)); err != nil {
+			return err
+		}
+	}
+
+	// Resolve shared names last so the unambiguous links above count as context
+	for _, e := range ambiguous {
+		mentions := findMentions(text, e.name)
+		if len(mentions) == 0 {
+			continue
+		}
+		candidates := shared[strings.ToLower(strings.TrimSpace(e.name))]
+		if err := clearSharedMentions(tx, chunkID, candidates, mentions); err != nil {
+			return err
+		}
+		entityID, score, err := resolveSharedMention(tx, chunkID, candidates)
+		if err != nil {
+			return fmt.Errorf("resolve %q: %w", e.name, err)
+		}
+		if err := recordResolution(tx, chunkID, e.name, entityID, score); err != nil {
+			return err
+		}
+		if entityID != 0 {
+			if err := linkMentions(tx, chunkID, entityID, mentions); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func linkMentions(tx *sql.Tx, chunkID, entityID int64, mentions [][2]int) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO chunk_entities (chunk_id, entity_id) VALUES (?, ?)`, chunkID, entityID); err != nil {
+		return fmt.Errorf("link entity: %w", err)
+	}
+	for _, m := range mentions {
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO entity_mentions (entity_id, chunk_id, start_pos, end_pos) VALUES (?, ?, ?, ?)`,
+			entityID, chunkID, m[0], m[1],
+		); err != nil {
+			return fmt.Errorf("insert mention: %w", err)
+		}
+	}
+	return nil
+}
+
+// IndexChunkMentions links every known entity mentioned in the given chunks.
+// Called after ingest so new chunks join the entity index immediately.
+func IndexChunkMentions(db *sql.DB, chunkIDs []int64) error {
+	if len(chunkIDs) == 0 {
+		return nil
+	}
+	entities, err := loadEntityNames(db)
+	if err != nil {
+		return fmt.Errorf("load entities: %w", err)
+	}
+	if len(entities) == 0 {
+		return nil
+	}
+
+	return withWriteTx(db, "index mentions", func(tx *sql.Tx) error {
+		return indexChunkMentionsTx(tx, chunkIDs, entities)
+	})
+}
+
+// indexChunkMentionsTx is IndexChunkMentions inside the caller's transaction, with the
+// entity names already loaded.
+func indexChunkMentionsTx(tx *sql.Tx, chunkIDs []int64, entities []entityName) error {
+	for _, chunkID := range chunkIDs {
+		var text string
+		if err := tx.QueryRow(`SELECT text FROM chunks WHERE id = ?`, chunkID).Scan(&text); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return fmt.Errorf("read chunk %d: %w", chunkID, err)
+		}
+		if err := linkEntityMentions(tx, chunkID, text, entities); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexEntityMentions scans every chunk for one entity name. LIKE narrows the candidates,
+// findMentions enforces word boundaries. If other entities share the name, the whole
+// group is indexed together so each mention is resolved to one of them.
+func indexEntityMentions(db *sql.DB, entity entityName) error {
+	group, err := entitiesNamed(db, entity.name)
+	if err != nil {
+		return err
+	}
+	if len(group) == 0 {
+		group = []entityName{entity}
+	}
+
+	rows, err := db.Query(
+		`SELECT id, text FROM chunks WHERE text LIKE ? ESCAPE '\' COLLATE NOCASE`,
+		"%"+escapeLike(entity.name)+"%",
+	)
+	if err != nil {
+		return err
+	}
+	type candidate struct {
+		id   int64
+		text string
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.text); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return withWriteTx(db, "index mentions", func(tx *sql.Tx) error {
+		for _, c := range candidates {
+			if err := linkEntityMentions(tx, c.id, c.text, group); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// chunksMentioning returns the ids of chunks that may mention any of names, in id order,
+// found in one pass: the chunks_fts word index with FTS5, a LIKE scan for names with no
+// word characters or without it. linkEntityMentions checks word boundaries after.
+func chunksMentioning(db *sql.DB, names []string) ([]int64, error) {
+	var conditions, phrases []string
+	var args []any
+	for _, name := range names {
+		if fts5Available && strings.IndexFunc(name, isWordRune) >= 0 {
+			phrases = append(phrases, ftsPhrase(name))
+			continue
+		}
+		conditions = append(conditions, "text LIKE ? ESCAPE '\\' COLLATE NOCASE")
+		args = append(args, "%"+escapeLike(name)+"%")
+	}
+	if len(phrases) > 0 {
+		conditions = append(conditions, "id IN (SELECT rowid FROM chunks_fts WHERE chunks_fts MATCH ?)")
+		args = append(args, strings.Join(phrases, " OR "))
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`SELECT id FROM chunks WHERE (`+strings.Join(conditions, " OR ")+`) ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// reindexBatchSize is how many chunks ReindexEntityMentions links per transaction.
+const reindexBatchSize = 500
+
+// ReindexEntityMentions rebuilds the mention index for every known entity and alias,
+// re-resolving shared aliases against the current context. The chunks are read once,
+// each matched against all names, in batches so writers elsewhere are not held off. Each
+// batch's old mentions are cleared in the transaction that relinks them, so a failure
+// part way leaves every chunk indexed either the old way or the new one.
+func ReindexEntityMentions(db *sql.DB) error {
+	entities, err := loadEntityNames(db)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT id FROM chunks ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	var chunkIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		chunkIDs = append(chunkIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(chunkIDs); start += reindexBatchSize {
+		batch := chunkIDs[start:min(start+reindexBatchSize, len(chunkIDs))]
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		err := withWriteTx(db, "reindex mentions", func(tx *sql.Tx) error {
+			for _, table := range []string{"entity_mentions", "mention_resolutions"} {
+				if _, err := tx.Exec(`DELETE FROM `+table+` WHERE chunk_id IN (`+placeholders+`)`, args...); err != nil {
+					return err
+				}
+			}
+			return indexChunkMentionsTx(tx, batch, entities)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============ Types ============
+
+// EntitySummary is one row of ListEntities.
+type EntitySummary struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind,omitempty"`
+	Chunks    int    `json:"chunks"`
+	FirstSeen string `json:"first_seen,omitempty"`
+	LastSeen  string `json:"last_seen,omitempty"`
+}
+
+// SetEntityType sets the type of the entity called name (or one of its stored aliases),
+// overriding whatever extraction assigned.
+func SetEntityType(db *sql.DB, name, kind string) error {
+	kind, err := normalizeEntityKind(kind)
+	if err != nil {
+		return err
+	}
+	id, err := findEntityID(db, name)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("unknown entity: %s", name)
+	}
+	if err != nil {
+		return err
+	}
+	return retryBusy("set entity type", func() error {
+		_, err := db.Exec(`UPDATE entities SET kind = ? WHERE id = ?`, kind, id)
+		return err
+	})
+}
+
+// ListEntities returns entities with how many chunks mention them, most mentioned first.
+// kind filters by type; since/until (YYYY-MM-DD, inclusive) count only chunks dated in
+// that range and drop entities with none. If limit <= 0, defaults to 50.
+func ListEntities(db *sql.DB, kind, since, until string, limit int) ([]EntitySummary, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	since, err := NormalizeDate(since)
+	if err != nil {
+		return nil, fmt.Errorf("since: %w", err)
+	}
+	if until, err = NormalizeDate(until); err != nil {
+		return nil, fmt.Errorf("until: %w", err)
+	}
+
+	var chunkFilter []string
+	var args []any
+	if since != "" {
+		chunkFilter = append(chunkFilter, "c.valid_at >= ?")
+		args = append(args, since)
+	}
+	if until != "" {
+		// Inclusive of the whole day even when valid_at carries a time
+		chunkFilter = append(chunkFilter, "c.valid_at < date(?, '+1 day')")
+		args = append(args, until)
+	}
+	join := "LEFT JOIN"
+	on := ""
+	if len(chunkFilter) > 0 {
+		join = "JOIN"
+		on = " AND " + strings.Join(chunkFilter, " AND ")
+	}
+
+	query := fmt.Sprintf(
+		`SELECT e.name, e.kind, COUNT(c.id), MIN(c.valid_at), MAX(c.valid_at)
+		 FROM entities e
+		 LEFT JOIN chunk_entities ce ON ce.entity_id = e.id
+		 %s chunks c ON c.id = ce.chunk_id%s`, join, on)
+	if kind != "" {
+		normalized, err := normalizeEntityKind(kind)
+		if err != nil {
+			return nil, err
+		}
+		query += ` WHERE e.kind = ?`
+		args = append(args, normalized)
+	}
+	query += ` GROUP BY e.id ORDER BY COUNT(c.id) DESC, MAX(c.valid_at) DESC, e.name LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []EntitySummary{}
+	for rows.Next() {
+		var e EntitySummary
+		var firstSeen, lastSeen sql.NullString
+		if err := rows.Scan(&e.Name, &e.Kind, &e.Chunks, &firstSeen, &lastSeen); err != nil {
+			return nil, err
+		}
+		e.FirstSeen = firstSeen.String
+		e.LastSeen = lastSeen.String
+		summaries = append(summaries, e)
+	}
+	return summaries, rows.Err()
+}
+
+// chunksWithEntityKind returns the ids of chunks linked to any entity of the given kind.
+func chunksWithEntityKind(db *sql.DB, kind string) (map[int64]bool, error) {
+	rows, err := db.Query(
+		`SELECT DISTINCT ce.chunk_id FROM chunk_entities ce
+		 JOIN entities e ON e.id = ce.entity_id
+		 WHERE e.kind = ?`, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// ============ Merge ============
+
+// EntityMergeResult reports what MergeEntities rewrote.
+type EntityMergeResult struct {
+	Kept             string
+	Merged           string
+	ChunksRelinked   int
+	RelationsRewired int
+	Aliases          []string
+}
+
+// MergeEntities folds the entity named merge into the one named keep: chunk links,
+// mentions and relations move over, and the merged name (plus its MNEME_ALIASES group)
+// is stored as an alias of keep so later lookups still resolve. Either argument may be
+// an existing alias.
+func MergeEntities(db *sql.DB, keep, merge string) (EntityMergeResult, error) {
+	var result EntityMergeResult
+
+	keepID, err := findEntityID(db, keep)
+	if err == sql.ErrNoRows {
+		return result, fmt.Errorf("unknown entity: %s", keep)
+	}
+	if err != nil {
+		return result, err
+	}
+	mergeID, err := findEntityID(db, merge)
+	if err == sql.ErrNoRows {
+		return result, fmt.Errorf("unknown entity: %s", merge)
+	}
+	if err != nil {
+		return result, err
+	}
+	if keepID == mergeID {
+		return result, fmt.Errorf("%q and %q are already the same entity", keep, merge)
+	}
+
+	err = withWriteTx(db, "merge entities", func(tx *sql.Tx) error {
+		result = EntityMergeResult{}
+		if err := tx.QueryRow(`SELECT name FROM entities WHERE id = ?`, keepID).Scan(&result.Kept); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(`SELECT name FROM entities WHERE id = ?`, mergeID).Scan(&result.Merged); err != nil {
+			return err
+		}
+
+		// Rows that would collide with an existing link to keep are left behind
+		// and removed by the cascade when the merged entity is deleted.
+		res, err := tx.Exec(`UPDATE OR IGNORE chunk_entities SET entity_id = ? WHERE entity_id = ?`, keepID, mergeID)
+		if err != nil {
+			return fmt.Errorf("relink chunks: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		result.ChunksRelinked = int(n)
+
+		if _, err := tx.Exec(`UPDATE OR IGNORE entity_mentions SET entity_id = ? WHERE entity_id = ?`, keepID, mergeID); err != nil {
+			return fmt.Errorf("relink mentions: %w", err)
+		}
+
+		for _, column := range []string{"subject_id", "object_id"} {
+			res, err := tx.Exec(fmt.Sprintf(`UPDATE OR IGNORE relations SET %s = ? WHERE %s = ?`, column, column), keepID, mergeID)
+			if err != nil {
+				return fmt.Errorf("rewire relations: %w", err)
+			}
+			n, _ := res.RowsAffected()
+			result.RelationsRewired += int(n)
+		}
+		// "Bob knows Robert Smith" collapses into a self-loop once they are one entity
+		if _, err := tx.Exec(`DELETE FROM relations WHERE subject_id = object_id AND subject_id = ?`, keepID); err != nil {
+			return fmt.Errorf("drop self relations: %w", err)
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE entities SET kind = (SELECT kind FROM entities WHERE id = ?) WHERE id = ? AND kind = ''`,
+			mergeID, keepID,
+		); err != nil {
+			return fmt.Errorf("carry kind: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE OR REPLACE entity_aliases SET entity_id = ? WHERE entity_id = ?`, keepID, mergeID); err != nil {
+			return fmt.Errorf("move aliases: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE mention_resolutions SET entity_id = ? WHERE entity_id = ?`, keepID, mergeID); err != nil {
+			return fmt.Errorf("move resolutions: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM entities WHERE id = ?`, mergeID); err != nil {
+			return fmt.Errorf("delete merged entity: %w", err)
+		}
+
+		seen := map[string]bool{strings.ToLower(result.Kept): true}
+		for _, name := range append([]string{result.Merged}, resolveAliases(result.Merged)...) {
+			name = strings.TrimSpace(name)
+			key := strings.ToLower(name)
+			if name == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			// Names that are entities in their own right stay separate until merged explicitly
+			var other int64
+			err := tx.QueryRow(`SELECT id FROM entities WHERE name = ?`, name).Scan(&other)
+			if err == nil {
+				continue
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO entity_aliases (alias, entity_id) VALUES (?, ?)`, name, keepID); err != nil {
+				return fmt.Errorf("store alias: %w", err)
+			}
+			result.Aliases = append(result.Aliases, name)
+		}
+		return nil
+	})
+	return result, err
+}
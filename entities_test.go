@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseEntityResponse(t *testing.T) {
+	raw := "Here you go:\n```json\n{\"people\": [\"Alice\", \" alice \", \"Bob Smith\"], \"projects\": [\"Mneme\"], \"places\": [\"x\", \"Berlin.\"]}\n```"
+	entities, err := parseEntityResponse(raw)
+	if err != nil {
+		t.Fatalf("parseEntityResponse: %v", err)
+	}
+
+	expected := []ExtractedEntity{
+		{Name: "Alice", Kind: entityKindPerson},
+		{Name: "Bob Smith", Kind: entityKindPerson},
+		{Name: "Mneme", Kind: entityKindProject},
+		{Name: "Berlin", Kind: entityKindPlace},
+	}
+	if len(entities) != len(expected) {
+		t.Fatalf("expected %d entities, got %d: %+v", len(expected), len(entities), entities)
+	}
+	for i, e := range expected {
+		if entities[i] != e {
+			t.Errorf("entity %d: expected %+v, got %+v", i, e, entities[i])
+		}
+	}
+
+	if _, err := parseEntityResponse("no json here"); err == nil {
+		t.Fatal("expected error for response without JSON")
+	}
+}
+
+func TestExtractEntities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/generate" {
+			http.NotFound(w, r)
+			return
+		}
+		var req generateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.Format != "json" {
+			t.Errorf("expected JSON format request, got %q", req.Format)
+		}
+		answer := `{"people": ["Alice"], "projects": ["Mneme"], "places": []}`
+		if req.Prompt == "Nothing to see." {
+			answer = `{"people": [], "projects": [], "places": []}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	id1 := insertChunk(t, db, "Alice is building Mneme.", "a.md", "One", "", 2, "", makeVec(map[int]float32{0: 1}))
+	id2 := insertChunk(t, db, "Mneme ships Friday, says Alice.", "a2.md", "Two", "", 2, "", makeVec(map[int]float32{0: 1}))
+	insertChunk(t, db, "Nothing to see.", "b.md", "Three", "", 2, "", makeVec(map[int]float32{0: 1}))
+
+	pending, err := pendingExtractionChunks(db, extractionKindEntities, "")
+	if err != nil {
+		t.Fatalf("pendingExtractionChunks: %v", err)
+	}
+	if len(pending) != 3 || pending[0] != id1 || pending[1] != id2 {
+		t.Fatalf("unexpected pending chunks: %v", pending)
+	}
+	onlyA, err := pendingExtractionChunks(db, extractionKindEntities, "a.md")
+	if err != nil {
+		t.Fatalf("pendingExtractionChunks: %v", err)
+	}
+	if len(onlyA) != 1 || onlyA[0] != id1 {
+		t.Fatalf("unexpected pending chunks for a.md: %v", onlyA)
+	}
+	pending = pending[:2]
+
+	client := NewOllamaClient(server.URL, "embed")
+	result, err := ExtractEntities(context.Background(), db, client, "gen", pending, nil)
+	if err != nil {
+		t.Fatalf("ExtractEntities: %v", err)
+	}
+	if result.ChunksProcessed != 2 || result.EntitiesFound != 2 || result.LinksCreated != 4 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	var kind string
+	if err := db.QueryRow(`SELECT kind FROM entities WHERE name = 'alice'`).Scan(&kind); err != nil {
+		t.Fatalf("lookup entity: %v", err)
+	}
+	if kind != entityKindPerson {
+		t.Fatalf("expected kind person, got %q", kind)
+	}
+
+	remaining, err := pendingExtractionChunks(db, extractionKindEntities, "")
+	if err != nil {
+		t.Fatalf("pendingExtractionChunks: %v", err)
+	}
+	if len(remaining) != 1 {
+		t.Fatalf("expected 1 chunk still pending, got %d", len(remaining))
+	}
+
+	// Deleting a chunk removes its entity links
+	if _, err := db.Exec(`DELETE FROM chunks WHERE id = ?`, id1); err != nil {
+		t.Fatalf("delete chunk: %v", err)
+	}
+	var links int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM chunk_entities`).Scan(&links); err != nil {
+		t.Fatalf("count links: %v", err)
+	}
+	if links != 2 {
+		t.Fatalf("expected 2 links after delete, got %d", links)
+	}
+}
+
+func TestMergeEntities(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	id1 := insertChunk(t, db, "Robert Smith joined the Mneme team.", "a.md", "One", "", 2, "2025-01-01", makeVec(map[int]float32{0: 1}))
+	id2 := insertChunk(t, db, "Bob fixed the Mneme ingest bug.", "b.md", "Two", "", 2, "2025-02-01", makeVec(map[int]float32{0: 1}))
+	insertChunk(t, db, "Bob and Robert Smith paired all day.", "c.md", "Three", "", 2, "2025-03-01", makeVec(map[int]float32{0: 1}))
+
+	for _, e := range []struct{ name, kind string }{{"Robert Smith", ""}, {"Bob", entityKindPerson}, {"Mneme", entityKindProject}} {
+		if _, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES (?, ?, ?)`, e.name, e.kind, "2025-01-01T00:00:00Z"); err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+	}
+	if err := IndexChunkMentions(db, []int64{id1, id2, id2 + 1}); err != nil {
+		t.Fatalf("IndexChunkMentions: %v", err)
+	}
+	if _, err := db.Exec(
+		`INSERT INTO relations (subject_id, predicate, object_id, chunk_id)
+		 SELECT s.id, 'works on', o.id, ? FROM entities s, entities o WHERE s.name = 'Bob' AND o.name = 'Mneme'`, id2,
+	); err != nil {
+		t.Fatalf("insert relation: %v", err)
+	}
+	if _, err := db.Exec(
+		`INSERT INTO relations (subject_id, predicate, object_id, chunk_id)
+		 SELECT s.id, 'pairs with', o.id, ? FROM entities s, entities o WHERE s.name = 'Bob' AND o.name = 'Robert Smith'`, id2+1,
+	); err != nil {
+		t.Fatalf("insert relation: %v", err)
+	}
+
+	result, err := MergeEntities(db, "robert smith", "Bob")
+	if err != nil {
+		t.Fatalf("MergeEntities: %v", err)
+	}
+	// Chunk c.md was already linked to both, so only b.md moves
+	if result.Kept != "Robert Smith" || result.Merged != "Bob" || result.ChunksRelinked != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(result.Aliases) != 1 || result.Aliases[0] != "Bob" {
+		t.Fatalf("expected Bob stored as alias, got %v", result.Aliases)
+	}
+
+	var entities, selfLoops int
+	var kind string
+	if err := db.QueryRow(`SELECT COUNT(*) FROM entities`).Scan(&entities); err != nil {
+		t.Fatalf("count entities: %v", err)
+	}
+	if err := db.QueryRow(`SELECT kind FROM entities WHERE name = 'Robert Smith'`).Scan(&kind); err != nil {
+		t.Fatalf("lookup kind: %v", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM relations WHERE subject_id = object_id`).Scan(&selfLoops); err != nil {
+		t.Fatalf("count self loops: %v", err)
+	}
+	if entities != 2 || kind != entityKindPerson || selfLoops != 0 {
+		t.Fatalf("expected 2 entities, kind person, no self loops; got %d, %q, %d", entities, kind, selfLoops)
+	}
+
+	// The merged name resolves to the kept entity everywhere
+	results, err := History(db, "Bob", 10)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 chunks for Bob after merge, got %d", len(results))
+	}
+	edges, err := Graph(db, "Bob", 1, 10)
+	if err != nil {
+		t.Fatalf("Graph: %v", err)
+	}
+	if len(edges) != 1 || edges[0].Subject != "Robert Smith" || edges[0].Object != "Mneme" {
+		t.Fatalf("unexpected edges after merge: %+v", edges)
+	}
+
+	if _, err := MergeEntities(db, "Robert Smith", "Bob"); err == nil {
+		t.Fatal("expected error merging an entity into itself")
+	}
+	if _, err := MergeEntities(db, "Robert Smith", "Nobody"); err == nil {
+		t.Fatal("expected error for unknown entity")
+	}
+}
+
+func TestEntityTypes(t *testing.T) {
+	for input, want := range map[string]string{"Person": entityKindPerson, "people": entityKindPerson, "tools": entityKindTool, " project ": entityKindProject} {
+		got, err := normalizeEntityKind(input)
+		if err != nil || got != want {
+			t.Errorf("normalizeEntityKind(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := normalizeEntityKind("animal"); err == nil {
+		t.Error("expected error for unknown type")
+	}
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	id1 := insertChunk(t, db, "Mneme moved to Postgres.", "a.md", "One", "", 2, "2025-08-20", vec)
+	id2 := insertChunk(t, db, "Mneme launch with Alice.", "b.md", "Two", "", 2, "2025-09-10", vec)
+	id3 := insertChunk(t, db, "Atlas kicked off.", "c.md", "Three", "", 2, "2025-09-30T18:00:00Z", vec)
+	insertChunk(t, db, "Lunch.", "d.md", "Four", "", 2, "2025-09-15", vec)
+	for _, e := range []struct{ name, kind string }{{"Mneme", entityKindProject}, {"Atlas", entityKindProject}, {"Alice", entityKindPerson}, {"Postgres", ""}} {
+		if _, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES (?, ?, '2025-01-01T00:00:00Z')`, e.name, e.kind); err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+	}
+	if err := IndexChunkMentions(db, []int64{id1, id2, id3}); err != nil {
+		t.Fatalf("IndexChunkMentions: %v", err)
+	}
+
+	if err := SetEntityType(db, "postgres", "Tool"); err != nil {
+		t.Fatalf("SetEntityType: %v", err)
+	}
+	if err := SetEntityType(db, "Nobody", "person"); err == nil {
+		t.Fatal("expected error for unknown entity")
+	}
+
+	tools, err := ListEntities(db, "tool", "", "", 10)
+	if err != nil {
+		t.Fatalf("ListEntities: %v", err)
+	}
+	if len(tools) != 1 || tools[0].Name != "Postgres" || tools[0].Chunks != 1 {
+		t.Fatalf("unexpected tools: %+v", tools)
+	}
+
+	// "All projects mentioned in September" counts only September chunks
+	projects, err := ListEntities(db, "projects", "2025-09-01", "2025-09-30", 10)
+	if err != nil {
+		t.Fatalf("ListEntities: %v", err)
+	}
+	if len(projects) != 2 || projects[0].Chunks != 1 || projects[1].Chunks != 1 {
+		t.Fatalf("unexpected September projects: %+v", projects)
+	}
+
+	history, err := TypeHistory(db, "project", 10)
+	if err != nil {
+		t.Fatalf("TypeHistory: %v", err)
+	}
+	if len(history) != 3 || history[0].SourceFile != "a.md" || history[2].SourceFile != "c.md" {
+		t.Fatalf("unexpected project history: %+v", history)
+	}
+
+	server := newOllamaServer(t, vec)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+	results, err := SearchWithOptions(context.Background(), db, client, "anything", SearchOptions{Limit: 10, EntityType: "person"})
+	if err != nil {
+		t.Fatalf("SearchWithOptions: %v", err)
+	}
+	if len(results) != 1 || results[0].SourceFile != "b.md" {
+		t.Fatalf("expected only the chunk naming a person, got %+v", results)
+	}
+}
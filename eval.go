@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// EvalCase is one retrieval test: a query and what a good answer contains. A result
+// counts as relevant when it matches every expectation the case sets.
+type EvalCase struct {
+	Query string `json:"query"`
+	// Chunks lists acceptable chunk IDs; recall is the share of them retrieved.
+	Chunks []int64 `json:"chunks,omitempty"`
+	// Source is the expected source_file, exact or a glob ("notes/*.md").
+	Source string `json:"source,omitempty"`
+	// Section is the expected section title (case-insensitive).
+	Section string `json:"section,omitempty"`
+	// Contains is text the chunk must include (case-insensitive).
+	Contains string `json:"contains,omitempty"`
+	AsOf     string `json:"as_of,omitempty"`
+}
+
+// EvalCaseResult is how one case fared.
+type EvalCaseResult struct {
+	Query string `json:"query"`
+	// Rank is the 1-based position of the first relevant result, 0 if none in the top K.
+	Rank   int     `json:"rank"`
+	Recall float64 `json:"recall"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// EvalReport summarizes a run over all cases.
+type EvalReport struct {
+	K      int              `json:"k"`
+	Recall float64          `json:"recall_at_k"`
+	MRR    float64          `json:"mrr"`
+	Cases  []EvalCaseResult `json:"cases"`
+}
+
+// ParseEvalCases reads cases from JSON (an array) or from a YAML list of mappings:
+//
+//   - query: "which database did we pick for auth"
+//     source: notes/auth.md
+//     chunks: [12, 14]
+//
+// Only that YAML subset is understood: scalars, quoted strings, [a, b] flow lists and
+// "- item" block lists under a key, optionally inside a top-level "cases:" key.
+func ParseEvalCases(data []byte) ([]EvalCase, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var cases []EvalCase
+		if err := json.Unmarshal(trimmed, &cases); err != nil {
+			return nil, fmt.Errorf("parse JSON cases: %w", err)
+		}
+		return cases, validateEvalCases(cases)
+	}
+
+	var items []map[string]any
+	var item map[string]any
+	listKey := ""
+	itemIndent := -1
+	for n, raw := range strings.Split(string(data), "\n") {
+		line := strings.TrimRight(raw, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent == 0 && trimmed == "cases:" {
+			continue
+		}
+
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			rest := strings.TrimSpace(trimmed[1:])
+			if itemIndent >= 0 && indent > itemIndent {
+				if listKey == "" {
+					return nil, fmt.Errorf("line %d: list item outside a list", n+1)
+				}
+				item[listKey] = append(item[listKey].([]any), yamlScalar(rest))
+				continue
+			}
+			itemIndent = indent
+			item = map[string]any{}
+			items = append(items, item)
+			listKey = ""
+			if rest == "" {
+				continue
+			}
+			trimmed = rest
+		} else if item == nil {
+			return nil, fmt.Errorf("line %d: expected a list of cases", n+1)
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if value == "" {
+			item[key] = []any{}
+			listKey = key
+			continue
+		}
+		item[key] = yamlValue(value)
+		listKey = ""
+	}
+
+	cases := make([]EvalCase, 0, len(items))
+	for i, fields := range items {
+		var c EvalCase
+		for key, value := range fields {
+			var err error
+			switch key {
+			case "query":
+				c.Query = fmt.Sprint(value)
+			case "source":
+				c.Source = fmt.Sprint(value)
+			case "section":
+				c.Section = fmt.Sprint(value)
+			case "contains":
+				c.Contains = fmt.Sprint(value)
+			case "as_of":
+				c.AsOf = fmt.Sprint(value)
+			case "chunks", "chunk":
+				c.Chunks, err = evalChunkIDs(value)
+			default:
+				err = fmt.Errorf("unknown field %q", key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("case %d: %w", i+1, err)
+			}
+		}
+		cases = append(cases, c)
+	}
+	return cases, validateEvalCases(cases)
+}
+
+// yamlValue parses a scalar or a [a, b] flow list.
+func yamlValue(value string) any {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		list := []any{}
+		for _, part := range strings.Split(value[1:len(value)-1], ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, yamlScalar(part))
+			}
+		}
+		return list
+	}
+	return yamlScalar(value)
+}
+
+// yamlScalar unquotes a scalar, or drops a trailing comment from an unquoted one.
+func yamlScalar(value string) string {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if s, err := strconv.Unquote(value); err == nil {
+			return s
+		}
+	case strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) >= 2:
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+func evalChunkIDs(value any) ([]int64, error) {
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+	ids := make([]int64, 0, len(values))
+	for _, v := range values {
+		id, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk id %v", v)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func validateEvalCases(cases []EvalCase) error {
+	if len(cases) == 0 {
+		return fmt.Errorf("no cases found")
+	}
+	for i, c := range cases {
+		if strings.TrimSpace(c.Query) == "" {
+			return fmt.Errorf("case %d: query is required", i+1)
+		}
+		if len(c.Chunks) == 0 && c.Source == "" && c.Section == "" && c.Contains == "" {
+			return fmt.Errorf("case %d (%q): set at least one of chunks, source, section or contains", i+1, c.Query)
+		}
+		if c.Source != "" {
+			if _, err := path.Match(c.Source, ""); err != nil {
+				return fmt.Errorf("case %d: bad source pattern %q", i+1, c.Source)
+			}
+		}
+	}
+	return nil
+}
+
+// evalRelevant reports whether r satisfies every expectation of c.
+func evalRelevant(c EvalCase, r SearchResult) bool {
+	if len(c.Chunks) > 0 {
+		found := false
+		for _, id := range c.Chunks {
+			found = found || int64(r.ID) == id
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.Source != "" {
+		if ok, _ := path.Match(c.Source, r.SourceFile); !ok {
+			return false
+		}
+	}
+	if c.Section != "" && !strings.EqualFold(c.Section, r.SectionTitle) {
+		return false
+	}
+	if c.Contains != "" && !strings.Contains(strings.ToLower(r.Text), strings.ToLower(c.Contains)) {
+		return false
+	}
+	return true
+}
+
+// RunEval searches every case with opts (Limit is K) and scores the rankings: recall@K
+// and mean reciprocal rank over all cases. Searches never reinforce chunks. A case whose
+// search fails scores zero and carries the error.
+func RunEval(ctx context.Context, db *sql.DB, ollama *OllamaClient, cases []EvalCase, opts SearchOptions, progress ProgressFunc) EvalReport {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	opts.ByRelevance = true
+	opts.Reinforce = false
+
+	report := EvalReport{K: opts.Limit, Cases: make([]EvalCaseResult, 0, len(cases))}
+	for i, c := range cases {
+		if progress != nil {
+			progress(i, len(cases), c.Query)
+		}
+		caseOpts := opts
+		if c.AsOf != "" {
+			caseOpts.AsOf = c.AsOf
+		}
+		result := EvalCaseResult{Query: c.Query}
+		results, err := SearchWithOptions(ctx, db, ollama, c.Query, caseOpts)
+		if err != nil {
+			result.Error = err.Error()
+			report.Cases = append(report.Cases, result)
+			continue
+		}
+
+		found := make(map[int64]bool)
+		for rank, r := range results {
+			if !evalRelevant(c, r) {
+				continue
+			}
+			if result.Rank == 0 {
+				result.Rank = rank + 1
+			}
+			found[int64(r.ID)] = true
+		}
+		switch {
+		case len(c.Chunks) > 0:
+			result.Recall = float64(len(found)) / float64(len(c.Chunks))
+		case result.Rank > 0:
+			result.Recall = 1
+		}
+		if result.Rank > 0 {
+			report.MRR += 1 / float64(result.Rank)
+		}
+		report.Recall += result.Recall
+		report.Cases = append(report.Cases, result)
+	}
+	if progress != nil {
+		progress(len(cases), len(cases), "")
+	}
+	if len(cases) > 0 {
+		report.Recall /= float64(len(cases))
+		report.MRR /= float64(len(cases))
+	}
+	return report
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseEvalCases(t *testing.T) {
+	yaml := `# retrieval checks
+cases:
+  - query: "which database, for auth?"
+    source: notes/*.md   # any note
+    contains: 'it''s postgres'
+  - query: retry policy
+    chunks:
+      - 412
+      - 873
+    as_of: 2025-06-01
+  -
+    query: flow list
+    chunk: [7, 8]
+`
+	cases, err := ParseEvalCases([]byte(yaml))
+	if err != nil {
+		t.Fatalf("ParseEvalCases: %v", err)
+	}
+	if len(cases) != 3 {
+		t.Fatalf("expected 3 cases, got %+v", cases)
+	}
+	if cases[0].Query != "which database, for auth?" || cases[0].Source != "notes/*.md" || cases[0].Contains != "it's postgres" {
+		t.Fatalf("unexpected first case: %+v", cases[0])
+	}
+	if len(cases[1].Chunks) != 2 || cases[1].Chunks[1] != 873 || cases[1].AsOf != "2025-06-01" {
+		t.Fatalf("unexpected second case: %+v", cases[1])
+	}
+	if len(cases[2].Chunks) != 2 || cases[2].Chunks[0] != 7 {
+		t.Fatalf("unexpected third case: %+v", cases[2])
+	}
+
+	fromJSON, err := ParseEvalCases([]byte(`[{"query": "q", "section": "Auth"}]`))
+	if err != nil || len(fromJSON) != 1 || fromJSON[0].Section != "Auth" {
+		t.Fatalf("expected a JSON case, got %+v, %v", fromJSON, err)
+	}
+
+	for name, bad := range map[string]string{
+		"unknown field":  "- query: q\n  sauce: a.md\n",
+		"no expectation": "- query: q\n",
+		"no query":       "- source: a.md\n",
+		"bad chunk":      "- query: q\n  chunks: [x]\n",
+		"not a list":     "query: q\n",
+		"empty":          "# nothing\n",
+	} {
+		if _, err := ParseEvalCases([]byte(bad)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRunEval(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	best := insertChunk(t, db, "We use Postgres for auth.", "notes/auth.md", "Auth", "", 2, "2025-01-01", makeVec(map[int]float32{0: 1}))
+	second := insertChunk(t, db, "Retry three times.", "notes/retry.md", "Retry", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1, 1: 0.3}))
+	insertChunk(t, db, "Unrelated.", "misc.md", "Misc", "", 2, "2025-02-01", makeVec(map[int]float32{1: 1}))
+
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	cases := []EvalCase{
+		{Query: "auth db", Source: "notes/*.md", Contains: "POSTGRES"},
+		{Query: "retry", Chunks: []int64{second, 999}},
+		{Query: "missing", Section: "Nowhere"},
+	}
+	report := RunEval(context.Background(), db, client, cases, SearchOptions{Limit: 2}, nil)
+	if report.K != 2 || len(report.Cases) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Cases[0].Rank != 1 || report.Cases[1].Rank != 2 || report.Cases[2].Rank != 0 {
+		t.Fatalf("expected ranks 1, 2 and a miss (relevance order, not chronological), got %+v", report.Cases)
+	}
+	if report.Cases[1].Recall != 0.5 {
+		t.Fatalf("expected half the listed chunks found, got %v", report.Cases[1].Recall)
+	}
+	if math.Abs(report.Recall-0.5) > 1e-9 || math.Abs(report.MRR-0.5) > 1e-9 {
+		t.Fatalf("expected recall 0.5 and MRR 0.5, got %v and %v", report.Recall, report.MRR)
+	}
+
+	var retrievals int
+	db.QueryRow(`SELECT retrieval_count FROM chunks WHERE id = ?`, best).Scan(&retrievals)
+	if retrievals != 0 {
+		t.Fatal("expected eval searches not to reinforce chunks")
+	}
+
+	// A case-level as_of filters out the newer chunk
+	dated := RunEval(context.Background(), db, client, []EvalCase{{Query: "auth", Contains: "postgres", AsOf: "2024-06-01"}}, SearchOptions{Limit: 2}, nil)
+	if dated.Cases[0].Rank != 0 || !strings.Contains(dated.Cases[0].Query, "auth") {
+		t.Fatalf("expected as_of to hide the 2025 chunk, got %+v", dated.Cases[0])
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// expandSections sets SectionText on each result whose section was split into several
+// chunks, stitching the section back together from all of them in order, so a hit in
+// the middle of a long section can be read with what comes before and after it.
+func expandSections(ctx context.Context, db *sql.DB, results []SearchResult) error {
+	stmt, err := cachedStmt(db,
+		`SELECT s.text FROM chunks c
+		 JOIN chunks s ON s.source_file = c.source_file AND s.section_sequence = c.section_sequence
+		 WHERE c.id = ?
+		 ORDER BY s.chunk_sequence`,
+	)
+	if err != nil {
+		return err
+	}
+	for i := range results {
+		rows, err := stmt.QueryContext(ctx, results[i].ID)
+		if err != nil {
+			return err
+		}
+		var texts []string
+		for rows.Next() {
+			var text string
+			if err := rows.Scan(&text); err != nil {
+				rows.Close()
+				return err
+			}
+			texts = append(texts, text)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(texts) > 1 {
+			results[i].SectionText = stitchChunks(texts)
+		}
+	}
+	return nil
+}
+
+// stitchChunks joins a section's chunks back into its text, dropping the paragraphs or
+// sentences each chunk repeats from the one before when chunked with an overlap.
+func stitchChunks(texts []string) string {
+	var b strings.Builder
+	for i, text := range texts {
+		if i > 0 {
+			text = strings.TrimSpace(text[chunkOverlap(texts[i-1], text):])
+			if text == "" {
+				continue
+			}
+			b.WriteString("\n\n")
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// chunkOverlap returns how many bytes next opens with that repeat the end of prev. The
+// repeat must be whole paragraphs or sentences: it ends where next breaks to its own text
+// and starts where prev breaks between units.
+func chunkOverlap(prev, next string) int {
+	for k := min(len(prev), len(next)); k > 0; k-- {
+		if k < len(next) && next[k] != ' ' && next[k] != '\n' {
+			continue
+		}
+		if k < len(prev) && prev[len(prev)-k-1] != ' ' && prev[len(prev)-k-1] != '\n' {
+			continue
+		}
+		if strings.HasSuffix(prev, next[:k]) {
+			return k
+		}
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const expandSection = "The move starts on Friday.\n\nMovers arrive at eight sharp.\n\nThe piano goes first, then the boxes.\n\nKeys are handed over at noon."
+
+func TestStitchChunks(t *testing.T) {
+	for _, opts := range []ChunkOptions{{Words: 8}, {Words: 12, Overlap: 6}} {
+		chunks := ChunkSection(Section{Title: "Move", Content: expandSection}, opts)
+		if len(chunks) < 3 {
+			t.Fatalf("expected the section split, got %+v", chunks)
+		}
+		var texts []string
+		for _, c := range chunks {
+			texts = append(texts, c.Text)
+		}
+		if got := stitchChunks(texts); got != expandSection {
+			t.Fatalf("overlap %d: expected the section back, got %q", opts.Overlap, got)
+		}
+	}
+	// Text that merely starts like a word the last chunk ended on is kept
+	if got := stitchChunks([]string{"Plan B", "Bravo team"}); got != "Plan B\n\nBravo team" {
+		t.Fatalf("expected no overlap, got %q", got)
+	}
+}
+
+func TestSearchExpand(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+	withNearDuplicateThreshold(t, 0)
+
+	md := "## Move\n\n" + expandSection + "\n\n## Short\n\nJust one chunk.\n"
+	if _, err := IngestMarkdown(context.Background(), db, client, "move.md", strings.NewReader(md), "", ChunkOptions{Words: 12, Overlap: 6, Depth: defaultSectionDepth}, nil); err != nil {
+		t.Fatalf("IngestMarkdown: %v", err)
+	}
+
+	results, err := SearchWithOptions(context.Background(), db, client, "move", SearchOptions{Limit: 10, Expand: true})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) < 4 {
+		t.Fatalf("expected every chunk found, got %+v", results)
+	}
+	for _, r := range results {
+		switch r.SectionTitle {
+		case "Move":
+			if r.SectionText != expandSection {
+				t.Fatalf("expected the whole section with chunk %q, got %q", r.Text, r.SectionText)
+			}
+		case "Short":
+			if r.SectionText != "" {
+				t.Fatalf("expected no section text for a single chunk, got %q", r.SectionText)
+			}
+		}
+	}
+
+	results, _ = SearchWithOptions(context.Background(), db, client, "move", SearchOptions{Limit: 10})
+	for _, r := range results {
+		if r.SectionText != "" {
+			t.Fatalf("expected no section text without Expand, got %+v", r)
+		}
+	}
+}
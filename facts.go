@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+// extractionKindFacts marks chunks in chunk_extractions once the fact pass has run.
+const extractionKindFacts = "facts"
+
+const factExtractionPrompt = `You distill personal notes and conversation transcripts into atomic facts.
+Return JSON only, in exactly this shape:
+{"facts": ["...", "..."]}
+Rules:
+- Each fact is one short, self-contained sentence that names its subject, e.g. "Project Y uses Postgres".
+- Never use pronouns like "he", "it" or "we" without the name they refer to.
+- Only include facts the text states directly; skip greetings, questions and chatter.
+- Use an empty array when nothing applies.`
+
+type factExtractionResponse struct {
+	Facts []string `json:"facts"`
+}
+
+type FactExtractionResult struct {
+	ChunksProcessed int
+	FactsCreated    int
+}
+
+// FactResult is a fact matched by SearchFacts, with the chunk it came from.
+type FactResult struct {
+	ID           int64
+	Text         string
+	ValidAt      string
+	ValidUntil   string `json:",omitempty"`
+	ChunkID      int64
+	SourceFile   string
+	SectionTitle string
+	Distance     float64
+}
+
+// parseFactResponse decodes the model's JSON answer into trimmed, de-duplicated facts.
+func parseFactResponse(raw string) ([]string, error) {
+	var resp factExtractionResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var facts []string
+	for _, f := range resp.Facts {
+		f = strings.Join(strings.Fields(f), " ")
+		key := strings.ToLower(f)
+		if len(f) < 5 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		facts = append(facts, f)
+	}
+	return facts, nil
+}
+
+// ExtractFacts runs the LLM fact pass over the given chunks. Each fact is embedded
+// into vec_facts and keeps its chunk and that chunk's valid_at as provenance.
+func ExtractFacts(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, chunkIDs []int64, progress ProgressFunc) (FactExtractionResult, error) {
+	var result FactExtractionResult
+
+	for i, chunkID := range chunkIDs {
+		var text, title string
+		var validAt sql.NullString
+		err := db.QueryRow(`SELECT text, section_title, valid_at FROM chunks WHERE id = ?`, chunkID).Scan(&text, &title, &validAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("read chunk %d: %w", chunkID, err)
+		}
+		if progress != nil {
+			progress(i, len(chunkIDs), title)
+		}
+
+		raw, err := ollama.GenerateJSON(ctx, model, factExtractionPrompt, text)
+		if err != nil {
+			return result, fmt.Errorf("extract facts from chunk %d: %w", chunkID, err)
+		}
+		facts, err := parseFactResponse(raw)
+		if err != nil {
+			if errors.Is(err, errBadModelResponse) {
+				log.Printf("fact extraction: skipping chunk %d: %v", chunkID, err)
+				continue
+			}
+			return result, err
+		}
+
+		// Embed before opening the transaction so a slow model doesn't hold the write lock
+		embeddings := make([][]byte, len(facts))
+		for j, fact := range facts {
+			embedding, err := ollama.Embed(ctx, fact)
+			if err != nil {
+				return result, fmt.Errorf("embed fact: %w", err)
+			}
+			embeddings[j], err = sqlite_vec.SerializeFloat32(embedding)
+			if err != nil {
+				return result, fmt.Errorf("serialize embedding: %w", err)
+			}
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		factsCreated := 0
+		err = withWriteTx(db, "extract facts", func(tx *sql.Tx) error {
+			factsCreated = 0
+			for j, fact := range facts {
+				res, err := tx.Exec(
+					`INSERT OR IGNORE INTO facts (text, chunk_id, valid_at, created_at) VALUES (?, ?, ?, ?)`,
+					fact, chunkID, validAt, now,
+				)
+				if err != nil {
+					return fmt.Errorf("insert fact: %w", err)
+				}
+				if n, _ := res.RowsAffected(); n == 0 {
+					continue
+				}
+				factID, err := res.LastInsertId()
+				if err != nil {
+					return fmt.Errorf("fact id: %w", err)
+				}
+				vecValidAt, vecValidUntil := vecValidity(validAt, sql.NullString{})
+				if _, err := tx.Exec(`INSERT INTO vec_facts (fact_id, embedding, valid_at, valid_until) VALUES (?, ?, ?, ?)`, factID, embeddings[j], vecValidAt, vecValidUntil); err != nil {
+					return fmt.Errorf("insert fact vector: %w", err)
+				}
+				factsCreated++
+			}
+			if err := markExtracted(tx, chunkID, extractionKindFacts); err != nil {
+				return fmt.Errorf("mark extracted: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		result.FactsCreated += factsCreated
+		result.ChunksProcessed++
+	}
+	if progress != nil && len(chunkIDs) > 0 {
+		progress(len(chunkIDs), len(chunkIDs), "")
+	}
+
+	return result, nil
+}
+
+// SearchFacts returns the facts closest to query, most relevant first.
+// asOf (YYYY-MM-DD) keeps only facts whose validity interval covers it.
+// If limit <= 0, defaults to 10.
+func SearchFacts(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, limit int, asOf string) ([]FactResult, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	asOf, err := NormalizeDate(asOf)
+	if err != nil {
+		return nil, fmt.Errorf("as-of: %w", err)
+	}
+
+	embedding, err := ollama.Embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	serialized, err := sqlite_vec.SerializeFloat32(embedding)
+	if err != nil {
+		return nil, err
+	}
+
+	// As for chunks, vec0 checks the as-of bound against its copies of the validity
+	// columns, so the k nearest are all valid then
+	knn := `v.embedding MATCH ? AND v.k = ?`
+	args := []any{serialized, limit}
+	if asOf != "" {
+		knn += ` AND v.valid_at <= ? AND v.valid_until > ?`
+		args = append(args, asOf, asOf)
+	}
+	rows, err := db.Query(
+		`SELECT f.id, f.text, f.valid_at, f.valid_until, f.chunk_id, c.source_file, c.section_title, v.distance
+		 FROM vec_facts v
+		 JOIN facts f ON f.id = v.fact_id
+		 JOIN chunks c ON c.id = f.chunk_id
+		 WHERE `+knn+`
+		 ORDER BY v.distance`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []FactResult{}
+	for rows.Next() {
+		var r FactResult
+		var validAt, validUntil sql.NullString
+		if err := rows.Scan(&r.ID, &r.Text, &validAt, &validUntil, &r.ChunkID, &r.SourceFile, &r.SectionTitle, &r.Distance); err != nil {
+			return nil, err
+		}
+		r.ValidAt = validAt.String
+		r.ValidUntil = validUntil.String
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+func TestParseFactResponse(t *testing.T) {
+	raw := "```json\n{\"facts\": [\"Project Y uses Postgres.\", \"project y  uses postgres.\", \"ok\", \"Alice lives in Berlin.\"]}\n```"
+	facts, err := parseFactResponse(raw)
+	if err != nil {
+		t.Fatalf("parseFactResponse: %v", err)
+	}
+	if len(facts) != 2 || facts[0] != "Project Y uses Postgres." || facts[1] != "Alice lives in Berlin." {
+		t.Fatalf("unexpected facts: %q", facts)
+	}
+
+	if _, err := parseFactResponse("no json here"); err == nil {
+		t.Fatal("expected error for response without JSON")
+	}
+}
+
+func TestExtractAndSearchFacts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			answer := `{"facts": ["Project Y uses Postgres", "Alice leads Project Y"]}`
+			if strings.Contains(req.Prompt, "Berlin") {
+				answer = `{"facts": ["Alice lives in Berlin"]}`
+			}
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		case "/api/embed":
+			var req embedRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			// Database talk points along dim 0, everything else along dim 1
+			vec := make([]float64, EmbedDimension)
+			if strings.Contains(strings.ToLower(req.Input), "postgres") || strings.Contains(strings.ToLower(req.Input), "database") {
+				vec[0] = 1
+			} else {
+				vec[1] = 1
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	id1 := insertChunk(t, db, "Long transcript about Project Y and its Postgres setup, led by Alice.", "a.md", "Setup", "", 2, "2025-01-10", makeVec(map[int]float32{0: 1}))
+	id2 := insertChunk(t, db, "Alice moved to Berlin last week.", "b.md", "Move", "", 2, "2025-06-01", makeVec(map[int]float32{1: 1}))
+
+	client := NewOllamaClient(server.URL, "embed")
+	result, err := ExtractFacts(context.Background(), db, client, "gen", []int64{id1, id2}, nil)
+	if err != nil {
+		t.Fatalf("ExtractFacts: %v", err)
+	}
+	if result.ChunksProcessed != 2 || result.FactsCreated != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	pending, err := pendingExtractionChunks(db, extractionKindFacts, "")
+	if err != nil {
+		t.Fatalf("pendingExtractionChunks: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending chunks, got %v", pending)
+	}
+
+	facts, err := SearchFacts(context.Background(), db, client, "which database", 1, "")
+	if err != nil {
+		t.Fatalf("SearchFacts: %v", err)
+	}
+	if len(facts) != 1 || facts[0].Text != "Project Y uses Postgres" {
+		t.Fatalf("unexpected facts: %+v", facts)
+	}
+	if facts[0].ChunkID != id1 || facts[0].SourceFile != "a.md" || facts[0].ValidAt != "2025-01-10" {
+		t.Fatalf("fact lost its provenance: %+v", facts[0])
+	}
+
+	// as-of drops the Berlin fact, which is dated later
+	facts, err = SearchFacts(context.Background(), db, client, "where does Alice live", 10, "2025-03-01")
+	if err != nil {
+		t.Fatalf("SearchFacts: %v", err)
+	}
+	for _, f := range facts {
+		if f.ValidAt > "2025-03-01" {
+			t.Fatalf("as-of filter kept a later fact: %+v", f)
+		}
+	}
+	if len(facts) != 2 {
+		t.Fatalf("expected 2 facts before as-of, got %d", len(facts))
+	}
+}
+
+// insertFact stores a fact about chunkID as ExtractFacts would, returning its id.
+func insertFact(t *testing.T, db *sql.DB, chunkID int64, text, validAt string, embedding []float32) int64 {
+	t.Helper()
+	res, err := db.Exec(`INSERT INTO facts (text, chunk_id, valid_at, created_at) VALUES (?, ?, NULLIF(?, ''), '2025-01-01T00:00:00Z')`, text, chunkID, validAt)
+	if err != nil {
+		t.Fatalf("insert fact: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	blob, err := sqlite_vec.SerializeFloat32(embedding)
+	if err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	vecValidAt, vecValidUntil := vecValidity(sql.NullString{String: validAt, Valid: validAt != ""}, sql.NullString{})
+	if _, err := db.Exec(`INSERT INTO vec_facts (fact_id, embedding, valid_at, valid_until) VALUES (?, ?, ?, ?)`, id, blob, vecValidAt, vecValidUntil); err != nil {
+		t.Fatalf("insert fact vector: %v", err)
+	}
+	return id
+}
+
+func TestSearchFactsAsOfInsideKNN(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	query := makeVec(map[int]float32{0: 1})
+	chunk := insertChunk(t, db, "notes", "a.md", "Notes", "", 2, "", query)
+	// Closer than the answer but all dated after the as-of day
+	for i := 0; i < 5; i++ {
+		insertFact(t, db, chunk, fmt.Sprintf("later %d", i), "2025-03-01", makeVec(map[int]float32{0: 1, 1: float32(i) * 0.01}))
+	}
+	answer := insertFact(t, db, chunk, "earlier", "2024-01-01", makeVec(map[int]float32{0: 1, 1: 1}))
+	ended := insertFact(t, db, chunk, "ended", "2024-01-01", makeVec(map[int]float32{0: 1, 1: 0.5}))
+	if _, err := db.Exec(`UPDATE facts SET valid_until = '2024-03-01' WHERE id = ?`, ended); err != nil {
+		t.Fatalf("end validity: %v", err)
+	}
+
+	server := newOllamaServer(t, query)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	facts, err := SearchFacts(context.Background(), db, client, "query", 1, "2024-06-01")
+	if err != nil {
+		t.Fatalf("SearchFacts: %v", err)
+	}
+	if len(facts) != 1 || facts[0].ID != answer {
+		t.Fatalf("expected the one fact valid on the day despite nearer later ones, got %+v", facts)
+	}
+
+	// The trigger carries validity changes into vec_facts
+	if _, err := db.Exec(`UPDATE facts SET valid_until = NULL WHERE id = ?`, ended); err != nil {
+		t.Fatalf("reopen validity: %v", err)
+	}
+	facts, _ = SearchFacts(context.Background(), db, client, "query", 1, "2024-06-01")
+	if len(facts) != 1 || facts[0].ID != ended {
+		t.Fatalf("expected the reopened fact, got %+v", facts)
+	}
+}
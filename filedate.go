@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Where a file's date can come from when neither a header nor its frontmatter gives one.
+const (
+	dateFromValidAt  = "valid-at" // the --valid-at flag
+	dateFromFilename = "filename" // a date in the name, as daily notes have: 2026-01-21.md
+	dateFromMtime    = "mtime"    // the file's modification time
+)
+
+// compactDate matches a date written without separators, as in 20260121-standup.md.
+var compactDate = regexp.MustCompile(`\b(\d{4})(\d{2})(\d{2})\b`)
+
+// parseDateFrom reads a --date-from list: the sources of a file's date, first first.
+func parseDateFrom(s string) ([]string, error) {
+	sources := splitList(s)
+	for _, source := range sources {
+		switch source {
+		case dateFromValidAt, dateFromFilename, dateFromMtime:
+		default:
+			return nil, fmt.Errorf("--date-from: unknown source %q (want valid-at, filename or mtime)", source)
+		}
+	}
+	return sources, nil
+}
+
+// fileValidAt picks the valid_at a file's sections fall back to, from the first of from
+// that yields a date: validAt, a date in the file's name, or its modification time. It is
+// "" when none does; an empty from is validAt alone. A date in a header or the frontmatter
+// still comes first.
+func fileValidAt(path, validAt string, from []string) (string, error) {
+	if len(from) == 0 {
+		from = []string{dateFromValidAt}
+	}
+	for _, source := range from {
+		switch source {
+		case dateFromValidAt:
+			if validAt != "" {
+				return NormalizeDate(validAt)
+			}
+		case dateFromFilename:
+			if date := filenameDate(path); date != "" {
+				return date, nil
+			}
+		case dateFromMtime:
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", err
+			}
+			return localDate(info.ModTime()), nil
+		}
+	}
+	return "", nil
+}
+
+// filenameDate returns the date in a file's name, read like a header's, or "".
+func filenameDate(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	// Underscores join words, so \b would not see a date between them
+	name = strings.ReplaceAll(name, "_", " ")
+	if date := ExtractDateFromHeader(name); date != "" {
+		return date
+	}
+	if m := compactDate.FindStringSubmatch(name); m != nil {
+		if t, ok := calendarDate(m[1], monthNumber(m[2]), m[3]); ok {
+			return t.Format(dateLayout)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilenameDate(t *testing.T) {
+	for name, want := range map[string]string{
+		"daily/2026-01-21.md":         "2026-01-21",
+		"notes_2026-01-21_standup.md": "2026-01-21",
+		"20260121-retro.md":           "2026-01-21",
+		"21 Jan 2026 planning.md":     "2026-01-21",
+		"2026-W04.md":                 "2026-01-19",
+		"20261341.md":                 "",
+		"ideas.md":                    "",
+	} {
+		if got := filenameDate(name); got != want {
+			t.Fatalf("filenameDate(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestFileValidAt(t *testing.T) {
+	withLocation(t, time.UTC)
+	dir := t.TempDir()
+	dated := filepath.Join(dir, "2026-01-21.md")
+	undated := filepath.Join(dir, "ideas.md")
+	for _, path := range []string{dated, undated} {
+		if err := os.WriteFile(path, []byte("## Notes\n\nText\n"), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		modified := time.Date(2025, 11, 5, 12, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+	}
+
+	for _, c := range []struct {
+		path, validAt string
+		from          []string
+		want          string
+	}{
+		{dated, "2025-06-01", nil, "2025-06-01"},
+		{dated, "", nil, ""},
+		{dated, "2025-06-01", []string{"filename", "valid-at"}, "2026-01-21"},
+		{undated, "2025-06-01", []string{"filename", "valid-at"}, "2025-06-01"},
+		{undated, "", []string{"filename", "valid-at", "mtime"}, "2025-11-05"},
+		{undated, "", []string{"filename"}, ""},
+	} {
+		got, err := fileValidAt(c.path, c.validAt, c.from)
+		if err != nil || got != c.want {
+			t.Fatalf("fileValidAt(%s, %q, %q) = %q, %v; want %q", filepath.Base(c.path), c.validAt, c.from, got, err, c.want)
+		}
+	}
+
+	if _, err := parseDateFrom("filename,ctime"); err == nil {
+		t.Fatal("expected an unknown source rejected")
+	}
+}
+
+func TestIngestDirDateFromFilename(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	// Every chunk embeds alike here, which would make the second file a near-duplicate
+	withNearDuplicateThreshold(t, 0)
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"2026-01-21.md": "Standup notes\n",
+		"2026-01-22.md": "---\ndate: 2026-02-01\n---\nMoved from another day\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	opts := DirOptions{DateFrom: []string{dateFromFilename}}
+	if _, err := IngestDir(context.Background(), db, NewOllamaClient(server.URL, "embed"), dir, "", opts, defaultChunking, nil); err != nil {
+		t.Fatalf("IngestDir: %v", err)
+	}
+	for name, want := range map[string]string{"2026-01-21.md": "2026-01-21", "2026-01-22.md": "2026-02-01"} {
+		var validAt string
+		db.QueryRow(`SELECT valid_at FROM chunks WHERE source_file = ?`, filepath.Join(dir, name)).Scan(&validAt)
+		if validAt != want {
+			t.Fatalf("expected %s dated %s (the frontmatter before the name), got %q", name, want, validAt)
+		}
+	}
+}
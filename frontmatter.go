@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// tagSourceFrontmatter marks tags a note declared in its frontmatter.
+const tagSourceFrontmatter = "frontmatter"
+
+// Frontmatter is the metadata a note declares in a leading YAML block between "---"
+// lines, as Obsidian, Jekyll and Hugo write it.
+type Frontmatter struct {
+	Title string
+	Date  string // normalized like --valid-at; "" when missing or unparseable
+	Tags  []string
+	// Fields holds every key as written, lists joined by ", ".
+	Fields map[string]string
+}
+
+// readFrontmatter consumes a frontmatter block at the start of r, if there is one, and
+// returns the document after it. A document that opens with "---" but never closes it
+// has none; rest then starts from the top again.
+func readFrontmatter(r *bufio.Reader) (fm Frontmatter, rest io.Reader, err error) {
+	if first, err := r.Peek(4); err != nil || (string(first) != "---\n" && string(first) != "---\r") {
+		return fm, r, nil
+	}
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		lines = append(lines, line)
+		if err == io.EOF {
+			// Not frontmatter after all: a thematic break opening the document
+			return fm, io.MultiReader(strings.NewReader(strings.Join(lines, "")), r), nil
+		}
+		if err != nil {
+			return fm, r, err
+		}
+		if trimmed := strings.TrimRight(line, "\r\n"); len(lines) > 1 && (trimmed == "---" || trimmed == "...") {
+			break
+		}
+	}
+	return parseFrontmatter(lines[1 : len(lines)-1]), r, nil
+}
+
+// parseFrontmatter reads the subset of YAML notes use: "key: value" scalars, quoted or
+// not, and lists written inline as [a, b] or as "- item" lines under their key. Nested
+// mappings and multi-line strings are skipped.
+func parseFrontmatter(lines []string) Frontmatter {
+	fm := Frontmatter{Fields: make(map[string]string)}
+	lists := make(map[string][]string)
+	key := ""
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") && key != "" && line != trimmed {
+			lists[key] = append(lists[key], unquoteYAML(trimmed[2:]))
+			continue
+		}
+		if line != trimmed {
+			// Nested under a key that is not a list
+			continue
+		}
+		name, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			key = ""
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquoteYAML(item); item != "" {
+					lists[key] = append(lists[key], item)
+				}
+			}
+		case value != "" && value != "|" && value != ">":
+			fm.Fields[key] = unquoteYAML(value)
+		}
+	}
+	for key, items := range lists {
+		fm.Fields[key] = strings.Join(items, ", ")
+	}
+
+	fm.Title = fm.Fields["title"]
+	for _, key := range []string{"date", "created"} {
+		if date, err := NormalizeDate(fm.Fields[key]); err == nil && date != "" {
+			fm.Date = date
+			break
+		}
+	}
+	tags := lists["tags"]
+	if tags == nil && fm.Fields["tags"] != "" {
+		// tags: a, b or tags: a b
+		tags = strings.FieldsFunc(fm.Fields["tags"], func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if tag = normalizeTag(tag); tag != "" && !seen[tag] {
+			seen[tag] = true
+			fm.Tags = append(fm.Tags, tag)
+		}
+	}
+	return fm
+}
+
+// unquoteYAML trims a scalar and the quotes around it.
+func unquoteYAML(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFrontmatter(t *testing.T) {
+	withLocation(t, time.UTC)
+	fm := parseFrontmatter(strings.Split(`title: "Token rotation"
+date: 2025-06-02
+aliases: [rotation, 'key rollover']
+tags:
+  - Security
+  - "#auth/tokens"
+  - security
+cssclass: wide
+nested:
+  key: value
+# a comment
+`, "\n"))
+	if fm.Title != "Token rotation" || fm.Date != "2025-06-02" {
+		t.Fatalf("unexpected title and date: %+v", fm)
+	}
+	if !reflect.DeepEqual(fm.Tags, []string{"security", "auth/tokens"}) {
+		t.Fatalf("expected normalized, deduplicated tags, got %q", fm.Tags)
+	}
+	if fm.Fields["aliases"] != "rotation, key rollover" || fm.Fields["cssclass"] != "wide" {
+		t.Fatalf("unexpected fields %v", fm.Fields)
+	}
+	if _, ok := fm.Fields["key"]; ok {
+		t.Fatalf("expected nested keys skipped, got %v", fm.Fields)
+	}
+
+	fm = parseFrontmatter([]string{"created: 2025-06-03T10:00:00Z", "tags: [work, hiring]"})
+	if fm.Date != "2025-06-03" || !reflect.DeepEqual(fm.Tags, []string{"work", "hiring"}) {
+		t.Fatalf("expected created as the date and inline tags, got %+v", fm)
+	}
+	if fm := parseFrontmatter([]string{"date: someday", "tags: one two"}); fm.Date != "" || !reflect.DeepEqual(fm.Tags, []string{"one", "two"}) {
+		t.Fatalf("expected an unparseable date ignored and space-separated tags, got %+v", fm)
+	}
+}
+
+func TestReadFrontmatter(t *testing.T) {
+	fm, rest, err := readFrontmatter(bufio.NewReader(strings.NewReader("---\ntitle: Note\n---\n## Body\n")))
+	body, _ := io.ReadAll(rest)
+	if err != nil || fm.Title != "Note" || string(body) != "## Body\n" {
+		t.Fatalf("expected the block consumed, got %+v, %q, %v", fm, body, err)
+	}
+
+	// A thematic break that is never closed is the document's own
+	doc := "---\nJust a rule above.\n"
+	fm, rest, err = readFrontmatter(bufio.NewReader(strings.NewReader(doc)))
+	body, _ = io.ReadAll(rest)
+	if err != nil || fm.Fields != nil || string(body) != doc {
+		t.Fatalf("expected no frontmatter, got %+v, %q, %v", fm, body, err)
+	}
+	_, rest, _ = readFrontmatter(bufio.NewReader(strings.NewReader("## Title\n")))
+	if body, _ = io.ReadAll(rest); string(body) != "## Title\n" {
+		t.Fatalf("expected a document without frontmatter untouched, got %q", body)
+	}
+}
+
+func TestIngestFrontmatter(t *testing.T) {
+	withLocation(t, time.UTC)
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	path := filepath.Join(t.TempDir(), "note.md")
+	note := "---\ntitle: Rotation plan\ndate: 2025-06-02\ntags: [security, auth]\n---\nWe rotate weekly.\n\n## Review on June 9, 2025\n\nStill weekly.\n"
+	if err := os.WriteFile(path, []byte(note), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := IngestFile(context.Background(), db, client, path, "", defaultChunking); err != nil {
+		t.Fatalf("IngestFile: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT section_title, valid_at, text FROM chunks ORDER BY section_sequence`)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var got []string
+	for rows.Next() {
+		var title, validAt, text string
+		rows.Scan(&title, &validAt, &text)
+		if strings.Contains(text, "tags:") {
+			t.Fatalf("expected the frontmatter out of the chunk text, got %q", text)
+		}
+		got = append(got, title+"@"+validAt)
+	}
+	rows.Close()
+	if !reflect.DeepEqual(got, []string{"Rotation plan@2025-06-02", "Review on June 9, 2025@2025-06-09"}) {
+		t.Fatalf("expected the title and date from the frontmatter, header dates first, got %v", got)
+	}
+
+	tags, err := ListTags(db, tagSourceFrontmatter, 0)
+	if err != nil || len(tags) != 2 || tags[0].Chunks != 2 {
+		t.Fatalf("expected both tags on both chunks, got %+v, %v", tags, err)
+	}
+	// Ingesting again replaces the chunks, their tags with them
+	if _, err := IngestFile(context.Background(), db, client, path, "", defaultChunking); err != nil {
+		t.Fatalf("IngestFile: %v", err)
+	}
+	var tagged int
+	db.QueryRow(`SELECT COUNT(*) FROM chunk_tags`).Scan(&tagged)
+	if tagged != 4 {
+		t.Fatalf("expected 4 tags after re-ingesting, got %d", tagged)
+	}
+}
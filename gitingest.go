@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitSourcePrefix starts the source_file of every commit and pull request ingested from a
+// repository, followed by the repository name: git://<repo>/<commit> or git://<repo>/pr-<n>.
+const gitSourcePrefix = "git://"
+
+type gitCommit struct {
+	Hash    string
+	Author  string
+	Date    time.Time
+	Subject string
+	Body    string
+	// Files lists what the commit changed, read only with GitOptions.Diff
+	Files []gitFileChange
+}
+
+// gitFileChange is one line of git log --numstat.
+type gitFileChange struct {
+	Path           string
+	Added, Deleted int
+	Binary         bool
+}
+
+// GitOptions selects the history ingest-git reads.
+type GitOptions struct {
+	// Name attributes the chunks; the repository's directory name when empty
+	Name string
+	// Since and Author are passed to git log as --since and --author
+	Since  string
+	Author string
+	Limit  int
+	Merges bool
+	// Diff adds a summary of the files each commit changed
+	Diff bool
+	// PRs is a GitHub pull request export, from
+	// gh pr list --state all --json number,title,body,author,createdAt,mergedAt,url
+	PRs string
+}
+
+type GitIngestResult struct {
+	Repo         string
+	Commits      int
+	PullRequests int
+	// Skipped counts commits and pull requests stored by an earlier run
+	Skipped int
+}
+
+// Field and record separators that cannot appear in a commit message
+const (
+	gitFieldSep  = "\x1f"
+	gitRecordSep = "\x1e"
+)
+
+// gitDiffFiles caps how many changed files a commit's summary names.
+const gitDiffFiles = 10
+
+// readGitCommits lists the commits of the repository at repo, newest first.
+func readGitCommits(ctx context.Context, repo string, opts GitOptions) ([]gitCommit, error) {
+	// Each record ends in a field separator, so the --numstat lines git prints after the
+	// formatted message are a field of their own
+	args := []string{"-C", repo, "log", "--format=" + gitRecordSep + "%H" + gitFieldSep + "%an" + gitFieldSep + "%aI" + gitFieldSep + "%s" + gitFieldSep + "%b" + gitFieldSep}
+	if opts.Diff {
+		args = append(args, "--numstat")
+	}
+	if !opts.Merges {
+		args = append(args, "--no-merges")
+	}
+	if opts.Since != "" {
+		args = append(args, "--since="+opts.Since)
+	}
+	if opts.Author != "" {
+		args = append(args, "--author="+opts.Author)
+	}
+	if opts.Limit > 0 {
+		args = append(args, fmt.Sprintf("-n%d", opts.Limit))
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var commits []gitCommit
+	for _, record := range strings.Split(string(out), gitRecordSep) {
+		record = strings.TrimLeft(record, "\n")
+		if record == "" {
+			continue
+		}
+		fields := strings.SplitN(record, gitFieldSep, 6)
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("git log: unexpected record %q", record)
+		}
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("git log: commit %s: %w", fields[0], err)
+		}
+		commits = append(commits, gitCommit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Date:    date,
+			Subject: strings.TrimSpace(fields[3]),
+			Body:    strings.TrimSpace(fields[4]),
+			Files:   parseNumstat(fields[5]),
+		})
+	}
+	return commits, nil
+}
+
+// parseNumstat reads git's "added<TAB>deleted<TAB>path" lines, where binary files count
+// "-" for both.
+func parseNumstat(out string) []gitFileChange {
+	var files []gitFileChange
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		change := gitFileChange{Path: parts[2], Binary: parts[0] == "-"}
+		change.Added, _ = strconv.Atoi(parts[0])
+		change.Deleted, _ = strconv.Atoi(parts[1])
+		files = append(files, change)
+	}
+	return files
+}
+
+// summarizeDiff describes the files a commit changed, the most changed first:
+// "Changed 3 files (+42 -7): auth/session.go (+30 -2), ...".
+func summarizeDiff(files []gitFileChange) string {
+	sorted := append([]gitFileChange(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Added+sorted[i].Deleted > sorted[j].Added+sorted[j].Deleted
+	})
+	added, deleted := 0, 0
+	var names []string
+	for i, f := range sorted {
+		added += f.Added
+		deleted += f.Deleted
+		if i >= gitDiffFiles {
+			continue
+		}
+		if f.Binary {
+			names = append(names, f.Path+" (binary)")
+		} else {
+			names = append(names, fmt.Sprintf("%s (+%d -%d)", f.Path, f.Added, f.Deleted))
+		}
+	}
+	if len(sorted) > gitDiffFiles {
+		names = append(names, fmt.Sprintf("and %d more", len(sorted)-gitDiffFiles))
+	}
+	noun := "files"
+	if len(sorted) == 1 {
+		noun = "file"
+	}
+	return fmt.Sprintf("Changed %d %s (+%d -%d): %s.", len(sorted), noun, added, deleted, strings.Join(names, ", "))
+}
+
+// gitRepoName is the name commits are attributed to: the top-level directory's name.
+func gitRepoName(ctx context.Context, repo string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", repo, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s is not a git repository: %w", repo, err)
+	}
+	return filepath.Base(strings.TrimSpace(string(out))), nil
+}
+
+// buildCommitMarkdown renders a commit as one dated section titled by its subject, so the
+// why in the body is searchable next to the what, and with a diff, where it happened.
+func buildCommitMarkdown(repo string, c gitCommit) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s (%s)\n\n", c.Subject, c.Date.In(mnemeLocation).Format("January 2, 2006"))
+	if c.Body != "" {
+		b.WriteString(demoteHeadings(c.Body) + "\n\n")
+	}
+	if len(c.Files) > 0 {
+		b.WriteString(summarizeDiff(c.Files) + "\n\n")
+	}
+	fmt.Fprintf(&b, "Commit %s by %s in %s.\n", shortHash(c.Hash), c.Author, repo)
+	return b.String()
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+type gitPullRequest struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Author struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	CreatedAt string `json:"createdAt"`
+	MergedAt  string `json:"mergedAt"`
+	URL       string `json:"url"`
+}
+
+func readPullRequests(path string) ([]gitPullRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prs []gitPullRequest
+	if err := json.Unmarshal(data, &prs); err != nil {
+		return nil, fmt.Errorf("%s: want the JSON array of gh pr list --json: %w", path, err)
+	}
+	return prs, nil
+}
+
+// buildPullRequestMarkdown renders a pull request dated when it merged, or when it was
+// opened if it never did.
+func buildPullRequestMarkdown(repo string, pr gitPullRequest) string {
+	var b strings.Builder
+	date := pr.MergedAt
+	if date == "" {
+		date = pr.CreatedAt
+	}
+	heading := fmt.Sprintf("PR #%d: %s", pr.Number, pr.Title)
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		heading += " (" + t.In(mnemeLocation).Format("January 2, 2006") + ")"
+	}
+	fmt.Fprintf(&b, "## %s\n\n", heading)
+	if body := strings.TrimSpace(pr.Body); body != "" {
+		b.WriteString(demoteHeadings(body) + "\n\n")
+	}
+	line := fmt.Sprintf("Pull request #%d", pr.Number)
+	if pr.Author.Login != "" {
+		line += " by " + pr.Author.Login
+	}
+	line += " in " + repo
+	if pr.URL != "" {
+		line += ", " + pr.URL
+	}
+	b.WriteString(line + ".\n")
+	return b.String()
+}
+
+// demoteHeadings turns markdown headings into bold lines, which would otherwise split a
+// commit or pull request description from its title.
+func demoteHeadings(md string) string {
+	lines := strings.Split(md, "\n")
+	for i, line := range lines {
+		if trimmed := strings.TrimLeft(line, "#"); trimmed != line && strings.HasPrefix(trimmed, " ") {
+			lines[i] = "**" + strings.TrimSpace(trimmed) + "**"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// IngestGit ingests the commit messages of the repository at repo, and the pull requests
+// of opts.PRs, each as its own source so a later run only adds what is new.
+func IngestGit(ctx context.Context, db *sql.DB, ollama *OllamaClient, repo string, opts GitOptions, progress ProgressFunc) (GitIngestResult, error) {
+	var result GitIngestResult
+	name := opts.Name
+	if name == "" {
+		var err error
+		if name, err = gitRepoName(ctx, repo); err != nil {
+			return result, err
+		}
+	}
+	result.Repo = name
+
+	commits, err := readGitCommits(ctx, repo, opts)
+	if err != nil {
+		return result, err
+	}
+	var prs []gitPullRequest
+	if opts.PRs != "" {
+		if prs, err = readPullRequests(opts.PRs); err != nil {
+			return result, err
+		}
+	}
+
+	stored, err := storedSources(db, gitSourcePrefix+name+"/")
+	if err != nil {
+		return result, err
+	}
+	type item struct {
+		sourceFile, md string
+		pr             bool
+	}
+	var items []item
+	for _, c := range commits {
+		items = append(items, item{sourceFile: gitSourcePrefix + name + "/" + shortHash(c.Hash), md: buildCommitMarkdown(name, c)})
+	}
+	for _, pr := range prs {
+		items = append(items, item{sourceFile: fmt.Sprintf("%s%s/pr-%d", gitSourcePrefix, name, pr.Number), md: buildPullRequestMarkdown(name, pr), pr: true})
+	}
+
+	for i, it := range items {
+		if progress != nil {
+			progress(i, len(items), it.sourceFile)
+		}
+		if stored[it.sourceFile] {
+			result.Skipped++
+			continue
+		}
+		if _, err := ingestMarkdownSource(ctx, db, ollama, it.sourceFile, it.md); err != nil {
+			return result, fmt.Errorf("ingest %s: %w", it.sourceFile, err)
+		}
+		if it.pr {
+			result.PullRequests++
+		} else {
+			result.Commits++
+		}
+	}
+	if progress != nil && len(items) > 0 {
+		progress(len(items), len(items), "")
+	}
+	return result, nil
+}
+
+// storedSources returns the source files already holding chunks under prefix, which must
+// end in "/". The range (rather than LIKE) lets the source_file index serve it.
+func storedSources(db *sql.DB, prefix string) (map[string]bool, error) {
+	end := strings.TrimSuffix(prefix, "/") + "0" // '0' follows '/'
+	rows, err := db.Query(`SELECT DISTINCT source_file FROM chunks WHERE source_file >= ? AND source_file < ?`, prefix, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			return nil, err
+		}
+		stored[source] = true
+	}
+	return stored, rows.Err()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitRepo creates a repository at dir/name with one commit per message, dated a day apart.
+func gitRepo(t *testing.T, dir, name string, messages ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := filepath.Join(dir, name)
+	git := func(env []string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(), append([]string{"GIT_AUTHOR_NAME=Sam", "GIT_AUTHOR_EMAIL=sam@example.com", "GIT_COMMITTER_NAME=Sam", "GIT_COMMITTER_EMAIL=sam@example.com"}, env...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	if err := os.MkdirAll(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	git(nil, "init", "-q")
+	for i, message := range messages {
+		date := time.Date(2025, 3, 10+i, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		git([]string{"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}, "commit", "-q", "--allow-empty", "-m", message)
+	}
+	return repo
+}
+
+func TestReadGitCommits(t *testing.T) {
+	withLocation(t, time.UTC)
+	repo := gitRepo(t, t.TempDir(), "api", "Add login endpoint", "Move auth to sessions\n\nJWTs could not be revoked.\n\n## Notes\nCookies are httpOnly.")
+
+	commits, err := readGitCommits(context.Background(), repo, GitOptions{})
+	if err != nil {
+		t.Fatalf("readGitCommits: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "Move auth to sessions" || commits[1].Subject != "Add login endpoint" {
+		t.Fatalf("expected both commits newest first, got %+v", commits)
+	}
+	if !strings.HasPrefix(commits[0].Body, "JWTs could not be revoked.") || commits[0].Author != "Sam" {
+		t.Fatalf("unexpected commit %+v", commits[0])
+	}
+
+	md := buildCommitMarkdown("api", commits[0])
+	sections := ParseMarkdown(md)
+	if len(sections) != 1 {
+		t.Fatalf("expected the body kept in one section, got %+v", sections)
+	}
+	if sections[0].Title != "Move auth to sessions (March 11, 2025)" || sections[0].ValidAt != "2025-03-11" {
+		t.Fatalf("expected a dated section titled by the subject, got %q, %q", sections[0].Title, sections[0].ValidAt)
+	}
+	if !strings.Contains(sections[0].Content, "**Notes**") || !strings.Contains(sections[0].Content, "Commit "+commits[0].Hash[:12]+" by Sam in api.") {
+		t.Fatalf("unexpected content %q", sections[0].Content)
+	}
+
+	if commits, err := readGitCommits(context.Background(), repo, GitOptions{Limit: 1}); err != nil || len(commits) != 1 {
+		t.Fatalf("expected one commit with a limit, got %d, %v", len(commits), err)
+	}
+}
+
+func TestIngestGit(t *testing.T) {
+	withLocation(t, time.UTC)
+	dir := t.TempDir()
+	repo := gitRepo(t, dir, "api", "Add login endpoint", "Move auth to sessions")
+	prs := filepath.Join(dir, "prs.json")
+	os.WriteFile(prs, []byte(`[{"number": 7, "title": "Session auth", "body": "Replaces JWTs.", "author": {"login": "sam"}, "createdAt": "2025-03-11T09:00:00Z", "mergedAt": "2025-03-12T09:00:00Z", "url": "https://github.com/sam/api/pull/7"}]`), 0o644)
+
+	db, err := InitDB(filepath.Join(dir, "mneme.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	ollama := NewOllamaClient(server.URL, "embed")
+
+	result, err := IngestGit(context.Background(), db, ollama, repo, GitOptions{PRs: prs}, nil)
+	if err != nil {
+		t.Fatalf("IngestGit: %v", err)
+	}
+	if result.Repo != "api" || result.Commits != 2 || result.PullRequests != 1 || result.Skipped != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	var validAt string
+	if err := db.QueryRow(`SELECT valid_at FROM chunks WHERE source_file = 'git://api/pr-7'`).Scan(&validAt); err != nil || validAt != "2025-03-12" {
+		t.Fatalf("expected the pull request dated when it merged, got %q, %v", validAt, err)
+	}
+
+	// A second run only adds the new commit
+	gitRepo(t, dir, "api", "Expire idle sessions")
+	if result, err = IngestGit(context.Background(), db, ollama, repo, GitOptions{PRs: prs}, nil); err != nil {
+		t.Fatalf("IngestGit: %v", err)
+	}
+	if result.Commits != 1 || result.PullRequests != 0 || result.Skipped != 3 {
+		t.Fatalf("expected only the new commit ingested, got %+v", result)
+	}
+}
+
+func TestReadGitCommitsDiff(t *testing.T) {
+	withLocation(t, time.UTC)
+	repo := gitRepo(t, t.TempDir(), "api", "Initial commit")
+	os.MkdirAll(filepath.Join(repo, "auth"), 0o755)
+	os.WriteFile(filepath.Join(repo, "auth", "session.go"), []byte("package auth\n\nfunc Expire() {}\n"), 0o644)
+	os.WriteFile(filepath.Join(repo, "logo.png"), []byte{0x89, 'P', 'N', 'G', 0, 0, 1}, 0o644)
+	cmd := exec.Command("sh", "-c", `git add -A && git commit -q -m "Expire idle sessions"`)
+	cmd.Dir = repo
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Sam", "GIT_AUTHOR_EMAIL=sam@example.com", "GIT_COMMITTER_NAME=Sam", "GIT_COMMITTER_EMAIL=sam@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit: %v: %s", err, out)
+	}
+
+	commits, err := readGitCommits(context.Background(), repo, GitOptions{Diff: true})
+	if err != nil {
+		t.Fatalf("readGitCommits: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "Expire idle sessions" || len(commits[0].Files) != 2 || len(commits[1].Files) != 0 {
+		t.Fatalf("expected the changed files read with each commit, got %+v", commits)
+	}
+	md := buildCommitMarkdown("api", commits[0])
+	if !strings.Contains(md, "Changed 2 files (+3 -0): auth/session.go (+3 -0), logo.png (binary).") {
+		t.Fatalf("expected a diff summary, got %q", md)
+	}
+
+	if commits, err := readGitCommits(context.Background(), repo, GitOptions{}); err != nil || len(commits[0].Files) != 0 {
+		t.Fatalf("expected no files read without a diff, got %+v, %v", commits, err)
+	}
+}
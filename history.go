@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
 )
 
 // entityAliases maps entity names to their known aliases.
@@ -66,9 +70,13 @@ type HistoryResult struct {
 	ParentTitle  string
 	ValidAt      string
 	IngestedAt   string
+	Distance     float64 `json:",omitempty"`
 }
 
-// History searches chunks for entity (and its aliases) and returns results in chronological order.
+// History returns chunks mentioning entity (or any of its aliases) in chronological order.
+// Names known to the entity index are resolved through chunk_entities; other names are looked
+// up in the chunks_fts word index when FTS5 is available, or a LIKE scan otherwise. Both are
+// filtered to whole-word matches, so "Go" never matches "going" or "Google".
 // NULLs in valid_at come first (timeless before dated), then sorted by valid_at ASC, then section_sequence ASC.
 // If limit <= 0, defaults to 20.
 func History(db *sql.DB, entity string, limit int) ([]HistoryResult, error) {
@@ -78,21 +86,48 @@ func History(db *sql.DB, entity string, limit int) ([]HistoryResult, error) {
 
 	names := resolveAliases(entity)
 
-	conditions := make([]string, len(names))
-	args := make([]any, len(names))
-	for i, name := range names {
-		conditions[i] = "text LIKE ? ESCAPE '\\' COLLATE NOCASE"
-		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(name)
-		args[i] = "%" + escaped + "%"
+	entityIDs, unindexed, err := lookupEntityIDs(db, names)
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks linked to a known entity through chunk_entities are flagged in the select
+	// list. Everything else matched an unindexed name in the chunks_fts word index, or in
+	// the raw text when there is no FTS5 or the name has no word characters, and still
+	// needs a whole-word check.
+	var conditions []string
+	var idArgs []any
+	indexedExpr := "0"
+	if len(entityIDs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(entityIDs)), ",")
+		indexedExpr = fmt.Sprintf("id IN (SELECT chunk_id FROM chunk_entities WHERE entity_id IN (%s))", placeholders)
+		conditions = append(conditions, indexedExpr)
+		for _, id := range entityIDs {
+			idArgs = append(idArgs, id)
+		}
+	}
+	args := append(append([]any{}, idArgs...), idArgs...)
+	var phrases []string
+	for _, name := range unindexed {
+		if fts5Available && strings.IndexFunc(name, isWordRune) >= 0 {
+			phrases = append(phrases, ftsPhrase(name))
+			continue
+		}
+		// Names with no word characters produce no FTS tokens, so scan the raw text
+		conditions = append(conditions, "text LIKE ? ESCAPE '\\' COLLATE NOCASE")
+		args = append(args, "%"+escapeLike(name)+"%")
+	}
+	if len(phrases) > 0 {
+		conditions = append(conditions, "id IN (SELECT rowid FROM chunks_fts WHERE chunks_fts MATCH ?)")
+		args = append(args, strings.Join(phrases, " OR "))
 	}
-	args = append(args, limit)
 
 	query := fmt.Sprintf(
-		`SELECT id, text, source_file, section_title, parent_title, valid_at, ingested_at
+		`SELECT id, text, source_file, section_title, parent_title, valid_at, ingested_at, %s
 		 FROM chunks
 		 WHERE (%s)
-		 ORDER BY CASE WHEN valid_at IS NULL THEN 0 ELSE 1 END, valid_at ASC, section_sequence ASC
-		 LIMIT ?`,
+		 ORDER BY CASE WHEN valid_at IS NULL THEN 0 ELSE 1 END, valid_at ASC, section_sequence ASC`,
+		indexedExpr,
 		strings.Join(conditions, " OR "),
 	)
 
@@ -107,6 +142,7 @@ func History(db *sql.DB, entity string, limit int) ([]HistoryResult, error) {
 		var result HistoryResult
 		var parentTitle sql.NullString
 		var validAt sql.NullString
+		var indexed bool
 		if err := rows.Scan(
 			&result.ID,
 			&result.Text,
@@ -115,9 +151,13 @@ func History(db *sql.DB, entity string, limit int) ([]HistoryResult, error) {
 			&parentTitle,
 			&validAt,
 			&result.IngestedAt,
+			&indexed,
 		); err != nil {
 			return nil, err
 		}
+		if !indexed && !mentionsAny(result.Text, unindexed) {
+			continue
+		}
 		if parentTitle.Valid {
 			result.ParentTitle = parentTitle.String
 		}
@@ -125,6 +165,9 @@ func History(db *sql.DB, entity string, limit int) ([]HistoryResult, error) {
 			result.ValidAt = validAt.String
 		}
 		results = append(results, result)
+		if len(results) >= limit {
+			break
+		}
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -132,3 +175,291 @@ func History(db *sql.DB, entity string, limit int) ([]HistoryResult, error) {
 
 	return results, nil
 }
+
+// TypeHistory returns chunks mentioning any entity of the given type (person, project,
+// place, tool) in the same chronological order as History. If limit <= 0, defaults to 20.
+func TypeHistory(db *sql.DB, kind string, limit int) ([]HistoryResult, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	kind, err := normalizeEntityKind(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := cachedStmt(db,
+		`SELECT id, text, source_file, section_title, parent_title, valid_at, ingested_at
+		 FROM chunks
+		 WHERE id IN (SELECT ce.chunk_id FROM chunk_entities ce JOIN entities e ON e.id = ce.entity_id WHERE e.kind = ?)
+		 ORDER BY CASE WHEN valid_at IS NULL THEN 0 ELSE 1 END, valid_at ASC, section_sequence ASC
+		 LIMIT ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.Query(kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []HistoryResult{}
+	for rows.Next() {
+		var result HistoryResult
+		var parentTitle, validAt sql.NullString
+		if err := rows.Scan(&result.ID, &result.Text, &result.SourceFile, &result.SectionTitle, &parentTitle, &validAt, &result.IngestedAt); err != nil {
+			return nil, err
+		}
+		result.ParentTitle = parentTitle.String
+		result.ValidAt = validAt.String
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// SemanticHistory embeds the entity name (with its aliases) and returns the closest chunks
+// in chronological order, catching mentions that paraphrase the entity ("my manager").
+// With intersect, only chunks that also mention the entity by name are kept.
+// If limit <= 0, defaults to 20.
+func SemanticHistory(ctx context.Context, db *sql.DB, ollama *OllamaClient, entity string, limit int, intersect bool) ([]HistoryResult, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	names := resolveAliases(entity)
+
+	embedding, err := ollama.Embed(ctx, strings.Join(names, ", "))
+	if err != nil {
+		return nil, err
+	}
+	serialized, err := sqlite_vec.SerializeFloat32(embedding)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchLimit := limit
+	var linked map[int]bool
+	var unindexed []string
+	if intersect {
+		fetchLimit = limit * 3
+		if linked, unindexed, err = entityLinkedChunks(db, names); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, err := cachedStmt(db,
+		`SELECT c.id, c.text, c.source_file, c.section_title, c.parent_title, c.valid_at, c.ingested_at, c.section_sequence, v.distance
+		 FROM vec_chunks v
+		 JOIN chunks c ON c.id = v.chunk_id
+		 WHERE v.embedding MATCH ? AND v.k = ?
+		 ORDER BY v.distance`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, serialized, fetchLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type ranked struct {
+		result   HistoryResult
+		sequence sql.NullInt64
+	}
+	var candidates []ranked
+	for rows.Next() {
+		var r ranked
+		var parentTitle sql.NullString
+		var validAt sql.NullString
+		if err := rows.Scan(
+			&r.result.ID,
+			&r.result.Text,
+			&r.result.SourceFile,
+			&r.result.SectionTitle,
+			&parentTitle,
+			&validAt,
+			&r.result.IngestedAt,
+			&r.sequence,
+			&r.result.Distance,
+		); err != nil {
+			return nil, err
+		}
+		if intersect && !linked[r.result.ID] && !mentionsAny(r.result.Text, unindexed) {
+			continue
+		}
+		r.result.ParentTitle = parentTitle.String
+		r.result.ValidAt = validAt.String
+		candidates = append(candidates, r)
+		if len(candidates) >= limit {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Same ordering as History: timeless first, then valid_at, then section order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		left, right := candidates[i], candidates[j]
+		if (left.result.ValidAt == "") != (right.result.ValidAt == "") {
+			return left.result.ValidAt == ""
+		}
+		if left.result.ValidAt != right.result.ValidAt {
+			return left.result.ValidAt < right.result.ValidAt
+		}
+		return left.sequence.Int64 < right.sequence.Int64
+	})
+
+	results := make([]HistoryResult, 0, len(candidates))
+	for _, c := range candidates {
+		results = append(results, c.result)
+	}
+	return results, nil
+}
+
+// keepTagged narrows history results to chunks carrying tag, keeping their order and at
+// most limit of them. Callers fetch extra results to leave enough after filtering.
+func keepTagged(db *sql.DB, results []HistoryResult, tag string, limit int) ([]HistoryResult, error) {
+	tagged, err := chunksWithTag(db, tag)
+	if err != nil {
+		return nil, err
+	}
+	kept := results[:0]
+	for _, result := range results {
+		if tagged[int64(result.ID)] && len(kept) < limit {
+			kept = append(kept, result)
+		}
+	}
+	return kept, nil
+}
+
+// entityLinkedChunks returns the ids of chunks linked to any known entity in names,
+// plus the names that have no entity row and must be matched in text instead.
+func entityLinkedChunks(db *sql.DB, names []string) (map[int]bool, []string, error) {
+	entityIDs, unindexed, err := lookupEntityIDs(db, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	stmt, err := cachedStmt(db, `SELECT chunk_id FROM chunk_entities WHERE entity_id = ?`)
+	if err != nil {
+		return nil, nil, err
+	}
+	linked := make(map[int]bool)
+	for _, id := range entityIDs {
+		rows, err := stmt.Query(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		for rows.Next() {
+			var chunkID int
+			if err := rows.Scan(&chunkID); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			linked[chunkID] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return linked, unindexed, nil
+}
+
+// lookupEntityIDs splits names into ids of known entities (by name or stored alias)
+// and names with no entity row. An alias shared by several entities contributes all
+// of them and is also returned as unindexed, so mentions left undecided still match.
+func lookupEntityIDs(db *sql.DB, names []string) ([]int64, []string, error) {
+	var ids []int64
+	var unindexed []string
+	seen := make(map[int64]bool)
+	for _, name := range names {
+		matched, err := entityIDsForName(db, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(matched) != 1 {
+			unindexed = append(unindexed, name)
+		}
+		for _, id := range matched {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, unindexed, nil
+}
+
+// entityIDsForName returns the entity called name, or failing that every entity
+// carrying name as an alias.
+func entityIDsForName(db *sql.DB, name string) ([]int64, error) {
+	name = strings.TrimSpace(name)
+	byName, err := cachedStmt(db, `SELECT id FROM entities WHERE name = ?`)
+	if err != nil {
+		return nil, err
+	}
+	var id int64
+	err = byName.QueryRow(name).Scan(&id)
+	if err == nil {
+		return []int64{id}, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	byAlias, err := cachedStmt(db, `SELECT entity_id FROM entity_aliases WHERE alias = ? ORDER BY entity_id`)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := byAlias.Query(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// findEntityID resolves a name to a single entity id, checking canonical names before
+// aliases. Returns sql.ErrNoRows when neither matches, and an error when the name is
+// an alias shared by several entities.
+func findEntityID(db *sql.DB, name string) (int64, error) {
+	ids, err := entityIDsForName(db, name)
+	if err != nil {
+		return 0, err
+	}
+	switch len(ids) {
+	case 0:
+		return 0, sql.ErrNoRows
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, fmt.Errorf("%q is an alias of %d entities; use the full name", strings.TrimSpace(name), len(ids))
+	}
+}
+
+// ftsPhrase quotes name as an FTS5 phrase so its words must appear together, in order.
+func ftsPhrase(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func mentionsAny(text string, names []string) bool {
+	for _, name := range names {
+		if len(findMentions(text, name)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
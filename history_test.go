@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 )
@@ -141,12 +142,13 @@ func TestHistoryCaseInsensitive(t *testing.T) {
 	}
 	defer db.Close()
 
-	// Insert chunks with different cases
+	// Insert chunks with different cases; GoLang and going are different words
 	testChunks := []string{
 		"Learning Go programming",
 		"go is lowercase",
 		"GO is uppercase",
 		"GoLang mixed case",
+		"going nowhere",
 	}
 
 	for i, text := range testChunks {
@@ -166,8 +168,8 @@ func TestHistoryCaseInsensitive(t *testing.T) {
 		t.Fatalf("History failed: %v", err)
 	}
 
-	if len(results) != 4 {
-		t.Errorf("Expected 4 results for case-insensitive search, got %d", len(results))
+	if len(results) != 3 {
+		t.Errorf("Expected 3 results for case-insensitive search, got %d", len(results))
 	}
 }
 
@@ -274,3 +276,184 @@ func TestHistoryLimit(t *testing.T) {
 		t.Errorf("Expected 10 results (all available) with limit=-1, got %d", len(results))
 	}
 }
+
+func TestHistoryWholeWords(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	defer db.Close()
+
+	texts := []string{
+		"Rewrote the parser in Go.",
+		"Going to Google tomorrow",
+		"(go) is fine",
+		"Ergo, nothing",
+	}
+	for i, text := range texts {
+		_, err := db.Exec(
+			`INSERT INTO chunks (text, source_file, section_title, section_sequence, valid_at, ingested_at)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			text, "test.md", "Test", i, nil, "2025-01-31",
+		)
+		if err != nil {
+			t.Fatalf("Insert chunk failed: %v", err)
+		}
+	}
+
+	results, err := History(db, "Go", 10)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 whole-word matches, got %d", len(results))
+	}
+	if results[0].Text != texts[0] || results[1].Text != texts[2] {
+		t.Errorf("Unexpected matches: %q, %q", results[0].Text, results[1].Text)
+	}
+}
+
+func TestHistoryEntityIndex(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	defer db.Close()
+
+	var ids []int64
+	for i, text := range []string{"Met Dana for coffee", "Dana's launch went well", "Danaher earnings call"} {
+		res, err := db.Exec(
+			`INSERT INTO chunks (text, source_file, section_title, section_sequence, valid_at, ingested_at)
+			 VALUES (?, ?, ?, ?, ?, ?)`,
+			text, "test.md", "Test", i, "2025-01-1"+string(rune('0'+i)), "2025-01-31",
+		)
+		if err != nil {
+			t.Fatalf("Insert chunk failed: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		ids = append(ids, id)
+	}
+
+	res, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES ('Dana', 'person', '2025-01-31')`)
+	if err != nil {
+		t.Fatalf("Insert entity failed: %v", err)
+	}
+	entityID, _ := res.LastInsertId()
+	if err := IndexChunkMentions(db, ids); err != nil {
+		t.Fatalf("IndexChunkMentions failed: %v", err)
+	}
+
+	var start, end int
+	if err := db.QueryRow(`SELECT start_pos, end_pos FROM entity_mentions WHERE entity_id = ? AND chunk_id = ?`, entityID, ids[0]).Scan(&start, &end); err != nil {
+		t.Fatalf("Query mention failed: %v", err)
+	}
+	if start != 4 || end != 8 {
+		t.Errorf("Expected mention at [4,8), got [%d,%d)", start, end)
+	}
+
+	results, err := History(db, "dana", 10)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 indexed results, got %d", len(results))
+	}
+	if results[0].ID != int(ids[0]) || results[1].ID != int(ids[1]) {
+		t.Errorf("Unexpected results: %d, %d", results[0].ID, results[1].ID)
+	}
+}
+
+func TestSemanticHistory(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	defer db.Close()
+
+	near := makeVec(map[int]float32{0: 1})
+	far := makeVec(map[int]float32{1: 1})
+	insertChunk(t, db, "My manager approved the budget", "a.md", "Later", "", 2, "2025-03-01", near)
+	insertChunk(t, db, "Priya scheduled the planning meeting", "b.md", "Earlier", "", 2, "2025-01-01", near)
+	insertChunk(t, db, "Lunch was great", "c.md", "Unrelated", "", 2, "2025-02-01", far)
+
+	server := newOllamaServer(t, near)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	results, err := SemanticHistory(context.Background(), db, client, "Priya", 2, false)
+	if err != nil {
+		t.Fatalf("SemanticHistory failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].ValidAt != "2025-01-01" || results[1].ValidAt != "2025-03-01" {
+		t.Errorf("Expected chronological order, got %q then %q", results[0].ValidAt, results[1].ValidAt)
+	}
+
+	results, err = SemanticHistory(context.Background(), db, client, "Priya", 2, true)
+	if err != nil {
+		t.Fatalf("SemanticHistory intersect failed: %v", err)
+	}
+	if len(results) != 1 || results[0].SourceFile != "b.md" {
+		t.Fatalf("Expected only the chunk naming Priya, got %+v", results)
+	}
+}
+
+func TestHistoryFTS(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	defer db.Close()
+	if !fts5Available {
+		t.Skip("FTS5 not compiled in (run with -tags fts5)")
+	}
+
+	vec := makeVec(map[int]float32{0: 1})
+	insertChunk(t, db, "Shipped the Rust rewrite.", "a.md", "One", "", 2, "2025-01-01", vec)
+	insertChunk(t, db, "Rusty tools everywhere, trusting nothing.", "b.md", "Two", "", 2, "2025-01-02", vec)
+	insertChunk(t, db, "RUST compile times are fine.", "c.md", "Three", "", 2, "2025-01-03", vec)
+
+	results, err := History(db, "rust", 10)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(results) != 2 || results[0].SourceFile != "a.md" || results[1].SourceFile != "c.md" {
+		t.Fatalf("expected whole-word FTS matches a.md and c.md, got %+v", results)
+	}
+
+	// Updates and deletes flow through the triggers
+	if _, err := db.Exec(`UPDATE chunks SET text = 'Now in Go.' WHERE source_file = 'a.md'`); err != nil {
+		t.Fatalf("update chunk: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM vec_chunks WHERE chunk_id IN (SELECT id FROM chunks WHERE source_file = 'c.md')`); err != nil {
+		t.Fatalf("delete vec chunk: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM chunks WHERE source_file = 'c.md'`); err != nil {
+		t.Fatalf("delete chunk: %v", err)
+	}
+	results, err = History(db, "rust", 10)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected no matches after update and delete, got %+v", results)
+	}
+
+	// Chunks written while the triggers were gone (a build without FTS5) are picked up on rebuild
+	if err := dropChunksFTSTriggers(db); err != nil {
+		t.Fatalf("drop triggers: %v", err)
+	}
+	insertChunk(t, db, "Rust again.", "d.md", "Four", "", 2, "2025-02-01", vec)
+	if err := ensureChunksFTS(db); err != nil {
+		t.Fatalf("ensureChunksFTS: %v", err)
+	}
+	results, err = History(db, "rust", 10)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(results) != 1 || results[0].SourceFile != "d.md" {
+		t.Fatalf("expected rebuilt index to find d.md, got %+v", results)
+	}
+}
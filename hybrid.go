@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+// rrfK damps reciprocal rank fusion so the top few ranks of one list cannot swamp the
+// other; 60 is the constant from the original paper and what most engines use.
+const rrfK = 60
+
+// ftsQuery turns free text into an FTS5 query matching any of its words, each quoted so
+// punctuation and FTS operators in the text are taken literally. BM25 ranks chunks
+// holding more (and rarer) words first. It is empty when the text has no words.
+func ftsQuery(text string) string {
+	var terms []string
+	for _, word := range queryWords(text) {
+		terms = append(terms, ftsPhrase(word))
+	}
+	return strings.Join(terms, " OR ")
+}
+
+// queryWords splits free text into its distinct words, ignoring case, in order.
+func queryWords(text string) []string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) }) {
+		if key := strings.ToLower(word); !seen[key] {
+			seen[key] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// keywordChunks returns up to limit chunks matching query's words, best BM25 match first,
+// within bounds and from sources when given. Each carries its cosine distance from
+// embedding, so it reads like a vector result. Without FTS5 it falls back to chunks
+// containing any of the words, those containing the most first, then the newest.
+func keywordChunks(ctx context.Context, db *sql.DB, query string, embedding []byte, bounds dateBounds, sources []string, includeArchived bool, limit int) ([]SearchResult, error) {
+	// Without an embedding every match is as far as an unembedded chunk
+	distance := `1`
+	var args []any
+	if embedding != nil {
+		distance = `COALESCE(vec_distance_cosine(v.embedding, ?), 1)`
+		args = append(args, embedding)
+	}
+	columns := `c.id, ` + distance + `, c.text, c.source_file, c.section_title, c.parent_title, c.header_level, c.valid_at, c.valid_until, c.superseded_by, c.importance, c.decay, c.archived_at`
+	var from, order string
+	var orderArgs []any
+	if fts5Available {
+		match := ftsQuery(query)
+		if match == "" {
+			return nil, nil
+		}
+		from = `chunks_fts f JOIN chunks c ON c.id = f.rowid LEFT JOIN vec_chunks v ON v.chunk_id = c.id WHERE chunks_fts MATCH ?`
+		order = `bm25(chunks_fts)`
+		args = append(args, match)
+	} else {
+		words := queryWords(query)
+		if len(words) == 0 {
+			return nil, nil
+		}
+		var terms []string
+		for _, word := range words {
+			terms = append(terms, `(c.text LIKE ? ESCAPE '\' COLLATE NOCASE)`)
+			orderArgs = append(orderArgs, "%"+escapeLike(word)+"%")
+		}
+		from = `chunks c LEFT JOIN vec_chunks v ON v.chunk_id = c.id WHERE (` + strings.Join(terms, ` OR `) + `)`
+		order = strings.Join(terms, ` + `) + ` DESC, c.id DESC`
+		args = append(args, orderArgs...)
+	}
+	// The same validity bounds the KNN query applies, read from the same columns
+	dates, dateArgs := bounds.condition()
+	from += dates
+	args = append(args, dateArgs...)
+	if scope, scopeArgs := sourceCondition(sources); scope != "" {
+		from += ` AND ` + scope
+		args = append(args, scopeArgs...)
+	}
+	if !includeArchived {
+		from += ` AND c.archived_at IS NULL`
+	}
+	rows, err := db.QueryContext(ctx, `SELECT `+columns+` FROM `+from+` ORDER BY `+order+` LIMIT ?`, append(append(args, orderArgs...), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanSearchResults(rows, includeArchived)
+}
+
+// fuseRanks merges two best-first result lists by reciprocal rank fusion: each chunk
+// scores 1/(rrfK + rank) for every list it appears in, so a chunk both lists agree on
+// beats one only a single list ranks highly. Ties go to the closer embedding.
+func fuseRanks(vector, keyword []SearchResult) []SearchResult {
+	scores := make(map[int]float64, len(vector)+len(keyword))
+	var fused []SearchResult
+	for _, list := range [][]SearchResult{vector, keyword} {
+		for rank, r := range list {
+			if _, seen := scores[r.ID]; !seen {
+				fused = append(fused, r)
+			}
+			scores[r.ID] += 1 / float64(rrfK+rank+1)
+		}
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		if scores[fused[i].ID] != scores[fused[j].ID] {
+			return scores[fused[i].ID] > scores[fused[j].ID]
+		}
+		return fused[i].Distance < fused[j].Distance
+	})
+	return fused
+}
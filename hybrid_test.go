@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFTSQuery(t *testing.T) {
+	if got, want := ftsQuery(`Why did "XJ-9000" fail? why`), `"Why" OR "did" OR "XJ" OR "9000" OR "fail"`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if got := ftsQuery("?!"); got != "" {
+		t.Fatalf("expected no query without words, got %q", got)
+	}
+}
+
+func TestFuseRanks(t *testing.T) {
+	vector := []SearchResult{{ID: 1, Distance: 0.1}, {ID: 2, Distance: 0.2}, {ID: 3, Distance: 0.3}}
+	keyword := []SearchResult{{ID: 3, Distance: 0.3}, {ID: 4, Distance: 0.9}}
+	var ids []int
+	for _, r := range fuseRanks(vector, keyword) {
+		ids = append(ids, r.ID)
+	}
+	// 3 is in both lists; 2 and 4 are both second in one list and tie, the closer first
+	if fmt.Sprint(ids) != "[3 1 2 4]" {
+		t.Fatalf("unexpected fused order %v", ids)
+	}
+}
+
+func TestHybridSearch(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	near := makeVec(map[int]float32{0: 1})
+	for i := 0; i < 8; i++ {
+		insertChunk(t, db, fmt.Sprintf("Checkout notes, part %d.", i), fmt.Sprintf("notes-%d.md", i), "Checkout", "", 2, "", near)
+	}
+	target := insertChunk(t, db, "The XJ-9000 controller resets when the bus is idle.", "hardware.md", "Controller", "", 2, "", makeVec(map[int]float32{1: 1}))
+
+	server := newOllamaServer(t, near)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+	found := func(results []SearchResult) bool {
+		for _, r := range results {
+			if r.ID == int(target) {
+				return true
+			}
+		}
+		return false
+	}
+
+	plain, err := SearchWithOptions(context.Background(), db, client, "XJ-9000", SearchOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchWithOptions: %v", err)
+	}
+	if found(plain) {
+		t.Fatal("expected the distant chunk missed by vector search alone")
+	}
+
+	hybrid, err := SearchWithOptions(context.Background(), db, client, "XJ-9000", SearchOptions{Limit: 2, Hybrid: true, ByRelevance: true})
+	if err != nil {
+		t.Fatalf("SearchWithOptions: %v", err)
+	}
+	if len(hybrid) != 2 || !found(hybrid) || hybrid[1].ID != int(target) || hybrid[1].Distance < 0.9 {
+		t.Fatalf("expected the keyword match fused in with its own distance, got %+v", hybrid)
+	}
+
+	db.Exec(`UPDATE chunks SET archived_at = '2025-01-01' WHERE id = ?`, target)
+	if hybrid, err = SearchWithOptions(context.Background(), db, client, "XJ-9000", SearchOptions{Limit: 2, Hybrid: true}); err != nil || found(hybrid) {
+		t.Fatalf("expected archived chunks left out of keyword matches, got %+v, %v", hybrid, err)
+	}
+}
+
+func TestSearchWithFallback(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	target := insertChunk(t, db, "The XJ-9000 controller resets when the bus is idle.", "hardware.md", "Controller", "", 2, "", makeVec(map[int]float32{1: 1}))
+	insertChunk(t, db, "Checkout notes.", "notes.md", "Checkout", "", 2, "", makeVec(map[int]float32{0: 1}))
+	archived := insertChunk(t, db, "An old XJ-9000 note.", "old.md", "Old", "", 2, "", makeVec(map[int]float32{0: 1}))
+	db.Exec(`UPDATE chunks SET archived_at = '2025-01-01' WHERE id = ?`, archived)
+
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	client := NewOllamaClient(server.URL, "embed")
+	results, degraded, err := SearchWithFallback(context.Background(), db, client, "XJ-9000", SearchOptions{Limit: 2})
+	if err != nil || degraded || len(results) != 2 {
+		t.Fatalf("expected a normal search while Ollama is up, got %+v, %v, %v", results, degraded, err)
+	}
+
+	// Nothing listens on a closed server's address
+	server.Close()
+	if _, err := SearchWithOptions(context.Background(), db, client, "XJ-9000", SearchOptions{Limit: 2}); err == nil {
+		t.Fatal("expected SearchWithOptions to fail without Ollama")
+	}
+	results, degraded, err = SearchWithFallback(context.Background(), db, client, "XJ-9000", SearchOptions{Limit: 2, RerankModel: "judge"})
+	if err != nil {
+		t.Fatalf("SearchWithFallback: %v", err)
+	}
+	if !degraded || len(results) != 1 || results[0].ID != int(target) {
+		t.Fatalf("expected only the keyword match in degraded mode, got %+v, %v", results, degraded)
+	}
+	// The words need not be next to each other, nor all present
+	results, _, err = SearchWithFallback(context.Background(), db, client, "is the controller idle or busy?", SearchOptions{Limit: 2})
+	if err != nil || len(results) == 0 || results[0].ID != int(target) {
+		t.Fatalf("expected the chunk with the most of the words first, got %+v, %v", results, err)
+	}
+
+	// An error from a running server is still reported
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	if _, _, err := SearchWithFallback(context.Background(), db, NewOllamaClient(failing.URL, "embed"), "XJ-9000", SearchOptions{Limit: 2}); err == nil {
+		t.Fatal("expected an embed error from a reachable server reported")
+	}
+}
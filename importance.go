@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+)
+
+const importanceRatingPrompt = `You rate how important a memory is to keep for the long term.
+Return JSON only, in exactly this shape:
+{"importance": 3}
+Use a whole number from 1 to 5:
+1 = small talk or transient detail, 3 = useful context, 5 = a decision, commitment, preference or fact that will matter for months.`
+
+// defaultImportanceBoost is the search boost used when importance ranking is simply
+// switched on (MCP boost_important).
+const defaultImportanceBoost = 0.3
+
+type importanceRatingResponse struct {
+	Importance float64 `json:"importance"`
+}
+
+// decisionPattern matches language that marks decisions, commitments and things to remember.
+var decisionPattern = regexp.MustCompile(`(?i)\b(decided|decision|agreed|we will|we'll|i will|i'll|going with|chose|committed|must|deadline|important|remember|never|always|prefer|plan is|conclusion|resolved)\b`)
+
+// speakerTurnPattern matches the "**Speaker** [15:04]:" lines that watchers write.
+var speakerTurnPattern = regexp.MustCompile(`(?m)^\*\*(.+?)\*\* \[\d{2}:\d{2}\]:`)
+
+type ImportanceResult struct {
+	ChunksScored int
+	LLMRated     int
+}
+
+// heuristicImportance scores a chunk between 0 and 1 from three signals:
+// how much of it the user wrote (hand-written notes count fully, transcripts by the
+// share of turns spoken by userAlias), decision language, and entity density.
+func heuristicImportance(text string, entities int, userAlias string) float64 {
+	authored := 1.0
+	if turns := speakerTurnPattern.FindAllStringSubmatch(text, -1); len(turns) > 0 {
+		mine := 0
+		for _, t := range turns {
+			if strings.EqualFold(strings.TrimSpace(t[1]), userAlias) {
+				mine++
+			}
+		}
+		authored = float64(mine) / float64(len(turns))
+	}
+
+	decisions := math.Min(float64(len(decisionPattern.FindAllStringIndex(text, -1)))/2, 1)
+
+	density := 0.0
+	if words := len(strings.Fields(text)); words > 0 {
+		// Three linked entities per hundred words counts as dense
+		density = math.Min(float64(entities)*100/float64(words)/3, 1)
+	}
+
+	score := 0.4*authored + 0.35*decisions + 0.25*density
+	return math.Round(score*100) / 100
+}
+
+// pendingImportanceChunks returns ids of chunks without an importance score (or every
+// chunk with rescore), optionally limited to one source file.
+func pendingImportanceChunks(db *sql.DB, sourceFile string, rescore bool) ([]int64, error) {
+	var conditions []string
+	var args []any
+	if !rescore {
+		conditions = append(conditions, "importance IS NULL")
+	}
+	if sourceFile != "" {
+		conditions = append(conditions, "source_file = ?")
+		args = append(args, sourceFile)
+	}
+	query := `SELECT id FROM chunks`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ScoreImportance stores an importance score (0 to 1) for each chunk. With a generate
+// model the model rates the chunk; chunks it can't rate, or every chunk when ollama is
+// nil, get the heuristic score.
+func ScoreImportance(ctx context.Context, db *sql.DB, ollama *OllamaClient, model, userAlias string, chunkIDs []int64, progress ProgressFunc) (ImportanceResult, error) {
+	var result ImportanceResult
+
+	for i, chunkID := range chunkIDs {
+		var text, title string
+		err := db.QueryRow(`SELECT text, section_title FROM chunks WHERE id = ?`, chunkID).Scan(&text, &title)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("read chunk %d: %w", chunkID, err)
+		}
+		if progress != nil {
+			progress(i, len(chunkIDs), title)
+		}
+
+		score := -1.0
+		if ollama != nil {
+			raw, err := ollama.GenerateJSON(ctx, model, importanceRatingPrompt, text)
+			if err != nil {
+				return result, fmt.Errorf("rate chunk %d: %w", chunkID, err)
+			}
+			var resp importanceRatingResponse
+			err = decodeModelJSON(raw, &resp)
+			if err == nil && (resp.Importance < 1 || resp.Importance > 5) {
+				err = fmt.Errorf("%w: importance %v out of range", errBadModelResponse, resp.Importance)
+			}
+			switch {
+			case err == nil:
+				score = math.Round((resp.Importance-1)/4*100) / 100
+				result.LLMRated++
+			case errors.Is(err, errBadModelResponse):
+				log.Printf("importance: falling back to heuristic for chunk %d: %v", chunkID, err)
+			default:
+				return result, err
+			}
+		}
+		if score < 0 {
+			var entities int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM chunk_entities WHERE chunk_id = ?`, chunkID).Scan(&entities); err != nil {
+				return result, err
+			}
+			score = heuristicImportance(text, entities, userAlias)
+		}
+
+		err = retryBusy("store importance", func() error {
+			_, err := db.Exec(`UPDATE chunks SET importance = ? WHERE id = ?`, score, chunkID)
+			return err
+		})
+		if err != nil {
+			return result, fmt.Errorf("store importance: %w", err)
+		}
+		result.ChunksScored++
+	}
+	if progress != nil && len(chunkIDs) > 0 {
+		progress(len(chunkIDs), len(chunkIDs), "")
+	}
+	return result, nil
+}
+
+// PruneCandidate is a chunk whose importance falls below a retention threshold.
+type PruneCandidate struct {
+	ID           int64
+	SourceFile   string
+	SectionTitle string
+	ValidAt      string
+	Importance   float64
+}
+
+// PruneCandidates lists scored chunks with importance below threshold, least important
+// first. With before (YYYY-MM-DD), only chunks dated earlier are considered, so recent
+// memories are kept regardless of score. Unscored and pinned chunks are never candidates.
+func PruneCandidates(db *sql.DB, threshold float64, before string) ([]PruneCandidate, error) {
+	before, err := NormalizeDate(before)
+	if err != nil {
+		return nil, fmt.Errorf("before: %w", err)
+	}
+	query := `SELECT id, source_file, section_title, valid_at, importance FROM chunks
+		WHERE importance IS NOT NULL AND importance < ? AND pinned_at IS NULL`
+	args := []any{threshold}
+	if before != "" {
+		query += ` AND valid_at < ?`
+		args = append(args, before)
+	}
+	query += ` ORDER BY importance ASC, valid_at ASC, id ASC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []PruneCandidate{}
+	for rows.Next() {
+		var c PruneCandidate
+		var validAt sql.NullString
+		if err := rows.Scan(&c.ID, &c.SourceFile, &c.SectionTitle, &validAt, &c.Importance); err != nil {
+			return nil, err
+		}
+		c.ValidAt = validAt.String
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// DeleteChunks removes chunks and their vectors. Entity links, facts, tags and other
+// per-chunk rows go with them through ON DELETE CASCADE.
+func DeleteChunks(db *sql.DB, chunkIDs []int64) (int, error) {
+	var deleted int
+	err := withWriteTx(db, "delete chunks", func(tx *sql.Tx) error {
+		var err error
+		deleted, err = deleteChunksTx(tx, chunkIDs)
+		return err
+	})
+	return deleted, err
+}
+
+func deleteChunksTx(tx *sql.Tx, chunkIDs []int64) (int, error) {
+	deleted := 0
+	for _, id := range chunkIDs {
+		// vec0 tables don't take part in cascades
+		if _, err := tx.Exec(`DELETE FROM vec_facts WHERE fact_id IN (SELECT id FROM facts WHERE chunk_id = ?)`, id); err != nil {
+			return 0, fmt.Errorf("delete fact vectors %d: %w", id, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM vec_chunks WHERE chunk_id = ?`, id); err != nil {
+			return 0, fmt.Errorf("delete vector %d: %w", id, err)
+		}
+		res, err := tx.Exec(`DELETE FROM chunks WHERE id = ?`, id)
+		if err != nil {
+			return 0, fmt.Errorf("delete chunk %d: %w", id, err)
+		}
+		n, _ := res.RowsAffected()
+		deleted += int(n)
+	}
+	return deleted, nil
+}
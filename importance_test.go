@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeuristicImportance(t *testing.T) {
+	note := heuristicImportance("We decided to go with Postgres. Deadline is Friday.", 1, "User")
+	chatter := heuristicImportance("**Assistant** [10:00]:\nHere is a summary of the weather.\n\n**User** [10:01]:\nok", 0, "User")
+	mine := heuristicImportance("**User** [10:00]:\nI prefer tabs.\n\n**User** [10:01]:\nRemember that.", 0, "user")
+
+	if note != 1 {
+		t.Fatalf("expected an authored decision note with a dense entity to score 1, got %.2f", note)
+	}
+	if chatter != 0.2 {
+		t.Fatalf("expected half-authored transcript without decisions to score 0.2, got %.2f", chatter)
+	}
+	if mine != 0.75 {
+		t.Fatalf("expected user-authored decisions to score 0.75, got %.2f", mine)
+	}
+}
+
+func TestScoreImportance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req generateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		answer := `{"importance": 5}`
+		if strings.Contains(req.Prompt, "weather") {
+			answer = `{"importance": 9}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	decision := insertChunk(t, db, "We decided on Postgres.", "a.md", "Decision", "", 2, "2024-01-01", vec)
+	weather := insertChunk(t, db, "Nice weather today.", "b.md", "Weather", "", 2, "2024-01-02", vec)
+
+	pending, err := pendingImportanceChunks(db, "", false)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("expected 2 pending chunks, got %v, %v", pending, err)
+	}
+
+	client := NewOllamaClient(server.URL, "embed")
+	result, err := ScoreImportance(context.Background(), db, client, "gen", "User", pending, nil)
+	if err != nil {
+		t.Fatalf("ScoreImportance: %v", err)
+	}
+	if result.ChunksScored != 2 || result.LLMRated != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	var decisionScore, weatherScore float64
+	db.QueryRow(`SELECT importance FROM chunks WHERE id = ?`, decision).Scan(&decisionScore)
+	db.QueryRow(`SELECT importance FROM chunks WHERE id = ?`, weather).Scan(&weatherScore)
+	if decisionScore != 1 {
+		t.Fatalf("expected model rating 5 to store 1.0, got %.2f", decisionScore)
+	}
+	// Out-of-range rating falls back to the heuristic: authored note, no decisions, no entities
+	if weatherScore != 0.4 {
+		t.Fatalf("expected heuristic fallback 0.4, got %.2f", weatherScore)
+	}
+
+	if pending, _ := pendingImportanceChunks(db, "", false); len(pending) != 0 {
+		t.Fatalf("expected nothing pending after scoring, got %v", pending)
+	}
+
+	candidates, err := PruneCandidates(db, 0.5, "2024-06-01")
+	if err != nil {
+		t.Fatalf("PruneCandidates: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].ID != weather {
+		t.Fatalf("expected only the weather chunk, got %+v", candidates)
+	}
+	if candidates, _ := PruneCandidates(db, 0.5, "2024-01-02"); len(candidates) != 0 {
+		t.Fatalf("expected --before to protect newer chunks, got %+v", candidates)
+	}
+
+	deleted, err := DeleteChunks(db, []int64{weather})
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteChunks: %d, %v", deleted, err)
+	}
+	var vectors int
+	db.QueryRow(`SELECT COUNT(*) FROM vec_chunks WHERE chunk_id = ?`, weather).Scan(&vectors)
+	if vectors != 0 {
+		t.Fatal("expected the chunk's vector to be deleted")
+	}
+}
+
+func TestSearchImportanceBoost(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	closer := insertChunk(t, db, "Trivia", "a.md", "Trivia", "", 2, "", makeVec(map[int]float32{0: 1, 1: 0.30}))
+	important := insertChunk(t, db, "Decision", "b.md", "Decision", "", 2, "", makeVec(map[int]float32{0: 1, 1: 0.35}))
+	if _, err := db.Exec(`UPDATE chunks SET importance = CASE id WHEN ? THEN 0.1 ELSE 1 END`, closer); err != nil {
+		t.Fatalf("set importance: %v", err)
+	}
+
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	results, err := SearchWithOptions(context.Background(), db, client, "q", SearchOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 1 || int64(results[0].ID) != closer {
+		t.Fatalf("expected nearest chunk without boost, got %+v", results)
+	}
+
+	results, err = SearchWithOptions(context.Background(), db, client, "q", SearchOptions{Limit: 1, ImportanceBoost: 0.5})
+	if err != nil {
+		t.Fatalf("search with boost: %v", err)
+	}
+	if len(results) != 1 || int64(results[0].ID) != important || results[0].Importance != 1 {
+		t.Fatalf("expected important chunk with boost, got %+v", results)
+	}
+}
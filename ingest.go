@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
-
-	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
 )
 
 type Section struct {
@@ -18,6 +23,7 @@ type Section struct {
 	Content     string
 	Sequence    int
 	ValidAt     string
+	Tags        []string // from the document's frontmatter
 }
 
 type ChunkData struct {
@@ -37,48 +43,196 @@ type IngestResult struct {
 	ChunksCreated    int
 	SubChunksCreated int
 	DeletedChunks    int64
+	// ChunksUnchanged counts chunks whose text was already stored, kept with their
+	// embeddings rather than embedded again. ChunkIDs holds only the new chunks.
+	ChunksUnchanged int
+	// Resumed counts embeddings kept from an earlier run that failed or was interrupted
+	Resumed int
+	// DuplicatesSkipped counts new chunks left out as near-duplicates of one already
+	// stored in the source's family (see nearDuplicate), each listed in Duplicates
+	DuplicatesSkipped int
+	Duplicates        []SkippedDuplicate `json:",omitempty"`
+	ChunkIDs          []int64            `json:"-"`
+}
+
+// monthName matches a month's name or its abbreviation: "January", "Jan", "Sept."
+const monthName = `(Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:t(?:ember)?)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\b\.?`
+
+// headerDates are the dates a header may carry, each with how to read its match.
+var headerDates = []struct {
+	re    *regexp.Regexp
+	parse func(m []string) (time.Time, bool)
+}{
+	// 2026-01-21
+	{regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`), func(m []string) (time.Time, bool) {
+		return calendarDate(m[1], monthNumber(m[2]), m[3])
+	}},
+	// 2026-W04, the Monday of that ISO week
+	{regexp.MustCompile(`\b(\d{4})-W(\d{2})\b`), func(m []string) (time.Time, bool) {
+		year, _ := strconv.Atoi(m[1])
+		week, _ := strconv.Atoi(m[2])
+		if week < 1 || week > 53 {
+			return time.Time{}, false
+		}
+		// January 4 is always in week 1
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+		monday := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+7*(week-1))
+		if _, w := monday.ISOWeek(); w != week {
+			return time.Time{}, false
+		}
+		return monday, true
+	}},
+	// January 21, 2026; Jan 21 2026; Week of January 20, 2026
+	{regexp.MustCompile(`\b` + monthName + `\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`), func(m []string) (time.Time, bool) {
+		return calendarDate(m[3], monthNumber(m[1]), m[2])
+	}},
+	// 21 Jan 2026; 21st January, 2026
+	{regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)?\s+` + monthName + `,?\s+(\d{4})\b`), func(m []string) (time.Time, bool) {
+		return calendarDate(m[3], monthNumber(m[2]), m[1])
+	}},
+	// 01/21/2026 or 21/01/2026, also with dots or dashes
+	{regexp.MustCompile(`\b(\d{1,2})[/.-](\d{1,2})[/.-](\d{4})\b`), func(m []string) (time.Time, bool) {
+		first, _ := strconv.Atoi(m[1])
+		second, _ := strconv.Atoi(m[2])
+		// A number over 12 can only be the day; otherwise the configured order decides
+		month, day := first, second
+		if first > 12 || (second <= 12 && dayFirst) {
+			month, day = second, first
+		}
+		return calendarDate(m[3], time.Month(month), strconv.Itoa(day))
+	}},
 }
 
+// ExtractDateFromHeader returns the date a header mentions, as YYYY-MM-DD, or "" when it
+// has none. The leftmost date wins; one that does not exist, like February 30, is skipped.
 func ExtractDateFromHeader(header string) string {
-	pattern := `\b(January|February|March|April|May|June|July|August|September|October|November|December)\s+([0-9]{1,2}),\s*([0-9]{4})\b`
-	re := regexp.MustCompile(pattern)
-	match := re.FindString(header)
-	if match == "" {
-		return ""
+	type candidate struct {
+		start int
+		date  time.Time
 	}
-	parsed, err := time.Parse("January 2, 2006", match)
-	if err != nil {
+	var found []candidate
+	for _, format := range headerDates {
+		for _, loc := range format.re.FindAllStringSubmatchIndex(header, -1) {
+			m := make([]string, len(loc)/2)
+			for i := range m {
+				if loc[2*i] >= 0 {
+					m[i] = header[loc[2*i]:loc[2*i+1]]
+				}
+			}
+			if date, ok := format.parse(m); ok {
+				found = append(found, candidate{loc[0], date})
+			}
+		}
+	}
+	if len(found) == 0 {
 		return ""
 	}
-	return parsed.Format("2006-01-02")
+	first := found[0]
+	for _, c := range found[1:] {
+		if c.start < first.start {
+			first = c
+		}
+	}
+	return first.date.Format(dateLayout)
+}
+
+// monthNumber reads a month given by name, abbreviation or number; 0 if it is none.
+func monthNumber(s string) time.Month {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Month(n)
+	}
+	if len(s) < 3 {
+		return 0
+	}
+	i := strings.Index("janfebmaraprmayjunjulaugsepoctnovdec", strings.ToLower(s[:3]))
+	if i < 0 || i%3 != 0 {
+		return 0
+	}
+	return time.Month(i/3 + 1)
+}
+
+// calendarDate builds a date from its parts, failing for one that does not exist.
+func calendarDate(year string, month time.Month, day string) (time.Time, bool) {
+	y, err1 := strconv.Atoi(year)
+	d, err2 := strconv.Atoi(day)
+	if err1 != nil || err2 != nil || month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+	t := time.Date(y, month, d, 0, 0, 0, 0, time.UTC)
+	if t.Month() != month || t.Day() != d {
+		return time.Time{}, false
+	}
+	return t, true
 }
 
 func ParseMarkdown(content string) []Section {
-	lines := strings.Split(content, "\n")
 	sections := []Section{}
-	seq := 1
-	seenHeader := false
+	_ = ParseMarkdownStream(strings.NewReader(content), func(section Section) error {
+		sections = append(sections, section)
+		return nil
+	})
+	return sections
+}
 
-	preambleLines := []string{}
+// defaultSectionDepth is the deepest header level that starts a section of its own:
+// ## and ###. Deeper headers stay in their section's content.
+const defaultSectionDepth = 3
 
-	currentH2Title := ""
-	currentH2Content := []string{}
-	currentH2HasH3 := false
-	currentH2ValidAt := ""
+// markdownHeader matches a header line of level 2 or deeper; a # title is content.
+var markdownHeader = regexp.MustCompile(`^(#{2,}) +(.*?)\s*$`)
+
+// ParseMarkdownStream splits markdown read from r into sections like ParseMarkdown,
+// passing each to fn as soon as it ends, so only the current section is held in memory.
+// It stops at the first error from r or fn. A frontmatter block is not part of any
+// section: its date dates the sections without one in their header, its title names the
+// preamble, and its tags are given to every section.
+func ParseMarkdownStream(r io.Reader, fn func(Section) error) error {
+	return ParseMarkdownStreamDepth(r, defaultSectionDepth, fn)
+}
+
+// ParseMarkdownStreamDepth is ParseMarkdownStream with headers down to depth (## is 2)
+// starting sections. A section's ParentTitle is the breadcrumb of the headers above it,
+// "Design > Storage", and one without a date in its header takes its parent's. A header
+// with subsections is a section only for the text before its first one.
+func ParseMarkdownStreamDepth(r io.Reader, depth int, fn func(Section) error) error {
+	if depth < 2 {
+		depth = defaultSectionDepth
+	}
+	fm, body, err := readFrontmatter(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(body)
+	var emitErr error
+	seq := 1
 
-	currentH3Title := ""
-	currentH3Content := []string{}
-	currentH3ValidAt := ""
-	inH3 := false
+	type openHeader struct {
+		level       int
+		title       string
+		validAt     string
+		content     []string
+		hasChildren bool
+	}
+	// The headers enclosing the current line, outermost first; lines go to the last
+	var open []*openHeader
+	preambleLines := []string{}
+	seenHeader := false
 
 	addSection := func(title string, headerLevel int, parentTitle string, sectionContent string, validAt string) {
-		sections = append(sections, Section{
+		if emitErr != nil {
+			return
+		}
+		if validAt == "" {
+			validAt = fm.Date
+		}
+		emitErr = fn(Section{
 			Title:       title,
 			HeaderLevel: headerLevel,
 			ParentTitle: parentTitle,
 			Content:     sectionContent,
 			Sequence:    seq,
 			ValidAt:     validAt,
+			Tags:        fm.Tags,
 		})
 		seq++
 	}
@@ -89,98 +243,92 @@ func ParseMarkdown(content string) []Section {
 		}
 		content := strings.TrimSpace(strings.Join(preambleLines, "\n"))
 		if content != "" {
-			addSection("Preamble", 2, "", content, "")
+			title := "Preamble"
+			if fm.Title != "" {
+				title = fm.Title
+			}
+			addSection(title, 2, "", content, "")
 		}
 		preambleLines = nil
 	}
 
-	flushH3 := func() {
-		if currentH3Title == "" {
-			return
+	breadcrumb := func(n int) string {
+		titles := make([]string, n)
+		for i, h := range open[:n] {
+			titles[i] = h.title
 		}
-		content := strings.TrimSpace(strings.Join(currentH3Content, "\n"))
-		addSection(currentH3Title, 3, currentH2Title, content, currentH3ValidAt)
-		currentH3Title = ""
-		currentH3Content = nil
-		currentH3ValidAt = ""
-		inH3 = false
+		return strings.Join(titles, " > ")
 	}
 
-	flushH2 := func() {
-		if currentH2Title == "" {
-			return
-		}
-		if !currentH2HasH3 {
-			content := strings.TrimSpace(strings.Join(currentH2Content, "\n"))
-			addSection(currentH2Title, 2, "", content, currentH2ValidAt)
+	// closeTo ends the open headers of level or deeper. A header that had subsections
+	// already gave its text before them; one without is a section even when empty.
+	closeTo := func(level int) {
+		for len(open) > 0 && open[len(open)-1].level >= level {
+			h := open[len(open)-1]
+			content := strings.TrimSpace(strings.Join(h.content, "\n"))
+			if content != "" || !h.hasChildren {
+				addSection(h.title, h.level, breadcrumb(len(open)-1), content, h.validAt)
+			}
+			open = open[:len(open)-1]
 		}
-		currentH2Title = ""
-		currentH2Content = nil
-		currentH2HasH3 = false
-		currentH2ValidAt = ""
 	}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "### ") {
-			if !seenHeader {
-				seenHeader = true
-				flushPreamble()
-			}
-			flushH3()
-			if currentH2Title != "" && !currentH2HasH3 {
-				preamble := strings.TrimSpace(strings.Join(currentH2Content, "\n"))
-				if preamble != "" {
-					addSection(currentH2Title, 2, "", preamble, currentH2ValidAt)
-				}
-				currentH2Content = nil
-			}
-			currentH2HasH3 = true
-			inH3 = true
-			currentH3Title = strings.TrimSpace(line[4:])
-			currentH3ValidAt = ExtractDateFromHeader(currentH3Title)
-			if currentH3ValidAt == "" {
-				currentH3ValidAt = currentH2ValidAt
-			}
-			currentH3Content = nil
-			continue
+	// A "## " line in a fenced code block is code, not a header
+	var fences fenceTracker
+	for done := false; !done && emitErr == nil; {
+		// Lines as strings.Split would give them: a trailing newline ends in an empty line
+		line, err := reader.ReadString('\n')
+		switch err {
+		case nil:
+			line = line[:len(line)-1]
+		case io.EOF:
+			done = true
+		default:
+			return err
 		}
 
-		if strings.HasPrefix(line, "## ") {
+		inCode := fences.next(line)
+		if m := markdownHeader.FindStringSubmatch(line); !inCode && m != nil && len(m[1]) <= depth {
 			if !seenHeader {
 				seenHeader = true
 				flushPreamble()
 			}
-			flushH3()
-			flushH2()
-			currentH2Title = strings.TrimSpace(line[3:])
-			currentH2Content = nil
-			currentH2HasH3 = false
-			currentH2ValidAt = ExtractDateFromHeader(currentH2Title)
-			inH3 = false
+			level := len(m[1])
+			closeTo(level)
+			h := &openHeader{level: level, title: m[2], validAt: ExtractDateFromHeader(m[2])}
+			if len(open) > 0 {
+				parent := open[len(open)-1]
+				if content := strings.TrimSpace(strings.Join(parent.content, "\n")); content != "" {
+					addSection(parent.title, parent.level, breadcrumb(len(open)-1), content, parent.validAt)
+				}
+				parent.content = nil
+				parent.hasChildren = true
+				if h.validAt == "" {
+					h.validAt = parent.validAt
+				}
+			}
+			open = append(open, h)
 			continue
 		}
 
-		if inH3 {
-			currentH3Content = append(currentH3Content, line)
-		} else if currentH2Title != "" {
-			currentH2Content = append(currentH2Content, line)
+		if len(open) > 0 {
+			open[len(open)-1].content = append(open[len(open)-1].content, line)
 		} else {
 			preambleLines = append(preambleLines, line)
 		}
 	}
 
-	flushH3()
-	flushH2()
+	closeTo(0)
 	if !seenHeader {
 		flushPreamble()
 	}
 
-	return sections
+	return emitErr
 }
 
-func ChunkSection(section Section, maxWords int) []ChunkData {
-	wordCount := len(strings.Fields(section.Content))
-	if wordCount <= maxWords {
+func ChunkSection(section Section, opts ChunkOptions) []ChunkData {
+	size, limit := opts.measure()
+	if size(section.Content) <= limit {
 		return []ChunkData{
 			{
 				Text:            strings.TrimSpace(section.Content),
@@ -195,39 +343,89 @@ func ChunkSection(section Section, maxWords int) []ChunkData {
 		}
 	}
 
-	paragraphs := strings.Split(section.Content, "\n\n")
-	chunkTexts := []string{}
-	currentParts := []string{}
-	currentWords := 0
-
-	countWords := func(text string) int {
-		return len(strings.Fields(text))
+	// Chunks are packed from paragraphs. One too long for a chunk is split into its
+	// sentences, which are packed as units that continue the paragraph. A fenced code
+	// block is never split: it is one unit with the sentence that introduces it, even
+	// when that is more than a chunk holds.
+	type chunkUnit struct {
+		text   string
+		size   int
+		inline bool
 	}
+	var units []chunkUnit
+	for _, block := range markdownBlocks(section.Content) {
+		if codeFence(block) != "" {
+			code := chunkUnit{text: block, size: size(block)}
+			if len(units) > 0 && codeFence(units[len(units)-1].text) == "" {
+				intro := &units[len(units)-1]
+				if merged := intro.size + code.size; merged > limit && !intro.inline {
+					// Keep only the paragraph's last sentence with the code
+					if sentences := splitSentences(intro.text); len(sentences) > 1 {
+						last := sentences[len(sentences)-1]
+						rest := strings.TrimSpace(strings.TrimSuffix(intro.text, last))
+						*intro = chunkUnit{text: rest, size: size(rest)}
+						units = append(units, chunkUnit{text: last, size: size(last), inline: true})
+						intro = &units[len(units)-1]
+					}
+				}
+				intro.text += "\n\n" + code.text
+				intro.size += code.size
+				continue
+			}
+			units = append(units, code)
+			continue
+		}
+		if n := size(block); n <= limit {
+			units = append(units, chunkUnit{text: block, size: n})
+			continue
+		}
+		for i, piece := range splitLongParagraph(block, size, limit) {
+			units = append(units, chunkUnit{text: piece, size: size(piece), inline: i > 0})
+		}
+	}
+
+	chunkTexts := []string{}
+	currentParts := []chunkUnit{}
+	currentSize := 0
+	// Units of currentParts that are new rather than repeated from the last chunk
+	fresh := 0
 
 	flushChunk := func() {
-		if len(currentParts) == 0 {
+		if fresh == 0 {
 			return
 		}
-		chunkTexts = append(chunkTexts, strings.Join(currentParts, "\n\n"))
-		currentParts = nil
-		currentWords = 0
-	}
-
-	for _, paragraph := range paragraphs {
-		trimmed := strings.TrimSpace(paragraph)
-		if trimmed == "" {
-			continue
+		var text strings.Builder
+		for i, part := range currentParts {
+			if i > 0 && part.inline {
+				text.WriteString(" ")
+			} else if i > 0 {
+				text.WriteString("\n\n")
+			}
+			text.WriteString(part.text)
 		}
-		paraWords := countWords(trimmed)
-		if currentWords == 0 && paraWords > maxWords {
-			chunkTexts = append(chunkTexts, trimmed)
-			continue
+		chunkTexts = append(chunkTexts, text.String())
+		// The next chunk opens with the trailing units that fit in the overlap
+		keep, kept := len(currentParts), 0
+		for keep > 0 && kept+currentParts[keep-1].size <= opts.Overlap {
+			keep--
+			kept += currentParts[keep].size
 		}
-		if currentWords+paraWords > maxWords {
+		currentParts = append([]chunkUnit(nil), currentParts[keep:]...)
+		currentSize = kept
+		fresh = 0
+	}
+
+	for _, unit := range units {
+		if currentSize+unit.size > limit {
 			flushChunk()
 		}
-		currentParts = append(currentParts, trimmed)
-		currentWords += paraWords
+		if currentSize+unit.size > limit {
+			// No room for the overlap next to this unit
+			currentParts, currentSize = nil, 0
+		}
+		currentParts = append(currentParts, unit)
+		currentSize += unit.size
+		fresh++
 	}
 
 	flushChunk()
@@ -251,24 +449,56 @@ func ChunkSection(section Section, maxWords int) []ChunkData {
 
 type ingestPreparedChunk struct {
 	chunk      ChunkData
+	tags       []string // from the frontmatter
+	hashtags   []string // written in the chunk's text
 	validAt    sql.NullString
+	normalized sql.NullString
 	serialized []byte
+	hash       string // contentHash of the text
+	keep       int64  // the stored chunk with the same text, reused instead of embedded
+	duplicate  int64  // the stored chunk of another source this one nearly repeats
 }
 
-func IngestFile(db *sql.DB, ollama *OllamaClient, filePath string, validAt string) (IngestResult, error) {
-	data, err := os.ReadFile(filePath)
+func IngestFile(ctx context.Context, db *sql.DB, ollama *OllamaClient, filePath string, validAt string, chunking ChunkOptions) (IngestResult, error) {
+	return IngestFileWithProgress(ctx, db, ollama, filePath, validAt, chunking, nil)
+}
+
+// IngestFileWithProgress behaves like IngestFile and reports each embedded chunk to progress (may be nil).
+func IngestFileWithProgress(ctx context.Context, db *sql.DB, ollama *OllamaClient, filePath string, validAt string, chunking ChunkOptions, progress ProgressFunc) (IngestResult, error) {
+	f, err := OpenIngestFile(filePath)
 	if err != nil {
 		return IngestResult{}, err
 	}
+	defer f.Close()
+	return IngestMarkdown(ctx, db, ollama, filePath, f, validAt, chunking, progress)
+}
 
-	sections := ParseMarkdown(string(data))
-	result := IngestResult{SectionsFound: len(sections)}
+// OpenIngestFile opens a file for ingestion as markdown: an HTML file is read whole and
+// converted by htmlToMarkdown, anything else streamed as it is.
+func OpenIngestFile(filePath string) (io.ReadCloser, error) {
+	if !isHTMLFile(filePath) {
+		return os.Open(filePath)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(htmlToMarkdown(string(data)))), nil
+}
 
-	ctx := context.Background()
-	ingestedAt := time.Now().UTC().Format(time.RFC3339)
+// chunkMarkdown parses and chunks markdown read from r as sourceFile, dating each section
+// without a date of its own validAt. Sections are streamed, so only the chunk texts are
+// held, never the whole file.
+func chunkMarkdown(sourceFile string, r io.Reader, validAt string, chunking ChunkOptions) (IngestResult, []ingestPreparedChunk, error) {
+	validAt, err := NormalizeDate(validAt)
+	if err != nil {
+		return IngestResult{}, nil, fmt.Errorf("valid-at: %w", err)
+	}
 
-	var prepared []ingestPreparedChunk
-	for _, section := range sections {
+	var result IngestResult
+	var pending []ingestPreparedChunk
+	err = ParseMarkdownStreamDepth(r, chunking.Depth, func(section Section) error {
+		result.SectionsFound++
 		sectionValidAt := section.ValidAt
 		if sectionValidAt == "" {
 			sectionValidAt = validAt
@@ -278,13 +508,13 @@ func IngestFile(db *sql.DB, ollama *OllamaClient, filePath string, validAt strin
 			validAtValue = sql.NullString{String: sectionValidAt, Valid: true}
 		}
 
-		chunks := ChunkSection(section, 600)
+		chunks := ChunkSection(section, chunking)
 		result.ChunksCreated += len(chunks)
 		if len(chunks) > 1 {
 			result.SubChunksCreated += len(chunks) - 1
 		}
 		for _, chunk := range chunks {
-			chunk.SourceFile = filePath
+			chunk.SourceFile = sourceFile
 			chunk.ValidAt = sectionValidAt
 
 			if strings.TrimSpace(chunk.Text) == "" {
@@ -292,56 +522,281 @@ func IngestFile(db *sql.DB, ollama *OllamaClient, filePath string, validAt strin
 				continue
 			}
 
-			// Normalize text before embedding (fix typos for better search)
-			normalizedText := normalizeText(chunk.Text)
-			embedding, err := ollama.Embed(ctx, normalizedText)
-			if err != nil {
-				return IngestResult{}, err
-			}
-			serialized, err := sqlite_vec.SerializeFloat32(embedding)
-			if err != nil {
-				return IngestResult{}, err
-			}
-
-			prepared = append(prepared, ingestPreparedChunk{
-				chunk:      chunk,
-				validAt:    validAtValue,
-				serialized: serialized,
+			pending = append(pending, ingestPreparedChunk{
+				chunk:    chunk,
+				tags:     section.Tags,
+				hashtags: extractHashtags(chunk.Text),
+				validAt:  validAtValue,
 			})
 		}
+		return nil
+	})
+	if err != nil {
+		return IngestResult{}, nil, fmt.Errorf("read %s: %w", sourceFile, err)
 	}
+	return result, pending, nil
+}
 
-	if len(prepared) == 0 {
+// IngestMarkdown ingests markdown read from r as sourceFile, a file path or the URL of a
+// fetched page, replacing the chunks that source held before. Sections are split as
+// chunking sets.
+func IngestMarkdown(ctx context.Context, db *sql.DB, ollama *OllamaClient, sourceFile string, r io.Reader, validAt string, chunking ChunkOptions, progress ProgressFunc) (IngestResult, error) {
+	// Chunk everything first so the total is known before embedding starts
+	result, pending, err := chunkMarkdown(sourceFile, r, validAt, chunking)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	if len(pending) == 0 {
 		return result, nil
 	}
+	ingestedAt := time.Now().UTC().Format(time.RFC3339)
 
-	db.Exec(`DELETE FROM vec_chunks WHERE chunk_id IN (SELECT id FROM chunks WHERE source_file = ?)`, filePath)
-	delResult, err := db.Exec("DELETE FROM chunks WHERE source_file = ?", filePath)
+	// Only chunks whose text is new are embedded; the rest keep the embedding they have
+	fileHash := sourceHash(pending)
+	previous, err := loadSourceChunks(db, sourceFile)
 	if err != nil {
+		return IngestResult{}, fmt.Errorf("read stored chunks of %s: %w", sourceFile, err)
+	}
+	if previous.unchanged(fileHash, len(pending)) {
+		result.ChunksUnchanged = len(pending)
+		return result, nil
+	}
+	var embed []int
+	for i := range pending {
+		pending[i].hash = contentHash(pending[i].chunk.Text)
+		if pending[i].keep = previous.take(pending[i].hash); pending[i].keep == 0 {
+			embed = append(embed, i)
+		}
+	}
+
+	// Embeddings staged by an earlier run that stopped partway are not made again
+	embed, result.Resumed, err = resumeStaged(db, sourceFile, ollama.embedModel, pending, embed)
+	if err != nil {
+		return IngestResult{}, fmt.Errorf("read staged embeddings of %s: %w", sourceFile, err)
+	}
+
+	// Embedded concurrently, then stored by the one writer below in sequence order
+	stage := func(done []int) error { return stageEmbeddings(db, sourceFile, ollama.embedModel, pending, done) }
+	if err := embedChunks(ctx, ollama, pending, embed, progress, stage); err != nil {
 		return IngestResult{}, err
 	}
-	deletedCount, _ := delResult.RowsAffected()
-	result.DeletedChunks = deletedCount
 
-	for _, pc := range prepared {
-		res, err := db.Exec(
-			`INSERT INTO chunks (text, source_file, section_title, header_level, parent_title, section_sequence, chunk_sequence, chunk_total, valid_at, ingested_at)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			pc.chunk.Text, pc.chunk.SourceFile, pc.chunk.SectionTitle, pc.chunk.HeaderLevel, pc.chunk.ParentTitle,
-			pc.chunk.SectionSequence, pc.chunk.ChunkSequence, pc.chunk.ChunkTotal, pc.validAt, ingestedAt,
-		)
-		if err != nil {
+	// A new chunk that nearly repeats one elsewhere in its family is left out
+	for i := range pending {
+		if pending[i].keep != 0 {
+			continue
+		}
+		if pending[i].duplicate, err = nearDuplicate(db, sourceFile, pending[i].serialized); err != nil {
 			return IngestResult{}, err
 		}
+	}
 
-		chunkID, _ := res.LastInsertId()
-		if _, err := db.Exec(
-			"INSERT INTO vec_chunks (chunk_id, embedding) VALUES (?, ?)",
-			chunkID, pc.serialized,
-		); err != nil {
-			return IngestResult{}, err
+	// One write transaction, so other writers queue behind it once rather than
+	// interleaving with every insert
+	err = withWriteTx(db, "store "+sourceFile, func(tx *sql.Tx) error {
+		result.ChunkIDs, result.ChunksUnchanged, result.DeletedChunks, result.DuplicatesSkipped, result.Duplicates = nil, 0, 0, 0, nil
+		kept := map[int64]bool{}
+		for _, pc := range pending {
+			if pc.keep != 0 {
+				kept[pc.keep] = true
+			}
+		}
+		var stale []int64
+		rows, err := tx.Query(`SELECT id FROM chunks WHERE source_file = ?`, sourceFile)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			if !kept[id] {
+				stale = append(stale, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range stale {
+			if _, err := tx.Exec(`DELETE FROM vec_chunks WHERE chunk_id = ?`, id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`DELETE FROM chunks WHERE id = ?`, id); err != nil {
+				return err
+			}
+		}
+		result.DeletedChunks = int64(len(stale))
+		// Out of the way of the sequences the kept chunks move to
+		if _, err := tx.Exec(`UPDATE chunks SET section_sequence = -id WHERE source_file = ?`, sourceFile); err != nil {
+			return err
+		}
+
+		for _, pc := range pending {
+			if pc.keep != 0 {
+				if err := keepChunk(tx, pc.keep, pc); err != nil {
+					return err
+				}
+				result.ChunksUnchanged++
+				continue
+			}
+			if pc.duplicate != 0 {
+				skipped := SkippedDuplicate{Section: pc.chunk.SectionTitle, KeptID: pc.duplicate}
+				if err := tx.QueryRow(`SELECT source_file, section_title FROM chunks WHERE id = ?`, pc.duplicate).Scan(&skipped.KeptSource, &skipped.KeptSection); err != nil {
+					return fmt.Errorf("read near-duplicate %d: %w", pc.duplicate, err)
+				}
+				result.DuplicatesSkipped++
+				result.Duplicates = append(result.Duplicates, skipped)
+				continue
+			}
+			res, err := tx.Exec(
+				`INSERT INTO chunks (text, source_file, section_title, header_level, parent_title, section_sequence, chunk_sequence, chunk_total, valid_at, ingested_at, normalized_text, content_hash)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				pc.chunk.Text, pc.chunk.SourceFile, pc.chunk.SectionTitle, pc.chunk.HeaderLevel, pc.chunk.ParentTitle,
+				pc.chunk.SectionSequence, pc.chunk.ChunkSequence, pc.chunk.ChunkTotal, pc.validAt, ingestedAt, pc.normalized, pc.hash,
+			)
+			if err != nil {
+				return err
+			}
+
+			chunkID, _ := res.LastInsertId()
+			validFrom, validUntil := vecValidity(pc.validAt, sql.NullString{})
+			if _, err := tx.Exec(
+				"INSERT INTO vec_chunks (chunk_id, embedding, valid_at, valid_until) VALUES (?, ?, ?, ?)",
+				chunkID, pc.serialized, validFrom, validUntil,
+			); err != nil {
+				return err
+			}
+			if err := storeIngestTags(tx, chunkID, pc); err != nil {
+				return err
+			}
+			result.ChunkIDs = append(result.ChunkIDs, chunkID)
 		}
+		if _, err := tx.Exec(`DELETE FROM ingest_staging WHERE source_file = ?`, sourceFile); err != nil {
+			return err
+		}
+		return storeSourceHash(tx, sourceFile, fileHash, result.ChunksUnchanged+len(result.ChunkIDs), ingestedAt)
+	})
+	if err != nil {
+		return IngestResult{}, err
 	}
 
+	if entityNameDetection && len(result.ChunkIDs) > 0 {
+		if _, err := DetectEntityNames(db, result.ChunkIDs); err != nil {
+			return IngestResult{}, fmt.Errorf("detect names: %w", err)
+		}
+	}
+	if err := IndexChunkMentions(db, result.ChunkIDs); err != nil {
+		return IngestResult{}, err
+	}
+
+	chunksIngested.add("", float64(len(result.ChunkIDs)))
+	notify(eventFileIngested, fmt.Sprintf("Ingested %s: %d chunks", sourceFile, len(result.ChunkIDs)), map[string]any{
+		"file":      sourceFile,
+		"chunks":    len(result.ChunkIDs),
+		"deleted":   result.DeletedChunks,
+		"unchanged": result.ChunksUnchanged,
+	})
 	return result, nil
 }
+
+// DirOptions selects the files IngestDir ingests. A pattern holding a "/" is matched
+// against the path relative to the directory, any other against the file or directory
+// name. Include defaults to markdown files; an excluded directory is not walked.
+// DateFrom orders where each file's fallback date comes from, as fileValidAt takes it;
+// without it that is validAt alone.
+type DirOptions struct {
+	Include  []string
+	Exclude  []string
+	DateFrom []string
+}
+
+var defaultDirInclude = []string{"*.md", "*.markdown"}
+
+// DirFileResult is the outcome of ingesting one file of a directory.
+type DirFileResult struct {
+	Path   string
+	Result IngestResult
+	Err    error
+}
+
+// IngestDir ingests every file under dir matching opts, in path order. A file that fails
+// is recorded in its result and the walk goes on; only a failure to list the directory
+// (or ctx ending) stops it.
+func IngestDir(ctx context.Context, db *sql.DB, ollama *OllamaClient, dir, validAt string, opts DirOptions, chunking ChunkOptions, progress ProgressFunc) ([]DirFileResult, error) {
+	files, err := DirFiles(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	var results []DirFileResult
+	for i, file := range files {
+		if progress != nil {
+			progress(i, len(files), file)
+		}
+		fileDate, err := fileValidAt(file, validAt, opts.DateFrom)
+		var result IngestResult
+		if err == nil {
+			result, err = IngestFile(ctx, db, ollama, file, fileDate, chunking)
+		}
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		results = append(results, DirFileResult{Path: file, Result: result, Err: err})
+	}
+	if progress != nil && len(files) > 0 {
+		progress(len(files), len(files), "")
+	}
+	return results, nil
+}
+
+// DirFiles lists the files under dir that opts selects, in path order.
+func DirFiles(dir string, opts DirOptions) ([]string, error) {
+	include := opts.Include
+	if len(include) == 0 {
+		include = defaultDirInclude
+	}
+	for _, pattern := range append(append([]string{}, include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if matchesAny(opts.Exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && d.Type().IsRegular() && matchesAny(include, rel) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// matchesAny reports whether rel, a slash-separated relative path, matches one of patterns.
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
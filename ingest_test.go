@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseMarkdownH2Only(t *testing.T) {
@@ -29,6 +34,38 @@ func TestParseMarkdownH2Only(t *testing.T) {
 	}
 }
 
+func TestParseMarkdownStream(t *testing.T) {
+	content := "Intro line.\n\n## First\nAlpha content.\n\n### Sub, June 2, 2025\nBeta.\n\n## Second\n" + strings.Repeat("word ", 5000) + "\n"
+
+	var streamed []Section
+	err := ParseMarkdownStream(strings.NewReader(content), func(section Section) error {
+		streamed = append(streamed, section)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ParseMarkdownStream: %v", err)
+	}
+	// Compare with the pre-streaming behavior: lines split on "\n"
+	if len(streamed) != 4 || streamed[2].ValidAt != "2025-06-02" || streamed[3].Title != "Second" {
+		t.Fatalf("unexpected sections: %+v", streamed)
+	}
+	for i, section := range ParseMarkdown(content) {
+		if !reflect.DeepEqual(section, streamed[i]) {
+			t.Fatalf("section %d differs: %+v vs %+v", i, section, streamed[i])
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = ParseMarkdownStream(strings.NewReader(content), func(Section) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("expected the first error to stop parsing, got %v after %d calls", err, calls)
+	}
+}
+
 func TestParseMarkdownH3Preferred(t *testing.T) {
 	content := strings.Join([]string{
 		"## Architecture Decisions",
@@ -84,6 +121,44 @@ func TestParseMarkdownPreamble(t *testing.T) {
 	}
 }
 
+func TestParseMarkdownDepth(t *testing.T) {
+	content := strings.Join([]string{
+		"## Design (March 3, 2026)",
+		"Overview",
+		"### Storage",
+		"#### Tables",
+		"Chunks and vectors",
+		"##### Indexes",
+		"On valid_at",
+		"#### Backups",
+		"Nightly",
+		"### API",
+		"REST",
+	}, "\n")
+
+	// By default #### and deeper stay in their ### section
+	sections := ParseMarkdown(content)
+	if len(sections) != 3 || sections[1].Title != "Storage" || !strings.Contains(sections[1].Content, "#### Backups\nNightly") {
+		t.Fatalf("expected ## and ### sections only, got %+v", sections)
+	}
+
+	var got []string
+	err := ParseMarkdownStreamDepth(strings.NewReader(content), 5, func(s Section) error {
+		got = append(got, fmt.Sprintf("%d %s | %s | %s | %s", s.HeaderLevel, s.ParentTitle, s.Title, s.Content, s.ValidAt))
+		return nil
+	})
+	want := []string{
+		"2  | Design (March 3, 2026) | Overview | 2026-03-03",
+		"4 Design (March 3, 2026) > Storage | Tables | Chunks and vectors | 2026-03-03",
+		"5 Design (March 3, 2026) > Storage > Tables | Indexes | On valid_at | 2026-03-03",
+		"4 Design (March 3, 2026) > Storage | Backups | Nightly | 2026-03-03",
+		"3 Design (March 3, 2026) | API | REST | 2026-03-03",
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, %v\nwant %q", got, err, want)
+	}
+}
+
 func TestExtractDateFromHeader(t *testing.T) {
 	tests := map[string]string{
 		"## January 21, 2026":                             "2026-01-21",
@@ -103,6 +178,51 @@ func TestExtractDateFromHeader(t *testing.T) {
 	}
 }
 
+func TestExtractDateFromHeaderFormats(t *testing.T) {
+	previous := dayFirst
+	defer func() { dayFirst = previous }()
+	dayFirst = false
+
+	tests := map[string]string{
+		"## 2026-01-21 standup":                "2026-01-21",
+		"## Notes 2026-02-30":                  "",
+		"## 21 Jan 2026":                       "2026-01-21",
+		"## 3rd March, 2026 retro":             "2026-03-03",
+		"## Jan 21 2026":                       "2026-01-21",
+		"## Sept. 9, 2026":                     "2026-09-09",
+		"## Week of January 20, 2026":          "2026-01-20",
+		"## Sprint 2026-W04":                   "2026-01-19",
+		"## Sprint 2026-W54":                   "",
+		"## 01/21/2026":                        "2026-01-21",
+		"## 21/01/2026":                        "2026-01-21",
+		"## 03/04/2026":                        "2026-03-04",
+		"## 13/13/2026":                        "",
+		"## Janet's notes 2026":                "",
+		"## Moved 2026-01-21 to Feb 2, 2026":   "2026-01-21",
+		"## Moved Feb 2, 2026 from 2026-01-21": "2026-02-02",
+	}
+	for header, expected := range tests {
+		if got := ExtractDateFromHeader(header); got != expected {
+			t.Fatalf("expected %q for %q, got %q", expected, header, got)
+		}
+	}
+
+	// Both numbers 12 or under: the configured order decides
+	t.Setenv("MNEME_DATE_ORDER", "dmy")
+	if err := loadDateOrder(); err != nil {
+		t.Fatalf("loadDateOrder: %v", err)
+	}
+	for header, expected := range map[string]string{"## 03/04/2026": "2026-04-03", "## 04.13.2026": "2026-04-13", "## 13-04-2026": "2026-04-13"} {
+		if got := ExtractDateFromHeader(header); got != expected {
+			t.Fatalf("expected %q for %q day first, got %q", expected, header, got)
+		}
+	}
+	t.Setenv("MNEME_DATE_ORDER", "ymd")
+	if err := loadDateOrder(); err == nil {
+		t.Fatal("expected an error for an unknown order")
+	}
+}
+
 func TestParseMarkdownWithDates(t *testing.T) {
 	content := strings.Join([]string{
 		"## January 21, 2026",
@@ -142,7 +262,7 @@ func TestChunkSection(t *testing.T) {
 		Content:     "one two three four five",
 		Sequence:    1,
 	}
-	chunks := ChunkSection(section, 600)
+	chunks := ChunkSection(section, ChunkOptions{Words: 600})
 	if len(chunks) != 1 {
 		t.Fatalf("expected 1 chunk, got %d", len(chunks))
 	}
@@ -173,7 +293,7 @@ func TestChunkSectionOversized(t *testing.T) {
 		Sequence:    2,
 	}
 
-	chunks := ChunkSection(section, 600)
+	chunks := ChunkSection(section, ChunkOptions{Words: 600})
 	if len(chunks) != 2 {
 		t.Fatalf("expected 2 chunks, got %d", len(chunks))
 	}
@@ -197,7 +317,7 @@ func TestChunkSectionPreservesMetadata(t *testing.T) {
 		Sequence:    5,
 	}
 
-	chunks := ChunkSection(section, 600)
+	chunks := ChunkSection(section, ChunkOptions{Words: 600})
 	if len(chunks) < 2 {
 		t.Fatalf("expected multiple chunks, got %d", len(chunks))
 	}
@@ -251,7 +371,8 @@ func TestIngestFile(t *testing.T) {
 	defer db.Close()
 
 	client := NewOllamaClient(server.URL, "test-embed-model")
-	result, err := IngestFile(db, client, filePath, "2024-01-01T00:00:00Z")
+	withLocation(t, time.UTC)
+	result, err := IngestFile(context.Background(), db, client, filePath, "2024-01-01T00:00:00Z", defaultChunking)
 	if err != nil {
 		t.Fatalf("IngestFile: %v", err)
 	}
@@ -282,7 +403,7 @@ func TestIngestFile(t *testing.T) {
 	if storedSource != filePath {
 		t.Fatalf("expected source_file %q, got %q", filePath, storedSource)
 	}
-	if !storedValid.Valid || storedValid.String != "2024-01-01T00:00:00Z" {
+	if !storedValid.Valid || storedValid.String != "2024-01-01" {
 		t.Fatalf("unexpected valid_at: %+v", storedValid)
 	}
 	if storedIngested == "" {
@@ -332,7 +453,8 @@ func TestIngestFileSectionDates(t *testing.T) {
 	defer db.Close()
 
 	client := NewOllamaClient(server.URL, "test-embed-model")
-	result, err := IngestFile(db, client, filePath, "2024-01-01T00:00:00Z")
+	withLocation(t, time.UTC)
+	result, err := IngestFile(context.Background(), db, client, filePath, "2024-01-01T00:00:00Z", defaultChunking)
 	if err != nil {
 		t.Fatalf("IngestFile: %v", err)
 	}
@@ -365,7 +487,7 @@ func TestIngestFileSectionDates(t *testing.T) {
 	expected := map[string]string{
 		"Part 1: Authentication Flow": "2026-01-21",
 		"Part 2: Caching Strategy":    "2026-01-21",
-		"Summary":                     "2024-01-01T00:00:00Z",
+		"Summary":                     "2024-01-01",
 		"January 30, 2026":            "2026-01-30",
 	}
 
@@ -383,3 +505,77 @@ func TestIngestFileSectionDates(t *testing.T) {
 		}
 	}
 }
+
+func TestDirFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "b.txt", "notes/c.markdown", "notes/drafts/d.md", "archive/e.md", "notes/skip.md"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, []byte("## Note\nText."), 0o644)
+	}
+	rel := func(files []string) string {
+		var names []string
+		for _, f := range files {
+			r, _ := filepath.Rel(dir, f)
+			names = append(names, filepath.ToSlash(r))
+		}
+		return strings.Join(names, ",")
+	}
+
+	files, err := DirFiles(dir, DirOptions{})
+	if err != nil {
+		t.Fatalf("DirFiles: %v", err)
+	}
+	if got := rel(files); got != "a.md,archive/e.md,notes/c.markdown,notes/drafts/d.md,notes/skip.md" {
+		t.Fatalf("expected every markdown file, got %s", got)
+	}
+
+	files, err = DirFiles(dir, DirOptions{Include: []string{"*.md", "*.txt"}, Exclude: []string{"archive", "notes/drafts", "skip.*"}})
+	if err != nil {
+		t.Fatalf("DirFiles: %v", err)
+	}
+	if got := rel(files); got != "a.md,b.txt" {
+		t.Fatalf("expected the excluded directories and file skipped, got %s", got)
+	}
+
+	if _, err := DirFiles(dir, DirOptions{Include: []string{"[a-"}}); err == nil {
+		t.Fatal("expected an error for a malformed pattern")
+	}
+}
+
+func TestIngestDir(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.Contains(req.Input, "boom") {
+			http.Error(w, "embedding failed", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(embedResponse{Embeddings: [][]float64{make([]float64, EmbedDimension)}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.md"), []byte("## One\nFirst.\n\n## Two\nSecond."), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.md"), []byte("## Bad\nboom"), 0o644)
+	os.WriteFile(filepath.Join(dir, "c.md"), []byte("## Three\nThird."), 0o644)
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	results, err := IngestDir(context.Background(), db, NewOllamaClient(server.URL, "embed"), dir, "", DirOptions{}, defaultChunking, nil)
+	if err != nil {
+		t.Fatalf("IngestDir: %v", err)
+	}
+	if len(results) != 3 || results[0].Err != nil || results[0].Result.ChunksCreated != 2 || results[1].Err == nil || results[2].Err != nil {
+		t.Fatalf("expected the failed file reported and the others ingested, got %+v", results)
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&count)
+	if count != 3 {
+		t.Fatalf("expected 3 chunks, got %d", count)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// jsonlParser returns the text message in one JSONL line starting at byte offset, if it
+// holds one.
+type jsonlParser func(line []byte, offset int64) (textMessage, bool)
+
+// scanJSONL passes each text message after byte offset to fn, reading one line at a
+// time, and returns the offset to resume from. A trailing line that is still being
+// written (no newline yet and not valid JSON) is left for the next scan.
+func scanJSONL(filePath string, offset int64, parse jsonlParser, fn func(textMessage)) (int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	reader := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, n, complete, err := readLine(reader, maxCCLineBytes)
+		if err != nil && err != io.EOF {
+			return offset, err
+		}
+		if !complete && !json.Valid(line) {
+			return offset, nil
+		}
+		if tm, ok := parse(line, offset); ok {
+			fn(tm)
+		}
+		offset += n
+		if err == io.EOF {
+			return offset, nil
+		}
+	}
+}
+
+// jsonlWatch is a JSONL transcript to follow: a Claude Code session for watch-cc, any
+// agent's log for watch-jsonl.
+type jsonlWatch struct {
+	watcher   string // its watch_state name, also the scheme of its sources
+	sessionID string
+	title     string
+	path      string
+	parse     jsonlParser
+}
+
+// watchOptions are the batching, titling and chunking options of a JSONL watcher.
+type watchOptions struct {
+	batchSize     int
+	pollSec       int
+	summaryIdle   time.Duration
+	flushAfter    time.Duration
+	generateModel string
+	noTitles      bool
+	chunking      ChunkOptions
+}
+
+// followJSONL ingests what is appended to a transcript in batches until SIGINT or
+// SIGTERM, then flushes what is pending. Batches are stored as
+// <watcher>://<session>/batch-N.
+func followJSONL(ctx context.Context, db *sql.DB, ollama *OllamaClient, w jsonlWatch, opts watchOptions) {
+	removeOrphanVectors(db)
+
+	// Find batch number
+	batchPrefix := fmt.Sprintf("%s://%s/batch-", w.watcher, w.sessionID)
+	batchNum := nextWatchSeq(db, batchPrefix)
+	summarizer := newSessionSummarizer(db, ollama, opts.generateModel, fmt.Sprintf("%s://%s/summary-", w.watcher, w.sessionID), w.title, opts.summaryIdle)
+	titleModel := opts.generateModel
+	if opts.noTitles {
+		titleModel = ""
+	}
+
+	// Each poll reads only what was appended since the offset, which is saved with every
+	// batch so a restart picks up the messages written while the watcher was down
+	offset, watched, err := watchedOffset(db, w.watcher, w.sessionID)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if info, err := os.Stat(w.path); watched && err == nil && offset <= info.Size() {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Resuming at byte %d. Watching for new...", offset)))
+	} else {
+		// Watched for the first time, or the transcript was rewritten: start from now
+		skipped := 0
+		offset, _ = scanJSONL(w.path, 0, w.parse, func(textMessage) { skipped++ })
+		if err := withWriteTx(db, "save watch state", func(tx *sql.Tx) error {
+			return saveWatchedOffset(tx, w.watcher, w.sessionID, offset)
+		}); err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Skipping %d existing messages. Watching for new...", skipped)))
+	}
+	fmt.Println()
+
+	var pending []textMessage
+	var lastMessage time.Time
+	// Pending holds everything read up to offset, so a stored batch covers the file to there
+	saveState := func(tx *sql.Tx) error {
+		return saveWatchedOffset(tx, w.watcher, w.sessionID, offset)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	ticker := time.NewTicker(time.Duration(opts.pollSec) * time.Second)
+	defer ticker.Stop()
+
+	flushPending := func() {
+		if len(pending) == 0 {
+			return
+		}
+		fmt.Println()
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Flushing %d pending messages...", len(pending))))
+		sourceFile := fmt.Sprintf("%s%d", batchPrefix, batchNum)
+		if err := ingestBatch(ctx, db, ollama, titleModel, sourceFile, pending, w.title, opts.chunking, saveState); err != nil {
+			fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Flush error: %v", err)))
+			return
+		}
+		batchNum++
+		fmt.Println(renderIngest(len(pending), batchNum))
+		pending = nil
+	}
+
+	summarizeSession := func() {
+		if summarizer == nil || len(summarizer.messages) == 0 {
+			return
+		}
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Summarizing %d messages...", len(summarizer.messages))))
+		sourceFile, err := summarizer.summarize(ctx, time.Now())
+		if err != nil {
+			fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Summary error: %v", err)))
+			return
+		}
+		if sourceFile != "" {
+			fmt.Println(renderPreflightStep("ok", "Stored session summary "+sourceFile))
+		}
+	}
+
+	for {
+		select {
+		case <-sigCh:
+			flushPending()
+			summarizeSession()
+			fmt.Println()
+			fmt.Println(infoStyle.Render("  Stopped."))
+			return
+		case <-ticker.C:
+		}
+
+		// A quiet session gets its last partial batch and a summary written
+		if summarizer.due(time.Now()) {
+			flushPending()
+			summarizeSession()
+		}
+		if idleFlushDue(len(pending), lastMessage, opts.flushAfter, time.Now()) {
+			flushPending()
+		}
+
+		var newMsgs []textMessage
+		offset, err = scanJSONL(w.path, offset, w.parse, func(tm textMessage) {
+			newMsgs = append(newMsgs, tm)
+		})
+		if err != nil || len(newMsgs) == 0 {
+			continue
+		}
+
+		for _, tm := range newMsgs {
+			pending = append(pending, tm)
+			lastMessage = time.Now()
+			summarizer.add(tm, time.Now())
+			fmt.Println(renderMessage(tm.Role, tm.Timestamp.Format("15:04:05"), tm.Text, tm.IsUser))
+		}
+
+		if len(pending) >= opts.batchSize {
+			sourceFile := fmt.Sprintf("%s%d", batchPrefix, batchNum)
+			if err := ingestBatch(ctx, db, ollama, titleModel, sourceFile, pending, w.title, opts.chunking, saveState); err != nil {
+				fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Ingest error: %v", err)))
+				if errors.Is(err, errDatabaseBusy) {
+					fmt.Println(infoStyle.Render(fmt.Sprintf("  Keeping %d messages for the next poll", len(pending))))
+				}
+				continue
+			}
+
+			batchNum++
+			fmt.Println()
+			fmt.Println(renderIngest(len(pending), batchNum))
+			fmt.Println()
+			pending = nil
+		}
+	}
+}
+
+// jsonlMapping says where a JSONL log keeps the parts of a message. Fields are dotted
+// paths into each line's object, e.g. "message.content".
+type jsonlMapping struct {
+	Role      string   `json:"role"`
+	Text      string   `json:"text"`
+	Timestamp string   `json:"timestamp"`
+	ID        string   `json:"id"`
+	User      []string `json:"user"`      // role values of the user's messages
+	Assistant []string `json:"assistant"` // role values of the agent's messages
+}
+
+func defaultJSONLMapping() jsonlMapping {
+	return jsonlMapping{
+		Role:      "role",
+		Text:      "text",
+		Timestamp: "timestamp",
+		ID:        "id",
+		User:      []string{"user", "human"},
+		Assistant: []string{"assistant", "ai", "model"},
+	}
+}
+
+// loadJSONLMapping reads a mapping file over the defaults; fields it leaves out keep
+// theirs.
+func loadJSONLMapping(path string) (jsonlMapping, error) {
+	mapping := defaultJSONLMapping()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return mapping, fmt.Errorf("read mapping: %w", err)
+	}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return mapping, fmt.Errorf("parse mapping %s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// jsonlField looks up a dotted path in a decoded JSON object.
+func jsonlField(entry map[string]any, path string) (any, bool) {
+	var value any = entry
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonlText reads message text: a string, or an array of strings and
+// {"type": "text", "text": ...} blocks as chat APIs log content.
+func jsonlText(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		var texts []string
+		for _, part := range v {
+			switch p := part.(type) {
+			case string:
+				texts = append(texts, p)
+			case map[string]any:
+				if t, ok := p["text"].(string); ok && (p["type"] == nil || p["type"] == "text") {
+					texts = append(texts, t)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// jsonlTime reads a timestamp: RFC 3339, or Unix seconds or milliseconds.
+func jsonlTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		if ts, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return ts, true
+		}
+	case float64:
+		if v > 1e12 {
+			return time.UnixMilli(int64(v)), true
+		}
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+// parser returns a jsonlParser for a log mapped by m. A line without an ID is named by
+// its offset, which stays put as the file grows; IDs are prefixed with the session so two
+// logs numbering their lines alike don't collide.
+func (m jsonlMapping) parser(sessionID, userAlias, assistantAlias string) jsonlParser {
+	return func(line []byte, offset int64) (textMessage, bool) {
+		var entry map[string]any
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return textMessage{}, false
+		}
+		role, _ := jsonlField(entry, m.Role)
+		roleName, _ := role.(string)
+		var isUser bool
+		switch {
+		case containsFold(m.User, roleName):
+			isUser = true
+		case containsFold(m.Assistant, roleName):
+		default:
+			// System prompts, tool calls and the like
+			return textMessage{}, false
+		}
+
+		text, _ := jsonlField(entry, m.Text)
+		cleaned := stripNoise(jsonlText(text))
+		if len(cleaned) < 3 {
+			return textMessage{}, false
+		}
+
+		ts := time.Now()
+		if value, ok := jsonlField(entry, m.Timestamp); ok {
+			if parsed, ok := jsonlTime(value); ok {
+				ts = parsed
+			}
+		}
+
+		id := fmt.Sprintf("@%d", offset)
+		if value, ok := jsonlField(entry, m.ID); ok && value != nil {
+			id = fmt.Sprint(value)
+		}
+
+		tm := textMessage{
+			Role:      assistantAlias,
+			Text:      cleaned,
+			Timestamp: ts.In(mnemeLocation),
+			IsUser:    isUser,
+			MessageID: sessionID + "/" + id,
+			SessionID: sessionID,
+		}
+		if isUser {
+			tm.Role = userAlias
+		}
+		return tm, true
+	}
+}
+
+func runWatchJSONL(args []string, mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias string) {
+	fs := flag.NewFlagSet("watch-jsonl", flag.ExitOnError)
+	defaults := defaultJSONLMapping()
+	mapFile := fs.String("map", "", "JSON file with the field mapping: role, text, timestamp, id, user and assistant")
+	roleField := fs.String("role-field", "", "field holding the speaker, a dotted path (default \""+defaults.Role+"\")")
+	textField := fs.String("text-field", "", "field holding the message text (default \""+defaults.Text+"\")")
+	timeField := fs.String("time-field", "", "field holding the RFC 3339 or Unix timestamp (default \""+defaults.Timestamp+"\")")
+	idField := fs.String("id-field", "", "field holding a message ID (default \""+defaults.ID+"\"; without one lines are named by offset)")
+	userRoles := fs.String("user-roles", "", "comma-separated roles of the user's messages (default \""+strings.Join(defaults.User, ",")+"\")")
+	assistantRoles := fs.String("assistant-roles", "", "comma-separated roles of the agent's messages (default \""+strings.Join(defaults.Assistant, ",")+"\")")
+	sessionID := fs.String("session", "", "session ID for the log (default: the file name without extension)")
+	sessionTitle := fs.String("title", "", "session title (default: the session ID)")
+	batchSize := fs.Int("batch", 6, "text messages before ingesting")
+	pollSec := fs.Int("poll", 3, "poll interval in seconds")
+	summaryIdle := fs.Int("summary-idle", 10, "minutes of quiet before summarizing the session (0 disables)")
+	flushAfter := fs.Duration("flush-after", 0, "ingest a partial batch after this long without new messages, e.g. 5m (0 waits for a full batch)")
+	noTitles := fs.Bool("no-titles", false, "keep date headings instead of titling each batch with the generate model")
+	chunks := newChunkFlags(fs)
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics on this address, e.g. :9464")
+	daemon := fs.Bool("daemon", false, "run unattended: write a PID file and log to a file instead of the terminal")
+	pidFile := fs.String("pid-file", "", "daemon PID file (default: next to the database)")
+	logFile := fs.String("log-file", "", "daemon log file (default: next to the database)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	chunking, err := chunks.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if fs.NArg() != 1 {
+		log.Fatal("usage: mneme watch-jsonl [flags] <file.jsonl>")
+	}
+	path := fs.Arg(0)
+
+	mapping := defaults
+	if *mapFile != "" {
+		var err error
+		if mapping, err = loadJSONLMapping(*mapFile); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	// Flags win over the mapping file
+	for field, value := range map[*string]string{&mapping.Role: *roleField, &mapping.Text: *textField, &mapping.Timestamp: *timeField, &mapping.ID: *idField} {
+		if value != "" {
+			*field = value
+		}
+	}
+	if *userRoles != "" {
+		mapping.User = strings.Split(*userRoles, ",")
+	}
+	if *assistantRoles != "" {
+		mapping.Assistant = strings.Split(*assistantRoles, ",")
+	}
+
+	if *sessionID == "" {
+		*sessionID = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	title := *sessionTitle
+	if title == "" {
+		title = *sessionID
+	}
+
+	if *daemon {
+		stop, err := startDaemon(daemonPaths(watcherJSONL, mnemeDB, *pidFile, *logFile))
+		if err != nil {
+			log.Fatalf("daemon: %v", err)
+		}
+		defer stop()
+	}
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	fmt.Println()
+	// The watcher catches Ctrl+C itself to flush what is pending, so its work runs to
+	// completion rather than on a cancellable context.
+	ctx := context.Background()
+	if err := watchPreflight(ctx, ollamaHost, embedModel); err != nil {
+		log.Fatalf("preflight: %v", err)
+	}
+
+	fmt.Println()
+	fmt.Println(renderWatchStatus(title, *sessionID, *batchSize, *pollSec, mnemeDB))
+	fmt.Println()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	followJSONL(ctx, db, ollama, jsonlWatch{
+		watcher:   watcherJSONL,
+		sessionID: *sessionID,
+		title:     title,
+		path:      path,
+		parse:     mapping.parser(*sessionID, userAlias, assistantAlias),
+	}, watchOptions{
+		batchSize:     *batchSize,
+		pollSec:       *pollSec,
+		summaryIdle:   time.Duration(*summaryIdle) * time.Minute,
+		flushAfter:    *flushAfter,
+		generateModel: generateModel,
+		noTitles:      *noTitles,
+		chunking:      chunking,
+	})
+}
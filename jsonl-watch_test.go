@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLMappingParser(t *testing.T) {
+	withLocation(t, time.UTC)
+	mapping := defaultJSONLMapping()
+	mapping.Role = "author.kind"
+	mapping.Text = "message.content"
+	mapping.Timestamp = "ts"
+	mapping.User = []string{"me"}
+	mapping.Assistant = []string{"bot"}
+	parse := mapping.parser("run", "Me", "AI")
+
+	tm, ok := parse([]byte(`{"id":7,"author":{"kind":"ME"},"ts":"2025-06-02T10:00:00Z","message":{"content":"Where do the logs go?"}}`), 0)
+	if !ok || !tm.IsUser || tm.Role != "Me" || tm.Text != "Where do the logs go?" || tm.MessageID != "run/7" || tm.SessionID != "run" {
+		t.Fatalf("unexpected user message: %+v, %v", tm, ok)
+	}
+	if !tm.Timestamp.Equal(time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected timestamp %v", tm.Timestamp)
+	}
+
+	// Content blocks, a millisecond timestamp, and no ID
+	tm, ok = parse([]byte(`{"author":{"kind":"bot"},"ts":1748858460000,"message":{"content":[{"type":"text","text":"To S3."},{"type":"tool_use","text":"ls"},"Daily."]}}`), 120)
+	if !ok || tm.IsUser || tm.Role != "AI" || tm.Text != "To S3.\nDaily." || tm.MessageID != "run/@120" {
+		t.Fatalf("unexpected assistant message: %+v, %v", tm, ok)
+	}
+	if !tm.Timestamp.Equal(time.Date(2025, 6, 2, 10, 1, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected timestamp %v", tm.Timestamp)
+	}
+
+	for _, line := range []string{
+		`{"author":{"kind":"system"},"message":{"content":"You are a helpful agent."}}`,
+		`{"author":{"kind":"bot"},"message":{"content":"ok"}}`,
+		`not json`,
+	} {
+		if tm, ok := parse([]byte(line), 0); ok {
+			t.Fatalf("expected %s skipped, got %+v", line, tm)
+		}
+	}
+}
+
+func TestLoadJSONLMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "map.json")
+	if err := os.WriteFile(path, []byte(`{"text": "body", "user": ["customer"]}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	mapping, err := loadJSONLMapping(path)
+	if err != nil {
+		t.Fatalf("loadJSONLMapping: %v", err)
+	}
+	if mapping.Text != "body" || mapping.Role != "role" || len(mapping.User) != 1 || mapping.User[0] != "customer" || len(mapping.Assistant) != 3 {
+		t.Fatalf("expected the file over the defaults, got %+v", mapping)
+	}
+}
+
+func TestScanJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	lines := `{"role":"user","text":"How do we rotate tokens?"}` + "\n" +
+		`{"role":"assistant","text":"Rotate them weekly."}` + "\n"
+	if err := os.WriteFile(path, []byte(lines), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	parse := defaultJSONLMapping().parser("run", "Me", "AI")
+
+	var got []textMessage
+	collect := func(tm textMessage) { got = append(got, tm) }
+	offset, err := scanJSONL(path, 0, parse, collect)
+	if err != nil || len(got) != 2 || got[0].MessageID != "run/@0" {
+		t.Fatalf("unexpected messages: %+v, %v", got, err)
+	}
+	// Lines are named by where they start, so a rescan names them alike
+	if want := "run/@" + strconv.Itoa(strings.Index(lines, "\n")+1); got[1].MessageID != want {
+		t.Fatalf("expected %s, got %s", want, got[1].MessageID)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	f.WriteString(`{"role":"user","text":"And the`)
+	got = nil
+	next, err := scanJSONL(path, offset, parse, collect)
+	if err != nil || len(got) != 0 || next != offset {
+		t.Fatalf("expected the partial line left unread, got %+v at %d (from %d), %v", got, next, offset, err)
+	}
+	f.WriteString(` signing keys?"}` + "\n")
+	if _, err := scanJSONL(path, next, parse, collect); err != nil || len(got) != 1 || got[0].MessageID != "run/@"+strconv.Itoa(int(offset)) {
+		t.Fatalf("expected the finished line, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mailMessage is one email, reduced to what is worth remembering.
+type mailMessage struct {
+	ID      string
+	Subject string
+	From    string
+	To      string
+	Date    time.Time
+	Body    string
+}
+
+// mailbox is a store of email import-mail reads: an mbox file or a Maildir folder.
+type mailbox struct {
+	Path    string
+	Maildir bool
+}
+
+// maxMailBytes caps the size of one message read from a mailbox; attachments beyond it
+// are cut off, which leaves the text parts that come first.
+const maxMailBytes = 25 << 20
+
+// readMbox splits an mbox file into its messages at the "From " lines that start each,
+// undoing the ">From " escaping of lines in bodies.
+func readMbox(r io.Reader) ([]mailMessage, error) {
+	reader := bufio.NewReader(r)
+	var messages []mailMessage
+	var raw bytes.Buffer
+	flush := func() {
+		if raw.Len() == 0 {
+			return
+		}
+		// One mangled message should not lose the rest of the mailbox
+		if m, err := parseMail(raw.Bytes()); err == nil {
+			messages = append(messages, m)
+		}
+		raw.Reset()
+	}
+	previousBlank := true
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			switch {
+			case previousBlank && strings.HasPrefix(line, "From "):
+				flush()
+			case strings.HasPrefix(line, ">") && strings.HasPrefix(strings.TrimLeft(line, ">"), "From "):
+				raw.WriteString(line[1:])
+			default:
+				if raw.Len() < maxMailBytes {
+					raw.WriteString(line)
+				}
+			}
+			previousBlank = strings.TrimRight(line, "\r\n") == ""
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	flush()
+	return messages, nil
+}
+
+// readMaildir reads the messages in a Maildir's cur and new folders, in name order.
+func readMaildir(dir string) ([]mailMessage, error) {
+	var messages []mailMessage
+	for _, sub := range []string{"cur", "new"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			data, err := readLimited(filepath.Join(dir, sub, entry.Name()), maxMailBytes)
+			if err != nil {
+				return nil, err
+			}
+			if m, err := parseMail(data); err == nil {
+				messages = append(messages, m)
+			}
+		}
+	}
+	return messages, nil
+}
+
+func readLimited(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
+
+// mailHeaderDecoder decodes =?charset?...?= words in headers.
+var mailHeaderDecoder = mime.WordDecoder{CharsetReader: charsetReader}
+
+// parseMail reads one RFC 5322 message.
+func parseMail(raw []byte) (mailMessage, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return mailMessage{}, err
+	}
+	header := func(key string) string {
+		value := msg.Header.Get(key)
+		if decoded, err := mailHeaderDecoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		return strings.Join(strings.Fields(value), " ")
+	}
+	m := mailMessage{
+		ID:      header("Message-Id"),
+		Subject: header("Subject"),
+		From:    mailNames(header("From")),
+		To:      mailNames(header("To")),
+	}
+	m.Date, _ = mail.ParseDate(msg.Header.Get("Date"))
+	body, err := mailText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return m, err
+	}
+	m.Body = stripQuotedReply(body)
+	return m, nil
+}
+
+// mailNames reduces an address list to its display names, or the addresses of those
+// without one.
+func mailNames(list string) string {
+	addresses, err := mail.ParseAddressList(list)
+	if err != nil {
+		return list
+	}
+	names := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		if a.Name != "" {
+			names = append(names, a.Name)
+		} else {
+			names = append(names, a.Address)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// mailText returns the readable text of a message body: its text/plain part, or failing
+// that its text/html part as plain text. Attachments are skipped.
+func mailText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	body = decodeTransfer(encoding, body)
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		var plain, html string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Disposition"), "attachment") {
+				continue
+			}
+			text, err := mailText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", err
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			switch {
+			case plain == "" && (partType == "text/plain" || partType == "" || strings.HasPrefix(partType, "multipart/")):
+				plain = text
+			case html == "" && partType == "text/html":
+				html = text
+			}
+		}
+		if plain != "" {
+			return plain, nil
+		}
+		return html, nil
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	text := decodeCharset(params["charset"], data)
+	if mediaType == "text/html" {
+		return htmlToText(text), nil
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n"), nil
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		// The decoder skips the line breaks base64 bodies are wrapped with
+		return base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return r
+}
+
+// charsetReader decodes the Latin-1 family, the other charset old mail is commonly in;
+// anything else is read as UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decodeCharset(charset, data)), nil
+}
+
+func decodeCharset(charset string, data []byte) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso-8859-15", "latin1", "windows-1252", "cp1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return string(data)
+}
+
+var (
+	// "On Tue, Jan 20, 2026 at 9:14 AM Alex <alex@example.com> wrote:", often wrapped
+	replyAttribution = regexp.MustCompile(`(?i)^(on|am|le|el)\b.*\b(wrote|schrieb|a écrit|escribió):?$`)
+	originalMessage  = regexp.MustCompile(`(?i)^-{2,}\s*(original message|forwarded message)\s*-{2,}$`)
+	sentFromDevice   = regexp.MustCompile(`(?i)^sent from my \w+`)
+)
+
+// stripQuotedReply keeps what the sender wrote: quoted lines, the earlier message under
+// a reply's attribution line and the signature after "-- " are dropped.
+func stripQuotedReply(body string) string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	var kept []string
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		next := ""
+		if i+1 < len(lines) {
+			next = strings.TrimSpace(lines[i+1])
+		}
+		if line == "-- " || trimmed == "--" || quoteStarts(trimmed, next) {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") || sentFromDevice.MatchString(trimmed) {
+			continue
+		}
+		kept = append(kept, strings.TrimRight(line, " \t"))
+	}
+	return strings.TrimSpace(extraBlanks.ReplaceAllString(strings.Join(kept, "\n"), "\n\n"))
+}
+
+// quoteStarts reports whether line, followed by next, introduces the message a reply or
+// forward quotes: an attribution line, perhaps wrapped onto next, or Outlook's header block.
+func quoteStarts(line, next string) bool {
+	switch {
+	case originalMessage.MatchString(line), replyAttribution.MatchString(line):
+		return true
+	case strings.HasPrefix(line, "On ") && replyAttribution.MatchString(line+" "+next):
+		return true
+	case strings.HasPrefix(line, "From: "):
+		return strings.HasPrefix(next, "Sent: ") || strings.HasPrefix(next, "Date: ")
+	}
+	return false
+}
+
+// buildMailMarkdown renders emails as sections titled by their subject and dated when
+// they were sent, each closing with who wrote to whom.
+func buildMailMarkdown(messages []mailMessage) string {
+	var b strings.Builder
+	for _, m := range messages {
+		if m.Body == "" {
+			continue
+		}
+		title := m.Subject
+		if title == "" {
+			title = "(no subject)"
+		}
+		if !m.Date.IsZero() {
+			title += " (" + m.Date.In(mnemeLocation).Format("January 2, 2006") + ")"
+		}
+		fmt.Fprintf(&b, "## %s\n\n%s\n\n", title, demoteHeadings(m.Body))
+		line := "Email"
+		if m.From != "" {
+			line += " from " + m.From
+		}
+		if m.To != "" {
+			line += " to " + m.To
+		}
+		b.WriteString(line + ".\n\n")
+	}
+	return b.String()
+}
+
+type MailImportResult struct {
+	Mailboxes int
+	Messages  int
+	// Duplicates counts messages skipped because another folder held them too
+	Duplicates int
+}
+
+// ImportMail ingests the email at path: an mbox file, a Maildir, or a directory holding
+// any number of them. Each mailbox becomes one source, so importing it again replaces
+// it, embedding only the messages that are new.
+func ImportMail(ctx context.Context, db *sql.DB, ollama *OllamaClient, path string, chunking ChunkOptions, progress ProgressFunc) (MailImportResult, error) {
+	var result MailImportResult
+	boxes, err := findMailboxes(path)
+	if err != nil {
+		return result, err
+	}
+	if len(boxes) == 0 {
+		return result, fmt.Errorf("no mbox files or Maildir folders in %s", path)
+	}
+
+	seen := make(map[string]bool)
+	for _, box := range boxes {
+		var messages []mailMessage
+		if box.Maildir {
+			messages, err = readMaildir(box.Path)
+		} else {
+			var f *os.File
+			if f, err = os.Open(box.Path); err == nil {
+				messages, err = readMbox(f)
+				f.Close()
+			}
+		}
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", box.Path, err)
+		}
+		kept := messages[:0]
+		for _, m := range messages {
+			if m.ID != "" && seen[m.ID] {
+				result.Duplicates++
+				continue
+			}
+			seen[m.ID] = true
+			kept = append(kept, m)
+		}
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].Date.Before(kept[j].Date) })
+
+		md := buildMailMarkdown(kept)
+		if md == "" {
+			continue
+		}
+		if _, err := IngestMarkdown(ctx, db, ollama, box.Path, strings.NewReader(md), "", chunking, progress); err != nil {
+			return result, fmt.Errorf("ingest %s: %w", box.Path, err)
+		}
+		result.Mailboxes++
+		result.Messages += len(kept)
+	}
+	return result, nil
+}
+
+// findMailboxes lists the mailboxes at path, in path order. A directory with cur or new
+// is a Maildir; a file is an mbox if it starts like one.
+func findMailboxes(path string) ([]mailbox, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if !isMbox(path) {
+			return nil, errors.New("want an mbox file or a Maildir, or a directory of them")
+		}
+		return []mailbox{{Path: path}}, nil
+	}
+	var boxes []mailbox
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if isMaildir(p) {
+				boxes = append(boxes, mailbox{Path: p, Maildir: true})
+			}
+			// A Maildir's own messages are read with it
+			if name := d.Name(); name == "cur" || name == "new" || name == "tmp" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if isMbox(p) {
+			boxes = append(boxes, mailbox{Path: p})
+		}
+		return nil
+	})
+	sort.Slice(boxes, func(i, j int) bool { return boxes[i].Path < boxes[j].Path })
+	return boxes, err
+}
+
+func isMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func isMbox(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	start := make([]byte, 5)
+	n, _ := io.ReadFull(f, start)
+	return string(start[:n]) == "From "
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testMbox = `From alex@example.com Tue Jan 20 09:14:00 2026
+From: Alex Chen <alex@example.com>
+To: Sam <sam@example.com>
+Subject: Lease renewal
+Date: Tue, 20 Jan 2026 09:14:00 +0000
+Message-ID: <1@example.com>
+
+The landlord agreed to keep the rent at 1450.
+>From now on the deposit is held in escrow.
+
+--
+Alex Chen
+Property Manager
+
+From sam@example.com Wed Jan 21 18:02:00 2026
+From: sam@example.com
+To: Alex Chen <alex@example.com>
+Subject: =?UTF-8?Q?Re:_Lease_renewal_=E2=9C=93?=
+Date: Wed, 21 Jan 2026 18:02:00 +0000
+Message-ID: <2@example.com>
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+Great, I'll sign it on Friday.
+
+Sent from my iPhone
+
+On Tue, Jan 20, 2026 at 9:14 AM Alex Chen <alex@example.com>
+wrote:
+> The landlord agreed to keep the rent at 1450.
+--b1
+Content-Type: text/html
+
+<p>Great, I'll sign it on Friday.</p>
+--b1--
+`
+
+func TestReadMbox(t *testing.T) {
+	messages, err := readMbox(strings.NewReader(testMbox))
+	if err != nil {
+		t.Fatalf("readMbox: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %+v", messages)
+	}
+	first, reply := messages[0], messages[1]
+	if first.Subject != "Lease renewal" || first.From != "Alex Chen" || first.To != "Sam" || !first.Date.Equal(time.Date(2026, 1, 20, 9, 14, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected headers %+v", first)
+	}
+	if first.Body != "The landlord agreed to keep the rent at 1450.\nFrom now on the deposit is held in escrow." {
+		t.Fatalf("expected the body unescaped and the signature dropped, got %q", first.Body)
+	}
+	if reply.Subject != "Re: Lease renewal ✓" || reply.From != "sam@example.com" || reply.Body != "Great, I'll sign it on Friday." {
+		t.Fatalf("expected the plain part without the quoted message, got %+v", reply)
+	}
+}
+
+func TestStripQuotedReply(t *testing.T) {
+	body := "Sounds good.\n\nFrom: Alex Chen\nSent: Monday, January 19, 2026\nSubject: Plans\n\nEarlier text"
+	if got := stripQuotedReply(body); got != "Sounds good." {
+		t.Fatalf("expected the Outlook header block cut, got %q", got)
+	}
+	body = "See below.\n\n---------- Forwarded message ---------\nFrom: someone"
+	if got := stripQuotedReply(body); got != "See below." {
+		t.Fatalf("expected the forwarded message cut, got %q", got)
+	}
+	if got := stripQuotedReply("On second thought, let's wait.\nFrom: now on"); got != "On second thought, let's wait.\nFrom: now on" {
+		t.Fatalf("expected ordinary lines kept, got %q", got)
+	}
+}
+
+func TestImportMail(t *testing.T) {
+	withLocation(t, time.UTC)
+	dir := t.TempDir()
+	root := filepath.Join(dir, "Mail")
+	os.MkdirAll(filepath.Join(root, "Archive", "cur"), 0o755)
+	os.MkdirAll(filepath.Join(root, "Archive", "new"), 0o755)
+	os.MkdirAll(filepath.Join(root, "Archive", "tmp"), 0o755)
+	os.WriteFile(filepath.Join(root, "inbox.mbox"), []byte(testMbox), 0o644)
+	// The Maildir, read first, repeats the mbox's first message and adds one of its own
+	os.WriteFile(filepath.Join(root, "Archive", "cur", "1:2,S"), []byte("Message-ID: <1@example.com>\nSubject: Lease renewal\n\nThe landlord agreed.\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "Archive", "new", "2"), []byte("From: Priya <priya@example.com>\r\nSubject: Offsite\r\nDate: Mon, 2 Feb 2026 10:00:00 +0000\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\nVGhlIG9mZnNpdGUgaXMg\r\naW4gTGlzYm9uLg==\r\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("not mail"), 0o644)
+
+	db, err := InitDB(filepath.Join(dir, "mneme.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	withNearDuplicateThreshold(t, 0)
+
+	result, err := ImportMail(context.Background(), db, NewOllamaClient(server.URL, "embed"), root, defaultChunking, nil)
+	if err != nil {
+		t.Fatalf("ImportMail: %v", err)
+	}
+	if result.Mailboxes != 2 || result.Messages != 3 || result.Duplicates != 1 {
+		t.Fatalf("expected 3 emails from 2 mailboxes and the repeat skipped, got %+v", result)
+	}
+	var title, text, validAt string
+	err = db.QueryRow(`SELECT section_title, text, valid_at FROM chunks WHERE source_file = ? AND section_title LIKE 'Offsite%'`, filepath.Join(root, "Archive")).Scan(&title, &text, &validAt)
+	if err != nil {
+		t.Fatalf("read Maildir chunk: %v", err)
+	}
+	if title != "Offsite (February 2, 2026)" || validAt != "2026-02-02" || !strings.Contains(text, "The offsite is in Lisbon.") || !strings.Contains(text, "Email from Priya.") {
+		t.Fatalf("unexpected chunk %q, %q, %q", title, validAt, text)
+	}
+
+	if _, err := ImportMail(context.Background(), db, nil, filepath.Join(root, "notes.txt"), defaultChunking, nil); err == nil {
+		t.Fatal("expected an error for a file that is not a mailbox")
+	}
+}
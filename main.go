@@ -2,11 +2,18 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,7 +25,45 @@ func main() {
 	// Load .env (ignore error if file doesn't exist)
 	_ = godotenv.Load()
 	loadEmbedDimension()
+	loadEmbedModel()
+	if err := loadTimezone(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadDateOrder(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadBusyTimeout(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadTimeouts(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadNormalization(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadNoisePatterns(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadWebhooks(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadNonInteractive(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadEntityNameDetection(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadChunking(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadEmbedConcurrency(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := loadNearDuplicateThreshold(); err != nil {
+		log.Fatalf("%v", err)
+	}
 	loadAliasesFromEnv()
+	loadDBProfilesFromEnv()
 
 	ollamaHost := os.Getenv("OLLAMA_HOST")
 	if ollamaHost == "" {
@@ -28,9 +73,19 @@ func main() {
 	if mnemeDB == "" {
 		mnemeDB = "mneme.db"
 	}
-	embedModel := os.Getenv("EMBED_MODEL")
-	if embedModel == "" {
-		embedModel = "qwen3-embedding:0.6b"
+	mnemeDB = resolveDBPath(mnemeDB)
+	embedModel := EmbedModel
+	generateModel := os.Getenv("GENERATE_MODEL")
+	if generateModel == "" {
+		generateModel = "llama3.2:3b"
+	}
+	queryModel := os.Getenv("QUERY_MODEL")
+	if queryModel == "" {
+		queryModel = generateModel
+	}
+	rerankModel := os.Getenv("RERANK_MODEL")
+	if rerankModel == "" {
+		rerankModel = generateModel
 	}
 	userAlias := os.Getenv("USER_ALIAS")
 	if userAlias == "" {
@@ -41,28 +96,134 @@ func main() {
 		assistantAlias = "Assistant"
 	}
 
-	if len(os.Args) < 2 {
+	// --db overrides MNEME_DB on every subcommand, before or after the command name
+	dbFlag, args := extractDBFlag(os.Args[1:])
+	if dbFlag != "" {
+		mnemeDB = resolveDBPath(dbFlag)
+	}
+	// --json does the same for JSON output
+	jsonOutput, args = extractJSONFlag(args)
+
+	if len(args) < 1 {
 		printUsage()
 		os.Exit(1)
 	}
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "ingest":
-		runIngest(os.Args[2:], mnemeDB, ollamaHost, embedModel)
+		runIngest(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "ingest-git":
+		runIngestGit(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "ingest-audio":
+		runIngestAudio(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "import-notes":
+		runImportNotes(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "import-mail":
+		runImportMail(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "import-claude":
+		runImportClaude(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias)
+	case "bridge":
+		runBridge(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "note":
+		runNote(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "email-digest":
+		runEmailDigest(args[1:], mnemeDB)
 	case "search":
-		runSearch(os.Args[2:], mnemeDB, ollamaHost, embedModel)
+		runSearch(args[1:], mnemeDB, ollamaHost, embedModel, rerankModel)
+	case "ask":
+		runAsk(args[1:], mnemeDB, ollamaHost, embedModel, queryModel)
+	case "browse":
+		runBrowse(args[1:], mnemeDB, ollamaHost, embedModel)
 	case "search-msg":
-		runSearchMessages(os.Args[2:], mnemeDB, ollamaHost, embedModel)
+		runSearchMessages(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "threads":
+		runThreads(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "eval":
+		runEval(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "extract-entities":
+		runExtractEntities(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "extract-relations":
+		runExtractRelations(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "extract-facts":
+		runExtractFacts(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "facts":
+		runFacts(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "conflicts":
+		runConflicts(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "supersede":
+		runSupersede(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "tag-topics":
+		runTagTopics(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "tags":
+		runTags(args[1:], mnemeDB)
+	case "tag":
+		runTag(args[1:], mnemeDB)
+	case "title-batches":
+		runTitleBatches(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "topics":
+		runTopics(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "graph":
+		runGraph(args[1:], mnemeDB)
+	case "related-entities":
+		runRelatedEntities(args[1:], mnemeDB)
+	case "entity":
+		runEntity(args[1:], mnemeDB)
+	case "alias":
+		runAlias(args[1:], mnemeDB)
+	case "people":
+		runPeople(args[1:], mnemeDB)
+	case "importance":
+		runImportance(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, userAlias)
+	case "prune":
+		runPrune(args[1:], mnemeDB)
+	case "decay":
+		runDecay(args[1:], mnemeDB)
+	case "dupes":
+		runDupes(args[1:], mnemeDB)
+	case "pin":
+		runPin(args[1:], mnemeDB)
+	case "pack":
+		runPack(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "on-this-day":
+		runOnThisDay(args[1:], mnemeDB)
+	case "reflect":
+		runReflect(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "consolidate":
+		runConsolidate(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "digest":
+		runDigest(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "review":
+		runReview(args[1:], mnemeDB)
+	case "summarize":
+		runSummarize(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "condense":
+		runCondense(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
+	case "profile":
+		runProfile(args[1:], mnemeDB, ollamaHost, embedModel, generateModel)
 	case "history":
-		runHistory(os.Args[2:], mnemeDB)
+		runHistory(args[1:], mnemeDB, ollamaHost, embedModel)
+	case "strip":
+		runStrip(args[1:])
+	case "typos":
+		runTypos(args[1:], mnemeDB)
+	case "reembed":
+		runReembed(args[1:], mnemeDB, ollamaHost, embedModel)
 	case "status":
-		runStatus(os.Args[2:], mnemeDB, ollamaHost, embedModel)
+		runStatus(args[1:], mnemeDB, ollamaHost, embedModel)
 	case "watch-oc":
-		runWatch(os.Args[2:], mnemeDB, ollamaHost, embedModel, userAlias, assistantAlias)
+		runWatch(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias)
 	case "watch-cc":
-		runWatchCC(os.Args[2:], mnemeDB, ollamaHost, embedModel, userAlias, assistantAlias)
+		runWatchCC(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias)
+	case "watch-jsonl":
+		runWatchJSONL(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias)
+	case "watch-cursor":
+		runWatchCursor(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias)
+	case "backfill-oc":
+		runBackfillOC(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias)
+	case "backfill-cc":
+		runBackfillCC(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias)
 	case "serve":
-		runServe(os.Args[2:], mnemeDB, ollamaHost, embedModel)
+		runServe(args[1:], mnemeDB, ollamaHost, embedModel, generateModel, rerankModel)
 	case "version", "-v", "--version":
 		fmt.Printf("mneme %s\n", Version)
 		os.Exit(0)
@@ -70,86 +231,286 @@ func main() {
 		printUsage()
 		os.Exit(0)
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
 		printUsage()
 		os.Exit(1)
 	}
+	waitWebhooks()
 }
 
 func printUsage() {
 	fmt.Fprintf(os.Stderr, `Mneme - Personal memory system
 
 Usage:
-  mneme <command> [options]
+  mneme [--db path|profile] [--json] <command> [options]
 
 Commands:
-  ingest     Parse and ingest markdown file into vector database
+  ingest     Parse and ingest a markdown file, directory, Obsidian vault or web page into vector database
+  ingest-git Ingest a repository's commit messages (and a GitHub PR export) as dated chunks
+  ingest-audio Transcribe voice memos with whisper.cpp (or a transcription endpoint) and ingest them
+  import-notes Import Evernote/Apple Notes exports (.enex or HTML), dated by creation
+  import-mail  Import email from mbox files or Maildir folders, dated when sent
+  import-claude Import conversations from a Claude.ai data export (.zip or conversations.json)
+  bridge     Capture messages sent to a Telegram bot or Discord channel as dated memories
+  note       Remember a thought right away, dated today (--editor to write it in $EDITOR)
   search     Search for relevant chunks (debug output)
+  browse     Explore memory in a terminal UI: sources, sections and chunks, with live search
+  ask        Answer a question from retrieved chunks with QUERY_MODEL, citing its sources
   search-msg Search messages directly (Phase 2 - semantic + FTS5)
-  history    Find all mentions of an entity in chronological order
+  threads    Group messages into topical threads and return whole discussions
+  eval       Score retrieval against test cases (recall@K, MRR)
+  history    Find all mentions of an entity in chronological order, or list known entities
+  extract-entities  Extract people, projects and places from chunks via the generate model
+  extract-relations Extract entity relations (knowledge graph) from chunks via the generate model
+  extract-facts     Distill chunks into atomic, embedded facts via the generate model
+  facts      Search extracted facts (crisp answers with source chunk)
+  conflicts  Show (or --detect) contradicting and superseded facts
+  supersede  Mark a chunk as replaced by a newer one, or --detect replacements
+  tag-topics Label chunks with topics via the generate model (--every to keep running)
+  title-batches Title watch batches stored before auto-titling (or while it failed)
+  tags       List tags, or show the chunks carrying one
+  tag        Add, remove or list a chunk's tags by hand
+  on-this-day  Memories from this day in earlier years, and from N weeks ago
+  digest     Summarize one day's chunks and messages (--store, --notes to keep it)
+  email-digest Email new memories, summaries and on-this-day items (--schedule to keep sending)
+  consolidate  Roll watch batches up into weekly and monthly summaries
+  review     Compile a week's summaries, decisions, new entities and quotes into markdown
+  summarize  Store a condensed summary of a whole source file, pointing to its sections
+  condense   Rewrite finished watch sessions' batches into fewer topic-organized chunks
+  reflect    Draw higher-level insights from recent memories and store them
+  importance Score chunk importance (heuristic, or --llm via the generate model)
+  prune      Delete chunks scored below an importance threshold
+  decay      Score how faded each chunk is and archive stale ones (policy per namespace)
+  dupes      Report near-duplicate chunks, and merge or delete them
+  pin        Pin chunks that pinned-aware retrieval always returns, or list pins
+  pack       Assemble pinned chunks, diverse matches and profiles into a token budget
+  topics     Cluster chunk embeddings into labeled topics (bird's-eye view)
+  graph      Traverse knowledge-graph relations around an entity
+  related-entities  Entities that most often appear alongside an entity
+  entity     List, type, merge or alias extracted entities
+  people     Most-mentioned people over a window, with trends and last mention
+  alias      Suggest alias groups from "aka" phrases, shared sessions and replies
+  profile    Up-to-date profile of an entity (key facts, recent events, open threads)
+  strip      Show what noise stripping removes from a transcript, pattern by pattern
+  typos      List, add or remove custom typo corrections, or learn them from messages
+  reembed    Re-embed every chunk and message after changing the embedding model
   status     Show system status and health
   serve      Start MCP server
   watch-oc   Watch live OpenCode session and auto-ingest into Mneme
   watch-cc   Watch live Claude Code session and auto-ingest into Mneme
+  watch-jsonl  Watch any agent's JSONL log, mapped by field, and auto-ingest into Mneme
+  watch-cursor  Watch live Cursor chat and auto-ingest into Mneme
+  backfill-oc  Ingest past OpenCode sessions the watcher never saw
+  backfill-cc  Ingest past Claude Code sessions the watcher never saw
   help       Show this help message
 
 Examples:
   mneme ingest --file notes.md --valid-at 2025-01-31
+  mneme ingest --file notes.md --extract-entities
+  mneme ingest --dir ~/notes --exclude "archive,drafts/*"
+  mneme ingest --vault ~/Obsidian/Main
+  mneme ingest --yes --file notes.md        # no confirmation prompt, for cron and scripts
+  mneme ingest --dry-run --dir ~/notes      # print the chunks without storing anything
+  mneme ingest-git --repo ~/src/api --author "$(git config user.email)"
+  mneme ingest-audio --whisper-model ~/models/ggml-base.en.bin memos/*.m4a
   mneme search --as-of 2025-12-31 "key topic"
+  mneme search --since 2025-03-01 --until 2025-03-31 "the pricing change"
+  mneme search --current "which database are we using"
+  mneme search --rerank "why did the staging deploy fail"
+  mneme search --all "the flaky login test"
   mneme search-msg --fts "baka Lily"
   mneme search-msg --context 3 "what about habibti"
+  mneme threads build
+  mneme threads search "the migration plan"
+  mneme eval --cases eval.yaml --k 5 --importance-boost 0.3
+  mneme review --week 2025-W23 --out review.md
+  mneme summarize --source notes/project.md
+  mneme note "Parking spot is B14 #car"
+  mneme condense --source 'watch://ses_abc123/*'
   mneme history --limit 20 "person name"
+  mneme history
+  mneme history --semantic "my manager"
+  mneme graph --depth 2 "project name"
+  mneme facts "which database does project Y use"
+  mneme conflicts --detect
+  mneme entity merge "Robert Smith" "Bob"
+  mneme entity alias "Alex" "Alex Rivera"
+  mneme alias suggest --apply
+  mneme people --days 90
+  mneme importance --llm
+  mneme search --importance-boost 0.3 "what did we decide about auth"
+  mneme prune --below 0.2 --before 2025-01-01
+  mneme decay policy set --namespace watch:// --half-life 30 --archive-below 0.15
+  mneme decay --archive
+  mneme dupes --threshold 0.97
+  mneme dupes merge 12 45 67
+  mneme pin --id 12,45
+  mneme search --pinned "what should I cook tonight"
+  mneme pack --query "plan the auth migration" --budget 4000
+  mneme entity list --type project --since 2025-09-01
+  mneme history --type person
+  mneme profile "person name"
+  mneme tag-topics --every 15m
+  mneme tags "database migration"
+  mneme tag add 42 hiring q3-planning
+  mneme history --tag hiring "Alex"
+  mneme topics --from 2025-01-01 --to 2025-03-31
+  mneme on-this-day --weeks 1,4,12
+  mneme digest --date 2025-06-01 --store --notes ~/notes/daily
+  mneme consolidate --raw downweight --every 24h
+  mneme reflect --topic "auth redesign" --days 30
+  mneme strip --file transcript.txt --pattern-file noise.txt
+  mneme typos add recieve receive
+  mneme typos learn --apply
+  EMBED_MODEL=nomic-embed-text EMBED_DIM=768 mneme reembed
   mneme status
+  mneme --db work search "deploy checklist"
+  mneme search --json "deploy checklist" | jq '.[].SourceFile'
+
+Global options:
+  --db       Database path or profile name from MNEME_DB_PROFILES (overrides MNEME_DB)
+  --json     Print results as JSON (search, history, status, and commands with their own --json)
 `)
 }
 
-func runIngest(args []string, mnemeDB, ollamaHost, embedModel string) {
+func runIngest(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
 	fs := flag.NewFlagSet("ingest", flag.ExitOnError)
-	file := fs.String("file", "", "path to markdown file (required)")
-	validAt := fs.String("valid-at", "", "optional date for valid_at field (YYYY-MM-DD)")
+	file := fs.String("file", "", "path to markdown file (or an HTML page)")
+	pageURL := fs.String("url", "", "web page to fetch and ingest, instead of --file")
+	dir := fs.String("dir", "", "directory to ingest recursively, instead of --file")
+	vault := fs.String("vault", "", "Obsidian vault to ingest, resolving [[wikilinks]], instead of --file")
+	include := fs.String("include", "", "with --dir, comma-separated globs of files to ingest (default *.md,*.markdown)")
+	exclude := fs.String("exclude", "", "with --dir, comma-separated globs of files and directories to skip")
+	validAt := fs.String("valid-at", "", "optional date for valid_at field (YYYY-MM-DD or RFC3339)")
+	dateFromFlag := fs.String("date-from", dateFromValidAt, "comma-separated sources of a file's date when no header or frontmatter gives one, first first: valid-at, filename, mtime")
+	extract := fs.Bool("extract-entities", false, "run LLM entity extraction on the new chunks after ingest")
+	supersede := fs.Bool("detect-supersession", false, "check whether the new chunks replace older memories")
+	concurrency := fs.Int("concurrency", embedConcurrency, "chunks to embed at once (default $MNEME_EMBED_CONCURRENCY)")
+	dryRun := fs.Bool("dry-run", false, "print the chunks that would be stored and the embedding calls they take, without touching the database or Ollama")
+	chunks := newChunkFlags(fs)
+	var yes bool
+	fs.BoolVar(&yes, "yes", nonInteractive, "ingest without asking for confirmation (default $MNEME_NONINTERACTIVE)")
+	fs.BoolVar(&yes, "y", nonInteractive, "shorthand for --yes")
 
 	if err := fs.Parse(args); err != nil {
 		log.Fatalf("parse flags: %v", err)
 	}
-
-	if *file == "" {
-		fmt.Fprintf(os.Stderr, "Error: --file is required\n")
-		os.Exit(1)
+	chunking, err := chunks.options()
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
-
-	// Read and parse markdown
-	data, err := os.ReadFile(*file)
+	if *concurrency < 1 {
+		log.Fatalf("--concurrency must be at least 1, got %d", *concurrency)
+	}
+	dateFrom, err := parseDateFrom(*dateFromFlag)
 	if err != nil {
-		log.Fatalf("read file: %v", err)
+		log.Fatalf("%v", err)
 	}
+	if *validAt != "" && !containsFold(dateFrom, dateFromValidAt) {
+		log.Fatal("--valid-at is given but --date-from leaves it out")
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
 
-	sections := ParseMarkdown(string(data))
+	given := 0
+	for _, source := range []string{*file, *dir, *pageURL, *vault} {
+		if source != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		fmt.Fprintf(os.Stderr, "Error: one of --file, --dir, --url or --vault is required\n")
+		os.Exit(1)
+	}
 
-	// Show sections found
-	fmt.Printf("Sections found in %s:\n", *file)
-	for _, section := range sections {
-		wordCount := len(strings.Fields(section.Content))
-		headerStr := strings.Repeat("#", section.HeaderLevel)
-		marker := ""
-		if wordCount > 600 {
-			marker = " [will be sub-chunked]"
+	var dirOpts DirOptions
+	var dirFiles []string
+	var pageText string
+	listed := *dir
+	if *dir != "" || *vault != "" {
+		var err error
+		if *vault != "" {
+			listed = *vault
+			dirFiles, err = VaultFiles(*vault)
+		} else {
+			dirOpts = DirOptions{Include: splitList(*include), Exclude: splitList(*exclude), DateFrom: dateFrom}
+			dirFiles, err = DirFiles(*dir, dirOpts)
+		}
+		if err != nil {
+			log.Fatalf("read dir: %v", err)
+		}
+		if len(dirFiles) == 0 {
+			fmt.Printf("No matching files in %s.\n", listed)
+			return
+		}
+		fmt.Printf("Files found in %s:\n", listed)
+		for i, path := range dirFiles {
+			fmt.Printf("  %d. %s\n", i+1, path)
+		}
+	} else {
+		// Show sections found, streaming so a large file isn't read into memory
+		source := *file
+		var r io.ReadCloser
+		var err error
+		if *pageURL != "" {
+			// Kept for the ingest below, so the page is fetched once
+			if pageText, err = FetchPage(ctx, *pageURL); err != nil {
+				log.Fatalf("%v", err)
+			}
+			source, r = *pageURL, io.NopCloser(strings.NewReader(pageText))
+		} else if r, err = OpenIngestFile(*file); err != nil {
+			log.Fatalf("read file: %v", err)
+		}
+		fmt.Printf("Sections found in %s:\n", source)
+		err = ParseMarkdownStreamDepth(r, chunking.Depth, func(section Section) error {
+			wordCount := len(strings.Fields(section.Content))
+			headerStr := strings.Repeat("#", section.HeaderLevel)
+			marker := ""
+			if size, limit := chunking.measure(); size(section.Content) > limit {
+				marker = " [will be sub-chunked]"
+			}
+			fmt.Printf("  %d. [%s] \"%s\" (%d words)%s\n",
+				section.Sequence, headerStr, section.Title, wordCount, marker)
+			return nil
+		})
+		r.Close()
+		if err != nil {
+			log.Fatalf("read file: %v", err)
 		}
-		fmt.Printf("  %d. [%s] \"%s\" (%d words)%s\n",
-			section.Sequence, headerStr, section.Title, wordCount, marker)
 	}
 
-	// Ask for confirmation
-	fmt.Print("\nProceed? [y/n]: ")
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		log.Fatalf("read input: %v", err)
+	if *dryRun {
+		var plans []IngestPlan
+		switch {
+		case *dir != "":
+			plans = PlanFiles(dirFiles, *validAt, dateFrom, chunking, OpenIngestFile)
+		case *vault != "":
+			plans = PlanFiles(dirFiles, *validAt, dateFrom, chunking, openVaultNote)
+		case *pageURL != "":
+			plans = []IngestPlan{PlanMarkdown(*pageURL, strings.NewReader(pageText), *validAt, chunking)}
+		default:
+			plans = PlanFiles([]string{*file}, *validAt, dateFrom, chunking, OpenIngestFile)
+		}
+		printIngestPlans(os.Stdout, plans)
+		return
 	}
 
-	response = strings.TrimSpace(strings.ToLower(response))
-	if response != "y" && response != "yes" {
-		fmt.Println("Cancelled.")
-		os.Exit(0)
+	// Ask for confirmation, unless running unattended
+	if yes {
+		fmt.Println()
+	} else {
+		fmt.Print("\nProceed? [y/n]: ")
+		reader := bufio.NewReader(os.Stdin)
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			log.Fatalf("read input: %v", err)
+		}
+
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response != "y" && response != "yes" {
+			fmt.Println("Cancelled.")
+			os.Exit(0)
+		}
 	}
 
 	// Initialize DB and Ollama
@@ -159,38 +520,159 @@ func runIngest(args []string, mnemeDB, ollamaHost, embedModel string) {
 	}
 	defer db.Close()
 
-	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel).WithConcurrency(*concurrency)
 
 	// Ingest
-	result, err := IngestFile(db, ollama, *file, *validAt)
-	if err != nil {
-		log.Fatalf("ingest file: %v", err)
+	var result IngestResult
+	var failed, total int
+	if *dir != "" || *vault != "" {
+		progress := NewProgress("Ingesting")
+		var files []DirFileResult
+		var linked VaultResult
+		var err error
+		if *vault != "" {
+			linked, err = IngestVault(ctx, db, ollama, *vault, *validAt, dateFrom, chunking, progress.Func())
+			files = linked.Files
+		} else {
+			files, err = IngestDir(ctx, db, ollama, *dir, *validAt, dirOpts, chunking, progress.Func())
+		}
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("ingest dir: %v", err)
+		}
+		fmt.Printf("\nIngested %s:\n", listed)
+		total = len(files)
+		for _, f := range files {
+			if f.Err != nil {
+				failed++
+				fmt.Printf("  %s: FAILED: %v\n", f.Path, f.Err)
+				continue
+			}
+			fmt.Printf("  %s: %d sections, %d chunks", f.Path, f.Result.SectionsFound, f.Result.ChunksCreated)
+			if f.Result.ChunksUnchanged > 0 {
+				fmt.Printf(", %d unchanged", f.Result.ChunksUnchanged)
+			}
+			fmt.Println()
+			result.SectionsFound += f.Result.SectionsFound
+			result.ChunksCreated += f.Result.ChunksCreated
+			result.SubChunksCreated += f.Result.SubChunksCreated
+			result.ChunksUnchanged += f.Result.ChunksUnchanged
+			result.Resumed += f.Result.Resumed
+			result.DuplicatesSkipped += f.Result.DuplicatesSkipped
+			result.Duplicates = append(result.Duplicates, f.Result.Duplicates...)
+			result.ChunkIDs = append(result.ChunkIDs, f.Result.ChunkIDs...)
+		}
+		fmt.Printf("\nIngest complete: %d of %d files\n", total-failed, total)
+		if *vault != "" {
+			fmt.Printf("  Linked notes: %d (%d new entities)\n", linked.Linked, linked.NewEntities)
+		}
+	} else if *pageURL != "" {
+		progress := NewProgress("Embedding")
+		var err error
+		result, err = IngestMarkdown(ctx, db, ollama, *pageURL, strings.NewReader(pageText), *validAt, chunking, progress.Func())
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("ingest page: %v", err)
+		}
+		fmt.Printf("\nIngest complete:\n")
+	} else {
+		fileDate, err := fileValidAt(*file, *validAt, dateFrom)
+		if err != nil {
+			log.Fatalf("read file: %v", err)
+		}
+		progress := NewProgress("Embedding")
+		result, err = IngestFileWithProgress(ctx, db, ollama, *file, fileDate, chunking, progress.Func())
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("ingest file: %v", err)
+		}
+		fmt.Printf("\nIngest complete:\n")
 	}
 
 	// Print result summary
-	fmt.Printf("\nIngest complete:\n")
 	fmt.Printf("  Sections: %d\n", result.SectionsFound)
 	fmt.Printf("  Chunks: %d\n", result.ChunksCreated)
 	fmt.Printf("  Sub-chunks: %d\n", result.SubChunksCreated)
+	if result.ChunksUnchanged > 0 {
+		fmt.Printf("  Unchanged: %d (kept without embedding again)\n", result.ChunksUnchanged)
+	}
+	if result.Resumed > 0 {
+		fmt.Printf("  Resumed: %d embeddings from the interrupted run\n", result.Resumed)
+	}
+	if result.DuplicatesSkipped > 0 {
+		fmt.Printf("  Near-duplicates skipped: %d\n", result.DuplicatesSkipped)
+		for _, d := range result.Duplicates {
+			fmt.Printf("    %q, a near-duplicate of chunk %d (%q in %s)\n", d.Section, d.KeptID, d.KeptSection, d.KeptSource)
+		}
+	}
+
+	if *extract && len(result.ChunkIDs) > 0 {
+		progress := NewProgress("Extracting")
+		extracted, err := ExtractEntities(ctx, db, ollama, generateModel, result.ChunkIDs, progress.Func())
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("extract entities: %v", err)
+		}
+		fmt.Printf("  Entities: %d (%d links)\n", extracted.EntitiesFound, extracted.LinksCreated)
+	}
+
+	if *supersede && len(result.ChunkIDs) > 0 {
+		progress := NewProgress("Comparing")
+		detected, err := DetectSupersessions(ctx, db, ollama, generateModel, result.ChunkIDs, progress.Func())
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("detect supersession: %v", err)
+		}
+		fmt.Printf("  Superseded: %d older chunks\n", detected.Superseded)
+	}
+	if failed > 0 {
+		log.Fatalf("ingest dir: %d of %d files failed", failed, total)
+	}
 }
 
-func runSearch(args []string, mnemeDB, ollamaHost, embedModel string) {
-	fs := flag.NewFlagSet("search", flag.ExitOnError)
-	asOf := fs.String("as-of", "", "optional date filter (YYYY-MM-DD)")
-	limit := fs.Int("limit", 10, "max chunks to retrieve")
+// nonInteractive makes ingest proceed without asking (MNEME_NONINTERACTIVE), for cron
+// jobs and scripts with no one to answer.
+var nonInteractive bool
 
-	if err := fs.Parse(args); err != nil {
-		log.Fatalf("parse flags: %v", err)
+func loadNonInteractive() error {
+	if value := os.Getenv("MNEME_NONINTERACTIVE"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MNEME_NONINTERACTIVE: %w", err)
+		}
+		nonInteractive = enabled
 	}
+	return nil
+}
 
-	if fs.NArg() < 1 {
-		fmt.Fprintf(os.Stderr, "Error: question required as first positional argument\n")
-		os.Exit(1)
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
-	question := fs.Arg(0)
+func runIngestGit(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("ingest-git", flag.ExitOnError)
+	repo := fs.String("repo", ".", "path to the git repository")
+	name := fs.String("name", "", "name to attribute the commits to (default: the repository directory's name)")
+	since := fs.String("since", "", "only commits after this date, as git log --since takes it")
+	author := fs.String("author", "", "only commits whose author matches, as git log --author takes it")
+	limit := fs.Int("limit", 0, "at most this many of the newest commits (0 for all)")
+	merges := fs.Bool("merges", false, "include merge commits")
+	diff := fs.Bool("diff", false, "add a summary of the files each commit changed")
+	prs := fs.String("prs", "", "GitHub pull request export: gh pr list --state all --json number,title,body,author,createdAt,mergedAt,url")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
 
-	// Initialize DB and Ollama
 	db, err := InitDB(mnemeDB)
 	if err != nil {
 		log.Fatalf("init db: %v", err)
@@ -198,50 +680,59 @@ func runSearch(args []string, mnemeDB, ollamaHost, embedModel string) {
 	defer db.Close()
 
 	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
-
-	// Search
-	results, err := Search(db, ollama, question, *limit, *asOf)
+	progress := NewProgress("Ingesting")
+	result, err := IngestGit(ctx, db, ollama, *repo, GitOptions{
+		Name:   *name,
+		Since:  *since,
+		Author: *author,
+		Limit:  *limit,
+		Merges: *merges,
+		Diff:   *diff,
+		PRs:    *prs,
+	}, progress.Func())
+	progress.Finish()
 	if err != nil {
-		log.Fatalf("search: %v", err)
+		log.Fatalf("ingest-git: %v", err)
 	}
 
-	// Print raw chunks (debug output)
-	for _, result := range results {
-		validAtLabel := result.ValidAt
-		if validAtLabel == "" {
-			validAtLabel = "timeless"
-		}
-
-		fmt.Printf("[%.4f] [%s] %s — %s\n",
-			result.Distance, validAtLabel, result.SourceFile, result.SectionTitle)
-
-		// First 200 chars
-		text := result.Text
-		if len(text) > 200 {
-			text = text[:200] + "..."
-		}
-		fmt.Printf("%s\n\n", text)
+	fmt.Printf("Ingested %d commits and %d pull requests from %s as %s%s/...\n", result.Commits, result.PullRequests, result.Repo, gitSourcePrefix, result.Repo)
+	if result.Skipped > 0 {
+		fmt.Printf("Skipped %d already ingested\n", result.Skipped)
 	}
 }
 
-func runSearchMessages(args []string, mnemeDB, ollamaHost, embedModel string) {
-	fs := flag.NewFlagSet("search-msg", flag.ExitOnError)
-	fts := fs.Bool("fts", false, "use FTS5 exact phrase matching instead of semantic search")
-	contextMinutes := fs.Int("context", 3, "context window in minutes around matched messages")
-	limit := fs.Int("limit", 5, "max results")
+func runIngestAudio(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("ingest-audio", flag.ExitOnError)
+	url := fs.String("url", os.Getenv("MNEME_WHISPER_URL"), "OpenAI-compatible transcription endpoint to post recordings to, instead of running whisper.cpp (default $MNEME_WHISPER_URL)")
+	whisperCmd := os.Getenv("MNEME_WHISPER_CMD")
+	if whisperCmd == "" {
+		whisperCmd = "whisper-cli"
+	}
+	command := fs.String("whisper", whisperCmd, "whisper.cpp command (default $MNEME_WHISPER_CMD, or whisper-cli)")
+	model := fs.String("whisper-model", os.Getenv("MNEME_WHISPER_MODEL"), "whisper.cpp model file, or the model name sent to --url (default $MNEME_WHISPER_MODEL)")
+	section := fs.Duration("section", defaultTranscriptSection, "how much of a recording each section covers")
+	validAt := fs.String("valid-at", "", "date of the recordings (YYYY-MM-DD or RFC3339)")
+	dateFromFlag := fs.String("date-from", "valid-at,filename,mtime", "comma-separated sources of a recording's date, first first: valid-at, filename, mtime")
+	chunks := newChunkFlags(fs)
 
 	if err := fs.Parse(args); err != nil {
 		log.Fatalf("parse flags: %v", err)
 	}
-
-	if fs.NArg() < 1 {
-		fmt.Fprintf(os.Stderr, "Error: query required as first positional argument\n")
+	chunking, err := chunks.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	dateFrom, err := parseDateFrom(*dateFromFlag)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: mneme ingest-audio [options] <recording>...\n")
 		os.Exit(1)
 	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
 
-	query := fs.Arg(0)
-
-	// Initialize DB and Ollama
 	db, err := InitDB(mnemeDB)
 	if err != nil {
 		log.Fatalf("init db: %v", err)
@@ -249,113 +740,110 @@ func runSearchMessages(args []string, mnemeDB, ollamaHost, embedModel string) {
 	defer db.Close()
 
 	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
-
-	if *fts {
-		// FTS5 exact phrase search
-		results, err := searchMessagesFTS(db, query, *limit)
+	t := newTranscriber(*url, *command, *model)
+	for _, path := range fs.Args() {
+		date, err := fileValidAt(path, *validAt, dateFrom)
 		if err != nil {
-			log.Fatalf("fts search: %v", err)
-		}
-
-		if len(results) == 0 {
-			fmt.Println("No exact matches found.")
-			return
-		}
-
-		fmt.Printf("FTS5 matches for %q:\n\n", query)
-		for _, r := range results {
-			ts := fmt.Sprintf("%d", r.Timestamp/1000) // unix seconds
-			fmt.Printf("[%s] %s:\n%s\n\n", ts, r.Role, truncate(r.Text, 300))
+			log.Fatalf("%s: %v", path, err)
 		}
-	} else {
-		// Semantic search with context window
-		contexts, err := searchMessagesWithContext(db, ollama, query, *limit, *contextMinutes)
+		fmt.Printf("Transcribing %s...\n", path)
+		progress := NewProgress("Ingesting")
+		result, err := IngestAudio(ctx, db, ollama, t, path, date, *section, chunking, progress.Func())
+		progress.Finish()
 		if err != nil {
-			log.Fatalf("search messages: %v", err)
-		}
-
-		if len(contexts) == 0 {
-			fmt.Println("No messages found.")
-			return
-		}
-
-		fmt.Printf("Found %d conversation contexts:\n\n", len(contexts))
-		for i, ctx := range contexts {
-			fmt.Printf("─── Context %d ───\n", i+1)
-			for _, m := range ctx {
-				fmt.Printf("[%s] %s:\n%s\n\n", formatTimestamp(m.Timestamp), m.Role, truncate(m.Text, 400))
-			}
-			fmt.Println()
+			log.Fatalf("ingest-audio: %v", err)
 		}
+		fmt.Printf("  Sections: %d, chunks: %d\n", result.SectionsFound, len(result.ChunkIDs)+result.ChunksUnchanged)
 	}
 }
 
-func truncate(s string, max int) string {
-	if len(s) <= max {
-		return s
+func runImportNotes(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("import-notes", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
 	}
-	return s[:max] + "..."
-}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: mneme import-notes <export.enex | note.html | directory>\n")
+		os.Exit(1)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
 
-func formatTimestamp(ms int64) string {
-	return fmt.Sprintf("%d", ms/1000)
-}
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
 
-func runHistory(args []string, mnemeDB string) {
-	fs := flag.NewFlagSet("history", flag.ExitOnError)
-	limit := fs.Int("limit", 20, "max chunks to retrieve")
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	progress := NewProgress("Importing")
+	result, err := ImportNotes(ctx, db, ollama, fs.Arg(0), progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("import-notes: %v", err)
+	}
+	fmt.Printf("Imported %d notes from %d files\n", result.Notes, result.Files)
+}
 
+func runImportMail(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("import-mail", flag.ExitOnError)
+	chunks := newChunkFlags(fs)
 	if err := fs.Parse(args); err != nil {
 		log.Fatalf("parse flags: %v", err)
 	}
-
-	if fs.NArg() < 1 {
-		fmt.Fprintf(os.Stderr, "Error: entity name required as first positional argument\n")
+	chunking, err := chunks.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: mneme import-mail <mbox file | Maildir | directory>\n")
 		os.Exit(1)
 	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
 
-	entity := fs.Arg(0)
-
-	// Initialize DB
 	db, err := InitDB(mnemeDB)
 	if err != nil {
 		log.Fatalf("init db: %v", err)
 	}
 	defer db.Close()
 
-	// History
-	results, err := History(db, entity, *limit)
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	progress := NewProgress("Importing")
+	result, err := ImportMail(ctx, db, ollama, fs.Arg(0), chunking, progress.Func())
+	progress.Finish()
 	if err != nil {
-		log.Fatalf("history: %v", err)
+		log.Fatalf("import-mail: %v", err)
 	}
-
-	// Print chronological chunks
-	for _, result := range results {
-		validAtLabel := result.ValidAt
-		if validAtLabel == "" {
-			validAtLabel = "timeless"
-		}
-
-		fmt.Printf("[%s] %s — %s\n",
-			validAtLabel, result.SourceFile, result.SectionTitle)
-
-		// First 300 chars
-		text := result.Text
-		if len(text) > 300 {
-			text = text[:300] + "..."
-		}
-		fmt.Printf("%s\n", text)
-		fmt.Println("---")
+	fmt.Printf("Imported %d emails from %d mailboxes\n", result.Messages, result.Mailboxes)
+	if result.Duplicates > 0 {
+		fmt.Printf("Skipped %d held by more than one folder\n", result.Duplicates)
 	}
 }
 
-func runStatus(args []string, mnemeDB, ollamaHost, embedModel string) {
-	fs := flag.NewFlagSet("status", flag.ExitOnError)
+func runImportClaude(args []string, mnemeDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias string) {
+	fs := flag.NewFlagSet("import-claude", flag.ExitOnError)
+	batchSize := fs.Int("batch", 6, "messages per ingested batch, as with the watchers")
+	noTitles := fs.Bool("no-titles", false, "keep date headings instead of titling each batch with the generate model")
+	chunks := newChunkFlags(fs)
 	if err := fs.Parse(args); err != nil {
 		log.Fatalf("parse flags: %v", err)
 	}
+	chunking, err := chunks.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: mneme import-claude [--batch n] [--no-titles] <export.zip | conversations.json>\n")
+		os.Exit(1)
+	}
+	conversations, err := readClaudeExport(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("import-claude: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
 
-	// Initialize DB and Ollama
 	db, err := InitDB(mnemeDB)
 	if err != nil {
 		log.Fatalf("init db: %v", err)
@@ -363,38 +851,2729 @@ func runStatus(args []string, mnemeDB, ollamaHost, embedModel string) {
 	defer db.Close()
 
 	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	if err := ValidateEmbedDimension(ctx, ollama); err != nil {
+		log.Fatalf("%v", err)
+	}
+	titleModel := generateModel
+	if *noTitles {
+		titleModel = ""
+	}
+	progress := NewProgress("Importing")
+	result, err := ImportClaude(ctx, db, ollama, titleModel, conversations, userAlias, assistantAlias, *batchSize, chunking, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("import-claude: %v (run it again to resume)", err)
+	}
+	fmt.Printf("Imported %d messages from %d conversations in %d batches (%d already stored)\n", result.Messages, result.Conversations, result.Batches, result.Skipped)
+}
 
-	// Get status
-	status := Status(db, ollama, embedModel)
+func runNote(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("note", flag.ExitOnError)
+	useEditor := fs.Bool("editor", false, "write the note in $VISUAL or $EDITOR instead")
 
-	// Format output
-	fmt.Println("Mneme Status")
-	fmt.Println("─────────────")
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
 
-	ollamaStatus := "unhealthy"
-	if status.OllamaHealthy {
-		ollamaStatus = "healthy"
+	text := strings.Join(fs.Args(), " ")
+	if *useEditor {
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+		edited, err := editNote(editor)
+		if err != nil {
+			log.Fatalf("editor: %v", err)
+		}
+		text = edited
+	}
+	if strings.TrimSpace(text) == "" {
+		fmt.Fprintf(os.Stderr, "Error: nothing to remember; give the note as arguments or use --editor\n")
+		os.Exit(1)
 	}
-	fmt.Printf("Ollama:      %s (%s)\n", ollamaStatus, ollamaHost)
-	fmt.Printf("Embed Model: %s\n", status.EmbedModel)
-	fmt.Printf("sqlite-vec:  %s\n", status.SqliteVecVersion)
-	fmt.Printf("Chunks:      %d\n", status.TotalChunks)
 
-	dateRange := "none"
-	if status.EarliestValidAt != "" && status.LatestValidAt != "" {
-		dateRange = fmt.Sprintf("%s → %s", status.EarliestValidAt, status.LatestValidAt)
-	} else if status.EarliestValidAt != "" {
-		dateRange = status.EarliestValidAt
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
 	}
-	fmt.Printf("Date Range:  %s\n", dateRange)
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	source, result, err := StoreNote(ctx, db, ollama, text, time.Now())
+	if err != nil {
+		log.Fatalf("note: %v", err)
+	}
+	fmt.Println(renderPreflightStep("ok", fmt.Sprintf("Remembered %s (%d chunks)", source, len(result.ChunkIDs))))
 }
 
-func runServe(args []string, mnemeDB, ollamaHost, embedModel string) {
+func runBridge(args []string, mnemeDB, ollamaHost, embedModel string) {
+	if len(args) == 0 || (args[0] != "telegram" && args[0] != "discord") {
+		fmt.Fprintf(os.Stderr, "Usage: mneme bridge telegram|discord --token <bot token> [options]\n")
+		os.Exit(1)
+	}
+	platform := args[0]
+	fs := flag.NewFlagSet("bridge "+platform, flag.ExitOnError)
+	token := fs.String("token", os.Getenv("MNEME_BRIDGE_TOKEN"), "bot token (default $MNEME_BRIDGE_TOKEN)")
+	allow := fs.String("allow", "", "comma-separated chat IDs (telegram) or user IDs (discord) to capture from")
+	channel := fs.String("channel", "", "discord channel ID to read")
+	interval := fs.Duration("interval", 5*time.Second, "how often to check the discord channel")
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	if *token == "" {
+		log.Fatal("bridge: --token (or MNEME_BRIDGE_TOKEN) is required")
+	}
+
+	var bridge chatBridge
+	switch platform {
+	case "telegram":
+		if *allow == "" {
+			fmt.Println("No --allow chats yet: send the bot a message and it will log your chat ID")
+		}
+		bridge = newTelegramBridge(*token, parseAllowList(*allow))
+	case "discord":
+		if *channel == "" {
+			log.Fatal("bridge: --channel is required for discord")
+		}
+		bridge = newDiscordBridge(*token, *channel, parseAllowList(*allow), *interval)
+	}
+	// Runs until interrupted, so the ingest timeout does not apply
+	ctx, cancel := commandContext(0)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	fmt.Printf("Capturing %s messages as %s%s/... (Ctrl+C to stop)\n", platform, bridgeSourcePrefix, platform)
+	if err := RunBridge(ctx, db, ollama, bridge); err != nil {
+		log.Fatalf("bridge: %v", err)
+	}
+}
+
+func runExtractEntities(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("extract-entities", flag.ExitOnError)
+	source := fs.String("source", "", "only process chunks from this source file")
+	limit := fs.Int("limit", 0, "max chunks to process (0 = all pending)")
+	reindex := fs.Bool("reindex", false, "rebuild the entity mention index instead of extracting")
+	names := fs.Bool("names", false, "link capitalized names by heuristics alone, without the generate model (as ingest does)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	if *reindex {
+		if err := ReindexEntityMentions(db); err != nil {
+			log.Fatalf("reindex mentions: %v", err)
+		}
+		fmt.Println("Entity mention index rebuilt.")
+		return
+	}
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	kind := extractionKindEntities
+	if *names {
+		kind = extractionKindNames
+	}
+	chunkIDs, err := pendingExtractionChunks(db, kind, *source)
+	if err != nil {
+		log.Fatalf("find pending chunks: %v", err)
+	}
+	if *limit > 0 && len(chunkIDs) > *limit {
+		chunkIDs = chunkIDs[:*limit]
+	}
+	if len(chunkIDs) == 0 {
+		fmt.Println("No chunks pending entity extraction.")
+		return
+	}
+
+	if *names {
+		fmt.Printf("Detecting names in %d chunks...\n", len(chunkIDs))
+		result, err := DetectEntityNames(db, chunkIDs)
+		if err != nil {
+			log.Fatalf("detect names: %v", err)
+		}
+		fmt.Printf("  Chunks:   %d\n", result.ChunksProcessed)
+		fmt.Printf("  Entities: %d\n", result.EntitiesFound)
+		fmt.Printf("  Links:    %d\n", result.LinksCreated)
+		return
+	}
+
+	fmt.Printf("Extracting entities from %d chunks with %s...\n", len(chunkIDs), generateModel)
+	progress := NewProgress("Extracting")
+	result, err := ExtractEntities(ctx, db, ollama, generateModel, chunkIDs, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("extract entities: %v", err)
+	}
+
+	fmt.Printf("\nExtraction complete:\n")
+	fmt.Printf("  Chunks:   %d\n", result.ChunksProcessed)
+	fmt.Printf("  Entities: %d\n", result.EntitiesFound)
+	fmt.Printf("  Links:    %d\n", result.LinksCreated)
+}
+
+func runAsk(args []string, mnemeDB, ollamaHost, embedModel, queryModel string) {
+	fs := flag.NewFlagSet("ask", flag.ExitOnError)
+	limit := fs.Int("limit", 8, "chunks to retrieve for the answer")
+	asOf := fs.String("as-of", "", "answer from chunks valid on this date (YYYY-MM-DD)")
+	current := fs.Bool("current", false, "leave out chunks superseded by newer ones")
+	hybrid := fs.Bool("hybrid", false, "also retrieve by keyword (BM25) match")
+	jsonOut := fs.Bool("json", jsonOutput, "print the answer and its sources as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: mneme ask [options] \"question\"\n")
+		os.Exit(1)
+	}
+	question := strings.Join(fs.Args(), " ")
+	// Bounded like the other generate-model commands, not like a search
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	answer, err := Ask(ctx, db, ollama, queryModel, question, SearchOptions{
+		Limit: *limit, AsOf: *asOf, Current: *current, Hybrid: *hybrid, Reinforce: true,
+	})
+	if err != nil {
+		log.Fatalf("ask: %v", err)
+	}
+
+	if *jsonOut {
+		out, err := json.MarshalIndent(answer, "", "  ")
+		if err != nil {
+			log.Fatalf("marshal answer: %v", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+	if len(answer.Sources) == 0 {
+		fmt.Println("Nothing in memory matches that question.")
+		return
+	}
+	fmt.Printf("%s\n\nSources:\n", answer.Text)
+	for i, r := range answer.Sources {
+		fmt.Printf("  [%d] %s — %s (%s)\n", i+1, r.SourceFile, r.SectionTitle, dateLabel(r.ValidAt))
+	}
+}
+
+func runSearch(args []string, mnemeDB, ollamaHost, embedModel, rerankModel string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	asOf := fs.String("as-of", "", "optional date filter (YYYY-MM-DD or RFC3339)")
+	since := fs.String("since", "", "only chunks dated on or after this date (YYYY-MM-DD or RFC3339)")
+	until := fs.String("until", "", "only chunks dated on or before this date (YYYY-MM-DD or RFC3339)")
+	limit := fs.Int("limit", 10, "max chunks to retrieve")
+	current := fs.Bool("current", false, "hide chunks superseded by newer ones")
+	entityType := fs.String("type", "", "only chunks mentioning an entity of this type (person, project, place, tool)")
+	tag := fs.String("tag", "", "only chunks carrying this tag or topic")
+	source := fs.String("source", "", "only chunks from these sources: comma-separated globs (watch://*, notes/*.md) or prefixes (notes/)")
+	importanceBoost := fs.Float64("importance-boost", 0, "shrink distances by this factor × chunk importance (0-1, 0 = off)")
+	decayWeight := fs.Float64("decay-weight", 0, "stretch distances of faded chunks by this factor × (1 - decay) (0-1, 0 = off)")
+	includeArchived := fs.Bool("include-archived", false, "also search chunks archived by the decay pass")
+	pinned := fs.Bool("pinned", false, "always include pinned chunks, ahead of the matches")
+	hybrid := fs.Bool("hybrid", false, "also rank chunks by keyword (BM25) match and fuse both rankings")
+	rerankFlag := fs.Bool("rerank", false, "have RERANK_MODEL score the best 30 matches against the question and keep the top --limit")
+	expand := fs.Bool("expand", false, "print the whole section around each match, stitched from its sibling chunks")
+	all := fs.Bool("all", false, "also search raw conversation messages, interleaving them with the chunks by score")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(searchTimeout)
+	defer cancel()
+
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: question required as first positional argument\n")
+		os.Exit(1)
+	}
+
+	question := fs.Arg(0)
+
+	// Initialize DB and Ollama
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	// Search
+	opts := SearchOptions{
+		Limit: *limit, AsOf: *asOf, Since: *since, Until: *until, Current: *current, EntityType: *entityType, Tag: *tag, Sources: splitList(*source),
+		ImportanceBoost: *importanceBoost, DecayWeight: *decayWeight, IncludeArchived: *includeArchived, Reinforce: true,
+		IncludePinned: *pinned, Hybrid: *hybrid, Expand: *expand,
+	}
+	if *rerankFlag {
+		opts.RerankModel = rerankModel
+	}
+	if *all {
+		hits, err := SearchChunksAndMessages(ctx, db, ollama, question, opts, 0)
+		if err != nil {
+			log.Fatalf("search: %v", err)
+		}
+		if jsonOutput {
+			printJSON(hits)
+			return
+		}
+		for _, hit := range hits {
+			if hit.Type == hitMessage {
+				m := hit.Message
+				fmt.Printf("[%.4f] [message, %s] %s — %s\n%s\n\n",
+					hit.Score, formatThreadTime(m.Timestamp), m.SessionID, m.Role, truncate(m.Text, 200))
+				continue
+			}
+			printSearchResult(*hit.Chunk, hit.Score)
+		}
+		return
+	}
+	results, degraded, err := SearchWithFallback(ctx, db, ollama, question, opts)
+	if err != nil {
+		log.Fatalf("search: %v", err)
+	}
+	if degraded {
+		// On stderr, so --json output stays parseable
+		fmt.Fprintf(os.Stderr, "Degraded mode: Ollama is unreachable at %s, showing keyword matches only\n\n", ollamaHost)
+	}
+	if jsonOutput {
+		printJSON(results)
+		return
+	}
+
+	// Print raw chunks (debug output)
+	for _, result := range results {
+		printSearchResult(result, result.Distance)
+	}
+}
+
+func runBrowse(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("browse", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	if err := RunBrowser(db, NewOllamaClient("http://"+ollamaHost, embedModel)); err != nil {
+		log.Fatalf("browse: %v", err)
+	}
+}
+
+// printSearchResult prints a chunk found by search after its score (the distance,
+// or a Hit's score), its dates and where it came from.
+func printSearchResult(result SearchResult, score float64) {
+	validAtLabel := result.ValidAt
+	if validAtLabel == "" {
+		validAtLabel = "timeless"
+	}
+	if result.ValidUntil != "" {
+		validAtLabel += " → " + result.ValidUntil
+	}
+
+	if result.Pinned {
+		validAtLabel = "pinned, " + validAtLabel
+	}
+
+	fmt.Printf("[%.4f] [%s] %s — %s\n",
+		score, validAtLabel, result.SourceFile, result.SectionTitle)
+	if source := summarizedSource(result.SourceFile); source != "" {
+		fmt.Printf("(summary — details in %s)\n", source)
+	}
+
+	if result.SectionText != "" {
+		fmt.Printf("%s\n\n", result.SectionText)
+		return
+	}
+	// First 200 columns
+	fmt.Printf("%s\n\n", truncate(result.Text, 200))
+}
+
+func runSearchMessages(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("search-msg", flag.ExitOnError)
+	fts := fs.Bool("fts", false, "use FTS5 exact phrase matching instead of semantic search")
+	contextMinutes := fs.Int("context", 3, "context window in minutes around matched messages")
+	limit := fs.Int("limit", 5, "max results")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(searchTimeout)
+	defer cancel()
+
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: query required as first positional argument\n")
+		os.Exit(1)
+	}
+
+	query := fs.Arg(0)
+
+	// Initialize DB and Ollama
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	if *fts {
+		// FTS5 exact phrase search
+		results, err := searchMessagesFTS(db, query, *limit)
+		if err != nil {
+			log.Fatalf("fts search: %v", err)
+		}
+
+		if len(results) == 0 {
+			fmt.Println("No exact matches found.")
+			return
+		}
+
+		fmt.Printf("FTS5 matches for %q:\n\n", query)
+		for _, r := range results {
+			ts := fmt.Sprintf("%d", r.Timestamp/1000) // unix seconds
+			fmt.Printf("[%s] %s:\n%s\n\n", ts, r.Role, truncate(r.Text, 300))
+		}
+	} else {
+		// Semantic search with context window
+		contexts, err := searchMessagesWithContext(ctx, db, ollama, query, *limit, *contextMinutes)
+		if err != nil {
+			log.Fatalf("search messages: %v", err)
+		}
+
+		if len(contexts) == 0 {
+			fmt.Println("No messages found.")
+			return
+		}
+
+		fmt.Printf("Found %d conversation contexts:\n\n", len(contexts))
+		for i, ctx := range contexts {
+			fmt.Printf("─── Context %d ───\n", i+1)
+			for _, m := range ctx {
+				fmt.Printf("[%s] %s:\n%s\n\n", formatTimestamp(m.Timestamp), m.Role, truncate(m.Text, 400))
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func runExtractRelations(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("extract-relations", flag.ExitOnError)
+	source := fs.String("source", "", "only process chunks from this source file")
+	limit := fs.Int("limit", 0, "max chunks to process (0 = all pending)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	chunkIDs, err := pendingExtractionChunks(db, extractionKindRelations, *source)
+	if err != nil {
+		log.Fatalf("find pending chunks: %v", err)
+	}
+	if *limit > 0 && len(chunkIDs) > *limit {
+		chunkIDs = chunkIDs[:*limit]
+	}
+	if len(chunkIDs) == 0 {
+		fmt.Println("No chunks pending relation extraction.")
+		return
+	}
+
+	fmt.Printf("Extracting relations from %d chunks with %s...\n", len(chunkIDs), generateModel)
+	progress := NewProgress("Extracting")
+	result, err := ExtractRelations(ctx, db, ollama, generateModel, chunkIDs, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("extract relations: %v", err)
+	}
+
+	fmt.Printf("\nExtraction complete:\n")
+	fmt.Printf("  Chunks:    %d\n", result.ChunksProcessed)
+	fmt.Printf("  Relations: %d\n", result.RelationsCreated)
+}
+
+func runExtractFacts(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("extract-facts", flag.ExitOnError)
+	source := fs.String("source", "", "only process chunks from this source file")
+	limit := fs.Int("limit", 0, "max chunks to process (0 = all pending)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	chunkIDs, err := pendingExtractionChunks(db, extractionKindFacts, *source)
+	if err != nil {
+		log.Fatalf("find pending chunks: %v", err)
+	}
+	if *limit > 0 && len(chunkIDs) > *limit {
+		chunkIDs = chunkIDs[:*limit]
+	}
+	if len(chunkIDs) == 0 {
+		fmt.Println("No chunks pending fact extraction.")
+		return
+	}
+
+	fmt.Printf("Extracting facts from %d chunks with %s...\n", len(chunkIDs), generateModel)
+	progress := NewProgress("Extracting")
+	result, err := ExtractFacts(ctx, db, ollama, generateModel, chunkIDs, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("extract facts: %v", err)
+	}
+
+	fmt.Printf("\nExtraction complete:\n")
+	fmt.Printf("  Chunks: %d\n", result.ChunksProcessed)
+	fmt.Printf("  Facts:  %d\n", result.FactsCreated)
+}
+
+func runFacts(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("facts", flag.ExitOnError)
+	limit := fs.Int("limit", 10, "max facts to return")
+	asOf := fs.String("as-of", "", "only facts valid on or before this date (YYYY-MM-DD or RFC3339)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(searchTimeout)
+	defer cancel()
+
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: query required as first positional argument\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	results, err := SearchFacts(ctx, db, ollama, fs.Arg(0), *limit, *asOf)
+	if err != nil {
+		log.Fatalf("search facts: %v", err)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No facts found.")
+		return
+	}
+
+	for _, r := range results {
+		validAtLabel := r.ValidAt
+		if validAtLabel == "" {
+			validAtLabel = "timeless"
+		}
+		fmt.Printf("[%s] %s\n", validAtLabel, r.Text)
+		fmt.Printf("    %s › %s  (distance %.4f)\n", r.SourceFile, r.SectionTitle, r.Distance)
+	}
+}
+
+func runConflicts(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("conflicts", flag.ExitOnError)
+	detect := fs.Bool("detect", false, "check newly extracted facts for conflicts before listing")
+	entity := fs.String("entity", "", "only show conflicts about this entity")
+	limit := fs.Int("limit", 20, "max conflicts to show")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	if *detect {
+		ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+		chunkIDs, err := pendingConflictChunks(db)
+		if err != nil {
+			log.Fatalf("find pending chunks: %v", err)
+		}
+		if len(chunkIDs) == 0 {
+			fmt.Println("No new facts to check. Run extract-facts first.")
+		} else {
+			fmt.Printf("Checking facts from %d chunks with %s...\n", len(chunkIDs), generateModel)
+			progress := NewProgress("Checking")
+			result, err := DetectConflicts(ctx, db, ollama, generateModel, chunkIDs, progress.Func())
+			progress.Finish()
+			if err != nil {
+				log.Fatalf("detect conflicts: %v", err)
+			}
+			fmt.Printf("  Facts checked: %d, comparisons: %d, new conflicts: %d\n\n",
+				result.FactsChecked, result.Comparisons, result.ConflictsFound)
+		}
+	}
+
+	conflicts, err := Conflicts(db, *entity, *limit)
+	if err != nil {
+		log.Fatalf("conflicts: %v", err)
+	}
+
+	if len(conflicts) == 0 {
+		fmt.Println("No conflicts found.")
+		return
+	}
+
+	for _, c := range conflicts {
+		fmt.Printf("#%d %s — %s\n", c.ID, c.Kind, c.Entity)
+		fmt.Printf("  [%s] %s  (%s)\n", dateLabel(c.Older.ValidAt), c.Older.Text, c.Older.SourceFile)
+		fmt.Printf("  [%s] %s  (%s)\n", dateLabel(c.Newer.ValidAt), c.Newer.Text, c.Newer.SourceFile)
+		if c.Reason != "" {
+			fmt.Printf("  %s\n", c.Reason)
+		}
+		fmt.Println()
+	}
+}
+
+func runSupersede(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("supersede", flag.ExitOnError)
+	detect := fs.Bool("detect", false, "find chunks that replace older memories via the generate model")
+	source := fs.String("source", "", "with --detect, only check chunks from this source file")
+	limit := fs.Int("limit", 0, "with --detect, max chunks to check (0 = all pending)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	if *detect {
+		db, err := InitDB(mnemeDB)
+		if err != nil {
+			log.Fatalf("init db: %v", err)
+		}
+		defer db.Close()
+
+		ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+		chunkIDs, err := pendingSupersessionChunks(db, *source)
+		if err != nil {
+			log.Fatalf("find pending chunks: %v", err)
+		}
+		if *limit > 0 && len(chunkIDs) > *limit {
+			chunkIDs = chunkIDs[:*limit]
+		}
+		if len(chunkIDs) == 0 {
+			fmt.Println("No dated chunks pending supersession check.")
+			return
+		}
+
+		fmt.Printf("Comparing %d chunks with older memories using %s...\n", len(chunkIDs), generateModel)
+		progress := NewProgress("Comparing")
+		result, err := DetectSupersessions(ctx, db, ollama, generateModel, chunkIDs, progress.Func())
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("detect supersession: %v", err)
+		}
+
+		fmt.Printf("\nSupersession check complete:\n")
+		fmt.Printf("  Chunks:      %d\n", result.ChunksChecked)
+		fmt.Printf("  Comparisons: %d\n", result.Comparisons)
+		fmt.Printf("  Superseded:  %d\n", result.Superseded)
+		return
+	}
+
+	if fs.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "Error: two chunk IDs required: <old-id> <new-id> (or --detect)\n")
+		os.Exit(1)
+	}
+	oldID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		log.Fatalf("invalid chunk id %q", fs.Arg(0))
+	}
+	newID, err := strconv.ParseInt(fs.Arg(1), 10, 64)
+	if err != nil {
+		log.Fatalf("invalid chunk id %q", fs.Arg(1))
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	if err := SupersedeChunk(db, oldID, newID); err != nil {
+		log.Fatalf("supersede: %v", err)
+	}
+	fmt.Printf("Chunk %d is now superseded by chunk %d\n", oldID, newID)
+}
+
+func runTitleBatches(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("title-batches", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	progress := NewProgress("Titling")
+	titled, err := TitleWatchBatches(ctx, db, ollama, generateModel, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("title batches: %v", err)
+	}
+	if titled == 0 {
+		fmt.Println("No untitled watch batches.")
+		return
+	}
+	fmt.Printf("Titled %d watch batches.\n", titled)
+}
+
+func runTagTopics(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("tag-topics", flag.ExitOnError)
+	source := fs.String("source", "", "only process chunks from this source file")
+	limit := fs.Int("limit", 0, "max chunks to process per pass (0 = all pending)")
+	every := fs.Duration("every", 0, "keep running, tagging new chunks at this interval (e.g. 15m)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	for {
+		chunkIDs, err := pendingExtractionChunks(db, extractionKindTopics, *source)
+		if err != nil {
+			log.Fatalf("find pending chunks: %v", err)
+		}
+		if *limit > 0 && len(chunkIDs) > *limit {
+			chunkIDs = chunkIDs[:*limit]
+		}
+
+		if len(chunkIDs) == 0 {
+			if *every == 0 {
+				fmt.Println("No chunks pending topic tagging.")
+			}
+		} else {
+			fmt.Printf("Tagging %d chunks with %s...\n", len(chunkIDs), generateModel)
+			progress := NewProgress("Tagging")
+			result, err := TagTopics(ctx, db, ollama, generateModel, chunkIDs, progress.Func())
+			progress.Finish()
+			if err != nil {
+				if *every == 0 {
+					log.Fatalf("tag topics: %v", err)
+				}
+				log.Printf("tag topics: %v", err)
+			}
+			fmt.Printf("  Chunks: %d, tags: %d\n", result.ChunksProcessed, result.TagsCreated)
+		}
+
+		if *every == 0 {
+			return
+		}
+		time.Sleep(*every)
+	}
+}
+
+func runTags(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	limit := fs.Int("limit", 50, "max tags (or chunks) to show")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	if fs.NArg() == 0 {
+		tags, err := ListTags(db, "", *limit)
+		if err != nil {
+			log.Fatalf("list tags: %v", err)
+		}
+		if len(tags) == 0 {
+			fmt.Println("No tags yet. Run tag-topics to label chunks.")
+			return
+		}
+		for _, t := range tags {
+			fmt.Printf("%5d  %s\n", t.Chunks, t.Tag)
+		}
+		return
+	}
+
+	results, err := TaggedChunks(db, fs.Arg(0), *limit)
+	if err != nil {
+		log.Fatalf("tagged chunks: %v", err)
+	}
+	if len(results) == 0 {
+		fmt.Printf("No chunks tagged %q.\n", fs.Arg(0))
+		return
+	}
+	for _, result := range results {
+		validAtLabel := result.ValidAt
+		if validAtLabel == "" {
+			validAtLabel = "timeless"
+		}
+		fmt.Printf("[%s] %s — %s\n", validAtLabel, result.SourceFile, result.SectionTitle)
+		fmt.Printf("%s\n---\n", truncate(result.Text, 300))
+	}
+}
+
+func runTag(args []string, mnemeDB string) {
+	if len(args) < 2 || (args[0] != "list" && len(args) < 3) {
+		fmt.Fprintf(os.Stderr, "Usage: mneme tag add|remove <chunk-id> <tag>... | mneme tag list <chunk-id>\n")
+		os.Exit(1)
+	}
+	chunkID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		log.Fatalf("invalid chunk id %q", args[1])
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "add":
+		added, err := AddChunkTags(db, chunkID, args[2:])
+		if err != nil {
+			log.Fatalf("add tags: %v", err)
+		}
+		fmt.Printf("Added %d tags to chunk %d\n", added, chunkID)
+	case "remove":
+		removed, err := RemoveChunkTags(db, chunkID, args[2:])
+		if err != nil {
+			log.Fatalf("remove tags: %v", err)
+		}
+		fmt.Printf("Removed %d tags from chunk %d\n", removed, chunkID)
+	case "list":
+		tags, err := ListChunkTags(db, chunkID)
+		if err != nil {
+			log.Fatalf("list tags: %v", err)
+		}
+		if len(tags) == 0 {
+			fmt.Printf("Chunk %d has no tags.\n", chunkID)
+			return
+		}
+		for _, t := range tags {
+			fmt.Printf("%-30s %s\n", t.Tag, t.Source)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown tag command %q (add, remove or list)\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func runOnThisDay(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("on-this-day", flag.ExitOnError)
+	date := fs.String("date", "", "day to look back from (YYYY-MM-DD, default today)")
+	weeks := fs.String("weeks", "1,4", "also show chunks ingested exactly this many weeks ago (comma-separated, empty to skip)")
+	limit := fs.Int("limit", 20, "max chunks per group")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	day := time.Now().In(mnemeLocation)
+	if *date != "" {
+		parsed, err := time.ParseInLocation(dateLayout, *date, mnemeLocation)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --date must be YYYY-MM-DD\n")
+			os.Exit(1)
+		}
+		day = parsed
+	}
+
+	var weekList []int
+	for _, w := range strings.Split(*weeks, ",") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		n, err := strconv.Atoi(w)
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: --weeks must be positive whole numbers, got %q\n", w)
+			os.Exit(1)
+		}
+		weekList = append(weekList, n)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	results, err := OnThisDay(db, day, weekList, *limit)
+	if err != nil {
+		log.Fatalf("on this day: %v", err)
+	}
+	if len(results) == 0 {
+		fmt.Printf("Nothing from %s in earlier years.\n", day.Format("January 2"))
+		return
+	}
+
+	for _, r := range results {
+		when := fmt.Sprintf("%d weeks ago", r.WeeksAgo)
+		switch {
+		case r.YearsAgo == 1:
+			when = "1 year ago"
+		case r.YearsAgo > 1:
+			when = fmt.Sprintf("%d years ago", r.YearsAgo)
+		case r.WeeksAgo == 1:
+			when = "1 week ago"
+		}
+		fmt.Printf("[%s · %s] %s — %s\n", when, dateLabel(r.ValidAt), r.SourceFile, r.SectionTitle)
+		fmt.Printf("%s\n---\n", truncate(r.Text, 300))
+	}
+}
+
+func runTopics(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("topics", flag.ExitOnError)
+	from := fs.String("from", "", "only chunks dated on or after this date (YYYY-MM-DD or RFC3339)")
+	to := fs.String("to", "", "only chunks dated on or before this date (YYYY-MM-DD or RFC3339)")
+	k := fs.Int("k", 0, "number of clusters (0 = pick from the number of chunks)")
+	noLabel := fs.Bool("no-label", false, "skip the generate model; label clusters by tag or section title")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	clusters, err := ClusterTopics(db, *from, *to, *k)
+	if err != nil {
+		log.Fatalf("cluster topics: %v", err)
+	}
+	if len(clusters) == 0 {
+		fmt.Println("No chunks in range.")
+		return
+	}
+
+	var ollama *OllamaClient
+	if !*noLabel {
+		ollama = NewOllamaClient("http://"+ollamaHost, embedModel)
+	}
+	progress := NewProgress("Labeling")
+	err = LabelTopicClusters(ctx, db, ollama, generateModel, clusters, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("label topics: %v", err)
+	}
+
+	total := 0
+	for _, c := range clusters {
+		total += c.Size
+	}
+	fmt.Printf("%d chunks in %d topics\n\n", total, len(clusters))
+	for _, c := range clusters {
+		span := "timeless"
+		if c.FirstSeen != "" {
+			span = c.FirstSeen + " → " + c.LastSeen
+		}
+		fmt.Printf("%5d  %s  [%s]\n", c.Size, c.Label, span)
+		for _, title := range c.Titles {
+			fmt.Printf("         · %s\n", title)
+		}
+	}
+}
+
+func runGraph(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	depth := fs.Int("depth", 1, "how many hops to traverse")
+	limit := fs.Int("limit", 50, "max relations to show")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: entity name required as first positional argument\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	edges, err := Graph(db, fs.Arg(0), *depth, *limit)
+	if err != nil {
+		log.Fatalf("graph: %v", err)
+	}
+
+	if len(edges) == 0 {
+		fmt.Println("No relations found.")
+		return
+	}
+
+	for _, e := range edges {
+		validAtLabel := e.ValidAt
+		if validAtLabel == "" {
+			validAtLabel = "timeless"
+		}
+		indent := strings.Repeat("  ", e.Depth-1)
+		fmt.Printf("%s[%s] %s —%s→ %s", indent, validAtLabel, e.Subject, e.Predicate, e.Object)
+		if e.SourceFile != "" {
+			fmt.Printf("  (%s)", e.SourceFile)
+		}
+		fmt.Println()
+	}
+}
+
+func runRelatedEntities(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("related-entities", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "max entities to show")
+	bySession := fs.Bool("by-session", false, "count shared sessions instead of shared chunks")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: entity name required as first positional argument\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	related, err := RelatedEntities(db, fs.Arg(0), *limit, *bySession)
+	if err != nil {
+		log.Fatalf("related entities: %v", err)
+	}
+
+	if len(related) == 0 {
+		fmt.Println("No co-occurring entities found.")
+		return
+	}
+
+	unit := "chunks"
+	if *bySession {
+		unit = "sessions"
+	}
+	for _, r := range related {
+		kind := ""
+		if r.Kind != "" {
+			kind = " (" + r.Kind + ")"
+		}
+		span := "timeless"
+		if r.FirstSeen != "" {
+			span = r.FirstSeen + " → " + r.LastSeen
+		}
+		fmt.Printf("%4d %s  %s%s  [%s]\n", r.Shared, unit, r.Name, kind, span)
+	}
+}
+
+func runEntity(args []string, mnemeDB string) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: mneme entity <list|set-type|merge|alias> ...\n")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		runEntityList(args[1:], mnemeDB)
+	case "set-type":
+		runEntitySetType(args[1:], mnemeDB)
+	case "merge":
+		runEntityMerge(args[1:], mnemeDB)
+	case "alias":
+		runEntityAlias(args[1:], mnemeDB)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown entity command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func runEntityList(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("entity list", flag.ExitOnError)
+	entityType := fs.String("type", "", "only entities of this type (person, project, place, tool)")
+	since := fs.String("since", "", "only count mentions dated on or after this date (YYYY-MM-DD or RFC3339)")
+	until := fs.String("until", "", "only count mentions dated on or before this date (YYYY-MM-DD or RFC3339)")
+	limit := fs.Int("limit", 50, "max entities to show")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	entities, err := ListEntities(db, *entityType, *since, *until, *limit)
+	if err != nil {
+		log.Fatalf("list entities: %v", err)
+	}
+	printEntitySummaries(entities)
+}
+
+// printEntitySummaries prints entities with their mention counts, types and date spans.
+func printEntitySummaries(entities []EntitySummary) {
+	if jsonOutput {
+		printJSON(entities)
+		return
+	}
+	if len(entities) == 0 {
+		fmt.Println("No entities found.")
+		return
+	}
+
+	for _, e := range entities {
+		kind := e.Kind
+		if kind == "" {
+			kind = "-"
+		}
+		span := "timeless"
+		if e.FirstSeen != "" {
+			span = e.FirstSeen + " → " + e.LastSeen
+		}
+		fmt.Printf("%5d  %-8s %s  [%s]\n", e.Chunks, kind, e.Name, span)
+	}
+}
+
+func runEntitySetType(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("entity set-type", flag.ExitOnError)
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	if fs.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "Error: entity name and type required: <name> <person|project|place|tool>\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	if err := SetEntityType(db, fs.Arg(0), fs.Arg(1)); err != nil {
+		log.Fatalf("set type: %v", err)
+	}
+	kind, _ := normalizeEntityKind(fs.Arg(1))
+	fmt.Printf("%s is now a %s\n", fs.Arg(0), kind)
+}
+
+func runEntityMerge(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("entity merge", flag.ExitOnError)
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	if fs.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "Error: two entity names required: <keep> <merge>\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	result, err := MergeEntities(db, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		log.Fatalf("merge entities: %v", err)
+	}
+
+	fmt.Printf("Merged %q into %q\n", result.Merged, result.Kept)
+	fmt.Printf("  Chunks relinked:   %d\n", result.ChunksRelinked)
+	fmt.Printf("  Relations rewired: %d\n", result.RelationsRewired)
+	if len(result.Aliases) > 0 {
+		fmt.Printf("  Aliases added:     %s\n", strings.Join(result.Aliases, ", "))
+	}
+}
+
+func runEntityAlias(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("entity alias", flag.ExitOnError)
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	if fs.NArg() < 2 {
+		fmt.Fprintf(os.Stderr, "Error: alias and entity name required: <alias> <entity>\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	result, err := AddEntityAlias(db, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		log.Fatalf("add alias: %v", err)
+	}
+
+	if len(result.Entities) == 1 {
+		fmt.Printf("%q now refers to %s\n", result.Alias, result.Entities[0])
+		return
+	}
+	fmt.Printf("%q now refers to %d entities: %s\n", result.Alias, len(result.Entities), strings.Join(result.Entities, ", "))
+	fmt.Printf("  Mentions resolved by context: %d\n", result.Resolved)
+	fmt.Printf("  Mentions left undecided:      %d\n", result.Undecided)
+}
+
+func runPeople(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("people", flag.ExitOnError)
+	days := fs.Int("days", 30, "window length in days, compared with the window before it")
+	date := fs.String("date", "", "last day of the window (YYYY-MM-DD, default today)")
+	limit := fs.Int("limit", 20, "max people to show")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	end := time.Now().In(mnemeLocation)
+	if *date != "" {
+		parsed, err := time.ParseInLocation(dateLayout, *date, mnemeLocation)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --date must be YYYY-MM-DD\n")
+			os.Exit(1)
+		}
+		end = parsed
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	people, err := PeopleDigest(db, end, *days, *limit)
+	if err != nil {
+		log.Fatalf("people: %v", err)
+	}
+	if len(people) == 0 {
+		fmt.Printf("No people mentioned in the last %d days. Run extract-entities to build the entity index.\n", 2**days)
+		return
+	}
+
+	arrows := map[string]string{trendNew: "new", trendUp: " ↑ ", trendDown: " ↓ ", trendSteady: " → "}
+	fmt.Printf("People, last %d days (previous %d days in parentheses)\n\n", *days, *days)
+	for _, p := range people {
+		fmt.Printf("%5d (%d) %s  %-30s last %s\n", p.Mentions, p.Previous, arrows[p.Trend], p.Name, p.LastSeen)
+	}
+}
+
+func runImportance(args []string, mnemeDB, ollamaHost, embedModel, generateModel, userAlias string) {
+	fs := flag.NewFlagSet("importance", flag.ExitOnError)
+	llm := fs.Bool("llm", false, "rate chunks with the generate model instead of the heuristic")
+	source := fs.String("source", "", "only score chunks from this source file")
+	limit := fs.Int("limit", 0, "max chunks to score (0 = all pending)")
+	rescore := fs.Bool("rescore", false, "score chunks that already have a score too")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	chunkIDs, err := pendingImportanceChunks(db, *source, *rescore)
+	if err != nil {
+		log.Fatalf("find pending chunks: %v", err)
+	}
+	if *limit > 0 && len(chunkIDs) > *limit {
+		chunkIDs = chunkIDs[:*limit]
+	}
+	if len(chunkIDs) == 0 {
+		fmt.Println("No chunks to score.")
+		return
+	}
+
+	var ollama *OllamaClient
+	if *llm {
+		ollama = NewOllamaClient("http://"+ollamaHost, embedModel)
+		fmt.Printf("Rating %d chunks with %s...\n", len(chunkIDs), generateModel)
+	} else {
+		fmt.Printf("Scoring %d chunks...\n", len(chunkIDs))
+	}
+	progress := NewProgress("Scoring")
+	result, err := ScoreImportance(ctx, db, ollama, generateModel, userAlias, chunkIDs, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("score importance: %v", err)
+	}
+
+	fmt.Printf("  Chunks scored: %d\n", result.ChunksScored)
+	if *llm {
+		fmt.Printf("  Rated by model: %d (rest by heuristic)\n", result.LLMRated)
+	}
+}
+
+func runDecay(args []string, mnemeDB string) {
+	if len(args) > 0 && args[0] == "policy" {
+		runDecayPolicy(args[1:], mnemeDB)
+		return
+	}
+
+	fs := flag.NewFlagSet("decay", flag.ExitOnError)
+	archive := fs.Bool("archive", false, "archive chunks below their policy's archive threshold")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	result, err := UpdateDecay(db, time.Now(), nil, *archive)
+	if err != nil {
+		log.Fatalf("decay: %v", err)
+	}
+	fmt.Printf("Scored %d chunks.\n", result.ChunksScored)
+	if *archive {
+		fmt.Printf("Archived %d chunks (search with --include-archived to see them; a retrieval restores them).\n", result.Archived)
+	}
+}
+
+func runDecayPolicy(args []string, mnemeDB string) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: mneme decay policy <list|set|delete> ...\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "list":
+		policies, err := LoadDecayPolicies(db)
+		if err != nil {
+			log.Fatalf("load policies: %v", err)
+		}
+		fmt.Printf("%-24s %10s %10s %10s %10s\n", "NAMESPACE", "HALF-LIFE", "IMPORTANCE", "REINFORCE", "ARCHIVE <")
+		for _, p := range policies {
+			ns := p.Namespace
+			if ns == "" {
+				ns = "(default)"
+			}
+			fmt.Printf("%-24s %9.0fd %10.2f %10.2f %10.2f\n", ns, p.HalfLifeDays, p.ImportanceWeight, p.Reinforcement, p.ArchiveBelow)
+		}
+	case "set":
+		fs := flag.NewFlagSet("decay policy set", flag.ExitOnError)
+		namespace := fs.String("namespace", "", "source_file prefix the policy applies to (empty = default)")
+		halfLife := fs.Float64("half-life", defaultDecayPolicy.HalfLifeDays, "days for an unretrieved chunk to lose half its strength")
+		importanceWeight := fs.Float64("importance-weight", defaultDecayPolicy.ImportanceWeight, "share of the score taken from importance (0-1)")
+		reinforcement := fs.Float64("reinforcement", defaultDecayPolicy.Reinforcement, "half-life stretch per retrieval")
+		archiveBelow := fs.Float64("archive-below", 0, "archive chunks scoring under this (0 = never)")
+		if err := fs.Parse(args[1:]); err != nil {
+			log.Fatalf("parse flags: %v", err)
+		}
+		p := DecayPolicy{
+			Namespace:        *namespace,
+			HalfLifeDays:     *halfLife,
+			ImportanceWeight: *importanceWeight,
+			Reinforcement:    *reinforcement,
+			ArchiveBelow:     *archiveBelow,
+		}
+		if err := SetDecayPolicy(db, p); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Policy saved. Run `mneme decay` to rescore.")
+	case "delete":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "Usage: mneme decay policy delete <namespace>\n")
+			os.Exit(1)
+		}
+		deleted, err := DeleteDecayPolicy(db, args[1])
+		if err != nil {
+			log.Fatalf("delete policy: %v", err)
+		}
+		if !deleted {
+			fmt.Printf("No policy for %q.\n", args[1])
+			return
+		}
+		fmt.Println("Policy deleted.")
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown decay policy command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func runPrune(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	below := fs.Float64("below", 0, "delete chunks with importance below this score (0-1, required)")
+	before := fs.String("before", "", "only chunks dated before this date (YYYY-MM-DD or RFC3339)")
+	dryRun := fs.Bool("dry-run", false, "list what would be deleted without deleting")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	if *below <= 0 || *below > 1 {
+		fmt.Fprintf(os.Stderr, "Error: --below must be between 0 and 1\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	candidates, err := PruneCandidates(db, *below, *before)
+	if err != nil {
+		log.Fatalf("find prune candidates: %v", err)
+	}
+	if len(candidates) == 0 {
+		fmt.Println("Nothing to prune. Unscored chunks are kept; run importance first.")
+		return
+	}
+
+	for _, c := range candidates {
+		fmt.Printf("  %.2f  [%s] %s — %s\n", c.Importance, dateLabel(c.ValidAt), c.SourceFile, c.SectionTitle)
+	}
+	if *dryRun {
+		fmt.Printf("\n%d chunks would be deleted.\n", len(candidates))
+		return
+	}
+
+	fmt.Printf("\nDelete these %d chunks? [y/n]: ", len(candidates))
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatalf("read input: %v", err)
+	}
+	response = strings.TrimSpace(strings.ToLower(response))
+	if response != "y" && response != "yes" {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	ids := make([]int64, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.ID
+	}
+	deleted, err := DeleteChunks(db, ids)
+	if err != nil {
+		log.Fatalf("prune: %v", err)
+	}
+	fmt.Printf("Deleted %d chunks.\n", deleted)
+}
+
+func runDupes(args []string, mnemeDB string) {
+	if len(args) > 0 && (args[0] == "merge" || args[0] == "delete") {
+		runDupesAction(args[0], args[1:], mnemeDB)
+		return
+	}
+
+	fs := flag.NewFlagSet("dupes", flag.ExitOnError)
+	threshold := fs.Float64("threshold", defaultDuplicateThreshold, "minimum cosine similarity for a pair (0-1)")
+	limit := fs.Int("limit", 20, "max clusters to show (0 = all)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	if *threshold <= 0 || *threshold > 1 {
+		fmt.Fprintf(os.Stderr, "Error: --threshold must be between 0 and 1\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	progress := NewProgress("Scanning")
+	clusters, err := FindDuplicates(db, *threshold, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("find duplicates: %v", err)
+	}
+	if len(clusters) == 0 {
+		fmt.Printf("No chunks at or above %.2f similarity.\n", *threshold)
+		return
+	}
+
+	total := 0
+	for _, c := range clusters {
+		total += len(c.Chunks) - 1
+	}
+	fmt.Printf("%d clusters, %d redundant chunks at or above %.2f similarity.\n", len(clusters), total, *threshold)
+
+	for i, cluster := range clusters {
+		if *limit > 0 && i >= *limit {
+			fmt.Printf("\n... %d more clusters (raise --limit to see them)\n", len(clusters)-i)
+			break
+		}
+		fmt.Printf("\n%d. %d chunks, similarity >= %.3f\n", i+1, len(cluster.Chunks), cluster.Similarity)
+		ids := make([]string, len(cluster.Chunks))
+		for j, c := range cluster.Chunks {
+			marker := " "
+			if j == 0 {
+				marker = "*"
+			}
+			fmt.Printf("  %s #%-6d [%s] %s — %s (%d words)\n", marker, c.ID, dateLabel(c.ValidAt), c.SourceFile, c.SectionTitle, c.Words)
+			ids[j] = strconv.FormatInt(c.ID, 10)
+		}
+		fmt.Printf("    mneme dupes merge %s\n", strings.Join(ids, " "))
+	}
+	fmt.Println("\n* = suggested keeper. merge keeps the first id and folds the rest into it.")
+}
+
+func runDupesAction(action string, args []string, mnemeDB string) {
+	minIDs := 1
+	usage := "Usage: mneme dupes delete <id>...\n"
+	if action == "merge" {
+		minIDs = 2
+		usage = "Usage: mneme dupes merge <keep-id> <id>...\n"
+	}
+	if len(args) < minIDs {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+	ids := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid chunk id %q\n", arg)
+			os.Exit(1)
+		}
+		ids[i] = id
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	if action == "merge" {
+		merged, err := MergeChunks(db, ids[0], ids[1:])
+		if err != nil {
+			log.Fatalf("merge: %v", err)
+		}
+		fmt.Printf("Merged %d chunks into #%d.\n", merged, ids[0])
+		return
+	}
+	deleted, err := DeleteChunks(db, ids)
+	if err != nil {
+		log.Fatalf("delete: %v", err)
+	}
+	fmt.Printf("Deleted %d chunks.\n", deleted)
+}
+
+func runPin(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("pin", flag.ExitOnError)
+	idList := fs.String("id", "", "comma-separated chunk ids to pin (omit to list pinned chunks)")
+	remove := fs.Bool("remove", false, "unpin the --id chunks instead")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	var ids []int64
+	for _, part := range strings.Split(*idList, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid chunk id %q\n", part)
+			os.Exit(1)
+		}
+		ids = append(ids, id)
+	}
+	if *remove && len(ids) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: --remove needs --id\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	switch {
+	case *remove:
+		changed, err := UnpinChunks(db, ids)
+		if err != nil {
+			log.Fatalf("unpin: %v", err)
+		}
+		fmt.Printf("Unpinned %d chunks.\n", changed)
+	case len(ids) > 0:
+		changed, err := PinChunks(db, ids, time.Now())
+		if err != nil {
+			log.Fatalf("pin: %v", err)
+		}
+		fmt.Printf("Pinned %d chunks.\n", changed)
+	default:
+		pinned, err := PinnedChunks(db, nil)
+		if err != nil {
+			log.Fatalf("list pinned: %v", err)
+		}
+		if len(pinned) == 0 {
+			fmt.Println("No pinned chunks. Pin one with: mneme pin --id <chunk-id>")
+			return
+		}
+		for _, p := range pinned {
+			fmt.Printf("  #%d [%s] %s — %s\n", p.ID, dateLabel(p.ValidAt), p.SourceFile, p.SectionTitle)
+			fmt.Printf("      %s\n", truncate(strings.Join(strings.Fields(p.Text), " "), 120))
+		}
+	}
+}
+
+func runPack(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("pack", flag.ExitOnError)
+	query := fs.String("query", "", "task or question to pack context for (required)")
+	budget := fs.Int("budget", defaultPackBudget, "token budget (estimated at four characters per token)")
+	asOf := fs.String("as-of", "", "optional date filter (YYYY-MM-DD or RFC3339)")
+	current := fs.Bool("current", false, "leave out chunks superseded by newer ones")
+	jsonOut := fs.Bool("json", jsonOutput, "print the pack as JSON instead of markdown")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(searchTimeout)
+	defer cancel()
+
+	if *query == "" {
+		fmt.Fprintf(os.Stderr, "Error: --query is required\n")
+		os.Exit(1)
+	}
+	if *budget <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --budget must be positive\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	pack, err := BuildContextPack(ctx, db, ollama, *query, PackOptions{Budget: *budget, AsOf: *asOf, Current: *current})
+	if err != nil {
+		log.Fatalf("pack: %v", err)
+	}
+
+	if *jsonOut {
+		payload, err := json.MarshalIndent(pack, "", "  ")
+		if err != nil {
+			log.Fatalf("encode pack: %v", err)
+		}
+		fmt.Println(string(payload))
+		return
+	}
+	fmt.Print(RenderPackMarkdown(pack))
+	fmt.Fprintf(os.Stderr, "~%d of %d tokens, %d items left out\n", pack.Tokens, pack.Budget, pack.Omitted)
+}
+
+func runAlias(args []string, mnemeDB string) {
+	if len(args) < 1 || args[0] != "suggest" {
+		fmt.Fprintf(os.Stderr, "Usage: mneme alias suggest [--min N] [--apply]\n")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("alias suggest", flag.ExitOnError)
+	minEvidence := fs.Int("min", 2, "minimum supporting occurrences for a suggestion")
+	apply := fs.Bool("apply", false, "store every suggestion (merging entities and adding aliases)")
+	limit := fs.Int("limit", 20, "max suggestions to show")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	suggestions, err := SuggestAliases(db, *minEvidence)
+	if err != nil {
+		log.Fatalf("suggest aliases: %v", err)
+	}
+	if len(suggestions) == 0 {
+		fmt.Println("No alias suggestions.")
+		return
+	}
+	if len(suggestions) > *limit {
+		suggestions = suggestions[:*limit]
+	}
+
+	for _, s := range suggestions {
+		fmt.Printf("%-40s  %3d× %s\n", strings.Join(s.Names, " = "), s.Evidence, strings.Join(s.Reasons, ", "))
+		if *apply {
+			if err := ApplyAliasSuggestion(db, s); err != nil {
+				fmt.Fprintf(os.Stderr, "  skipped: %v\n", err)
+			}
+		}
+	}
+	if *apply {
+		fmt.Printf("\nApplied %d suggestions.\n", len(suggestions))
+	} else {
+		fmt.Println("\nRun with --apply to store these, or add the ones you agree with via `mneme entity alias`.")
+	}
+}
+
+func formatTimestamp(ms int64) string {
+	return fmt.Sprintf("%d", ms/1000)
+}
+
+func runEval(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	casesFile := fs.String("cases", "", "YAML or JSON file of test cases (required)")
+	k := fs.Int("k", 10, "results considered per query")
+	current := fs.Bool("current", false, "hide chunks superseded by newer ones")
+	entityType := fs.String("type", "", "only chunks mentioning an entity of this type")
+	tag := fs.String("tag", "", "only chunks carrying this tag or topic")
+	importanceBoost := fs.Float64("importance-boost", 0, "as in search")
+	decayWeight := fs.Float64("decay-weight", 0, "as in search")
+	includeArchived := fs.Bool("include-archived", false, "also search archived chunks")
+	jsonOut := fs.Bool("json", jsonOutput, "print the report as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	if *casesFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: --cases is required\n")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(*casesFile)
+	if err != nil {
+		log.Fatalf("read cases: %v", err)
+	}
+	cases, err := ParseEvalCases(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", *casesFile, err)
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	opts := SearchOptions{
+		Limit: *k, Current: *current, EntityType: *entityType, Tag: *tag,
+		ImportanceBoost: *importanceBoost, DecayWeight: *decayWeight, IncludeArchived: *includeArchived,
+	}
+
+	var progress ProgressFunc
+	var bar *Progress
+	if !*jsonOut {
+		bar = NewProgress("Evaluating")
+		progress = bar.Func()
+	}
+	report := RunEval(ctx, db, ollama, cases, opts, progress)
+	if bar != nil {
+		bar.Finish()
+	}
+
+	if *jsonOut {
+		payload, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("encode report: %v", err)
+		}
+		fmt.Println(string(payload))
+		return
+	}
+
+	var chunks int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&chunks)
+	fmt.Printf("Model %s, %d chunks, K=%d, importance-boost %.2f, decay-weight %.2f\n\n",
+		embedModel, chunks, report.K, *importanceBoost, *decayWeight)
+	for _, c := range report.Cases {
+		rank := "miss"
+		if c.Rank > 0 {
+			rank = fmt.Sprintf("#%d", c.Rank)
+		}
+		if c.Error != "" {
+			rank = "error"
+		}
+		fmt.Printf("  %-5s recall %.2f  %s\n", rank, c.Recall, truncate(c.Query, 70))
+		if c.Error != "" {
+			fmt.Printf("        %s\n", c.Error)
+		}
+	}
+	fmt.Printf("\nrecall@%d %.3f   MRR %.3f   (%d cases)\n", report.K, report.Recall, report.MRR, len(report.Cases))
+}
+
+func runThreads(args []string, mnemeDB, ollamaHost, embedModel string) {
+	sub := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	switch sub {
+	case "build":
+		fs := flag.NewFlagSet("threads build", flag.ExitOnError)
+		gap := fs.Int("gap", int(defaultThreadOptions.Gap/time.Minute), "minutes of silence after which a session's thread no longer simply continues")
+		drift := fs.Float64("drift", defaultThreadOptions.Drift, "similarity to the ongoing thread below which a message leaves it (0-1)")
+		resume := fs.Float64("resume", defaultThreadOptions.Resume, "similarity at which a message rejoins an earlier thread (0-1)")
+		rebuild := fs.Bool("rebuild", false, "discard existing threads and regroup every message")
+		if err := fs.Parse(args); err != nil {
+			log.Fatalf("parse flags: %v", err)
+		}
+		if *rebuild {
+			if err := ResetThreads(db); err != nil {
+				log.Fatalf("reset threads: %v", err)
+			}
+		}
+		opts := ThreadOptions{Gap: time.Duration(*gap) * time.Minute, Drift: *drift, Resume: *resume}
+		progress := NewProgress("Threading")
+		result, err := BuildThreads(db, opts, progress.Func())
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("build threads: %v", err)
+		}
+		fmt.Printf("Threaded %d messages (%d new threads).\n", result.Messages, result.NewThreads)
+	case "list":
+		fs := flag.NewFlagSet("threads", flag.ExitOnError)
+		limit := fs.Int("limit", 20, "max threads to show")
+		if err := fs.Parse(args); err != nil {
+			log.Fatalf("parse flags: %v", err)
+		}
+		threads, err := ListThreads(db, *limit)
+		if err != nil {
+			log.Fatalf("list threads: %v", err)
+		}
+		if len(threads) == 0 {
+			fmt.Println("No threads yet. Run `mneme threads build` first.")
+			return
+		}
+		for _, t := range threads {
+			fmt.Printf("#%-5d %s → %s  %3d msgs, %d sessions  %s\n",
+				t.ID, formatThreadTime(t.StartedAt), formatThreadTime(t.EndedAt), t.MessageCount, t.Sessions, t.Title)
+		}
+	case "show":
+		if len(args) != 1 {
+			fmt.Fprintf(os.Stderr, "Usage: mneme threads show <id>\n")
+			os.Exit(1)
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid thread id %q\n", args[0])
+			os.Exit(1)
+		}
+		thread, err := GetThread(db, id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printThread(*thread)
+	case "search":
+		fs := flag.NewFlagSet("threads search", flag.ExitOnError)
+		limit := fs.Int("limit", 3, "max threads to return")
+		if err := fs.Parse(args); err != nil {
+			log.Fatalf("parse flags: %v", err)
+		}
+		query := strings.Join(fs.Args(), " ")
+		if query == "" {
+			fmt.Fprintf(os.Stderr, "Usage: mneme threads search [--limit N] \"<query>\"\n")
+			os.Exit(1)
+		}
+		ctx, cancel := commandContext(searchTimeout)
+		defer cancel()
+		ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+		matches, err := SearchThreads(ctx, db, ollama, query, *limit)
+		if err != nil {
+			log.Fatalf("search threads: %v", err)
+		}
+		if len(matches) == 0 {
+			fmt.Println("No threads found. Run `mneme threads build` to thread new messages.")
+			return
+		}
+		for _, m := range matches {
+			printThread(m)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown threads command: %s\n", sub)
+		os.Exit(1)
+	}
+}
+
+func formatThreadTime(ms int64) string {
+	return time.UnixMilli(ms).In(mnemeLocation).Format("2006-01-02 15:04")
+}
+
+func printThread(t ThreadMatch) {
+	fmt.Printf("─── Thread #%d: %s ───\n", t.ID, t.Title)
+	fmt.Printf("%s → %s, %d messages across %d sessions\n\n", formatThreadTime(t.StartedAt), formatThreadTime(t.EndedAt), t.MessageCount, t.Sessions)
+	for _, m := range t.Messages {
+		fmt.Printf("[%s] %s:\n%s\n\n", formatThreadTime(m.Timestamp), m.Role, truncate(m.Text, 400))
+	}
+}
+
+func runHistory(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "max chunks to retrieve")
+	semantic := fs.Bool("semantic", false, "find chunks by vector similarity to the entity name")
+	intersect := fs.Bool("intersect", false, "with --semantic, keep only chunks that also mention the entity by name")
+	entityType := fs.String("type", "", "instead of one entity, every entity of this type (person, project, place, tool)")
+	tag := fs.String("tag", "", "only chunks carrying this tag")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(searchTimeout)
+	defer cancel()
+
+	if fs.NArg() > 0 && *entityType != "" {
+		fmt.Fprintf(os.Stderr, "Error: give either an entity name or --type, not both\n")
+		os.Exit(1)
+	}
+
+	entity := fs.Arg(0)
+
+	// Initialize DB
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	// Without an entity, list the known ones to pick from
+	if fs.NArg() < 1 && *entityType == "" {
+		entities, err := ListEntities(db, "", "", "", *limit)
+		if err != nil {
+			log.Fatalf("list entities: %v", err)
+		}
+		printEntitySummaries(entities)
+		return
+	}
+
+	// History
+	fetchLimit := *limit
+	if *tag != "" {
+		fetchLimit = *limit * 3
+	}
+	var results []HistoryResult
+	if *entityType != "" {
+		results, err = TypeHistory(db, *entityType, fetchLimit)
+	} else if *semantic {
+		ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+		results, err = SemanticHistory(ctx, db, ollama, entity, fetchLimit, *intersect)
+	} else {
+		results, err = History(db, entity, fetchLimit)
+	}
+	if err == nil && *tag != "" {
+		results, err = keepTagged(db, results, *tag, *limit)
+	}
+	if err != nil {
+		log.Fatalf("history: %v", err)
+	}
+	if jsonOutput {
+		if results == nil {
+			results = []HistoryResult{}
+		}
+		printJSON(results)
+		return
+	}
+
+	// Print chronological chunks
+	for _, result := range results {
+		validAtLabel := result.ValidAt
+		if validAtLabel == "" {
+			validAtLabel = "timeless"
+		}
+
+		fmt.Printf("[%s] %s — %s\n",
+			validAtLabel, result.SourceFile, result.SectionTitle)
+
+		// First 300 columns
+		fmt.Printf("%s\n", truncate(result.Text, 300))
+		fmt.Println("---")
+	}
+}
+
+func runReflect(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("reflect", flag.ExitOnError)
+	topic := fs.String("topic", "", "only reflect on memories about this topic")
+	days := fs.Int("days", 14, "how many days back to look")
+	noStore := fs.Bool("no-store", false, "print the insights without storing them")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	reflection, err := Reflect(ctx, db, ollama, generateModel, *topic, time.Now().In(mnemeLocation), *days, !*noStore)
+	if err != nil {
+		log.Fatalf("reflect: %v", err)
+	}
+	if reflection.Chunks == 0 {
+		fmt.Printf("No memories from the last %d days to reflect on.\n", *days)
+		return
+	}
+	if len(reflection.Insights) == 0 {
+		fmt.Printf("Nothing stood out across %d chunks.\n", reflection.Chunks)
+		return
+	}
+
+	fmt.Printf("Insights from %d chunks:\n\n", reflection.Chunks)
+	for _, insight := range reflection.Insights {
+		fmt.Printf("  • %s\n", insight)
+	}
+	if reflection.SourceFile != "" {
+		fmt.Printf("\nStored as %s (search --tag reflection to find them later)\n", reflection.SourceFile)
+	}
+}
+
+func runConsolidate(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("consolidate", flag.ExitOnError)
+	level := fs.String("level", "all", "rollups to build: week, month or all (weeks, then months from weeks)")
+	raw := fs.String("raw", rawKeep, "what to do with rolled-up watch batches: keep, downweight or prune")
+	every := fs.Duration("every", 0, "keep running, consolidating at this interval (e.g. 24h)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	var levels []string
+	switch *level {
+	case "all":
+		levels = []string{consolidateWeek, consolidateMonth}
+	case consolidateWeek, consolidateMonth:
+		levels = []string{*level}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --level must be week, month or all\n")
+		os.Exit(1)
+	}
+	if *raw != rawKeep && *raw != rawDownweight && *raw != rawPrune {
+		fmt.Fprintf(os.Stderr, "Error: --raw must be keep, downweight or prune\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	for {
+		for _, lvl := range levels {
+			progress := NewProgress("Consolidating")
+			result, err := Consolidate(ctx, db, ollama, generateModel, lvl, time.Now().In(mnemeLocation), progress.Func())
+			progress.Finish()
+			if err != nil {
+				if *every == 0 {
+					log.Fatalf("consolidate: %v", err)
+				}
+				log.Printf("consolidate: %v", err)
+			}
+			if result.Periods == 0 {
+				if *every == 0 {
+					fmt.Printf("No complete %ss to consolidate.\n", lvl)
+				}
+				continue
+			}
+			fmt.Printf("Rolled %d chunks into %d %sly rollups:\n", result.ChunksRolled, result.Periods, lvl)
+			for _, source := range result.Rollups {
+				fmt.Printf("  %s\n", source)
+			}
+
+			if lvl != consolidateWeek {
+				continue
+			}
+			switch *raw {
+			case rawDownweight:
+				if err := DownweightChunks(db, result.RolledUp); err != nil {
+					log.Fatalf("downweight: %v", err)
+				}
+				fmt.Printf("Down-weighted %d watch chunks to importance %.1f.\n", len(result.RolledUp), consolidatedRawImportance)
+			case rawPrune:
+				deleted, err := DeleteChunks(db, result.RolledUp)
+				if err != nil {
+					log.Fatalf("prune: %v", err)
+				}
+				fmt.Printf("Pruned %d watch chunks.\n", deleted)
+			}
+		}
+
+		if *every == 0 {
+			return
+		}
+		time.Sleep(*every)
+	}
+}
+
+func runDigest(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	date := fs.String("date", "", "day to digest (YYYY-MM-DD, default today)")
+	store := fs.Bool("store", false, "ingest the digest back into the store as digest://<date>")
+	notes := fs.String("notes", "", "also write the digest to <dir>/<date>-digest.md")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	day := time.Now().In(mnemeLocation)
+	if *date != "" {
+		parsed, err := time.ParseInLocation(dateLayout, *date, mnemeLocation)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --date must be YYYY-MM-DD\n")
+			os.Exit(1)
+		}
+		day = parsed
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	progress := NewProgress("Digesting")
+	digest, err := BuildDigest(ctx, db, ollama, generateModel, day, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("digest: %v", err)
+	}
+	if digest.Chunks == 0 && digest.Messages == 0 {
+		fmt.Printf("Nothing recorded on %s.\n", digest.Date)
+		return
+	}
+
+	fmt.Printf("From %d chunks and %d messages:\n\n", digest.Chunks, digest.Messages)
+	fmt.Print(RenderDigestMarkdown(digest))
+
+	if *store {
+		sourceFile, err := StoreDigest(ctx, db, ollama, digest)
+		if err != nil {
+			log.Fatalf("store digest: %v", err)
+		}
+		fmt.Printf("Stored as %s\n", sourceFile)
+	}
+	if *notes != "" {
+		path, err := WriteDigestFile(*notes, digest)
+		if err != nil {
+			log.Fatalf("write digest: %v", err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+}
+
+func runEmailDigest(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("email-digest", flag.ExitOnError)
+	period := fs.String("period", emailDaily, "what each email covers: daily (yesterday) or weekly (the last 7 days)")
+	schedule := fs.Bool("schedule", false, "keep running, emailing every day (or every Monday when weekly) at --at")
+	at := fs.String("at", "07:00", "time of day scheduled emails are sent (HH:MM)")
+	printOnly := fs.Bool("print", false, "print the email instead of sending it")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	if *period != emailDaily && *period != emailWeekly {
+		fmt.Fprintf(os.Stderr, "Error: --period must be daily or weekly\n")
+		os.Exit(1)
+	}
+	clock, err := parseClock(*at)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --at: %v\n", err)
+		os.Exit(1)
+	}
+	var cfg smtpConfig
+	if !*printOnly {
+		if cfg, err = smtpConfigFromEnv(); err != nil {
+			log.Fatalf("email-digest: %v", err)
+		}
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	if *schedule {
+		ctx, cancel := commandContext(0)
+		defer cancel()
+		ScheduleDigestEmails(ctx, db, cfg, *period, clock)
+		return
+	}
+
+	digest, err := BuildMemoryDigest(db, *period, time.Now())
+	if err != nil {
+		log.Fatalf("email-digest: %v", err)
+	}
+	if *printOnly {
+		fmt.Printf("Subject: %s\n\n%s", digestSubject(digest), RenderDigestEmail(digest))
+		return
+	}
+	if digest.Empty() {
+		fmt.Println("Nothing to email.")
+		return
+	}
+	if err := SendDigestEmail(cfg, digest); err != nil {
+		log.Fatalf("send: %v", err)
+	}
+	fmt.Printf("Emailed %q to %s\n", digestSubject(digest), strings.Join(cfg.To, ", "))
+}
+
+func runSummarize(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("summarize", flag.ExitOnError)
+	source := fs.String("source", "", "source file to summarize, as stored at ingest (required)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	if *source == "" {
+		fmt.Fprintf(os.Stderr, "Error: --source is required\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	progress := NewProgress("Summarizing")
+	summary, err := SummarizeSource(ctx, db, ollama, generateModel, *source, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("summarize: %v", err)
+	}
+
+	fmt.Printf("From %d chunks:\n\n", summary.Chunks)
+	fmt.Print(RenderSourceSummaryMarkdown(summary))
+	fmt.Printf("Stored as %s\n", summary.SourceFile)
+}
+
+func runCondense(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("condense", flag.ExitOnError)
+	source := fs.String("source", "", "glob of watch batch sources to condense, e.g. 'watch://<session>/*' (required)")
+	minAge := fs.Duration("min-age", defaultCondenseMinAge, "skip sessions with a batch newer than this (still active)")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	if *source == "" {
+		fmt.Fprintf(os.Stderr, "Error: --source is required\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	progress := NewProgress("Condensing")
+	sessions, err := Condense(ctx, db, ollama, generateModel, *source, *minAge, time.Now(), progress.Func())
+	progress.Finish()
+	for _, s := range sessions {
+		fmt.Printf("%s: %d batches, %d chunks → %d chunks in %s\n", s.Session, s.Batches, s.Before, s.After, s.SourceFile)
+	}
+	if err != nil {
+		log.Fatalf("condense: %v", err)
+	}
+	if len(sessions) == 0 {
+		fmt.Printf("No finished sessions match %s.\n", *source)
+	}
+}
+
+func runReview(args []string, mnemeDB string) {
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	week := fs.String("week", "", "ISO week to review, e.g. 2025-W23 (default this week)")
+	out := fs.String("out", "", "write the review to this markdown file instead of stdout")
+	jsonOut := fs.Bool("json", jsonOutput, "print the review as JSON")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+
+	label := *week
+	if label == "" {
+		label = ISOWeekLabel(time.Now().In(mnemeLocation))
+	}
+	monday, err := ParseISOWeek(label)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	review, err := BuildWeeklyReview(db, monday)
+	if err != nil {
+		log.Fatalf("review: %v", err)
+	}
+	if review.Empty() {
+		fmt.Fprintf(os.Stderr, "Nothing to review for %s. Run digest, consolidate or importance first.\n", review.Week)
+	}
+
+	switch {
+	case *jsonOut:
+		payload, err := json.MarshalIndent(review, "", "  ")
+		if err != nil {
+			log.Fatalf("encode review: %v", err)
+		}
+		fmt.Println(string(payload))
+	case *out != "":
+		if err := WriteReviewFile(*out, review); err != nil {
+			log.Fatalf("write review: %v", err)
+		}
+		fmt.Printf("Wrote %s (%d summaries, %d decisions, %d new entities, %d quotes)\n",
+			*out, len(review.Summaries), len(review.Decisions), len(review.NewEntities), len(review.Quotes))
+	default:
+		fmt.Print(RenderReviewMarkdown(review))
+	}
+}
+
+func runProfile(args []string, mnemeDB, ollamaHost, embedModel, generateModel string) {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	cached := fs.Bool("cached", false, "show the cached profile without asking the generate model")
+	rebuild := fs.Bool("rebuild", false, "rebuild the profile from every chunk instead of only new ones")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	if fs.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "Error: entity name required as first positional argument\n")
+		os.Exit(1)
+	}
+
+	db, err := InitDB(mnemeDB)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	var profile *EntityProfile
+	if *cached {
+		profile, err = LoadProfile(db, fs.Arg(0))
+		if err != nil {
+			log.Fatalf("load profile: %v", err)
+		}
+		if profile == nil {
+			fmt.Printf("No cached profile for %s. Run without --cached to build one.\n", fs.Arg(0))
+			return
+		}
+	} else {
+		ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+		progress := NewProgress("Profiling")
+		var folded int
+		profile, folded, err = RefreshProfile(ctx, db, ollama, generateModel, fs.Arg(0), *rebuild, progress.Func())
+		progress.Finish()
+		if err != nil {
+			log.Fatalf("profile: %v", err)
+		}
+		if folded > 0 {
+			fmt.Printf("Folded %d new chunks into the profile.\n\n", folded)
+		}
+	}
+
+	fmt.Printf("%s\n", profile.Entity)
+	fmt.Printf("  from %d chunks, updated %s\n", profile.Chunks, profile.UpdatedAt)
+	fmt.Println("\nKey facts:")
+	for _, f := range profile.KeyFacts {
+		fmt.Printf("  • %s\n", f)
+	}
+	fmt.Println("\nRecent events:")
+	for _, e := range profile.RecentEvents {
+		fmt.Printf("  [%s] %s\n", dateLabel(e.Date), e.Event)
+	}
+	fmt.Println("\nOpen threads:")
+	for _, t := range profile.OpenThreads {
+		fmt.Printf("  • %s\n", t)
+	}
+}
+
+func runStrip(args []string) {
+	fs := flag.NewFlagSet("strip", flag.ExitOnError)
+	file := fs.String("file", "", "transcript to strip (required)")
+	patternFile := fs.String("pattern-file", "", "extra patterns to try, one regular expression per line")
+	builtin := fs.Bool("builtin", true, "run the built-in patterns (and MNEME_NOISE_PATTERNS) first")
+	quiet := fs.Bool("quiet", false, "list the matches without printing the stripped text")
+
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	if *file == "" {
+		fmt.Fprintf(os.Stderr, "Error: --file is required\n")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatalf("read file: %v", err)
+	}
+
+	var patterns []*regexp.Regexp
+	var labels []string
+	add := func(source string, list []*regexp.Regexp) {
+		for i, p := range list {
+			patterns = append(patterns, p)
+			labels = append(labels, fmt.Sprintf("%s #%d", source, i+1))
+		}
+	}
+	if *builtin {
+		add("built-in", noisePatterns)
+		add("MNEME_NOISE_PATTERNS", customNoisePatterns)
+	}
+	if *patternFile != "" {
+		extra, err := readNoisePatterns(*patternFile)
+		if err != nil {
+			log.Fatalf("pattern file: %v", err)
+		}
+		add(filepath.Base(*patternFile), extra)
+	}
+	if len(patterns) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no patterns to run\n")
+		os.Exit(1)
+	}
+
+	text := string(data)
+	stripped, matches := explainNoise(text, patterns)
+	if len(matches) == 0 {
+		fmt.Printf("No noise found in %s by %d patterns.\n", *file, len(patterns))
+	} else {
+		fmt.Printf("%d removals in %s:\n", len(matches), *file)
+	}
+	for _, m := range matches {
+		fmt.Printf("\n  line %d:%d  %s  (%d bytes)  %s\n", m.Line, m.Column, labels[m.Index-1], m.End-m.Start, m.Pattern)
+		preview := strings.Split(strings.TrimRight(m.Text, "\n"), "\n")
+		for i, line := range preview {
+			if i == 3 {
+				fmt.Printf("    - ... %d more lines\n", len(preview)-3)
+				break
+			}
+			fmt.Printf("    - %s\n", truncate(line, 100))
+		}
+	}
+
+	fmt.Printf("\nBefore: %d lines, %d bytes\n", strings.Count(strings.TrimRight(text, "\n"), "\n")+1, len(text))
+	fmt.Printf("After:  %d lines, %d bytes\n", strings.Count(stripped, "\n")+1, len(stripped))
+	if !*quiet {
+		fmt.Println("\n" + strings.Repeat("─", 40))
+		fmt.Println(stripped)
+	}
+}
+
+func runTypos(args []string, mnemeDB string) {
+	usage := "Usage: mneme typos list | add <typo> <correction> | rm <typo>... | learn [--session id] [--apply]\n"
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		typosMutex.RLock()
+		typos := make([]string, 0, len(customTypos))
+		for typo, correct := range customTypos {
+			typos = append(typos, fmt.Sprintf("%s → %s", typo, correct))
+		}
+		typosMutex.RUnlock()
+		if len(typos) == 0 {
+			fmt.Printf("No custom typos in %s.\n", getTyposPath())
+			return
+		}
+		sort.Strings(typos)
+		fmt.Printf("%d custom typos in %s:\n", len(typos), getTyposPath())
+		for _, line := range typos {
+			fmt.Println("  " + line)
+		}
+	case "add":
+		if len(args) != 3 || strings.TrimSpace(args[1]) == "" || strings.TrimSpace(args[2]) == "" {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(1)
+		}
+		typo, correct := strings.TrimSpace(args[1]), strings.TrimSpace(args[2])
+		if err := updateTyposFile(map[string]string{typo: correct}); err != nil {
+			log.Fatalf("update typos: %v", err)
+		}
+		fmt.Printf("Added %s → %s to %s.\n", typo, correct, getTyposPath())
+	case "rm":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(1)
+		}
+		removed := 0
+		typosMutex.RLock()
+		for _, typo := range args[1:] {
+			if _, ok := customTypos[typo]; ok {
+				removed++
+			}
+		}
+		typosMutex.RUnlock()
+		if err := updateTyposFile(nil, args[1:]...); err != nil {
+			log.Fatalf("update typos: %v", err)
+		}
+		fmt.Printf("Removed %d typos from %s.\n", removed, getTyposPath())
+	case "learn":
+		fs := flag.NewFlagSet("typos learn", flag.ExitOnError)
+		session := fs.String("session", "", "only learn from this session's messages")
+		apply := fs.Bool("apply", false, "add the learned typos to the typos file")
+		if err := fs.Parse(args[1:]); err != nil {
+			log.Fatalf("parse flags: %v", err)
+		}
+
+		db, err := InitDB(mnemeDB)
+		if err != nil {
+			log.Fatalf("init db: %v", err)
+		}
+		defer db.Close()
+
+		learned, err := LearnTypos(db, *session)
+		if err != nil {
+			log.Fatalf("learn typos: %v", err)
+		}
+		if len(learned) == 0 {
+			fmt.Println("No new typos found. Corrections are learned from follow-up messages like \"*receive\" or \"s/recieve/receive/\".")
+			return
+		}
+		typos := make([]string, 0, len(learned))
+		for typo := range learned {
+			typos = append(typos, typo)
+		}
+		sort.Strings(typos)
+		for _, typo := range typos {
+			fmt.Printf("  %s → %s\n", typo, learned[typo])
+		}
+		if !*apply {
+			fmt.Println("\nRun with --apply to add these, or add the ones you agree with via `mneme typos add`.")
+			return
+		}
+		if err := updateTyposFile(learned); err != nil {
+			log.Fatalf("update typos: %v", err)
+		}
+		fmt.Printf("\nAdded %d typos to %s.\n", len(learned), getTyposPath())
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func runReembed(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("reembed", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(ingestTimeout)
+	defer cancel()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+	if err := ValidateEmbedDimension(ctx, ollama); err != nil {
+		log.Fatalf("%v", err)
+	}
+	// Skips the dimension check: a mismatch is what this command fixes
+	db, err := initDB(mnemeDB, false)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	fmt.Printf("Re-embedding with %s (%d dimensions)...\n", embedModel, EmbedDimension)
+	progress := NewProgress("Embedding")
+	result, err := Reembed(ctx, db, ollama, progress.Func())
+	progress.Finish()
+	if err != nil {
+		log.Fatalf("reembed: %v (run it again to resume)", err)
+	}
+	if result.Resumed > 0 {
+		fmt.Printf("Resumed with %d embeddings from an interrupted run.\n", result.Resumed)
+	}
+	fmt.Printf("Re-embedded %d chunks, %d messages and %d facts, and summed %d threads again.\n", result.Chunks, result.Messages, result.Facts, result.Threads)
+}
+
+func runStatus(args []string, mnemeDB, ollamaHost, embedModel string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		log.Fatalf("parse flags: %v", err)
+	}
+	ctx, cancel := commandContext(searchTimeout)
+	defer cancel()
+
+	// Skips the embedding checks so a mismatch is reported rather than fatal
+	db, err := initDB(mnemeDB, false)
+	if err != nil {
+		log.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
+
+	// Get status
+	status := Status(ctx, db, ollama, embedModel)
+	if jsonOutput {
+		printJSON(status)
+		return
+	}
+
+	// Format output
+	fmt.Println("Mneme Status")
+	fmt.Println("─────────────")
+
+	ollamaStatus := "unhealthy"
+	if status.OllamaHealthy {
+		ollamaStatus = "healthy"
+	}
+	fmt.Printf("Ollama:      %s (%s)\n", ollamaStatus, ollamaHost)
+	fmt.Printf("Embed Model: %s (%d dimensions)\n", status.EmbedModel, EmbedDimension)
+	if stored := status.StoredEmbedding; stored.Model != "" {
+		fmt.Printf("Embedded:    %s (%d dimensions)\n", stored.Model, stored.Dimension)
+		if status.EmbeddingMismatch() {
+			fmt.Println("             ⚠ differs from the configured model; run `mneme reembed`")
+		}
+	}
+	fmt.Printf("sqlite-vec:  %s\n", status.SqliteVecVersion)
+	fmt.Printf("Chunks:      %d\n", status.TotalChunks)
+
+	dateRange := "none"
+	if status.EarliestValidAt != "" && status.LatestValidAt != "" {
+		dateRange = fmt.Sprintf("%s → %s", status.EarliestValidAt, status.LatestValidAt)
+	} else if status.EarliestValidAt != "" {
+		dateRange = status.EarliestValidAt
+	}
+	fmt.Printf("Date Range:  %s\n", dateRange)
+}
+
+func runServe(args []string, mnemeDB, ollamaHost, embedModel, generateModel, rerankModel string) {
 	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics on this address, e.g. :9464")
 	if err := fs.Parse(args); err != nil {
 		log.Fatalf("parse flags: %v", err)
 	}
 
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
 	// Initialize DB and Ollama
 	db, err := InitDB(mnemeDB)
 	if err != nil {
@@ -404,7 +3583,7 @@ func runServe(args []string, mnemeDB, ollamaHost, embedModel string) {
 
 	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
 
-	if err := RunMCPServer(db, ollama, embedModel); err != nil {
+	if err := RunMCPServer(db, ollama, embedModel, generateModel, rerankModel); err != nil {
 		log.Fatalf("run MCP server: %v", err)
 	}
 }
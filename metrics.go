@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics are kept in memory by every process and exposed in the Prometheus text format
+// by the long-running ones (serve and the watchers) when given --metrics.
+
+// counter is a monotonically increasing value, optionally split by one label.
+type counter struct {
+	name, help, label string
+	mu                sync.Mutex
+	values            map[string]float64
+}
+
+func (c *counter) add(labelValue string, delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]float64)
+	}
+	c.values[labelValue] += delta
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if c.label == "" {
+		fmt.Fprintf(w, "%s %s\n", c.name, formatMetric(c.values[""]))
+		return
+	}
+	labels := make([]string, 0, len(c.values))
+	for value := range c.values {
+		labels = append(labels, value)
+	}
+	sort.Strings(labels)
+	for _, value := range labels {
+		fmt.Fprintf(w, "%s{%s=%q} %s\n", c.name, c.label, value, formatMetric(c.values[value]))
+	}
+}
+
+// gauge is a value that goes up and down.
+type gauge struct {
+	name, help string
+	mu         sync.Mutex
+	value      float64
+}
+
+func (g *gauge) set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+}
+
+func (g *gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatMetric(g.value))
+}
+
+// histogram counts observations into cumulative buckets by upper bound.
+type histogram struct {
+	name, help string
+	bounds     []float64
+	mu         sync.Mutex
+	counts     []uint64
+	sum        float64
+	total      uint64
+}
+
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(h.bounds))
+	}
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.total++
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, bound := range h.bounds {
+		var count uint64
+		if h.counts != nil {
+			count = h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.name, formatMetric(bound), count)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %s\n%s_count %d\n", h.name, h.total, h.name, formatMetric(h.sum), h.name, h.total)
+}
+
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// latencyBuckets suit model calls, from a cached embedding to a slow generation.
+var latencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	chunksIngested = &counter{name: "mneme_chunks_ingested_total", help: "Chunks stored by ingest, watcher batches and generated summaries."}
+	messagesStored = &counter{name: "mneme_messages_ingested_total", help: "Messages stored by the watchers."}
+	ollamaErrors   = &counter{name: "mneme_ollama_errors_total", help: "Failed Ollama requests by endpoint.", label: "endpoint"}
+	embedLatency   = &histogram{name: "mneme_embed_duration_seconds", help: "Time taken by Ollama embedding requests.", bounds: latencyBuckets}
+	generateTime   = &histogram{name: "mneme_generate_duration_seconds", help: "Time taken by Ollama generate requests.", bounds: latencyBuckets}
+	searchLatency  = &histogram{name: "mneme_search_duration_seconds", help: "Time taken by chunk and message searches, embedding included.", bounds: latencyBuckets}
+	watcherLag     = &gauge{name: "mneme_watcher_lag_seconds", help: "How long the oldest message of the last watcher batch waited before it was stored."}
+)
+
+var allMetrics = []interface{ write(io.Writer) }{
+	chunksIngested, messagesStored, ollamaErrors, embedLatency, generateTime, searchLatency, watcherLag,
+}
+
+// recordOllamaCall times an Ollama request and counts it as an error when it failed for
+// any reason other than the caller giving up.
+func recordOllamaCall(endpoint string, latency *histogram, start time.Time, err error) {
+	latency.observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, context.Canceled) {
+		ollamaErrors.add(endpoint, 1)
+	}
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	var b strings.Builder
+	for _, m := range allMetrics {
+		m.write(&b)
+	}
+	io.WriteString(w, b.String())
+}
+
+// serveMetrics exposes /metrics on addr in the background. Listening happens before it
+// returns, so a taken port is reported to the caller.
+func serveMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Printf("Warning: metrics server stopped: %v", err)
+		}
+	}()
+	return nil
+}
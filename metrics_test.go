@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := &histogram{name: "test_seconds", help: "Test.", bounds: []float64{0.1, 1}}
+	h.observe(0.05)
+	h.observe(0.5)
+	h.observe(3)
+
+	var b strings.Builder
+	h.write(&b)
+	for _, want := range []string{
+		`test_seconds_bucket{le="0.1"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		`test_seconds_sum 3.55`,
+		`test_seconds_count 3`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("expected %q in\n%s", want, b.String())
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	embedErrors := func() float64 {
+		ollamaErrors.mu.Lock()
+		defer ollamaErrors.mu.Unlock()
+		return ollamaErrors.values["embed"]
+	}
+	failures := embedErrors()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+	if _, err := client.Embed(context.Background(), "hello"); err == nil {
+		t.Fatal("expected the embedding to fail")
+	}
+	// A caller giving up is not an Ollama error
+	recordOllamaCall("embed", embedLatency, time.Now(), context.Canceled)
+	if got := embedErrors(); got != failures+1 {
+		t.Fatalf("expected one more embed error, got %v after %v", got, failures)
+	}
+
+	rec := httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		"# TYPE mneme_chunks_ingested_total counter",
+		`mneme_ollama_errors_total{endpoint="embed"}`,
+		"# TYPE mneme_embed_duration_seconds histogram",
+		"# TYPE mneme_search_duration_seconds histogram",
+		"# TYPE mneme_watcher_lag_seconds gauge",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("expected %q in\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// extractionKindNames marks chunks in chunk_extractions once name detection has run.
+const extractionKindNames = "names"
+
+// entityNameDetection makes ingest link the capitalized names in new chunks as entities
+// (MNEME_ENTITY_NAMES, on by default), so history finds them by entity without a model.
+var entityNameDetection = true
+
+func loadEntityNameDetection() error {
+	if value := os.Getenv("MNEME_ENTITY_NAMES"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MNEME_ENTITY_NAMES: %w", err)
+		}
+		entityNameDetection = enabled
+	}
+	return nil
+}
+
+// nameStopwords are capitalized words that are not names: days, months, titles, and the
+// pronouns and openers that start sentences. They split a run of capitalized words.
+var nameStopwords = make(map[string]bool)
+
+func init() {
+	for _, word := range strings.Fields(`
+		monday tuesday wednesday thursday friday saturday sunday
+		january february march april may june july august september october november december
+		mr mrs ms dr prof sir madam
+		i i'm i've i'll i'd
+		a an the this that these those there here it it's its
+		he she we they you me us them him her his our my your their
+		and but or so if then when while after before since because although though once
+		yesterday today tomorrow tonight last next every each some many most all any no yes not
+		also still just now maybe perhaps please thanks thank hi hello hey dear ok okay
+		what why how who where which
+		note todo done update meeting notes summary`) {
+		nameStopwords[word] = true
+	}
+}
+
+// detectEntityNames finds what look like names in text: runs of capitalized words
+// ("Ada Lovelace", "Project Atlas") anywhere, and single capitalized words ("Postgres")
+// that don't merely start a sentence. All-caps words, headings and stopwords are left
+// out. Names come back once each, in the spelling first seen.
+func detectEntityNames(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var run []string
+	runAtStart, sentenceStart := false, true
+	flush := func() {
+		if len(run) >= 2 || (len(run) == 1 && !runAtStart) {
+			name := cleanEntityName(strings.Join(run, " "))
+			if key := strings.ToLower(name); name != "" && !seen[key] {
+				seen[key] = true
+				names = append(names, name)
+			}
+		}
+		run = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		flush()
+		sentenceStart = true
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for i := 0; i < len(line); {
+			r, size := utf8.DecodeRuneInString(line[i:])
+			if !isWordRune(r) {
+				switch {
+				case strings.ContainsRune(".!?:", r):
+					flush()
+					sentenceStart = true
+				case r != ' ' || (i+size < len(line) && line[i+size] == ' '):
+					// Anything but a single space ends the run
+					flush()
+				}
+				i += size
+				continue
+			}
+			end := i + size
+			for end < len(line) {
+				r, size := utf8.DecodeRuneInString(line[end:])
+				if !isWordRune(r) {
+					// Apostrophes and hyphens inside a word keep it whole
+					next, _ := utf8.DecodeRuneInString(line[end+size:])
+					if !strings.ContainsRune("'’-", r) || !isWordRune(next) {
+						break
+					}
+				}
+				end += size
+			}
+			word := strings.TrimSuffix(strings.TrimSuffix(line[i:end], "'s"), "’s")
+			if capitalizedWord(word) && !nameStopwords[strings.ToLower(word)] {
+				if len(run) == 0 {
+					runAtStart = sentenceStart
+				}
+				run = append(run, word)
+			} else {
+				flush()
+			}
+			sentenceStart = false
+			i = end
+		}
+	}
+	flush()
+	return names
+}
+
+// capitalizedWord reports whether word starts with an upper-case letter and has lower-case
+// ones after it, as names do and acronyms ("API") and "I" don't.
+func capitalizedWord(word string) bool {
+	first, size := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(first) && strings.IndexFunc(word[size:], unicode.IsLower) >= 0
+}
+
+// DetectEntityNames runs detectEntityNames over the given chunks and adds the names that
+// are not yet entities or aliases, without a kind, then links them in those chunks and in
+// older ones mentioning them, found in one pass over the word index. An LLM pass
+// (ExtractEntities) later types the ones it agrees with.
+func DetectEntityNames(db *sql.DB, chunkIDs []int64) (EntityExtractionResult, error) {
+	var result EntityExtractionResult
+	var linksBefore int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM chunk_entities`).Scan(&linksBefore); err != nil {
+		return result, err
+	}
+
+	found := make(map[string]bool)
+	var newEntities []entityName
+	for _, chunkID := range chunkIDs {
+		var text string
+		if err := db.QueryRow(`SELECT text FROM chunks WHERE id = ?`, chunkID).Scan(&text); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return result, fmt.Errorf("read chunk %d: %w", chunkID, err)
+		}
+		var created []entityName
+		err := withWriteTx(db, "detect names", func(tx *sql.Tx) error {
+			created = created[:0]
+			for _, name := range detectEntityNames(text) {
+				found[strings.ToLower(name)] = true
+				var known bool
+				if err := tx.QueryRow(
+					`SELECT EXISTS(SELECT 1 FROM entities WHERE name = ?) OR EXISTS(SELECT 1 FROM entity_aliases WHERE alias = ?)`,
+					name, name,
+				).Scan(&known); err != nil {
+					return err
+				}
+				if known {
+					continue
+				}
+				id, _, err := upsertEntity(tx, name, "")
+				if err != nil {
+					return err
+				}
+				created = append(created, entityName{id: id, name: name})
+			}
+			return markExtracted(tx, chunkID, extractionKindNames)
+		})
+		if err != nil {
+			return result, err
+		}
+		newEntities = append(newEntities, created...)
+		result.ChunksProcessed++
+	}
+
+	// Names known already are linked by the mention index; new ones wherever they appear,
+	// so history keeps finding older chunks once a name resolves to an entity
+	if len(newEntities) > 0 {
+		var newNames []string
+		for _, e := range newEntities {
+			newNames = append(newNames, e.name)
+		}
+		candidates, err := chunksMentioning(db, newNames)
+		if err != nil {
+			return result, fmt.Errorf("find names: %w", err)
+		}
+		for start := 0; start < len(candidates); start += reindexBatchSize {
+			batch := candidates[start:min(start+reindexBatchSize, len(candidates))]
+			err := withWriteTx(db, "link names", func(tx *sql.Tx) error {
+				return indexChunkMentionsTx(tx, batch, newEntities)
+			})
+			if err != nil {
+				return result, fmt.Errorf("link names: %w", err)
+			}
+		}
+	}
+
+	var linksAfter int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM chunk_entities`).Scan(&linksAfter); err != nil {
+		return result, err
+	}
+	result.EntitiesFound = len(found)
+	result.LinksCreated = linksAfter - linksBefore
+	return result, nil
+}
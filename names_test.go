@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDetectEntityNames(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"Lunch with Ada Lovelace and Priya at the Old Mill.", []string{"Ada Lovelace", "Priya", "Old Mill"}},
+		{"We moved the ledger to Postgres. Postgres handles it.", []string{"Postgres"}},
+		{"Project Atlas ships on Monday.", []string{"Project Atlas"}},
+		// A lone capital at a sentence start is only a capital
+		{"Deploys are frozen. Rollbacks too.", nil},
+		{"## Meeting Notes\n\nThe API and SQL work is done, I think.", nil},
+		{"Ask Dr Okafor about Priya's visa; Priya knows.", []string{"Okafor", "Priya"}},
+		{"Tested on GitHub, then on Hacker-News: fine.", []string{"GitHub", "Hacker-News"}},
+		{"Yesterday Sam Reyes called, Sam again today.", []string{"Sam Reyes", "Sam"}},
+	}
+	for _, c := range cases {
+		if got := detectEntityNames(c.text); fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("detectEntityNames(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestDetectEntityNamesAtIngest(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+	withNearDuplicateThreshold(t, 0)
+
+	old := insertChunk(t, db, "an early note that mentions kestrel in passing", "old.md", "Early", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1}))
+	if _, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES ('Robert Smith', 'person', '2024-01-01')`); err != nil {
+		t.Fatalf("insert entity: %v", err)
+	}
+	db.Exec(`INSERT INTO entity_aliases (alias, entity_id) SELECT 'Bob', id FROM entities WHERE name = 'Robert Smith'`)
+
+	md := "## Plans\n\nThe Kestrel rollout starts when Bob is back.\n"
+	if _, err := IngestMarkdown(context.Background(), db, client, "plans.md", strings.NewReader(md), "2024-02-01", defaultChunking, nil); err != nil {
+		t.Fatalf("IngestMarkdown: %v", err)
+	}
+
+	entities, err := ListEntities(db, "", "", "", 0)
+	if err != nil {
+		t.Fatalf("ListEntities: %v", err)
+	}
+	var names []string
+	for _, e := range entities {
+		names = append(names, e.Name)
+	}
+	if fmt.Sprint(names) != "[Kestrel Robert Smith]" {
+		t.Fatalf("expected Kestrel added and Bob left to its entity, got %v", names)
+	}
+
+	// The new entity is linked where it was found and in the older chunk mentioning it
+	var linked int
+	db.QueryRow(`SELECT COUNT(*) FROM chunk_entities ce JOIN entities e ON e.id = ce.entity_id WHERE e.name = 'Kestrel'`).Scan(&linked)
+	if linked != 2 {
+		t.Fatalf("expected both chunks linked, got %d", linked)
+	}
+	results, err := History(db, "kestrel", 10)
+	if err != nil || len(results) != 2 || results[0].ID != int(old) {
+		t.Fatalf("expected both chunks by entity, oldest first, got %+v, %v", results, err)
+	}
+	if results, _ := History(db, "Robert Smith", 10); len(results) != 1 {
+		t.Fatalf("expected the alias mention linked, got %+v", results)
+	}
+
+	pending, err := pendingExtractionChunks(db, extractionKindNames, "")
+	if err != nil || len(pending) != 1 || pending[0] != old {
+		t.Fatalf("expected only the chunk from before to be pending, got %v, %v", pending, err)
+	}
+
+	entityNameDetection = false
+	defer func() { entityNameDetection = true }()
+	if _, err := IngestMarkdown(context.Background(), db, client, "more.md", strings.NewReader("## More\n\nThen we call Marguerite.\n"), "", defaultChunking, nil); err != nil {
+		t.Fatalf("IngestMarkdown: %v", err)
+	}
+	if _, err := findEntityID(db, "Marguerite"); err == nil {
+		t.Fatal("expected no names detected with detection off")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// noisePatterns match the agent scaffolding that watchers strip from session text before
+// it is stored: mode banners, system reminders, background-task notices.
+var noisePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?s)\[search-mode\].*?---\s*\n`),
+	regexp.MustCompile(`(?s)\[analyze-mode\].*?---\s*\n`),
+	regexp.MustCompile(`(?s)\[SYSTEM DIRECTIVE[^\]]*\].*?(?:\[Status:[^\]]*\])`),
+	regexp.MustCompile(`(?s)# Continuation Prompt.*`),
+	regexp.MustCompile(`\(sisyphus\)\s*`),
+	regexp.MustCompile(`\(prometheus\)\s*`),
+	regexp.MustCompile(`\(oracle\)\s*`),
+	regexp.MustCompile(`(?s)\[BACKGROUND TASK COMPLETED\].*?\n`),
+	regexp.MustCompile(`(?s)\[Agent Usage Reminder\].*?(?:\n\n|\z)`),
+	regexp.MustCompile(`(?s)\[Category\+Skill Reminder\].*?(?:\n\n|\z)`),
+	regexp.MustCompile(`(?s)<system-reminder>.*?</system-reminder>`),
+	regexp.MustCompile(`(?s)\[ALL BACKGROUND TASKS COMPLETE\].*?(?:\n\n|\z)`),
+	regexp.MustCompile(`(?s)\[SYSTEM REMINDER[^\]]*\].*?(?:\n\n|\z)`),
+}
+
+// customNoisePatterns are loaded from the MNEME_NOISE_PATTERNS file and run after the
+// built-in ones.
+var customNoisePatterns []*regexp.Regexp
+
+// loadNoisePatterns reads the MNEME_NOISE_PATTERNS file, if one is set.
+func loadNoisePatterns() error {
+	path := os.Getenv("MNEME_NOISE_PATTERNS")
+	if path == "" {
+		return nil
+	}
+	patterns, err := readNoisePatterns(path)
+	if err != nil {
+		return fmt.Errorf("MNEME_NOISE_PATTERNS: %w", err)
+	}
+	customNoisePatterns = patterns
+	return nil
+}
+
+// readNoisePatterns reads a pattern file: one Go regular expression per line, with blank
+// lines and lines starting with # skipped.
+func readNoisePatterns(path string) ([]*regexp.Regexp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
+
+func stripNoise(text string) string {
+	for _, p := range noisePatterns {
+		text = p.ReplaceAllString(text, "")
+	}
+	for _, p := range customNoisePatterns {
+		text = p.ReplaceAllString(text, "")
+	}
+	return strings.TrimSpace(text)
+}
+
+// NoiseMatch is one stretch of text a noise pattern removed.
+type NoiseMatch struct {
+	Pattern string
+	// Index is the pattern's position in the list it came from, counting from 1.
+	Index int
+	// Start and End are byte offsets into the original text; Line and Column (1-based)
+	// locate Start.
+	Start, End   int
+	Line, Column int
+	Text         string
+}
+
+// explainNoise strips text the way stripNoise does with patterns, run in order, and
+// reports every removal in terms of the original text.
+func explainNoise(text string, patterns []*regexp.Regexp) (string, []NoiseMatch) {
+	// offsets[i] is where byte i of the current text sat in the original
+	offsets := make([]int, len(text))
+	for i := range offsets {
+		offsets[i] = i
+	}
+	current := text
+	var matches []NoiseMatch
+	for i, p := range patterns {
+		locs := p.FindAllStringIndex(current, -1)
+		if len(locs) == 0 {
+			continue
+		}
+		var kept strings.Builder
+		keptOffsets := make([]int, 0, len(offsets))
+		last := 0
+		for _, loc := range locs {
+			if loc[1] > loc[0] {
+				start, end := offsets[loc[0]], offsets[loc[1]-1]+1
+				line, column := lineColumn(text, start)
+				matches = append(matches, NoiseMatch{
+					Pattern: p.String(), Index: i + 1,
+					Start: start, End: end, Line: line, Column: column,
+					Text: current[loc[0]:loc[1]],
+				})
+			}
+			kept.WriteString(current[last:loc[0]])
+			keptOffsets = append(keptOffsets, offsets[last:loc[0]]...)
+			last = loc[1]
+		}
+		kept.WriteString(current[last:])
+		current, offsets = kept.String(), append(keptOffsets, offsets[last:]...)
+	}
+	return strings.TrimSpace(current), matches
+}
+
+// lineColumn returns the 1-based line and column (in runes) of byte offset in text.
+func lineColumn(text string, offset int) (int, int) {
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	lineStart := strings.LastIndex(before, "\n") + 1
+	return line, len([]rune(before[lineStart:])) + 1
+}
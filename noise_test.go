@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExplainNoise(t *testing.T) {
+	text := "Fix the login bug\n<system-reminder>be brief</system-reminder>\n(sisyphus) on it\nDONE [x]\nand ship it"
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`(?s)<system-reminder>.*?</system-reminder>`),
+		regexp.MustCompile(`\(sisyphus\)\s*`),
+		regexp.MustCompile(`DONE \[x\]\n`),
+	}
+	stripped, matches := explainNoise(text, patterns)
+	want := "Fix the login bug\n\non it\nand ship it"
+	if stripped != want {
+		t.Fatalf("expected %q, got %q", want, stripped)
+	}
+	if len(matches) != 3 {
+		t.Fatalf("expected 3 matches, got %+v", matches)
+	}
+	// Offsets point into the original text, even after earlier patterns removed text
+	for _, m := range matches {
+		if text[m.Start:m.End] != m.Text {
+			t.Fatalf("match %+v doesn't line up with the original", m)
+		}
+	}
+	if m := matches[2]; m.Index != 3 || m.Line != 4 || m.Column != 1 {
+		t.Fatalf("expected the third pattern at 4:1, got %+v", m)
+	}
+	if m := matches[1]; m.Line != 3 || m.Column != 1 {
+		t.Fatalf("expected the second pattern at 3:1, got %+v", m)
+	}
+
+	// Same result as the watchers' stripping
+	sample := "hello <system-reminder>x</system-reminder> (oracle) world"
+	if got, _ := explainNoise(sample, noisePatterns); got != stripNoise(sample) {
+		t.Fatalf("expected explainNoise to agree with stripNoise, got %q and %q", got, stripNoise(sample))
+	}
+}
+
+func TestReadNoisePatterns(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "noise.txt")
+	os.WriteFile(path, []byte("# tool banners\n\\[tool:[a-z]+\\]\\s*\n\n(?m)^>>> .*$\n"), 0o644)
+	patterns, err := readNoisePatterns(path)
+	if err != nil || len(patterns) != 2 {
+		t.Fatalf("expected 2 patterns, got %d, %v", len(patterns), err)
+	}
+
+	bad := filepath.Join(dir, "bad.txt")
+	os.WriteFile(bad, []byte("ok\n[unclosed\n"), 0o644)
+	if _, err := readNoisePatterns(bad); err == nil || !strings.Contains(err.Error(), "bad.txt:2") {
+		t.Fatalf("expected the bad line reported, got %v", err)
+	}
+
+	previous := customNoisePatterns
+	defer func() { customNoisePatterns = previous }()
+	t.Setenv("MNEME_NOISE_PATTERNS", path)
+	if err := loadNoisePatterns(); err != nil {
+		t.Fatalf("loadNoisePatterns: %v", err)
+	}
+	if got := stripNoise("[tool:grep] found it\n>>> debug line"); got != "found it" {
+		t.Fatalf("expected custom patterns applied, got %q", got)
+	}
+}
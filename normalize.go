@@ -2,42 +2,227 @@ package main
 
 import (
 	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/client9/misspell"
 )
 
 var normalizer *misspell.Replacer
 var customTypos map[string]string
+
+// customTypoPatterns match each custom typo as a whole word, in any case.
+var customTypoPatterns map[string]*regexp.Regexp
 var typosMutex sync.RWMutex
 
+// normalizeEnabled turns spell correction on (MNEME_NORMALIZE). It is off by default:
+// corrections only ever feed embeddings, but a wrong one still skews what is found.
+var normalizeEnabled bool
+
+// protectedWords are never corrected, compared case-insensitively (MNEME_PROTECTED_WORDS).
+var protectedWords map[string]bool
+
+// spellBase picks the built-in corrections the spell model starts from (MNEME_SPELL_BASE):
+// "en" for misspell's English list, or "none" to rely on loaded dictionaries alone.
+var spellBase = "en"
+
+// dictionaryCorrections (lowercase typo to correction) and dictionaryWords (known-good
+// words) are loaded from MNEME_DICTIONARIES.
+var dictionaryCorrections map[string]string
+var dictionaryWords map[string]bool
+
+// dictionaryWordPattern splits text into words in any script for dictionary corrections,
+// which misspell (ASCII only) can't apply to words like "wärend".
+var dictionaryWordPattern = regexp.MustCompile(`[\p{L}\p{M}\p{N}_']+`)
+
 func init() {
 	normalizer = misspell.New()
+}
+
+// loadNormalization reads MNEME_NORMALIZE, MNEME_PROTECTED_WORDS (comma-separated),
+// MNEME_SPELL_BASE and MNEME_DICTIONARIES, and builds the spell model from them.
+func loadNormalization() error {
+	if value := os.Getenv("MNEME_NORMALIZE"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MNEME_NORMALIZE: %w", err)
+		}
+		normalizeEnabled = enabled
+	}
+	switch base := os.Getenv("MNEME_SPELL_BASE"); base {
+	case "", "en":
+		spellBase = "en"
+	case "none":
+		spellBase = "none"
+	default:
+		return fmt.Errorf("MNEME_SPELL_BASE: unknown base %q (want en or none)", base)
+	}
+	var paths []string
+	for _, path := range filepath.SplitList(os.Getenv("MNEME_DICTIONARIES")) {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if err := loadDictionaries(paths); err != nil {
+		return err
+	}
+	setProtectedWords(strings.Split(os.Getenv("MNEME_PROTECTED_WORDS"), ","))
 	loadCustomTypos()
+	return nil
 }
 
-func getTyposPath() string {
-	exe, err := os.Executable()
-	if err != nil {
-		return "typos.txt"
+// loadDictionaries replaces the loaded dictionaries with the files at paths. A line
+// "typo → correction" (or "typo -> correction") corrects a single word; any other line is
+// a word known to be spelled right, which is never corrected. Blank lines and lines
+// starting with # are skipped.
+func loadDictionaries(paths []string) error {
+	corrections := make(map[string]string)
+	words := make(map[string]bool)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("dictionary: %w", err)
+		}
+		before := len(corrections) + len(words)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			typo, correct, isRule := strings.Cut(line, "→")
+			if !isRule {
+				typo, correct, isRule = strings.Cut(line, "->")
+			}
+			if isRule {
+				typo, correct = strings.ToLower(strings.TrimSpace(typo)), strings.TrimSpace(correct)
+				if typo != "" && correct != "" {
+					corrections[typo] = correct
+				}
+				continue
+			}
+			words[strings.ToLower(line)] = true
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("dictionary %s: %w", path, err)
+		}
+		log.Printf("Loaded %d dictionary entries from %s", len(corrections)+len(words)-before, path)
 	}
-	return filepath.Join(filepath.Dir(exe), "typos.txt")
+
+	typosMutex.Lock()
+	defer typosMutex.Unlock()
+	dictionaryCorrections, dictionaryWords = corrections, words
+	rebuildSpellModel()
+	return nil
 }
 
-func loadCustomTypos() {
+// setProtectedWords replaces the protected words and rebuilds the spelling rules without them.
+func setProtectedWords(words []string) {
 	typosMutex.Lock()
 	defer typosMutex.Unlock()
 
-	customTypos = make(map[string]string)
+	protectedWords = make(map[string]bool)
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			protectedWords[word] = true
+		}
+	}
+	rebuildSpellModel()
+}
 
-	typosPath := getTyposPath()
-	data, err := os.ReadFile(typosPath)
+// rebuildSpellModel builds normalizer from the spell base, minus rules that would
+// correct a protected or dictionary word. Callers hold typosMutex.
+func rebuildSpellModel() {
+	var replacements []string
+	if spellBase == "en" {
+		for i := 0; i+1 < len(misspell.DictMain); i += 2 {
+			// Checked against the maps rather than with RemoveRule, which is quadratic
+			// in the size of a word list
+			if typo := misspell.DictMain[i]; !protectedWords[typo] && !dictionaryWords[typo] {
+				replacements = append(replacements, typo, misspell.DictMain[i+1])
+			}
+		}
+	}
+	normalizer = &misspell.Replacer{Replacements: replacements}
+	normalizer.Compile()
+}
+
+// applyDictionaryCorrections corrects whole words from the loaded dictionaries.
+func applyDictionaryCorrections(text string) string {
+	typosMutex.RLock()
+	defer typosMutex.RUnlock()
+
+	if len(dictionaryCorrections) == 0 {
+		return text
+	}
+	return dictionaryWordPattern.ReplaceAllStringFunc(text, func(word string) string {
+		lower := strings.ToLower(word)
+		correct, ok := dictionaryCorrections[lower]
+		if !ok || protectedWords[lower] {
+			return word
+		}
+		return matchCase(word, correct)
+	})
+}
+
+// matchCase returns correct in the case of the word it replaces: upper, title or as is.
+func matchCase(word, correct string) string {
+	switch word {
+	case strings.ToLower(word):
+		return correct
+	case strings.ToUpper(word):
+		return strings.ToUpper(correct)
+	case strings.Title(strings.ToLower(word)):
+		return strings.Title(correct)
+	}
+	return correct
+}
+
+// getTyposPath is the custom typos file: MNEME_TYPOS, else typos.txt in the mneme config
+// directory. A typos.txt next to the binary, where it used to live, is still used while the
+// config directory has none.
+func getTyposPath() string {
+	if path := os.Getenv("MNEME_TYPOS"); path != "" {
+		return path
+	}
+	configPath := "typos.txt"
+	if dir, err := os.UserConfigDir(); err == nil {
+		configPath = filepath.Join(dir, "mneme", "typos.txt")
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		return configPath
+	}
+	if exe, err := os.Executable(); err == nil {
+		legacy := filepath.Join(filepath.Dir(exe), "typos.txt")
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	return configPath
+}
+
+// readTypos reads a typos file of "typo → correction" lines. A missing file has none.
+func readTypos(path string) (map[string]string, error) {
+	typos := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return typos, nil
+	}
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	scanner := bufio.NewScanner(strings.NewReader(string(data)))
@@ -55,22 +240,53 @@ func loadCustomTypos() {
 		typo := strings.TrimSpace(parts[0])
 		correct := strings.TrimSpace(parts[1])
 		if typo != "" && correct != "" {
-			customTypos[typo] = correct
+			typos[typo] = correct
 		}
 	}
+	return typos, scanner.Err()
+}
 
-	if len(customTypos) > 0 {
-		log.Printf("Loaded %d custom typos from %s", len(customTypos), typosPath)
+func loadCustomTypos() {
+	typosPath := getTyposPath()
+	typos, err := readTypos(typosPath)
+	if err != nil {
+		log.Printf("Warning: read %s: %v", typosPath, err)
+	}
+	setCustomTypos(typos)
+
+	if len(typos) > 0 {
+		log.Printf("Loaded %d custom typos from %s", len(typos), typosPath)
 	}
 }
 
+// setCustomTypos replaces the custom typos applied by normalizeText.
+func setCustomTypos(typos map[string]string) {
+	typosMutex.Lock()
+	defer typosMutex.Unlock()
+
+	customTypos = make(map[string]string, len(typos))
+	customTypoPatterns = make(map[string]*regexp.Regexp, len(typos))
+	for typo, correct := range typos {
+		customTypos[typo] = correct
+		customTypoPatterns[typo] = regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(typo) + `\b`)
+	}
+}
+
+// normalizeText corrects common and custom typos when normalization is enabled, and
+// returns text unchanged otherwise. Only embeddings are made from the result; stored text
+// stays as written.
 func normalizeText(text string) string {
-	if text == "" {
+	if text == "" || !normalizeEnabled {
 		return text
 	}
 
-	// Apply misspell library (common typos)
-	normalized, _ := normalizer.Replace(text)
+	typosMutex.RLock()
+	replacer := normalizer
+	typosMutex.RUnlock()
+
+	// Apply the spell model (common typos), then corrections from loaded dictionaries
+	normalized, _ := replacer.Replace(text)
+	normalized = applyDictionaryCorrections(normalized)
 
 	// Apply custom typos from typos.txt
 	normalized = applyCustomTypos(normalized)
@@ -78,27 +294,195 @@ func normalizeText(text string) string {
 	return normalized
 }
 
+// normalizedVersion is the normalized_text stored beside a chunk or message: NULL when
+// normalization left the text as it was.
+func normalizedVersion(text string) sql.NullString {
+	if normalized := normalizeText(text); normalized != text {
+		return sql.NullString{String: normalized, Valid: true}
+	}
+	return sql.NullString{}
+}
+
 func applyCustomTypos(text string) string {
 	typosMutex.RLock()
 	defer typosMutex.RUnlock()
 
 	result := text
 	for typo, correct := range customTypos {
-		// Case-insensitive replacement
-		result = strings.ReplaceAll(result, typo, correct)
-		result = strings.ReplaceAll(result, strings.Title(typo), strings.Title(correct))
-		result = strings.ReplaceAll(result, strings.ToUpper(typo), strings.ToUpper(correct))
+		if protectedWords[strings.ToLower(typo)] {
+			continue
+		}
+		// Whole words only, so a typo inside a longer word or name is left alone; the
+		// correction follows the typo's case
+		result = customTypoPatterns[typo].ReplaceAllStringFunc(result, func(match string) string {
+			return matchCase(match, correct)
+		})
 	}
 
 	return result
 }
 
-// findTyposInMessages - not used with manual approach
+// starCorrection matches a chat-style follow-up correction: "*receive" or "receive*".
+var starCorrection = regexp.MustCompile(`^(?:\*([\p{L}\p{M}\p{N}_']+)|([\p{L}\p{M}\p{N}_']+)\*)$`)
+
+// sedCorrection matches a follow-up correction written as "s/recieve/receive/".
+var sedCorrection = regexp.MustCompile(`^s/([^/]+)/([^/]+)/?$`)
+
+// findTyposInMessages learns typos from corrections people make to their own messages: a
+// message that is only "*word" (or "word*") corrects the closest word, at most two edits
+// away, in the same author's previous message in the session, and "s/old/new/" replaces a
+// word that message contained. messages must be in order; it returns typo → correction.
 func findTyposInMessages(messages []textMessage) map[string]string {
-	return nil
+	typos := make(map[string]string)
+	previous := make(map[[2]string]string) // (session, role) → last message text
+	for _, m := range messages {
+		key := [2]string{m.SessionID, m.Role}
+		text := strings.TrimSpace(m.Text)
+		before, ok := previous[key]
+		if !ok {
+			previous[key] = text
+			continue
+		}
+
+		if match := starCorrection.FindStringSubmatch(text); match != nil {
+			correct := match[1] + match[2]
+			if typo := closestWord(before, correct); typo != "" {
+				typos[typo] = strings.ToLower(correct)
+			}
+			continue
+		}
+		if match := sedCorrection.FindStringSubmatch(text); match != nil {
+			typo, correct := strings.TrimSpace(match[1]), strings.TrimSpace(match[2])
+			if typo != "" && correct != "" && !strings.EqualFold(typo, correct) && containsWord(before, typo) {
+				typos[strings.ToLower(typo)] = correct
+			}
+			continue
+		}
+		previous[key] = text
+	}
+	return typos
+}
+
+// LearnTypos runs findTyposInMessages over the stored messages, of one session or all,
+// and returns the typos not already in the custom typos with that correction.
+func LearnTypos(db *sql.DB, sessionID string) (map[string]string, error) {
+	query := `SELECT id, session_id, role, timestamp, text FROM messages`
+	var args []any
+	if sessionID != "" {
+		query += ` WHERE session_id = ?`
+		args = append(args, sessionID)
+	}
+	rows, err := db.Query(query+` ORDER BY session_id, timestamp, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []textMessage
+	for rows.Next() {
+		var m textMessage
+		var ts int64
+		if err := rows.Scan(&m.MessageID, &m.SessionID, &m.Role, &ts, &m.Text); err != nil {
+			return nil, err
+		}
+		m.Timestamp = time.UnixMilli(ts)
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	learned := findTyposInMessages(messages)
+	typosMutex.RLock()
+	defer typosMutex.RUnlock()
+	for typo, correct := range learned {
+		if customTypos[typo] == correct {
+			delete(learned, typo)
+		}
+	}
+	return learned, nil
+}
+
+// closestWord returns the lowercased word in text nearest to correct by edit distance,
+// if it is one or two edits away.
+func closestWord(text, correct string) string {
+	correct = strings.ToLower(correct)
+	best, bestDistance := "", 3
+	for _, word := range dictionaryWordPattern.FindAllString(text, -1) {
+		word = strings.ToLower(word)
+		if len([]rune(word)) < 3 {
+			continue
+		}
+		if d := editDistance(word, correct); d > 0 && d < bestDistance {
+			best, bestDistance = word, d
+		}
+	}
+	return best
+}
+
+// containsWord reports whether text contains word as a whole word, ignoring case.
+func containsWord(text, word string) bool {
+	return regexp.MustCompile(`(?i)(^|[^\p{L}\p{M}\p{N}_])` + regexp.QuoteMeta(word) + `($|[^\p{L}\p{M}\p{N}_])`).MatchString(text)
+}
+
+// editDistance is the Levenshtein distance between a and b, in runes.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	row := make([]int, len(br)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			diagonal, row[j] = row[j], min(row[j]+1, row[j-1]+1, diagonal+cost)
+		}
+	}
+	return row[len(br)]
 }
 
-// updateTyposFile - not used with manual approach
-func updateTyposFile(newTypos map[string]string) error {
+// updateTyposFile adds newTypos to the typos file, replacing existing corrections for the
+// same typos, and removes the typos in remove. The file is rewritten sorted, and the
+// custom typos reloaded.
+func updateTyposFile(newTypos map[string]string, remove ...string) error {
+	path := getTyposPath()
+	typos, err := readTypos(path)
+	if err != nil {
+		return err
+	}
+	for typo, correct := range newTypos {
+		typos[typo] = correct
+	}
+	for _, typo := range remove {
+		delete(typos, typo)
+	}
+
+	keys := make([]string, 0, len(typos))
+	for typo := range typos {
+		keys = append(keys, typo)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("# Custom typos for mneme: typo → correction, one per line\n")
+	for _, typo := range keys {
+		fmt.Fprintf(&b, "%s → %s\n", typo, typos[typo])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	setCustomTypos(typos)
 	return nil
 }
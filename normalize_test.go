@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withNormalization runs the rest of a test with normalization on, the given protected
+// words and custom typos.
+func withNormalization(t *testing.T, protected []string, typos map[string]string) {
+	t.Helper()
+	previousEnabled, previousTypos, previousPatterns := normalizeEnabled, customTypos, customTypoPatterns
+	normalizeEnabled = true
+	setProtectedWords(protected)
+	setCustomTypos(typos)
+	t.Cleanup(func() {
+		normalizeEnabled, customTypos, customTypoPatterns = previousEnabled, previousTypos, previousPatterns
+		setProtectedWords(nil)
+	})
+}
+
+func TestNormalizeTextOptIn(t *testing.T) {
+	if normalizeEnabled {
+		t.Fatal("expected normalization off by default")
+	}
+	if got := normalizeText("I recieve teh mail"); got != "I recieve teh mail" {
+		t.Fatalf("expected text untouched when disabled, got %q", got)
+	}
+	if got := normalizedVersion("I recieve mail"); got.Valid {
+		t.Fatalf("expected no normalized version when disabled, got %q", got.String)
+	}
+
+	t.Setenv("MNEME_NORMALIZE", "maybe")
+	if err := loadNormalization(); err == nil {
+		t.Fatal("expected an error for a bad MNEME_NORMALIZE")
+	}
+}
+
+func TestNormalizeTextProtectedWords(t *testing.T) {
+	withNormalization(t, []string{" Recieve "}, map[string]string{"kuberntes": "kubernetes", "pg": "postgres"})
+
+	cases := map[string]string{
+		"I will recieve it":            "I will recieve it",
+		"we accross the line":          "we across the line",
+		"deploy to Kuberntes today":    "deploy to Kubernetes today",
+		"KUBERNTES is down":            "KUBERNETES is down",
+		"pgbouncer talks to pg":        "pgbouncer talks to postgres",
+		"call upgrade, not pg_upgrade": "call upgrade, not pg_upgrade",
+	}
+	for in, want := range cases {
+		if got := normalizeText(in); got != want {
+			t.Errorf("normalizeText(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := normalizedVersion("we accross the line"); !got.Valid || got.String != "we across the line" {
+		t.Fatalf("expected a normalized version, got %+v", got)
+	}
+}
+
+func TestLoadDictionaries(t *testing.T) {
+	withNormalization(t, nil, nil)
+	t.Cleanup(func() {
+		spellBase = "en"
+		if err := loadDictionaries(nil); err != nil {
+			t.Fatalf("reset dictionaries: %v", err)
+		}
+	})
+
+	dir := t.TempDir()
+	german := filepath.Join(dir, "de.txt")
+	os.WriteFile(german, []byte("# German corrections and words\nwärend → während\nzb -> z.B.\nwird\n"), 0o644)
+	tech := filepath.Join(dir, "tech.txt")
+	os.WriteFile(tech, []byte("accross\n\n"), 0o644)
+
+	t.Setenv("MNEME_DICTIONARIES", german+string(filepath.ListSeparator)+tech)
+	t.Setenv("MNEME_NORMALIZE", "true")
+	if err := loadNormalization(); err != nil {
+		t.Fatalf("loadNormalization: %v", err)
+	}
+	cases := map[string]string{
+		"Er wird wärend der Woche kommen": "Er wird während der Woche kommen",
+		"Wärend":                          "Während",
+		// A word list entry is never corrected, even when the English list has a rule
+		"the accross flag": "the accross flag",
+		"we recieve it":    "we receive it",
+	}
+	for in, want := range cases {
+		if got := normalizeText(in); got != want {
+			t.Errorf("normalizeText(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	// Without the English base only the dictionaries apply
+	t.Setenv("MNEME_SPELL_BASE", "none")
+	if err := loadNormalization(); err != nil {
+		t.Fatalf("loadNormalization: %v", err)
+	}
+	if got := normalizeText("we recieve it wärend"); got != "we recieve it während" {
+		t.Fatalf("expected only dictionary corrections, got %q", got)
+	}
+	t.Setenv("MNEME_DICTIONARIES", "")
+	if err := loadNormalization(); err != nil {
+		t.Fatalf("loadNormalization: %v", err)
+	}
+	if got := normalizeText("we recieve it"); got != "we recieve it" {
+		t.Fatalf("expected no corrections at all, got %q", got)
+	}
+
+	t.Setenv("MNEME_SPELL_BASE", "klingon")
+	if err := loadNormalization(); err == nil {
+		t.Fatal("expected an error for an unknown spell base")
+	}
+	t.Setenv("MNEME_SPELL_BASE", "")
+	t.Setenv("MNEME_DICTIONARIES", filepath.Join(dir, "missing.txt"))
+	if err := loadNormalization(); err == nil {
+		t.Fatal("expected an error for a missing dictionary")
+	}
+}
+
+func TestFindTyposInMessages(t *testing.T) {
+	msg := func(session, role, text string) textMessage {
+		return textMessage{SessionID: session, Role: role, Text: text}
+	}
+	learned := findTyposInMessages([]textMessage{
+		msg("s1", "User", "I will recieve the package tomorow"),
+		msg("s1", "Assistant", "Sounds good."),
+		msg("s1", "User", "*receive"),
+		msg("s1", "User", "tomorrow*"),
+		msg("s1", "User", "deploy to kuberntes"),
+		msg("s1", "User", "s/kuberntes/Kubernetes/"),
+		// Too far from anything said before
+		msg("s1", "User", "*elephant"),
+		// A correction with nothing before it in its session
+		msg("s2", "User", "*receive"),
+		// s/// needs the word in the previous message
+		msg("s3", "User", "all good here"),
+		msg("s3", "User", "s/teh/the/"),
+	})
+	want := map[string]string{"recieve": "receive", "tomorow": "tomorrow", "kuberntes": "Kubernetes"}
+	if len(learned) != len(want) {
+		t.Fatalf("expected %v, got %v", want, learned)
+	}
+	for typo, correct := range want {
+		if learned[typo] != correct {
+			t.Fatalf("expected %s → %s, got %v", typo, correct, learned)
+		}
+	}
+
+	if d := editDistance("wärend", "während"); d != 1 {
+		t.Fatalf("expected one edit, got %d", d)
+	}
+}
+
+func TestUpdateTyposFile(t *testing.T) {
+	withNormalization(t, nil, nil)
+	path := filepath.Join(t.TempDir(), "config", "typos.txt")
+	t.Setenv("MNEME_TYPOS", path)
+
+	if err := updateTyposFile(map[string]string{"tomorow": "tomorrow", "pg": "postgres"}); err != nil {
+		t.Fatalf("updateTyposFile: %v", err)
+	}
+	if got := normalizeText("see pg tomorow"); got != "see postgres tomorrow" {
+		t.Fatalf("expected the new typos applied, got %q", got)
+	}
+	if err := updateTyposFile(map[string]string{"pg": "PostgreSQL"}, "tomorow"); err != nil {
+		t.Fatalf("updateTyposFile: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasSuffix(string(data), "pg → PostgreSQL\n") || strings.Contains(string(data), "tomorow") {
+		t.Fatalf("unexpected typos file:\n%s", data)
+	}
+	typos, err := readTypos(path)
+	if err != nil || len(typos) != 1 || typos["pg"] != "PostgreSQL" {
+		t.Fatalf("expected one typo read back, got %v, %v", typos, err)
+	}
+}
+
+func TestLearnTypos(t *testing.T) {
+	withNormalization(t, nil, map[string]string{"tomorow": "tomorrow"})
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	for i, text := range []string{"I will recieve it tomorow", "*receive", "tomorrow*"} {
+		if _, err := db.Exec(`INSERT INTO messages (id, session_id, role, timestamp, text) VALUES (?, 's1', 'User', ?, ?)`, fmt.Sprintf("m%d", i), i, text); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	learned, err := LearnTypos(db, "")
+	if err != nil || len(learned) != 1 || learned["recieve"] != "receive" {
+		t.Fatalf("expected only the typo not already known, got %v, %v", learned, err)
+	}
+	if learned, _ := LearnTypos(db, "s2"); len(learned) != 0 {
+		t.Fatalf("expected nothing from another session, got %v", learned)
+	}
+}
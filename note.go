@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// noteSourcePrefix starts the source_file of every note captured with `mneme note`:
+// note://<local time to the minute>.
+const noteSourcePrefix = "note://"
+
+// noteSource names a note taken at t, numbering it when another note already took that
+// minute so neither replaces the other.
+func noteSource(db *sql.DB, t time.Time) (string, error) {
+	base := noteSourcePrefix + t.In(mnemeLocation).Format("2006-01-02T15:04")
+	source := base
+	for n := 2; ; n++ {
+		var taken bool
+		err := db.QueryRow(
+			`SELECT EXISTS(SELECT 1 FROM chunks WHERE source_file = ?) OR EXISTS(SELECT 1 FROM source_hashes WHERE source_file = ?)`,
+			source, source,
+		).Scan(&taken)
+		if err != nil || !taken {
+			return source, err
+		}
+		source = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// buildNoteMarkdown renders a note as one section titled by its first line.
+func buildNoteMarkdown(text string) string {
+	text = strings.TrimSpace(text)
+	return "## " + captureTitle(text) + "\n\n" + demoteHeadings(text) + "\n"
+}
+
+// StoreNote ingests text as a new note dated the day of now, returning its source.
+func StoreNote(ctx context.Context, db *sql.DB, ollama *OllamaClient, text string, now time.Time) (string, IngestResult, error) {
+	if strings.TrimSpace(text) == "" {
+		return "", IngestResult{}, fmt.Errorf("note is empty")
+	}
+	source, err := noteSource(db, now)
+	if err != nil {
+		return "", IngestResult{}, err
+	}
+	result, err := IngestMarkdown(ctx, db, ollama, source, strings.NewReader(buildNoteMarkdown(text)), localDate(now), defaultChunking, nil)
+	return source, result, err
+}
+
+// editNote opens editor on an empty markdown file and returns what was saved. editor is
+// run by the shell, so it may carry arguments, as in "code --wait".
+func editNote(editor string) (string, error) {
+	f, err := os.CreateTemp("", "mneme-note-*.md")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("run %s: %w", editor, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
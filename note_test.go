@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStoreNote(t *testing.T) {
+	withLocation(t, time.UTC)
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	ollama := NewOllamaClient(server.URL, "embed")
+
+	now := time.Date(2026, 1, 21, 10, 33, 12, 0, time.UTC)
+	source, result, err := StoreNote(context.Background(), db, ollama, "Parking spot is B14 #car\nLevel 2", now)
+	if err != nil {
+		t.Fatalf("StoreNote: %v", err)
+	}
+	if source != "note://2026-01-21T10:33" || len(result.ChunkIDs) != 1 {
+		t.Fatalf("expected one chunk stored as note://2026-01-21T10:33, got %q, %v", source, result.ChunkIDs)
+	}
+	var title, validAt string
+	db.QueryRow(`SELECT section_title, valid_at FROM chunks WHERE id = ?`, result.ChunkIDs[0]).Scan(&title, &validAt)
+	if title != "Parking spot is B14 #car" || validAt != "2026-01-21" {
+		t.Fatalf("expected the note titled by its first line and dated today, got %q, %q", title, validAt)
+	}
+	if tagged, err := TaggedChunks(db, "car", 10); err != nil || len(tagged) != 1 {
+		t.Fatalf("expected the note tagged car, got %v, %v", tagged, err)
+	}
+
+	// A second note in the same minute keeps the first
+	source, _, err = StoreNote(context.Background(), db, ollama, "Dentist moved to Elm Street", now.Add(20*time.Second))
+	if err != nil || source != "note://2026-01-21T10:33-2" {
+		t.Fatalf("expected note://2026-01-21T10:33-2, got %q, %v", source, err)
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE source_file LIKE 'note://%'`).Scan(&count)
+	if count != 2 {
+		t.Fatalf("expected both notes kept, got %d", count)
+	}
+
+	if _, _, err := StoreNote(context.Background(), db, ollama, "  \n", now); err == nil {
+		t.Fatal("expected an empty note rejected")
+	}
+}
+
+func TestEditNote(t *testing.T) {
+	text, err := editNote(`printf 'Call the plumber' >`)
+	if err != nil || text != "Call the plumber" {
+		t.Fatalf("expected the saved text, got %q, %v", text, err)
+	}
+	if _, err := editNote("false"); err == nil {
+		t.Fatal("expected a failed editor reported")
+	}
+}
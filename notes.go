@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// note is one note from a notes-app export, whatever the format.
+type note struct {
+	Title   string
+	Text    string
+	Created time.Time
+	Tags    []string
+}
+
+// enexTime is the timestamp format of Evernote exports.
+const enexTime = "20060102T150405Z"
+
+// readENEX reads the notes of an Evernote (or Apple Notes via Evernote) .enex export,
+// one at a time so a large export is never held as XML in memory.
+func readENEX(r io.Reader) ([]note, error) {
+	decoder := xml.NewDecoder(r)
+	// Exports declare entities such as &nbsp; through the ENML DTD, which is not fetched
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	var notes []note
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return notes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read enex: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+		var raw struct {
+			Title   string   `xml:"title"`
+			Content string   `xml:"content"`
+			Created string   `xml:"created"`
+			Tags    []string `xml:"tag"`
+		}
+		if err := decoder.DecodeElement(&raw, &start); err != nil {
+			return nil, fmt.Errorf("read enex note: %w", err)
+		}
+		n := note{Title: strings.TrimSpace(raw.Title), Text: htmlToText(raw.Content), Tags: raw.Tags}
+		if raw.Created != "" {
+			if n.Created, err = time.Parse(enexTime, raw.Created); err != nil {
+				return nil, fmt.Errorf("note %q: created %q: %w", n.Title, raw.Created, err)
+			}
+		}
+		notes = append(notes, n)
+	}
+}
+
+var (
+	htmlDropped   = regexp.MustCompile(`(?is)<(head|script|style)\b.*?</(head|script|style)\s*>`)
+	htmlTitle     = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title\s*>`)
+	htmlHeading1  = regexp.MustCompile(`(?is)<h1\b[^>]*>(.*?)</h1\s*>`)
+	htmlListItem  = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	htmlLineBreak = regexp.MustCompile(`(?i)<(br|hr)\b[^>]*>|</(p|div|h[1-6]|ul|ol|tr|blockquote|pre)\s*>`)
+	htmlTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+	extraBlanks   = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText reduces HTML (or ENML) to plain text, keeping line breaks at block
+// boundaries and list items as "- " lines.
+func htmlToText(s string) string {
+	s = htmlDropped.ReplaceAllString(s, "")
+	s = htmlListItem.ReplaceAllString(s, "\n- ")
+	s = htmlLineBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(html.UnescapeString(s), "\u00a0", " ")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(extraBlanks.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// readNoteHTML reads one note exported as HTML, as Apple Notes exporters write them. The
+// title is the page title or first heading, and the note is dated by the file's
+// modification time, which those exporters set to when the note was created.
+func readNoteHTML(path string) (note, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return note{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return note{}, err
+	}
+	page := string(data)
+	n := note{Created: info.ModTime(), Text: htmlToText(page)}
+	for _, pattern := range []*regexp.Regexp{htmlTitle, htmlHeading1} {
+		if m := pattern.FindStringSubmatch(page); m != nil {
+			if n.Title = htmlToText(m[1]); n.Title != "" {
+				break
+			}
+		}
+	}
+	if n.Title == "" {
+		n.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	// The heading repeats the title at the top of the body
+	n.Text = strings.TrimSpace(strings.TrimPrefix(n.Text, n.Title))
+	return n, nil
+}
+
+// buildNotesMarkdown renders notes as sections titled by the note and dated when it was
+// created, so they chunk and date like any ingested markdown.
+func buildNotesMarkdown(notes []note) string {
+	var b strings.Builder
+	for _, n := range notes {
+		if n.Text == "" {
+			continue
+		}
+		title := n.Title
+		if title == "" {
+			title = "Untitled note"
+		}
+		if !n.Created.IsZero() {
+			title += " (" + n.Created.In(mnemeLocation).Format("January 2, 2006") + ")"
+		}
+		fmt.Fprintf(&b, "## %s\n\n%s\n\n", title, demoteHeadings(n.Text))
+		if len(n.Tags) > 0 {
+			fmt.Fprintf(&b, "Tags: %s\n\n", strings.Join(n.Tags, ", "))
+		}
+	}
+	return b.String()
+}
+
+type NotesImportResult struct {
+	Files int
+	Notes int
+}
+
+// noteExtensions are the export files import-notes reads.
+var noteExtensions = map[string]bool{".enex": true, ".html": true, ".htm": true}
+
+// ImportNotes ingests a notes export: an .enex file, an HTML note, or a directory holding
+// any number of them. Each file becomes one source, so importing it again replaces it.
+func ImportNotes(ctx context.Context, db *sql.DB, ollama *OllamaClient, path string, progress ProgressFunc) (NotesImportResult, error) {
+	var result NotesImportResult
+	files, err := noteFiles(path)
+	if err != nil {
+		return result, err
+	}
+	if len(files) == 0 {
+		return result, fmt.Errorf("no .enex or .html notes in %s", path)
+	}
+
+	for i, file := range files {
+		if progress != nil {
+			progress(i, len(files), filepath.Base(file))
+		}
+		var notes []note
+		if strings.EqualFold(filepath.Ext(file), ".enex") {
+			f, err := os.Open(file)
+			if err != nil {
+				return result, err
+			}
+			notes, err = readENEX(f)
+			f.Close()
+			if err != nil {
+				return result, fmt.Errorf("%s: %w", file, err)
+			}
+		} else {
+			n, err := readNoteHTML(file)
+			if err != nil {
+				return result, err
+			}
+			notes = []note{n}
+		}
+
+		md := buildNotesMarkdown(notes)
+		if md == "" {
+			continue
+		}
+		if _, err := ingestMarkdownSource(ctx, db, ollama, file, md); err != nil {
+			return result, fmt.Errorf("ingest %s: %w", file, err)
+		}
+		result.Files++
+		result.Notes += len(notes)
+	}
+	if progress != nil {
+		progress(len(files), len(files), "")
+	}
+	return result, nil
+}
+
+// noteFiles lists the export files at path, in name order.
+func noteFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if !noteExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil, errors.New("want an .enex or .html export, or a directory of them")
+		}
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && noteExtensions[strings.ToLower(filepath.Ext(p))] {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testENEX = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export export-date="20250401T100000Z" application="Evernote" version="10">
+  <note>
+    <title>Trip ideas</title>
+    <content><![CDATA[<?xml version="1.0" encoding="UTF-8"?><!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd"><en-note><div>Places for the &nbsp;autumn:</div><ul><li>Lisbon</li><li>Kyoto &amp; Nara</li></ul><br/><div>Book by June.</div></en-note>]]></content>
+    <created>20240305T081500Z</created>
+    <updated>20240306T090000Z</updated>
+    <tag>travel</tag>
+    <tag>plans</tag>
+  </note>
+  <note>
+    <title>Empty</title>
+    <content><![CDATA[<en-note></en-note>]]></content>
+    <created>20240306T081500Z</created>
+  </note>
+</en-export>`
+
+func TestReadENEX(t *testing.T) {
+	withLocation(t, time.UTC)
+	notes, err := readENEX(strings.NewReader(testENEX))
+	if err != nil {
+		t.Fatalf("readENEX: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("expected 2 notes, got %+v", notes)
+	}
+	n := notes[0]
+	if n.Title != "Trip ideas" || !n.Created.Equal(time.Date(2024, 3, 5, 8, 15, 0, 0, time.UTC)) || strings.Join(n.Tags, ",") != "travel,plans" {
+		t.Fatalf("unexpected note %+v", n)
+	}
+	if want := "Places for the autumn:\n\n- Lisbon\n- Kyoto & Nara\n\nBook by June."; n.Text != want {
+		t.Fatalf("expected %q, got %q", want, n.Text)
+	}
+
+	sections := ParseMarkdown(buildNotesMarkdown(notes))
+	if len(sections) != 1 {
+		t.Fatalf("expected the empty note dropped, got %+v", sections)
+	}
+	if sections[0].Title != "Trip ideas (March 5, 2024)" || sections[0].ValidAt != "2024-03-05" || !strings.Contains(sections[0].Content, "Tags: travel, plans") {
+		t.Fatalf("unexpected section %+v", sections[0])
+	}
+}
+
+func TestImportNotes(t *testing.T) {
+	withLocation(t, time.UTC)
+	dir := t.TempDir()
+	exports := filepath.Join(dir, "exports")
+	os.MkdirAll(exports, 0o755)
+	os.WriteFile(filepath.Join(exports, "evernote.enex"), []byte(testENEX), 0o644)
+	page := filepath.Join(exports, "Groceries.html")
+	os.WriteFile(page, []byte(`<html><head><title>Groceries</title><style>p{}</style></head><body><h1>Groceries</h1><p>Oat milk<br>Coffee</p></body></html>`), 0o644)
+	created := time.Date(2023, 11, 2, 18, 0, 0, 0, time.UTC)
+	os.Chtimes(page, created, created)
+	os.WriteFile(filepath.Join(exports, "readme.txt"), []byte("not a note"), 0o644)
+
+	db, err := InitDB(filepath.Join(dir, "mneme.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+
+	result, err := ImportNotes(context.Background(), db, NewOllamaClient(server.URL, "embed"), exports, nil)
+	if err != nil {
+		t.Fatalf("ImportNotes: %v", err)
+	}
+	if result.Files != 2 || result.Notes != 3 {
+		t.Fatalf("expected 3 notes from 2 files, got %+v", result)
+	}
+	var title, text, validAt string
+	if err := db.QueryRow(`SELECT section_title, text, valid_at FROM chunks WHERE source_file = ?`, page).Scan(&title, &text, &validAt); err != nil {
+		t.Fatalf("read note chunk: %v", err)
+	}
+	if title != "Groceries (November 2, 2023)" || validAt != "2023-11-02" || !strings.Contains(text, "Oat milk\nCoffee") || strings.Contains(text, "p{}") {
+		t.Fatalf("unexpected chunk %q, %q, %q", title, validAt, text)
+	}
+
+	if _, err := ImportNotes(context.Background(), db, nil, filepath.Join(exports, "readme.txt"), nil); err == nil {
+		t.Fatal("expected an error for a file that is not a notes export")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -13,7 +14,6 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"syscall"
 	"time"
@@ -28,6 +28,7 @@ type ocSession struct {
 	Title    string
 	ParentID sql.NullString
 	Updated  int64
+	Dir      string // the directory OpenCode was run in
 }
 
 type ocPart struct {
@@ -35,22 +36,6 @@ type ocPart struct {
 	Text string `json:"text"`
 }
 
-var noisePatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?s)\[search-mode\].*?---\s*\n`),
-	regexp.MustCompile(`(?s)\[analyze-mode\].*?---\s*\n`),
-	regexp.MustCompile(`(?s)\[SYSTEM DIRECTIVE[^\]]*\].*?(?:\[Status:[^\]]*\])`),
-	regexp.MustCompile(`(?s)# Continuation Prompt.*`),
-	regexp.MustCompile(`\(sisyphus\)\s*`),
-	regexp.MustCompile(`\(prometheus\)\s*`),
-	regexp.MustCompile(`\(oracle\)\s*`),
-	regexp.MustCompile(`(?s)\[BACKGROUND TASK COMPLETED\].*?\n`),
-	regexp.MustCompile(`(?s)\[Agent Usage Reminder\].*?(?:\n\n|\z)`),
-	regexp.MustCompile(`(?s)\[Category\+Skill Reminder\].*?(?:\n\n|\z)`),
-	regexp.MustCompile(`(?s)<system-reminder>.*?</system-reminder>`),
-	regexp.MustCompile(`(?s)\[ALL BACKGROUND TASKS COMPLETE\].*?(?:\n\n|\z)`),
-	regexp.MustCompile(`(?s)\[SYSTEM REMINDER[^\]]*\].*?(?:\n\n|\z)`),
-}
-
 type textMessage struct {
 	Role      string
 	Text      string
@@ -67,7 +52,7 @@ func openCodeDBPath() string {
 
 func discoverSessions(ocDB *sql.DB) ([]ocSession, error) {
 	rows, err := ocDB.Query(`
-		SELECT id, slug, title, parent_id, time_updated 
+		SELECT id, slug, title, parent_id, time_updated, directory
 		FROM session 
 		WHERE parent_id IS NULL 
 		ORDER BY time_updated DESC
@@ -80,7 +65,7 @@ func discoverSessions(ocDB *sql.DB) ([]ocSession, error) {
 	var sessions []ocSession
 	for rows.Next() {
 		var s ocSession
-		if err := rows.Scan(&s.ID, &s.Slug, &s.Title, &s.ParentID, &s.Updated); err != nil {
+		if err := rows.Scan(&s.ID, &s.Slug, &s.Title, &s.ParentID, &s.Updated, &s.Dir); err != nil {
 			continue
 		}
 		sessions = append(sessions, s)
@@ -129,11 +114,36 @@ func pickSession(sessions []ocSession) (ocSession, error) {
 	return sessions[choice-1], nil
 }
 
-func stripNoise(text string) string {
-	for _, p := range noisePatterns {
-		text = p.ReplaceAllString(text, "")
+// ocSessionsIn keeps the sessions OpenCode was run in dir for.
+func ocSessionsIn(sessions []ocSession, dir string) []ocSession {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	var kept []ocSession
+	for _, s := range sessions {
+		if filepath.Clean(s.Dir) == dir {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// findSession chooses a session without prompting: the one with id, or with latest the
+// most recently updated.
+func findSession(sessions []ocSession, id string, latest bool) (ocSession, error) {
+	for _, s := range sessions {
+		// discoverSessions lists the most recently updated first
+		if latest || s.ID == id {
+			return s, nil
+		}
 	}
-	return strings.TrimSpace(text)
+	return ocSession{}, fmt.Errorf("no OpenCode session %s", id)
+}
+
+// idleFlushDue reports whether a partial batch has waited flushAfter since its last
+// message arrived, so a quiet session's trailing messages are not left unembedded.
+func idleFlushDue(pending int, lastMessage time.Time, flushAfter time.Duration, now time.Time) bool {
+	return flushAfter > 0 && pending > 0 && now.Sub(lastMessage) >= flushAfter
 }
 
 func getExistingMessageIDs(ocDB *sql.DB, sessionID string) (map[string]bool, error) {
@@ -157,12 +167,13 @@ func getExistingMessageIDs(ocDB *sql.DB, sessionID string) (map[string]bool, err
 func readTextFromDB(ocDB *sql.DB, sessionID, msgID, userAlias, assistantAlias string) (*textMessage, error) {
 	var data string
 	var timeCreated int64
-	err := ocDB.QueryRow(`
-		SELECT data, time_created FROM message WHERE id = ? AND session_id = ?
-	`, msgID, sessionID).Scan(&data, &timeCreated)
+	stmt, err := cachedStmt(ocDB, `SELECT data, time_created FROM message WHERE id = ? AND session_id = ?`)
 	if err != nil {
 		return nil, err
 	}
+	if err := stmt.QueryRow(msgID, sessionID).Scan(&data, &timeCreated); err != nil {
+		return nil, err
+	}
 
 	var msgData struct {
 		Role string `json:"role"`
@@ -171,11 +182,10 @@ func readTextFromDB(ocDB *sql.DB, sessionID, msgID, userAlias, assistantAlias st
 		return nil, err
 	}
 
-	rows, err := ocDB.Query(`
-		SELECT data FROM part 
-		WHERE message_id = ? AND session_id = ?
-		ORDER BY time_created
-	`, msgID, sessionID)
+	if stmt, err = cachedStmt(ocDB, `SELECT data FROM part WHERE message_id = ? AND session_id = ? ORDER BY time_created`); err != nil {
+		return nil, err
+	}
+	rows, err := stmt.Query(msgID, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -214,7 +224,7 @@ func readTextFromDB(ocDB *sql.DB, sessionID, msgID, userAlias, assistantAlias st
 	return &textMessage{
 		Role:      role,
 		Text:      cleaned,
-		Timestamp: time.UnixMilli(timeCreated),
+		Timestamp: time.UnixMilli(timeCreated).In(mnemeLocation),
 		IsUser:    isUser,
 		MessageID: msgID,
 		SessionID: sessionID,
@@ -222,11 +232,11 @@ func readTextFromDB(ocDB *sql.DB, sessionID, msgID, userAlias, assistantAlias st
 }
 
 func getNewMessages(ocDB *sql.DB, sessionID string, done map[string]bool) ([]string, error) {
-	rows, err := ocDB.Query(`
-		SELECT id FROM message 
-		WHERE session_id = ? 
-		ORDER BY time_created
-	`, sessionID)
+	stmt, err := cachedStmt(ocDB, `SELECT id FROM message WHERE session_id = ? ORDER BY time_created`)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.Query(sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -253,16 +263,17 @@ func buildWatchMarkdown(messages []textMessage, sessionTitle string) string {
 	var b strings.Builder
 	b.WriteString(fmt.Sprintf("# %s\n\n", sessionTitle))
 
-	date := messages[0].Timestamp.Format("January 2, 2006")
+	// Dated in mnemeLocation whatever zone the source reported
+	date := messages[0].Timestamp.In(mnemeLocation).Format("January 2, 2006")
 	b.WriteString(fmt.Sprintf("## %s\n\n", date))
 
 	for _, m := range messages {
-		msgDate := m.Timestamp.Format("January 2, 2006")
+		msgDate := m.Timestamp.In(mnemeLocation).Format("January 2, 2006")
 		if msgDate != date {
 			date = msgDate
 			b.WriteString(fmt.Sprintf("\n## %s\n\n", date))
 		}
-		b.WriteString(fmt.Sprintf("**%s** [%s]:\n%s\n\n", m.Role, m.Timestamp.Format("15:04"), m.Text))
+		b.WriteString(fmt.Sprintf("**%s** [%s]:\n%s\n\n", m.Role, m.Timestamp.In(mnemeLocation).Format("15:04"), m.Text))
 	}
 
 	return b.String()
@@ -271,29 +282,156 @@ func buildWatchMarkdown(messages []textMessage, sessionTitle string) string {
 type preparedChunk struct {
 	chunk      ChunkData
 	validAt    sql.NullString
+	normalized sql.NullString
 	serialized []byte
 }
 
-func ingestBatch(db *sql.DB, ollama *OllamaClient, sourceFile string, messages []textMessage, sessionTitle string) error {
-	// Phase 2: Store individual messages with embeddings for direct search
-	if inserted, err := insertMessages(db, ollama, messages); err != nil {
-		log.Printf("Warning: message insert failed: %v", err)
-	} else if inserted > 0 {
+// ingestBatch stores a batch's messages and ingests it as markdown under sourceFile.
+// Everything is embedded first, then messages, chunks, their vectors and FTS rows and the
+// entity mentions are written in one transaction, so a crash or a failed write leaves
+// none of the batch behind rather than chunks without vectors.
+// With a generate model the batch's chunks are titled after what they discuss. saveState,
+// when not nil, records the watcher's progress in the same transaction.
+func ingestBatch(ctx context.Context, db *sql.DB, ollama *OllamaClient, generateModel, sourceFile string, messages []textMessage, sessionTitle string, chunking ChunkOptions, saveState func(tx *sql.Tx) error) error {
+	newMessages, err := prepareMessages(ctx, db, ollama, messages)
+	if err != nil {
+		return fmt.Errorf("prepare messages: %w", err)
+	}
+	md := buildWatchMarkdown(messages, sessionTitle)
+	chunks, err := prepareMarkdownChunks(ctx, ollama, md, chunking)
+	if err != nil {
+		return err
+	}
+	chunks, skipped, err := dropNearDuplicates(db, sourceFile, chunks)
+	if err != nil {
+		return err
+	}
+	entities, err := loadEntityNames(db)
+	if err != nil {
+		return fmt.Errorf("load entities: %w", err)
+	}
+
+	var inserted int
+	var chunkIDs []int64
+	if err := withWriteTx(db, "store batch", func(tx *sql.Tx) error {
+		var err error
+		if inserted, err = storeMessages(tx, newMessages); err != nil {
+			return err
+		}
+		chunkIDs = nil
+		if len(chunks) > 0 {
+			if chunkIDs, err = storeMarkdownChunks(tx, sourceFile, chunks); err != nil {
+				return err
+			}
+			if err := indexChunkMentionsTx(tx, chunkIDs, entities); err != nil {
+				return fmt.Errorf("index entities: %w", err)
+			}
+		}
+		if saveState != nil {
+			return saveState(tx)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if inserted > 0 {
 		fmt.Println(renderPreflightStep("ok", fmt.Sprintf("Stored %d messages", inserted)))
 	}
+	for _, d := range skipped {
+		fmt.Println(renderPreflightStep("ok", fmt.Sprintf("Skipped %q, a near-duplicate of chunk %d (%q in %s)", d.Section, d.KeptID, d.KeptSection, d.KeptSource)))
+	}
+	messagesStored.add("", float64(inserted))
+	chunksIngested.add("", float64(len(chunkIDs)))
+	if len(messages) > 0 {
+		oldest := messages[0].Timestamp
+		for _, m := range messages[1:] {
+			if m.Timestamp.Before(oldest) {
+				oldest = m.Timestamp
+			}
+		}
+		watcherLag.set(time.Since(oldest).Seconds())
+	}
 
-	md := buildWatchMarkdown(messages, sessionTitle)
-	sections := ParseMarkdown(md)
-	if len(sections) == 0 {
+	title, err := titleIngestedBatch(ctx, db, ollama, generateModel, chunkIDs, md)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	} else if title != "" {
+		fmt.Println(renderPreflightStep("ok", fmt.Sprintf("Titled batch: %s", title)))
+	}
+
+	text := fmt.Sprintf("Stored %d messages from %s", inserted, sessionTitle)
+	if title != "" {
+		text += ": " + title
+	}
+	notify(eventBatchIngested, text, map[string]any{
+		"source_file": sourceFile,
+		"session":     sessionTitle,
+		"messages":    inserted,
+		"chunks":      len(chunkIDs),
+		"duplicates":  len(skipped),
+		"title":       title,
+	})
+	return nil
+}
+
+// ingestMarkdownSource chunks, embeds and stores generated markdown under sourceFile,
+// replacing whatever that source held before. It returns the new chunk ids.
+func ingestMarkdownSource(ctx context.Context, db *sql.DB, ollama *OllamaClient, sourceFile, md string) ([]int64, error) {
+	prepared, err := prepareMarkdownChunks(ctx, ollama, md, defaultChunking)
+	if err != nil || len(prepared) == 0 {
+		return nil, err
+	}
+	entities, err := loadEntityNames(db)
+	if err != nil {
+		return nil, fmt.Errorf("load entities: %w", err)
+	}
+
+	var chunkIDs []int64
+	err = withWriteTx(db, "store "+sourceFile, func(tx *sql.Tx) error {
+		var err error
+		if chunkIDs, err = storeMarkdownChunks(tx, sourceFile, prepared); err != nil {
+			return err
+		}
+		if err := indexChunkMentionsTx(tx, chunkIDs, entities); err != nil {
+			return fmt.Errorf("index entities: %w", err)
+		}
 		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	chunksIngested.add("", float64(len(chunkIDs)))
+	return chunkIDs, nil
+}
 
-	ctx := context.Background()
-	ingestedAt := time.Now().UTC().Format(time.RFC3339)
+// dropNearDuplicates leaves out the prepared chunks that nearly repeat one already stored
+// in sourceFile's family, such as an earlier batch of the same session, returning the
+// rest and the ones dropped.
+func dropNearDuplicates(db *sql.DB, sourceFile string, prepared []preparedChunk) ([]preparedChunk, []SkippedDuplicate, error) {
+	kept := prepared[:0]
+	var skipped []SkippedDuplicate
+	for _, pc := range prepared {
+		duplicate, err := nearDuplicate(db, sourceFile, pc.serialized)
+		if err != nil {
+			return nil, nil, err
+		}
+		if duplicate == 0 {
+			kept = append(kept, pc)
+			continue
+		}
+		d := SkippedDuplicate{Section: pc.chunk.SectionTitle, KeptID: duplicate}
+		if err := db.QueryRow(`SELECT source_file, section_title FROM chunks WHERE id = ?`, duplicate).Scan(&d.KeptSource, &d.KeptSection); err != nil {
+			return nil, nil, fmt.Errorf("read near-duplicate %d: %w", duplicate, err)
+		}
+		skipped = append(skipped, d)
+	}
+	return kept, skipped, nil
+}
 
-	// Phase 1: embed everything BEFORE touching the DB — safe to fail here
+// prepareMarkdownChunks chunks and embeds markdown without touching the DB — safe to fail.
+func prepareMarkdownChunks(ctx context.Context, ollama *OllamaClient, md string, chunking ChunkOptions) ([]preparedChunk, error) {
 	var prepared []preparedChunk
-	for _, section := range sections {
+	for _, section := range ParseMarkdown(md) {
 		if strings.TrimSpace(section.Content) == "" {
 			continue
 		}
@@ -303,72 +441,92 @@ func ingestBatch(db *sql.DB, ollama *OllamaClient, sourceFile string, messages [
 			validAtValue = sql.NullString{String: section.ValidAt, Valid: true}
 		}
 
-		chunks := ChunkSection(section, 600)
+		chunks := ChunkSection(section, chunking)
 		for _, chunk := range chunks {
 			if strings.TrimSpace(chunk.Text) == "" {
 				continue
 			}
 
-			embedding, err := ollama.Embed(ctx, chunk.Text)
+			normalized := normalizedVersion(chunk.Text)
+			text := chunk.Text
+			if normalized.Valid {
+				text = normalized.String
+			}
+			embedding, err := ollama.Embed(ctx, text)
 			if err != nil {
-				return fmt.Errorf("embed: %w", err)
+				return nil, fmt.Errorf("embed: %w", err)
 			}
 			serialized, err := sqlite_vec.SerializeFloat32(embedding)
 			if err != nil {
-				return fmt.Errorf("serialize: %w", err)
+				return nil, fmt.Errorf("serialize: %w", err)
 			}
 
 			prepared = append(prepared, preparedChunk{
 				chunk:      chunk,
 				validAt:    validAtValue,
+				normalized: normalized,
 				serialized: serialized,
 			})
 		}
 	}
+	return prepared, nil
+}
 
-	if len(prepared) == 0 {
-		return nil
+// storeMarkdownChunks replaces sourceFile's chunks with prepared inside tx, writing the
+// chunk rows (and through their triggers the FTS rows) and vectors with multi-row inserts.
+// It returns the new chunk ids in the order of prepared.
+func storeMarkdownChunks(tx *sql.Tx, sourceFile string, prepared []preparedChunk) ([]int64, error) {
+	if _, err := tx.Exec(`DELETE FROM vec_chunks WHERE chunk_id IN (SELECT id FROM chunks WHERE source_file = ?)`, sourceFile); err != nil {
+		return nil, fmt.Errorf("delete vectors: %w", err)
 	}
-
-	db.Exec(`DELETE FROM vec_chunks WHERE chunk_id IN (SELECT id FROM chunks WHERE source_file = ?)`, sourceFile)
-
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
+	if _, err := tx.Exec(`DELETE FROM chunks WHERE source_file = ?`, sourceFile); err != nil {
+		return nil, fmt.Errorf("delete chunks: %w", err)
 	}
-	defer func() { _ = tx.Rollback() }()
 
-	tx.Exec(`DELETE FROM chunks WHERE source_file = ?`, sourceFile)
-
-	chunkIDs := make([]int64, 0, len(prepared))
-	for _, pc := range prepared {
-		res, err := tx.Exec(
-			`INSERT INTO chunks (text, source_file, section_title, header_level, parent_title, section_sequence, chunk_sequence, chunk_total, valid_at, ingested_at)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			pc.chunk.Text, sourceFile, pc.chunk.SectionTitle, pc.chunk.HeaderLevel, pc.chunk.ParentTitle,
-			pc.chunk.SectionSequence, pc.chunk.ChunkSequence, pc.chunk.ChunkTotal, pc.validAt, ingestedAt,
+	ingestedAt := time.Now().UTC().Format(time.RFC3339)
+	chunkIDs := make([]int64, len(prepared))
+	for start := 0; start < len(prepared); start += multiRowBatch {
+		batch := prepared[start:min(start+multiRowBatch, len(prepared))]
+		// RETURNING order isn't guaranteed, so ids are matched back by sequence
+		position := make(map[[2]int]int, len(batch))
+		args := make([]any, 0, len(batch)*11)
+		for i, pc := range batch {
+			position[[2]int{pc.chunk.SectionSequence, pc.chunk.ChunkSequence}] = start + i
+			args = append(args, pc.chunk.Text, sourceFile, pc.chunk.SectionTitle, pc.chunk.HeaderLevel, pc.chunk.ParentTitle,
+				pc.chunk.SectionSequence, pc.chunk.ChunkSequence, pc.chunk.ChunkTotal, pc.validAt, ingestedAt, pc.normalized)
+		}
+		rows, err := tx.Query(
+			`INSERT INTO chunks (text, source_file, section_title, header_level, parent_title, section_sequence, chunk_sequence, chunk_total, valid_at, ingested_at, normalized_text)
+			 VALUES `+valuesPlaceholders(len(batch), 11)+` RETURNING id, section_sequence, chunk_sequence`,
+			args...,
 		)
 		if err != nil {
-			return fmt.Errorf("insert chunk: %w", err)
+			return nil, fmt.Errorf("insert chunks: %w", err)
+		}
+		for rows.Next() {
+			var id int64
+			var key [2]int
+			if err := rows.Scan(&id, &key[0], &key[1]); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("insert chunks: %w", err)
+			}
+			chunkIDs[position[key]] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("insert chunks: %w", err)
 		}
-		chunkID, _ := res.LastInsertId()
-		chunkIDs = append(chunkIDs, chunkID)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit: %w", err)
-	}
 
-	for i, pc := range prepared {
-		if _, err := db.Exec(
-			"INSERT INTO vec_chunks (chunk_id, embedding) VALUES (?, ?)",
-			chunkIDs[i], pc.serialized,
-		); err != nil {
-			return fmt.Errorf("insert vec: %w", err)
+		vecArgs := make([]any, 0, len(batch)*4)
+		for i, pc := range batch {
+			validFrom, validUntil := vecValidity(pc.validAt, sql.NullString{})
+			vecArgs = append(vecArgs, chunkIDs[start+i], pc.serialized, validFrom, validUntil)
+		}
+		if _, err := tx.Exec(`INSERT INTO vec_chunks (chunk_id, embedding, valid_at, valid_until) VALUES `+valuesPlaceholders(len(batch), 4), vecArgs...); err != nil {
+			return nil, fmt.Errorf("insert vectors: %w", err)
 		}
 	}
-
-	return nil
+	return chunkIDs, nil
 }
 
 type tagsResponse struct {
@@ -377,8 +535,7 @@ type tagsResponse struct {
 	} `json:"models"`
 }
 
-func watchPreflight(ollamaHost, embedModel string) error {
-	ctx := context.Background()
+func watchPreflight(ctx context.Context, ollamaHost, embedModel string) error {
 	baseURL := "http://" + ollamaHost
 	client := &OllamaClient{
 		baseURL:    baseURL,
@@ -451,7 +608,7 @@ func watchPreflight(ollamaHost, embedModel string) error {
 
 	fmt.Print(renderPreflightStep("wait", "Warmup  loading into VRAM"))
 	warmupClient := NewOllamaClient(baseURL, embedModel)
-	if err := ValidateEmbedDimension(warmupClient); err != nil {
+	if err := ValidateEmbedDimension(ctx, warmupClient); err != nil {
 		fmt.Print("\r" + renderPreflightStep("fail", "Warmup  "+err.Error()) + "\n")
 		return fmt.Errorf("warmup: %w", err)
 	}
@@ -460,14 +617,48 @@ func watchPreflight(ollamaHost, embedModel string) error {
 	return nil
 }
 
-func runWatch(args []string, hanaDB, ollamaHost, embedModel, userAlias, assistantAlias string) {
+func runWatch(args []string, hanaDB, ollamaHost, embedModel, generateModel, userAlias, assistantAlias string) {
 	fs := flag.NewFlagSet("watch-oc", flag.ExitOnError)
 	batchSize := fs.Int("batch", 6, "text messages before ingesting")
 	pollSec := fs.Int("poll", 3, "poll interval in seconds")
+	summaryIdle := fs.Int("summary-idle", 10, "minutes of quiet before summarizing the session (0 disables)")
+	flushAfter := fs.Duration("flush-after", 0, "ingest a partial batch after this long without new messages, e.g. 5m (0 waits for a full batch)")
+	noTitles := fs.Bool("no-titles", false, "keep date headings instead of titling each batch with the generate model")
+	chunks := newChunkFlags(fs)
+	metricsAddr := fs.String("metrics", "", "serve Prometheus metrics on this address, e.g. :9464")
+	sessionID := fs.String("session", "", "watch the session with this ID instead of picking one")
+	project := fs.String("project", "", "only sessions run in this directory")
+	latest := fs.Bool("latest", false, "watch the most recently updated session instead of picking one")
+	daemon := fs.Bool("daemon", false, "run unattended: write a PID file and log to a file instead of the terminal (needs --session or --latest)")
+	pidFile := fs.String("pid-file", "", "daemon PID file (default: next to the database)")
+	logFile := fs.String("log-file", "", "daemon log file (default: next to the database)")
 
 	if err := fs.Parse(args); err != nil {
 		log.Fatalf("parse flags: %v", err)
 	}
+	chunking, err := chunks.options()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *sessionID != "" && *latest {
+		log.Fatal("--session and --latest are exclusive")
+	}
+	if *daemon {
+		if *sessionID == "" && !*latest {
+			log.Fatal("--daemon needs --session or --latest: there is no one to pick a session")
+		}
+		stop, err := startDaemon(daemonPaths(watcherOC, hanaDB, *pidFile, *logFile))
+		if err != nil {
+			log.Fatalf("daemon: %v", err)
+		}
+		defer stop()
+	}
+
+	if *metricsAddr != "" {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
 
 	ocDBPath := openCodeDBPath()
 	ocDB, err := sql.Open("sqlite3", ocDBPath+"?mode=ro")
@@ -475,6 +666,7 @@ func runWatch(args []string, hanaDB, ollamaHost, embedModel, userAlias, assistan
 		log.Fatalf("open opencode db: %v", err)
 	}
 	defer ocDB.Close()
+	defer closeStatements(ocDB)
 
 	sessions, err := discoverSessions(ocDB)
 	if err != nil {
@@ -484,13 +676,27 @@ func runWatch(args []string, hanaDB, ollamaHost, embedModel, userAlias, assistan
 		log.Fatal("no OpenCode sessions found")
 	}
 
-	session, err := pickSession(sessions)
-	if err != nil {
+	if *project != "" {
+		if sessions = ocSessionsIn(sessions, *project); len(sessions) == 0 {
+			log.Fatalf("no OpenCode sessions in %s", *project)
+		}
+	}
+
+	var session ocSession
+	if *sessionID != "" || *latest {
+		// Under systemd or a script there is no one to answer the picker
+		if session, err = findSession(sessions, *sessionID, *latest); err != nil {
+			log.Fatalf("%v", err)
+		}
+	} else if session, err = pickSession(sessions); err != nil {
 		log.Fatalf("pick session: %v", err)
 	}
 
 	fmt.Println()
-	if err := watchPreflight(ollamaHost, embedModel); err != nil {
+	// The watcher catches Ctrl+C itself to flush what is pending, so its work runs to
+	// completion rather than on a cancellable context.
+	ctx := context.Background()
+	if err := watchPreflight(ctx, ollamaHost, embedModel); err != nil {
 		log.Fatalf("preflight: %v", err)
 	}
 
@@ -506,32 +712,55 @@ func runWatch(args []string, hanaDB, ollamaHost, embedModel, userAlias, assistan
 
 	ollama := NewOllamaClient("http://"+ollamaHost, embedModel)
 
-	db.Exec(`DELETE FROM vec_chunks WHERE chunk_id NOT IN (SELECT id FROM chunks)`)
+	removeOrphanVectors(db)
 
-	done := make(map[string]bool)
 	retry := make(map[string]int)
 	var pending []textMessage
+	var lastMessage time.Time
 
-	batchNum := 0
-	watchPrefix := fmt.Sprintf("watch://%s/batch-", session.ID)
-	var maxBatch sql.NullInt64
-	_ = db.QueryRow(
-		`SELECT MAX(CAST(REPLACE(source_file, ?, '') AS INTEGER)) FROM chunks WHERE source_file LIKE ?`,
-		watchPrefix, watchPrefix+"%",
-	).Scan(&maxBatch)
-	if maxBatch.Valid {
-		batchNum = int(maxBatch.Int64) + 1
+	batchNum := nextWatchSeq(db, fmt.Sprintf("watch://%s/batch-", session.ID))
+	summarizer := newSessionSummarizer(db, ollama, generateModel, fmt.Sprintf("watch://%s/summary-", session.ID), session.Title, time.Duration(*summaryIdle)*time.Minute)
+	titleModel := generateModel
+	if *noTitles {
+		titleModel = ""
 	}
 
-	done, err = getExistingMessageIDs(ocDB, session.ID)
+	done, watched, err := watchedIDs(db, watcherOC, session.ID)
 	if err != nil {
-		log.Fatalf("get existing messages: %v", err)
+		log.Fatalf("%v", err)
+	}
+	if watched {
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Resuming after %d processed messages. Watching for new...", len(done))))
+	} else {
+		// A session watched for the first time starts from now
+		if done, err = getExistingMessageIDs(ocDB, session.ID); err != nil {
+			log.Fatalf("get existing messages: %v", err)
+		}
+		existing := make([]string, 0, len(done))
+		for id := range done {
+			existing = append(existing, id)
+		}
+		if err := withWriteTx(db, "save watch state", func(tx *sql.Tx) error {
+			return saveWatchedIDs(tx, watcherOC, session.ID, existing)
+		}); err != nil {
+			log.Fatalf("%v", err)
+		}
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Skipping %d existing messages. Watching for new...", len(done))))
 	}
-	fmt.Println(infoStyle.Render(fmt.Sprintf("  Skipping %d existing messages. Watching for new...", len(done))))
 	fmt.Println()
 
+	// Messages given up on, recorded with the next batch
+	var unreadable []string
+	saveState := func(tx *sql.Tx) error {
+		ids := unreadable
+		for _, tm := range pending {
+			ids = append(ids, tm.MessageID)
+		}
+		return saveWatchedIDs(tx, watcherOC, session.ID, ids)
+	}
+
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
 	ticker := time.NewTicker(time.Duration(*pollSec) * time.Second)
 	defer ticker.Stop()
@@ -543,25 +772,51 @@ func runWatch(args []string, hanaDB, ollamaHost, embedModel, userAlias, assistan
 		fmt.Println()
 		fmt.Println(infoStyle.Render(fmt.Sprintf("  Flushing %d pending messages...", len(pending))))
 		sourceFile := fmt.Sprintf("watch://%s/batch-%d", session.ID, batchNum)
-		if err := ingestBatch(db, ollama, sourceFile, pending, session.Title); err != nil {
+		if err := ingestBatch(ctx, db, ollama, titleModel, sourceFile, pending, session.Title, chunking, saveState); err != nil {
 			fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Flush error: %v", err)))
 			return
 		}
+		unreadable = nil
 		batchNum++
 		fmt.Println(renderIngest(len(pending), batchNum))
 		pending = nil
 	}
 
+	summarizeSession := func() {
+		if summarizer == nil || len(summarizer.messages) == 0 {
+			return
+		}
+		fmt.Println(infoStyle.Render(fmt.Sprintf("  Summarizing %d messages...", len(summarizer.messages))))
+		sourceFile, err := summarizer.summarize(ctx, time.Now())
+		if err != nil {
+			fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Summary error: %v", err)))
+			return
+		}
+		if sourceFile != "" {
+			fmt.Println(renderPreflightStep("ok", "Stored session summary "+sourceFile))
+		}
+	}
+
 	for {
 		select {
 		case <-sigCh:
 			flushPending()
+			summarizeSession()
 			fmt.Println()
 			fmt.Println(infoStyle.Render("  Stopped."))
 			return
 		case <-ticker.C:
 		}
 
+		// A quiet session gets its last partial batch and a summary written
+		if summarizer.due(time.Now()) {
+			flushPending()
+			summarizeSession()
+		}
+		if idleFlushDue(len(pending), lastMessage, *flushAfter, time.Now()) {
+			flushPending()
+		}
+
 		newMsgs, err := getNewMessages(ocDB, session.ID, done)
 		if err != nil {
 			continue
@@ -573,6 +828,7 @@ func runWatch(args []string, hanaDB, ollamaHost, embedModel, userAlias, assistan
 				retry[msgID]++
 				if retry[msgID] > 60 {
 					done[msgID] = true
+					unreadable = append(unreadable, msgID)
 					delete(retry, msgID)
 				}
 				continue
@@ -581,21 +837,22 @@ func runWatch(args []string, hanaDB, ollamaHost, embedModel, userAlias, assistan
 			done[msgID] = true
 			delete(retry, msgID)
 			pending = append(pending, *tm)
+			lastMessage = time.Now()
+			summarizer.add(*tm, time.Now())
 
 			fmt.Println(renderMessage(tm.Role, tm.Timestamp.Format("15:04:05"), tm.Text, tm.IsUser))
 		}
 
 		if len(pending) >= *batchSize {
-			// Normalize text before ingestion
-			for i := range pending {
-				pending[i].Text = normalizeText(pending[i].Text)
-			}
-
 			sourceFile := fmt.Sprintf("watch://%s/batch-%d", session.ID, batchNum)
-			if err := ingestBatch(db, ollama, sourceFile, pending, session.Title); err != nil {
+			if err := ingestBatch(ctx, db, ollama, titleModel, sourceFile, pending, session.Title, chunking, saveState); err != nil {
 				fmt.Println(renderPreflightStep("fail", fmt.Sprintf("Ingest error: %v", err)))
+				if errors.Is(err, errDatabaseBusy) {
+					fmt.Println(infoStyle.Render(fmt.Sprintf("  Keeping %d messages for the next poll", len(pending))))
+				}
 				continue
 			}
+			unreadable = nil
 			batchNum++
 			fmt.Println()
 			fmt.Println(renderIngest(len(pending), batchNum))
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+func TestValuesPlaceholders(t *testing.T) {
+	if got := valuesPlaceholders(2, 3); got != "(?, ?, ?), (?, ?, ?)" {
+		t.Fatalf("unexpected placeholders %q", got)
+	}
+}
+
+func TestIngestBatchSingleTransaction(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	at := time.Date(2025, time.June, 3, 10, 0, 0, 0, time.UTC)
+	messages := []textMessage{
+		{Role: "User", Text: "Should auth tokens live in Postgres?", Timestamp: at, MessageID: "m1", SessionID: "s1"},
+		{Role: "Assistant", Text: "Yes, with a TTL column.", Timestamp: at.Add(time.Minute), MessageID: "m2", SessionID: "s1"},
+		{Role: "User", Text: "ok", Timestamp: at.Add(2 * time.Minute), MessageID: "m3", SessionID: "s1"},
+	}
+
+	// Vectors of the wrong size fail to insert after the messages were written in the
+	// same transaction
+	bad := newOllamaServer(t, make([]float32, 3))
+	defer bad.Close()
+	if err := ingestBatch(context.Background(), db, NewOllamaClient(bad.URL, "embed"), "", "watch://s1/batch-0", messages, "Backend", defaultChunking, nil); err == nil {
+		t.Fatal("expected the vector insert to fail")
+	}
+	var stored int
+	db.QueryRow(`SELECT (SELECT COUNT(*) FROM messages) + (SELECT COUNT(*) FROM chunks)`).Scan(&stored)
+	if stored != 0 {
+		t.Fatalf("expected a failed batch to leave nothing behind, got %d rows", stored)
+	}
+
+	good := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer good.Close()
+	client := NewOllamaClient(good.URL, "embed")
+	if err := ingestBatch(context.Background(), db, client, "", "watch://s1/batch-0", messages, "Backend", defaultChunking, nil); err != nil {
+		t.Fatalf("ingestBatch: %v", err)
+	}
+	var msgs, msgVecs, chunks, unvectored int
+	db.QueryRow(`SELECT COUNT(*) FROM messages`).Scan(&msgs)
+	db.QueryRow(`SELECT COUNT(*) FROM vec_messages`).Scan(&msgVecs)
+	db.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&chunks)
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE id NOT IN (SELECT chunk_id FROM vec_chunks)`).Scan(&unvectored)
+	if msgs != 3 || msgVecs != 2 || chunks == 0 || unvectored != 0 {
+		t.Fatalf("expected 3 messages (2 long enough for vectors) and vectored chunks, got %d, %d, %d, %d", msgs, msgVecs, chunks, unvectored)
+	}
+	if fts5Available {
+		var indexed int
+		db.QueryRow(`SELECT COUNT(*) FROM messages_fts WHERE messages_fts MATCH 'postgres OR ttl'`).Scan(&indexed)
+		if indexed != 2 {
+			t.Fatalf("expected the messages in the FTS index, got %d", indexed)
+		}
+	}
+
+	// Already stored messages are skipped on the next batch
+	again, err := prepareMessages(context.Background(), db, client, append(messages, textMessage{Role: "User", Text: "And the signing keys?", MessageID: "m4"}))
+	if err != nil || len(again) != 1 || again[0].message.MessageID != "m4" {
+		t.Fatalf("expected only the new message, got %+v, %v", again, err)
+	}
+}
+
+func TestStoreMarkdownChunksOrder(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	serialized, err := sqlite_vec.SerializeFloat32(vec)
+	if err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	// More than one multi-row statement's worth
+	var prepared []preparedChunk
+	for i := 0; i < multiRowBatch+50; i++ {
+		prepared = append(prepared, preparedChunk{
+			chunk:      ChunkData{Text: fmt.Sprintf("chunk %d", i), SectionTitle: "S", HeaderLevel: 2, SectionSequence: i + 1, ChunkSequence: 1, ChunkTotal: 1},
+			serialized: serialized,
+		})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	ids, err := storeMarkdownChunks(tx, "gen://a", prepared)
+	if err != nil {
+		t.Fatalf("storeMarkdownChunks: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	for i, id := range ids {
+		var text string
+		if err := db.QueryRow(`SELECT c.text FROM chunks c JOIN vec_chunks v ON v.chunk_id = c.id WHERE c.id = ?`, id).Scan(&text); err != nil || text != fmt.Sprintf("chunk %d", i) {
+			t.Fatalf("id %d: expected chunk %d with a vector, got %q, %v", id, i, text, err)
+		}
+	}
+}
+
+func TestIngestBatchKeepsOriginalText(t *testing.T) {
+	withNormalization(t, nil, nil)
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+
+	at := time.Date(2025, time.June, 3, 10, 0, 0, 0, time.UTC)
+	messages := []textMessage{
+		{Role: "User", Text: "We go accross the bridge", Timestamp: at, MessageID: "m1", SessionID: "s1"},
+		{Role: "User", Text: "Nothing to fix here", Timestamp: at, MessageID: "m2", SessionID: "s1"},
+	}
+	if err := ingestBatch(context.Background(), db, NewOllamaClient(server.URL, "embed"), "", "watch://s1/batch-0", messages, "Travel", defaultChunking, nil); err != nil {
+		t.Fatalf("ingestBatch: %v", err)
+	}
+	var text string
+	var normalized *string
+	db.QueryRow(`SELECT text, normalized_text FROM messages WHERE id = 'm1'`).Scan(&text, &normalized)
+	if text != "We go accross the bridge" || normalized == nil || *normalized != "We go across the bridge" {
+		t.Fatalf("expected the original kept beside the correction, got %q, %v", text, normalized)
+	}
+	db.QueryRow(`SELECT text, normalized_text FROM messages WHERE id = 'm2'`).Scan(&text, &normalized)
+	if normalized != nil {
+		t.Fatalf("expected no normalized text when nothing changed, got %q", *normalized)
+	}
+	var chunkText string
+	db.QueryRow(`SELECT text, normalized_text FROM chunks WHERE text LIKE '%accross%'`).Scan(&chunkText, &normalized)
+	if !strings.Contains(chunkText, "accross") || normalized == nil || !strings.Contains(*normalized, "across the bridge") {
+		t.Fatalf("expected the chunk's original and normalized text, got %q, %v", chunkText, normalized)
+	}
+}
+
+func TestFindSession(t *testing.T) {
+	sessions := []ocSession{
+		{ID: "s3", Dir: "/home/me/site"},
+		{ID: "s2", Dir: "/home/me/app/"},
+		{ID: "s1", Dir: "/home/me/app"},
+	}
+	app := ocSessionsIn(sessions, "/home/me/app")
+	if len(app) != 2 || app[0].ID != "s2" {
+		t.Fatalf("expected the two sessions run in the app, got %+v", app)
+	}
+	if s, err := findSession(app, "", true); err != nil || s.ID != "s2" {
+		t.Fatalf("expected the most recent session, got %q, %v", s.ID, err)
+	}
+	if s, err := findSession(sessions, "s1", false); err != nil || s.ID != "s1" {
+		t.Fatalf("expected the session by ID, got %q, %v", s.ID, err)
+	}
+	if _, err := findSession(app, "s3", false); err == nil {
+		t.Fatal("expected an error for a session outside the project")
+	}
+}
+
+func TestIdleFlushDue(t *testing.T) {
+	last := time.Date(2025, 6, 3, 10, 0, 0, 0, time.UTC)
+	if idleFlushDue(2, last, 5*time.Minute, last.Add(4*time.Minute)) {
+		t.Fatal("expected no flush before the session went quiet")
+	}
+	if !idleFlushDue(2, last, 5*time.Minute, last.Add(5*time.Minute)) {
+		t.Fatal("expected a flush once quiet for flushAfter")
+	}
+	if idleFlushDue(0, last, 5*time.Minute, last.Add(time.Hour)) || idleFlushDue(2, last, 0, last.Add(time.Hour)) {
+		t.Fatal("expected no flush with nothing pending or the timer off")
+	}
+}
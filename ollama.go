@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -15,12 +17,15 @@ type OllamaClient struct {
 	baseURL    string
 	httpClient *http.Client
 	embedModel string
+	// concurrency is how many chunks ingest embeds at once (see embedChunks)
+	concurrency int
 }
 
 func NewOllamaClient(baseURL, embedModel string) *OllamaClient {
 	return &OllamaClient{
-		baseURL:    baseURL,
-		embedModel: embedModel,
+		baseURL:     baseURL,
+		embedModel:  embedModel,
+		concurrency: embedConcurrency,
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second,
 		},
@@ -40,6 +45,13 @@ type embedResponse struct {
 
 // Embed calls Ollama /api/embed endpoint and returns a float32 vector
 func (c *OllamaClient) Embed(ctx context.Context, text string) ([]float32, error) {
+	start := time.Now()
+	embedding, err := c.embed(ctx, text)
+	recordOllamaCall("embed", embedLatency, start, err)
+	return embedding, err
+}
+
+func (c *OllamaClient) embed(ctx context.Context, text string) ([]float32, error) {
 	reqBody := embedRequest{
 		Model: c.embedModel,
 		Input: text,
@@ -98,6 +110,7 @@ type generateRequest struct {
 	System string `json:"system"`
 	Prompt string `json:"prompt"`
 	Stream bool   `json:"stream"`
+	Format string `json:"format,omitempty"`
 }
 
 // generateResponse is the response from /api/generate
@@ -107,13 +120,34 @@ type generateResponse struct {
 
 // GenerateAnswer calls Ollama /api/generate endpoint and returns response text
 func (c *OllamaClient) GenerateAnswer(ctx context.Context, model, systemPrompt, userPrompt string) (string, error) {
-	reqBody := generateRequest{
+	return c.generate(ctx, generateRequest{
 		Model:  model,
 		System: systemPrompt,
 		Prompt: userPrompt,
 		Stream: false,
-	}
+	})
+}
+
+// GenerateJSON is GenerateAnswer with Ollama's JSON mode enabled, so the
+// response is constrained to a single valid JSON value.
+func (c *OllamaClient) GenerateJSON(ctx context.Context, model, systemPrompt, userPrompt string) (string, error) {
+	return c.generate(ctx, generateRequest{
+		Model:  model,
+		System: systemPrompt,
+		Prompt: userPrompt,
+		Stream: false,
+		Format: "json",
+	})
+}
 
+func (c *OllamaClient) generate(ctx context.Context, reqBody generateRequest) (string, error) {
+	start := time.Now()
+	response, err := c.requestGenerate(ctx, reqBody)
+	recordOllamaCall("generate", generateTime, start, err)
+	return response, err
+}
+
+func (c *OllamaClient) requestGenerate(ctx context.Context, reqBody generateRequest) (string, error) {
 	body, err := json.Marshal(reqBody)
 	if err != nil {
 		log.Printf("marshal generate request: %v", err)
@@ -166,3 +200,11 @@ func (c *OllamaClient) IsHealthy(ctx context.Context) bool {
 
 	return resp.StatusCode == http.StatusOK
 }
+
+// ollamaUnreachable reports whether err, from a request made with ctx, means the Ollama
+// server could not be reached at all (refused, unresolvable, timed out) rather than
+// that it answered with an error or that ctx itself ended.
+func ollamaUnreachable(ctx context.Context, err error) bool {
+	var urlErr *url.Error
+	return ctx.Err() == nil && errors.As(err, &urlErr)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Recollection is a chunk surfaced by OnThisDay: either dated on this day in an
+// earlier year, or ingested a whole number of weeks ago.
+type Recollection struct {
+	HistoryResult
+	YearsAgo int `json:",omitempty"`
+	WeeksAgo int `json:",omitempty"`
+}
+
+// OnThisDay returns chunks whose valid_at falls on day's month and day in previous
+// years (most recent year first), then chunks ingested exactly N weeks before day for
+// each N in weeks. On Feb 28 of a non-leap year, Feb 29 anniversaries are included.
+// If limit <= 0 it defaults to 20; it applies to each group separately.
+func OnThisDay(db *sql.DB, day time.Time, weeks []int, limit int) ([]Recollection, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	monthDays := []string{day.Format("01-02")}
+	if day.Month() == time.February && day.Day() == 28 && time.Date(day.Year(), time.February, 29, 0, 0, 0, 0, time.UTC).Day() != 29 {
+		monthDays = append(monthDays, "02-29")
+	}
+
+	rows, err := db.Query(
+		`SELECT id, text, source_file, section_title, parent_title, valid_at, ingested_at
+		 FROM chunks
+		 WHERE substr(valid_at, 6, 5) IN (?, ?) AND substr(valid_at, 1, 4) < ?
+		 ORDER BY valid_at DESC, section_sequence ASC
+		 LIMIT ?`,
+		monthDays[0], monthDays[len(monthDays)-1], day.Format("2006"), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	results, err := scanRecollections(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if validAt, err := time.Parse("2006-01-02", results[i].ValidAt); err == nil {
+			results[i].YearsAgo = day.Year() - validAt.Year()
+		}
+	}
+
+	for _, n := range weeks {
+		if n <= 0 {
+			continue
+		}
+		rows, err := db.Query(
+			`SELECT id, text, source_file, section_title, parent_title, valid_at, ingested_at
+			 FROM chunks
+			 WHERE local_date(ingested_at) = ?
+			 ORDER BY ingested_at ASC, section_sequence ASC
+			 LIMIT ?`,
+			day.AddDate(0, 0, -7*n).Format("2006-01-02"), limit,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ingested, err := scanRecollections(rows)
+		if err != nil {
+			return nil, err
+		}
+		for i := range ingested {
+			ingested[i].WeeksAgo = n
+		}
+		results = append(results, ingested...)
+	}
+	return results, nil
+}
+
+func scanRecollections(rows *sql.Rows) ([]Recollection, error) {
+	defer rows.Close()
+	results := []Recollection{}
+	for rows.Next() {
+		var r Recollection
+		var parentTitle, validAt sql.NullString
+		if err := rows.Scan(&r.ID, &r.Text, &r.SourceFile, &r.SectionTitle, &parentTitle, &validAt, &r.IngestedAt); err != nil {
+			return nil, err
+		}
+		r.ParentTitle = parentTitle.String
+		r.ValidAt = validAt.String
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOnThisDay(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	insertChunk(t, db, "Moved into the flat.", "a.md", "Moving day", "", 2, "2023-03-14", vec)
+	insertChunk(t, db, "Started the new job.", "b.md", "First day", "", 2, "2025-03-14", vec)
+	insertChunk(t, db, "Today, not an anniversary.", "c.md", "Today", "", 2, "2026-03-14", vec)
+	insertChunk(t, db, "Different day.", "d.md", "Other", "", 2, "2025-03-15", vec)
+	recent := insertChunk(t, db, "Ingested a while back.", "e.md", "Backlog", "", 2, "", vec)
+	if _, err := db.Exec(`UPDATE chunks SET ingested_at = '2026-02-14T09:30:00Z' WHERE id = ?`, recent); err != nil {
+		t.Fatalf("set ingested_at: %v", err)
+	}
+
+	day := time.Date(2026, time.March, 14, 12, 0, 0, 0, time.UTC)
+	results, err := OnThisDay(db, day, []int{4}, 0)
+	if err != nil {
+		t.Fatalf("OnThisDay: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d: %+v", len(results), results)
+	}
+	if results[0].SectionTitle != "First day" || results[0].YearsAgo != 1 {
+		t.Fatalf("expected most recent anniversary first, got %+v", results[0])
+	}
+	if results[1].SectionTitle != "Moving day" || results[1].YearsAgo != 3 {
+		t.Fatalf("unexpected second result: %+v", results[1])
+	}
+	if results[2].SectionTitle != "Backlog" || results[2].WeeksAgo != 4 {
+		t.Fatalf("expected chunk ingested 4 weeks ago, got %+v", results[2])
+	}
+}
+
+func TestOnThisDayLeapDay(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	insertChunk(t, db, "Leap day party.", "a.md", "Leap", "", 2, "2024-02-29", makeVec(map[int]float32{0: 1}))
+
+	results, err := OnThisDay(db, time.Date(2026, time.February, 28, 0, 0, 0, 0, time.UTC), nil, 0)
+	if err != nil {
+		t.Fatalf("OnThisDay: %v", err)
+	}
+	if len(results) != 1 || results[0].YearsAgo != 2 {
+		t.Fatalf("expected leap-day anniversary on Feb 28, got %+v", results)
+	}
+
+	results, err = OnThisDay(db, time.Date(2028, time.February, 28, 0, 0, 0, 0, time.UTC), nil, 0)
+	if err != nil {
+		t.Fatalf("OnThisDay: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("leap years should wait for Feb 29, got %+v", results)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// jsonOutput is set by the global --json flag: commands print their results as JSON on
+// stdout instead of text.
+var jsonOutput bool
+
+// extractJSONFlag removes --json (or --json=true|false) from args wherever it appears,
+// before or after the command name, as extractDBFlag does for --db.
+func extractJSONFlag(args []string) (bool, []string) {
+	value := false
+	rest := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, setting, hasSetting := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "json" {
+			rest = append(rest, arg)
+			continue
+		}
+		value = true
+		if hasSetting {
+			if parsed, err := strconv.ParseBool(setting); err == nil {
+				value = parsed
+			}
+		}
+	}
+	return value, rest
+}
+
+// printJSON prints v to stdout as indented JSON.
+func printJSON(v any) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatalf("marshal output: %v", err)
+	}
+	fmt.Println(string(out))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractJSONFlag(t *testing.T) {
+	cases := []struct {
+		args     []string
+		wantJSON bool
+		wantRest []string
+	}{
+		{[]string{"search", "query"}, false, []string{"search", "query"}},
+		{[]string{"--json", "status"}, true, []string{"status"}},
+		{[]string{"search", "--limit", "5", "-json", "query"}, true, []string{"search", "--limit", "5", "query"}},
+		{[]string{"ask", "--json=false", "question"}, false, []string{"ask", "question"}},
+		{[]string{"search", "--json-ish", "json"}, false, []string{"search", "--json-ish", "json"}},
+		{[]string{"note", "--", "--json"}, false, []string{"note", "--", "--json"}},
+	}
+
+	for _, tc := range cases {
+		json, rest := extractJSONFlag(tc.args)
+		if json != tc.wantJSON {
+			t.Errorf("extractJSONFlag(%v): json = %v, want %v", tc.args, json, tc.wantJSON)
+		}
+		if !reflect.DeepEqual(rest, tc.wantRest) {
+			t.Errorf("extractJSONFlag(%v): rest = %v, want %v", tc.args, rest, tc.wantRest)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// defaultPackBudget is the token budget of a context pack when none is given.
+const defaultPackBudget = 4000
+
+// packCandidates is how many search results a pack chooses its chunks from.
+const packCandidates = 30
+
+// packRelevance weighs relevance against novelty when picking chunks (maximal marginal
+// relevance): 1 picks purely by similarity, lower values skip near-repeats sooner.
+const packRelevance = 0.7
+
+// packProfiles caps how many entity profiles a pack carries, and packProfileShare how
+// much of the budget they may take.
+const (
+	packProfiles     = 3
+	packProfileShare = 0.25
+)
+
+// PackChunk is one chunk in a context pack.
+type PackChunk struct {
+	ID           int    `json:"id"`
+	SourceFile   string `json:"source_file"`
+	SectionTitle string `json:"section_title"`
+	ValidAt      string `json:"valid_at,omitempty"`
+	Text         string `json:"text"`
+	Tokens       int    `json:"tokens"`
+}
+
+// ContextPack is a bundle of memories sized for an agent's context window: pinned
+// chunks, the most relevant chunks that don't repeat each other, and cached profiles
+// of the entities they mention.
+type ContextPack struct {
+	Query    string           `json:"query"`
+	Budget   int              `json:"budget"`
+	Tokens   int              `json:"tokens"`
+	Pinned   []PackChunk      `json:"pinned"`
+	Chunks   []PackChunk      `json:"chunks"`
+	Profiles []*EntityProfile `json:"profiles"`
+	// Omitted counts relevant chunks and pins left out for lack of budget.
+	Omitted int `json:"omitted"`
+}
+
+// PackOptions narrows the chunks a pack draws from.
+type PackOptions struct {
+	Budget  int
+	AsOf    string
+	Current bool
+}
+
+// estimateTokens approximates a BPE tokenizer, an embedding model's or a chat model's:
+// a run of letters and digits costs a token per four characters, and any other symbol a
+// token of its own, since operators and brackets rarely merge. Counting words instead
+// undercounts code; CJK characters are a token each.
+func estimateTokens(s string) int {
+	tokens, run := 0, 0
+	for _, r := range s {
+		if r >= 0x2E80 && unicode.IsLetter(r) {
+			tokens++
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			run++
+			continue
+		} else if !unicode.IsSpace(r) {
+			tokens++
+		}
+		tokens += (run + 3) / 4
+		run = 0
+	}
+	return tokens + (run+3)/4
+}
+
+func packChunkMarkdown(c PackChunk) string {
+	return fmt.Sprintf("### %s — %s (%s)\n\n%s\n\n", c.SourceFile, c.SectionTitle, dateLabel(c.ValidAt), strings.TrimSpace(c.Text))
+}
+
+func packProfileMarkdown(p *EntityProfile) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", p.Entity)
+	for _, f := range p.KeyFacts {
+		b.WriteString("- " + f + "\n")
+	}
+	for _, e := range p.RecentEvents {
+		fmt.Fprintf(&b, "- [%s] %s\n", dateLabel(e.Date), e.Event)
+	}
+	for _, t := range p.OpenThreads {
+		b.WriteString("- Open: " + t + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func newPackChunk(r SearchResult) PackChunk {
+	c := PackChunk{ID: r.ID, SourceFile: r.SourceFile, SectionTitle: r.SectionTitle, ValidAt: r.ValidAt, Text: r.Text}
+	c.Tokens = estimateTokens(packChunkMarkdown(c))
+	return c
+}
+
+// diversify orders results by maximal marginal relevance: each pick is the result most
+// similar to the query after a penalty for its similarity to the results already picked.
+// Results without a stored embedding keep their relevance unpenalized.
+func diversify(db *sql.DB, results []SearchResult) ([]SearchResult, error) {
+	vecs := make([][]float32, len(results))
+	for i, r := range results {
+		var blob []byte
+		err := db.QueryRow(`SELECT embedding FROM vec_chunks WHERE chunk_id = ?`, r.ID).Scan(&blob)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if vecs[i], err = deserializeFloat32(blob); err != nil {
+			return nil, err
+		}
+		normalizeVec(vecs[i])
+	}
+
+	picked := make([]bool, len(results))
+	ordered := make([]SearchResult, 0, len(results))
+	var chosen []int
+	for len(ordered) < len(results) {
+		best, bestScore := -1, 0.0
+		for i, r := range results {
+			if picked[i] {
+				continue
+			}
+			redundancy := 0.0
+			for _, j := range chosen {
+				if vecs[i] != nil && vecs[j] != nil {
+					if sim := float64(dotVec(vecs[i], vecs[j])); sim > redundancy {
+						redundancy = sim
+					}
+				}
+			}
+			score := packRelevance*(1-r.Distance) - (1-packRelevance)*redundancy
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		picked[best] = true
+		chosen = append(chosen, best)
+		ordered = append(ordered, results[best])
+	}
+	return ordered, nil
+}
+
+// packEntities returns the names of the entities most often linked to chunkIDs.
+func packEntities(db *sql.DB, chunkIDs []int64) ([]string, error) {
+	if len(chunkIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(chunkIDs))
+	for i, id := range chunkIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(
+		`SELECT e.name FROM chunk_entities ce JOIN entities e ON e.id = ce.entity_id
+		 WHERE ce.chunk_id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(chunkIDs)), ",")+`)
+		 GROUP BY e.id ORDER BY COUNT(*) DESC, e.name ASC LIMIT 10`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// BuildContextPack assembles the memories an agent should see for query within
+// opts.Budget tokens. Pinned chunks come first, then cached profiles of the entities the
+// relevant chunks mention (at most packProfileShare of the budget), then relevant
+// chunks in diversified order. Items that don't fit are skipped in favor of smaller ones
+// further down. Profiles are read from the cache only; run profile to build them. The
+// packed chunks count as retrieved.
+func BuildContextPack(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, opts PackOptions) (*ContextPack, error) {
+	if opts.Budget <= 0 {
+		opts.Budget = defaultPackBudget
+	}
+	pack := &ContextPack{Query: query, Budget: opts.Budget, Pinned: []PackChunk{}, Chunks: []PackChunk{}, Profiles: []*EntityProfile{}}
+
+	results, err := SearchWithOptions(ctx, db, ollama, query, SearchOptions{
+		Limit: packCandidates, AsOf: opts.AsOf, Current: opts.Current, IncludePinned: true, ByRelevance: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var pinned, matches []SearchResult
+	for _, r := range results {
+		if r.Pinned {
+			pinned = append(pinned, r)
+		} else {
+			matches = append(matches, r)
+		}
+	}
+
+	// Headings of the rendered pack
+	used := estimateTokens(fmt.Sprintf("# Context: %s\n\n## Pinned\n\n## People and projects\n\n## Relevant memories\n\n", query))
+	for _, r := range pinned {
+		c := newPackChunk(r)
+		if used+c.Tokens > opts.Budget {
+			pack.Omitted++
+			continue
+		}
+		used += c.Tokens
+		pack.Pinned = append(pack.Pinned, c)
+	}
+
+	ids := make([]int64, len(matches))
+	for i, r := range matches {
+		ids[i] = int64(r.ID)
+	}
+	names, err := packEntities(db, ids)
+	if err != nil {
+		return nil, fmt.Errorf("find entities: %w", err)
+	}
+	profileBudget := int(float64(opts.Budget) * packProfileShare)
+	for _, name := range names {
+		if len(pack.Profiles) == packProfiles {
+			break
+		}
+		profile, err := LoadProfile(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("load profile of %s: %w", name, err)
+		}
+		if profile == nil {
+			continue
+		}
+		tokens := estimateTokens(packProfileMarkdown(profile))
+		if tokens > profileBudget || used+tokens > opts.Budget {
+			continue
+		}
+		profileBudget -= tokens
+		used += tokens
+		pack.Profiles = append(pack.Profiles, profile)
+	}
+
+	ordered, err := diversify(db, matches)
+	if err != nil {
+		return nil, fmt.Errorf("diversify: %w", err)
+	}
+	var packed []int64
+	for _, r := range ordered {
+		c := newPackChunk(r)
+		if used+c.Tokens > opts.Budget {
+			pack.Omitted++
+			continue
+		}
+		used += c.Tokens
+		pack.Chunks = append(pack.Chunks, c)
+		packed = append(packed, int64(c.ID))
+	}
+	pack.Tokens = used
+
+	if len(packed) > 0 {
+		if err := RecordRetrieval(db, packed, time.Now()); err != nil {
+			return nil, fmt.Errorf("record retrieval: %w", err)
+		}
+	}
+	return pack, nil
+}
+
+// RenderPackMarkdown formats a pack for pasting into a prompt, leaving out empty parts.
+func RenderPackMarkdown(p *ContextPack) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Context: %s\n\n", p.Query)
+	if len(p.Pinned) > 0 {
+		b.WriteString("## Pinned\n\n")
+		for _, c := range p.Pinned {
+			b.WriteString(packChunkMarkdown(c))
+		}
+	}
+	if len(p.Profiles) > 0 {
+		b.WriteString("## People and projects\n\n")
+		for _, profile := range p.Profiles {
+			b.WriteString(packProfileMarkdown(profile))
+		}
+	}
+	if len(p.Chunks) > 0 {
+		b.WriteString("## Relevant memories\n\n")
+		for _, c := range p.Chunks {
+			b.WriteString(packChunkMarkdown(c))
+		}
+	}
+	return b.String()
+}
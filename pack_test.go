@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildContextPack(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	a := insertChunk(t, db, "Auth tokens move to Postgres.", "a.md", "Tokens", "", 2, "2025-06-02", makeVec(map[int]float32{0: 1, 1: 0.01}))
+	repeat := insertChunk(t, db, "Auth tokens are moving to Postgres.", "b.md", "Tokens again", "", 2, "2025-06-03", makeVec(map[int]float32{0: 1, 1: 0.01, 2: 0.03}))
+	other := insertChunk(t, db, "The migration runs on Friday.", "c.md", "Migration", "", 2, "2025-06-04", makeVec(map[int]float32{1: 1}))
+	long := insertChunk(t, db, strings.Repeat("Background detail. ", 200), "d.md", "Background", "", 2, "", makeVec(map[int]float32{0: 0.3, 3: 1}))
+	pinned := insertChunk(t, db, "I prefer small PRs.", "me.md", "Preferences", "", 2, "", makeVec(map[int]float32{4: 1}))
+	if _, err := PinChunks(db, []int64{pinned}, time.Now()); err != nil {
+		t.Fatalf("PinChunks: %v", err)
+	}
+
+	res, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES ('Postgres', 'tool', '2025-06-01')`)
+	if err != nil {
+		t.Fatalf("insert entity: %v", err)
+	}
+	entityID, _ := res.LastInsertId()
+	db.Exec(`INSERT INTO chunk_entities (chunk_id, entity_id) VALUES (?, ?)`, a, entityID)
+	db.Exec(`INSERT INTO entity_profiles (name, profile, last_chunk_id, chunk_count, updated_at) VALUES ('Postgres', ?, ?, 1, '2025-06-05')`,
+		`{"key_facts": ["Stores auth tokens"], "recent_events": [], "open_threads": ["Token TTL"]}`, a)
+
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1, 1: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	pack, err := BuildContextPack(context.Background(), db, client, "auth migration", PackOptions{Budget: 400})
+	if err != nil {
+		t.Fatalf("BuildContextPack: %v", err)
+	}
+	if len(pack.Pinned) != 1 || pack.Pinned[0].ID != int(pinned) {
+		t.Fatalf("expected the pinned chunk, got %+v", pack.Pinned)
+	}
+	if len(pack.Profiles) != 1 || pack.Profiles[0].Entity != "Postgres" {
+		t.Fatalf("expected the Postgres profile, got %+v", pack.Profiles)
+	}
+	var ids []int
+	for _, c := range pack.Chunks {
+		ids = append(ids, c.ID)
+	}
+	if len(ids) != 3 || ids[0] != int(a) || ids[1] != int(other) || ids[2] != int(repeat) {
+		t.Fatalf("expected the near-repeat after the new information and the long chunk left out, got %v", ids)
+	}
+	if pack.Omitted != 1 || pack.Tokens > pack.Budget {
+		t.Fatalf("expected one item omitted within budget, got %d omitted, %d of %d tokens", pack.Omitted, pack.Tokens, pack.Budget)
+	}
+
+	md := RenderPackMarkdown(pack)
+	for _, want := range []string{"# Context: auth migration", "## Pinned", "I prefer small PRs.", "## People and projects", "- Open: Token TTL", "## Relevant memories", "### c.md — Migration (2025-06-04)"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in pack:\n%s", want, md)
+		}
+	}
+	if estimateTokens(md) > pack.Budget {
+		t.Fatalf("rendered pack is %d tokens, over the %d budget", estimateTokens(md), pack.Budget)
+	}
+
+	var retrieved int
+	db.QueryRow(`SELECT retrieval_count FROM chunks WHERE id = ?`, long).Scan(&retrieved)
+	if retrieved != 0 {
+		t.Fatal("expected chunks left out of the pack not to count as retrieved")
+	}
+	db.QueryRow(`SELECT retrieval_count FROM chunks WHERE id = ?`, other).Scan(&retrieved)
+	if retrieved != 1 {
+		t.Fatalf("expected packed chunks to count as retrieved, got %d", retrieved)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Trend directions for PersonTrend, comparing a window with the one before it.
+const (
+	trendNew    = "new"
+	trendUp     = "up"
+	trendDown   = "down"
+	trendSteady = "steady"
+)
+
+// PersonTrend is one row of the people digest.
+type PersonTrend struct {
+	Name     string `json:"name"`
+	Mentions int    `json:"mentions"`
+	Previous int    `json:"previous"`
+	Trend    string `json:"trend"`
+	LastSeen string `json:"last_seen"`
+}
+
+// PeopleDigest ranks people (entities of type person) by how many chunks dated in the
+// days-long window ending on end mention them, compared with the window before. People
+// mentioned only in the earlier window are kept, with a downward trend, so fading
+// contacts show up. If days <= 0 it defaults to 30; if limit <= 0, to 20.
+func PeopleDigest(db *sql.DB, end time.Time, days, limit int) ([]PersonTrend, error) {
+	if days <= 0 {
+		days = 30
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	// Windows are half-open date ranges: [start, stop)
+	stop := end.AddDate(0, 0, 1).Format("2006-01-02")
+	start := end.AddDate(0, 0, 1-days).Format("2006-01-02")
+	prevStart := end.AddDate(0, 0, 1-2*days).Format("2006-01-02")
+
+	rows, err := db.Query(
+		`SELECT e.name,
+		        SUM(CASE WHEN c.valid_at >= ? THEN 1 ELSE 0 END) AS current,
+		        SUM(CASE WHEN c.valid_at < ? THEN 1 ELSE 0 END) AS previous,
+		        (SELECT MAX(c2.valid_at) FROM chunk_entities ce2 JOIN chunks c2 ON c2.id = ce2.chunk_id
+		         WHERE ce2.entity_id = e.id AND c2.valid_at < ?) AS last_seen
+		 FROM entities e
+		 JOIN chunk_entities ce ON ce.entity_id = e.id
+		 JOIN chunks c ON c.id = ce.chunk_id
+		 WHERE e.kind = ? AND c.valid_at >= ? AND c.valid_at < ?
+		 GROUP BY e.id
+		 ORDER BY current DESC, last_seen DESC, previous DESC, e.name
+		 LIMIT ?`,
+		start, start, stop, entityKindPerson, prevStart, stop, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	people := []PersonTrend{}
+	for rows.Next() {
+		var p PersonTrend
+		var lastSeen sql.NullString
+		if err := rows.Scan(&p.Name, &p.Mentions, &p.Previous, &lastSeen); err != nil {
+			return nil, err
+		}
+		p.LastSeen = lastSeen.String
+		switch {
+		case p.Previous == 0:
+			p.Trend = trendNew
+		case p.Mentions > p.Previous:
+			p.Trend = trendUp
+		case p.Mentions < p.Previous:
+			p.Trend = trendDown
+		default:
+			p.Trend = trendSteady
+		}
+		people = append(people, p)
+	}
+	return people, rows.Err()
+}
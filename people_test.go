@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeopleDigest(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	for _, e := range []struct{ name, kind string }{
+		{"Priya", entityKindPerson},
+		{"Sam", entityKindPerson},
+		{"Jo", entityKindPerson},
+		{"Mneme", entityKindProject},
+	} {
+		if _, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES (?, ?, '2025-01-01T00:00:00Z')`, e.name, e.kind); err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+	}
+
+	vec := makeVec(map[int]float32{0: 1})
+	chunks := []struct{ text, validAt string }{
+		{"Priya and Mneme planning.", "2025-03-05"},
+		{"Priya again.", "2025-03-20"},
+		{"Priya once more.", "2025-03-28"},
+		{"Priya last month.", "2025-02-10"},
+		{"Sam in the earlier window.", "2025-02-15"},
+		{"Sam twice earlier.", "2025-02-20"},
+		{"Sam this window.", "2025-03-10"},
+		{"Jo is new.", "2025-03-30"},
+		{"Jo long ago.", "2024-06-01"},
+		{"Priya in the future.", "2025-04-02"},
+	}
+	for i, c := range chunks {
+		insertChunk(t, db, c.text, string(rune('a'+i))+".md", "S", "", 2, c.validAt, vec)
+	}
+	if err := ReindexEntityMentions(db); err != nil {
+		t.Fatalf("ReindexEntityMentions: %v", err)
+	}
+
+	people, err := PeopleDigest(db, time.Date(2025, time.March, 31, 0, 0, 0, 0, time.UTC), 30, 0)
+	if err != nil {
+		t.Fatalf("PeopleDigest: %v", err)
+	}
+	if len(people) != 3 {
+		t.Fatalf("expected 3 people (no projects), got %+v", people)
+	}
+
+	expected := []PersonTrend{
+		{Name: "Priya", Mentions: 3, Previous: 1, Trend: trendUp, LastSeen: "2025-03-28"},
+		{Name: "Jo", Mentions: 1, Previous: 0, Trend: trendNew, LastSeen: "2025-03-30"},
+		{Name: "Sam", Mentions: 1, Previous: 2, Trend: trendDown, LastSeen: "2025-03-10"},
+	}
+	for i, want := range expected {
+		if people[i] != want {
+			t.Fatalf("row %d: expected %+v, got %+v", i, want, people[i])
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PinChunks pins chunks so pinned-aware retrieval always returns them, whatever their
+// similarity to the query. Pinned chunks are also kept out of pruning and archiving;
+// pinning an archived chunk unarchives it. It returns how many chunks changed.
+func PinChunks(db *sql.DB, chunkIDs []int64, now time.Time) (int, error) {
+	pinnedAt := now.UTC().Format(time.RFC3339)
+	changed := 0
+	for _, id := range chunkIDs {
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM chunks WHERE id = ?)`, id).Scan(&exists); err != nil {
+			return changed, err
+		}
+		if !exists {
+			return changed, fmt.Errorf("chunk %d not found", id)
+		}
+		var n int64
+		err := retryBusy("pin chunk", func() error {
+			res, err := db.Exec(`UPDATE chunks SET pinned_at = ?, archived_at = NULL WHERE id = ? AND pinned_at IS NULL`, pinnedAt, id)
+			if err != nil {
+				return err
+			}
+			n, _ = res.RowsAffected()
+			return nil
+		})
+		if err != nil {
+			return changed, fmt.Errorf("pin chunk %d: %w", id, err)
+		}
+		changed += int(n)
+	}
+	return changed, nil
+}
+
+// UnpinChunks clears the pin on chunks and returns how many were pinned.
+func UnpinChunks(db *sql.DB, chunkIDs []int64) (int, error) {
+	changed := 0
+	for _, id := range chunkIDs {
+		var n int64
+		err := retryBusy("unpin chunk", func() error {
+			res, err := db.Exec(`UPDATE chunks SET pinned_at = NULL WHERE id = ? AND pinned_at IS NOT NULL`, id)
+			if err != nil {
+				return err
+			}
+			n, _ = res.RowsAffected()
+			return nil
+		})
+		if err != nil {
+			return changed, fmt.Errorf("unpin chunk %d: %w", id, err)
+		}
+		changed += int(n)
+	}
+	return changed, nil
+}
+
+// PinnedChunks returns every pinned chunk, oldest pin first. With an embedding, each
+// result's Distance is its cosine distance to it; otherwise Distance is 0.
+func PinnedChunks(db *sql.DB, embedding []byte) ([]SearchResult, error) {
+	distance := `0`
+	var args []any
+	if embedding != nil {
+		distance = `COALESCE(vec_distance_cosine(v.embedding, ?), 1)`
+		args = append(args, embedding)
+	}
+	rows, err := db.Query(
+		`SELECT c.id, `+distance+`, c.text, c.source_file, c.section_title, c.parent_title, c.header_level, c.valid_at, c.valid_until, c.superseded_by, c.importance
+		 FROM chunks c
+		 LEFT JOIN vec_chunks v ON v.chunk_id = c.id
+		 WHERE c.pinned_at IS NOT NULL
+		 ORDER BY c.pinned_at ASC, c.id ASC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		r := SearchResult{Pinned: true}
+		var parentTitle, validAt, validUntil sql.NullString
+		var supersededBy sql.NullInt64
+		var importance sql.NullFloat64
+		if err := rows.Scan(&r.ID, &r.Distance, &r.Text, &r.SourceFile, &r.SectionTitle, &parentTitle, &r.HeaderLevel, &validAt, &validUntil, &supersededBy, &importance); err != nil {
+			return nil, err
+		}
+		r.ParentTitle = parentTitle.String
+		r.ValidAt = validAt.String
+		r.ValidUntil = validUntil.String
+		r.SupersededBy = supersededBy.Int64
+		r.Importance = importance.Float64
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// withPinned puts every pinned chunk ahead of results, marking pinned chunks the search
+// already found rather than listing them twice.
+func withPinned(db *sql.DB, embedding []byte, results []SearchResult) ([]SearchResult, error) {
+	pinned, err := PinnedChunks(db, embedding)
+	if err != nil {
+		return nil, fmt.Errorf("load pinned chunks: %w", err)
+	}
+	if len(pinned) == 0 {
+		return results, nil
+	}
+	found := make(map[int]bool, len(pinned))
+	for _, p := range pinned {
+		found[p.ID] = true
+	}
+	merged := pinned
+	for _, r := range results {
+		if !found[r.ID] {
+			merged = append(merged, r)
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPinnedSearch(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	query := makeVec(map[int]float32{0: 1})
+	close1 := insertChunk(t, db, "close", "a.md", "Close", "", 2, "2025-06-02", query)
+	close2 := insertChunk(t, db, "also close", "b.md", "Also close", "", 2, "2025-06-01", makeVec(map[int]float32{0: 1, 1: 0.2}))
+	far := insertChunk(t, db, "I am vegetarian.", "me.md", "Diet", "", 2, "", makeVec(map[int]float32{1: 1}))
+
+	if _, err := db.Exec(`UPDATE chunks SET archived_at = '2025-01-01T00:00:00Z', importance = 0.05 WHERE id = ?`, far); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if pinned, err := PinChunks(db, []int64{far, close1}, time.Now()); err != nil || pinned != 2 {
+		t.Fatalf("expected 2 chunks pinned, got %d, %v", pinned, err)
+	}
+	if pinned, _ := PinChunks(db, []int64{far}, time.Now()); pinned != 0 {
+		t.Fatalf("expected pinning twice to change nothing, got %d", pinned)
+	}
+	if _, err := PinChunks(db, []int64{999}, time.Now()); err == nil {
+		t.Fatal("expected an error for a missing chunk")
+	}
+
+	server := newOllamaServer(t, query)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	plain, err := SearchWithOptions(context.Background(), db, client, "diet", SearchOptions{Limit: 1})
+	if err != nil || len(plain) != 1 || plain[0].ID != int(close1) {
+		t.Fatalf("expected only the closest chunk without pins, got %+v, %v", plain, err)
+	}
+
+	results, err := SearchWithOptions(context.Background(), db, client, "diet", SearchOptions{Limit: 2, IncludePinned: true})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 3 || results[0].ID != int(close1) || results[1].ID != int(far) || results[2].ID != int(close2) {
+		t.Fatalf("expected both pins first, then the other match, got %+v", results)
+	}
+	if !results[0].Pinned || !results[1].Pinned || results[2].Pinned {
+		t.Fatalf("unexpected pinned flags: %+v", results)
+	}
+	if math.Abs(results[1].Distance-1) > 1e-6 {
+		t.Fatalf("expected the pinned chunk's real distance, got %v", results[0].Distance)
+	}
+
+	candidates, err := PruneCandidates(db, 0.5, "")
+	if err != nil || len(candidates) != 0 {
+		t.Fatalf("expected pinned chunks kept out of pruning, got %+v, %v", candidates, err)
+	}
+
+	if unpinned, err := UnpinChunks(db, []int64{far, close2}); err != nil || unpinned != 1 {
+		t.Fatalf("expected 1 chunk unpinned, got %d, %v", unpinned, err)
+	}
+	pinned, err := PinnedChunks(db, nil)
+	if err != nil || len(pinned) != 1 || pinned[0].ID != int(close1) {
+		t.Fatalf("expected one pin left, got %+v, %v", pinned, err)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// profileBatchSize is how many new chunks are folded into a profile per model call.
+const profileBatchSize = 10
+
+// profileMaxChunks caps how many chunks History returns when building a profile.
+const profileMaxChunks = 2000
+
+const profileUpdatePrompt = `You maintain a running profile of one person, project, place or tool from someone's personal notes.
+You are given the current profile (possibly empty) and new notes that mention the entity, oldest first.
+Return the updated profile as JSON only, in exactly this shape:
+{"key_facts": ["..."], "recent_events": [{"date": "YYYY-MM-DD", "event": "..."}], "open_threads": ["..."]}
+Rules:
+- key_facts: at most 12 short sentences describing who or what the entity is right now. Replace facts the new notes make outdated.
+- recent_events: at most 10 dated events, newest first. Use an empty date when the notes give none.
+- open_threads: at most 8 unresolved questions, plans or follow-ups. Drop threads the new notes resolve.
+- Only use what the profile and notes state.`
+
+// ProfileEvent is a dated happening in an entity profile.
+type ProfileEvent struct {
+	Date  string `json:"date"`
+	Event string `json:"event"`
+}
+
+// EntityProfile is the cached, model-written summary of everything known about an entity.
+type EntityProfile struct {
+	Entity       string         `json:"entity"`
+	KeyFacts     []string       `json:"key_facts"`
+	RecentEvents []ProfileEvent `json:"recent_events"`
+	OpenThreads  []string       `json:"open_threads"`
+	Chunks       int            `json:"chunks"`
+	UpdatedAt    string         `json:"updated_at"`
+	lastChunkID  int
+}
+
+type profileBody struct {
+	KeyFacts     []string       `json:"key_facts"`
+	RecentEvents []ProfileEvent `json:"recent_events"`
+	OpenThreads  []string       `json:"open_threads"`
+}
+
+// parseProfileResponse decodes the model's JSON answer, trimming empty entries and
+// capping each list at the sizes the prompt asks for.
+func parseProfileResponse(raw string) (profileBody, error) {
+	var resp profileBody
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return profileBody{}, err
+	}
+	body := profileBody{
+		KeyFacts:     cleanProfileLines(resp.KeyFacts, 12),
+		RecentEvents: []ProfileEvent{},
+		OpenThreads:  cleanProfileLines(resp.OpenThreads, 8),
+	}
+	for _, e := range resp.RecentEvents {
+		e.Event = strings.Join(strings.Fields(e.Event), " ")
+		e.Date = strings.TrimSpace(e.Date)
+		if e.Event == "" {
+			continue
+		}
+		body.RecentEvents = append(body.RecentEvents, e)
+		if len(body.RecentEvents) == 10 {
+			break
+		}
+	}
+	return body, nil
+}
+
+func cleanProfileLines(lines []string, max int) []string {
+	cleaned := []string{}
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		cleaned = append(cleaned, line)
+		if len(cleaned) == max {
+			break
+		}
+	}
+	return cleaned
+}
+
+// profileKey returns the canonical name a profile is cached under: the entity's own
+// name when the input matches an entity or alias, otherwise the input as given.
+func profileKey(db *sql.DB, entity string) (string, error) {
+	entity = strings.TrimSpace(entity)
+	id, err := findEntityID(db, entity)
+	if err == sql.ErrNoRows {
+		return entity, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var name string
+	if err := db.QueryRow(`SELECT name FROM entities WHERE id = ?`, id).Scan(&name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// LoadProfile returns the cached profile for entity, or nil if none has been built.
+func LoadProfile(db *sql.DB, entity string) (*EntityProfile, error) {
+	key, err := profileKey(db, entity)
+	if err != nil {
+		return nil, err
+	}
+	var profile EntityProfile
+	var raw string
+	err = db.QueryRow(
+		`SELECT name, profile, last_chunk_id, chunk_count, updated_at FROM entity_profiles WHERE name = ?`, key,
+	).Scan(&profile.Entity, &raw, &profile.lastChunkID, &profile.Chunks, &profile.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var body profileBody
+	if err := json.Unmarshal([]byte(raw), &body); err != nil {
+		return nil, fmt.Errorf("decode cached profile of %s: %w", key, err)
+	}
+	profile.KeyFacts = body.KeyFacts
+	profile.RecentEvents = body.RecentEvents
+	profile.OpenThreads = body.OpenThreads
+	return &profile, nil
+}
+
+// RefreshProfile brings the cached profile of entity up to date. Only chunks that
+// arrived since the last refresh are sent to the model, folded into the existing
+// profile in chronological batches; with rebuild the profile starts from scratch.
+// Returns the profile and how many chunks were folded in (0 when it was current).
+func RefreshProfile(ctx context.Context, db *sql.DB, ollama *OllamaClient, model, entity string, rebuild bool, progress ProgressFunc) (*EntityProfile, int, error) {
+	key, err := profileKey(db, entity)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var profile *EntityProfile
+	if !rebuild {
+		if profile, err = LoadProfile(db, key); err != nil {
+			return nil, 0, err
+		}
+	}
+	if profile == nil {
+		profile = &EntityProfile{Entity: key, KeyFacts: []string{}, RecentEvents: []ProfileEvent{}, OpenThreads: []string{}}
+	}
+
+	history, err := History(db, key, profileMaxChunks)
+	if err != nil {
+		return nil, 0, err
+	}
+	var pending []HistoryResult
+	for _, h := range history {
+		if h.ID > profile.lastChunkID {
+			pending = append(pending, h)
+		}
+	}
+	if len(pending) == 0 {
+		if profile.UpdatedAt == "" {
+			return nil, 0, fmt.Errorf("no chunks mention %s", key)
+		}
+		return profile, 0, nil
+	}
+
+	lastChunkID := profile.lastChunkID
+	for start := 0; start < len(pending); start += profileBatchSize {
+		end := start + profileBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		if progress != nil {
+			progress(start, len(pending), pending[start].SectionTitle)
+		}
+
+		current, err := json.Marshal(profileBody{profile.KeyFacts, profile.RecentEvents, profile.OpenThreads})
+		if err != nil {
+			return nil, 0, err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Entity: %s\n\nCurrent profile:\n%s\n\nNew notes:\n", key, current)
+		for _, h := range pending[start:end] {
+			fmt.Fprintf(&b, "\n## [%s] %s › %s\n%s\n", dateLabel(h.ValidAt), h.SourceFile, h.SectionTitle, h.Text)
+			if h.ID > lastChunkID {
+				lastChunkID = h.ID
+			}
+		}
+
+		raw, err := ollama.GenerateJSON(ctx, model, profileUpdatePrompt, b.String())
+		if err != nil {
+			return nil, 0, fmt.Errorf("update profile of %s: %w", key, err)
+		}
+		body, err := parseProfileResponse(raw)
+		if err != nil {
+			return nil, 0, fmt.Errorf("update profile of %s: %w", key, err)
+		}
+		profile.KeyFacts = body.KeyFacts
+		profile.RecentEvents = body.RecentEvents
+		profile.OpenThreads = body.OpenThreads
+	}
+	if progress != nil {
+		progress(len(pending), len(pending), "")
+	}
+
+	// Saved once every batch has been folded: pending is in date order, not id order,
+	// so a partial save could mark unread chunks as covered.
+	profile.Chunks += len(pending)
+	profile.lastChunkID = lastChunkID
+	profile.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	raw, err := json.Marshal(profileBody{profile.KeyFacts, profile.RecentEvents, profile.OpenThreads})
+	if err != nil {
+		return nil, 0, err
+	}
+	err = retryBusy("save profile", func() error {
+		_, err := db.Exec(
+			`INSERT INTO entity_profiles (name, profile, last_chunk_id, chunk_count, updated_at) VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT(name) DO UPDATE SET profile = excluded.profile, last_chunk_id = excluded.last_chunk_id,
+			     chunk_count = excluded.chunk_count, updated_at = excluded.updated_at`,
+			key, string(raw), profile.lastChunkID, profile.Chunks, profile.UpdatedAt,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("save profile of %s: %w", key, err)
+	}
+	return profile, len(pending), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseProfileResponse(t *testing.T) {
+	body, err := parseProfileResponse(`{"key_facts": ["  Leads   the infra team ", ""], "recent_events": [{"date": "2025-02-01", "event": "Joined"}, {"date": "", "event": " "}], "open_threads": null}`)
+	if err != nil {
+		t.Fatalf("parseProfileResponse: %v", err)
+	}
+	if len(body.KeyFacts) != 1 || body.KeyFacts[0] != "Leads the infra team" {
+		t.Fatalf("unexpected key facts: %q", body.KeyFacts)
+	}
+	if len(body.RecentEvents) != 1 || body.RecentEvents[0].Event != "Joined" {
+		t.Fatalf("unexpected events: %+v", body.RecentEvents)
+	}
+	if body.OpenThreads == nil || len(body.OpenThreads) != 0 {
+		t.Fatalf("expected empty open threads, got %v", body.OpenThreads)
+	}
+}
+
+func TestRefreshProfile(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req generateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		prompts = append(prompts, req.Prompt)
+		answer := `{"key_facts": ["Priya manages the infra team"], "recent_events": [], "open_threads": ["Hiring a second SRE"]}`
+		if strings.Contains(req.Prompt, "hired") {
+			answer = `{"key_facts": ["Priya manages the infra team"], "recent_events": [{"date": "2025-03-01", "event": "Hired an SRE"}], "open_threads": []}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	insertChunk(t, db, "Priya took over the infra team.", "a.md", "Reorg", "", 2, "2025-01-10", vec)
+	insertChunk(t, db, "Priya wants a second SRE.", "b.md", "Hiring", "", 2, "2025-02-01", vec)
+	insertChunk(t, db, "Lunch with Sam.", "c.md", "Lunch", "", 2, "2025-02-02", vec)
+
+	client := NewOllamaClient(server.URL, "embed")
+
+	if profile, err := LoadProfile(db, "Priya"); err != nil || profile != nil {
+		t.Fatalf("expected no cached profile, got %+v, %v", profile, err)
+	}
+
+	profile, folded, err := RefreshProfile(context.Background(), db, client, "gen", "Priya", false, nil)
+	if err != nil {
+		t.Fatalf("RefreshProfile: %v", err)
+	}
+	if folded != 2 || profile.Chunks != 2 || len(prompts) != 1 {
+		t.Fatalf("expected 2 chunks folded in one call, got folded=%d chunks=%d calls=%d", folded, profile.Chunks, len(prompts))
+	}
+	if strings.Contains(prompts[0], "Lunch with Sam") {
+		t.Fatalf("prompt included a chunk that doesn't mention Priya: %q", prompts[0])
+	}
+
+	// Nothing new: served from the cache without a model call
+	profile, folded, err = RefreshProfile(context.Background(), db, client, "gen", "Priya", false, nil)
+	if err != nil {
+		t.Fatalf("RefreshProfile (cached): %v", err)
+	}
+	if folded != 0 || len(prompts) != 1 || len(profile.OpenThreads) != 1 {
+		t.Fatalf("expected cached profile, got folded=%d calls=%d profile=%+v", folded, len(prompts), profile)
+	}
+
+	// A new chunk is folded into the existing profile
+	insertChunk(t, db, "Priya hired an SRE.", "d.md", "Hiring done", "", 2, "2025-03-01", vec)
+	profile, folded, err = RefreshProfile(context.Background(), db, client, "gen", "Priya", false, nil)
+	if err != nil {
+		t.Fatalf("RefreshProfile (incremental): %v", err)
+	}
+	if folded != 1 || profile.Chunks != 3 {
+		t.Fatalf("expected 1 new chunk, got folded=%d chunks=%d", folded, profile.Chunks)
+	}
+	if !strings.Contains(prompts[1], "Hiring a second SRE") || strings.Contains(prompts[1], "took over") {
+		t.Fatalf("expected current profile and only the new chunk in prompt, got %q", prompts[1])
+	}
+	if len(profile.RecentEvents) != 1 || len(profile.OpenThreads) != 0 {
+		t.Fatalf("unexpected refreshed profile: %+v", profile)
+	}
+
+	cached, err := LoadProfile(db, "priya")
+	if err != nil || cached == nil {
+		t.Fatalf("LoadProfile: %+v, %v", cached, err)
+	}
+	if cached.Chunks != 3 || cached.RecentEvents[0].Event != "Hired an SRE" {
+		t.Fatalf("unexpected cached profile: %+v", cached)
+	}
+
+	// Rebuild starts over from every chunk
+	if _, folded, err = RefreshProfile(context.Background(), db, client, "gen", "Priya", true, nil); err != nil || folded != 3 {
+		t.Fatalf("rebuild: folded=%d err=%v", folded, err)
+	}
+
+	if _, _, err := RefreshProfile(context.Background(), db, client, "gen", "Nobody", false, nil); err == nil {
+		t.Fatal("expected error for an entity with no chunks")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dbProfiles maps profile names to database paths.
+// Configured via MNEME_DB_PROFILES so --db can take a short name instead of a path.
+var dbProfiles = map[string]string{}
+
+func loadDBProfilesFromEnv() {
+	profilesEnv := strings.TrimSpace(os.Getenv("MNEME_DB_PROFILES"))
+	if profilesEnv == "" {
+		return
+	}
+
+	// Format: name1=/path/one.db;name2=/path/two.db
+	for _, entry := range strings.Split(profilesEnv, ";") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		path := strings.TrimSpace(parts[1])
+		if name == "" || path == "" {
+			continue
+		}
+		dbProfiles[name] = expandHome(path)
+	}
+}
+
+// resolveDBPath returns the database path for value, which may be a profile name or a path.
+func resolveDBPath(value string) string {
+	if path, ok := dbProfiles[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return path
+	}
+	return expandHome(value)
+}
+
+// extractDBFlag pulls --db/-db (with a separate or "=" value) out of args wherever it appears,
+// so it works both before and after the subcommand. Returns the value ("" if absent) and the
+// remaining args in order.
+func extractDBFlag(args []string) (string, []string) {
+	value := ""
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch {
+		case arg == "--db" || arg == "-db":
+			if i+1 < len(args) {
+				value = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, "--db="):
+			value = strings.TrimPrefix(arg, "--db=")
+		case strings.HasPrefix(arg, "-db="):
+			value = strings.TrimPrefix(arg, "-db=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return value, rest
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractDBFlag(t *testing.T) {
+	cases := []struct {
+		args     []string
+		wantDB   string
+		wantRest []string
+	}{
+		{[]string{"search", "query"}, "", []string{"search", "query"}},
+		{[]string{"--db", "work.db", "search", "query"}, "work.db", []string{"search", "query"}},
+		{[]string{"search", "--db=work", "--limit", "5", "query"}, "work", []string{"search", "--limit", "5", "query"}},
+		{[]string{"history", "-db", "x.db", "Go"}, "x.db", []string{"history", "Go"}},
+		{[]string{"search", "--", "--db"}, "", []string{"search", "--", "--db"}},
+	}
+
+	for _, tc := range cases {
+		db, rest := extractDBFlag(tc.args)
+		if db != tc.wantDB {
+			t.Errorf("extractDBFlag(%v): db = %q, want %q", tc.args, db, tc.wantDB)
+		}
+		if !reflect.DeepEqual(rest, tc.wantRest) {
+			t.Errorf("extractDBFlag(%v): rest = %v, want %v", tc.args, rest, tc.wantRest)
+		}
+	}
+}
+
+func TestResolveDBPathProfiles(t *testing.T) {
+	original := dbProfiles
+	defer func() { dbProfiles = original }()
+	dbProfiles = map[string]string{}
+
+	t.Setenv("MNEME_DB_PROFILES", "work=/data/work.db; Personal = /data/me.db ;broken")
+	loadDBProfilesFromEnv()
+
+	if got := resolveDBPath("work"); got != "/data/work.db" {
+		t.Errorf("expected work profile path, got %q", got)
+	}
+	if got := resolveDBPath("personal"); got != "/data/me.db" {
+		t.Errorf("expected case-insensitive profile lookup, got %q", got)
+	}
+	if got := resolveDBPath("other.db"); got != "other.db" {
+		t.Errorf("expected plain path passthrough, got %q", got)
+	}
+}
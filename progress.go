@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ProgressFunc receives progress updates from long-running operations.
+// done counts completed units out of total; current names the unit being
+// worked on (usually a section title).
+type ProgressFunc func(done, total int, current string)
+
+// Progress renders a redrawn progress bar with ETA on stderr.
+// On a non-terminal stderr it falls back to one line per 10% step so
+// logs stay readable.
+type Progress struct {
+	label    string
+	out      io.Writer
+	tty      bool
+	start    time.Time
+	lastDraw time.Time
+	lastPct  int
+	drawn    bool
+}
+
+func NewProgress(label string) *Progress {
+	tty := false
+	if fi, err := os.Stderr.Stat(); err == nil {
+		tty = fi.Mode()&os.ModeCharDevice != 0
+	}
+	return &Progress{
+		label:   label,
+		out:     os.Stderr,
+		tty:     tty,
+		start:   time.Now(),
+		lastPct: -1,
+	}
+}
+
+// Update implements ProgressFunc. Safe to call on a nil *Progress.
+func (p *Progress) Update(done, total int, current string) {
+	if p == nil || total <= 0 {
+		return
+	}
+
+	pct := done * 100 / total
+	eta := estimateETA(time.Since(p.start), done, total)
+
+	if p.tty {
+		// Throttle redraws; always draw the final state
+		if done < total && time.Since(p.lastDraw) < 100*time.Millisecond {
+			return
+		}
+		p.lastDraw = time.Now()
+		fmt.Fprint(p.out, "\r\033[K"+renderProgress(p.label, done, total, eta, current))
+		p.drawn = true
+		return
+	}
+
+	step := pct / 10
+	if step == p.lastPct && done < total {
+		return
+	}
+	p.lastPct = step
+	fmt.Fprintf(p.out, "%s: %d/%d (%d%%) eta %s\n", p.label, done, total, pct, formatETA(eta))
+}
+
+// Finish terminates the progress line so subsequent output starts clean.
+func (p *Progress) Finish() {
+	if p == nil || !p.tty || !p.drawn {
+		return
+	}
+	fmt.Fprintln(p.out)
+}
+
+// Func returns p.Update as a ProgressFunc, or nil when p is nil.
+func (p *Progress) Func() ProgressFunc {
+	if p == nil {
+		return nil
+	}
+	return p.Update
+}
+
+// estimateETA extrapolates remaining time from the average time per unit so far.
+func estimateETA(elapsed time.Duration, done, total int) time.Duration {
+	if done <= 0 || done >= total {
+		return 0
+	}
+	perUnit := elapsed / time.Duration(done)
+	return perUnit * time.Duration(total-done)
+}
+
+func formatETA(d time.Duration) string {
+	if d <= 0 {
+		return "--"
+	}
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	if d < time.Hour {
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateETA(t *testing.T) {
+	if eta := estimateETA(10*time.Second, 0, 10); eta != 0 {
+		t.Fatalf("expected 0 ETA before any work, got %v", eta)
+	}
+	if eta := estimateETA(10*time.Second, 5, 10); eta != 10*time.Second {
+		t.Fatalf("expected 10s ETA at halfway, got %v", eta)
+	}
+	if eta := estimateETA(10*time.Second, 10, 10); eta != 0 {
+		t.Fatalf("expected 0 ETA when done, got %v", eta)
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                             "--",
+		42 * time.Second:              "42s",
+		3*time.Minute + 5*time.Second: "3m05s",
+		2*time.Hour + 7*time.Minute:   "2h07m",
+	}
+	for in, want := range cases {
+		if got := formatETA(in); got != want {
+			t.Errorf("formatETA(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestProgressNonTTY(t *testing.T) {
+	var buf bytes.Buffer
+	p := &Progress{label: "Embedding", out: &buf, start: time.Now(), lastPct: -1}
+
+	for i := 0; i <= 20; i++ {
+		p.Update(i, 20, "section")
+	}
+	p.Finish()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 11 {
+		t.Fatalf("expected one line per 10%% step (11), got %d:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], "Embedding: 20/20 (100%)") {
+		t.Fatalf("unexpected final line: %q", lines[len(lines)-1])
+	}
+}
+
+func TestProgressNil(t *testing.T) {
+	var p *Progress
+	p.Update(1, 2, "x")
+	p.Finish()
+	if p.Func() != nil {
+		t.Fatal("expected nil ProgressFunc from nil Progress")
+	}
+}
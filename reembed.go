@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+// errDimensionMismatch marks a database whose stored embeddings have a different
+// dimension than EMBED_DIM, which vec0 would otherwise reject on the first insert.
+var errDimensionMismatch = errors.New("embedding dimension mismatch")
+
+// errModelMismatch marks a database whose stored embeddings were made with another model
+// than EMBED_MODEL, whose vectors the current model's queries would not match.
+var errModelMismatch = errors.New("embedding model mismatch")
+
+// vecTables are the vec0 tables holding embeddings.
+var vecTables = []string{"vec_chunks", "vec_messages", "vec_facts", "vec_threads"}
+
+// vecDimension returns the embedding dimension a vec0 table was created with.
+func vecDimension(db *sql.DB, table string) (int, error) {
+	var schema string
+	if err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = ?`, table).Scan(&schema); err != nil {
+		return 0, fmt.Errorf("read %s schema: %w", table, err)
+	}
+	m := vecDimensionPattern.FindStringSubmatch(schema)
+	if m == nil {
+		return 0, fmt.Errorf("no embedding dimension in %s schema", table)
+	}
+	return strconv.Atoi(m[1])
+}
+
+// checkVecDimensions compares the vec0 tables with EMBED_DIM. Empty tables are rebuilt at
+// the configured dimension; tables holding embeddings of another size are refused with
+// the two ways out.
+func checkVecDimensions(db *sql.DB) error {
+	for _, table := range vecTables {
+		dim, err := vecDimension(db, table)
+		if err != nil {
+			return err
+		}
+		if dim == EmbedDimension {
+			continue
+		}
+		var rows int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&rows); err != nil {
+			return err
+		}
+		if rows == 0 {
+			if err := rebuildVecTable(db, table); err != nil {
+				return err
+			}
+			continue
+		}
+		return fmt.Errorf("%w: %s holds %d embeddings of %d dimensions but EMBED_DIM is %d. Set EMBED_DIM=%d to keep using the model they were made with, or run `mneme reembed` to re-embed every chunk, message and fact with the current model",
+			errDimensionMismatch, table, rows, dim, EmbedDimension, dim)
+	}
+	return nil
+}
+
+// EmbeddingMeta is the model and dimension a database's embeddings were made with.
+type EmbeddingMeta struct {
+	Model     string
+	Dimension int
+}
+
+// readEmbeddingMeta returns the recorded embedding model and dimension, zero before the
+// first open that recorded them.
+func readEmbeddingMeta(db *sql.DB) (EmbeddingMeta, error) {
+	var meta EmbeddingMeta
+	rows, err := db.Query(`SELECT key, value FROM meta WHERE key IN ('embed_model', 'embed_dim')`)
+	if err != nil {
+		return meta, fmt.Errorf("read meta: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return meta, err
+		}
+		if key == "embed_model" {
+			meta.Model = value
+		} else {
+			meta.Dimension, _ = strconv.Atoi(value)
+		}
+	}
+	return meta, rows.Err()
+}
+
+// writeEmbeddingMeta records the embedding model and dimension.
+func writeEmbeddingMeta(tx *sql.Tx, model string, dim int) error {
+	_, err := tx.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES ('embed_model', ?), ('embed_dim', ?)`, model, strconv.Itoa(dim))
+	return err
+}
+
+// checkEmbeddingMeta compares the recorded embedding model with EMBED_MODEL, recording
+// EMBED_MODEL and EMBED_DIM on a database that has none yet or holds no embeddings.
+// Vectors from another model have the right size but mean nothing to the current one,
+// so a database holding them is refused with the two ways out.
+func checkEmbeddingMeta(db *sql.DB) error {
+	meta, err := readEmbeddingMeta(db)
+	if err != nil {
+		return err
+	}
+	if meta.Model == EmbedModel && meta.Dimension == EmbedDimension {
+		return nil
+	}
+	if meta.Model != "" && meta.Model != EmbedModel {
+		embeddings, err := countEmbeddings(db)
+		if err != nil {
+			return err
+		}
+		if embeddings > 0 {
+			return fmt.Errorf("%w: the %d embeddings in this database were made with %s but EMBED_MODEL is %s. Set EMBED_MODEL=%s to keep using it, or run `mneme reembed` to re-embed every chunk, message and fact with the current model",
+				errModelMismatch, embeddings, meta.Model, EmbedModel, meta.Model)
+		}
+	}
+	return withWriteTx(db, "record embedding model", func(tx *sql.Tx) error {
+		return writeEmbeddingMeta(tx, EmbedModel, EmbedDimension)
+	})
+}
+
+// countEmbeddings counts the embeddings in every vec0 table.
+func countEmbeddings(db *sql.DB) (int, error) {
+	total := 0
+	for _, table := range vecTables {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// rebuildVecTable drops an empty vec0 table and creates it again at EMBED_DIM.
+func rebuildVecTable(db *sql.DB, table string) error {
+	return withWriteTx(db, "rebuild "+table, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DROP TABLE ` + table); err != nil {
+			return err
+		}
+		_, err := tx.Exec(buildSchema(EmbedDimension))
+		return err
+	})
+}
+
+// reembedStaging holds new embeddings until every one is ready, so an interrupted
+// reembed leaves the old index searchable and picks up where it stopped.
+const reembedStaging = `
+CREATE TABLE IF NOT EXISTS reembed_staging (
+    kind TEXT NOT NULL,
+    id TEXT NOT NULL,
+    dim INTEGER NOT NULL,
+    embedding BLOB NOT NULL,
+    PRIMARY KEY (kind, id)
+)`
+
+// ReembedResult reports what a reembed rewrote.
+type ReembedResult struct {
+	Chunks   int
+	Messages int
+	Facts    int
+	// Threads counts thread embeddings summed again from the new message vectors
+	Threads int
+	// Resumed counts embeddings kept from an earlier, interrupted run.
+	Resumed int
+}
+
+type reembedItem struct {
+	kind, id, text string
+}
+
+// Reembed embeds every chunk, message and fact again with the current model, then swaps
+// the vec0 tables for ones at EMBED_DIM in a single transaction, summing each thread's
+// embedding again from its messages' new vectors. Messages too short to have been
+// embedded at ingest are skipped, as are messages the model fails on; a chunk or fact the
+// model fails on, or a cancelled ctx, stops the run, which a later run resumes.
+func Reembed(ctx context.Context, db *sql.DB, ollama *OllamaClient, progress ProgressFunc) (ReembedResult, error) {
+	var result ReembedResult
+	err := withWriteTx(db, "prepare reembed", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(reembedStaging); err != nil {
+			return err
+		}
+		// Embeddings staged for another dimension are of no use now
+		_, err := tx.Exec(`DELETE FROM reembed_staging WHERE dim != ?`, EmbedDimension)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM reembed_staging`).Scan(&result.Resumed); err != nil {
+		return result, err
+	}
+
+	items, err := pendingReembed(db)
+	if err != nil {
+		return result, err
+	}
+
+	var batch []any
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := withWriteTx(db, "stage embeddings", func(tx *sql.Tx) error {
+			_, err := tx.Exec(`INSERT OR REPLACE INTO reembed_staging (kind, id, dim, embedding) VALUES `+valuesPlaceholders(len(batch)/4, 4), batch...)
+			return err
+		})
+		batch = batch[:0]
+		return err
+	}
+	for i, item := range items {
+		if progress != nil {
+			progress(i, len(items), item.kind+" "+item.id)
+		}
+		embedding, err := ollama.Embed(ctx, item.text)
+		if err != nil {
+			if item.kind == "message" && ctx.Err() == nil {
+				continue
+			}
+			if flushErr := flush(); flushErr != nil {
+				return result, flushErr
+			}
+			return result, fmt.Errorf("embed %s %s: %w", item.kind, item.id, err)
+		}
+		if len(embedding) != EmbedDimension {
+			return result, fmt.Errorf("%w: the embedding model produces %d dimensions but EMBED_DIM is %d — set EMBED_DIM=%d",
+				errDimensionMismatch, len(embedding), EmbedDimension, len(embedding))
+		}
+		serialized, err := sqlite_vec.SerializeFloat32(embedding)
+		if err != nil {
+			return result, err
+		}
+		batch = append(batch, item.kind, item.id, EmbedDimension, serialized)
+		if len(batch)/4 >= multiRowBatch {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+	if progress != nil && len(items) > 0 {
+		progress(len(items), len(items), "")
+	}
+
+	err = withWriteTx(db, "swap embeddings", func(tx *sql.Tx) error {
+		for _, table := range vecTables {
+			if _, err := tx.Exec(`DROP TABLE ` + table); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(buildSchema(EmbedDimension)); err != nil {
+			return err
+		}
+		res, err := tx.Exec(
+			`INSERT INTO vec_chunks (chunk_id, embedding, valid_at, valid_until)
+			 SELECT c.id, s.embedding, COALESCE(c.valid_at, ''), COALESCE(NULLIF(c.valid_until, ''), '` + openValidUntil + `')
+			 FROM reembed_staging s JOIN chunks c ON s.kind = 'chunk' AND c.id = CAST(s.id AS INTEGER)`,
+		)
+		if err != nil {
+			return err
+		}
+		chunks, _ := res.RowsAffected()
+		if res, err = tx.Exec(
+			`INSERT INTO vec_messages (message_id, embedding)
+			 SELECT m.id, s.embedding
+			 FROM reembed_staging s JOIN messages m ON s.kind = 'message' AND m.id = s.id`,
+		); err != nil {
+			return err
+		}
+		messages, _ := res.RowsAffected()
+		if res, err = tx.Exec(
+			`INSERT INTO vec_facts (fact_id, embedding, valid_at, valid_until)
+			 SELECT f.id, s.embedding, COALESCE(f.valid_at, ''), COALESCE(NULLIF(f.valid_until, ''), '` + openValidUntil + `')
+			 FROM reembed_staging s JOIN facts f ON s.kind = 'fact' AND f.id = CAST(s.id AS INTEGER)`,
+		); err != nil {
+			return err
+		}
+		facts, _ := res.RowsAffected()
+		threads, err := rebuildThreadEmbeddings(tx)
+		if err != nil {
+			return err
+		}
+		result.Chunks, result.Messages, result.Facts, result.Threads = int(chunks), int(messages), int(facts), threads
+		if _, err := tx.Exec(`DROP TABLE reembed_staging`); err != nil {
+			return err
+		}
+		return writeEmbeddingMeta(tx, ollama.embedModel, EmbedDimension)
+	})
+	return result, err
+}
+
+// pendingReembed lists the chunks, messages and facts not yet staged, with the text to
+// embed: chunks and messages normalized as at ingest, facts as extracted, and only
+// messages long enough to have been embedded.
+func pendingReembed(db *sql.DB) ([]reembedItem, error) {
+	rows, err := db.Query(
+		`SELECT 'chunk', CAST(c.id AS TEXT), c.text FROM chunks c
+		 WHERE NOT EXISTS (SELECT 1 FROM reembed_staging s WHERE s.kind = 'chunk' AND s.id = CAST(c.id AS TEXT))
+		 UNION ALL
+		 SELECT 'message', m.id, m.text FROM messages m
+		 WHERE NOT EXISTS (SELECT 1 FROM reembed_staging s WHERE s.kind = 'message' AND s.id = m.id)
+		 UNION ALL
+		 SELECT 'fact', CAST(f.id AS TEXT), f.text FROM facts f
+		 WHERE NOT EXISTS (SELECT 1 FROM reembed_staging s WHERE s.kind = 'fact' AND s.id = CAST(f.id AS TEXT))`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []reembedItem
+	for rows.Next() {
+		var item reembedItem
+		if err := rows.Scan(&item.kind, &item.id, &item.text); err != nil {
+			return nil, err
+		}
+		if item.kind == "message" && len(item.text) < 10 { // never embedded, see prepareMessages
+			continue
+		}
+		if item.kind != "fact" {
+			item.text = normalizeText(item.text)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ReembedChunk embeds one chunk again with the current model and replaces its vector,
+// for a chunk whose embedding is suspect rather than a whole database on another model.
+func ReembedChunk(ctx context.Context, db *sql.DB, ollama *OllamaClient, chunkID int64) error {
+	var text string
+	var validAt, validUntil sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT text, valid_at, valid_until FROM chunks WHERE id = ?`, chunkID).Scan(&text, &validAt, &validUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("chunk %d not found", chunkID)
+	}
+	if err != nil {
+		return err
+	}
+	embedding, err := ollama.Embed(ctx, normalizeText(text))
+	if err != nil {
+		return fmt.Errorf("embed chunk %d: %w", chunkID, err)
+	}
+	if len(embedding) != EmbedDimension {
+		return fmt.Errorf("%w: the embedding model produces %d dimensions but EMBED_DIM is %d — set EMBED_DIM=%d",
+			errDimensionMismatch, len(embedding), EmbedDimension, len(embedding))
+	}
+	serialized, err := sqlite_vec.SerializeFloat32(embedding)
+	if err != nil {
+		return err
+	}
+	validFrom, until := vecValidity(validAt, validUntil)
+	return withWriteTx(db, "reembed chunk", func(tx *sql.Tx) error {
+		// vec0 rows are replaced rather than updated
+		if _, err := tx.Exec(`DELETE FROM vec_chunks WHERE chunk_id = ?`, chunkID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO vec_chunks (chunk_id, embedding, valid_at, valid_until) VALUES (?, ?, ?, ?)`, chunkID, serialized, validFrom, until)
+		return err
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withEmbedDimension(t *testing.T, dim int) {
+	t.Helper()
+	previous := EmbedDimension
+	EmbedDimension = dim
+	t.Cleanup(func() { EmbedDimension = previous })
+}
+
+func withEmbedModel(t *testing.T, model string) {
+	t.Helper()
+	previous := EmbedModel
+	EmbedModel = model
+	t.Cleanup(func() { EmbedModel = previous })
+}
+
+func TestCheckEmbeddingMeta(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mneme.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	if meta, err := readEmbeddingMeta(db); err != nil || meta.Model != EmbedModel || meta.Dimension != EmbedDimension {
+		t.Fatalf("expected the model and dimension recorded, got %+v, %v", meta, err)
+	}
+	insertChunk(t, db, "postgres it is", "a.md", "Decision", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1}))
+	db.Close()
+	empty, err := InitDB(filepath.Join(dir, "empty.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	empty.Close()
+
+	previous := EmbedModel
+	withEmbedModel(t, "nomic-embed-text")
+	_, err = InitDB(path)
+	if !errors.Is(err, errModelMismatch) {
+		t.Fatalf("expected a model mismatch, got %v", err)
+	}
+	for _, want := range []string{"made with " + previous, "EMBED_MODEL is nomic-embed-text", "mneme reembed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %q", want, err.Error())
+		}
+	}
+
+	// Nothing was embedded with the old model, so the new one is just recorded
+	if empty, err = InitDB(filepath.Join(dir, "empty.db")); err != nil {
+		t.Fatalf("expected an empty database to follow EMBED_MODEL, got %v", err)
+	}
+	defer empty.Close()
+	if meta, err := readEmbeddingMeta(empty); err != nil || meta.Model != "nomic-embed-text" {
+		t.Fatalf("expected the new model recorded, got %+v, %v", meta, err)
+	}
+}
+
+func TestCheckVecDimensions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mneme.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	insertChunk(t, db, "postgres it is", "a.md", "Decision", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1}))
+	db.Close()
+	empty, err := InitDB(filepath.Join(dir, "empty.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	empty.Close()
+
+	withEmbedDimension(t, 8)
+	_, err = InitDB(path)
+	if !errors.Is(err, errDimensionMismatch) {
+		t.Fatalf("expected a dimension mismatch, got %v", err)
+	}
+	for _, want := range []string{"vec_chunks", "1024 dimensions", "EMBED_DIM is 8", "mneme reembed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %q", want, err.Error())
+		}
+	}
+
+	// Nothing to lose in an empty database, so it just follows EMBED_DIM
+	if empty, err = InitDB(filepath.Join(dir, "empty.db")); err != nil {
+		t.Fatalf("expected an empty database rebuilt, got %v", err)
+	}
+	defer empty.Close()
+	for _, table := range vecTables {
+		if dim, err := vecDimension(empty, table); err != nil || dim != 8 {
+			t.Fatalf("expected %s at 8 dimensions, got %d, %v", table, dim, err)
+		}
+	}
+}
+
+func TestReembed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mneme.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	id := insertChunk(t, db, "postgres it is", "a.md", "Decision", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1}))
+	db.Exec(`UPDATE chunks SET valid_until = '2024-06-01' WHERE id = ?`, id)
+	for _, m := range []struct{ id, text string }{{"m1", "we moved to postgres"}, {"m2", "ok"}} {
+		if _, err := db.Exec(`INSERT INTO messages (id, session_id, role, timestamp, text) VALUES (?, 's1', 'user', 1, ?)`, m.id, m.text); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+	res, err := db.Exec(`INSERT INTO facts (text, chunk_id, valid_at, created_at) VALUES ('the team uses postgres', ?, '2024-01-01', '2024-01-01')`, id)
+	if err != nil {
+		t.Fatalf("insert fact: %v", err)
+	}
+	factID, _ := res.LastInsertId()
+	db.Exec(`INSERT INTO vec_facts (fact_id, embedding, valid_at, valid_until) VALUES (?, ?, '2024-01-01', ?)`, factID, makeVec(map[int]float32{0: 1}), openValidUntil)
+	db.Exec(`INSERT INTO threads (id, title, started_at, ended_at, message_count) VALUES (1, 'postgres', 1, 1, 2)`)
+	db.Exec(`UPDATE messages SET thread_id = 1`)
+	db.Exec(`INSERT INTO vec_threads (thread_id, embedding) VALUES (1, ?)`, makeVec(map[int]float32{0: 1}))
+	db.Close()
+
+	withEmbedDimension(t, 8)
+	withEmbedModel(t, "small-embed")
+	server := newOllamaServer(t, []float32{1, 0, 0, 0, 0, 0, 0, 0})
+	defer server.Close()
+
+	if db, err = initDB(path, false); err != nil {
+		t.Fatalf("initDB without the check: %v", err)
+	}
+	result, err := Reembed(context.Background(), db, NewOllamaClient(server.URL, EmbedModel), nil)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Reembed: %v", err)
+	}
+	if result.Chunks != 1 || result.Messages != 1 || result.Facts != 1 || result.Threads != 1 {
+		t.Fatalf("expected 1 chunk, 1 message (the short one skipped), 1 fact and 1 thread, got %+v", result)
+	}
+
+	if db, err = InitDB(path); err != nil {
+		t.Fatalf("expected the reembedded database to open, got %v", err)
+	}
+	defer db.Close()
+	var validAt, validUntil string
+	if err := db.QueryRow(`SELECT valid_at, valid_until FROM vec_chunks WHERE chunk_id = ?`, id).Scan(&validAt, &validUntil); err != nil {
+		t.Fatalf("read vec_chunks: %v", err)
+	}
+	if validAt != "2024-01-01" || validUntil != "2024-06-01" {
+		t.Fatalf("expected validity carried over, got %q, %q", validAt, validUntil)
+	}
+	results, err := searchByEmbedding(context.Background(), db, []float32{1, 0, 0, 0, 0, 0, 0, 0}, SearchOptions{Limit: 5, AsOf: "2024-03-01"})
+	if err != nil || len(results) != 1 || results[0].ID != int(id) {
+		t.Fatalf("expected the chunk found at the new dimension, got %+v, %v", results, err)
+	}
+	var factValidAt string
+	if err := db.QueryRow(`SELECT valid_at FROM vec_facts WHERE fact_id = ?`, factID).Scan(&factValidAt); err != nil || factValidAt != "2024-01-01" {
+		t.Fatalf("expected the fact embedded again with its dates, got %q, %v", factValidAt, err)
+	}
+	var blob []byte
+	if err := db.QueryRow(`SELECT embedding FROM vec_threads WHERE thread_id = 1`).Scan(&blob); err != nil || len(blob) != 8*4 {
+		t.Fatalf("expected the thread summed at the new dimension, got %d bytes, %v", len(blob), err)
+	}
+	var staging int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'reembed_staging'`).Scan(&staging)
+	if staging != 0 {
+		t.Fatal("expected the staging table dropped")
+	}
+}
+
+func TestReembedChunk(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	id := insertChunk(t, db, "postgres it is", "a.md", "Decision", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1}))
+	other := insertChunk(t, db, "redis for queues", "b.md", "Queues", "", 2, "", makeVec(map[int]float32{0: 1}))
+
+	fresh := makeVec(map[int]float32{1: 1})
+	server := newOllamaServer(t, fresh)
+	defer server.Close()
+	if err := ReembedChunk(context.Background(), db, NewOllamaClient(server.URL, "embed"), id); err != nil {
+		t.Fatalf("ReembedChunk: %v", err)
+	}
+
+	results, err := searchByEmbedding(context.Background(), db, fresh, SearchOptions{Limit: 1, AsOf: "2024-03-01", ByRelevance: true})
+	if err != nil || len(results) != 1 || results[0].ID != int(id) || results[0].Distance > 0.01 {
+		t.Fatalf("expected the chunk found by its new vector with its dates kept, got %+v, %v", results, err)
+	}
+	var vectors int
+	db.QueryRow(`SELECT COUNT(*) FROM vec_chunks WHERE chunk_id IN (?, ?)`, id, other).Scan(&vectors)
+	if vectors != 2 {
+		t.Fatalf("expected one vector per chunk, got %d", vectors)
+	}
+	if err := ReembedChunk(context.Background(), db, NewOllamaClient(server.URL, "embed"), 999); err == nil {
+		t.Fatal("expected a missing chunk reported")
+	}
+}
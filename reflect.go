@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// reflectionSourcePrefix is the source_file prefix of stored reflections.
+const reflectionSourcePrefix = "reflection://"
+
+// tagSourceReflection and tagReflection mark reflection chunks in chunk_tags, so they
+// can be filtered with search --tag reflection.
+const (
+	tagSourceReflection = "reflection"
+	tagReflection       = "reflection"
+)
+
+// reflectMaxWords caps how much recent material is sent to the model, newest first.
+const reflectMaxWords = 4000
+
+// reflectTopicCandidates is how many chunks a topic search considers before the
+// window filter.
+const reflectTopicCandidates = 60
+
+// reflectTopicMaxDistance drops topic search hits too far from the topic to be about it.
+const reflectTopicMaxDistance = 0.5
+
+const reflectionPrompt = `You reflect on someone's recent notes and conversations to find higher-level insights.
+Look for patterns across the material: topics they keep returning to without deciding, shifts in priorities or opinions, commitments that keep slipping, tensions between goals, and habits worth noticing.
+Return JSON only, in exactly this shape:
+{"insights": ["..."]}
+Rules:
+- At most 6 insights, each one or two sentences, addressed to the person ("you keep revisiting ...").
+- Each insight must be supported by more than one note; skip one-off details.
+- Only use what the material states. Return an empty list if nothing stands out.`
+
+type reflectionResponse struct {
+	Insights []string `json:"insights"`
+}
+
+// Reflection is one reflect run: the insights drawn and where they were stored.
+type Reflection struct {
+	Topic      string   `json:"topic,omitempty"`
+	Date       string   `json:"date"`
+	Insights   []string `json:"insights"`
+	Chunks     int      `json:"chunks"`
+	SourceFile string   `json:"source_file,omitempty"`
+}
+
+var reflectionSlugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+func reflectionSource(date, topic string) string {
+	source := reflectionSourcePrefix + date
+	if slug := strings.Trim(reflectionSlugPattern.ReplaceAllString(strings.ToLower(topic), "-"), "-"); slug != "" {
+		source += "/" + slug
+	}
+	return source
+}
+
+// reflectionMaterial picks the chunks to reflect on: with a topic, the chunks within
+// reflectTopicMaxDistance of it; otherwise the most recent ones. Either way only chunks
+// dated (or, when undated, ingested) on or after since are kept, reflections themselves
+// are skipped, and the total is capped at reflectMaxWords, newest first.
+func reflectionMaterial(ctx context.Context, db *sql.DB, ollama *OllamaClient, topic string, since time.Time) ([]HistoryResult, error) {
+	sinceDate := since.Format("2006-01-02")
+	var candidates []HistoryResult
+	if topic != "" {
+		results, err := SearchWithOptions(ctx, db, ollama, topic, SearchOptions{Limit: reflectTopicCandidates})
+		if err != nil {
+			return nil, fmt.Errorf("search %q: %w", topic, err)
+		}
+		ids := make(map[int]bool, len(results))
+		for _, r := range results {
+			if r.Distance <= reflectTopicMaxDistance {
+				ids[r.ID] = true
+			}
+		}
+		recent, err := recentChunks(db, sinceDate)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range recent {
+			if ids[c.ID] {
+				candidates = append(candidates, c)
+			}
+		}
+	} else {
+		var err error
+		if candidates, err = recentChunks(db, sinceDate); err != nil {
+			return nil, err
+		}
+	}
+
+	var material []HistoryResult
+	words := 0
+	for _, c := range candidates {
+		n := len(strings.Fields(c.Text))
+		if words+n > reflectMaxWords && len(material) > 0 {
+			break
+		}
+		material = append(material, c)
+		words += n
+	}
+	return material, nil
+}
+
+// recentChunks returns chunks from sinceDate on, newest first, leaving out reflections.
+func recentChunks(db *sql.DB, sinceDate string) ([]HistoryResult, error) {
+	rows, err := db.Query(
+		`SELECT id, text, source_file, section_title, parent_title, valid_at, ingested_at FROM chunks
+		 WHERE COALESCE(valid_at, local_date(ingested_at)) >= ? AND source_file NOT LIKE ?
+		 ORDER BY COALESCE(valid_at, local_date(ingested_at)) DESC, id DESC`,
+		sinceDate, reflectionSourcePrefix+"%",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []HistoryResult
+	for rows.Next() {
+		var r HistoryResult
+		var parent, validAt sql.NullString
+		if err := rows.Scan(&r.ID, &r.Text, &r.SourceFile, &r.SectionTitle, &parent, &validAt, &r.IngestedAt); err != nil {
+			return nil, err
+		}
+		r.ParentTitle = parent.String
+		r.ValidAt = validAt.String
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// Reflect asks the generate model for insights across recent memories (the days before
+// now, optionally narrowed to a topic). With store, the insights are ingested as
+// reflection://<date>[/<topic>], one chunk per insight tagged "reflection", replacing
+// an earlier reflection on the same day and topic.
+func Reflect(ctx context.Context, db *sql.DB, ollama *OllamaClient, model, topic string, now time.Time, days int, store bool) (*Reflection, error) {
+	if days <= 0 {
+		days = 14
+	}
+	material, err := reflectionMaterial(ctx, db, ollama, topic, now.AddDate(0, 0, -days))
+	if err != nil {
+		return nil, err
+	}
+	reflection := &Reflection{Topic: topic, Date: now.Format("2006-01-02"), Insights: []string{}, Chunks: len(material)}
+	if len(material) == 0 {
+		return reflection, nil
+	}
+
+	var b strings.Builder
+	if topic != "" {
+		fmt.Fprintf(&b, "Topic: %s\n\n", topic)
+	}
+	b.WriteString("Recent material, oldest first:\n")
+	for i := len(material) - 1; i >= 0; i-- {
+		m := material[i]
+		fmt.Fprintf(&b, "\n## [%s] %s › %s\n%s\n", dateLabel(m.ValidAt), m.SourceFile, m.SectionTitle, m.Text)
+	}
+
+	raw, err := ollama.GenerateJSON(ctx, model, reflectionPrompt, b.String())
+	if err != nil {
+		return nil, fmt.Errorf("reflect: %w", err)
+	}
+	var resp reflectionResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return nil, fmt.Errorf("reflect: %w", err)
+	}
+	reflection.Insights = cleanProfileLines(resp.Insights, 6)
+	if !store || len(reflection.Insights) == 0 {
+		return reflection, nil
+	}
+
+	heading := "Reflection"
+	if topic != "" {
+		heading += " on " + topic
+	}
+	var md strings.Builder
+	fmt.Fprintf(&md, "## %s, %s\n\n", heading, now.Format("January 2, 2006"))
+	for i, insight := range reflection.Insights {
+		fmt.Fprintf(&md, "### Insight %d\n\n%s\n\n", i+1, insight)
+	}
+
+	sourceFile := reflectionSource(reflection.Date, topic)
+	chunkIDs, err := ingestMarkdownSource(ctx, db, ollama, sourceFile, md.String())
+	if err != nil {
+		return nil, fmt.Errorf("store reflection: %w", err)
+	}
+	err = withWriteTx(db, "tag reflection", func(tx *sql.Tx) error {
+		for _, id := range chunkIDs {
+			if _, err := addChunkTag(tx, id, tagReflection, tagSourceReflection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	reflection.SourceFile = sourceFile
+	return reflection, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReflectionSource(t *testing.T) {
+	if got := reflectionSource("2025-06-01", ""); got != "reflection://2025-06-01" {
+		t.Fatalf("unexpected source %q", got)
+	}
+	if got := reflectionSource("2025-06-01", " Auth Redesign! "); got != "reflection://2025-06-01/auth-redesign" {
+		t.Fatalf("unexpected topic source %q", got)
+	}
+}
+
+func TestReflect(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			prompts = append(prompts, req.Prompt)
+			answer := `{"insights": ["You keep revisiting the auth redesign without deciding.", "  ", "Sleep keeps coming up."]}`
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		case "/api/embed":
+			var req embedRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			// Auth talk points along dim 0, everything else along dim 1
+			vec := make([]float64, EmbedDimension)
+			if strings.Contains(strings.ToLower(req.Input), "auth") {
+				vec[0] = 1
+			} else {
+				vec[1] = 1
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	authVec := makeVec(map[int]float32{0: 1})
+	otherVec := makeVec(map[int]float32{1: 1})
+	insertChunk(t, db, "Auth redesign: maybe OAuth?", "a.md", "Auth", "", 2, "2025-05-25", authVec)
+	insertChunk(t, db, "Auth redesign again, still unsure.", "b.md", "Auth", "", 2, "2025-05-30", authVec)
+	insertChunk(t, db, "Slept badly.", "c.md", "Sleep", "", 2, "2025-05-29", otherVec)
+	insertChunk(t, db, "Auth from long ago.", "d.md", "Auth", "", 2, "2024-01-01", authVec)
+
+	client := NewOllamaClient(server.URL, "embed")
+	now := time.Date(2025, time.June, 1, 9, 0, 0, 0, time.UTC)
+
+	reflection, err := Reflect(context.Background(), db, client, "gen", "", now, 14, false)
+	if err != nil {
+		t.Fatalf("Reflect: %v", err)
+	}
+	if reflection.Chunks != 3 || len(reflection.Insights) != 2 || reflection.SourceFile != "" {
+		t.Fatalf("unexpected reflection: %+v", reflection)
+	}
+	if strings.Contains(prompts[0], "long ago") || strings.Index(prompts[0], "maybe OAuth") > strings.Index(prompts[0], "still unsure") {
+		t.Fatalf("expected only recent material, oldest first:\n%s", prompts[0])
+	}
+
+	reflection, err = Reflect(context.Background(), db, client, "gen", "auth", now, 14, true)
+	if err != nil {
+		t.Fatalf("Reflect with topic: %v", err)
+	}
+	if reflection.Chunks != 2 || strings.Contains(prompts[1], "Slept badly") || !strings.HasPrefix(prompts[1], "Topic: auth") {
+		t.Fatalf("expected only recent auth chunks, got %d:\n%s", reflection.Chunks, prompts[1])
+	}
+	if reflection.SourceFile != "reflection://2025-06-01/auth" {
+		t.Fatalf("unexpected source %q", reflection.SourceFile)
+	}
+
+	tagged, err := TaggedChunks(db, tagReflection, 10)
+	if err != nil {
+		t.Fatalf("TaggedChunks: %v", err)
+	}
+	if len(tagged) != 2 || tagged[0].ValidAt != "2025-06-01" || !strings.Contains(tagged[0].Text+tagged[1].Text, "auth redesign without deciding") {
+		t.Fatalf("expected two tagged, dated insight chunks, got %+v", tagged)
+	}
+
+	// Reflections are not fed into later reflections, and a rerun replaces the old one
+	if _, err := Reflect(context.Background(), db, client, "gen", "auth", now, 14, true); err != nil {
+		t.Fatalf("Reflect rerun: %v", err)
+	}
+	if strings.Contains(prompts[2], "without deciding") {
+		t.Fatalf("expected stored reflections to be left out:\n%s", prompts[2])
+	}
+	var stored int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE source_file LIKE 'reflection://%'`).Scan(&stored)
+	if stored != 2 {
+		t.Fatalf("expected the rerun to replace the reflection, got %d chunks", stored)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RelatedEntity is an entity that co-occurs with the queried one.
+type RelatedEntity struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind,omitempty"`
+	Shared    int    `json:"shared"`
+	FirstSeen string `json:"first_seen,omitempty"`
+	LastSeen  string `json:"last_seen,omitempty"`
+}
+
+var watchBatchSuffix = regexp.MustCompile(`/batch-\d+$`)
+
+// sessionGroup maps a chunk's source_file to the session it came from. Watch batches
+// (watch://<id>/batch-N) collapse to their session; any other source is its own session.
+func sessionGroup(sourceFile string) string {
+	if strings.Contains(sourceFile, "://") {
+		return watchBatchSuffix.ReplaceAllString(sourceFile, "")
+	}
+	return sourceFile
+}
+
+// RelatedEntities ranks the entities that appear alongside entity (and its aliases),
+// counting shared chunks, or shared sessions when bySession is set.
+// If limit <= 0, defaults to 20.
+func RelatedEntities(db *sql.DB, entity string, limit int, bySession bool) ([]RelatedEntity, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	targetIDs, _, err := lookupEntityIDs(db, resolveAliases(entity))
+	if err != nil {
+		return nil, err
+	}
+	if len(targetIDs) == 0 {
+		return nil, fmt.Errorf("unknown entity: %s", entity)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(targetIDs)), ",")
+	targetArgs := make([]any, len(targetIDs))
+	for i, id := range targetIDs {
+		targetArgs[i] = id
+	}
+
+	// Units (chunks or sessions) the target appears in
+	rows, err := db.Query(fmt.Sprintf(
+		`SELECT DISTINCT c.id, c.source_file FROM chunk_entities ce
+		 JOIN chunks c ON c.id = ce.chunk_id
+		 WHERE ce.entity_id IN (%s)`, placeholders), targetArgs...)
+	if err != nil {
+		return nil, err
+	}
+	targetUnits := make(map[string]bool)
+	for rows.Next() {
+		var chunkID int64
+		var sourceFile string
+		if err := rows.Scan(&chunkID, &sourceFile); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		targetUnits[cooccurrenceUnit(chunkID, sourceFile, bySession)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(
+		`SELECT e.id, e.name, e.kind, c.id, c.source_file, c.valid_at
+		 FROM chunk_entities ce
+		 JOIN entities e ON e.id = ce.entity_id
+		 JOIN chunks c ON c.id = ce.chunk_id
+		 WHERE ce.entity_id NOT IN (%s)`, placeholders)
+	if !bySession {
+		// Chunk mode only needs the target's own chunks
+		query += fmt.Sprintf(` AND ce.chunk_id IN (SELECT chunk_id FROM chunk_entities WHERE entity_id IN (%s))`, placeholders)
+		targetArgs = append(targetArgs, targetArgs...)
+	}
+
+	rows, err = db.Query(query, targetArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type tally struct {
+		related RelatedEntity
+		units   map[string]bool
+	}
+	tallies := make(map[int64]*tally)
+	for rows.Next() {
+		var entityID, chunkID int64
+		var name, kind, sourceFile string
+		var validAt sql.NullString
+		if err := rows.Scan(&entityID, &name, &kind, &chunkID, &sourceFile, &validAt); err != nil {
+			return nil, err
+		}
+		unit := cooccurrenceUnit(chunkID, sourceFile, bySession)
+		if !targetUnits[unit] {
+			continue
+		}
+
+		t, ok := tallies[entityID]
+		if !ok {
+			t = &tally{related: RelatedEntity{Name: name, Kind: kind}, units: make(map[string]bool)}
+			tallies[entityID] = t
+		}
+		t.units[unit] = true
+		if validAt.Valid {
+			if t.related.FirstSeen == "" || validAt.String < t.related.FirstSeen {
+				t.related.FirstSeen = validAt.String
+			}
+			if validAt.String > t.related.LastSeen {
+				t.related.LastSeen = validAt.String
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	related := make([]RelatedEntity, 0, len(tallies))
+	for _, t := range tallies {
+		t.related.Shared = len(t.units)
+		related = append(related, t.related)
+	}
+	sort.Slice(related, func(i, j int) bool {
+		if related[i].Shared != related[j].Shared {
+			return related[i].Shared > related[j].Shared
+		}
+		if related[i].LastSeen != related[j].LastSeen {
+			return related[i].LastSeen > related[j].LastSeen
+		}
+		return related[i].Name < related[j].Name
+	})
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+func cooccurrenceUnit(chunkID int64, sourceFile string, bySession bool) string {
+	if bySession {
+		return sessionGroup(sourceFile)
+	}
+	return fmt.Sprintf("%d", chunkID)
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestSessionGroup(t *testing.T) {
+	cases := map[string]string{
+		"watch://ses_1/batch-12": "watch://ses_1",
+		"watch-cc://abc/batch-0": "watch-cc://abc",
+		"notes/project.md":       "notes/project.md",
+		"notes/batch-3":          "notes/batch-3",
+	}
+	for in, want := range cases {
+		if got := sessionGroup(in); got != want {
+			t.Errorf("sessionGroup(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRelatedEntities(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	c1 := insertChunk(t, db, "Alice and Bob planned Mneme", "watch://s1/batch-0", "One", "", 2, "2025-01-01", vec)
+	c2 := insertChunk(t, db, "Alice and Bob shipped", "watch://s1/batch-1", "Two", "", 2, "2025-02-01", vec)
+	c3 := insertChunk(t, db, "Carol reviewed", "watch://s1/batch-2", "Three", "", 2, "2025-02-02", vec)
+	c4 := insertChunk(t, db, "Alice met Dave", "notes.md", "Four", "", 2, "2025-03-01", vec)
+
+	ids := map[string]int64{}
+	for _, name := range []string{"Alice", "Bob", "Carol", "Dave", "Mneme"} {
+		res, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES (?, 'person', '2025-01-01')`, name)
+		if err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+		ids[name], _ = res.LastInsertId()
+	}
+	link := func(chunk int64, names ...string) {
+		for _, name := range names {
+			if _, err := db.Exec(`INSERT INTO chunk_entities (chunk_id, entity_id) VALUES (?, ?)`, chunk, ids[name]); err != nil {
+				t.Fatalf("link: %v", err)
+			}
+		}
+	}
+	link(c1, "Alice", "Bob", "Mneme")
+	link(c2, "Alice", "Bob")
+	link(c3, "Carol")
+	link(c4, "Alice", "Dave")
+
+	related, err := RelatedEntities(db, "Alice", 10, false)
+	if err != nil {
+		t.Fatalf("RelatedEntities: %v", err)
+	}
+	if len(related) != 3 {
+		t.Fatalf("expected 3 related entities, got %+v", related)
+	}
+	if related[0].Name != "Bob" || related[0].Shared != 2 || related[0].FirstSeen != "2025-01-01" || related[0].LastSeen != "2025-02-01" {
+		t.Fatalf("unexpected top entity: %+v", related[0])
+	}
+
+	// Carol shares a session with Alice but never a chunk
+	related, err = RelatedEntities(db, "Alice", 10, true)
+	if err != nil {
+		t.Fatalf("RelatedEntities by session: %v", err)
+	}
+	found := false
+	for _, r := range related {
+		if r.Name == "Carol" && r.Shared == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected Carol to co-occur by session, got %+v", related)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// extractionKindRelations marks chunks in chunk_extractions once the relation pass has run.
+const extractionKindRelations = "relations"
+
+const relationExtractionPrompt = `You extract relationships between named entities from personal notes and conversation transcripts.
+Return JSON only, in exactly this shape:
+{"relations": [{"subject": "...", "predicate": "...", "object": "..."}]}
+Rules:
+- Subject and object must be people, projects, places, organizations or tools named in the text.
+- Predicate is a short lowercase verb phrase, e.g. "works on", "lives in", "uses", "manages".
+- Only include relationships the text states directly.
+- Use an empty array when nothing applies.`
+
+type extractedRelation struct {
+	Subject   string `json:"subject"`
+	Predicate string `json:"predicate"`
+	Object    string `json:"object"`
+}
+
+type relationExtractionResponse struct {
+	Relations []extractedRelation `json:"relations"`
+}
+
+type RelationExtractionResult struct {
+	ChunksProcessed  int
+	RelationsCreated int
+}
+
+// GraphEdge is one relation reached while traversing the graph from an entity.
+type GraphEdge struct {
+	Subject    string `json:"subject"`
+	Predicate  string `json:"predicate"`
+	Object     string `json:"object"`
+	ValidAt    string `json:"valid_at,omitempty"`
+	ChunkID    int64  `json:"chunk_id,omitempty"`
+	SourceFile string `json:"source_file,omitempty"`
+	Depth      int    `json:"depth"`
+}
+
+// parseRelationResponse decodes the model's JSON answer into cleaned relations.
+func parseRelationResponse(raw string) ([]extractedRelation, error) {
+	var resp relationExtractionResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+
+	var relations []extractedRelation
+	for _, r := range resp.Relations {
+		r.Subject = cleanEntityName(r.Subject)
+		r.Object = cleanEntityName(r.Object)
+		r.Predicate = strings.ToLower(strings.Join(strings.Fields(r.Predicate), " "))
+		if r.Subject == "" || r.Object == "" || r.Predicate == "" || strings.EqualFold(r.Subject, r.Object) {
+			continue
+		}
+		relations = append(relations, r)
+	}
+	return relations, nil
+}
+
+// ExtractRelations runs the LLM relation pass over the given chunks. Subjects and
+// objects become entities (created if new); each relation carries its chunk's valid_at.
+func ExtractRelations(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, chunkIDs []int64, progress ProgressFunc) (RelationExtractionResult, error) {
+	var result RelationExtractionResult
+	var newEntities []entityName
+
+	for i, chunkID := range chunkIDs {
+		var text, title string
+		var validAt sql.NullString
+		err := db.QueryRow(`SELECT text, section_title, valid_at FROM chunks WHERE id = ?`, chunkID).Scan(&text, &title, &validAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("read chunk %d: %w", chunkID, err)
+		}
+		if progress != nil {
+			progress(i, len(chunkIDs), title)
+		}
+
+		raw, err := ollama.GenerateJSON(ctx, model, relationExtractionPrompt, text)
+		if err != nil {
+			return result, fmt.Errorf("extract relations from chunk %d: %w", chunkID, err)
+		}
+		relations, err := parseRelationResponse(raw)
+		if err != nil {
+			if errors.Is(err, errBadModelResponse) {
+				log.Printf("relation extraction: skipping chunk %d: %v", chunkID, err)
+				continue
+			}
+			return result, err
+		}
+
+		var created []entityName
+		relationsCreated := 0
+		err = withWriteTx(db, "extract relations", func(tx *sql.Tx) error {
+			created, relationsCreated = created[:0], 0
+			for _, r := range relations {
+				subjectID, isNew, err := upsertEntity(tx, r.Subject, "")
+				if err != nil {
+					return err
+				}
+				if isNew {
+					created = append(created, entityName{id: subjectID, name: r.Subject})
+				}
+				objectID, isNew, err := upsertEntity(tx, r.Object, "")
+				if err != nil {
+					return err
+				}
+				if isNew {
+					created = append(created, entityName{id: objectID, name: r.Object})
+				}
+
+				res, err := tx.Exec(
+					`INSERT OR IGNORE INTO relations (subject_id, predicate, object_id, chunk_id, valid_at) VALUES (?, ?, ?, ?, ?)`,
+					subjectID, r.Predicate, objectID, chunkID, validAt,
+				)
+				if err != nil {
+					return fmt.Errorf("insert relation: %w", err)
+				}
+				if n, _ := res.RowsAffected(); n > 0 {
+					relationsCreated++
+				}
+			}
+			if err := markExtracted(tx, chunkID, extractionKindRelations); err != nil {
+				return fmt.Errorf("mark extracted: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		newEntities = append(newEntities, created...)
+		result.RelationsCreated += relationsCreated
+		result.ChunksProcessed++
+	}
+	if progress != nil && len(chunkIDs) > 0 {
+		progress(len(chunkIDs), len(chunkIDs), "")
+	}
+
+	for _, e := range newEntities {
+		if err := indexEntityMentions(db, e); err != nil {
+			return result, fmt.Errorf("index mentions of %q: %w", e.name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// Graph walks relations outward from entity (in both directions) up to depth hops
+// and returns the edges found, nearest first and chronological within a hop.
+// If depth <= 0 it defaults to 1; if limit <= 0 it defaults to 50.
+func Graph(db *sql.DB, entity string, depth, limit int) ([]GraphEdge, error) {
+	if depth <= 0 {
+		depth = 1
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+
+	frontier, _, err := lookupEntityIDs(db, resolveAliases(entity))
+	if err != nil {
+		return nil, err
+	}
+	if len(frontier) == 0 {
+		return nil, fmt.Errorf("unknown entity: %s", entity)
+	}
+
+	visited := make(map[int64]bool)
+	seenEdges := make(map[int64]bool)
+	edges := []GraphEdge{}
+
+	for hop := 1; hop <= depth && len(frontier) > 0; hop++ {
+		for _, id := range frontier {
+			visited[id] = true
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(frontier)), ",")
+		args := make([]any, 0, len(frontier)*2)
+		for _, id := range frontier {
+			args = append(args, id)
+		}
+		args = append(args, args...)
+
+		rows, err := db.Query(fmt.Sprintf(
+			`SELECT r.id, r.subject_id, s.name, r.predicate, r.object_id, o.name, r.valid_at, r.chunk_id, c.source_file
+			 FROM relations r
+			 JOIN entities s ON s.id = r.subject_id
+			 JOIN entities o ON o.id = r.object_id
+			 LEFT JOIN chunks c ON c.id = r.chunk_id
+			 WHERE r.subject_id IN (%s) OR r.object_id IN (%s)
+			 ORDER BY CASE WHEN r.valid_at IS NULL THEN 0 ELSE 1 END, r.valid_at ASC, r.id ASC`,
+			placeholders, placeholders,
+		), args...)
+		if err != nil {
+			return nil, err
+		}
+
+		var next []int64
+		for rows.Next() {
+			var relID, subjectID, objectID int64
+			var edge GraphEdge
+			var validAt, sourceFile sql.NullString
+			var chunkID sql.NullInt64
+			if err := rows.Scan(&relID, &subjectID, &edge.Subject, &edge.Predicate, &objectID, &edge.Object, &validAt, &chunkID, &sourceFile); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if seenEdges[relID] {
+				continue
+			}
+			seenEdges[relID] = true
+
+			edge.ValidAt = validAt.String
+			edge.ChunkID = chunkID.Int64
+			edge.SourceFile = sourceFile.String
+			edge.Depth = hop
+			edges = append(edges, edge)
+			if len(edges) >= limit {
+				rows.Close()
+				return edges, nil
+			}
+
+			for _, neighbor := range []int64{subjectID, objectID} {
+				if !visited[neighbor] {
+					visited[neighbor] = true
+					next = append(next, neighbor)
+				}
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		frontier = next
+	}
+
+	return edges, nil
+}
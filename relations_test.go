@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestParseRelationResponse(t *testing.T) {
+	raw := `{"relations": [
+		{"subject": "Alice", "predicate": "Works  On", "object": "Mneme"},
+		{"subject": "Alice", "predicate": "is", "object": "alice"},
+		{"subject": "", "predicate": "uses", "object": "Go"}
+	]}`
+	relations, err := parseRelationResponse(raw)
+	if err != nil {
+		t.Fatalf("parseRelationResponse: %v", err)
+	}
+	if len(relations) != 1 {
+		t.Fatalf("expected 1 relation, got %d: %+v", len(relations), relations)
+	}
+	if relations[0] != (extractedRelation{Subject: "Alice", Predicate: "works on", Object: "Mneme"}) {
+		t.Fatalf("unexpected relation: %+v", relations[0])
+	}
+}
+
+func TestGraph(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	chunkID := insertChunk(t, db, "Alice works on Mneme, which uses SQLite. Bob lives in Paris.", "notes.md", "Team", "", 2, "2025-03-01", makeVec(map[int]float32{0: 1}))
+
+	entity := func(name string) int64 {
+		t.Helper()
+		res, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES (?, '', '2025-03-01')`, name)
+		if err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+	alice, mneme, sqlite, bob, paris := entity("Alice"), entity("Mneme"), entity("SQLite"), entity("Bob"), entity("Paris")
+
+	relation := func(subject int64, predicate string, object int64, validAt sql.NullString) {
+		t.Helper()
+		if _, err := db.Exec(
+			`INSERT INTO relations (subject_id, predicate, object_id, chunk_id, valid_at) VALUES (?, ?, ?, ?, ?)`,
+			subject, predicate, object, chunkID, validAt,
+		); err != nil {
+			t.Fatalf("insert relation: %v", err)
+		}
+	}
+	relation(alice, "works on", mneme, sql.NullString{String: "2025-03-01", Valid: true})
+	relation(mneme, "uses", sqlite, sql.NullString{String: "2025-02-01", Valid: true})
+	relation(bob, "lives in", paris, sql.NullString{})
+
+	edges, err := Graph(db, "alice", 1, 0)
+	if err != nil {
+		t.Fatalf("Graph depth 1: %v", err)
+	}
+	if len(edges) != 1 || edges[0].Object != "Mneme" || edges[0].SourceFile != "notes.md" {
+		t.Fatalf("unexpected depth-1 edges: %+v", edges)
+	}
+
+	edges, err = Graph(db, "Alice", 3, 0)
+	if err != nil {
+		t.Fatalf("Graph depth 3: %v", err)
+	}
+	if len(edges) != 2 {
+		t.Fatalf("expected 2 reachable edges, got %d: %+v", len(edges), edges)
+	}
+	if edges[1].Subject != "Mneme" || edges[1].Predicate != "uses" || edges[1].Depth != 2 {
+		t.Fatalf("unexpected second-hop edge: %+v", edges[1])
+	}
+
+	// Reverse direction: SQLite reaches Mneme, then Alice
+	edges, err = Graph(db, "SQLite", 2, 0)
+	if err != nil {
+		t.Fatalf("Graph from object: %v", err)
+	}
+	if len(edges) != 2 || edges[1].Subject != "Alice" {
+		t.Fatalf("unexpected reverse edges: %+v", edges)
+	}
+
+	if _, err := Graph(db, "Nobody", 1, 0); err == nil {
+		t.Fatal("expected error for unknown entity")
+	}
+}
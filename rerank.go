@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// rerankCandidates is how many of the best vector matches a reranked search scores, of
+// which it keeps the limit it was asked for.
+const rerankCandidates = 30
+
+// rerankMaxWords caps how much of a chunk is shown to the rerank model.
+const rerankMaxWords = 400
+
+const rerankPrompt = `You judge how well a passage from someone's notes answers a search query.
+Return JSON only, in exactly this shape:
+{"score": 0}
+Rules:
+- score is a whole number from 0 to 10: 10 when the passage directly answers the query, 5 when it is on the topic but doesn't answer it, 0 when it is unrelated.
+- Judge the passage alone; sharing words with the query is not enough.`
+
+type rerankResponse struct {
+	Score *float64 `json:"score"`
+}
+
+// rerankScore asks model how well text answers query, from 0 to 10.
+func rerankScore(ctx context.Context, ollama *OllamaClient, model, query, text string) (float64, error) {
+	words := strings.Fields(text)
+	if len(words) > rerankMaxWords {
+		text = strings.Join(words[:rerankMaxWords], " ")
+	}
+	raw, err := ollama.GenerateJSON(ctx, model, rerankPrompt, "Query: "+query+"\n\nPassage:\n"+text)
+	if err != nil {
+		return 0, err
+	}
+	var resp rerankResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Score == nil {
+		return 0, fmt.Errorf("%w: no score", errBadModelResponse)
+	}
+	return min(max(*resp.Score, 0), 10), nil
+}
+
+// rerank has model score each result against query, one pair per request in the way a
+// cross-encoder reads them, and returns the results best score first. Ties, and results
+// the model gave no usable score, keep their order from the vector ranking, the latter
+// after every scored one. Requests run on the client's concurrency workers.
+func rerank(ctx context.Context, ollama *OllamaClient, model, query string, results []SearchResult) ([]SearchResult, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	scores := make([]float64, len(results))
+	var mu sync.Mutex
+	var failed error
+	slots := make(chan struct{}, max(ollama.concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			score, err := rerankScore(ctx, ollama, model, query, results[i].Text)
+			if errors.Is(err, errBadModelResponse) {
+				log.Printf("rerank: chunk %d keeps its place: %v", results[i].ID, err)
+				score, err = -1, nil
+			}
+			if err != nil {
+				// The first failure cancels the rest, which then fail too
+				mu.Lock()
+				if failed == nil {
+					failed = err
+				}
+				mu.Unlock()
+				cancel()
+			}
+			scores[i] = score
+		}()
+	}
+	wg.Wait()
+	if failed != nil {
+		return nil, fmt.Errorf("rerank: %w", failed)
+	}
+
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	reranked := make([]SearchResult, len(results))
+	for i, index := range order {
+		reranked[i] = results[index]
+	}
+	return reranked, nil
+}
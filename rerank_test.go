@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newRerankServer embeds every text as query and scores passages by the digit after
+// "score" in them; passages saying "garbled" get an unusable reply.
+func newRerankServer(t *testing.T, query []float32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/embed":
+			vec := make([]float64, len(query))
+			for i, v := range query {
+				vec[i] = float64(v)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		case "/api/generate":
+			var req generateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			answer := `{"score": 0}`
+			if i := strings.Index(req.Prompt, "score "); i >= 0 {
+				answer = fmt.Sprintf(`{"score": %c}`, req.Prompt[i+6])
+			}
+			if strings.Contains(req.Prompt, "garbled") {
+				answer = `{"relevance": "high"}`
+			}
+			if strings.Contains(req.Prompt, "broken") {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestSearchRerank(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	query := makeVec(map[int]float32{0: 1})
+	near := insertChunk(t, db, "same topic, score 2", "near.md", "Near", "", 2, "", query)
+	garbled := insertChunk(t, db, "garbled", "garbled.md", "Garbled", "", 2, "", makeVec(map[int]float32{0: 1, 1: 0.1}))
+	unscored := insertChunk(t, db, "nothing to say", "unscored.md", "Unscored", "", 2, "", makeVec(map[int]float32{0: 1, 1: 0.5}))
+	answer := insertChunk(t, db, "the actual answer, score 9", "answer.md", "Answer", "", 2, "", makeVec(map[int]float32{0: 1, 1: 2}))
+
+	server := newRerankServer(t, query)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	results, err := SearchWithOptions(context.Background(), db, client, "query", SearchOptions{Limit: 1, ByRelevance: true})
+	if err != nil || len(results) != 1 || results[0].ID != int(near) {
+		t.Fatalf("expected the nearest chunk without reranking, got %+v, %v", results, err)
+	}
+	results, err = SearchWithOptions(context.Background(), db, client, "query", SearchOptions{Limit: 4, ByRelevance: true, RerankModel: "judge"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	var order []int
+	for _, r := range results {
+		order = append(order, r.ID)
+	}
+	if fmt.Sprint(order) != fmt.Sprint([]int{int(answer), int(near), int(unscored), int(garbled)}) {
+		t.Fatalf("expected the best-scored first and the unscorable last, got %v", order)
+	}
+
+	insertChunk(t, db, "broken", "broken.md", "Broken", "", 2, "", query)
+	if _, err := SearchWithOptions(context.Background(), db, client, "query", SearchOptions{Limit: 4, RerankModel: "judge"}); err == nil {
+		t.Fatal("expected a failed generate call reported")
+	}
+}
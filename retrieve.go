@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// Hit types in a search over both chunks and messages.
+const (
+	hitChunk   = "chunk"
+	hitMessage = "message"
+)
+
+// Hit is one result of a search over both chunks and messages. Score puts both kinds on
+// one scale, from 0 for opposite embeddings to 1 for identical ones.
+type Hit struct {
+	Type     string               `json:"type"`
+	Score    float64              `json:"score"`
+	Distance float64              `json:"distance"`
+	Chunk    *SearchResult        `json:"chunk,omitempty"`
+	Message  *MessageSearchResult `json:"message,omitempty"`
+}
+
+// SearchChunksAndMessages embeds query once, then searches vec_chunks (narrowed by opts)
+// and vec_messages at the same time, each on its own pooled connection, and merges the
+// two lists by rank, keeping the best opts.Limit. Both indexes hold embeddings from the
+// same model, so their scores compare directly. Pinned chunks, when asked for, lead.
+// messageLimit defaults to opts.Limit. Hybrid, Rerank and Expand apply to the chunks,
+// whose order the merge keeps.
+func SearchChunksAndMessages(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, opts SearchOptions, messageLimit int) ([]Hit, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	if messageLimit <= 0 {
+		messageLimit = opts.Limit
+	}
+	embedding, err := ollama.Embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	opts.ByRelevance = true
+	opts.query, opts.ollama = query, ollama
+
+	var (
+		wg                   sync.WaitGroup
+		chunks               []SearchResult
+		messages             []MessageSearchResult
+		chunkErr, messageErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		chunks, chunkErr = searchByEmbedding(ctx, db, embedding, opts)
+	}()
+	go func() {
+		defer wg.Done()
+		messages, messageErr = searchMessagesByEmbedding(ctx, db, embedding, messageLimit)
+	}()
+	wg.Wait()
+	if chunkErr != nil {
+		return nil, fmt.Errorf("search chunks: %w", chunkErr)
+	}
+	if messageErr != nil {
+		return nil, fmt.Errorf("search messages: %w", messageErr)
+	}
+	return mergeHits(chunks, messages, opts.Limit), nil
+}
+
+// mergeHits interleaves chunk and message results, best first, and keeps the best limit
+// of them after any pinned chunks. Each list keeps its own order, so chunks ranked by
+// hybrid search or a reranker stay ahead of the ones they outranked: a chunk competes
+// with the messages at the best score of itself and the chunks after it, and the chunk
+// goes first on a tie.
+func mergeHits(chunks []SearchResult, messages []MessageSearchResult, limit int) []Hit {
+	var pinned, ranked []Hit
+	for i := range chunks {
+		if chunks[i].Pinned {
+			pinned = append(pinned, chunkHit(&chunks[i]))
+		} else {
+			ranked = append(ranked, chunkHit(&chunks[i]))
+		}
+	}
+	standing := make([]float64, len(ranked))
+	for i := len(ranked) - 1; i >= 0; i-- {
+		standing[i] = ranked[i].Score
+		if i+1 < len(ranked) {
+			standing[i] = max(standing[i], standing[i+1])
+		}
+	}
+
+	hits := make([]Hit, 0, len(ranked)+len(messages))
+	i, j := 0, 0
+	for i < len(ranked) || j < len(messages) {
+		if j == len(messages) || (i < len(ranked) && standing[i] >= hitScore(messages[j].Distance)) {
+			hits = append(hits, ranked[i])
+			i++
+			continue
+		}
+		hits = append(hits, Hit{Type: hitMessage, Score: hitScore(messages[j].Distance), Distance: messages[j].Distance, Message: &messages[j]})
+		j++
+	}
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return append(pinned, hits...)
+}
+
+func chunkHit(r *SearchResult) Hit {
+	return Hit{Type: hitChunk, Score: hitScore(r.Distance), Distance: r.Distance, Chunk: r}
+}
+
+// hitScore maps a cosine distance, from 0 to 2, onto a score from 1 to 0.
+func hitScore(distance float64) float64 {
+	return min(max(1-distance/2, 0), 1)
+}
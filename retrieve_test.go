@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+func TestMergeHits(t *testing.T) {
+	chunks := []SearchResult{{ID: 9, Distance: 0.9, Pinned: true}, {ID: 1, Distance: 0.1}, {ID: 2, Distance: 0.4}}
+	messages := []MessageSearchResult{{MessageID: "a", Distance: 0.2}, {MessageID: "b", Distance: 0.5}}
+
+	hits := mergeHits(chunks, messages, 0)
+	var order []string
+	for _, h := range hits {
+		if h.Type == hitChunk {
+			order = append(order, fmt.Sprint(h.Chunk.ID))
+		} else {
+			order = append(order, h.Message.MessageID)
+		}
+	}
+	if got := fmt.Sprint(order); got != "[9 1 a 2 b]" {
+		t.Fatalf("unexpected merge order %s", got)
+	}
+	if hits[1].Score != 0.95 || hits[2].Score != 0.9 || hitScore(2.5) != 0 {
+		t.Fatalf("expected scores from 1 for identical to 0 for opposite, got %v, %v", hits[1].Score, hits[2].Score)
+	}
+
+	// Chunks out of distance order, as after hybrid or rerank, keep that order, and only
+	// the best limit come back after the pinned chunk
+	chunks = []SearchResult{{ID: 9, Distance: 0.9, Pinned: true}, {ID: 2, Distance: 0.4}, {ID: 1, Distance: 0.1}}
+	hits = mergeHits(chunks, messages, 3)
+	order = nil
+	for _, h := range hits {
+		if h.Type == hitChunk {
+			order = append(order, fmt.Sprint(h.Chunk.ID))
+		} else {
+			order = append(order, h.Message.MessageID)
+		}
+	}
+	if got := fmt.Sprint(order); got != "[9 2 1 a]" {
+		t.Fatalf("unexpected merge order %s", got)
+	}
+}
+
+func TestSearchChunksAndMessages(t *testing.T) {
+	// A file database, so the two searches really run on separate connections
+	db, err := InitDB(filepath.Join(t.TempDir(), "mneme.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	query := makeVec(map[int]float32{0: 1})
+	near := insertChunk(t, db, "Tokens live in Postgres.", "a.md", "Tokens", "", 2, "2025-06-01", query)
+	insertChunk(t, db, "Lunch was good.", "b.md", "Lunch", "", 2, "2025-06-02", makeVec(map[int]float32{1: 1}))
+
+	blob := func(vec []float32) []byte {
+		b, err := sqlite_vec.SerializeFloat32(vec)
+		if err != nil {
+			t.Fatalf("serialize: %v", err)
+		}
+		return b
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	at := time.Date(2025, time.June, 2, 10, 0, 0, 0, time.UTC)
+	if _, err := storeMessages(tx, []preparedMessage{
+		{message: textMessage{Role: "User", Text: "Where do tokens live?", Timestamp: at, MessageID: "m1", SessionID: "s"}, serialized: blob(makeVec(map[int]float32{0: 1, 1: 0.3}))},
+		{message: textMessage{Role: "User", Text: "Unrelated chatter here", Timestamp: at, MessageID: "m2", SessionID: "s"}, serialized: blob(makeVec(map[int]float32{2: 1}))},
+	}); err != nil {
+		t.Fatalf("store messages: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	server := newOllamaServer(t, query)
+	defer server.Close()
+	hits, err := SearchChunksAndMessages(context.Background(), db, NewOllamaClient(server.URL, "embed"), "tokens", SearchOptions{Limit: 2}, 1)
+	if err != nil {
+		t.Fatalf("SearchChunksAndMessages: %v", err)
+	}
+	if len(hits) != 2 || hits[0].Type != hitChunk || hits[0].Chunk.ID != int(near) || hits[1].Type != hitMessage || hits[1].Message.MessageID != "m1" {
+		t.Fatalf("expected the best 2 hits, got %+v", hits)
+	}
+
+	// The query reaches the chunk search, so keyword matching works across both, and the
+	// keyword match hybrid ranks first stays ahead of the nearer chunk it outranked
+	hits, err = SearchChunksAndMessages(context.Background(), db, NewOllamaClient(server.URL, "embed"), "Lunch", SearchOptions{Limit: 3, Hybrid: true}, 1)
+	if err != nil || len(hits) != 3 || hits[0].Type != hitChunk || hits[0].Chunk.SectionTitle != "Lunch" || hits[1].Type != hitChunk || hits[1].Chunk.ID != int(near) {
+		t.Fatalf("expected the keyword match first, got %+v, %v", hits, err)
+	}
+}
+
+func TestSearchChunksAndMessagesRerank(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	query := makeVec(map[int]float32{0: 1})
+	insertChunk(t, db, "same topic, score 2", "near.md", "Near", "", 2, "", query)
+	answer := insertChunk(t, db, "the actual answer, score 9", "answer.md", "Answer", "", 2, "", makeVec(map[int]float32{0: 1, 1: 2}))
+
+	server := newRerankServer(t, query)
+	defer server.Close()
+	hits, err := SearchChunksAndMessages(context.Background(), db, NewOllamaClient(server.URL, "embed"), "query", SearchOptions{Limit: 1, RerankModel: "judge"}, 1)
+	if err != nil || len(hits) != 1 || hits[0].Type != hitChunk || hits[0].Chunk.ID != int(answer) {
+		t.Fatalf("expected the reranked chunk kept first, got %+v, %v", hits, err)
+	}
+}
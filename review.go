@@ -0,0 +1,344 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// reviewQuotes is how many notable quotes a review lists.
+const reviewQuotes = 5
+
+// reviewQuoteMax caps a quote, in runes.
+const reviewQuoteMax = 240
+
+// generatedSourcePatterns are the LIKE patterns of sources mneme writes itself, which
+// reviews read as summaries rather than quote from.
+var generatedSourcePatterns = []string{
+	digestSourcePrefix + "%",
+	consolidatedSourcePrefix + "%",
+	reflectionSourcePrefix + "%",
+	sourceSummaryPrefix + "%",
+	"watch://%/summary-%",
+	"watch-cc://%/summary-%",
+}
+
+// ReviewSummary is one stored summary that falls in the reviewed week.
+type ReviewSummary struct {
+	Label      string `json:"label"`
+	SourceFile string `json:"source_file"`
+	Date       string `json:"date,omitempty"`
+	Text       string `json:"text"`
+}
+
+// ReviewItem is a decision, open question or highlight lifted from a summary.
+type ReviewItem struct {
+	Text string `json:"text"`
+	Date string `json:"date,omitempty"`
+}
+
+// ReviewEntity is an entity first mentioned during the reviewed week.
+type ReviewEntity struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind,omitempty"`
+	FirstSeen string `json:"first_seen"`
+	Mentions  int    `json:"mentions"`
+}
+
+// ReviewQuote is a passage from one of the week's most important chunks.
+type ReviewQuote struct {
+	Text       string  `json:"text"`
+	SourceFile string  `json:"source_file"`
+	Date       string  `json:"date"`
+	Importance float64 `json:"importance"`
+}
+
+// WeeklyReview compiles what mneme already knows about one ISO week.
+type WeeklyReview struct {
+	Week          string          `json:"week"`
+	Start         string          `json:"start"`
+	End           string          `json:"end"`
+	Summaries     []ReviewSummary `json:"summaries"`
+	Highlights    []ReviewItem    `json:"highlights"`
+	Decisions     []ReviewItem    `json:"decisions"`
+	OpenQuestions []ReviewItem    `json:"open_questions"`
+	NewEntities   []ReviewEntity  `json:"new_entities"`
+	Quotes        []ReviewQuote   `json:"quotes"`
+}
+
+var isoWeekPattern = regexp.MustCompile(`^(\d{4})-W(\d{1,2})$`)
+
+// ParseISOWeek returns the Monday starting an ISO week written as 2025-W23.
+func ParseISOWeek(week string) (time.Time, error) {
+	m := isoWeekPattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(week)))
+	if m == nil {
+		return time.Time{}, fmt.Errorf("week must look like 2025-W23, got %q", week)
+	}
+	year, _ := strconv.Atoi(m[1])
+	num, _ := strconv.Atoi(m[2])
+	// Week 1 is the week holding January 4th
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	week1 := consolidationPeriod(consolidateWeek, jan4)
+	monday := week1.AddDate(0, 0, (num-1)*7)
+	if y, w := monday.ISOWeek(); num < 1 || y != year || w != num {
+		return time.Time{}, fmt.Errorf("%d has no week %d", year, num)
+	}
+	return monday, nil
+}
+
+// ISOWeekLabel formats the ISO week holding t as 2025-W23.
+func ISOWeekLabel(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// summaryParagraph is a stored summary's text before its bold-labelled lists.
+func summaryParagraph(text string) string {
+	if i := strings.Index(text, "**"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text)
+}
+
+// summaryListItems returns the "- " lines under a "**label**" line of a stored summary.
+func summaryListItems(text, label string) []string {
+	var items []string
+	in := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "**"+label+"**":
+			in = true
+		case in && strings.HasPrefix(line, "- "):
+			items = append(items, strings.TrimSpace(line[2:]))
+		case in:
+			in = false
+		}
+	}
+	return items
+}
+
+// reviewQuote picks the longest prose line of a chunk (skipping speaker labels and
+// headings) and shortens it at a word boundary.
+func reviewQuote(text string) string {
+	best := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "**") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimLeft(line, "-*> "))
+		if utf8.RuneCountInString(line) > utf8.RuneCountInString(best) {
+			best = line
+		}
+	}
+	if utf8.RuneCountInString(best) <= reviewQuoteMax {
+		return best
+	}
+	cut := string([]rune(best)[:reviewQuoteMax])
+	if i := strings.LastIndex(cut, " "); i > reviewQuoteMax/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, ",;: ") + "..."
+}
+
+func appendUniqueItems(items []ReviewItem, seen map[string]bool, lines []string, date string) []ReviewItem {
+	for _, line := range lines {
+		key := strings.ToLower(line)
+		if line == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		items = append(items, ReviewItem{Text: line, Date: date})
+	}
+	return items
+}
+
+// BuildWeeklyReview gathers the week starting monday: stored summaries (the weekly
+// rollup, daily digests, session summaries) with their highlights, decisions and open
+// questions, entities first mentioned that week, and quotes from its most important
+// chunks. It makes no model calls; run digest, consolidate and importance first for a
+// fuller review.
+func BuildWeeklyReview(db *sql.DB, monday time.Time) (*WeeklyReview, error) {
+	start := monday.Format("2006-01-02")
+	end := monday.AddDate(0, 0, 6).Format("2006-01-02")
+	review := &WeeklyReview{
+		Week: ISOWeekLabel(monday), Start: start, End: end,
+		Summaries: []ReviewSummary{}, Highlights: []ReviewItem{}, Decisions: []ReviewItem{},
+		OpenQuestions: []ReviewItem{}, NewEntities: []ReviewEntity{}, Quotes: []ReviewQuote{},
+	}
+
+	// Rollup first, then digests, then session summaries, each by date
+	rows, err := db.Query(
+		`SELECT source_file, COALESCE(valid_at, ''), section_title, text FROM chunks
+		 WHERE source_file = ?
+		    OR (source_file LIKE ? AND valid_at BETWEEN ? AND ?)
+		    OR ((source_file LIKE 'watch://%/summary-%' OR source_file LIKE 'watch-cc://%/summary-%') AND valid_at BETWEEN ? AND ?)
+		 ORDER BY CASE WHEN source_file LIKE ? THEN 0 WHEN source_file LIKE ? THEN 1 ELSE 2 END,
+		          valid_at, source_file, section_sequence, chunk_sequence`,
+		rollupSource(consolidateWeek, monday),
+		digestSourcePrefix+"%", start, end,
+		start, end,
+		consolidatedSourcePrefix+"%", digestSourcePrefix+"%",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load summaries: %w", err)
+	}
+	for rows.Next() {
+		var s ReviewSummary
+		if err := rows.Scan(&s.SourceFile, &s.Date, &s.Label, &s.Text); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// A long summary is stored as several chunks of one source
+		if n := len(review.Summaries); n > 0 && review.Summaries[n-1].SourceFile == s.SourceFile {
+			review.Summaries[n-1].Text += "\n\n" + s.Text
+			continue
+		}
+		review.Summaries = append(review.Summaries, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The rollup and digests repeat each other's lists
+	seenHighlights, seenDecisions, seenQuestions := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for i, s := range review.Summaries {
+		// The rollup is dated by its Monday, which says nothing about its items
+		date := s.Date
+		if strings.HasPrefix(s.SourceFile, consolidatedSourcePrefix) {
+			date = ""
+		}
+		review.Highlights = appendUniqueItems(review.Highlights, seenHighlights, summaryListItems(s.Text, "Highlights"), date)
+		review.Decisions = appendUniqueItems(review.Decisions, seenDecisions, summaryListItems(s.Text, "Decisions"), date)
+		review.OpenQuestions = appendUniqueItems(review.OpenQuestions, seenQuestions, summaryListItems(s.Text, "Open questions"), date)
+		review.Summaries[i].Text = summaryParagraph(s.Text)
+	}
+
+	rows, err = db.Query(
+		`SELECT e.name, e.kind, MIN(COALESCE(c.valid_at, local_date(c.ingested_at))) AS first_seen, COUNT(DISTINCT c.id)
+		 FROM entities e
+		 JOIN chunk_entities ce ON ce.entity_id = e.id
+		 JOIN chunks c ON c.id = ce.chunk_id
+		 GROUP BY e.id
+		 HAVING first_seen BETWEEN ? AND ?
+		 ORDER BY COUNT(DISTINCT c.id) DESC, e.name`,
+		start, end,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load entities: %w", err)
+	}
+	for rows.Next() {
+		var e ReviewEntity
+		if err := rows.Scan(&e.Name, &e.Kind, &e.FirstSeen, &e.Mentions); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		review.NewEntities = append(review.NewEntities, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT source_file, COALESCE(valid_at, local_date(ingested_at)), importance, text FROM chunks
+		 WHERE COALESCE(valid_at, local_date(ingested_at)) BETWEEN ? AND ? AND importance IS NOT NULL`
+	args := []any{start, end}
+	for _, pattern := range generatedSourcePatterns {
+		query += ` AND source_file NOT LIKE ?`
+		args = append(args, pattern)
+	}
+	query += ` ORDER BY importance DESC, id LIMIT ?`
+	args = append(args, reviewQuotes)
+	rows, err = db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("load quotes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var q ReviewQuote
+		var text string
+		if err := rows.Scan(&q.SourceFile, &q.Date, &q.Importance, &text); err != nil {
+			return nil, err
+		}
+		if q.Text = reviewQuote(text); q.Text != "" {
+			review.Quotes = append(review.Quotes, q)
+		}
+	}
+	return review, rows.Err()
+}
+
+// Empty reports whether the review found nothing at all for its week.
+func (r *WeeklyReview) Empty() bool {
+	return len(r.Summaries) == 0 && len(r.NewEntities) == 0 && len(r.Quotes) == 0
+}
+
+// RenderReviewMarkdown renders a review as a standalone note.
+func RenderReviewMarkdown(r *WeeklyReview) string {
+	start, _ := time.Parse("2006-01-02", r.Start)
+	end, _ := time.Parse("2006-01-02", r.End)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Weekly review %s\n\n", r.Week)
+	fmt.Fprintf(&b, "%s to %s\n\n", start.Format("Monday, January 2"), end.Format("Monday, January 2, 2006"))
+
+	if len(r.Summaries) > 0 {
+		b.WriteString("## Summaries\n\n")
+		for _, s := range r.Summaries {
+			fmt.Fprintf(&b, "### %s\n\n", s.Label)
+			if s.Text != "" {
+				b.WriteString(s.Text + "\n\n")
+			}
+		}
+	}
+	for _, part := range []struct {
+		label string
+		items []ReviewItem
+	}{
+		{"Highlights", r.Highlights},
+		{"Key decisions", r.Decisions},
+		{"Open questions", r.OpenQuestions},
+	} {
+		if len(part.items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "## %s\n\n", part.label)
+		for _, item := range part.items {
+			if item.Date != "" {
+				fmt.Fprintf(&b, "- %s (%s)\n", item.Text, item.Date)
+			} else {
+				fmt.Fprintf(&b, "- %s\n", item.Text)
+			}
+		}
+		b.WriteString("\n")
+	}
+	if len(r.NewEntities) > 0 {
+		b.WriteString("## New this week\n\n")
+		for _, e := range r.NewEntities {
+			kind := ""
+			if e.Kind != "" {
+				kind = ", " + e.Kind
+			}
+			fmt.Fprintf(&b, "- **%s**%s: first seen %s, %d mentions\n", e.Name, kind, e.FirstSeen, e.Mentions)
+		}
+		b.WriteString("\n")
+	}
+	if len(r.Quotes) > 0 {
+		b.WriteString("## Notable quotes\n\n")
+		for _, q := range r.Quotes {
+			fmt.Fprintf(&b, "> %s\n>\n> — %s, %s\n\n", q.Text, q.SourceFile, q.Date)
+		}
+	}
+	return b.String()
+}
+
+// WriteReviewFile writes the rendered review to path.
+func WriteReviewFile(path string, r *WeeklyReview) error {
+	return os.WriteFile(path, []byte(RenderReviewMarkdown(r)), 0o644)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseISOWeek(t *testing.T) {
+	for week, want := range map[string]string{
+		"2025-W23": "2025-06-02",
+		"2025-w1":  "2024-12-30",
+		"2020-W53": "2020-12-28",
+	} {
+		monday, err := ParseISOWeek(week)
+		if err != nil || monday.Format("2006-01-02") != want {
+			t.Errorf("ParseISOWeek(%q) = %s, %v; want %s", week, monday.Format("2006-01-02"), err, want)
+		}
+	}
+	for _, bad := range []string{"2025-W53", "2025-W0", "2025-23", "June"} {
+		if _, err := ParseISOWeek(bad); err == nil {
+			t.Errorf("ParseISOWeek(%q): expected an error", bad)
+		}
+	}
+	if got := ISOWeekLabel(time.Date(2025, time.June, 8, 0, 0, 0, 0, time.UTC)); got != "2025-W23" {
+		t.Fatalf("expected Sunday in week 23, got %s", got)
+	}
+}
+
+func TestReviewQuote(t *testing.T) {
+	text := "**User** [10:00]:\nShort.\n\n**Assistant** [10:01]:\nWe should keep the retry budget at three attempts."
+	if got := reviewQuote(text); got != "We should keep the retry budget at three attempts." {
+		t.Fatalf("unexpected quote %q", got)
+	}
+	long := reviewQuote(strings.Repeat("word ", 100))
+	if !strings.HasSuffix(long, "...") || len([]rune(long)) > reviewQuoteMax+3 {
+		t.Fatalf("expected a shortened quote, got %q", long)
+	}
+}
+
+func TestBuildWeeklyReview(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	insertChunk(t, db, "Mostly auth work.\n\n**Decisions**\n- Use Postgres for tokens\n\n**Open questions**\n- Token TTL?\n",
+		"consolidated://week/2025-06-02", "Week of June 2, 2025", "", 2, "2025-06-02", vec)
+	digest := insertChunk(t, db, "Tuesday was about tokens.\n\n**Highlights**\n- Benchmarked Postgres\n\n**Decisions**\n- use postgres for tokens\n- Drop Redis\n",
+		"digest://2025-06-03", "Digest, June 3, 2025", "", 2, "2025-06-03", vec)
+	insertChunk(t, db, "**Decisions**\n- Ship Friday\n", "watch://s1/summary-0", "Backend: session summary, June 5, 2025", "", 2, "2025-06-05", vec)
+	insertChunk(t, db, "Another week.\n\n**Decisions**\n- Not this week\n", "digest://2025-06-10", "Digest, June 10, 2025", "", 2, "2025-06-10", vec)
+
+	note := insertChunk(t, db, "Keep the retry budget at three attempts, no more.", "notes.md", "Retries", "", 2, "2025-06-04", vec)
+	old := insertChunk(t, db, "Redis notes.", "old.md", "Redis", "", 2, "2025-01-01", vec)
+	db.Exec(`UPDATE chunks SET importance = 0.9 WHERE id = ?`, note)
+	db.Exec(`UPDATE chunks SET importance = 1 WHERE id = ?`, digest)
+
+	for name, chunks := range map[string][]int64{"Postgres": {note}, "Redis": {old, note}} {
+		res, err := db.Exec(`INSERT INTO entities (name, kind, created_at) VALUES (?, 'tool', '2025-06-04')`, name)
+		if err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		for _, chunk := range chunks {
+			db.Exec(`INSERT INTO chunk_entities (chunk_id, entity_id) VALUES (?, ?)`, chunk, id)
+		}
+	}
+
+	monday, _ := ParseISOWeek("2025-W23")
+	review, err := BuildWeeklyReview(db, monday)
+	if err != nil {
+		t.Fatalf("BuildWeeklyReview: %v", err)
+	}
+	if len(review.Summaries) != 3 || review.Summaries[0].SourceFile != "consolidated://week/2025-06-02" || review.Summaries[1].Text != "Tuesday was about tokens." {
+		t.Fatalf("unexpected summaries: %+v", review.Summaries)
+	}
+	if len(review.Decisions) != 3 || review.Decisions[0].Date != "" || review.Decisions[1].Text != "Drop Redis" || review.Decisions[1].Date != "2025-06-03" {
+		t.Fatalf("expected deduplicated decisions from the week only, got %+v", review.Decisions)
+	}
+	if len(review.Highlights) != 1 || len(review.OpenQuestions) != 1 {
+		t.Fatalf("unexpected lists: %+v %+v", review.Highlights, review.OpenQuestions)
+	}
+	if len(review.NewEntities) != 1 || review.NewEntities[0].Name != "Postgres" {
+		t.Fatalf("expected only Postgres as new, got %+v", review.NewEntities)
+	}
+	if len(review.Quotes) != 1 || review.Quotes[0].SourceFile != "notes.md" {
+		t.Fatalf("expected a quote from the note, not the digest, got %+v", review.Quotes)
+	}
+
+	path := filepath.Join(t.TempDir(), "review.md")
+	if err := WriteReviewFile(path, review); err != nil {
+		t.Fatalf("WriteReviewFile: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	md := string(data)
+	for _, want := range []string{"# Weekly review 2025-W23", "Monday, June 2 to Sunday, June 8, 2025", "## Key decisions", "- Drop Redis (2025-06-03)", "## New this week", "> Keep the retry budget"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in review:\n%s", want, md)
+		}
+	}
+
+	empty, err := BuildWeeklyReview(db, monday.AddDate(0, 0, -70))
+	if err != nil || !empty.Empty() {
+		t.Fatalf("expected an empty review, got %+v, %v", empty, err)
+	}
+}
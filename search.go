@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
 )
@@ -16,47 +19,310 @@ type SearchResult struct {
 	ParentTitle  string
 	HeaderLevel  int
 	ValidAt      string
+	ValidUntil   string  `json:",omitempty"`
+	SupersededBy int64   `json:",omitempty"`
+	Importance   float64 `json:",omitempty"`
+	Decay        float64 `json:",omitempty"`
+	Pinned       bool    `json:",omitempty"`
+	decayScored  bool
 	Distance     float64
+	// SectionText is the whole section the chunk was split from, when Expand asked for
+	// it and the section spans more than one chunk.
+	SectionText string `json:",omitempty"`
 }
 
-func Search(db *sql.DB, ollama *OllamaClient, query string, limit int, asOf string) ([]SearchResult, error) {
-	ctx := context.Background()
+// SearchOptions narrows a semantic search.
+type SearchOptions struct {
+	Limit int
+	AsOf  string
+	// Current drops chunks that a newer chunk has superseded.
+	Current bool
+	// EntityType keeps only chunks linked to an entity of this type (person, project, place, tool).
+	EntityType string
+	// Tag keeps only chunks carrying this tag (e.g. a topic from tag-topics).
+	Tag string
+	// Since and Until keep only chunks dated within this range, both days included.
+	// Undated chunks fall outside any range.
+	Since string
+	Until string
+	// Sources keeps only chunks whose source matches one of these: a glob such as
+	// "watch://*" or "notes/*.md", or else a prefix such as "notes/".
+	Sources []string
+	// ImportanceBoost (0 to 1) shrinks each chunk's distance by boost × importance
+	// before the top results are chosen, so important memories win close calls.
+	ImportanceBoost float64
+	// DecayWeight (0 to 1) stretches each chunk's distance by weight × (1 - decay), so
+	// faded memories lose close calls. Chunks without a decay score are not penalized.
+	DecayWeight float64
+	// IncludeArchived keeps chunks archived by the decay pass.
+	IncludeArchived bool
+	// Reinforce records the returned chunks as retrieved (see RecordRetrieval).
+	Reinforce bool
+	// ByRelevance returns results best match first instead of chronologically.
+	ByRelevance bool
+	// IncludePinned puts every pinned chunk ahead of the results, however distant.
+	IncludePinned bool
+	// Hybrid also ranks chunks by BM25 keyword match on the query's words, and merges that
+	// ranking with the vector one by reciprocal rank fusion, so exact identifiers and rare
+	// names are found even when their embeddings are not close.
+	Hybrid bool
+	// RerankModel, when set, has this generate model score the best rerankCandidates
+	// matches against the query one by one, and keeps the limit it scores highest.
+	RerankModel string
+	// Expand fills in each result's SectionText from its sibling chunks.
+	Expand bool
+
+	// query is the text behind the embedding, which hybrid search matches keywords against
+	query string
+	// ollama scores query and chunk pairs for RerankModel
+	ollama *OllamaClient
+}
+
+func Search(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, limit int, asOf string) ([]SearchResult, error) {
+	return SearchWithOptions(ctx, db, ollama, query, SearchOptions{Limit: limit, AsOf: asOf})
+}
+
+func SearchWithOptions(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, opts SearchOptions) ([]SearchResult, error) {
+	defer func(start time.Time) { searchLatency.observe(time.Since(start).Seconds()) }(time.Now())
 	embedding, err := ollama.Embed(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	opts.query, opts.ollama = query, ollama
+	return searchByEmbedding(ctx, db, embedding, opts)
+}
 
-	serialized, err := sqlite_vec.SerializeFloat32(embedding)
+// SearchWithFallback is SearchWithOptions that keeps working while Ollama is down: when
+// the query can't be embedded because the server is unreachable, chunks are found by
+// keyword match alone (see keywordChunks), with the same filters, and degraded is true.
+// Reranking is skipped then, as it needs the model server too.
+func SearchWithFallback(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, opts SearchOptions) (results []SearchResult, degraded bool, err error) {
+	defer func(start time.Time) { searchLatency.observe(time.Since(start).Seconds()) }(time.Now())
+	embedding, err := ollama.Embed(ctx, query)
+	if err != nil && !ollamaUnreachable(ctx, err) {
+		return nil, false, err
+	}
+	degraded = err != nil
+	opts.query, opts.ollama = query, ollama
+	results, err = searchByEmbedding(ctx, db, embedding, opts)
+	return results, degraded, err
+}
+
+// searchByEmbedding is SearchWithOptions for a query that is already embedded. Without
+// an embedding it ranks chunks by keyword match on opts.query alone.
+func searchByEmbedding(ctx context.Context, db *sql.DB, embedding []float32, opts SearchOptions) ([]SearchResult, error) {
+	limit := opts.Limit
+	asOf, err := NormalizeDate(opts.AsOf)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("as-of: %w", err)
+	}
+	bounds := dateBounds{asOf: asOf}
+	if bounds.since, err = NormalizeDate(opts.Since); err != nil {
+		return nil, fmt.Errorf("since: %w", err)
+	}
+	if bounds.until, err = NormalizeDate(opts.Until); err != nil {
+		return nil, fmt.Errorf("until: %w", err)
+	}
+	if bounds.since != "" && bounds.until != "" && bounds.since > bounds.until {
+		return nil, fmt.Errorf("since %s is after until %s", bounds.since, bounds.until)
 	}
 
+	// Resolved before the KNN query so its rows aren't held open
+	var typed map[int64]bool
+	if opts.EntityType != "" {
+		kind, err := normalizeEntityKind(opts.EntityType)
+		if err != nil {
+			return nil, err
+		}
+		if typed, err = chunksWithEntityKind(db, kind); err != nil {
+			return nil, err
+		}
+	}
+	var tagged map[int64]bool
+	if opts.Tag != "" {
+		var err error
+		if tagged, err = chunksWithTag(db, opts.Tag); err != nil {
+			return nil, err
+		}
+	}
+
+	var serialized []byte
+	if embedding != nil {
+		if serialized, err = sqlite_vec.SerializeFloat32(embedding); err != nil {
+			return nil, err
+		}
+	}
+
+	archived := false
+	if !opts.IncludeArchived {
+		stmt, err := cachedStmt(db, `SELECT EXISTS(SELECT 1 FROM chunks WHERE archived_at IS NOT NULL)`)
+		if err != nil {
+			return nil, err
+		}
+		if err := stmt.QueryRowContext(ctx).Scan(&archived); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keyword matches stand in for the vector ones when there is no embedding
+	keywordOnly := embedding == nil
+	hybrid := (opts.Hybrid || keywordOnly) && opts.query != ""
 	fetchLimit := limit
-	if asOf != "" {
+	if opts.Current || typed != nil || tagged != nil || opts.ImportanceBoost > 0 || opts.DecayWeight > 0 || archived || hybrid {
 		fetchLimit = limit * 3
 	}
+	reranked := opts.RerankModel != "" && opts.query != "" && opts.ollama != nil && !keywordOnly
+	if reranked {
+		fetchLimit = max(fetchLimit, rerankCandidates)
+	}
 
-	rows, err := db.Query(
-		`SELECT v.chunk_id, v.distance, c.text, c.source_file, c.section_title, c.parent_title, c.header_level, c.valid_at
+	// The date bounds are checked by vec0 against its copies of the validity columns, so
+	// the k nearest are all in bounds rather than filtered down afterwards
+	dates, dateArgs := bounds.condition()
+	knn := `v.embedding MATCH ? AND v.k = ?` + dates
+	args := append([]any{serialized, fetchLimit}, dateArgs...)
+	query := `SELECT v.chunk_id, v.distance, c.text, c.source_file, c.section_title, c.parent_title, c.header_level, c.valid_at, c.valid_until, c.superseded_by, c.importance, c.decay, c.archived_at
 		 FROM vec_chunks v
 		 JOIN chunks c ON c.id = v.chunk_id
-		 WHERE v.embedding MATCH ? AND v.k = ?
+		 WHERE ` + knn + `
 		 ORDER BY v.distance
-		 LIMIT ?`,
-		serialized,
-		fetchLimit,
-		fetchLimit,
-	)
-	if err != nil {
-		return nil, err
+		 LIMIT ?`
+	scope, scopeArgs := sourceCondition(opts.Sources)
+	if scope != "" {
+		// The k nearest overall may hold none of a small scope, so rank the scope's own
+		// chunks instead, which is the same exact scan vec0 makes over every chunk
+		query = `SELECT v.chunk_id, COALESCE(vec_distance_cosine(v.embedding, ?), 1) AS distance, c.text, c.source_file, c.section_title, c.parent_title, c.header_level, c.valid_at, c.valid_until, c.superseded_by, c.importance, c.decay, c.archived_at
+		 FROM chunks c
+		 JOIN vec_chunks v ON v.chunk_id = c.id
+		 WHERE ` + scope + dates + `
+		 ORDER BY distance
+		 LIMIT ?`
+		args = append(append([]any{serialized}, scopeArgs...), dateArgs...)
+	}
+	results := []SearchResult{}
+	if !keywordOnly {
+		stmt, err := cachedStmt(db, query)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := stmt.QueryContext(ctx, append(args, fetchLimit)...)
+		if err != nil {
+			return nil, err
+		}
+		results, err = scanSearchResults(rows, opts.IncludeArchived)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var keyword []SearchResult
+	if hybrid {
+		if keyword, err = keywordChunks(ctx, db, opts.query, serialized, bounds, opts.Sources, opts.IncludeArchived, fetchLimit); err != nil {
+			return nil, fmt.Errorf("keyword search: %w", err)
+		}
+	}
+
+	if opts.Current || typed != nil || tagged != nil {
+		filter := func(results []SearchResult) []SearchResult {
+			filtered := make([]SearchResult, 0, len(results))
+			for _, result := range results {
+				if opts.Current && result.SupersededBy != 0 {
+					continue
+				}
+				if typed != nil && !typed[int64(result.ID)] {
+					continue
+				}
+				if tagged != nil && !tagged[int64(result.ID)] {
+					continue
+				}
+				filtered = append(filtered, result)
+			}
+			return filtered
+		}
+		results, keyword = filter(results), filter(keyword)
+	}
+
+	if opts.ImportanceBoost > 0 || opts.DecayWeight > 0 {
+		adjusted := func(r SearchResult) float64 {
+			d := r.Distance * (1 - opts.ImportanceBoost*r.Importance)
+			if r.decayScored {
+				d *= 1 + opts.DecayWeight*(1-r.Decay)
+			}
+			return d
+		}
+		sort.SliceStable(results, func(i, j int) bool { return adjusted(results[i]) < adjusted(results[j]) })
+	}
+
+	if hybrid {
+		results = fuseRanks(results, keyword)
+	}
+
+	if reranked {
+		if len(results) > max(limit, rerankCandidates) {
+			results = results[:max(limit, rerankCandidates)]
+		}
+		if results, err = rerank(ctx, opts.ollama, opts.RerankModel, opts.query, results); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	if opts.Reinforce && len(results) > 0 {
+		ids := make([]int64, len(results))
+		for i, r := range results {
+			ids[i] = int64(r.ID)
+		}
+		if err := RecordRetrieval(db, ids, time.Now()); err != nil {
+			return nil, fmt.Errorf("record retrieval: %w", err)
+		}
 	}
-	defer rows.Close()
 
+	if !opts.ByRelevance {
+		sort.SliceStable(results, func(i, j int) bool {
+			left := results[i].ValidAt
+			right := results[j].ValidAt
+			if left == "" && right == "" {
+				return false
+			}
+			if left == "" {
+				return true
+			}
+			if right == "" {
+				return false
+			}
+			return left < right
+		})
+	}
+
+	if opts.IncludePinned {
+		if results, err = withPinned(db, serialized, results); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Expand {
+		if err := expandSections(ctx, db, results); err != nil {
+			return nil, fmt.Errorf("expand sections: %w", err)
+		}
+	}
+	return results, nil
+}
+
+// scanSearchResults reads rows of (id, distance, text, source_file, section_title,
+// parent_title, header_level, valid_at, valid_until, superseded_by, importance, decay,
+// archived_at), dropping archived chunks unless includeArchived.
+func scanSearchResults(rows *sql.Rows, includeArchived bool) ([]SearchResult, error) {
 	results := []SearchResult{}
 	for rows.Next() {
 		var result SearchResult
 		var parentTitle sql.NullString
-		var validAt sql.NullString
+		var validAt, validUntil sql.NullString
+		var supersededBy sql.NullInt64
+		var importance, decay sql.NullFloat64
+		var archivedAt sql.NullString
 		if err := rows.Scan(
 			&result.ID,
 			&result.Distance,
@@ -66,6 +332,11 @@ func Search(db *sql.DB, ollama *OllamaClient, query string, limit int, asOf stri
 			&parentTitle,
 			&result.HeaderLevel,
 			&validAt,
+			&validUntil,
+			&supersededBy,
+			&importance,
+			&decay,
+			&archivedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -75,40 +346,62 @@ func Search(db *sql.DB, ollama *OllamaClient, query string, limit int, asOf stri
 		if validAt.Valid {
 			result.ValidAt = validAt.String
 		}
+		result.ValidUntil = validUntil.String
+		result.SupersededBy = supersededBy.Int64
+		result.Importance = importance.Float64
+		result.Decay, result.decayScored = decay.Float64, decay.Valid
+		if archivedAt.Valid && !includeArchived {
+			continue
+		}
 		results = append(results, result)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+	return results, rows.Err()
+}
 
-	if asOf != "" {
-		filtered := make([]SearchResult, 0, len(results))
-		for _, result := range results {
-			if result.ValidAt == "" || result.ValidAt <= asOf {
-				filtered = append(filtered, result)
-			}
+// sourceCondition is the SQL condition on c.source_file that keeps chunks from any of
+// patterns, with its arguments, or "" when there are none. A pattern with *, ? or [ is
+// matched as a GLOB, in which * also spans "/"; any other is a prefix.
+func sourceCondition(patterns []string) (string, []any) {
+	var conditions []string
+	var args []any
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			conditions = append(conditions, "c.source_file GLOB ?")
+			args = append(args, pattern)
+		} else {
+			conditions = append(conditions, "substr(c.source_file, 1, length(?)) = ?")
+			args = append(args, pattern, pattern)
 		}
-		results = filtered
 	}
-
-	if len(results) > limit {
-		results = results[:limit]
+	if len(conditions) == 0 {
+		return "", nil
 	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
 
-	sort.SliceStable(results, func(i, j int) bool {
-		left := results[i].ValidAt
-		right := results[j].ValidAt
-		if left == "" && right == "" {
-			return false
-		}
-		if left == "" {
-			return true
-		}
-		if right == "" {
-			return false
-		}
-		return left < right
-	})
+// dateBounds are the limits a search puts on when its chunks were valid: on the asOf
+// day, and dated from since to until. Empty fields set no limit.
+type dateBounds struct {
+	asOf, since, until string
+}
 
-	return results, nil
+// condition is the SQL for the bounds on vec_chunks v, each term led by AND so it can
+// follow any other condition, with its arguments.
+func (b dateBounds) condition() (string, []any) {
+	var sql string
+	var args []any
+	if b.asOf != "" {
+		sql += ` AND v.valid_at <= ? AND v.valid_until > ?`
+		args = append(args, b.asOf, b.asOf)
+	}
+	if b.since != "" {
+		sql += ` AND v.valid_at >= ?`
+		args = append(args, b.since)
+	}
+	if b.until != "" {
+		// Undated chunks hold '', which sorts before every date
+		sql += ` AND v.valid_at <= ? AND v.valid_at != ''`
+		args = append(args, b.until)
+	}
+	return sql, args
 }
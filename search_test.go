@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -60,7 +63,7 @@ func insertChunk(t *testing.T, db *sql.DB, text, source, section, parent string,
 		t.Fatalf("last insert id: %v", err)
 	}
 
-	if _, err := db.Exec("INSERT INTO vec_chunks (chunk_id, embedding) VALUES (?, ?)", chunkID, serialized); err != nil {
+	if _, err := db.Exec("INSERT INTO vec_chunks (chunk_id, embedding, valid_at, valid_until) VALUES (?, ?, ?, ?)", chunkID, serialized, validAt, openValidUntil); err != nil {
 		t.Fatalf("insert vec chunk: %v", err)
 	}
 
@@ -113,7 +116,7 @@ func TestSearch(t *testing.T) {
 	defer server.Close()
 
 	client := NewOllamaClient(server.URL, "embed")
-	results, err := Search(db, client, "query", 3, "")
+	results, err := Search(context.Background(), db, client, "query", 3, "")
 	if err != nil {
 		t.Fatalf("search: %v", err)
 	}
@@ -143,7 +146,7 @@ func TestSearchAsOf(t *testing.T) {
 	defer server.Close()
 
 	client := NewOllamaClient(server.URL, "embed")
-	results, err := Search(db, client, "query", 5, "2024-06-01")
+	results, err := Search(context.Background(), db, client, "query", 5, "2024-06-01")
 	if err != nil {
 		t.Fatalf("search: %v", err)
 	}
@@ -157,6 +160,46 @@ func TestSearchAsOf(t *testing.T) {
 	}
 }
 
+func TestSearchAsOfInsideKNN(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	query := makeVec(map[int]float32{0: 1})
+	// Closer than the answer but all dated after the as-of day
+	for i := 0; i < 5; i++ {
+		insertChunk(t, db, "later", fmt.Sprintf("later-%d.md", i), "Later", "", 2, "2025-03-01", makeVec(map[int]float32{0: 1, 1: float32(i) * 0.01}))
+	}
+	answer := insertChunk(t, db, "earlier", "early.md", "Earlier", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1, 1: 1}))
+	ended := insertChunk(t, db, "ended", "ended.md", "Ended", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1, 1: 0.5}))
+	if _, err := db.Exec(`UPDATE chunks SET valid_until = '2024-03-01' WHERE id = ?`, ended); err != nil {
+		t.Fatalf("end validity: %v", err)
+	}
+
+	server := newOllamaServer(t, query)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	results, err := Search(context.Background(), db, client, "query", 1, "2024-06-01")
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != int(answer) {
+		t.Fatalf("expected the one chunk valid on the day despite nearer later ones, got %+v", results)
+	}
+
+	// The trigger carries validity changes into vec_chunks
+	if _, err := db.Exec(`UPDATE chunks SET valid_until = NULL WHERE id = ?`, ended); err != nil {
+		t.Fatalf("reopen validity: %v", err)
+	}
+	results, _ = Search(context.Background(), db, client, "query", 1, "2024-06-01")
+	if len(results) != 1 || results[0].ID != int(ended) {
+		t.Fatalf("expected the reopened chunk, got %+v", results)
+	}
+}
+
 func TestSearchChronologicalOrder(t *testing.T) {
 	db, err := InitDB(":memory:")
 	if err != nil {
@@ -174,7 +217,7 @@ func TestSearchChronologicalOrder(t *testing.T) {
 	defer server.Close()
 
 	client := NewOllamaClient(server.URL, "embed")
-	results, err := Search(db, client, "query", 5, "")
+	results, err := Search(context.Background(), db, client, "query", 5, "")
 	if err != nil {
 		t.Fatalf("search: %v", err)
 	}
@@ -187,3 +230,103 @@ func TestSearchChronologicalOrder(t *testing.T) {
 		t.Fatalf("unexpected chronological order: %q, %q", results[0].ValidAt, results[1].ValidAt)
 	}
 }
+
+func TestSearchSources(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	query := makeVec(map[int]float32{0: 1})
+	// The watched chunks are all nearer the query than any note
+	for i := 0; i < 5; i++ {
+		insertChunk(t, db, "watched", fmt.Sprintf("watch://s%d/batch-1", i), "Watched", "", 2, "", makeVec(map[int]float32{0: 1, 1: float32(i) * 0.01}))
+	}
+	note := insertChunk(t, db, "note", "notes/a.md", "Note", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1, 1: 1}))
+	nested := insertChunk(t, db, "nested", "notes/sub/b.md", "Nested", "", 2, "2025-01-01", makeVec(map[int]float32{1: 1}))
+
+	server := newOllamaServer(t, query)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+	search := func(opts SearchOptions) []SearchResult {
+		t.Helper()
+		results, err := SearchWithOptions(context.Background(), db, client, "query", opts)
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		return results
+	}
+
+	if results := search(SearchOptions{Limit: 2, Sources: []string{"notes/"}}); len(results) != 2 || results[0].ID != int(note) || results[1].ID != int(nested) {
+		t.Fatalf("expected both notes by prefix despite nearer watched chunks, got %+v", results)
+	}
+	if results := search(SearchOptions{Limit: 10, Sources: []string{"notes/*.md"}}); len(results) != 2 {
+		t.Fatalf("expected the glob to reach into sub-folders, got %+v", results)
+	}
+	results := search(SearchOptions{Limit: 10, Sources: []string{"watch://*"}})
+	if len(results) != 5 {
+		t.Fatalf("expected only the watched chunks, got %+v", results)
+	}
+	for _, r := range results {
+		if !strings.HasPrefix(r.SourceFile, "watch://") {
+			t.Fatalf("unexpected source %q", r.SourceFile)
+		}
+	}
+	if results := search(SearchOptions{Limit: 10, Sources: []string{"notes/", "watch://s0/"}}); len(results) != 3 {
+		t.Fatalf("expected either pattern to match, got %+v", results)
+	}
+	if results := search(SearchOptions{Limit: 10, AsOf: "2024-06-01", Sources: []string{"notes/"}}); len(results) != 1 || results[0].ID != int(note) {
+		t.Fatalf("expected the scope and as-of day combined, got %+v", results)
+	}
+	if scope, _ := sourceCondition(nil); scope != "" {
+		t.Fatalf("expected no condition without patterns, got %q", scope)
+	}
+}
+
+func TestSearchSinceUntil(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	query := makeVec(map[int]float32{0: 1})
+	// Nearer than anything from March, but undated or outside it
+	insertChunk(t, db, "timeless", "timeless.md", "Timeless", "", 2, "", query)
+	for i := 0; i < 3; i++ {
+		insertChunk(t, db, "april", fmt.Sprintf("april-%d.md", i), "April", "", 2, "2025-04-01", makeVec(map[int]float32{0: 1, 1: float32(i) * 0.01}))
+	}
+	early := insertChunk(t, db, "early march", "early.md", "Early", "", 2, "2025-03-01", makeVec(map[int]float32{0: 1, 1: 0.5}))
+	late := insertChunk(t, db, "late march", "late.md", "Late", "", 2, "2025-03-31", makeVec(map[int]float32{0: 1, 1: 1}))
+	insertChunk(t, db, "february", "february.md", "February", "", 2, "2025-02-28", query)
+
+	server := newOllamaServer(t, query)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+	search := func(opts SearchOptions) []SearchResult {
+		t.Helper()
+		results, err := SearchWithOptions(context.Background(), db, client, "query", opts)
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		return results
+	}
+
+	results := search(SearchOptions{Limit: 2, Since: "2025-03-01", Until: "2025-03-31"})
+	if len(results) != 2 || results[0].ID != int(early) || results[1].ID != int(late) {
+		t.Fatalf("expected both March chunks, both ends included, got %+v", results)
+	}
+	if results := search(SearchOptions{Limit: 10, Until: "2025-03-01"}); len(results) != 2 {
+		t.Fatalf("expected February and early March without the undated chunk, got %+v", results)
+	}
+	if results := search(SearchOptions{Limit: 10, Since: "2025-04-01"}); len(results) != 3 {
+		t.Fatalf("expected the April chunks, got %+v", results)
+	}
+	if results := search(SearchOptions{Limit: 10, Since: "2025-03-01", Until: "2025-03-31", Sources: []string{"late"}}); len(results) != 1 || results[0].ID != int(late) {
+		t.Fatalf("expected the range and scope combined, got %+v", results)
+	}
+	if _, err := SearchWithOptions(context.Background(), db, client, "query", SearchOptions{Limit: 10, Since: "2025-04-01", Until: "2025-03-01"}); err == nil {
+		t.Fatal("expected a range ending before it starts rejected")
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
+func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel, generateModel, rerankModel string) error {
+	defer closeStatements(db)
+
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "mneme",
 		Version: "1.0.0",
@@ -27,11 +29,27 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 			"properties": {
 				"query": {"type": "string", "description": "Search query"},
 				"as_of": {"type": "string", "description": "Optional ISO date filter"},
+				"since": {"type": "string", "description": "Only memories dated on or after this ISO date (use with until for 'what did I think about X in March 2025')"},
+				"until": {"type": "string", "description": "Only memories dated on or before this ISO date"},
+				"current": {"type": "boolean", "description": "Hide memories superseded by newer ones (use for 'what is the current state' questions)"},
+				"type": {"type": "string", "description": "Only chunks mentioning an entity of this type: person, project, place or tool"},
+				"tag": {"type": "string", "description": "Only chunks carrying this tag or topic"},
+				"source": {"type": "string", "description": "Only chunks from these sources: comma-separated globs such as watch://* or notes/*.md, or path prefixes such as notes/"},
+				"boost_important": {"type": "boolean", "description": "Favor memories scored as important (decisions, commitments) when relevance is close"},
+				"include_archived": {"type": "boolean", "description": "Also search memories archived for fading out of use"},
+				"include_pinned": {"type": "boolean", "description": "Always include pinned memories (core facts, standing preferences) ahead of the matches, whatever their similarity"},
+				"hybrid": {"type": "boolean", "description": "Also match the query's exact words (identifiers, error codes, rare names) and fuse that ranking with the semantic one"},
+				"scope": {"type": "string", "description": "What to search: chunks (default) for ingested memories, or all to also search raw conversation messages; results then come as hits with a type (chunk or message) and a score from 0 to 1, best first"},
+				"expand": {"type": "boolean", "description": "Add SectionText to each result split from a longer section: the whole section stitched from its sibling chunks, so a fragment can be read in context without opening the file"},
+				"rerank": {"type": "boolean", "description": "Have a local model read the best 30 matches against the query and keep the ones it judges most relevant; slower, but better when the top results are near misses"},
 			"limit": {"type": "integer", "description": "Maximum results (default 10)"}
 			},
 			"required": ["query"]
 		}`),
 	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+
 		args, err := argsOrEmpty(req)
 		if err != nil {
 			return nil, err
@@ -44,6 +62,14 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 		if err != nil {
 			return nil, err
 		}
+		since, err := optionalStringArg(args, "since")
+		if err != nil {
+			return nil, err
+		}
+		until, err := optionalStringArg(args, "until")
+		if err != nil {
+			return nil, err
+		}
 		limit, ok, err := optionalIntArg(args, "limit")
 		if err != nil {
 			return nil, err
@@ -51,22 +77,86 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 		if !ok || limit <= 0 {
 			limit = 10
 		}
+		current, _, err := optionalBoolArg(args, "current")
+		if err != nil {
+			return nil, err
+		}
+		entityType, err := optionalStringArg(args, "type")
+		if err != nil {
+			return nil, err
+		}
+		tag, err := optionalStringArg(args, "tag")
+		if err != nil {
+			return nil, err
+		}
+		source, err := optionalStringArg(args, "source")
+		if err != nil {
+			return nil, err
+		}
+		boostImportant, _, err := optionalBoolArg(args, "boost_important")
+		if err != nil {
+			return nil, err
+		}
+		includeArchived, _, err := optionalBoolArg(args, "include_archived")
+		if err != nil {
+			return nil, err
+		}
+		includePinned, _, err := optionalBoolArg(args, "include_pinned")
+		if err != nil {
+			return nil, err
+		}
+		hybrid, _, err := optionalBoolArg(args, "hybrid")
+		if err != nil {
+			return nil, err
+		}
+		rerankResults, _, err := optionalBoolArg(args, "rerank")
+		if err != nil {
+			return nil, err
+		}
+		expand, _, err := optionalBoolArg(args, "expand")
+		if err != nil {
+			return nil, err
+		}
+		scope, err := optionalStringArg(args, "scope")
+		if err != nil {
+			return nil, err
+		}
+		if scope != "" && scope != "chunks" && scope != "all" {
+			return nil, fmt.Errorf("scope must be chunks or all, got %q", scope)
+		}
+		opts := SearchOptions{Limit: limit, AsOf: asOf, Since: since, Until: until, Current: current, EntityType: entityType, Tag: tag, Sources: splitList(source), IncludeArchived: includeArchived, IncludePinned: includePinned, Hybrid: hybrid, Expand: expand, Reinforce: true}
+		if boostImportant {
+			opts.ImportanceBoost = defaultImportanceBoost
+		}
+		if rerankResults {
+			opts.RerankModel = rerankModel
+		}
 
-		results, err := Search(db, ollama, query, limit, asOf)
+		var found any
+		var degraded bool
+		if scope == "all" {
+			found, err = SearchChunksAndMessages(ctx, db, ollama, query, opts, 0)
+		} else {
+			found, degraded, err = SearchWithFallback(ctx, db, ollama, query, opts)
+		}
 		if err != nil {
 			return nil, err
 		}
 
-		payload, err := json.Marshal(results)
+		payload, err := json.Marshal(found)
 		if err != nil {
 			return nil, err
 		}
 
+		notice := ""
+		if degraded {
+			notice = "⚠ Degraded mode: the embedding server is unreachable, so these are keyword matches only and may miss related wording.\n\n"
+		}
 		whisper := "\n\n---\n⚡ Before responding: if any chunk above is relevant, READ the full section in its SourceFile (use Read tool with the file path). The chunk is a summary — the real context, nuance, and sub-sections live in the original file. Don't skim. Don't guess. Read it."
 
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: string(payload) + whisper},
+				&mcp.TextContent{Text: notice + string(payload) + whisper},
 			},
 		}, nil
 	})
@@ -78,11 +168,15 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 			"type": "object",
 			"properties": {
 				"file_path": {"type": "string", "description": "Path to markdown file"},
-				"valid_at": {"type": "string", "description": "Optional ISO date for valid_at"}
+				"valid_at": {"type": "string", "description": "Optional ISO date for valid_at"},
+				"extract_entities": {"type": "boolean", "description": "Run LLM entity extraction on the new chunks (slower)"}
 			},
 			"required": ["file_path"]
 		}`),
 	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := withTimeout(ctx, ingestTimeout)
+		defer cancel()
+
 		args, err := argsOrEmpty(req)
 		if err != nil {
 			return nil, err
@@ -99,10 +193,20 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 			return nil, err
 		}
 
-		result, err := IngestFile(db, ollama, filePath, validAt)
+		extract, _, err := optionalBoolArg(args, "extract_entities")
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := IngestFile(ctx, db, ollama, filePath, validAt, defaultChunking)
 		if err != nil {
 			return nil, err
 		}
+		if extract {
+			if _, err := ExtractEntities(ctx, db, ollama, generateModel, result.ChunkIDs, nil); err != nil {
+				return nil, err
+			}
+		}
 
 		payload, err := json.Marshal(result)
 		if err != nil {
@@ -118,12 +222,97 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 
 	server.AddTool(&mcp.Tool{
 		Name:        "mneme_history",
-		Description: "Fetch chronological history for an entity.",
+		Description: "Fetch chronological history for an entity, or for every entity of a type.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"entity": {"type": "string", "description": "Entity name (required unless type is given)"},
+				"type": {"type": "string", "description": "Instead of one entity, every entity of this type: person, project, place or tool"},
+			"limit": {"type": "integer", "description": "Maximum results (default 20)"},
+				"semantic": {"type": "boolean", "description": "Match by vector similarity to the entity name, catching paraphrased mentions"},
+				"intersect": {"type": "boolean", "description": "With semantic, keep only chunks that also mention the entity by name"},
+				"tag": {"type": "string", "description": "Only chunks carrying this tag"}
+			}
+		}`),
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+
+		args, err := argsOrEmpty(req)
+		if err != nil {
+			return nil, err
+		}
+		entityType, err := optionalStringArg(args, "type")
+		if err != nil {
+			return nil, err
+		}
+		entity, err := optionalStringArg(args, "entity")
+		if err != nil {
+			return nil, err
+		}
+		if entity == "" && entityType == "" {
+			return nil, fmt.Errorf("entity or type is required")
+		}
+		limit, ok, err := optionalIntArg(args, "limit")
+		if err != nil {
+			return nil, err
+		}
+		if !ok || limit <= 0 {
+			limit = 20
+		}
+		semantic, _, err := optionalBoolArg(args, "semantic")
+		if err != nil {
+			return nil, err
+		}
+		intersect, _, err := optionalBoolArg(args, "intersect")
+		if err != nil {
+			return nil, err
+		}
+		tag, err := optionalStringArg(args, "tag")
+		if err != nil {
+			return nil, err
+		}
+
+		fetchLimit := limit
+		if tag != "" {
+			fetchLimit = limit * 3
+		}
+		var results []HistoryResult
+		if entity == "" {
+			results, err = TypeHistory(db, entityType, fetchLimit)
+		} else if semantic {
+			results, err = SemanticHistory(ctx, db, ollama, entity, fetchLimit, intersect)
+		} else {
+			results, err = History(db, entity, fetchLimit)
+		}
+		if err == nil && tag != "" {
+			results, err = keepTagged(db, results, tag, limit)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := json.Marshal(results)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: string(payload)},
+			},
+		}, nil
+	})
+
+	server.AddTool(&mcp.Tool{
+		Name:        "mneme_graph",
+		Description: "Traverse the knowledge graph around an entity. Returns relations (subject, predicate, object) with the date and source chunk that stated them, nearest hops first.",
 		InputSchema: json.RawMessage(`{
 			"type": "object",
 			"properties": {
 				"entity": {"type": "string", "description": "Entity name"},
-			"limit": {"type": "integer", "description": "Maximum results (default 20)"}
+				"depth": {"type": "integer", "description": "Hops to traverse (default 1)"},
+				"limit": {"type": "integer", "description": "Maximum relations (default 50)"}
 			},
 			"required": ["entity"]
 		}`),
@@ -136,15 +325,75 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 		if err != nil {
 			return nil, err
 		}
+		depth, ok, err := optionalIntArg(args, "depth")
+		if err != nil {
+			return nil, err
+		}
+		if !ok || depth <= 0 {
+			depth = 1
+		}
 		limit, ok, err := optionalIntArg(args, "limit")
 		if err != nil {
 			return nil, err
 		}
 		if !ok || limit <= 0 {
-			limit = 20
+			limit = 50
+		}
+
+		edges, err := Graph(db, entity, depth, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := json.Marshal(edges)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: string(payload)},
+			},
+		}, nil
+	})
+
+	server.AddTool(&mcp.Tool{
+		Name:        "mneme_facts",
+		Description: "Search atomic facts distilled from memories (e.g. \"Project Y uses Postgres\"). Returns short facts with their date and source chunk — use when you need a crisp answer rather than full context.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "Search query"},
+				"as_of": {"type": "string", "description": "Optional ISO date filter"},
+				"limit": {"type": "integer", "description": "Maximum facts (default 10)"}
+			},
+			"required": ["query"]
+		}`),
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+
+		args, err := argsOrEmpty(req)
+		if err != nil {
+			return nil, err
+		}
+		query, err := requiredStringArg(args, "query")
+		if err != nil {
+			return nil, err
+		}
+		asOf, err := optionalStringArg(args, "as_of")
+		if err != nil {
+			return nil, err
+		}
+		limit, ok, err := optionalIntArg(args, "limit")
+		if err != nil {
+			return nil, err
+		}
+		if !ok || limit <= 0 {
+			limit = 10
 		}
 
-		results, err := History(db, entity, limit)
+		results, err := SearchFacts(ctx, db, ollama, query, limit, asOf)
 		if err != nil {
 			return nil, err
 		}
@@ -161,6 +410,90 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 		}, nil
 	})
 
+	server.AddTool(&mcp.Tool{
+		Name:        "mneme_conflicts",
+		Description: "List facts that contradict each other or where a newer fact supersedes an older one (e.g. \"lives in Paris\" then \"moved to Berlin\"). Check this before stating something about a person or project as current.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"entity": {"type": "string", "description": "Optional entity name to filter by"},
+				"limit": {"type": "integer", "description": "Maximum conflicts (default 20)"}
+			}
+		}`),
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args, err := argsOrEmpty(req)
+		if err != nil {
+			return nil, err
+		}
+		entity, err := optionalStringArg(args, "entity")
+		if err != nil {
+			return nil, err
+		}
+		limit, ok, err := optionalIntArg(args, "limit")
+		if err != nil {
+			return nil, err
+		}
+		if !ok || limit <= 0 {
+			limit = 20
+		}
+
+		conflicts, err := Conflicts(db, entity, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := json.Marshal(conflicts)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: string(payload)},
+			},
+		}, nil
+	})
+
+	server.AddTool(&mcp.Tool{
+		Name:        "mneme_profile",
+		Description: "Get a summary profile of a person, project, place or tool: key facts, recent events and open threads. Cached and refreshed with chunks added since the last call. Use before mneme_history when you need the gist, not the timeline.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"entity": {"type": "string", "description": "Entity name"}
+			},
+			"required": ["entity"]
+		}`),
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+
+		args, err := argsOrEmpty(req)
+		if err != nil {
+			return nil, err
+		}
+		entity, err := requiredStringArg(args, "entity")
+		if err != nil {
+			return nil, err
+		}
+
+		profile, _, err := RefreshProfile(ctx, db, ollama, generateModel, entity, false, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := json.Marshal(profile)
+		if err != nil {
+			return nil, err
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: string(payload)},
+			},
+		}, nil
+	})
+
 	server.AddTool(&mcp.Tool{
 		Name:        "mneme_search_msg",
 		Description: "Search messages directly with context window. Returns conversation snippets around matching messages. Use for finding specific discussions or phrases.",
@@ -170,11 +503,15 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 				"query": {"type": "string", "description": "Search query"},
 				"fts": {"type": "boolean", "description": "Use exact phrase matching (FTS5/LIKE) instead of semantic search"},
 				"context": {"type": "integer", "description": "Context window in minutes (default 3)"},
-				"limit": {"type": "integer", "description": "Maximum results (default 5)"}
+				"limit": {"type": "integer", "description": "Maximum results (default 5)"},
+				"include_chunks": {"type": "boolean", "description": "Also search ingested memories, searching both at once; results then come as hits with a type (chunk or message) and a score from 0 to 1, best first, without context windows"}
 			},
 			"required": ["query"]
 		}`),
 	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+
 		args, err := argsOrEmpty(req)
 		if err != nil {
 			return nil, err
@@ -192,6 +529,26 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 		if !ok || limit <= 0 {
 			limit = 5
 		}
+		includeChunks, _, err := optionalBoolArg(args, "include_chunks")
+		if err != nil {
+			return nil, err
+		}
+
+		if includeChunks && !useFTS {
+			hits, err := SearchChunksAndMessages(ctx, db, ollama, query, SearchOptions{Limit: limit, Reinforce: true}, limit)
+			if err != nil {
+				return nil, err
+			}
+			payload, err := json.Marshal(hits)
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: string(payload)},
+				},
+			}, nil
+		}
 
 		if useFTS {
 			results, err := searchMessagesFTS(db, query, limit)
@@ -210,7 +567,7 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 		}
 
 		// Semantic search with context
-		contexts, err := searchMessagesWithContext(db, ollama, query, limit, contextMins)
+		contexts, err := searchMessagesWithContext(ctx, db, ollama, query, limit, contextMins)
 		if err != nil {
 			return nil, err
 		}
@@ -225,6 +582,105 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 		}, nil
 	})
 
+	server.AddTool(&mcp.Tool{
+		Name:        "mneme_threads",
+		Description: "Find whole discussions: returns the topical threads (grouped across sessions) containing the messages closest to the query, each with every message in order. Use when you need the full back-and-forth about something rather than isolated snippets. Pass thread_id to fetch one thread.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "What the discussion was about"},
+				"thread_id": {"type": "integer", "description": "Fetch this thread instead of searching"},
+				"limit": {"type": "integer", "description": "Maximum threads (default 3)"}
+			}
+		}`),
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+
+		args, err := argsOrEmpty(req)
+		if err != nil {
+			return nil, err
+		}
+		var result any
+		if threadID, ok, err := optionalIntArg(args, "thread_id"); err != nil {
+			return nil, err
+		} else if ok {
+			thread, err := GetThread(db, int64(threadID))
+			if err != nil {
+				return nil, err
+			}
+			result = thread
+		} else {
+			query, err := requiredStringArg(args, "query")
+			if err != nil {
+				return nil, err
+			}
+			limit, _, err := optionalIntArg(args, "limit")
+			if err != nil {
+				return nil, err
+			}
+			matches, err := SearchThreads(ctx, db, ollama, query, limit)
+			if err != nil {
+				return nil, err
+			}
+			result = matches
+		}
+
+		payload, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: string(payload)},
+			},
+		}, nil
+	})
+
+	server.AddTool(&mcp.Tool{
+		Name:        "mneme_pack",
+		Description: "Get a ready-to-use context bundle for a task within a token budget: pinned memories, the most relevant non-repetitive chunks, and profiles of the people and projects they mention, as markdown. Use at the start of a task instead of several searches.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "The task or question the context is for"},
+				"budget": {"type": "integer", "description": "Token budget (default 4000)"},
+				"current": {"type": "boolean", "description": "Leave out memories superseded by newer ones"}
+			},
+			"required": ["query"]
+		}`),
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+
+		args, err := argsOrEmpty(req)
+		if err != nil {
+			return nil, err
+		}
+		query, err := requiredStringArg(args, "query")
+		if err != nil {
+			return nil, err
+		}
+		budget, _, err := optionalIntArg(args, "budget")
+		if err != nil {
+			return nil, err
+		}
+		current, _, err := optionalBoolArg(args, "current")
+		if err != nil {
+			return nil, err
+		}
+
+		pack, err := BuildContextPack(ctx, db, ollama, query, PackOptions{Budget: budget, Current: current})
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: RenderPackMarkdown(pack)},
+			},
+		}, nil
+	})
+
 	server.AddTool(&mcp.Tool{
 		Name:        "mneme_status",
 		Description: "Get system status and health details.",
@@ -233,7 +689,10 @@ func RunMCPServer(db *sql.DB, ollama *OllamaClient, embedModel string) error {
 			"properties": {}
 		}`),
 	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		status := Status(db, ollama, embedModel)
+		ctx, cancel := withTimeout(ctx, searchTimeout)
+		defer cancel()
+
+		status := Status(ctx, db, ollama, embedModel)
 
 		payload, err := json.Marshal(status)
 		if err != nil {
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const sessionSummaryPrompt = `You summarize a conversation transcript for someone's long-term memory.
+Return JSON only, in exactly this shape:
+{"decisions": ["..."], "open_questions": ["..."], "facts": ["..."]}
+Rules:
+- decisions: what was decided, chosen or committed to, one short sentence each.
+- open_questions: questions, problems or follow-ups left unresolved at the end.
+- facts: durable facts learned about the people, projects and tools involved.
+- At most 10 entries per list. Use empty lists rather than guessing.
+- Only use what the transcript states.`
+
+// SessionSummary is the structured digest a watcher writes when a session goes quiet.
+type SessionSummary struct {
+	Decisions     []string `json:"decisions"`
+	OpenQuestions []string `json:"open_questions"`
+	Facts         []string `json:"facts"`
+}
+
+func (s *SessionSummary) empty() bool {
+	return len(s.Decisions) == 0 && len(s.OpenQuestions) == 0 && len(s.Facts) == 0
+}
+
+func parseSessionSummary(raw string) (*SessionSummary, error) {
+	var resp SessionSummary
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+	return &SessionSummary{
+		Decisions:     cleanProfileLines(resp.Decisions, 10),
+		OpenQuestions: cleanProfileLines(resp.OpenQuestions, 10),
+		Facts:         cleanProfileLines(resp.Facts, 10),
+	}, nil
+}
+
+// SummarizeSession asks the generate model for the decisions, open questions and
+// facts in a run of watched messages.
+func SummarizeSession(ctx context.Context, ollama *OllamaClient, model string, messages []textMessage, sessionTitle string) (*SessionSummary, error) {
+	raw, err := ollama.GenerateJSON(ctx, model, sessionSummaryPrompt, buildWatchMarkdown(messages, sessionTitle))
+	if err != nil {
+		return nil, err
+	}
+	return parseSessionSummary(raw)
+}
+
+// buildSummaryMarkdown renders a summary as a single section whose header carries the
+// session title and date, so it is stored as one chunk dated like the raw batches.
+func buildSummaryMarkdown(summary *SessionSummary, sessionTitle string, date time.Time) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("## %s: session summary, %s\n\n", sessionTitle, date.Format("January 2, 2006")))
+	for _, part := range []struct {
+		label string
+		lines []string
+	}{
+		{"Decisions", summary.Decisions},
+		{"Open questions", summary.OpenQuestions},
+		{"Facts learned", summary.Facts},
+	} {
+		if len(part.lines) == 0 {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("**%s**\n", part.label))
+		for _, line := range part.lines {
+			b.WriteString("- " + line + "\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// nextWatchSeq returns the number after the highest "<prefix>N" source file, so a
+// restarted watcher keeps numbering where the last run stopped.
+func nextWatchSeq(db *sql.DB, prefix string) int {
+	var maxSeq sql.NullInt64
+	_ = db.QueryRow(
+		`SELECT MAX(CAST(REPLACE(source_file, ?, '') AS INTEGER)) FROM chunks WHERE source_file LIKE ?`,
+		prefix, prefix+"%",
+	).Scan(&maxSeq)
+	if maxSeq.Valid {
+		return int(maxSeq.Int64) + 1
+	}
+	return 0
+}
+
+// removeOrphanVectors deletes vec_chunks rows whose chunk is gone, as a watcher starts.
+// A failure only leaves them to the next start, so it is logged rather than fatal.
+func removeOrphanVectors(db *sql.DB) {
+	err := retryBusy("remove orphaned vectors", func() error {
+		_, err := db.Exec(`DELETE FROM vec_chunks WHERE chunk_id NOT IN (SELECT id FROM chunks)`)
+		return err
+	})
+	if err != nil {
+		log.Printf("Warning: remove orphaned vectors: %v", err)
+	}
+}
+
+// sessionSummarizer collects the messages a watcher has seen since its last summary
+// and writes a summary once the session has been quiet for idle.
+type sessionSummarizer struct {
+	db           *sql.DB
+	ollama       *OllamaClient
+	model        string
+	prefix       string
+	title        string
+	idle         time.Duration
+	seq          int
+	messages     []textMessage
+	lastActivity time.Time
+}
+
+// newSessionSummarizer returns nil when idle is zero, which turns summaries off.
+func newSessionSummarizer(db *sql.DB, ollama *OllamaClient, model, prefix, title string, idle time.Duration) *sessionSummarizer {
+	if idle <= 0 {
+		return nil
+	}
+	return &sessionSummarizer{
+		db:     db,
+		ollama: ollama,
+		model:  model,
+		prefix: prefix,
+		title:  title,
+		idle:   idle,
+		seq:    nextWatchSeq(db, prefix),
+	}
+}
+
+func (s *sessionSummarizer) add(m textMessage, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.messages = append(s.messages, m)
+	s.lastActivity = now
+}
+
+// due reports whether there are unsummarized messages and the session has been idle.
+func (s *sessionSummarizer) due(now time.Time) bool {
+	return s != nil && len(s.messages) > 0 && now.Sub(s.lastActivity) >= s.idle
+}
+
+// summarize writes and ingests a summary of the collected messages. It returns the
+// source file it stored the summary under, or "" when there was nothing to store.
+// After a failed model call the messages are kept and retried after another idle period.
+func (s *sessionSummarizer) summarize(ctx context.Context, now time.Time) (string, error) {
+	if s == nil || len(s.messages) == 0 {
+		return "", nil
+	}
+	summary, err := SummarizeSession(ctx, s.ollama, s.model, s.messages, s.title)
+	if err != nil {
+		s.lastActivity = now
+		return "", fmt.Errorf("summarize: %w", err)
+	}
+	date := s.messages[len(s.messages)-1].Timestamp
+	s.messages = nil
+	if summary.empty() {
+		return "", nil
+	}
+
+	sourceFile := fmt.Sprintf("%s%d", s.prefix, s.seq)
+	if _, err := ingestMarkdownSource(ctx, s.db, s.ollama, sourceFile, buildSummaryMarkdown(summary, s.title, date)); err != nil {
+		return "", fmt.Errorf("ingest summary: %w", err)
+	}
+	s.seq++
+	notify(eventSummaryCreated, fmt.Sprintf("Summarized %s: %d decisions, %d open questions, %d facts",
+		s.title, len(summary.Decisions), len(summary.OpenQuestions), len(summary.Facts)), map[string]any{
+		"source_file": sourceFile,
+		"session":     s.title,
+		"summary":     summary,
+	})
+	return sourceFile, nil
+}
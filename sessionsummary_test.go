@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSessionSummary(t *testing.T) {
+	raw := "```json\n{\"decisions\": [\"Use  Postgres\", \"\"], \"open_questions\": [\"Who owns backups?\"]}\n```"
+	summary, err := parseSessionSummary(raw)
+	if err != nil {
+		t.Fatalf("parseSessionSummary: %v", err)
+	}
+	if len(summary.Decisions) != 1 || summary.Decisions[0] != "Use Postgres" {
+		t.Fatalf("unexpected decisions: %q", summary.Decisions)
+	}
+	if len(summary.OpenQuestions) != 1 || len(summary.Facts) != 0 || summary.empty() {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	md := buildSummaryMarkdown(summary, "Auth work", time.Date(2025, time.March, 4, 10, 0, 0, 0, time.UTC))
+	if !strings.HasPrefix(md, "## Auth work: session summary, March 4, 2025\n") || !strings.Contains(md, "**Decisions**\n- Use Postgres") || strings.Contains(md, "Facts learned") {
+		t.Fatalf("unexpected markdown:\n%s", md)
+	}
+}
+
+func TestSessionSummarizer(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			calls++
+			var req generateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			if !strings.Contains(req.Prompt, "Postgres") {
+				t.Errorf("expected the transcript in the prompt, got %q", req.Prompt)
+			}
+			answer := `{"decisions": ["Use Postgres for auth"], "open_questions": ["Who owns backups?"], "facts": []}`
+			if calls == 1 {
+				answer = "not json"
+			}
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		case "/api/embed":
+			vec := make([]float64, EmbedDimension)
+			vec[0] = 1
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{vec}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	insertChunk(t, db, "Old summary", "watch://s1/summary-3", "S", "", 2, "", makeVec(map[int]float32{0: 1}))
+
+	client := NewOllamaClient(server.URL, "embed")
+	if s := newSessionSummarizer(db, client, "gen", "watch://s1/summary-", "Auth", 0); s != nil {
+		t.Fatal("expected idle 0 to disable summaries")
+	}
+	s := newSessionSummarizer(db, client, "gen", "watch://s1/summary-", "Auth", 10*time.Minute)
+	if s.seq != 4 {
+		t.Fatalf("expected numbering to continue at 4, got %d", s.seq)
+	}
+
+	start := time.Date(2025, time.March, 4, 10, 0, 0, 0, time.UTC)
+	s.add(textMessage{Role: "User", Text: "Let's use Postgres for auth.", Timestamp: start}, start)
+	s.add(textMessage{Role: "Assistant", Text: "Agreed.", Timestamp: start.Add(time.Minute)}, start.Add(time.Minute))
+	if s.due(start.Add(5 * time.Minute)) {
+		t.Fatal("expected no summary before the idle period")
+	}
+	if !s.due(start.Add(11 * time.Minute)) {
+		t.Fatal("expected a summary after the idle period")
+	}
+
+	// A bad model answer keeps the messages and waits another idle period
+	if _, err := s.summarize(context.Background(), start.Add(11*time.Minute)); err == nil {
+		t.Fatal("expected an error for a bad model response")
+	}
+	if len(s.messages) != 2 || s.due(start.Add(15*time.Minute)) {
+		t.Fatalf("expected messages kept and the retry deferred, got %d messages", len(s.messages))
+	}
+
+	sourceFile, err := s.summarize(context.Background(), start.Add(22*time.Minute))
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	if sourceFile != "watch://s1/summary-4" || len(s.messages) != 0 || s.due(start.Add(time.Hour)) {
+		t.Fatalf("unexpected state after summary: %q, %d messages", sourceFile, len(s.messages))
+	}
+
+	var text, validAt string
+	if err := db.QueryRow(`SELECT text, valid_at FROM chunks WHERE source_file = ?`, sourceFile).Scan(&text, &validAt); err != nil {
+		t.Fatalf("read summary chunk: %v", err)
+	}
+	if !strings.Contains(text, "Use Postgres for auth") || !strings.Contains(text, "Who owns backups?") {
+		t.Fatalf("unexpected summary chunk: %q", text)
+	}
+	if validAt != "2025-03-04" {
+		t.Fatalf("expected summary dated 2025-03-04, got %q", validAt)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// sourceSummaryPrefix marks summary chunks written by SummarizeSource; the rest of the
+// source_file names the summarized source.
+const sourceSummaryPrefix = "summary://"
+
+// sourceSummaryImportance is stored on summary chunks so importance-boosted searches
+// reach the summary before the detailed chunks it points to.
+const sourceSummaryImportance = 1.0
+
+const sourceSummaryPrompt = `You summarize a long document from someone's notes so it can be found and skimmed quickly.
+You are given the summary so far (possibly empty, under "So far") and the next sections of the document, in order.
+Return the updated summary as JSON only, in exactly this shape:
+{"summary": "...", "highlights": ["..."], "decisions": ["..."], "open_questions": ["..."]}
+Rules:
+- summary: three to five sentences on what the document covers.
+- highlights: at most 8 key points, facts or conclusions.
+- decisions: at most 8 things decided or committed to.
+- open_questions: at most 8 unresolved questions or follow-ups.
+- Only use what the summary and document state.`
+
+// SourceSummary is the condensed summary of one source file.
+type SourceSummary struct {
+	Source        string   `json:"source"`
+	SourceFile    string   `json:"source_file"`
+	Chunks        int      `json:"chunks"`
+	Sections      []string `json:"sections"`
+	Summary       string   `json:"summary"`
+	Highlights    []string `json:"highlights"`
+	Decisions     []string `json:"decisions"`
+	OpenQuestions []string `json:"open_questions"`
+}
+
+// summarizedSource returns the source a summary chunk stands for, or "" for any other chunk.
+func summarizedSource(sourceFile string) string {
+	if !strings.HasPrefix(sourceFile, sourceSummaryPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(sourceFile, sourceSummaryPrefix)
+}
+
+// RenderSourceSummaryMarkdown formats a summary as one section that ends by listing the
+// source's sections, so a search hitting the summary shows where the details live.
+func RenderSourceSummaryMarkdown(s *SourceSummary) string {
+	md := renderSummaryMarkdown("Summary of "+s.Source, digestBody{s.Summary, s.Highlights, s.Decisions, s.OpenQuestions})
+	if len(s.Sections) == 0 {
+		return md
+	}
+	var b strings.Builder
+	b.WriteString(md)
+	fmt.Fprintf(&b, "**Sections in %s**\n", s.Source)
+	for _, section := range s.Sections {
+		b.WriteString("- " + section + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// SummarizeSource condenses every chunk of source into one summary, folding the chunks
+// in batches so long files fit the model, and stores it as summary://<source> with
+// full importance. An earlier summary of the source is replaced.
+func SummarizeSource(ctx context.Context, db *sql.DB, ollama *OllamaClient, model, source string, progress ProgressFunc) (*SourceSummary, error) {
+	if summarizedSource(source) != "" {
+		return nil, fmt.Errorf("%s is already a summary", source)
+	}
+	rows, err := db.Query(
+		`SELECT section_title, parent_title, text FROM chunks WHERE source_file = ?
+		 ORDER BY section_sequence ASC, chunk_sequence ASC`,
+		source,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var items []digestItem
+	seen := make(map[string]bool)
+	summary := &SourceSummary{Source: source, SourceFile: sourceSummaryPrefix + source, Sections: []string{}}
+	for rows.Next() {
+		var title, text string
+		var parent sql.NullString
+		if err := rows.Scan(&title, &parent, &text); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		label := title
+		if parent.String != "" {
+			label = parent.String + " › " + title
+		}
+		items = append(items, digestItem{label: label, text: text})
+		if title != "Preamble" && !seen[label] {
+			seen[label] = true
+			summary.Sections = append(summary.Sections, label)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no chunks stored for %s", source)
+	}
+	summary.Chunks = len(items)
+
+	body, err := foldSummary(ctx, ollama, model, sourceSummaryPrompt, "Document: "+source, items, progress)
+	if err != nil {
+		return nil, fmt.Errorf("summarize %s: %w", source, err)
+	}
+	summary.Summary = body.Summary
+	summary.Highlights = body.Highlights
+	summary.Decisions = body.Decisions
+	summary.OpenQuestions = body.OpenQuestions
+
+	ids, err := ingestMarkdownSource(ctx, db, ollama, summary.SourceFile, RenderSourceSummaryMarkdown(summary))
+	if err != nil {
+		return nil, fmt.Errorf("store %s: %w", summary.SourceFile, err)
+	}
+	err = withWriteTx(db, "set summary importance", func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec(`UPDATE chunks SET importance = ? WHERE id = ?`, sourceSummaryImportance, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("set summary importance: %w", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeSource(t *testing.T) {
+	answer := `{"summary": "Plans for the  auth rewrite.", "highlights": ["Tokens move to Postgres"], "decisions": ["Drop Redis"], "open_questions": ["Token TTL?"]}`
+	server := newBatchTitleServer(t, &answer)
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	for i, section := range []struct{ title, parent, text string }{
+		{"Preamble", "", "# Project"},
+		{"Storage", "Project", "Tokens move to Postgres."},
+		{"Storage", "Project", "Redis goes away."},
+		{"Open items", "Project", "What TTL do tokens get?"},
+	} {
+		id := insertChunk(t, db, section.text, "notes/project.md", section.title, section.parent, 2, "", vec)
+		db.Exec(`UPDATE chunks SET section_sequence = ?, chunk_sequence = ? WHERE id = ?`, i+10, i+10, id)
+	}
+	insertChunk(t, db, "Elsewhere.", "notes/other.md", "Other", "", 2, "", vec)
+
+	client := NewOllamaClient(server.URL, "embed")
+	summary, err := SummarizeSource(context.Background(), db, client, "gen", "notes/project.md", nil)
+	if err != nil {
+		t.Fatalf("SummarizeSource: %v", err)
+	}
+	if summary.Chunks != 4 || summary.Summary != "Plans for the auth rewrite." || len(summary.Decisions) != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if strings.Join(summary.Sections, "|") != "Project › Storage|Project › Open items" {
+		t.Fatalf("unexpected sections: %v", summary.Sections)
+	}
+
+	var text string
+	var importance float64
+	if err := db.QueryRow(`SELECT text, importance FROM chunks WHERE source_file = 'summary://notes/project.md'`).Scan(&text, &importance); err != nil {
+		t.Fatalf("read summary chunk: %v", err)
+	}
+	if importance != sourceSummaryImportance || !strings.Contains(text, "- Drop Redis") || !strings.Contains(text, "- Project › Open items") {
+		t.Fatalf("unexpected stored summary (importance %v):\n%s", importance, text)
+	}
+	if summarizedSource("summary://notes/project.md") != "notes/project.md" || summarizedSource("notes/project.md") != "" {
+		t.Fatal("summarizedSource should only resolve summary chunks")
+	}
+
+	// Summarizing again replaces the earlier summary
+	if _, err := SummarizeSource(context.Background(), db, client, "gen", "notes/project.md", nil); err != nil {
+		t.Fatalf("SummarizeSource again: %v", err)
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE source_file = 'summary://notes/project.md'`).Scan(&count)
+	if count != 1 {
+		t.Fatalf("expected one summary chunk, got %d", count)
+	}
+
+	if _, err := SummarizeSource(context.Background(), db, client, "gen", "notes/missing.md", nil); err == nil {
+		t.Fatal("expected an error for a source with no chunks")
+	}
+	if _, err := SummarizeSource(context.Background(), db, client, "gen", "summary://notes/project.md", nil); err == nil {
+		t.Fatal("expected an error when summarizing a summary")
+	}
+}
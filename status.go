@@ -12,18 +12,18 @@ type StatusInfo struct {
 	TotalChunks      int
 	EarliestValidAt  string
 	LatestValidAt    string
+	StoredEmbedding  EmbeddingMeta // what the stored embeddings were made with
 }
 
 // Status gathers system status information.
 // It never returns an error — it returns whatever it can gather.
 // embedModel is passed separately since OllamaClient fields are unexported.
-func Status(db *sql.DB, ollama *OllamaClient, embedModel string) StatusInfo {
+func Status(ctx context.Context, db *sql.DB, ollama *OllamaClient, embedModel string) StatusInfo {
 	info := StatusInfo{
 		EmbedModel: embedModel,
 	}
 
 	// Check Ollama health
-	ctx := context.Background()
 	info.OllamaHealthy = ollama.IsHealthy(ctx)
 
 	// Get sqlite-vec version
@@ -33,6 +33,10 @@ func Status(db *sql.DB, ollama *OllamaClient, embedModel string) StatusInfo {
 		info.SqliteVecVersion = vecVersion
 	}
 
+	if meta, err := readEmbeddingMeta(db); err == nil {
+		info.StoredEmbedding = meta
+	}
+
 	// Count total chunks
 	var totalChunks int
 	err = db.QueryRow("SELECT COUNT(*) FROM chunks").Scan(&totalChunks)
@@ -56,3 +60,10 @@ func Status(db *sql.DB, ollama *OllamaClient, embedModel string) StatusInfo {
 
 	return info
 }
+
+// EmbeddingMismatch reports whether the stored embeddings were made with another model or
+// dimension than the configured ones, which `mneme reembed` fixes.
+func (s StatusInfo) EmbeddingMismatch() bool {
+	stored := s.StoredEmbedding
+	return stored.Model != "" && (stored.Model != s.EmbedModel || stored.Dimension != EmbedDimension)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -56,7 +57,7 @@ func TestStatus(t *testing.T) {
 	}
 
 	// Call Status
-	status := Status(db, ollama, "embed-model")
+	status := Status(context.Background(), db, ollama, "embed-model")
 
 	// Verify all fields are populated
 	if !status.OllamaHealthy {
@@ -102,7 +103,7 @@ func TestStatusEmptyDB(t *testing.T) {
 	defer db.Close()
 
 	// Call Status on empty database
-	status := Status(db, ollama, "embed-model")
+	status := Status(context.Background(), db, ollama, "embed-model")
 
 	// Verify it handles empty database gracefully
 	if status.OllamaHealthy {
@@ -129,3 +130,20 @@ func TestStatusEmptyDB(t *testing.T) {
 		t.Errorf("Expected LatestValidAt='' for empty DB, got %q", status.LatestValidAt)
 	}
 }
+
+func TestStatusEmbeddingMismatch(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	defer db.Close()
+	ollama := NewOllamaClient("http://127.0.0.1:1", EmbedModel)
+
+	status := Status(context.Background(), db, ollama, EmbedModel)
+	if status.StoredEmbedding.Model != EmbedModel || status.StoredEmbedding.Dimension != EmbedDimension || status.EmbeddingMismatch() {
+		t.Fatalf("expected the configured model recorded, got %+v", status.StoredEmbedding)
+	}
+	if status = Status(context.Background(), db, ollama, "other-embed"); !status.EmbeddingMismatch() {
+		t.Fatal("expected a mismatch with another configured model")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// statementCaches holds each database's prepared statements, keyed by *sql.DB, for the
+// queries a watcher polls or the MCP server answers every few seconds. Preparing them
+// once saves SQLite compiling the same SQL on every call.
+var statementCaches sync.Map
+
+type statementCache struct {
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// cachedStmt returns query prepared on db, preparing it on first use. database/sql
+// prepares it again on each new connection, and SQLite recompiles it after a schema
+// change, so the statement stays usable for as long as db is open.
+func cachedStmt(db *sql.DB, query string) (*sql.Stmt, error) {
+	value, _ := statementCaches.LoadOrStore(db, &statementCache{stmts: make(map[string]*sql.Stmt)})
+	cache := value.(*statementCache)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if stmt, ok := cache.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	cache.stmts[query] = stmt
+	return stmt, nil
+}
+
+// closeStatements closes the statements cached for db; call it before closing db.
+func closeStatements(db *sql.DB) {
+	value, ok := statementCaches.LoadAndDelete(db)
+	if !ok {
+		return
+	}
+	cache := value.(*statementCache)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for _, stmt := range cache.stmts {
+		stmt.Close()
+	}
+}
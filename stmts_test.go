@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCachedStmt(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "mneme.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	defer closeStatements(db)
+
+	const query = `SELECT COUNT(*) FROM chunks WHERE source_file = ?`
+	first, err := cachedStmt(db, query)
+	if err != nil {
+		t.Fatalf("cachedStmt: %v", err)
+	}
+	insertChunk(t, db, "postgres it is", "a.md", "Decision", "", 2, "2024-01-01", makeVec(map[int]float32{0: 1}))
+	second, err := cachedStmt(db, query)
+	if err != nil || second != first {
+		t.Fatalf("expected the statement reused, got %p and %p, %v", first, second, err)
+	}
+	var n int
+	if err := second.QueryRow("a.md").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected the new chunk counted, got %d, %v", n, err)
+	}
+
+	// A schema change is picked up rather than breaking the cached statement
+	if _, err := db.Exec(`ALTER TABLE chunks ADD COLUMN scratch TEXT`); err != nil {
+		t.Fatalf("alter: %v", err)
+	}
+	if err := second.QueryRow("a.md").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected the statement usable after a schema change, got %d, %v", n, err)
+	}
+
+	closeStatements(db)
+	if third, err := cachedStmt(db, query); err != nil || third == first {
+		t.Fatalf("expected a fresh statement after closeStatements, got %v", err)
+	}
+}
+
+func TestChunkIndexes(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "mneme.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	for query, index := range map[string]string{
+		`SELECT id FROM chunks WHERE source_file = 'a.md'`:     "idx_chunks_source_file",
+		`SELECT id FROM chunks WHERE valid_at >= '2024-01-01'`: "idx_chunks_valid_at",
+	} {
+		rows, err := db.Query(`EXPLAIN QUERY PLAN ` + query)
+		if err != nil {
+			t.Fatalf("explain: %v", err)
+		}
+		var plan []string
+		for rows.Next() {
+			var id, parent, unused int
+			var detail string
+			if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+				t.Fatalf("scan plan: %v", err)
+			}
+			plan = append(plan, detail)
+		}
+		rows.Close()
+		if !strings.Contains(strings.Join(plan, "\n"), index) {
+			t.Fatalf("expected %q to use %s, got %q", query, index, plan)
+		}
+	}
+}
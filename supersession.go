@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// extractionKindSupersession marks chunks already checked against older memories.
+const extractionKindSupersession = "supersession"
+
+// supersessionCandidates is how many nearest chunks each new chunk is compared with.
+const supersessionCandidates = 5
+
+// supersessionMaxDistance keeps topic-only candidates (no shared entity) to close neighbours.
+const supersessionMaxDistance = 0.25
+
+const supersessionCheckPrompt = `You compare two memories from someone's notes, written at different times.
+Return JSON only, in exactly this shape:
+{"supersedes": false, "reason": "..."}
+Set "supersedes" to true only when the newer memory clearly updates or replaces what the older
+one says (a decision was reversed, a plan changed, a status moved on), so that the older one
+is no longer the current state. Memories that merely add detail or discuss something else do not supersede.
+Keep the reason to one short sentence.`
+
+type supersessionCheckResponse struct {
+	Supersedes bool   `json:"supersedes"`
+	Reason     string `json:"reason"`
+}
+
+type SupersessionResult struct {
+	ChunksChecked int
+	Comparisons   int
+	Superseded    int
+}
+
+type supersessionCandidate struct {
+	id      int64
+	text    string
+	validAt string
+}
+
+// DetectSupersessions compares each chunk with its nearest older chunks about the same
+// entity or topic and, where the generate model judges that the newer one replaces the
+// older, links them with SupersedeChunk.
+func DetectSupersessions(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, chunkIDs []int64, progress ProgressFunc) (SupersessionResult, error) {
+	var result SupersessionResult
+
+	for i, chunkID := range chunkIDs {
+		var text, title string
+		var validAt sql.NullString
+		err := db.QueryRow(`SELECT text, section_title, valid_at FROM chunks WHERE id = ?`, chunkID).Scan(&text, &title, &validAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("read chunk %d: %w", chunkID, err)
+		}
+		if progress != nil {
+			progress(i, len(chunkIDs), title)
+		}
+		result.ChunksChecked++
+
+		// Only dated chunks can be "later" than something else
+		var candidates []supersessionCandidate
+		if validAt.Valid && validAt.String != "" {
+			candidates, err = olderNeighbors(db, chunkID, validAt.String)
+			if err != nil {
+				return result, err
+			}
+		}
+
+		for _, older := range candidates {
+			prompt := fmt.Sprintf("Older (%s):\n%s\n\nNewer (%s):\n%s", older.validAt, older.text, validAt.String, text)
+			raw, err := ollama.GenerateJSON(ctx, model, supersessionCheckPrompt, prompt)
+			if err != nil {
+				return result, fmt.Errorf("compare chunks %d/%d: %w", older.id, chunkID, err)
+			}
+			result.Comparisons++
+
+			var resp supersessionCheckResponse
+			if err := decodeModelJSON(raw, &resp); err != nil {
+				if errors.Is(err, errBadModelResponse) {
+					log.Printf("supersession: skipping chunks %d/%d: %v", older.id, chunkID, err)
+					continue
+				}
+				return result, err
+			}
+			if !resp.Supersedes {
+				continue
+			}
+			log.Printf("supersession: chunk %d replaces %d: %s", chunkID, older.id, resp.Reason)
+			if err := SupersedeChunk(db, older.id, chunkID); err != nil {
+				return result, fmt.Errorf("supersede chunk %d: %w", older.id, err)
+			}
+			result.Superseded++
+		}
+
+		err = withWriteTx(db, "detect supersession", func(tx *sql.Tx) error {
+			if err := markExtracted(tx, chunkID, extractionKindSupersession); err != nil {
+				return fmt.Errorf("mark checked: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if progress != nil && len(chunkIDs) > 0 {
+		progress(len(chunkIDs), len(chunkIDs), "")
+	}
+
+	return result, nil
+}
+
+// olderNeighbors returns the chunks nearest to chunkID that are dated before validAt,
+// not yet superseded, and either share an entity with it or sit very close in embedding space.
+func olderNeighbors(db *sql.DB, chunkID int64, validAt string) ([]supersessionCandidate, error) {
+	var embedding []byte
+	err := db.QueryRow(`SELECT embedding FROM vec_chunks WHERE chunk_id = ?`, chunkID).Scan(&embedding)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load chunk embedding: %w", err)
+	}
+
+	rows, err := db.Query(
+		`SELECT c.id, c.text, c.valid_at, v.distance,
+		   EXISTS (SELECT 1 FROM chunk_entities a JOIN chunk_entities b ON a.entity_id = b.entity_id
+		           WHERE a.chunk_id = c.id AND b.chunk_id = ?)
+		 FROM vec_chunks v
+		 JOIN chunks c ON c.id = v.chunk_id
+		 WHERE v.embedding MATCH ? AND v.k = ?
+		 ORDER BY v.distance`,
+		chunkID, embedding, supersessionCandidates+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []supersessionCandidate
+	for rows.Next() {
+		var c supersessionCandidate
+		var candidateValidAt sql.NullString
+		var distance float64
+		var sharesEntity bool
+		if err := rows.Scan(&c.id, &c.text, &candidateValidAt, &distance, &sharesEntity); err != nil {
+			return nil, err
+		}
+		c.validAt = candidateValidAt.String
+		if c.id == chunkID || c.validAt == "" || c.validAt >= validAt {
+			continue
+		}
+		if !sharesEntity && distance > supersessionMaxDistance {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Skip chunks that already have a successor
+	kept := candidates[:0]
+	for _, c := range candidates {
+		var supersededBy sql.NullInt64
+		if err := db.QueryRow(`SELECT superseded_by FROM chunks WHERE id = ?`, c.id).Scan(&supersededBy); err != nil {
+			return nil, err
+		}
+		if !supersededBy.Valid {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// pendingSupersessionChunks returns dated chunks not yet checked for supersession,
+// oldest first so chains resolve in order, optionally limited to one source file.
+func pendingSupersessionChunks(db *sql.DB, sourceFile string) ([]int64, error) {
+	query := `SELECT id FROM chunks
+		WHERE valid_at IS NOT NULL AND valid_at != ''
+		  AND id NOT IN (SELECT chunk_id FROM chunk_extractions WHERE kind = ?)`
+	args := []any{extractionKindSupersession}
+	if sourceFile != "" {
+		query += ` AND source_file = ?`
+		args = append(args, sourceFile)
+	}
+	query += ` ORDER BY valid_at, id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
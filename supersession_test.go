@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectSupersessions(t *testing.T) {
+	var prompts []string
+	vec := makeVec(map[int]float32{0: 1})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/generate":
+			var req generateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			prompts = append(prompts, req.Prompt)
+			answer := `{"supersedes": false, "reason": "adds detail"}`
+			if strings.Contains(req.Prompt, "MySQL") && strings.Contains(req.Prompt, "switched to Postgres") {
+				answer = `{"supersedes": true, "reason": "database changed"}`
+			}
+			_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+		case "/api/embed":
+			out := make([]float64, len(vec))
+			for i, v := range vec {
+				out[i] = float64(v)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float64{out}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	near := makeVec(map[int]float32{0: 1, 1: 0.1})
+	far := makeVec(map[int]float32{1: 1})
+	oldID := insertChunk(t, db, "We use MySQL for the ledger.", "a.md", "Jan", "", 2, "2024-01-01", vec)
+	newID := insertChunk(t, db, "We switched to Postgres for the ledger.", "b.md", "May", "", 2, "2024-05-01", near)
+	insertChunk(t, db, "Lunch was good.", "c.md", "Jun", "", 2, "2024-06-01", far)
+	insertChunk(t, db, "Undated musings on databases.", "d.md", "Misc", "", 2, "", vec)
+
+	pending, err := pendingSupersessionChunks(db, "")
+	if err != nil {
+		t.Fatalf("pendingSupersessionChunks: %v", err)
+	}
+	if len(pending) != 3 || pending[0] != oldID || pending[1] != newID {
+		t.Fatalf("expected dated chunks oldest first, got %v", pending)
+	}
+
+	client := NewOllamaClient(server.URL, "embed")
+	result, err := DetectSupersessions(context.Background(), db, client, "gen", pending, nil)
+	if err != nil {
+		t.Fatalf("DetectSupersessions: %v", err)
+	}
+	// Only the May chunk has a close, older neighbour; lunch is too far off-topic
+	if result.ChunksChecked != 3 || result.Comparisons != 1 || result.Superseded != 1 || len(prompts) != 1 {
+		t.Fatalf("unexpected result: %+v (prompts %q)", result, prompts)
+	}
+
+	current, err := SearchWithOptions(context.Background(), db, client, "ledger database", SearchOptions{Limit: 10, Current: true})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	for _, r := range current {
+		if r.ID == int(oldID) {
+			t.Fatalf("current search returned superseded chunk: %+v", r)
+		}
+	}
+	all, err := Search(context.Background(), db, client, "ledger database", 10, "")
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(all) != len(current)+1 {
+		t.Fatalf("expected plain search to include the superseded chunk: %d vs %d", len(all), len(current))
+	}
+
+	remaining, err := pendingSupersessionChunks(db, "")
+	if err != nil {
+		t.Fatalf("pendingSupersessionChunks: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Fatalf("expected nothing pending, got %v", remaining)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// tagSourceHashtag marks tags written inline in a chunk's text as #hashtags, and
+// tagSourceManual those added with `mneme tag add`.
+const (
+	tagSourceHashtag = "hashtag"
+	tagSourceManual  = "manual"
+)
+
+// hashtag matches an Obsidian-style #tag: letters, digits, _, - and / for nesting, after
+// the start of a line, whitespace or an opening bracket. "# Title", "C#", URL fragments
+// and HTML entities are left alone.
+var hashtag = regexp.MustCompile(`(?:^|[\s(\[{,;])#([\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+
+// inlineCode matches a `code span`, whose #s are not tags.
+var inlineCode = regexp.MustCompile("`[^`\n]*`")
+
+// extractHashtags returns the #hashtags in text, normalized and in the order they first
+// appear. Fenced code blocks and code spans are skipped, as are all-digit tags like
+// "#12", which are issue numbers more often than topics.
+func extractHashtags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		line = inlineCode.ReplaceAllString(line, "")
+		for _, m := range hashtag.FindAllStringSubmatch(line, -1) {
+			tag := strings.TrimRight(m[1], "/-")
+			if strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+				continue
+			}
+			if tag = normalizeTag(tag); tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// storeIngestTags gives a newly ingested chunk its frontmatter tags and hashtags.
+func storeIngestTags(tx *sql.Tx, chunkID int64, pc ingestPreparedChunk) error {
+	for _, tag := range pc.tags {
+		if _, err := addChunkTag(tx, chunkID, tag, tagSourceFrontmatter); err != nil {
+			return err
+		}
+	}
+	for _, tag := range pc.hashtags {
+		if _, err := addChunkTag(tx, chunkID, tag, tagSourceHashtag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChunkTag is a tag on a chunk and what put it there.
+type ChunkTag struct {
+	Tag    string
+	Source string
+}
+
+// ListChunkTags returns the tags on a chunk, alphabetically.
+func ListChunkTags(db *sql.DB, chunkID int64) ([]ChunkTag, error) {
+	if err := chunkExists(db, chunkID); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT tag, source FROM chunk_tags WHERE chunk_id = ? ORDER BY tag`, chunkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []ChunkTag
+	for rows.Next() {
+		var t ChunkTag
+		if err := rows.Scan(&t.Tag, &t.Source); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// AddChunkTags tags a chunk by hand, returning how many of the tags it did not carry
+// already.
+func AddChunkTags(db *sql.DB, chunkID int64, tags []string) (int, error) {
+	if err := chunkExists(db, chunkID); err != nil {
+		return 0, err
+	}
+	added := 0
+	err := withWriteTx(db, "add tags", func(tx *sql.Tx) error {
+		for _, tag := range tags {
+			normalized := normalizeTag(tag)
+			if normalized == "" {
+				return fmt.Errorf("invalid tag %q", tag)
+			}
+			ok, err := addChunkTag(tx, chunkID, normalized, tagSourceManual)
+			if err != nil {
+				return err
+			}
+			if ok {
+				added++
+			}
+		}
+		return nil
+	})
+	return added, err
+}
+
+// RemoveChunkTags takes tags off a chunk, whatever put them there, returning how many it
+// carried. Frontmatter tags and hashtags come back if the note is ingested again with them.
+func RemoveChunkTags(db *sql.DB, chunkID int64, tags []string) (int, error) {
+	if err := chunkExists(db, chunkID); err != nil {
+		return 0, err
+	}
+	removed := 0
+	err := withWriteTx(db, "remove tags", func(tx *sql.Tx) error {
+		for _, tag := range tags {
+			res, err := tx.Exec(`DELETE FROM chunk_tags WHERE chunk_id = ? AND tag = ?`, chunkID, normalizeTag(tag))
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			removed += int(n)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func chunkExists(db *sql.DB, chunkID int64) error {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM chunks WHERE id = ?)`, chunkID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("chunk %d not found", chunkID)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	text := "Planning #Q3-planning with #project/mneme, see issue #12.\n" +
+		"Written in C# (#go), not http://example.com/#anchor or &#39;\n" +
+		"Inline `#notatag` and a repeat #go\n" +
+		"```\n# comment #alsonot\n```\n" +
+		"#hiring/"
+	want := []string{"q3-planning", "project/mneme", "go", "hiring"}
+	if got := extractHashtags(text); !reflect.DeepEqual(got, want) {
+		t.Fatalf("extractHashtags = %q, want %q", got, want)
+	}
+}
+
+func TestIngestStoresHashtags(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	ollama := NewOllamaClient(server.URL, "embed")
+
+	note := "---\ntags: [work]\n---\n## Hiring\n\nOffer out to Alex #hiring\n\n## Lunch\n\nTacos\n"
+	result, err := IngestMarkdown(context.Background(), db, ollama, "notes.md", strings.NewReader(note), "", defaultChunking, nil)
+	if err != nil {
+		t.Fatalf("IngestMarkdown: %v", err)
+	}
+	tags, err := ListChunkTags(db, result.ChunkIDs[0])
+	if err != nil {
+		t.Fatalf("ListChunkTags: %v", err)
+	}
+	want := []ChunkTag{{"hiring", tagSourceHashtag}, {"work", tagSourceFrontmatter}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Fatalf("expected %v, got %v", want, tags)
+	}
+
+	// Ingesting the edited note tags the chunk the hashtag was added to
+	note = strings.Replace(note, "Tacos", "Tacos #food", 1)
+	if _, err := IngestMarkdown(context.Background(), db, ollama, "notes.md", strings.NewReader(note), "", defaultChunking, nil); err != nil {
+		t.Fatalf("IngestMarkdown again: %v", err)
+	}
+	tagged, err := TaggedChunks(db, "food", 10)
+	if err != nil || len(tagged) != 1 || !strings.Contains(tagged[0].Text, "Tacos") {
+		t.Fatalf("expected the lunch chunk tagged food, got %v, %v", tagged, err)
+	}
+}
+
+func TestCurateChunkTags(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	id := insertChunk(t, db, "Offer out to Alex", "notes.md", "Hiring", "", 2, "2026-01-10", makeVec(map[int]float32{0: 1}))
+	other := insertChunk(t, db, "Alex joined standup", "standup.md", "Standup", "", 2, "2026-01-11", makeVec(map[int]float32{1: 1}))
+
+	added, err := AddChunkTags(db, id, []string{"Hiring", "#q3", "hiring"})
+	if err != nil || added != 2 {
+		t.Fatalf("expected 2 tags added, got %d, %v", added, err)
+	}
+	if _, err := AddChunkTags(db, 999, []string{"hiring"}); err == nil {
+		t.Fatal("expected a missing chunk rejected")
+	}
+	if _, err := AddChunkTags(db, id, []string{"#"}); err == nil {
+		t.Fatal("expected an empty tag rejected")
+	}
+
+	results, err := History(db, "Alex", 60)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	results, err = keepTagged(db, results, "hiring", 20)
+	if err != nil || len(results) != 1 || int64(results[0].ID) != id {
+		t.Fatalf("expected only chunk %d in the tagged history, got %v, %v", id, results, err)
+	}
+
+	removed, err := RemoveChunkTags(db, id, []string{"q3", "unknown"})
+	if err != nil || removed != 1 {
+		t.Fatalf("expected 1 tag removed, got %d, %v", removed, err)
+	}
+	tags, err := ListChunkTags(db, id)
+	if err != nil || !reflect.DeepEqual(tags, []ChunkTag{{"hiring", tagSourceManual}}) {
+		t.Fatalf("expected only hiring left, got %v, %v", tags, err)
+	}
+	if tags, err := ListChunkTags(db, other); err != nil || len(tags) != 0 {
+		t.Fatalf("expected no tags on chunk %d, got %v, %v", other, tags, err)
+	}
+}
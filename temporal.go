@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// Temporal fields are stored in two canonical forms:
+//   - valid_at and valid_until are calendar dates (YYYY-MM-DD) in mnemeLocation.
+//   - ingested_at and the other *_at columns are RFC3339 instants in UTC.
+//
+// Dates taken from message timestamps are the date in mnemeLocation, and user input
+// (--valid-at, --as-of, date ranges) may be a date or an RFC3339 timestamp.
+
+// mnemeLocation is the time zone calendar dates are read and written in: MNEME_TZ (an
+// IANA name such as Europe/Berlin) or the system zone.
+var mnemeLocation = time.Local
+
+const dateLayout = "2006-01-02"
+
+// sqliteDriver is the go-sqlite3 driver with mneme's SQL functions registered.
+const sqliteDriver = "sqlite3_mneme"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("local_date", sqlLocalDate, true)
+		},
+	})
+}
+
+func loadTimezone() error {
+	name := os.Getenv("MNEME_TZ")
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("MNEME_TZ: %w", err)
+	}
+	mnemeLocation = loc
+	return nil
+}
+
+// dayFirst reads an all-numeric date such as 03/04/2026 as day/month (4 March) rather
+// than month/day (March 4): MNEME_DATE_ORDER=dmy. A date with a number over 12 is read
+// the only way it can be either way.
+var dayFirst bool
+
+func loadDateOrder() error {
+	switch order := strings.ToLower(os.Getenv("MNEME_DATE_ORDER")); order {
+	case "", "mdy":
+		dayFirst = false
+	case "dmy":
+		dayFirst = true
+	default:
+		return fmt.Errorf("MNEME_DATE_ORDER: want mdy or dmy, got %q", order)
+	}
+	return nil
+}
+
+// zonelessLayouts are timestamps without an offset, read as mnemeLocation wall time.
+var zonelessLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"}
+
+// parseTemporal reads a date (YYYY-MM-DD, midnight in mnemeLocation) or a timestamp:
+// RFC3339, or a date and time without an offset taken to be in mnemeLocation.
+func parseTemporal(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.ParseInLocation(dateLayout, value, mnemeLocation); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range zonelessLayouts {
+		if t, err := time.ParseInLocation(layout, value, mnemeLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD or an RFC3339 timestamp)", value)
+}
+
+// NormalizeDate returns the canonical form of a date-valued field (valid_at, an as-of
+// or range bound): the calendar date of value in mnemeLocation. Empty stays empty.
+func NormalizeDate(value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+	t, err := parseTemporal(value)
+	if err != nil {
+		return "", err
+	}
+	return localDate(t), nil
+}
+
+// dateKey is NormalizeDate for values already stored, keeping unparseable ones as they are.
+func dateKey(value string) string {
+	if normalized, err := NormalizeDate(value); err == nil {
+		return normalized
+	}
+	return value
+}
+
+// localDate returns the calendar date of t in mnemeLocation.
+func localDate(t time.Time) string {
+	return t.In(mnemeLocation).Format(dateLayout)
+}
+
+// sqlLocalDate backs the local_date(value) SQL function, the mnemeLocation date of a
+// stored date or timestamp. Unparseable values come back unchanged, NULL as NULL.
+func sqlLocalDate(value driver.Value) driver.Value {
+	switch v := value.(type) {
+	case string:
+		return dateKey(v)
+	case []byte:
+		// go-sqlite3 passes NULL as a nil byte slice
+		if v == nil {
+			return nil
+		}
+		return dateKey(string(v))
+	}
+	return value
+}
+
+// normalizeStoredTimes rewrites temporal values written by older versions into the
+// canonical forms, once, as a migration. Values that can't be parsed are left alone.
+func normalizeStoredTimes(tx *sql.Tx) error {
+	type column struct {
+		table, name string
+		date        bool
+	}
+	for _, col := range []column{
+		{"chunks", "valid_at", true},
+		{"chunks", "valid_until", true},
+		{"facts", "valid_at", true},
+		{"facts", "valid_until", true},
+		{"relations", "valid_at", true},
+		{"chunks", "ingested_at", false},
+	} {
+		canonical := `'[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]'`
+		if !col.date {
+			canonical = `'[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]T[0-9][0-9]:[0-9][0-9]:[0-9][0-9]Z'`
+		}
+		rows, err := tx.Query(fmt.Sprintf(`SELECT rowid, %s FROM %s WHERE %s IS NOT NULL AND %s NOT GLOB %s`, col.name, col.table, col.name, col.name, canonical))
+		if err != nil {
+			return fmt.Errorf("scan %s.%s: %w", col.table, col.name, err)
+		}
+		updates := make(map[int64]string)
+		for rows.Next() {
+			var rowid int64
+			var value string
+			if err := rows.Scan(&rowid, &value); err != nil {
+				rows.Close()
+				return err
+			}
+			t, err := parseTemporal(value)
+			if err != nil {
+				continue
+			}
+			if col.date {
+				updates[rowid] = localDate(t)
+			} else {
+				updates[rowid] = t.UTC().Format(time.RFC3339)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for rowid, value := range updates {
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, col.table, col.name), value, rowid); err != nil {
+				return fmt.Errorf("normalize %s.%s: %w", col.table, col.name, err)
+			}
+		}
+	}
+	return nil
+}
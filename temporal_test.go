@@ -0,0 +1,141 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withLocation runs the rest of a test with mnemeLocation set to loc.
+func withLocation(t *testing.T, loc *time.Location) {
+	t.Helper()
+	previous := mnemeLocation
+	mnemeLocation = loc
+	t.Cleanup(func() { mnemeLocation = previous })
+}
+
+func TestNormalizeDate(t *testing.T) {
+	withLocation(t, time.FixedZone("UTC+2", 2*60*60))
+
+	cases := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"2025-06-02", "2025-06-02"},
+		{" 2025-06-02 ", "2025-06-02"},
+		{"2025-06-02T21:59:59Z", "2025-06-02"},
+		{"2025-06-02T23:30:00Z", "2025-06-03"},
+		{"2025-06-02T23:30:00.123456Z", "2025-06-03"},
+		{"2025-06-03T01:00:00+05:00", "2025-06-02"},
+		{"2025-06-02 23:30:00", "2025-06-02"},
+		{"2025-06-02T23:30", "2025-06-02"},
+	}
+	for _, tc := range cases {
+		got, err := NormalizeDate(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("NormalizeDate(%q) = %q, %v, want %q", tc.in, got, err, tc.want)
+		}
+	}
+	for _, bad := range []string{"June 2", "2025-13-01", "yesterday"} {
+		if _, err := NormalizeDate(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+	if got := dateKey("someday"); got != "someday" {
+		t.Fatalf("expected unparseable values kept, got %q", got)
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	withLocation(t, time.Local)
+
+	t.Setenv("MNEME_TZ", "Nowhere/Special")
+	if err := loadTimezone(); err == nil {
+		t.Fatal("expected an error for an unknown zone")
+	}
+	t.Setenv("MNEME_TZ", "UTC")
+	if err := loadTimezone(); err != nil || mnemeLocation.String() != "UTC" {
+		t.Fatalf("expected UTC, got %v, %v", mnemeLocation, err)
+	}
+}
+
+func TestValidAsOfMixedForms(t *testing.T) {
+	withLocation(t, time.FixedZone("UTC+2", 2*60*60))
+
+	cases := []struct {
+		validAt, validUntil, asOf string
+		want                      bool
+	}{
+		// Late evening UTC is already the next day in UTC+2
+		{"2025-06-03", "", "2025-06-02T23:30:00Z", true},
+		{"2025-06-03", "", "2025-06-02T21:00:00Z", false},
+		{"2025-06-02T23:30:00Z", "", "2025-06-03", true},
+		{"2025-06-01", "2025-06-02T23:30:00Z", "2025-06-02", true},
+		{"2025-06-01", "2025-06-02T23:30:00Z", "2025-06-03", false},
+	}
+	for _, tc := range cases {
+		if got := validAsOf(tc.validAt, tc.validUntil, tc.asOf); got != tc.want {
+			t.Errorf("validAsOf(%q, %q, %q) = %v, want %v", tc.validAt, tc.validUntil, tc.asOf, got, tc.want)
+		}
+	}
+}
+
+func TestLocalDateSQL(t *testing.T) {
+	withLocation(t, time.FixedZone("UTC+2", 2*60*60))
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	for in, want := range map[string]string{
+		"2025-06-02T23:30:00Z": "2025-06-03",
+		"2025-06-02":           "2025-06-02",
+		"garbage":              "garbage",
+	} {
+		var got string
+		if err := db.QueryRow(`SELECT local_date(?)`, in).Scan(&got); err != nil || got != want {
+			t.Errorf("local_date(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	var null *string
+	if err := db.QueryRow(`SELECT local_date(NULL)`).Scan(&null); err != nil || null != nil {
+		t.Fatalf("expected NULL through, got %v, %v", null, err)
+	}
+}
+
+func TestNormalizeStoredTimes(t *testing.T) {
+	withLocation(t, time.FixedZone("UTC+2", 2*60*60))
+
+	path := filepath.Join(t.TempDir(), "mneme.db")
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	id := insertChunk(t, db, "text", "a.md", "Title", "", 2, "2025-06-02T23:30:00Z", makeVec(map[int]float32{0: 1}))
+	kept := insertChunk(t, db, "text", "b.md", "Title", "", 2, "2025-06-02", makeVec(map[int]float32{0: 1}))
+	if _, err := db.Exec(`UPDATE chunks SET ingested_at = '2025-06-03 08:00:00', valid_until = 'someday' WHERE id = ?`, id); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	// Rewind to before the migration, which then runs on the next open
+	if _, err := db.Exec(`DELETE FROM schema_version WHERE version >= 8`); err != nil {
+		t.Fatalf("rewind: %v", err)
+	}
+	db.Close()
+
+	if db, err = InitDB(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+	var validAt, validUntil, ingestedAt string
+	db.QueryRow(`SELECT valid_at, valid_until, ingested_at FROM chunks WHERE id = ?`, id).Scan(&validAt, &validUntil, &ingestedAt)
+	if validAt != "2025-06-03" || validUntil != "someday" || ingestedAt != "2025-06-03T06:00:00Z" {
+		t.Fatalf("unexpected normalized values: %q, %q, %q", validAt, validUntil, ingestedAt)
+	}
+	db.QueryRow(`SELECT valid_at FROM chunks WHERE id = ?`, kept).Scan(&validAt)
+	if validAt != "2025-06-02" {
+		t.Fatalf("expected a canonical date left alone, got %q", validAt)
+	}
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+// ThreadOptions tunes how messages are grouped into threads.
+type ThreadOptions struct {
+	// Gap is the longest pause after which a session's next message no longer simply
+	// continues the thread it was in.
+	Gap time.Duration
+	// Drift is the similarity to the ongoing thread below which a message starts
+	// (or resumes) another one, even within the gap.
+	Drift float64
+	// Resume is the similarity to an earlier thread, from any session, at which a
+	// message rejoins it instead of starting a new one.
+	Resume float64
+}
+
+// defaultThreadOptions suits chatty sessions: half an hour of silence or a clear change
+// of subject ends a thread, and only close matches pull in earlier threads.
+var defaultThreadOptions = ThreadOptions{Gap: 30 * time.Minute, Drift: 0.4, Resume: 0.7}
+
+// threadTitleMax caps titles taken from a thread's first message, in runes.
+const threadTitleMax = 80
+
+// Thread is a run of messages about one topic, possibly spanning sessions.
+type Thread struct {
+	ID           int64  `json:"id"`
+	Title        string `json:"title"`
+	StartedAt    int64  `json:"started_at"`
+	EndedAt      int64  `json:"ended_at"`
+	MessageCount int    `json:"message_count"`
+	Sessions     int    `json:"sessions"`
+}
+
+// ThreadMatch is a thread found by a query, with its whole discussion.
+type ThreadMatch struct {
+	Thread
+	Distance float64          `json:"distance"`
+	Messages []contextMessage `json:"messages"`
+}
+
+// ThreadBuildResult reports one threading pass.
+type ThreadBuildResult struct {
+	Messages   int
+	NewThreads int
+}
+
+type pendingMessage struct {
+	id        string
+	sessionID string
+	timestamp int64
+	text      string
+}
+
+type sessionThread struct {
+	threadID int64
+	lastTS   int64
+}
+
+// threadTitle is the first line of text, shortened to threadTitleMax runes.
+func threadTitle(text string) string {
+	line := strings.TrimSpace(text)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+	if utf8.RuneCountInString(line) <= threadTitleMax {
+		return line
+	}
+	runes := []rune(line)
+	return strings.TrimSpace(string(runes[:threadTitleMax])) + "..."
+}
+
+// BuildThreads assigns every unthreaded message to a thread, oldest first. A message
+// continues its session's current thread while the pause is under opts.Gap and it
+// stays on topic (opts.Drift); otherwise it rejoins the closest earlier thread at
+// opts.Resume similarity or more, or starts a new one. Messages too short to have
+// been embedded follow their session's current thread.
+func BuildThreads(db *sql.DB, opts ThreadOptions, progress ProgressFunc) (ThreadBuildResult, error) {
+	var result ThreadBuildResult
+
+	rows, err := db.Query(`SELECT id, session_id, timestamp, text FROM messages WHERE thread_id IS NULL ORDER BY timestamp, id`)
+	if err != nil {
+		return result, err
+	}
+	var pending []pendingMessage
+	for rows.Next() {
+		var m pendingMessage
+		if err := rows.Scan(&m.id, &m.sessionID, &m.timestamp, &m.text); err != nil {
+			rows.Close()
+			return result, err
+		}
+		pending = append(pending, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	err = withWriteTx(db, "build threads", func(tx *sql.Tx) error {
+		result = ThreadBuildResult{}
+		sessions := make(map[string]*sessionThread)
+		centroids := make(map[int64][]float32)
+		gapMS := opts.Gap.Milliseconds()
+
+		for i, m := range pending {
+			if progress != nil {
+				progress(i, len(pending), "")
+			}
+
+			current, ok := sessions[m.sessionID]
+			if !ok {
+				current = &sessionThread{}
+				err := tx.QueryRow(
+					`SELECT thread_id, timestamp FROM messages WHERE session_id = ? AND thread_id IS NOT NULL
+					 ORDER BY timestamp DESC LIMIT 1`, m.sessionID,
+				).Scan(&current.threadID, &current.lastTS)
+				if err != nil && err != sql.ErrNoRows {
+					return fmt.Errorf("session %s: %w", m.sessionID, err)
+				}
+				sessions[m.sessionID] = current
+			}
+
+			vec, err := messageEmbedding(tx, m.id)
+			if err != nil {
+				return fmt.Errorf("load embedding %s: %w", m.id, err)
+			}
+
+			var threadID int64
+			withinGap := current.threadID != 0 && m.timestamp-current.lastTS <= gapMS
+			switch {
+			case vec == nil:
+				threadID = current.threadID
+			case withinGap:
+				centroid, err := threadCentroid(tx, centroids, current.threadID)
+				if err != nil {
+					return err
+				}
+				if centroid == nil || float64(dotVec(vec, unitVec(centroid))) >= opts.Drift {
+					threadID = current.threadID
+				}
+			}
+			if threadID == 0 && vec != nil {
+				if threadID, err = closestThread(tx, vec, opts.Resume); err != nil {
+					return err
+				}
+			}
+
+			if threadID == 0 {
+				res, err := tx.Exec(
+					`INSERT INTO threads (title, started_at, ended_at, message_count) VALUES (?, ?, ?, 0)`,
+					threadTitle(m.text), m.timestamp, m.timestamp,
+				)
+				if err != nil {
+					return fmt.Errorf("create thread: %w", err)
+				}
+				threadID, _ = res.LastInsertId()
+				result.NewThreads++
+			}
+
+			if _, err := tx.Exec(`UPDATE messages SET thread_id = ? WHERE id = ?`, threadID, m.id); err != nil {
+				return fmt.Errorf("assign %s: %w", m.id, err)
+			}
+			if _, err := tx.Exec(
+				`UPDATE threads SET message_count = message_count + 1,
+				   started_at = MIN(started_at, ?1), ended_at = MAX(ended_at, ?1) WHERE id = ?2`,
+				m.timestamp, threadID,
+			); err != nil {
+				return fmt.Errorf("update thread %d: %w", threadID, err)
+			}
+			if vec != nil {
+				if err := addToCentroid(tx, centroids, threadID, vec); err != nil {
+					return err
+				}
+			}
+
+			current.threadID = threadID
+			current.lastTS = m.timestamp
+			result.Messages++
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	if progress != nil {
+		progress(len(pending), len(pending), "")
+	}
+	return result, nil
+}
+
+// messageEmbedding reads a message's stored vector normalized, or nil if it has none.
+func messageEmbedding(tx *sql.Tx, messageID string) ([]float32, error) {
+	var blob []byte
+	err := tx.QueryRow(`SELECT embedding FROM vec_messages WHERE message_id = ?`, messageID).Scan(&blob)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	vec, err := deserializeFloat32(blob)
+	if err != nil {
+		return nil, err
+	}
+	normalizeVec(vec)
+	return vec, nil
+}
+
+// threadCentroid returns a thread's embedding sum, loading it into cache on first use.
+func threadCentroid(tx *sql.Tx, cache map[int64][]float32, threadID int64) ([]float32, error) {
+	if centroid, ok := cache[threadID]; ok {
+		return centroid, nil
+	}
+	var blob []byte
+	err := tx.QueryRow(`SELECT embedding FROM vec_threads WHERE thread_id = ?`, threadID).Scan(&blob)
+	if err == sql.ErrNoRows {
+		cache[threadID] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load thread %d: %w", threadID, err)
+	}
+	centroid, err := deserializeFloat32(blob)
+	if err != nil {
+		return nil, err
+	}
+	cache[threadID] = centroid
+	return centroid, nil
+}
+
+// addToCentroid adds vec to a thread's embedding sum and stores it.
+func addToCentroid(tx *sql.Tx, cache map[int64][]float32, threadID int64, vec []float32) error {
+	centroid, err := threadCentroid(tx, cache, threadID)
+	if err != nil {
+		return err
+	}
+	if centroid == nil {
+		centroid = make([]float32, len(vec))
+	}
+	for i := range vec {
+		centroid[i] += vec[i]
+	}
+	cache[threadID] = centroid
+
+	serialized, err := sqlite_vec.SerializeFloat32(centroid)
+	if err != nil {
+		return fmt.Errorf("serialize centroid: %w", err)
+	}
+	// vec0 rows are replaced rather than updated
+	if _, err := tx.Exec(`DELETE FROM vec_threads WHERE thread_id = ?`, threadID); err != nil {
+		return fmt.Errorf("store thread %d: %w", threadID, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO vec_threads (thread_id, embedding) VALUES (?, ?)`, threadID, serialized); err != nil {
+		return fmt.Errorf("store thread %d: %w", threadID, err)
+	}
+	return nil
+}
+
+// rebuildThreadEmbeddings sums every thread's embedding again from its messages' stored
+// vectors, as after a reembed, and returns how many threads it stored.
+func rebuildThreadEmbeddings(tx *sql.Tx) (int, error) {
+	rows, err := tx.Query(
+		`SELECT m.thread_id, v.embedding FROM messages m JOIN vec_messages v ON v.message_id = m.id
+		 WHERE m.thread_id IS NOT NULL`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("load thread messages: %w", err)
+	}
+	sums := make(map[int64][]float32)
+	for rows.Next() {
+		var threadID int64
+		var blob []byte
+		if err := rows.Scan(&threadID, &blob); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		vec, err := deserializeFloat32(blob)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		normalizeVec(vec)
+		sum := sums[threadID]
+		if sum == nil {
+			sum = make([]float32, len(vec))
+		}
+		for i := range vec {
+			sum[i] += vec[i]
+		}
+		sums[threadID] = sum
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM vec_threads`); err != nil {
+		return 0, err
+	}
+	for threadID, sum := range sums {
+		serialized, err := sqlite_vec.SerializeFloat32(sum)
+		if err != nil {
+			return 0, fmt.Errorf("serialize centroid: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO vec_threads (thread_id, embedding) VALUES (?, ?)`, threadID, serialized); err != nil {
+			return 0, fmt.Errorf("store thread %d: %w", threadID, err)
+		}
+	}
+	return len(sums), nil
+}
+
+// closestThread returns the thread most similar to vec if it reaches minSimilarity, else 0.
+func closestThread(tx *sql.Tx, vec []float32, minSimilarity float64) (int64, error) {
+	serialized, err := sqlite_vec.SerializeFloat32(vec)
+	if err != nil {
+		return 0, fmt.Errorf("serialize: %w", err)
+	}
+	var threadID int64
+	var distance float64
+	err = tx.QueryRow(
+		`SELECT thread_id, distance FROM vec_threads WHERE embedding MATCH ? AND k = 1`, serialized,
+	).Scan(&threadID, &distance)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("match threads: %w", err)
+	}
+	if 1-distance < minSimilarity {
+		return 0, nil
+	}
+	return threadID, nil
+}
+
+// unitVec returns a normalized copy of vec.
+func unitVec(vec []float32) []float32 {
+	out := make([]float32, len(vec))
+	copy(out, vec)
+	normalizeVec(out)
+	return out
+}
+
+// ResetThreads removes every thread so the next BuildThreads regroups all messages.
+func ResetThreads(db *sql.DB) error {
+	return withWriteTx(db, "reset threads", func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			`UPDATE messages SET thread_id = NULL WHERE thread_id IS NOT NULL`,
+			`DELETE FROM vec_threads`,
+			`DELETE FROM threads`,
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const threadColumns = `t.id, t.title, t.started_at, t.ended_at, t.message_count,
+	(SELECT COUNT(DISTINCT session_id) FROM messages WHERE thread_id = t.id)`
+
+func scanThread(scanner interface{ Scan(...any) error }) (Thread, error) {
+	var t Thread
+	err := scanner.Scan(&t.ID, &t.Title, &t.StartedAt, &t.EndedAt, &t.MessageCount, &t.Sessions)
+	return t, err
+}
+
+// ListThreads returns threads, most recently active first. If limit <= 0, defaults to 20.
+func ListThreads(db *sql.DB, limit int) ([]Thread, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	rows, err := db.Query(`SELECT `+threadColumns+` FROM threads t ORDER BY t.ended_at DESC, t.id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []Thread{}
+	for rows.Next() {
+		t, err := scanThread(rows)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
+
+// GetThread returns one thread and all its messages in order.
+func GetThread(db *sql.DB, threadID int64) (*ThreadMatch, error) {
+	t, err := scanThread(db.QueryRow(`SELECT `+threadColumns+` FROM threads t WHERE t.id = ?`, threadID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("thread %d not found", threadID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(
+		`SELECT id, session_id, role, timestamp, text FROM messages WHERE thread_id = ? ORDER BY timestamp, id`, threadID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	match := &ThreadMatch{Thread: t, Messages: []contextMessage{}}
+	for rows.Next() {
+		var m contextMessage
+		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Timestamp, &m.Text); err != nil {
+			return nil, err
+		}
+		match.Messages = append(match.Messages, m)
+	}
+	return match, rows.Err()
+}
+
+// SearchThreads finds the threads holding the messages closest to query and returns
+// each whole, best match first. Messages not yet threaded are ignored.
+func SearchThreads(ctx context.Context, db *sql.DB, ollama *OllamaClient, query string, limit int) ([]ThreadMatch, error) {
+	if limit <= 0 {
+		limit = 3
+	}
+	embedding, err := ollama.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	serialized, err := sqlite_vec.SerializeFloat32(embedding)
+	if err != nil {
+		return nil, fmt.Errorf("serialize: %w", err)
+	}
+
+	// Several hits usually land in the same thread, so look past limit
+	rows, err := db.Query(
+		`SELECT m.thread_id, vm.distance FROM vec_messages vm
+		 JOIN messages m ON m.id = vm.message_id
+		 WHERE vm.embedding MATCH ? AND k = ?
+		 ORDER BY vm.distance`,
+		serialized, limit*10,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	best := make(map[int64]float64)
+	for rows.Next() {
+		var threadID sql.NullInt64
+		var distance float64
+		if err := rows.Scan(&threadID, &distance); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !threadID.Valid {
+			continue
+		}
+		if d, ok := best[threadID.Int64]; !ok || distance < d {
+			best[threadID.Int64] = distance
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(best))
+	for id := range best {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if best[ids[i]] != best[ids[j]] {
+			return best[ids[i]] < best[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	matches := []ThreadMatch{}
+	for _, id := range ids {
+		match, err := GetThread(db, id)
+		if err != nil {
+			return nil, err
+		}
+		match.Distance = best[id]
+		matches = append(matches, *match)
+	}
+	return matches, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
+)
+
+func insertMessage(t *testing.T, db *sql.DB, id, session string, ts time.Time, text string, embedding []float32) {
+	t.Helper()
+	if _, err := db.Exec(`INSERT INTO messages (id, session_id, role, timestamp, text) VALUES (?, ?, 'user', ?, ?)`,
+		id, session, ts.UnixMilli(), text); err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	if embedding == nil {
+		return
+	}
+	serialized, err := sqlite_vec.SerializeFloat32(embedding)
+	if err != nil {
+		t.Fatalf("serialize embedding: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO vec_messages (message_id, embedding) VALUES (?, ?)`, id, serialized); err != nil {
+		t.Fatalf("insert message vector: %v", err)
+	}
+}
+
+func messageThreads(t *testing.T, db *sql.DB) map[string]int64 {
+	t.Helper()
+	rows, err := db.Query(`SELECT id, thread_id FROM messages`)
+	if err != nil {
+		t.Fatalf("query threads: %v", err)
+	}
+	defer rows.Close()
+	threads := make(map[string]int64)
+	for rows.Next() {
+		var id string
+		var thread sql.NullInt64
+		if err := rows.Scan(&id, &thread); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		threads[id] = thread.Int64
+	}
+	return threads
+}
+
+func TestThreadTitle(t *testing.T) {
+	if got := threadTitle("  How should we migrate?\nMore detail"); got != "How should we migrate?" {
+		t.Fatalf("unexpected title %q", got)
+	}
+	long := strings.Repeat("é", threadTitleMax+5)
+	if got := threadTitle(long); got != strings.Repeat("é", threadTitleMax)+"..." {
+		t.Fatalf("expected a rune-safe truncation, got %q", got)
+	}
+}
+
+func TestBuildAndSearchThreads(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	start := time.Date(2025, time.June, 2, 9, 0, 0, 0, time.UTC)
+	auth := makeVec(map[int]float32{0: 1})
+	insertMessage(t, db, "m1", "s1", start, "Auth migration plan", auth)
+	insertMessage(t, db, "m2", "s1", start.Add(5*time.Minute), "Auth tokens move to Postgres", makeVec(map[int]float32{0: 1, 1: 0.2}))
+	insertMessage(t, db, "m3", "s1", start.Add(6*time.Minute), "ok", nil)
+	insertMessage(t, db, "m4", "s1", start.Add(7*time.Minute), "Anyway, I slept badly", makeVec(map[int]float32{1: 1}))
+	insertMessage(t, db, "m5", "s2", start.Add(24*time.Hour), "Back to the auth migration", auth)
+	insertMessage(t, db, "m6", "s2", start.Add(24*time.Hour+time.Minute), "What's for dinner?", makeVec(map[int]float32{2: 1}))
+
+	result, err := BuildThreads(db, defaultThreadOptions, nil)
+	if err != nil {
+		t.Fatalf("BuildThreads: %v", err)
+	}
+	if result.Messages != 6 || result.NewThreads != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	threads := messageThreads(t, db)
+	authThread := threads["m1"]
+	if threads["m2"] != authThread || threads["m3"] != authThread || threads["m5"] != authThread {
+		t.Fatalf("expected the auth discussion in one thread across sessions, got %v", threads)
+	}
+	if threads["m4"] == authThread || threads["m6"] == authThread || threads["m4"] == threads["m6"] {
+		t.Fatalf("expected off-topic messages in threads of their own, got %v", threads)
+	}
+
+	// Incremental: only the new message is threaded, continuing its session's thread
+	insertMessage(t, db, "m7", "s1", start.Add(9*time.Minute), "Still tired", makeVec(map[int]float32{1: 1, 0: 0.1}))
+	if again, err := BuildThreads(db, defaultThreadOptions, nil); err != nil || again.Messages != 1 || again.NewThreads != 0 {
+		t.Fatalf("expected one message joined to an existing thread, got %+v, %v", again, err)
+	}
+	if got := messageThreads(t, db)["m7"]; got != threads["m4"] {
+		t.Fatalf("expected m7 in m4's thread, got %d", got)
+	}
+
+	list, err := ListThreads(db, 10)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("expected 3 threads, got %+v, %v", list, err)
+	}
+	thread, err := GetThread(db, authThread)
+	if err != nil {
+		t.Fatalf("GetThread: %v", err)
+	}
+	if thread.Title != "Auth migration plan" || thread.MessageCount != 4 || thread.Sessions != 2 || len(thread.Messages) != 4 || thread.Messages[3].ID != "m5" {
+		t.Fatalf("unexpected thread: %+v", thread)
+	}
+
+	server := newOllamaServer(t, auth)
+	defer server.Close()
+	matches, err := SearchThreads(context.Background(), db, NewOllamaClient(server.URL, "embed"), "auth", 1)
+	if err != nil {
+		t.Fatalf("SearchThreads: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != authThread || len(matches[0].Messages) != 4 {
+		t.Fatalf("expected the whole auth thread, got %+v", matches)
+	}
+
+	// Without resuming, the next day's auth talk starts over
+	if err := ResetThreads(db); err != nil {
+		t.Fatalf("ResetThreads: %v", err)
+	}
+	strict := defaultThreadOptions
+	strict.Resume = 1.01
+	if _, err := BuildThreads(db, strict, nil); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	threads = messageThreads(t, db)
+	if threads["m5"] == threads["m1"] || threads["m2"] != threads["m1"] {
+		t.Fatalf("expected m5 apart from m1 without resuming, got %v", threads)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// searchTimeout bounds a query: search, history, status and the MCP tools. A model
+// that stops answering fails the query instead of hanging the caller.
+var searchTimeout = 30 * time.Second
+
+// ingestTimeout bounds long runs such as ingest, reembed and the extraction passes.
+// Zero, the default, lets them run until done or interrupted.
+var ingestTimeout time.Duration
+
+func loadTimeouts() error {
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"MNEME_SEARCH_TIMEOUT", &searchTimeout},
+		{"MNEME_INGEST_TIMEOUT", &ingestTimeout},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("%s: want a duration such as 30s (0 for none), got %q", setting.name, value)
+		}
+		*setting.value = d
+	}
+	return nil
+}
+
+// withTimeout derives a context that expires after d, or one that only cancels when
+// d is zero.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// commandContext is the context for a CLI command: cancelled by Ctrl+C or SIGTERM, so
+// an embedding run stops at the next request rather than finishing the batch, and
+// bounded by timeout.
+func commandContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := withTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
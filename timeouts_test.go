@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadTimeouts(t *testing.T) {
+	previousSearch, previousIngest := searchTimeout, ingestTimeout
+	defer func() { searchTimeout, ingestTimeout = previousSearch, previousIngest }()
+
+	t.Setenv("MNEME_SEARCH_TIMEOUT", "5s")
+	t.Setenv("MNEME_INGEST_TIMEOUT", "10m")
+	if err := loadTimeouts(); err != nil || searchTimeout != 5*time.Second || ingestTimeout != 10*time.Minute {
+		t.Fatalf("expected 5s and 10m, got %v, %v, %v", searchTimeout, ingestTimeout, err)
+	}
+	t.Setenv("MNEME_SEARCH_TIMEOUT", "soon")
+	if err := loadTimeouts(); err == nil {
+		t.Fatal("expected an error for a bad duration")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := withTimeout(context.Background(), 0)
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("expected no deadline for a zero timeout")
+	}
+	cancel()
+	if ctx.Err() == nil {
+		t.Fatal("expected the context cancellable all the same")
+	}
+
+	ctx, cancel = withTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to pass, got %v", ctx.Err())
+	}
+}
+
+func TestIngestStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The model answers the first embedding, and the caller gives up meanwhile
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		cancel()
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": [][]float32{makeVec(map[int]float32{0: 1})}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	db, err := InitDB(filepath.Join(dir, "mneme.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	path := filepath.Join(dir, "notes.md")
+	if err := os.WriteFile(path, []byte("## One\n\nfirst section\n\n## Two\n\nsecond section\n\n## Three\n\nthird section\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// One request at a time, so none is in flight when the caller gives up
+	_, err = IngestFile(ctx, db, NewOllamaClient(server.URL, "embed").WithConcurrency(1), path, "", defaultChunking)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the ingest cancelled, got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expected embedding to stop after the first request, got %d", n)
+	}
+	var chunks int
+	db.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&chunks)
+	if chunks != 0 {
+		t.Fatalf("expected nothing stored from a cancelled ingest, got %d chunks", chunks)
+	}
+
+	if _, err := Search(ctx, db, NewOllamaClient(server.URL, "embed"), "first", 5, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the search cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// extractionKindTopics marks chunks in chunk_extractions once the topic pass has run.
+const extractionKindTopics = "topics"
+
+// tagSourceTopic marks tags assigned by the topic pass rather than by hand.
+const tagSourceTopic = "topic"
+
+// topicVocabularySize is how many existing topics are offered to the model for reuse.
+const topicVocabularySize = 40
+
+const topicTaggingPrompt = `You label personal notes and conversation transcripts with topics.
+Return JSON only, in exactly this shape:
+{"topics": ["...", "..."]}
+Rules:
+- Give 1 to 3 topics, each a short lowercase noun phrase of at most three words (e.g. "database migration", "hiring", "travel").
+- Describe what the text is about, not who is in it.
+- Reuse a topic from the existing list when one fits; only invent a new one when none does.`
+
+type topicTaggingResponse struct {
+	Topics []string `json:"topics"`
+}
+
+type TopicTaggingResult struct {
+	ChunksProcessed int
+	TagsCreated     int
+}
+
+// TagCount is a tag with the number of chunks carrying it.
+type TagCount struct {
+	Tag    string `json:"tag"`
+	Chunks int    `json:"chunks"`
+}
+
+// parseTopicResponse decodes the model's answer into at most three normalized topics.
+func parseTopicResponse(raw string) ([]string, error) {
+	var resp topicTaggingResponse
+	if err := decodeModelJSON(raw, &resp); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var topics []string
+	for _, topic := range resp.Topics {
+		topic = normalizeTag(topic)
+		if topic == "" || seen[topic] || len(strings.Fields(topic)) > 3 {
+			continue
+		}
+		seen[topic] = true
+		topics = append(topics, topic)
+		if len(topics) == 3 {
+			break
+		}
+	}
+	return topics, nil
+}
+
+// normalizeTag lowercases a tag and collapses whitespace; "" if nothing is left.
+func normalizeTag(tag string) string {
+	tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+	tag = strings.Trim(tag, ` "'.,;:#`)
+	if len([]rune(tag)) < 2 {
+		return ""
+	}
+	return tag
+}
+
+// TagTopics runs the topic pass over the given chunks. Existing topics are offered to
+// the model so the vocabulary stays small enough to browse.
+func TagTopics(ctx context.Context, db *sql.DB, ollama *OllamaClient, model string, chunkIDs []int64, progress ProgressFunc) (TopicTaggingResult, error) {
+	var result TopicTaggingResult
+
+	vocabulary, err := ListTags(db, tagSourceTopic, topicVocabularySize)
+	if err != nil {
+		return result, fmt.Errorf("load topics: %w", err)
+	}
+	known := make([]string, 0, len(vocabulary))
+	for _, t := range vocabulary {
+		known = append(known, t.Tag)
+	}
+
+	for i, chunkID := range chunkIDs {
+		var text, title string
+		err := db.QueryRow(`SELECT text, section_title FROM chunks WHERE id = ?`, chunkID).Scan(&text, &title)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("read chunk %d: %w", chunkID, err)
+		}
+		if progress != nil {
+			progress(i, len(chunkIDs), title)
+		}
+
+		prompt := fmt.Sprintf("Existing topics: %s\n\nText:\n%s", strings.Join(known, ", "), text)
+		if len(known) == 0 {
+			prompt = "Existing topics: (none yet)\n\nText:\n" + text
+		}
+		raw, err := ollama.GenerateJSON(ctx, model, topicTaggingPrompt, prompt)
+		if err != nil {
+			return result, fmt.Errorf("tag chunk %d: %w", chunkID, err)
+		}
+		topics, err := parseTopicResponse(raw)
+		if err != nil {
+			if errors.Is(err, errBadModelResponse) {
+				log.Printf("topic tagging: skipping chunk %d: %v", chunkID, err)
+				continue
+			}
+			return result, err
+		}
+
+		tagsCreated := 0
+		err = withWriteTx(db, "extract topics", func(tx *sql.Tx) error {
+			tagsCreated = 0
+			for _, topic := range topics {
+				added, err := addChunkTag(tx, chunkID, topic, tagSourceTopic)
+				if err != nil {
+					return err
+				}
+				if added {
+					tagsCreated++
+				}
+			}
+			if err := markExtracted(tx, chunkID, extractionKindTopics); err != nil {
+				return fmt.Errorf("mark extracted: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		for _, topic := range topics {
+			if !containsFold(known, topic) {
+				known = append(known, topic)
+			}
+		}
+		result.TagsCreated += tagsCreated
+		result.ChunksProcessed++
+	}
+	if progress != nil && len(chunkIDs) > 0 {
+		progress(len(chunkIDs), len(chunkIDs), "")
+	}
+
+	return result, nil
+}
+
+func addChunkTag(tx *sql.Tx, chunkID int64, tag, source string) (bool, error) {
+	res, err := tx.Exec(
+		`INSERT OR IGNORE INTO chunk_tags (chunk_id, tag, source, created_at) VALUES (?, ?, ?, ?)`,
+		chunkID, tag, source, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert tag: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListTags returns tags with their chunk counts, most used first. source filters by
+// who assigned them ("" for all). If limit <= 0, defaults to 50.
+func ListTags(db *sql.DB, source string, limit int) ([]TagCount, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	query := `SELECT tag, COUNT(DISTINCT chunk_id) FROM chunk_tags`
+	var args []any
+	if source != "" {
+		query += ` WHERE source = ?`
+		args = append(args, source)
+	}
+	query += ` GROUP BY tag ORDER BY COUNT(DISTINCT chunk_id) DESC, tag LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.Tag, &t.Chunks); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// TaggedChunks returns chunks carrying tag in the same chronological order as History.
+// If limit <= 0, defaults to 20.
+func TaggedChunks(db *sql.DB, tag string, limit int) ([]HistoryResult, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := db.Query(
+		`SELECT id, text, source_file, section_title, parent_title, valid_at, ingested_at
+		 FROM chunks
+		 WHERE id IN (SELECT chunk_id FROM chunk_tags WHERE tag = ?)
+		 ORDER BY CASE WHEN valid_at IS NULL THEN 0 ELSE 1 END, valid_at ASC, section_sequence ASC
+		 LIMIT ?`,
+		normalizeTag(tag), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []HistoryResult{}
+	for rows.Next() {
+		var result HistoryResult
+		var parentTitle, validAt sql.NullString
+		if err := rows.Scan(&result.ID, &result.Text, &result.SourceFile, &result.SectionTitle, &parentTitle, &validAt, &result.IngestedAt); err != nil {
+			return nil, err
+		}
+		result.ParentTitle = parentTitle.String
+		result.ValidAt = validAt.String
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// chunksWithTag returns the ids of chunks carrying tag.
+func chunksWithTag(db *sql.DB, tag string) (map[int64]bool, error) {
+	rows, err := db.Query(`SELECT chunk_id FROM chunk_tags WHERE tag = ?`, normalizeTag(tag))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTopicResponse(t *testing.T) {
+	topics, err := parseTopicResponse(`{"topics": ["Database Migration", "database  migration", "#hiring", "x", "a very long topic label", "travel", "cooking"]}`)
+	if err != nil {
+		t.Fatalf("parseTopicResponse: %v", err)
+	}
+	expected := []string{"database migration", "hiring", "travel"}
+	if strings.Join(topics, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected %q, got %q", expected, topics)
+	}
+}
+
+func TestTagTopics(t *testing.T) {
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req generateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		prompts = append(prompts, req.Prompt)
+		answer := `{"topics": ["database migration"]}`
+		if strings.Contains(req.Prompt, "interview") {
+			answer = `{"topics": ["hiring", "Database Migration"]}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(generateResponse{Response: answer})
+	}))
+	defer server.Close()
+
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	id1 := insertChunk(t, db, "Moving the ledger to Postgres.", "a.md", "One", "", 2, "2025-01-02", vec)
+	id2 := insertChunk(t, db, "Candidate interview about the migration.", "b.md", "Two", "", 2, "2025-01-01", vec)
+
+	client := NewOllamaClient(server.URL, "embed")
+	result, err := TagTopics(context.Background(), db, client, "gen", []int64{id1, id2}, nil)
+	if err != nil {
+		t.Fatalf("TagTopics: %v", err)
+	}
+	if result.ChunksProcessed != 2 || result.TagsCreated != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	// Topics from earlier chunks are offered for reuse
+	if !strings.Contains(prompts[1], "Existing topics: database migration") {
+		t.Fatalf("expected existing topics in prompt, got %q", prompts[1])
+	}
+
+	tags, err := ListTags(db, "", 10)
+	if err != nil {
+		t.Fatalf("ListTags: %v", err)
+	}
+	if len(tags) != 2 || tags[0].Tag != "database migration" || tags[0].Chunks != 2 {
+		t.Fatalf("unexpected tags: %+v", tags)
+	}
+
+	chunks, err := TaggedChunks(db, "Database Migration", 10)
+	if err != nil {
+		t.Fatalf("TaggedChunks: %v", err)
+	}
+	if len(chunks) != 2 || chunks[0].SourceFile != "b.md" {
+		t.Fatalf("expected both chunks oldest first, got %+v", chunks)
+	}
+
+	embedServer := newOllamaServer(t, vec)
+	defer embedServer.Close()
+	results, err := SearchWithOptions(context.Background(), db, NewOllamaClient(embedServer.URL, "embed"), "anything", SearchOptions{Limit: 10, Tag: "hiring"})
+	if err != nil {
+		t.Fatalf("SearchWithOptions: %v", err)
+	}
+	if len(results) != 1 || results[0].SourceFile != "b.md" {
+		t.Fatalf("expected only the hiring chunk, got %+v", results)
+	}
+
+	pending, err := pendingExtractionChunks(db, extractionKindTopics, "")
+	if err != nil {
+		t.Fatalf("pendingExtractionChunks: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected nothing pending, got %v", pending)
+	}
+}
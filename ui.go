@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
 // Colors
@@ -107,6 +109,29 @@ var (
 	infoHighlightStyle = lipgloss.NewStyle().
 				Foreground(cyan).
 				Bold(true)
+
+	// Progress bar
+	progressFillStyle = lipgloss.NewStyle().
+				Foreground(gold)
+
+	progressEmptyStyle = lipgloss.NewStyle().
+				Foreground(dimGray)
+
+	// Browser panes
+	browsePaneStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(dimGray)
+
+	browseFocusedPaneStyle = lipgloss.NewStyle().
+				Border(lipgloss.RoundedBorder()).
+				BorderForeground(amber)
+
+	browseSelectedStyle = lipgloss.NewStyle().
+				Foreground(amber).
+				Bold(true)
+
+	browseErrorStyle = lipgloss.NewStyle().
+				Foreground(red)
 )
 
 // renderHeader prints the mneme watch banner
@@ -124,11 +149,14 @@ func renderSessionItem(index int, title, slug, date string) string {
 	return fmt.Sprintf("%s %s %s %s", num, t, s, d)
 }
 
+// plainOutput renders messages as single lines, for a daemon's log file.
+var plainOutput = false
+
 // renderMessage formats a message in a colored box
 func renderMessage(role, timestamp, text string, isUser bool) string {
-	maxPreview := 200
-	if len(text) > maxPreview {
-		text = text[:maxPreview] + "..."
+	text = truncate(text, 200)
+	if plainOutput {
+		return fmt.Sprintf("%s %s: %s", timestamp, role, strings.Join(strings.Fields(text), " "))
 	}
 
 	var nameStyle lipgloss.Style
@@ -178,3 +206,30 @@ func renderWatchStatus(title, sessionID string, batchSize, pollSec int, dbPath s
 	b.WriteString(infoStyle.Render("  Ctrl+C to stop."))
 	return b.String()
 }
+
+// renderProgress formats a single-line progress bar with counts, ETA and the current item
+func renderProgress(label string, done, total int, eta time.Duration, current string) string {
+	const width = 24
+	filled := 0
+	if total > 0 {
+		filled = done * width / total
+	}
+	bar := progressFillStyle.Render(strings.Repeat("█", filled)) +
+		progressEmptyStyle.Render(strings.Repeat("░", width-filled))
+
+	line := fmt.Sprintf("  %s %s %d/%d eta %s", ingestStyle.Render(label), bar, done, total, formatETA(eta))
+	if current != "" {
+		line += " " + infoStyle.Render(truncate(current, 40))
+	}
+	return line
+}
+
+// truncate shortens s to max terminal columns and marks the cut with "...". It cuts
+// between graphemes, so UTF-8 sequences and emoji stay whole, and counts wide (CJK,
+// emoji) characters as two columns so previews line up inside boxes.
+func truncate(s string, max int) string {
+	if ansi.StringWidth(s) <= max {
+		return s
+	}
+	return ansi.Truncate(s, max, "") + "..."
+}
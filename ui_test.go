@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly ten", 11, "exactly ten"},
+		{"hello world", 5, "hello..."},
+		{"日本語のテキスト", 6, "日本語..."},
+		{"日本語のテキスト", 5, "日本..."},
+		{"ok 👍🏽 done", 4, "ok ..."},
+		{"ok 👍🏽 done", 5, "ok 👍🏽..."},
+		{"café crème", 4, "café..."},
+	} {
+		got := truncate(tc.in, tc.max)
+		if got != tc.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tc.in, tc.max, got, tc.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) split a UTF-8 sequence: %q", tc.in, tc.max, got)
+		}
+	}
+}
+
+func TestRenderMessageWideText(t *testing.T) {
+	text := strings.Repeat("漢字", 200)
+	box := renderMessage("User", "10:00", text, true)
+	if !utf8.ValidString(box) {
+		t.Fatal("rendered box contains invalid UTF-8")
+	}
+	width := ansi.StringWidth(strings.Split(box, "\n")[0])
+	for i, line := range strings.Split(box, "\n") {
+		if w := ansi.StringWidth(line); w != width {
+			t.Fatalf("line %d is %d columns wide, want %d:\n%s", i, w, width, box)
+		}
+	}
+}
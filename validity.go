@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// validAsOf reports whether something valid from validAt until validUntil (exclusive)
+// was true on asOf. Empty bounds are open; an empty asOf matches everything. Each value
+// may be a date or a timestamp and is compared as its date in mnemeLocation.
+func validAsOf(validAt, validUntil, asOf string) bool {
+	if asOf == "" {
+		return true
+	}
+	asOf = dateKey(asOf)
+	if validAt != "" && dateKey(validAt) > asOf {
+		return false
+	}
+	if validUntil != "" && dateKey(validUntil) <= asOf {
+		return false
+	}
+	return true
+}
+
+// SupersedeChunk records that newID replaces oldID. The old chunk's validity ends where
+// the new one's begins (or today, if the new chunk is undated) unless it already ended earlier.
+func SupersedeChunk(db *sql.DB, oldID, newID int64) error {
+	if oldID == newID {
+		return fmt.Errorf("chunk %d cannot supersede itself", oldID)
+	}
+
+	var newValidAt sql.NullString
+	err := db.QueryRow(`SELECT valid_at FROM chunks WHERE id = ?`, newID).Scan(&newValidAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("chunk %d not found", newID)
+	}
+	if err != nil {
+		return err
+	}
+	until := newValidAt.String
+	if until == "" {
+		until = localDate(time.Now())
+	}
+
+	var n int64
+	err = retryBusy("supersede chunk", func() error {
+		res, err := db.Exec(
+			`UPDATE chunks SET superseded_by = ?,
+			   valid_until = CASE WHEN valid_until IS NOT NULL AND valid_until < ? THEN valid_until ELSE ? END
+			 WHERE id = ?`,
+			newID, until, until, oldID,
+		)
+		if err != nil {
+			return err
+		}
+		n, _ = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("chunk %d not found", oldID)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidAsOf(t *testing.T) {
+	cases := []struct {
+		validAt, validUntil, asOf string
+		want                      bool
+	}{
+		{"", "", "2024-06-01", true},
+		{"2024-01-01", "", "2024-06-01", true},
+		{"2025-01-01", "", "2024-06-01", false},
+		{"2024-01-01", "2024-03-01", "2024-06-01", false},
+		{"2024-01-01", "2024-06-01", "2024-06-01", false},
+		{"2024-01-01", "2024-09-01", "2024-06-01", true},
+		{"2025-01-01", "2024-01-01", "", true},
+	}
+	for _, tc := range cases {
+		if got := validAsOf(tc.validAt, tc.validUntil, tc.asOf); got != tc.want {
+			t.Errorf("validAsOf(%q, %q, %q) = %v, want %v", tc.validAt, tc.validUntil, tc.asOf, got, tc.want)
+		}
+	}
+}
+
+func TestSupersedeChunk(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	defer db.Close()
+
+	vec := makeVec(map[int]float32{0: 1})
+	oldID := insertChunk(t, db, "we use MySQL", "a.md", "Old", "", 2, "2024-01-01", vec)
+	newID := insertChunk(t, db, "we switched to Postgres", "b.md", "New", "", 2, "2024-05-01", vec)
+
+	if err := SupersedeChunk(db, oldID, newID); err != nil {
+		t.Fatalf("SupersedeChunk: %v", err)
+	}
+	if err := SupersedeChunk(db, oldID, oldID); err == nil {
+		t.Fatal("expected error superseding a chunk with itself")
+	}
+	if err := SupersedeChunk(db, 9999, newID); err == nil {
+		t.Fatal("expected error for missing chunk")
+	}
+
+	server := newOllamaServer(t, vec)
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	// Before the switch only the old decision was true
+	results, err := Search(context.Background(), db, client, "database", 5, "2024-03-01")
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 1 || results[0].Text != "we use MySQL" || results[0].ValidUntil != "2024-05-01" || results[0].SupersededBy != newID {
+		t.Fatalf("unexpected results before switch: %+v", results)
+	}
+
+	// After it, the old chunk no longer applies
+	results, err = Search(context.Background(), db, client, "database", 5, "2024-08-01")
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 1 || results[0].Text != "we switched to Postgres" {
+		t.Fatalf("unexpected results after switch: %+v", results)
+	}
+}
+
+func TestInitDBAddsValidityColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := legacy.Exec(`CREATE TABLE chunks (
+		id INTEGER PRIMARY KEY, text TEXT NOT NULL, source_file TEXT NOT NULL, section_title TEXT NOT NULL,
+		header_level INTEGER NOT NULL DEFAULT 2, parent_title TEXT, section_sequence INTEGER,
+		chunk_sequence INTEGER, chunk_total INTEGER, valid_at TEXT, ingested_at TEXT NOT NULL,
+		UNIQUE(source_file, section_sequence, chunk_sequence))`); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	legacy.Close()
+
+	db, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`SELECT valid_until, superseded_by FROM chunks`); err != nil {
+		t.Fatalf("validity columns missing after upgrade: %v", err)
+	}
+}
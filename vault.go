@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// wikilink matches Obsidian links: [[Note]], [[folder/Note#Heading|shown text]], and
+// embeds written ![[...]].
+var wikilink = regexp.MustCompile(`(!?)\[\[([^\[\]|#^]*)([#^][^\[\]|]*)?(?:\|([^\[\]]*))?\]\]`)
+
+// resolveWikilinks replaces each wikilink in a note with the plain title of what it
+// links to, so a [[Ada Lovelace|Ada]] reads "Ada Lovelace" and is found as a mention of
+// that entity. A link to a heading of the same note becomes the heading; embedded
+// attachments such as images are dropped. It returns the titles of the linked notes.
+func resolveWikilinks(text string) (string, []string) {
+	var titles []string
+	seen := make(map[string]bool)
+	resolved := wikilink.ReplaceAllStringFunc(text, func(link string) string {
+		m := wikilink.FindStringSubmatch(link)
+		embed, target, anchor := m[1] != "", strings.TrimSpace(m[2]), m[3]
+		if target == "" {
+			return strings.TrimSpace(strings.TrimLeft(anchor, "#^"))
+		}
+		if ext := path.Ext(target); ext != "" && !strings.EqualFold(ext, ".md") {
+			if embed {
+				return ""
+			}
+			return path.Base(target)
+		}
+		title := strings.TrimSuffix(path.Base(target), path.Ext(target))
+		if key := strings.ToLower(title); !seen[key] {
+			seen[key] = true
+			titles = append(titles, title)
+		}
+		return title
+	})
+	return resolved, titles
+}
+
+// vaultExcludes lists what a vault's notes leave out, as DirOptions patterns: hidden
+// folders such as .obsidian and .trash, the templates folder Obsidian's Templates core
+// plugin or the Templater plugin use, and the patterns in .obsidianignore.
+func vaultExcludes(vault string) ([]string, error) {
+	excludes := []string{".*"}
+	for _, setting := range []struct{ file, key string }{
+		{".obsidian/templates.json", "folder"},
+		{".obsidian/plugins/templater-obsidian/data.json", "templates_folder"},
+	} {
+		data, err := os.ReadFile(filepath.Join(vault, setting.file))
+		if err != nil {
+			continue
+		}
+		var config map[string]any
+		if json.Unmarshal(data, &config) != nil {
+			continue
+		}
+		if folder, _ := config[setting.key].(string); strings.Trim(folder, "/") != "" {
+			excludes = append(excludes, vaultPattern(folder))
+		}
+	}
+
+	f, err := os.Open(filepath.Join(vault, ".obsidianignore"))
+	if os.IsNotExist(err) {
+		return excludes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			excludes = append(excludes, vaultPattern(line))
+		}
+	}
+	return excludes, scanner.Err()
+}
+
+// vaultPattern turns a folder or ignore line into a DirOptions pattern: a bare name
+// matches at any depth, a path with a slash from the vault's root.
+func vaultPattern(p string) string {
+	return strings.Trim(filepath.ToSlash(p), "/")
+}
+
+// VaultFiles lists the notes of an Obsidian vault, in path order.
+func VaultFiles(vault string) ([]string, error) {
+	excludes, err := vaultExcludes(vault)
+	if err != nil {
+		return nil, fmt.Errorf("read vault settings: %w", err)
+	}
+	return DirFiles(vault, DirOptions{Include: []string{"*.md"}, Exclude: excludes})
+}
+
+// VaultResult is the outcome of ingesting a vault.
+type VaultResult struct {
+	Files []DirFileResult
+	// Linked counts the distinct notes linked to, NewEntities those not known before.
+	Linked      int
+	NewEntities int
+}
+
+// IngestVault ingests every note of an Obsidian vault as its own source, with wikilinks
+// resolved to plain titles and each note dated by its frontmatter. Linked notes become
+// entities first, so the mention index links the chunks that refer to them. A note that
+// fails is recorded in its result and the rest are still ingested. A note without a
+// frontmatter date falls back on the first date dateFrom yields, as fileValidAt takes it.
+func IngestVault(ctx context.Context, db *sql.DB, ollama *OllamaClient, vault, validAt string, dateFrom []string, chunking ChunkOptions, progress ProgressFunc) (VaultResult, error) {
+	var result VaultResult
+	files, err := VaultFiles(vault)
+	if err != nil {
+		return result, err
+	}
+
+	var titles []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		_, linked := resolveWikilinks(string(data))
+		for _, title := range linked {
+			if name := cleanEntityName(title); name != "" && !seen[strings.ToLower(name)] {
+				seen[strings.ToLower(name)] = true
+				titles = append(titles, name)
+			}
+		}
+	}
+	result.Linked = len(titles)
+	var created []entityName
+	if err := withWriteTx(db, "store linked notes", func(tx *sql.Tx) error {
+		created = nil
+		for _, title := range titles {
+			id, isNew, err := upsertEntity(tx, title, "")
+			if err != nil {
+				return err
+			}
+			if isNew {
+				created = append(created, entityName{id: id, name: title})
+			}
+		}
+		return nil
+	}); err != nil {
+		return result, err
+	}
+	result.NewEntities = len(created)
+
+	for i, file := range files {
+		if progress != nil {
+			progress(i, len(files), file)
+		}
+		var ingested IngestResult
+		fileDate, err := fileValidAt(file, validAt, dateFrom)
+		var note io.ReadCloser
+		if err == nil {
+			note, err = openVaultNote(file)
+		}
+		if err == nil {
+			ingested, err = IngestMarkdown(ctx, db, ollama, file, note, fileDate, chunking, nil)
+			note.Close()
+		}
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Files = append(result.Files, DirFileResult{Path: file, Result: ingested, Err: err})
+	}
+	if progress != nil && len(files) > 0 {
+		progress(len(files), len(files), "")
+	}
+
+	// Notes ingested before may mention the new entities too
+	for _, e := range created {
+		if err := indexEntityMentions(db, e); err != nil {
+			return result, fmt.Errorf("index mentions of %q: %w", e.name, err)
+		}
+	}
+	return result, nil
+}
+
+// openVaultNote opens a note for ingestion with its wikilinks resolved.
+func openVaultNote(file string) (io.ReadCloser, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	text, _ := resolveWikilinks(string(data))
+	return io.NopCloser(strings.NewReader(text)), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestResolveWikilinks(t *testing.T) {
+	text, titles := resolveWikilinks("Met [[Ada Lovelace|Ada]] about [[projects/Engine#Design]], see [[#Open questions]] and [[ada lovelace]].\n![[diagram.png]]![[Engine]] [[report.pdf]]")
+	want := "Met Ada Lovelace about Engine, see Open questions and ada lovelace.\nEngine report.pdf"
+	if text != want {
+		t.Fatalf("got %q, want %q", text, want)
+	}
+	if !reflect.DeepEqual(titles, []string{"Ada Lovelace", "Engine"}) {
+		t.Fatalf("expected the linked notes once each, got %q", titles)
+	}
+	if text, titles := resolveWikilinks("No links, [just brackets]."); text != "No links, [just brackets]." || titles != nil {
+		t.Fatalf("expected text without links untouched, got %q, %q", text, titles)
+	}
+}
+
+func writeVault(t *testing.T, files map[string]string) string {
+	t.Helper()
+	vault := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(vault, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	return vault
+}
+
+func TestVaultFiles(t *testing.T) {
+	vault := writeVault(t, map[string]string{
+		"Home.md":                  "home",
+		"People/Ada.md":            "ada",
+		"Meta/Templates/Daily.md":  "template",
+		"Scripts/Weekly.md":        "templater template",
+		"Archive/Old.md":           "old",
+		"Drafts/idea.md":           "draft",
+		"image.png":                "png",
+		".trash/Deleted.md":        "deleted",
+		".obsidian/templates.json": `{"folder": "Meta/Templates/"}`,
+		".obsidian/plugins/templater-obsidian/data.json": `{"templates_folder": "Scripts"}`,
+		".obsidianignore": "# kept out of memory\nArchive\n/Drafts/\n",
+	})
+	files, err := VaultFiles(vault)
+	if err != nil {
+		t.Fatalf("VaultFiles: %v", err)
+	}
+	var rel []string
+	for _, f := range files {
+		r, _ := filepath.Rel(vault, f)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	if !reflect.DeepEqual(rel, []string{"Home.md", "People/Ada.md"}) {
+		t.Fatalf("expected only the notes, got %q", rel)
+	}
+}
+
+func TestIngestVault(t *testing.T) {
+	withLocation(t, time.UTC)
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+	client := NewOllamaClient(server.URL, "embed")
+
+	vault := writeVault(t, map[string]string{
+		"Daily/2025-06-02.md": "---\ndate: 2025-06-02\n---\nPaired with [[Ada Lovelace|Ada]] on [[Engine#Design]].\n",
+		"Engine.md":           "## Design\n\nGears all the way down.\n",
+	})
+	result, err := IngestVault(context.Background(), db, client, vault, "", nil, defaultChunking, nil)
+	if err != nil {
+		t.Fatalf("IngestVault: %v", err)
+	}
+	if len(result.Files) != 2 || result.Linked != 2 || result.NewEntities != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	for _, f := range result.Files {
+		if f.Err != nil {
+			t.Fatalf("ingest %s: %v", f.Path, f.Err)
+		}
+	}
+
+	var text, validAt string
+	db.QueryRow(`SELECT text, valid_at FROM chunks WHERE source_file = ?`, filepath.Join(vault, "Daily", "2025-06-02.md")).Scan(&text, &validAt)
+	if text != "Paired with Ada Lovelace on Engine." || validAt != "2025-06-02" {
+		t.Fatalf("expected the daily note resolved and dated, got %q at %q", text, validAt)
+	}
+	rows, err := db.Query(`SELECT e.name, COUNT(*) FROM chunk_entities ce JOIN entities e ON e.id = ce.entity_id GROUP BY e.name ORDER BY e.name`)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var links []string
+	for rows.Next() {
+		var name string
+		var chunks int
+		rows.Scan(&name, &chunks)
+		links = append(links, name+"="+strconv.Itoa(chunks))
+	}
+	rows.Close()
+	if !reflect.DeepEqual(links, []string{"Ada Lovelace=1", "Engine=1"}) {
+		t.Fatalf("expected each linked note as an entity of the linking chunk, got %q", links)
+	}
+
+	// Ingesting again finds the entities already known
+	if result, err = IngestVault(context.Background(), db, client, vault, "", nil, defaultChunking, nil); err != nil || result.NewEntities != 0 {
+		t.Fatalf("expected no new entities the second time, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Watchers keeping state in watch_state.
+const (
+	watcherOC     = "watch-oc"
+	watcherCC     = "watch-cc"
+	watcherJSONL  = "watch-jsonl"
+	watcherCursor = "watch-cursor"
+)
+
+// watchOffsetKey holds how far into a JSONL transcript watch-cc or watch-jsonl has
+// ingested.
+const watchOffsetKey = "offset"
+
+// loadWatchState returns what a watcher recorded for a session, nil if it never watched
+// it. watch-oc and watch-cursor key the message IDs they have handled; the JSONL
+// watchers keep watchOffsetKey.
+func loadWatchState(db *sql.DB, watcher, sessionID string) (map[string]string, error) {
+	rows, err := db.Query(`SELECT key, value FROM watch_state WHERE watcher = ? AND session_id = ?`, watcher, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("load watch state: %w", err)
+	}
+	defer rows.Close()
+	var state map[string]string
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		if state == nil {
+			state = make(map[string]string)
+		}
+		state[key] = value
+	}
+	return state, rows.Err()
+}
+
+// saveWatchState records keys for a session, replacing their earlier values. It runs in
+// the transaction that stores the batch they belong to, so a restart neither loses nor
+// repeats the batch.
+func saveWatchState(tx *sql.Tx, watcher, sessionID string, values map[string]string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var args []any
+	for key, value := range values {
+		args = append(args, watcher, sessionID, key, value, now)
+	}
+	for len(args) > 0 {
+		n := min(len(args)/5, multiRowBatch)
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO watch_state (watcher, session_id, key, value, updated_at) VALUES `+valuesPlaceholders(n, 5), args[:n*5]...); err != nil {
+			return fmt.Errorf("save watch state: %w", err)
+		}
+		args = args[n*5:]
+	}
+	return nil
+}
+
+// watchedIDs is a watcher's state as the set of handled message IDs, and whether the
+// session was watched before.
+func watchedIDs(db *sql.DB, watcher, sessionID string) (map[string]bool, bool, error) {
+	state, err := loadWatchState(db, watcher, sessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	done := make(map[string]bool, len(state))
+	for id := range state {
+		done[id] = true
+	}
+	return done, state != nil, nil
+}
+
+// saveWatchedIDs records message IDs a watcher has handled.
+func saveWatchedIDs(tx *sql.Tx, watcher, sessionID string, ids []string) error {
+	values := make(map[string]string, len(ids))
+	for _, id := range ids {
+		values[id] = ""
+	}
+	return saveWatchState(tx, watcher, sessionID, values)
+}
+
+// watchedOffset is the transcript offset a JSONL watcher recorded, and whether it
+// recorded one.
+func watchedOffset(db *sql.DB, watcher, sessionID string) (int64, bool, error) {
+	state, err := loadWatchState(db, watcher, sessionID)
+	if err != nil {
+		return 0, false, err
+	}
+	value, ok := state[watchOffsetKey]
+	if !ok {
+		return 0, false, nil
+	}
+	offset, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("watch state offset %q: %w", value, err)
+	}
+	return offset, true, nil
+}
+
+// saveWatchedOffset records the transcript offset a JSONL watcher has ingested up to.
+func saveWatchedOffset(tx *sql.Tx, watcher, sessionID string, offset int64) error {
+	return saveWatchState(tx, watcher, sessionID, map[string]string{watchOffsetKey: strconv.FormatInt(offset, 10)})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestWatchState(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+
+	if _, watched, err := watchedIDs(db, watcherOC, "s1"); err != nil || watched {
+		t.Fatalf("expected an unwatched session, got %v, %v", watched, err)
+	}
+	if _, watched, err := watchedOffset(db, watcherCC, "c1"); err != nil || watched {
+		t.Fatalf("expected no offset, got %v, %v", watched, err)
+	}
+
+	at := time.Date(2025, time.June, 3, 10, 0, 0, 0, time.UTC)
+	messages := []textMessage{
+		{Role: "User", Text: "Should auth tokens live in Postgres?", Timestamp: at, MessageID: "m1", SessionID: "s1"},
+		{Role: "Assistant", Text: "Yes, with a TTL column.", Timestamp: at.Add(time.Minute), MessageID: "m2", SessionID: "s1"},
+	}
+	save := func(tx *sql.Tx) error {
+		if err := saveWatchedIDs(tx, watcherOC, "s1", []string{"m1", "m2", "tool-call"}); err != nil {
+			return err
+		}
+		return saveWatchedOffset(tx, watcherCC, "c1", 512)
+	}
+
+	// A batch that fails to store records nothing
+	bad := newOllamaServer(t, make([]float32, 3))
+	defer bad.Close()
+	if err := ingestBatch(context.Background(), db, NewOllamaClient(bad.URL, "embed"), "", "watch://s1/batch-0", messages, "Backend", defaultChunking, save); err == nil {
+		t.Fatal("expected the vector insert to fail")
+	}
+	if _, watched, _ := watchedIDs(db, watcherOC, "s1"); watched {
+		t.Fatal("expected no state saved for a failed batch")
+	}
+
+	good := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer good.Close()
+	if err := ingestBatch(context.Background(), db, NewOllamaClient(good.URL, "embed"), "", "watch://s1/batch-0", messages, "Backend", defaultChunking, save); err != nil {
+		t.Fatalf("ingestBatch: %v", err)
+	}
+	done, watched, err := watchedIDs(db, watcherOC, "s1")
+	if err != nil || !watched || len(done) != 3 || !done["m1"] || !done["tool-call"] {
+		t.Fatalf("expected the batch's message IDs, got %v, %v, %v", done, watched, err)
+	}
+	if offset, watched, err := watchedOffset(db, watcherCC, "c1"); err != nil || !watched || offset != 512 {
+		t.Fatalf("expected offset 512, got %d, %v, %v", offset, watched, err)
+	}
+	// Another watcher's session of the same ID is separate
+	if _, watched, _ := watchedIDs(db, watcherOC, "c1"); watched {
+		t.Fatal("expected watch-cc state kept apart from watch-oc")
+	}
+}
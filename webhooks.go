@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events sent to webhooks.
+const (
+	eventBatchIngested    = "batch.ingested"
+	eventFileIngested     = "file.ingested"
+	eventSummaryCreated   = "summary.created"
+	eventConflictDetected = "conflict.detected"
+)
+
+var webhookEvents = []string{eventBatchIngested, eventFileIngested, eventSummaryCreated, eventConflictDetected}
+
+// webhook is one MNEME_WEBHOOKS entry: a URL to POST events to, the events it wants
+// (every event when nil) and whether it takes plain text instead of JSON. host is what
+// logs show of the URL, whose path or query often holds a secret.
+type webhook struct {
+	url    string
+	host   string
+	events map[string]bool
+	text   bool
+}
+
+var webhooks []webhook
+
+// webhookTimeout bounds each POST, so a dead endpoint never holds up a watcher for long.
+var webhookTimeout = 10 * time.Second
+
+// pendingWebhooks tracks POSTs in flight, which waitWebhooks lets finish before exit.
+var pendingWebhooks sync.WaitGroup
+
+// loadWebhooks reads MNEME_WEBHOOKS: whitespace-separated URLs, each optionally
+// prefixed with a comma-separated list of events and "text" and then "=", e.g.
+// "text,conflict.detected=https://ntfy.sh/mneme".
+func loadWebhooks() error {
+	hooks, err := parseWebhooks(os.Getenv("MNEME_WEBHOOKS"))
+	if err != nil {
+		return fmt.Errorf("MNEME_WEBHOOKS: %w", err)
+	}
+	webhooks = hooks
+	return nil
+}
+
+func parseWebhooks(value string) ([]webhook, error) {
+	var hooks []webhook
+	for _, entry := range strings.Fields(value) {
+		hook := webhook{url: entry}
+		// Options come before an "=" that precedes the scheme; later ones belong to the URL
+		if eq, scheme := strings.Index(entry, "="), strings.Index(entry, "://"); eq >= 0 && (scheme < 0 || eq < scheme) {
+			hook.url = entry[eq+1:]
+			for _, option := range strings.Split(entry[:eq], ",") {
+				switch {
+				case option == "text":
+					hook.text = true
+				case slices.Contains(webhookEvents, option):
+					if hook.events == nil {
+						hook.events = make(map[string]bool)
+					}
+					hook.events[option] = true
+				default:
+					return nil, fmt.Errorf("unknown option %q in %q (want text or one of %s)", option, entry, strings.Join(webhookEvents, ", "))
+				}
+			}
+		}
+		if !strings.HasPrefix(hook.url, "http://") && !strings.HasPrefix(hook.url, "https://") {
+			return nil, fmt.Errorf("want an http or https URL, got %q", hook.url)
+		}
+		u, err := url.Parse(hook.url)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("want an http or https URL, got %q", hook.url)
+		}
+		hook.host = u.Host
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// webhookPayload is the JSON body of an event. Text is a one-line summary, which also
+// makes the payload a valid Slack incoming-webhook message.
+type webhookPayload struct {
+	Event string `json:"event"`
+	Time  string `json:"time"`
+	Text  string `json:"text"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// notify POSTs event to every webhook that wants it, in the background. Failures are
+// logged and never affect the operation that raised the event.
+func notify(event, text string, data any) {
+	for _, hook := range webhooks {
+		if hook.events != nil && !hook.events[event] {
+			continue
+		}
+		pendingWebhooks.Add(1)
+		go func(hook webhook) {
+			defer pendingWebhooks.Done()
+			if err := postWebhook(hook, webhookPayload{
+				Event: event,
+				Time:  time.Now().UTC().Format(time.RFC3339),
+				Text:  text,
+				Data:  data,
+			}); err != nil {
+				log.Printf("Warning: webhook %s to %s: %v", event, hook.host, err)
+			}
+		}(hook)
+	}
+}
+
+func postWebhook(hook webhook, payload webhookPayload) error {
+	var body []byte
+	contentType := "application/json"
+	if hook.text {
+		body, contentType = []byte(payload.Text), "text/plain; charset=utf-8"
+	} else {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	// ntfy shows this as the notification title; other endpoints ignore it
+	req.Header.Set("Title", "mneme "+payload.Event)
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		// Without the *url.Error, which quotes the whole URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("answered %s", resp.Status)
+	}
+	return nil
+}
+
+// waitWebhooks waits for events still being sent, so a command does not exit
+// before its notifications go out.
+func waitWebhooks() {
+	pendingWebhooks.Wait()
+}
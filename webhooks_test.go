@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func withWebhooks(t *testing.T, hooks []webhook) {
+	t.Helper()
+	previous := webhooks
+	webhooks = hooks
+	t.Cleanup(func() { webhooks = previous })
+}
+
+func TestParseWebhooks(t *testing.T) {
+	hooks, err := parseWebhooks("https://hooks.example.com/a?token=x  text,conflict.detected,summary.created=https://ntfy.sh/mneme")
+	if err != nil {
+		t.Fatalf("parseWebhooks: %v", err)
+	}
+	if len(hooks) != 2 {
+		t.Fatalf("expected 2 webhooks, got %+v", hooks)
+	}
+	if hooks[0].url != "https://hooks.example.com/a?token=x" || hooks[0].host != "hooks.example.com" || hooks[0].events != nil || hooks[0].text {
+		t.Fatalf("expected the query string kept as part of a plain URL, got %+v", hooks[0])
+	}
+	if hooks[1].url != "https://ntfy.sh/mneme" || !hooks[1].text || !hooks[1].events[eventConflictDetected] || !hooks[1].events[eventSummaryCreated] || hooks[1].events[eventBatchIngested] {
+		t.Fatalf("unexpected options %+v", hooks[1])
+	}
+
+	for _, bad := range []string{"conflicts=https://example.com", "ntfy.sh/mneme"} {
+		if _, err := parseWebhooks(bad); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], r.Header.Get("Content-Type")+" "+string(body))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	withWebhooks(t, []webhook{
+		{url: server.URL + "/all"},
+		{url: server.URL + "/ntfy", text: true, events: map[string]bool{eventConflictDetected: true}},
+	})
+	notify(eventBatchIngested, "Stored 6 messages from Planning", map[string]any{"messages": 6})
+	notify(eventConflictDetected, "Detected contradiction about Alice", nil)
+	waitWebhooks()
+
+	if len(received["/all"]) != 2 {
+		t.Fatalf("expected both events on the unfiltered webhook, got %q", received["/all"])
+	}
+	var payload webhookPayload
+	for _, got := range received["/all"] {
+		if err := json.Unmarshal([]byte(got[len("application/json "):]), &payload); err != nil {
+			t.Fatalf("expected a JSON payload, got %q", got)
+		}
+		if payload.Event == eventBatchIngested && (payload.Text != "Stored 6 messages from Planning" || payload.Data.(map[string]any)["messages"] != float64(6)) {
+			t.Fatalf("unexpected payload %+v", payload)
+		}
+	}
+	if got := received["/ntfy"]; len(got) != 1 || got[0] != "text/plain; charset=utf-8 Detected contradiction about Alice" {
+		t.Fatalf("expected only the conflict, as text, got %q", got)
+	}
+}
+
+func TestPostWebhookHidesURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer server.Close()
+	for _, hook := range []webhook{{url: server.URL + "/hook/SECRET"}, {url: "http://127.0.0.1:1/hook/SECRET"}} {
+		if err := postWebhook(hook, webhookPayload{Event: eventFileIngested}); err == nil || strings.Contains(err.Error(), "SECRET") {
+			t.Fatalf("expected an error without the URL, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxPageBytes is the largest page FetchPage accepts; bigger pages are
+// refused rather than cut short.
+const maxPageBytes = 10 << 20
+
+var (
+	// Page boilerplate: navigation, sidebars, forms and embeds carry no content
+	htmlBoilerplate = regexp.MustCompile(`(?is)<(nav|footer|aside|form|noscript|svg|iframe|button|template)\b.*?</(nav|footer|aside|form|noscript|svg|iframe|button|template)\s*>`)
+	htmlSiteHeader  = regexp.MustCompile(`(?is)<header\b.*?</header\s*>`)
+	htmlComment     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlMain        = regexp.MustCompile(`(?is)<main\b[^>]*>(.*)</main\s*>`)
+	htmlArticle     = regexp.MustCompile(`(?is)<article\b[^>]*>(.*)</article\s*>`)
+	htmlHeading     = regexp.MustCompile(`(?is)<h([1-6])\b[^>]*>(.*?)</h[1-6]\s*>`)
+)
+
+// htmlToMarkdown reduces a web page to markdown that ParseMarkdown splits along the
+// page's headings: h1 and h2 become ## sections, h3 to h6 the headers one level deeper
+// each, as deep as the section depth reaches. Boilerplate is
+// dropped, and when the page marks its content with <main> or <article> only that is
+// kept. A page without an h1 is headed by its title.
+func htmlToMarkdown(page string) string {
+	var title string
+	if m := htmlTitle.FindStringSubmatch(page); m != nil {
+		title = htmlToText(m[1])
+	}
+
+	body := htmlComment.ReplaceAllString(page, "")
+	body = htmlDropped.ReplaceAllString(body, "")
+	content := ""
+	for _, pattern := range []*regexp.Regexp{htmlMain, htmlArticle} {
+		if m := pattern.FindStringSubmatch(body); m != nil {
+			content = m[1]
+			break
+		}
+	}
+	if content == "" {
+		// The site's header is only told apart from an article's by where it sits
+		content = htmlSiteHeader.ReplaceAllString(body, "")
+	}
+	content = htmlBoilerplate.ReplaceAllString(content, "")
+
+	hasH1 := false
+	content = htmlHeading.ReplaceAllStringFunc(content, func(heading string) string {
+		m := htmlHeading.FindStringSubmatch(heading)
+		text := strings.Join(strings.Fields(htmlToText(m[2])), " ")
+		if text == "" {
+			return "\n"
+		}
+		marker := strings.Repeat("#", max(int(m[1][0]-'0'), 2))
+		hasH1 = hasH1 || m[1] == "1"
+		return "\n" + marker + " " + text + "\n"
+	})
+
+	md := htmlToText(content)
+	if !hasH1 && title != "" {
+		md = "## " + title + "\n\n" + md
+	}
+	return md + "\n"
+}
+
+// isHTMLFile reports whether a file is ingested as a web page rather than markdown.
+func isHTMLFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".xhtml":
+		return true
+	}
+	return false
+}
+
+// FetchPage downloads a web page as markdown for ingestion. HTML is converted by
+// htmlToMarkdown; plain text and markdown are taken as they are.
+func FetchPage(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("fetch %s: %w", url, err)
+	}
+	req.Header.Set("User-Agent", "mneme/"+Version)
+	req.Header.Set("Accept", "text/html, text/markdown;q=0.9, text/plain;q=0.8")
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("fetch %s: %w", url, err)
+	}
+	if len(data) > maxPageBytes {
+		return "", fmt.Errorf("fetch %s: page is over the %d MB limit", url, maxPageBytes>>20)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "":
+		return htmlToMarkdown(string(data)), nil
+	case "text/plain", "text/markdown", "text/x-markdown":
+		return string(data), nil
+	}
+	return "", fmt.Errorf("fetch %s: %s is not a web page", url, mediaType)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPage = `<!DOCTYPE html>
+<html><head><title>Token rotation | Eng blog</title><style>body { color: red }</style></head>
+<body>
+<header><a href="/">Eng blog</a></header>
+<nav><ul><li>Home</li><li>Archive</li></ul></nav>
+<main>
+  <h1>Rotating <em>auth</em> tokens</h1>
+  <p>We rotate tokens weekly.</p>
+  <!-- tracking pixel -->
+  <h2>Storage</h2>
+  <p>Tokens live in Postgres with a TTL column.</p>
+  <h3>Signing keys</h3>
+  <ul><li>Kept in the vault</li><li>Rotated monthly</li></ul>
+  <form><button>Subscribe</button></form>
+</main>
+<footer>© 2025</footer>
+<script>track()</script>
+</body></html>`
+
+func TestHTMLToMarkdown(t *testing.T) {
+	sections := ParseMarkdown(htmlToMarkdown(testPage))
+	if len(sections) != 3 {
+		t.Fatalf("expected 3 sections, got %+v", sections)
+	}
+	if s := sections[0]; s.Title != "Rotating auth tokens" || s.HeaderLevel != 2 || s.Content != "We rotate tokens weekly." {
+		t.Fatalf("unexpected first section %+v", s)
+	}
+	if s := sections[2]; s.Title != "Signing keys" || s.HeaderLevel != 3 || s.ParentTitle != "Storage" || s.Content != "- Kept in the vault\n- Rotated monthly" {
+		t.Fatalf("unexpected subsection %+v", s)
+	}
+	md := htmlToMarkdown(testPage)
+	for _, boilerplate := range []string{"Archive", "Subscribe", "2025", "track", "tracking", "color"} {
+		if strings.Contains(md, boilerplate) {
+			t.Fatalf("expected %q dropped, got:\n%s", boilerplate, md)
+		}
+	}
+
+	// Without <main> the site header goes; without an h1 the title heads the page
+	md = htmlToMarkdown(`<html><head><title>Notes</title></head><body><header>Site</header><p>Intro</p><h2>Later</h2><p>More</p></body></html>`)
+	sections = ParseMarkdown(md)
+	if len(sections) != 2 || sections[0].Title != "Notes" || sections[0].Content != "Intro" || strings.Contains(md, "Site") {
+		t.Fatalf("unexpected sections %+v from:\n%s", sections, md)
+	}
+}
+
+func TestFetchPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/post":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(testPage))
+		case "/notes.md":
+			w.Header().Set("Content-Type", "text/markdown")
+			w.Write([]byte("## Plain\n\n<b>kept</b>\n"))
+		case "/huge":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(bytes.Repeat([]byte("a"), maxPageBytes+1))
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	md, err := FetchPage(context.Background(), server.URL+"/post")
+	if err != nil || !strings.HasPrefix(md, "## Rotating auth tokens") {
+		t.Fatalf("expected the page as markdown, got %q, %v", md, err)
+	}
+	if md, err := FetchPage(context.Background(), server.URL+"/notes.md"); err != nil || md != "## Plain\n\n<b>kept</b>\n" {
+		t.Fatalf("expected markdown as it is, got %q, %v", md, err)
+	}
+	for _, path := range []string{"/image.png", "/missing", "/huge"} {
+		if _, err := FetchPage(context.Background(), server.URL+path); err == nil {
+			t.Fatalf("expected an error for %s", path)
+		}
+	}
+}
+
+func TestIngestHTMLFile(t *testing.T) {
+	db, err := InitDB(":memory:")
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	server := newOllamaServer(t, makeVec(map[int]float32{0: 1}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "post.html")
+	if err := os.WriteFile(path, []byte(testPage), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	result, err := IngestFile(context.Background(), db, NewOllamaClient(server.URL, "embed"), path, "", defaultChunking)
+	if err != nil || result.SectionsFound != 3 {
+		t.Fatalf("expected the page's 3 sections, got %+v, %v", result, err)
+	}
+	var title string
+	db.QueryRow(`SELECT section_title FROM chunks WHERE source_file = ? ORDER BY section_sequence LIMIT 1`, path).Scan(&title)
+	if title != "Rotating auth tokens" {
+		t.Fatalf("expected the page's heading as the section title, got %q", title)
+	}
+}